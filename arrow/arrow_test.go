@@ -0,0 +1,203 @@
+package arrow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fbReader reads tables out of a flatbuffer, enough to check what
+// WriteStream produced
+type fbReader []byte
+
+func (b fbReader) u32(pos int) int { return int(binary.LittleEndian.Uint32(b[pos:])) }
+
+func (b fbReader) root() int { return b.u32(0) }
+
+// field returns the position of field id in the table at pos, or 0 if absent
+func (b fbReader) field(table, id int) int {
+	vt := table - int(int32(b.u32(table)))
+	if 4+2*id >= int(binary.LittleEndian.Uint16(b[vt:])) {
+		return 0
+	}
+	off := int(binary.LittleEndian.Uint16(b[vt+4+2*id:]))
+	if off == 0 {
+		return 0
+	}
+	return table + off
+}
+
+func (b fbReader) ref(table, id int) int {
+	p := b.field(table, id)
+	return p + b.u32(p)
+}
+
+func (b fbReader) int64(table, id int) int64 {
+	return int64(binary.LittleEndian.Uint64(b[b.field(table, id):]))
+}
+
+func (b fbReader) str(table, id int) string {
+	p := b.ref(table, id)
+	return string(b[p+4 : p+4+b.u32(p)])
+}
+
+// vector returns the length and the position of the first element
+func (b fbReader) vector(table, id int) (int, int) {
+	p := b.ref(table, id)
+	return b.u32(p), p + 4
+}
+
+// readMessage reads one encapsulated message; it returns nil metadata at the
+// end of the stream
+func readMessage(t *testing.T, r io.Reader) (fbReader, []byte) {
+	t.Helper()
+	var prefix [8]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		t.Fatal(err)
+	}
+	if binary.LittleEndian.Uint32(prefix[:]) != 0xFFFFFFFF {
+		t.Fatalf("missing continuation marker: %x", prefix)
+	}
+	size := binary.LittleEndian.Uint32(prefix[4:])
+	if size == 0 {
+		return nil, nil
+	}
+	if size%8 != 0 {
+		t.Fatalf("metadata size %d is not a multiple of 8", size)
+	}
+	meta := make(fbReader, size)
+	io.ReadFull(r, meta)
+	body := make([]byte, meta.int64(meta.root(), 3))
+	io.ReadFull(r, body)
+	return meta, body
+}
+
+func TestWriteStream(t *testing.T) {
+	fields := []Field{{"name", Utf8}, {"age", Int64}, {"score", Float64}, {"active", Bool}}
+	rows := [][]any{
+		{"Ann", int64(31), 1.5, true},
+		{nil, int64(-2), nil, false},
+		{"Zoë", nil, math.Inf(1), nil},
+	}
+	var buf bytes.Buffer
+	if err := WriteStream(&buf, fields, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	// schema
+	meta, _ := readMessage(t, &buf)
+	msg := meta.root()
+	if v := binary.LittleEndian.Uint16(meta[meta.field(msg, 0):]); v != metadataV5 {
+		t.Errorf("version %d", v)
+	}
+	if h := meta[meta.field(msg, 1)]; h != headerSchema {
+		t.Fatalf("header type %d, want schema", h)
+	}
+	n, first := meta.vector(meta.ref(msg, 2), 1)
+	if n != len(fields) {
+		t.Fatalf("%d fields", n)
+	}
+	wantTypes := []byte{typeUtf8, typeInt, typeFloatingPoint, typeBool}
+	for i := range n {
+		f := first + 4*i + meta.u32(first+4*i)
+		if name := meta.str(f, 0); name != fields[i].Name {
+			t.Errorf("field %d: name %q", i, name)
+		}
+		if typ := meta[meta.field(f, 2)]; typ != wantTypes[i] {
+			t.Errorf("field %d: type %d", i, typ)
+		}
+		if children, _ := meta.vector(f, 5); children != 0 {
+			t.Errorf("field %d: %d children", i, children)
+		}
+	}
+
+	// record batch
+	meta, body := readMessage(t, &buf)
+	msg = meta.root()
+	if h := meta[meta.field(msg, 1)]; h != headerRecordBatch {
+		t.Fatalf("header type %d, want record batch", h)
+	}
+	batch := meta.ref(msg, 2)
+	if length := meta.int64(batch, 0); length != 3 {
+		t.Errorf("length %d", length)
+	}
+	nNodes, nodes := meta.vector(batch, 1)
+	nBufs, bufs := meta.vector(batch, 2)
+	if nNodes != 4 || nBufs != 9 || nodes%8 != 0 || bufs%8 != 0 {
+		t.Fatalf("%d nodes at %d, %d buffers at %d", nNodes, nodes, nBufs, bufs)
+	}
+	var nulls []int64
+	for i := range nNodes {
+		nulls = append(nulls, int64(binary.LittleEndian.Uint64(meta[nodes+16*i+8:])))
+	}
+	if !reflect.DeepEqual(nulls, []int64{1, 1, 1, 1}) {
+		t.Errorf("null counts %v", nulls)
+	}
+	buffer := func(i int) []byte {
+		off := binary.LittleEndian.Uint64(meta[bufs+16*i:])
+		if off%8 != 0 {
+			t.Errorf("buffer %d at unaligned offset %d", i, off)
+		}
+		return body[off : off+binary.LittleEndian.Uint64(meta[bufs+16*i+8:])]
+	}
+
+	if v := buffer(0); v[0] != 0b101 {
+		t.Errorf("name validity %b", v[0])
+	}
+	offsets, text := buffer(1), buffer(2)
+	var names []string
+	for i := range 3 {
+		names = append(names, string(text[binary.LittleEndian.Uint32(offsets[4*i:]):binary.LittleEndian.Uint32(offsets[4*i+4:])]))
+	}
+	if !reflect.DeepEqual(names, []string{"Ann", "", "Zoë"}) {
+		t.Errorf("names %q", names)
+	}
+	if ages := buffer(4); int64(binary.LittleEndian.Uint64(ages[8:])) != -2 {
+		t.Errorf("ages %x", ages)
+	}
+	if scores := buffer(6); math.Float64frombits(binary.LittleEndian.Uint64(scores)) != 1.5 ||
+		!math.IsInf(math.Float64frombits(binary.LittleEndian.Uint64(scores[16:])), 1) {
+		t.Errorf("scores %x", scores)
+	}
+	if v, active := buffer(7), buffer(8); v[0] != 0b011 || active[0] != 0b001 {
+		t.Errorf("active validity %b, values %b", v[0], active[0])
+	}
+
+	if meta, _ := readMessage(t, &buf); meta != nil || buf.Len() != 0 {
+		t.Errorf("expected the end of the stream, %d bytes left", buf.Len())
+	}
+}
+
+func TestWriteStreamBatches(t *testing.T) {
+	rows := make([][]any, BatchSize+1)
+	for i := range rows {
+		rows[i] = []any{int64(i)}
+	}
+	var buf bytes.Buffer
+	if err := WriteStream(&buf, []Field{{"n", Int64}}, rows); err != nil {
+		t.Fatal(err)
+	}
+	readMessage(t, &buf)
+	var lengths []int64
+	for {
+		meta, _ := readMessage(t, &buf)
+		if meta == nil {
+			break
+		}
+		lengths = append(lengths, meta.int64(meta.ref(meta.root(), 2), 0))
+	}
+	if !reflect.DeepEqual(lengths, []int64{BatchSize, 1}) {
+		t.Errorf("batch lengths %v", lengths)
+	}
+}
+
+func TestWriteStreamTypeMismatch(t *testing.T) {
+	err := WriteStream(io.Discard, []Field{{"age", Int64}}, [][]any{{"31"}})
+	if err == nil || !strings.Contains(err.Error(), "column age") {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package arrow
+
+import "encoding/binary"
+
+// A minimal FlatBuffers encoder, enough for Arrow IPC metadata. Objects are
+// written front to back: a table comes first and the objects it refers to
+// follow it, which keeps every offset positive as the format requires.
+
+// fbObject is anything a table field can refer to
+type fbObject interface {
+	// write appends the object to b and returns the position that refers to it
+	write(b *fbBuilder) int
+}
+
+// fbField is one table field: a scalar of 1, 2, 4 or 8 bytes, an offset to a
+// child object, or absent (the zero value)
+type fbField struct {
+	size int
+	bits uint64
+	ref  fbObject
+}
+
+func fbUint8(v uint8) fbField  { return fbField{size: 1, bits: uint64(v)} }
+func fbInt16(v int16) fbField  { return fbField{size: 2, bits: uint64(uint16(v))} }
+func fbInt32(v int32) fbField  { return fbField{size: 4, bits: uint64(uint32(v))} }
+func fbInt64(v int64) fbField  { return fbField{size: 8, bits: uint64(v)} }
+func fbRef(o fbObject) fbField { return fbField{size: 4, ref: o} }
+
+func fbBool(v bool) fbField {
+	if v {
+		return fbUint8(1)
+	}
+	return fbUint8(0)
+}
+
+// fbTable is a table; field i has the i-th id of the schema
+type fbTable []fbField
+
+// fbString is a string
+type fbString string
+
+// fbTables is a vector of tables
+type fbTables []fbTable
+
+// fbStructs is a vector of structs of 8-byte-aligned fields, e.g. Arrow's
+// FieldNode and Buffer, each given as its int64 members
+type fbStructs [][]int64
+
+type fbBuilder struct {
+	buf []byte
+}
+
+// fbFinish encodes root as a complete buffer
+func fbFinish(root fbTable) []byte {
+	b := &fbBuilder{buf: make([]byte, 4, 256)}
+	pos := root.write(b)
+	binary.LittleEndian.PutUint32(b.buf, uint32(pos))
+	return b.buf
+}
+
+func (b *fbBuilder) pad(align int) {
+	for len(b.buf)%align != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+// patch points the uoffset at pos to target
+func (b *fbBuilder) patch(pos, target int) {
+	binary.LittleEndian.PutUint32(b.buf[pos:], uint32(target-pos))
+}
+
+func (t fbTable) write(b *fbBuilder) int {
+	// lay the fields out after the 4-byte vtable offset, largest first so
+	// that each is naturally aligned
+	offsets := make([]int, len(t))
+	size := 4
+	for _, width := range []int{8, 4, 2, 1} {
+		for i, f := range t {
+			if f.size != width {
+				continue
+			}
+			for size%width != 0 {
+				size++
+			}
+			offsets[i] = size
+			size += width
+		}
+	}
+
+	// the vtable sits just before the table, which starts 8-byte aligned
+	b.pad(2)
+	vt := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(4+2*len(t)))
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(size))
+	for _, off := range offsets {
+		b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(off))
+	}
+	b.pad(8)
+	start := len(b.buf)
+	b.buf = append(b.buf, make([]byte, size)...)
+	binary.LittleEndian.PutUint32(b.buf[start:], uint32(start-vt))
+
+	for i, f := range t {
+		p := start + offsets[i]
+		switch f.size {
+		case 1:
+			b.buf[p] = byte(f.bits)
+		case 2:
+			binary.LittleEndian.PutUint16(b.buf[p:], uint16(f.bits))
+		case 4:
+			binary.LittleEndian.PutUint32(b.buf[p:], uint32(f.bits))
+		case 8:
+			binary.LittleEndian.PutUint64(b.buf[p:], f.bits)
+		}
+	}
+	for i, f := range t {
+		if f.ref != nil {
+			b.patch(start+offsets[i], f.ref.write(b))
+		}
+	}
+	return start
+}
+
+func (s fbString) write(b *fbBuilder) int {
+	b.pad(4)
+	pos := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(s)))
+	b.buf = append(b.buf, s...)
+	b.buf = append(b.buf, 0)
+	return pos
+}
+
+func (v fbTables) write(b *fbBuilder) int {
+	b.pad(4)
+	pos := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(v)))
+	slots := len(b.buf)
+	b.buf = append(b.buf, make([]byte, 4*len(v))...)
+	for i, t := range v {
+		b.patch(slots+4*i, t.write(b))
+	}
+	return pos
+}
+
+func (v fbStructs) write(b *fbBuilder) int {
+	// the elements must be 8-byte aligned, so the length goes just before
+	for len(b.buf)%8 != 4 {
+		b.buf = append(b.buf, 0)
+	}
+	pos := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(v)))
+	for _, s := range v {
+		for _, n := range s {
+			b.buf = binary.LittleEndian.AppendUint64(b.buf, uint64(n))
+		}
+	}
+	return pos
+}
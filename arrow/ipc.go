@@ -0,0 +1,205 @@
+// Package arrow writes tabular results in the Apache Arrow IPC stream format,
+// which pandas, polars and DataFusion read without copying or parsing rows
+package arrow
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// MIMEType is the media type of an Arrow IPC stream
+const MIMEType = "application/vnd.apache.arrow.stream"
+
+// Type is a column type
+type Type uint8
+
+const (
+	Utf8 Type = iota
+	Int64
+	Float64
+	Bool
+)
+
+func (t Type) String() string {
+	switch t {
+	case Int64:
+		return "int64"
+	case Float64:
+		return "float64"
+	case Bool:
+		return "bool"
+	}
+	return "utf8"
+}
+
+// Field is a nullable column
+type Field struct {
+	Name string
+	Type Type
+}
+
+// BatchSize is the number of rows per record batch
+const BatchSize = 64 * 1024
+
+// flatbuffer enum values from the Arrow format's Schema.fbs and Message.fbs
+const (
+	metadataV5        = 4
+	headerSchema      = 1
+	headerRecordBatch = 3
+	typeInt           = 2
+	typeFloatingPoint = 3
+	typeUtf8          = 5
+	typeBool          = 6
+	precisionDouble   = 2
+)
+
+// WriteStream writes a schema message, the rows in record batches of up to
+// BatchSize rows and the end-of-stream marker. Each value must be nil, for a
+// null, or match its column: an int64, float64, bool or string.
+func WriteStream(w io.Writer, fields []Field, rows [][]any) error {
+	if err := writeMessage(w, headerSchema, schema(fields), nil); err != nil {
+		return err
+	}
+	for start := 0; start < len(rows); start += BatchSize {
+		batch := rows[start:min(start+BatchSize, len(rows))]
+		header, body, err := recordBatch(fields, batch)
+		if err != nil {
+			return err
+		}
+		if err := writeMessage(w, headerRecordBatch, header, body); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0, 0})
+	return err
+}
+
+// writeMessage writes an encapsulated message: the continuation marker, the
+// metadata length, the Message flatbuffer padded to 8 bytes, then the body
+func writeMessage(w io.Writer, headerType uint8, header fbTable, body []byte) error {
+	meta := fbFinish(fbTable{
+		fbInt16(metadataV5),
+		fbUint8(headerType),
+		fbRef(header),
+		fbInt64(int64(len(body))),
+	})
+	for len(meta)%8 != 0 {
+		meta = append(meta, 0)
+	}
+	prefix := binary.LittleEndian.AppendUint32([]byte{0xFF, 0xFF, 0xFF, 0xFF}, uint32(len(meta)))
+	for _, b := range [][]byte{prefix, meta, body} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func schema(fields []Field) fbTable {
+	fs := make(fbTables, len(fields))
+	for i, f := range fields {
+		var typeID uint8
+		var typ fbTable
+		switch f.Type {
+		case Int64:
+			typeID, typ = typeInt, fbTable{fbInt32(64), fbBool(true)}
+		case Float64:
+			typeID, typ = typeFloatingPoint, fbTable{fbInt16(precisionDouble)}
+		case Bool:
+			typeID, typ = typeBool, fbTable{}
+		default:
+			typeID, typ = typeUtf8, fbTable{}
+		}
+		fs[i] = fbTable{
+			fbRef(fbString(f.Name)),
+			fbBool(true),
+			fbUint8(typeID),
+			fbRef(typ),
+			{}, // dictionary
+			fbRef(fbTables{}),
+		}
+	}
+	return fbTable{fbInt16(0), fbRef(fs)} // little endian
+}
+
+// recordBatch lays the columns out as a body and describes them in a
+// RecordBatch header. Every column has a validity bitmap and its data; utf8
+// columns also have offsets.
+func recordBatch(fields []Field, rows [][]any) (fbTable, []byte, error) {
+	var body []byte
+	var nodes, buffers fbStructs
+	addBuffer := func(b []byte) {
+		buffers = append(buffers, []int64{int64(len(body)), int64(len(b))})
+		body = append(body, b...)
+		for len(body)%8 != 0 {
+			body = append(body, 0)
+		}
+	}
+
+	n := len(rows)
+	for col, f := range fields {
+		validity := make([]byte, (n+7)/8)
+		nulls := 0
+		var data, offsets []byte
+		switch f.Type {
+		case Int64, Float64:
+			data = make([]byte, 8*n)
+		case Bool:
+			data = make([]byte, (n+7)/8)
+		default:
+			offsets = make([]byte, 4, 4*(n+1))
+		}
+
+		for i, row := range rows {
+			v := row[col]
+			if v == nil {
+				nulls++
+				if offsets != nil {
+					offsets = binary.LittleEndian.AppendUint32(offsets, uint32(len(data)))
+				}
+				continue
+			}
+			validity[i/8] |= 1 << (i % 8)
+			ok := false
+			switch f.Type {
+			case Int64:
+				var x int64
+				if x, ok = v.(int64); ok {
+					binary.LittleEndian.PutUint64(data[8*i:], uint64(x))
+				}
+			case Float64:
+				var x float64
+				if x, ok = v.(float64); ok {
+					binary.LittleEndian.PutUint64(data[8*i:], math.Float64bits(x))
+				}
+			case Bool:
+				var x bool
+				if x, ok = v.(bool); ok && x {
+					data[i/8] |= 1 << (i % 8)
+				}
+			default:
+				var s string
+				if s, ok = v.(string); ok {
+					data = append(data, s...)
+					if len(data) > math.MaxInt32 {
+						return nil, nil, fmt.Errorf("column %s: more than 2 GiB of text in one batch", f.Name)
+					}
+					offsets = binary.LittleEndian.AppendUint32(offsets, uint32(len(data)))
+				}
+			}
+			if !ok {
+				return nil, nil, fmt.Errorf("column %s: %T value in a %s column", f.Name, v, f.Type)
+			}
+		}
+
+		nodes = append(nodes, []int64{int64(n), int64(nulls)})
+		addBuffer(validity)
+		if offsets != nil {
+			addBuffer(offsets)
+		}
+		addBuffer(data)
+	}
+	return fbTable{fbInt64(int64(n)), fbRef(nodes), fbRef(buffers)}, body, nil
+}
@@ -0,0 +1,147 @@
+// Package bolt implements the parts of the Neo4j Bolt protocol (version 4.x)
+// that let existing Neo4j drivers talk to grapho: the handshake, message
+// chunking and PackStream encoding. The server side lives in package server.
+package bolt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Request and response message tags
+const (
+	MsgHello    byte = 0x01
+	MsgGoodbye  byte = 0x02
+	MsgReset    byte = 0x0F
+	MsgRun      byte = 0x10
+	MsgBegin    byte = 0x11
+	MsgCommit   byte = 0x12
+	MsgRollback byte = 0x13
+	MsgDiscard  byte = 0x2F
+	MsgPull     byte = 0x3F
+	MsgRoute    byte = 0x66
+
+	MsgSuccess byte = 0x70
+	MsgRecord  byte = 0x71
+	MsgIgnored byte = 0x7E
+	MsgFailure byte = 0x7F
+)
+
+// TagNode is the structure tag of a node value: id, labels, properties
+const TagNode byte = 'N'
+
+// magic opens every Bolt connection
+var magic = []byte{0x60, 0x60, 0xB0, 0x17}
+
+// Version is a negotiated protocol version
+type Version struct {
+	Major, Minor byte
+}
+
+func (v Version) String() string { return fmt.Sprintf("%d.%d", v.Major, v.Minor) }
+
+// supported is the range of versions the server speaks
+const (
+	supportedMajor    = 4
+	supportedMaxMinor = 4
+)
+
+// ErrNoVersion means the client proposed no version the server speaks
+var ErrNoVersion = errors.New("bolt: no supported protocol version proposed")
+
+// Handshake performs the server side of the handshake: it reads the magic
+// preamble and four version proposals and answers with the chosen version.
+func Handshake(rw io.ReadWriter) (Version, error) {
+	var buf [20]byte
+	if _, err := io.ReadFull(rw, buf[:]); err != nil {
+		return Version{}, err
+	}
+	if !bytes.Equal(buf[:4], magic) {
+		return Version{}, errors.New("bolt: bad magic preamble")
+	}
+	for i := 4; i < 20; i += 4 {
+		// each proposal is [reserved, range, minor, major]: minor down to
+		// minor-range are all acceptable
+		span, minor, major := buf[i+1], buf[i+2], buf[i+3]
+		if major != supportedMajor {
+			continue
+		}
+		low := int(minor) - int(span)
+		chosen := min(minor, supportedMaxMinor)
+		if int(chosen) >= low {
+			v := Version{Major: major, Minor: chosen}
+			_, err := rw.Write([]byte{0, 0, v.Minor, v.Major})
+			return v, err
+		}
+	}
+	rw.Write([]byte{0, 0, 0, 0})
+	return Version{}, ErrNoVersion
+}
+
+// ReadMessage reads one chunked message
+func ReadMessage(r io.Reader) ([]byte, error) {
+	var (
+		msg  []byte
+		size [2]byte
+	)
+	for {
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return nil, err
+		}
+		n := binary.BigEndian.Uint16(size[:])
+		if n == 0 {
+			if len(msg) == 0 {
+				continue // a no-op chunk, sent as a keep-alive
+			}
+			return msg, nil
+		}
+		start := len(msg)
+		msg = append(msg, make([]byte, n)...)
+		if _, err := io.ReadFull(r, msg[start:]); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// WriteMessage writes msg in chunks followed by the end marker
+func WriteMessage(w io.Writer, msg []byte) error {
+	out := make([]byte, 0, len(msg)+2*(len(msg)/0xFFFF+2))
+	for len(msg) > 0 {
+		n := min(len(msg), 0xFFFF)
+		out = binary.BigEndian.AppendUint16(out, uint16(n))
+		out = append(out, msg[:n]...)
+		msg = msg[n:]
+	}
+	out = append(out, 0, 0)
+	_, err := w.Write(out)
+	return err
+}
+
+// Send packs a message structure and writes it
+func Send(w io.Writer, tag byte, fields ...any) error {
+	b, err := Pack(nil, Struct{Tag: tag, Fields: fields})
+	if err != nil {
+		return err
+	}
+	return WriteMessage(w, b)
+}
+
+// Receive reads and unpacks one message structure
+func Receive(r io.Reader) (Struct, error) {
+	b, err := ReadMessage(r)
+	if err != nil {
+		return Struct{}, err
+	}
+	v, err := Unpack(b)
+	if err != nil {
+		return Struct{}, err
+	}
+	s, ok := v.(Struct)
+	if !ok {
+		return Struct{}, fmt.Errorf("bolt: message is a %T, not a structure", v)
+	}
+	return s, nil
+}
@@ -0,0 +1,108 @@
+package bolt
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPackRoundTrip(t *testing.T) {
+	values := []any{
+		nil, true, false,
+		int64(0), int64(-16), int64(127), int64(-17), int64(128), int64(-129),
+		int64(40000), int64(-40000), int64(math.MaxInt32 + 1), int64(math.MinInt64),
+		3.25, "", "hello", strings.Repeat("x", 300), strings.Repeat("y", 70000),
+		[]byte{1, 2, 3},
+		[]any{int64(1), "two", []any{}},
+		map[string]any{"a": int64(1), "b": map[string]any{"c": nil}},
+		Struct{Tag: TagNode, Fields: []any{int64(7), []any{"Person"}, map[string]any{"name": "Ann"}}},
+	}
+	for _, v := range values {
+		b, err := Pack(nil, v)
+		if err != nil {
+			t.Fatalf("pack %v: %v", v, err)
+		}
+		got, err := Unpack(b)
+		if err != nil {
+			t.Fatalf("unpack %v: %v", v, err)
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Errorf("round trip: got %#v, want %#v", got, v)
+		}
+	}
+
+	// Go integers and string slices pack as their PackStream equivalents
+	b, _ := Pack(nil, []string{"a"})
+	if got, _ := Unpack(b); !reflect.DeepEqual(got, []any{"a"}) {
+		t.Errorf("[]string: got %#v", got)
+	}
+	if b, _ := Pack(nil, 1); !bytes.Equal(b, []byte{0x01}) {
+		t.Errorf("tiny int: % X", b)
+	}
+	if _, err := Pack(nil, struct{}{}); err == nil {
+		t.Error("expected error packing a Go struct")
+	}
+	if _, err := Unpack([]byte{0xD0, 5, 'a'}); err == nil {
+		t.Error("expected error on truncated string")
+	}
+}
+
+func TestChunking(t *testing.T) {
+	var buf bytes.Buffer
+	big := bytes.Repeat([]byte{0xAB}, 0xFFFF+10)
+	buf.Write([]byte{0, 0}) // keep-alive no-op chunk
+	if err := WriteMessage(&buf, big); err != nil {
+		t.Fatal(err)
+	}
+	if err := Send(&buf, MsgSuccess, map[string]any{"fields": []any{"n"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadMessage(&buf)
+	if err != nil || !bytes.Equal(got, big) {
+		t.Fatalf("big message: %d bytes, %v", len(got), err)
+	}
+	msg, err := Receive(&buf)
+	if err != nil || msg.Tag != MsgSuccess {
+		t.Fatalf("receive: %#v %v", msg, err)
+	}
+	if _, err := ReadMessage(&buf); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+// pipe reads a canned client handshake and records the answer
+type pipe struct {
+	io.Reader
+	out bytes.Buffer
+}
+
+func (p *pipe) Write(b []byte) (int, error) { return p.out.Write(b) }
+
+func TestHandshake(t *testing.T) {
+	tests := []struct {
+		proposals []byte
+		want      Version
+		err       bool
+	}{
+		// 5.4 first, then 4.4 with range 3
+		{[]byte{0, 0, 4, 5, 0, 3, 4, 4, 0, 0, 0, 0, 0, 0, 0, 0}, Version{4, 4}, false},
+		// a newer 4.x minor is answered with 4.4 when its range reaches it
+		{[]byte{0, 2, 6, 4, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, Version{4, 4}, false},
+		{[]byte{0, 0, 1, 4, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, Version{4, 1}, false},
+		{[]byte{0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, Version{}, true},
+	}
+	for _, tt := range tests {
+		p := &pipe{Reader: bytes.NewReader(append([]byte{0x60, 0x60, 0xB0, 0x17}, tt.proposals...))}
+		v, err := Handshake(p)
+		if (err != nil) != tt.err || v != tt.want {
+			t.Errorf("% X: got %v %v, want %v", tt.proposals, v, err, tt.want)
+		}
+		if want := []byte{0, 0, tt.want.Minor, tt.want.Major}; !bytes.Equal(p.out.Bytes(), want) {
+			t.Errorf("% X: answered % X, want % X", tt.proposals, p.out.Bytes(), want)
+		}
+	}
+}
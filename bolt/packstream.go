@@ -0,0 +1,333 @@
+package bolt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Struct is a PackStream structure: a tag byte and its fields. Bolt messages
+// and graph values such as nodes are structures.
+type Struct struct {
+	Tag    byte
+	Fields []any
+}
+
+// Pack appends the PackStream encoding of v to b. v may be nil, bool, any Go
+// integer type, float32/64, string, []byte, []any, []string,
+// map[string]any or Struct.
+func Pack(b []byte, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xC0), nil
+	case bool:
+		if v {
+			return append(b, 0xC3), nil
+		}
+		return append(b, 0xC2), nil
+	case int:
+		return packInt(b, int64(v)), nil
+	case int8:
+		return packInt(b, int64(v)), nil
+	case int16:
+		return packInt(b, int64(v)), nil
+	case int32:
+		return packInt(b, int64(v)), nil
+	case int64:
+		return packInt(b, v), nil
+	case uint8:
+		return packInt(b, int64(v)), nil
+	case uint16:
+		return packInt(b, int64(v)), nil
+	case uint32:
+		return packInt(b, int64(v)), nil
+	case float32:
+		return packFloat(b, float64(v)), nil
+	case float64:
+		return packFloat(b, v), nil
+	case string:
+		b = packHeader(b, 0x80, 0xD0, len(v))
+		return append(b, v...), nil
+	case []byte:
+		switch {
+		case len(v) <= math.MaxUint8:
+			b = append(b, 0xCC, byte(len(v)))
+		case len(v) <= math.MaxUint16:
+			b = binary.BigEndian.AppendUint16(append(b, 0xCD), uint16(len(v)))
+		default:
+			b = binary.BigEndian.AppendUint32(append(b, 0xCE), uint32(len(v)))
+		}
+		return append(b, v...), nil
+	case []string:
+		b = packHeader(b, 0x90, 0xD4, len(v))
+		for _, s := range v {
+			b, _ = Pack(b, s)
+		}
+		return b, nil
+	case []any:
+		b = packHeader(b, 0x90, 0xD4, len(v))
+		for _, e := range v {
+			var err error
+			if b, err = Pack(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]any:
+		b = packHeader(b, 0xA0, 0xD8, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			b, _ = Pack(b, k)
+			var err error
+			if b, err = Pack(b, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case Struct:
+		if len(v.Fields) > 15 {
+			return nil, fmt.Errorf("bolt: structure with %d fields", len(v.Fields))
+		}
+		b = append(b, 0xB0|byte(len(v.Fields)), v.Tag)
+		for _, f := range v.Fields {
+			var err error
+			if b, err = Pack(b, f); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("bolt: cannot pack %T", v)
+	}
+}
+
+func packInt(b []byte, n int64) []byte {
+	switch {
+	case n >= -16 && n <= 127:
+		return append(b, byte(int8(n)))
+	case n >= math.MinInt8 && n <= math.MaxInt8:
+		return append(b, 0xC8, byte(int8(n)))
+	case n >= math.MinInt16 && n <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xC9), uint16(int16(n)))
+	case n >= math.MinInt32 && n <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xCA), uint32(int32(n)))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xCB), uint64(n))
+	}
+}
+
+func packFloat(b []byte, f float64) []byte {
+	return binary.BigEndian.AppendUint64(append(b, 0xC1), math.Float64bits(f))
+}
+
+// packHeader writes the marker of a string, list or map: tiny holds sizes
+// below 16, and small is followed by an 8, 16 or 32-bit size
+func packHeader(b []byte, tiny, small byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, tiny|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, small, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, small+1), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, small+2), uint32(n))
+	}
+}
+
+var errShort = errors.New("bolt: truncated value")
+
+// Unpack decodes one value from b. Integers decode as int64, lists as []any
+// and maps as map[string]any.
+func Unpack(b []byte) (any, error) {
+	u := unpacker{b: b}
+	v, err := u.value()
+	if err != nil {
+		return nil, err
+	}
+	if u.pos != len(b) {
+		return nil, fmt.Errorf("bolt: %d trailing bytes", len(b)-u.pos)
+	}
+	return v, nil
+}
+
+type unpacker struct {
+	b   []byte
+	pos int
+}
+
+func (u *unpacker) take(n int) ([]byte, error) {
+	if n < 0 || u.pos+n > len(u.b) {
+		return nil, errShort
+	}
+	p := u.b[u.pos : u.pos+n]
+	u.pos += n
+	return p, nil
+}
+
+// size reads a 1, 2 or 4 byte big-endian size
+func (u *unpacker) size(width int) (int, error) {
+	p, err := u.take(width)
+	if err != nil {
+		return 0, err
+	}
+	switch width {
+	case 1:
+		return int(p[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(p)), nil
+	default:
+		return int(binary.BigEndian.Uint32(p)), nil
+	}
+}
+
+func (u *unpacker) value() (any, error) {
+	p, err := u.take(1)
+	if err != nil {
+		return nil, err
+	}
+	m := p[0]
+	switch {
+	case m <= 0x7F || m >= 0xF0:
+		return int64(int8(m)), nil
+	case m&0xF0 == 0x80:
+		return u.str(int(m & 0x0F))
+	case m&0xF0 == 0x90:
+		return u.list(int(m & 0x0F))
+	case m&0xF0 == 0xA0:
+		return u.dict(int(m & 0x0F))
+	case m&0xF0 == 0xB0:
+		return u.structure(int(m & 0x0F))
+	}
+	switch m {
+	case 0xC0:
+		return nil, nil
+	case 0xC2:
+		return false, nil
+	case 0xC3:
+		return true, nil
+	case 0xC1:
+		p, err := u.take(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(p)), nil
+	case 0xC8:
+		p, err := u.take(1)
+		if err != nil {
+			return nil, err
+		}
+		return int64(int8(p[0])), nil
+	case 0xC9:
+		p, err := u.take(2)
+		if err != nil {
+			return nil, err
+		}
+		return int64(int16(binary.BigEndian.Uint16(p))), nil
+	case 0xCA:
+		p, err := u.take(4)
+		if err != nil {
+			return nil, err
+		}
+		return int64(int32(binary.BigEndian.Uint32(p))), nil
+	case 0xCB:
+		p, err := u.take(8)
+		if err != nil {
+			return nil, err
+		}
+		return int64(binary.BigEndian.Uint64(p)), nil
+	case 0xCC, 0xCD, 0xCE:
+		n, err := u.size(1 << (m - 0xCC))
+		if err != nil {
+			return nil, err
+		}
+		p, err := u.take(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), p...), nil
+	case 0xD0, 0xD1, 0xD2:
+		n, err := u.size(1 << (m - 0xD0))
+		if err != nil {
+			return nil, err
+		}
+		return u.str(n)
+	case 0xD4, 0xD5, 0xD6:
+		n, err := u.size(1 << (m - 0xD4))
+		if err != nil {
+			return nil, err
+		}
+		return u.list(n)
+	case 0xD8, 0xD9, 0xDA:
+		n, err := u.size(1 << (m - 0xD8))
+		if err != nil {
+			return nil, err
+		}
+		return u.dict(n)
+	}
+	return nil, fmt.Errorf("bolt: unknown marker 0x%02X", m)
+}
+
+func (u *unpacker) str(n int) (any, error) {
+	p, err := u.take(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(p), nil
+}
+
+func (u *unpacker) list(n int) (any, error) {
+	if n > len(u.b)-u.pos {
+		return nil, errShort
+	}
+	l := make([]any, n)
+	for i := range l {
+		v, err := u.value()
+		if err != nil {
+			return nil, err
+		}
+		l[i] = v
+	}
+	return l, nil
+}
+
+func (u *unpacker) dict(n int) (any, error) {
+	if n > len(u.b)-u.pos {
+		return nil, errShort
+	}
+	d := make(map[string]any, n)
+	for range n {
+		k, err := u.value()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("bolt: map key of type %T", k)
+		}
+		if d[key], err = u.value(); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+func (u *unpacker) structure(n int) (any, error) {
+	p, err := u.take(1)
+	if err != nil {
+		return nil, err
+	}
+	s := Struct{Tag: p[0], Fields: make([]any, n)}
+	for i := range s.Fields {
+		if s.Fields[i], err = u.value(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
@@ -1,8 +1,7 @@
 package catalog
 
 import (
-	"errors"
-	"fmt"
+	"slices"
 	"strings"
 )
 
@@ -15,6 +14,9 @@ const (
 	OpAlterEdge  DDLOp = "ALTER_EDGE"
 	OpDropNode   DDLOp = "DROP_NODE"
 	OpDropEdge   DDLOp = "DROP_EDGE"
+
+	OpCreateFulltext DDLOp = "CREATE_FULLTEXT_INDEX"
+	OpDropFulltext   DDLOp = "DROP_FULLTEXT_INDEX"
 	// (later) OpCreateIndex, OpDropIndex, ...
 )
 
@@ -35,8 +37,10 @@ type FieldPayload struct {
 	Type       TypeSpec
 	PrimaryKey bool
 	Unique     bool
+	Index      bool // INDEX, for a node field
 	NotNull    bool
 	DefaultRaw *string
+	TTL        string // see FieldSpec.TTL
 }
 
 type CreateEdgePayload struct {
@@ -91,6 +95,13 @@ type DropEdgePayload struct {
 	Name string
 }
 
+// FULLTEXT INDEX payload, for both CREATE and DROP
+type FulltextIndexPayload struct {
+	NodeType string
+	Fields   []string
+	Stem     bool // CREATE only
+}
+
 /* -------------------- Pure functional apply with validation -------------------- */
 
 // ApplyCreateNode returns a new catalog (copy-on-write) with the node type added.
@@ -100,14 +111,15 @@ func ApplyCreateNode(c *Catalog, p CreateNodePayload) (*Catalog, error) {
 	}
 	out := c.Clone()
 	nt := &NodeType{
-		Name:    p.Name,
-		Fields:  map[string]FieldSpec{},
-		PK:      "",
-		Indexes: map[string]IndexSpec{},
+		Name:     p.Name,
+		Fields:   map[string]FieldSpec{},
+		PK:       "",
+		Indexes:  map[string]IndexSpec{},
+		Fulltext: map[string]FulltextSpec{},
 	}
 	for _, f := range p.Fields {
 		if _, exists := nt.Fields[f.Name]; exists {
-			return nil, fmt.Errorf("duplicate field %q", f.Name)
+			return nil, invalid("duplicate field %q", f.Name)
 		}
 		fs := FieldSpec{
 			Name:       f.Name,
@@ -115,6 +127,7 @@ func ApplyCreateNode(c *Catalog, p CreateNodePayload) (*Catalog, error) {
 			Unique:     f.Unique,
 			NotNull:    f.NotNull,
 			DefaultRaw: f.DefaultRaw,
+			TTL:        f.TTL,
 		}
 		nt.Fields[f.Name] = fs
 		if f.PrimaryKey {
@@ -122,6 +135,8 @@ func ApplyCreateNode(c *Catalog, p CreateNodePayload) (*Catalog, error) {
 			nt.Indexes[f.Name] = IndexSpec{Field: f.Name, Unique: true}
 		} else if f.Unique {
 			nt.Indexes[f.Name] = IndexSpec{Field: f.Name, Unique: true}
+		} else if f.Index {
+			nt.Indexes[f.Name] = IndexSpec{Field: f.Name}
 		}
 	}
 	out.Nodes[p.Name] = nt
@@ -131,39 +146,54 @@ func ApplyCreateNode(c *Catalog, p CreateNodePayload) (*Catalog, error) {
 
 func validateCreateNode(c *Catalog, p CreateNodePayload) error {
 	if p.Name == "" {
-		return errors.New("node name required")
+		return invalid("node name required")
 	}
 	if _, ok := c.Nodes[p.Name]; ok {
-		return fmt.Errorf("node %q already exists", p.Name)
+		return alreadyExists("node %q already exists", p.Name)
 	}
 	if len(p.Fields) == 0 {
-		return errors.New("node must define at least one field")
+		return invalid("node must define at least one field")
 	}
-	var pkCount int
+	var pkCount, ttlCount int
 	seen := map[string]struct{}{}
 	for _, f := range p.Fields {
 		if f.Name == "" {
-			return errors.New("field with empty name")
+			return invalid("field with empty name")
+		}
+		if f.TTL != "" {
+			ttlCount++
+			if !isExpiryType(f.Type) {
+				return invalid("TTL field %q must be a date or datetime", f.Name)
+			}
 		}
 		if _, dup := seen[f.Name]; dup {
-			return fmt.Errorf("duplicate field %q", f.Name)
+			return invalid("duplicate field %q", f.Name)
 		}
 		seen[f.Name] = struct{}{}
 		if f.PrimaryKey {
 			pkCount++
 			if !isScalarType(f.Type) {
-				return fmt.Errorf("primary key %q must be scalar", f.Name)
+				return invalid("primary key %q must be scalar", f.Name)
 			}
 		}
+		if f.Index && !isIndexable(f.Type) {
+			return invalid("indexed field %q must be scalar", f.Name)
+		}
 		if f.NotNull && f.DefaultRaw != nil && strings.EqualFold(*f.DefaultRaw, "null") {
-			return fmt.Errorf("field %q NOT NULL but default null", f.Name)
+			return invalid("field %q NOT NULL but default null", f.Name)
 		}
 		if f.Type.Base == BaseEnum && len(f.Type.EnumVals) == 0 {
-			return fmt.Errorf("enum field %q must have values", f.Name)
+			return invalid("enum field %q must have values", f.Name)
+		}
+		if f.Type.Base == BaseVector && f.Type.Dim < 1 {
+			return invalid("vector field %q must have a positive length", f.Name)
 		}
 	}
 	if pkCount > 1 {
-		return errors.New("multiple PRIMARY KEY fields")
+		return invalid("multiple PRIMARY KEY fields")
+	}
+	if ttlCount > 1 {
+		return invalid("multiple TTL fields")
 	}
 	return nil
 }
@@ -177,6 +207,33 @@ func isScalarType(t TypeSpec) bool {
 	}
 }
 
+// isExpiryType reports whether a TTL field may have type t: a date or a
+// datetime
+func isExpiryType(t TypeSpec) bool {
+	return t.Elem == nil && (t.Base == BaseDate || t.Base == BaseDateTime)
+}
+
+// checkTTL rejects fields if more than one has a TTL
+func checkTTL(fields map[string]FieldSpec) error {
+	var ttl []string
+	for name, f := range fields {
+		if f.TTL != "" {
+			ttl = append(ttl, name)
+		}
+	}
+	if len(ttl) > 1 {
+		slices.Sort(ttl)
+		return invalid("multiple TTL fields: %s", strings.Join(ttl, ", "))
+	}
+	return nil
+}
+
+// isIndexable reports whether an INDEX field may have type t: a scalar or
+// an enum
+func isIndexable(t TypeSpec) bool {
+	return isScalarType(t) || t.Base == BaseEnum
+}
+
 func ApplyCreateEdge(c *Catalog, p CreateEdgePayload) (*Catalog, error) {
 	if err := validateCreateEdge(c, p); err != nil {
 		return nil, err
@@ -190,7 +247,7 @@ func ApplyCreateEdge(c *Catalog, p CreateEdgePayload) (*Catalog, error) {
 	}
 	for _, f := range p.Props {
 		if _, exists := et.Props[f.Name]; exists {
-			return nil, fmt.Errorf("duplicate edge prop %q", f.Name)
+			return nil, invalid("duplicate edge prop %q", f.Name)
 		}
 		et.Props[f.Name] = FieldSpec{
 			Name:       f.Name,
@@ -198,6 +255,7 @@ func ApplyCreateEdge(c *Catalog, p CreateEdgePayload) (*Catalog, error) {
 			Unique:     f.Unique, // (rare on edges, but allowed)
 			NotNull:    f.NotNull,
 			DefaultRaw: f.DefaultRaw,
+			TTL:        f.TTL,
 		}
 	}
 	out.Edges[p.Name] = et
@@ -207,32 +265,45 @@ func ApplyCreateEdge(c *Catalog, p CreateEdgePayload) (*Catalog, error) {
 
 func validateCreateEdge(c *Catalog, p CreateEdgePayload) error {
 	if p.Name == "" {
-		return errors.New("edge name required")
+		return invalid("edge name required")
 	}
 	if _, ok := c.Edges[p.Name]; ok {
-		return fmt.Errorf("edge %q already exists", p.Name)
+		return alreadyExists("edge %q already exists", p.Name)
 	}
 	// endpoints must exist
 	if _, ok := c.Nodes[p.From.Label]; !ok {
-		return fmt.Errorf("FROM node type %q not found", p.From.Label)
+		return notFound("FROM node type %q not found", p.From.Label)
 	}
 	if _, ok := c.Nodes[p.To.Label]; !ok {
-		return fmt.Errorf("TO node type %q not found", p.To.Label)
+		return notFound("TO node type %q not found", p.To.Label)
 	}
 	// props sanity
 	seen := map[string]struct{}{}
+	ttlCount := 0
 	for _, f := range p.Props {
 		if f.Name == "" {
-			return errors.New("edge prop with empty name")
+			return invalid("edge prop with empty name")
 		}
 		if _, dup := seen[f.Name]; dup {
-			return fmt.Errorf("duplicate edge prop %q", f.Name)
+			return invalid("duplicate edge prop %q", f.Name)
 		}
 		seen[f.Name] = struct{}{}
 		if f.Type.Base == BaseEnum && len(f.Type.EnumVals) == 0 {
-			return fmt.Errorf("enum prop %q must have values", f.Name)
+			return invalid("enum prop %q must have values", f.Name)
+		}
+		if f.Type.Base == BaseVector && f.Type.Dim < 1 {
+			return invalid("vector prop %q must have a positive length", f.Name)
+		}
+		if f.TTL != "" {
+			ttlCount++
+			if !isExpiryType(f.Type) {
+				return invalid("TTL prop %q must be a date or datetime", f.Name)
+			}
 		}
 	}
+	if ttlCount > 1 {
+		return invalid("multiple TTL props")
+	}
 	return nil
 }
 
@@ -251,7 +322,7 @@ func ApplyAlterNode(c *Catalog, p AlterNodePayload) (*Catalog, error) {
 		switch action.Type {
 		case "ADD_FIELD":
 			if _, exists := nt.Fields[action.Field.Name]; exists {
-				return nil, fmt.Errorf("field %q already exists", action.Field.Name)
+				return nil, alreadyExists("field %q already exists", action.Field.Name)
 			}
 			fs := FieldSpec{
 				Name:       action.Field.Name,
@@ -259,42 +330,46 @@ func ApplyAlterNode(c *Catalog, p AlterNodePayload) (*Catalog, error) {
 				Unique:     action.Field.Unique,
 				NotNull:    action.Field.NotNull,
 				DefaultRaw: action.Field.DefaultRaw,
+				TTL:        action.Field.TTL,
 			}
 			nt.Fields[action.Field.Name] = fs
 
 			if action.Field.PrimaryKey {
 				if nt.PK != "" {
-					return nil, errors.New("node already has a primary key")
+					return nil, invalid("node already has a primary key")
 				}
 				nt.PK = action.Field.Name
 				nt.Indexes[action.Field.Name] = IndexSpec{Field: action.Field.Name, Unique: true}
 			} else if action.Field.Unique {
 				nt.Indexes[action.Field.Name] = IndexSpec{Field: action.Field.Name, Unique: true}
+			} else if action.Field.Index {
+				nt.Indexes[action.Field.Name] = IndexSpec{Field: action.Field.Name}
 			}
 
 		case "DROP_FIELD":
 			if _, exists := nt.Fields[action.FieldName]; !exists {
-				return nil, fmt.Errorf("field %q does not exist", action.FieldName)
+				return nil, notFound("field %q does not exist", action.FieldName)
 			}
 			if nt.PK == action.FieldName {
-				return nil, fmt.Errorf("cannot drop primary key field %q", action.FieldName)
+				return nil, invalid("cannot drop primary key field %q", action.FieldName)
 			}
 			delete(nt.Fields, action.FieldName)
 			delete(nt.Indexes, action.FieldName)
+			delete(nt.Fulltext, action.FieldName)
 
 		case "MODIFY_FIELD":
 			if _, exists := nt.Fields[action.Field.Name]; !exists {
-				return nil, fmt.Errorf("field %q does not exist", action.Field.Name)
+				return nil, notFound("field %q does not exist", action.Field.Name)
 			}
 			if nt.PK == action.Field.Name && action.Field.PrimaryKey {
 				// Modifying existing PK field - validate it remains scalar
 				if !isScalarType(action.Field.Type) {
-					return nil, fmt.Errorf("primary key %q must be scalar", action.Field.Name)
+					return nil, invalid("primary key %q must be scalar", action.Field.Name)
 				}
 			} else if nt.PK == action.Field.Name && !action.Field.PrimaryKey {
-				return nil, fmt.Errorf("cannot remove primary key from field %q", action.Field.Name)
+				return nil, invalid("cannot remove primary key from field %q", action.Field.Name)
 			} else if nt.PK != action.Field.Name && action.Field.PrimaryKey {
-				return nil, fmt.Errorf("cannot set primary key on field %q when %q is already primary key", action.Field.Name, nt.PK)
+				return nil, invalid("cannot set primary key on field %q when %q is already primary key", action.Field.Name, nt.PK)
 			}
 
 			fs := FieldSpec{
@@ -303,23 +378,29 @@ func ApplyAlterNode(c *Catalog, p AlterNodePayload) (*Catalog, error) {
 				Unique:     action.Field.Unique,
 				NotNull:    action.Field.NotNull,
 				DefaultRaw: action.Field.DefaultRaw,
+				TTL:        action.Field.TTL,
 			}
 			nt.Fields[action.Field.Name] = fs
 
 			// Update indexes
 			if action.Field.Unique || action.Field.PrimaryKey {
 				nt.Indexes[action.Field.Name] = IndexSpec{Field: action.Field.Name, Unique: true}
+			} else if action.Field.Index {
+				nt.Indexes[action.Field.Name] = IndexSpec{Field: action.Field.Name}
 			} else {
 				delete(nt.Indexes, action.Field.Name)
 			}
+			if !isTextType(action.Field.Type) {
+				delete(nt.Fulltext, action.Field.Name)
+			}
 
 		case "SET_PRIMARY_KEY":
 			if _, exists := nt.Fields[action.FieldName]; !exists {
-				return nil, fmt.Errorf("field %q does not exist", action.FieldName)
+				return nil, notFound("field %q does not exist", action.FieldName)
 			}
 			field := nt.Fields[action.FieldName]
 			if !isScalarType(field.Type) {
-				return nil, fmt.Errorf("primary key %q must be scalar", action.FieldName)
+				return nil, invalid("primary key %q must be scalar", action.FieldName)
 			}
 
 			// Remove old PK index if exists
@@ -334,9 +415,12 @@ func ApplyAlterNode(c *Catalog, p AlterNodePayload) (*Catalog, error) {
 			nt.Indexes[action.FieldName] = IndexSpec{Field: action.FieldName, Unique: true}
 
 		default:
-			return nil, fmt.Errorf("unknown alter node action: %s", action.Type)
+			return nil, invalid("unknown alter node action: %s", action.Type)
 		}
 	}
+	if err := checkTTL(nt.Fields); err != nil {
+		return nil, err
+	}
 
 	out.Version++
 	return out, nil
@@ -344,39 +428,48 @@ func ApplyAlterNode(c *Catalog, p AlterNodePayload) (*Catalog, error) {
 
 func validateAlterNode(c *Catalog, p AlterNodePayload) error {
 	if p.Name == "" {
-		return errors.New("node name required")
+		return invalid("node name required")
 	}
 	if _, ok := c.Nodes[p.Name]; !ok {
-		return fmt.Errorf("node %q does not exist", p.Name)
+		return notFound("node %q does not exist", p.Name)
 	}
 	if len(p.Actions) == 0 {
-		return errors.New("at least one action required")
+		return invalid("at least one action required")
 	}
 
 	for _, action := range p.Actions {
 		switch action.Type {
 		case "ADD_FIELD", "MODIFY_FIELD":
 			if action.Field == nil {
-				return fmt.Errorf("field required for action %s", action.Type)
+				return invalid("field required for action %s", action.Type)
 			}
 			if action.Field.Name == "" {
-				return errors.New("field name required")
+				return invalid("field name required")
 			}
 			if action.Field.Type.Base == BaseEnum && len(action.Field.Type.EnumVals) == 0 {
-				return fmt.Errorf("enum field %q must have values", action.Field.Name)
+				return invalid("enum field %q must have values", action.Field.Name)
+			}
+			if action.Field.Type.Base == BaseVector && action.Field.Type.Dim < 1 {
+				return invalid("vector field %q must have a positive length", action.Field.Name)
 			}
 			if action.Field.NotNull && action.Field.DefaultRaw != nil && strings.EqualFold(*action.Field.DefaultRaw, "null") {
-				return fmt.Errorf("field %q NOT NULL but default null", action.Field.Name)
+				return invalid("field %q NOT NULL but default null", action.Field.Name)
 			}
 			if action.Field.PrimaryKey && !isScalarType(action.Field.Type) {
-				return fmt.Errorf("primary key %q must be scalar", action.Field.Name)
+				return invalid("primary key %q must be scalar", action.Field.Name)
+			}
+			if action.Field.Index && !isIndexable(action.Field.Type) {
+				return invalid("indexed field %q must be scalar", action.Field.Name)
+			}
+			if action.Field.TTL != "" && !isExpiryType(action.Field.Type) {
+				return invalid("TTL field %q must be a date or datetime", action.Field.Name)
 			}
 		case "DROP_FIELD", "SET_PRIMARY_KEY":
 			if action.FieldName == "" {
-				return fmt.Errorf("field name required for action %s", action.Type)
+				return invalid("field name required for action %s", action.Type)
 			}
 		default:
-			return fmt.Errorf("unknown alter node action: %s", action.Type)
+			return invalid("unknown alter node action: %s", action.Type)
 		}
 	}
 
@@ -398,7 +491,7 @@ func ApplyAlterEdge(c *Catalog, p AlterEdgePayload) (*Catalog, error) {
 		switch action.Type {
 		case "ADD_PROP":
 			if _, exists := et.Props[action.Prop.Name]; exists {
-				return nil, fmt.Errorf("prop %q already exists", action.Prop.Name)
+				return nil, alreadyExists("prop %q already exists", action.Prop.Name)
 			}
 			et.Props[action.Prop.Name] = FieldSpec{
 				Name:       action.Prop.Name,
@@ -406,17 +499,18 @@ func ApplyAlterEdge(c *Catalog, p AlterEdgePayload) (*Catalog, error) {
 				Unique:     action.Prop.Unique,
 				NotNull:    action.Prop.NotNull,
 				DefaultRaw: action.Prop.DefaultRaw,
+				TTL:        action.Prop.TTL,
 			}
 
 		case "DROP_PROP":
 			if _, exists := et.Props[action.PropName]; !exists {
-				return nil, fmt.Errorf("prop %q does not exist", action.PropName)
+				return nil, notFound("prop %q does not exist", action.PropName)
 			}
 			delete(et.Props, action.PropName)
 
 		case "MODIFY_PROP":
 			if _, exists := et.Props[action.Prop.Name]; !exists {
-				return nil, fmt.Errorf("prop %q does not exist", action.Prop.Name)
+				return nil, notFound("prop %q does not exist", action.Prop.Name)
 			}
 			et.Props[action.Prop.Name] = FieldSpec{
 				Name:       action.Prop.Name,
@@ -424,27 +518,31 @@ func ApplyAlterEdge(c *Catalog, p AlterEdgePayload) (*Catalog, error) {
 				Unique:     action.Prop.Unique,
 				NotNull:    action.Prop.NotNull,
 				DefaultRaw: action.Prop.DefaultRaw,
+				TTL:        action.Prop.TTL,
 			}
 
 		case "CHANGE_ENDPOINT":
 			if action.Endpoint == "FROM" {
 				if _, ok := c.Nodes[action.NewEndpoint.Label]; !ok {
-					return nil, fmt.Errorf("FROM node type %q not found", action.NewEndpoint.Label)
+					return nil, notFound("FROM node type %q not found", action.NewEndpoint.Label)
 				}
 				et.From = *action.NewEndpoint
 			} else if action.Endpoint == "TO" {
 				if _, ok := c.Nodes[action.NewEndpoint.Label]; !ok {
-					return nil, fmt.Errorf("TO node type %q not found", action.NewEndpoint.Label)
+					return nil, notFound("TO node type %q not found", action.NewEndpoint.Label)
 				}
 				et.To = *action.NewEndpoint
 			} else {
-				return nil, fmt.Errorf("invalid endpoint %q", action.Endpoint)
+				return nil, invalid("invalid endpoint %q", action.Endpoint)
 			}
 
 		default:
-			return nil, fmt.Errorf("unknown alter edge action: %s", action.Type)
+			return nil, invalid("unknown alter edge action: %s", action.Type)
 		}
 	}
+	if err := checkTTL(et.Props); err != nil {
+		return nil, err
+	}
 
 	out.Version++
 	return out, nil
@@ -452,49 +550,55 @@ func ApplyAlterEdge(c *Catalog, p AlterEdgePayload) (*Catalog, error) {
 
 func validateAlterEdge(c *Catalog, p AlterEdgePayload) error {
 	if p.Name == "" {
-		return errors.New("edge name required")
+		return invalid("edge name required")
 	}
 	if _, ok := c.Edges[p.Name]; !ok {
-		return fmt.Errorf("edge %q does not exist", p.Name)
+		return notFound("edge %q does not exist", p.Name)
 	}
 	if len(p.Actions) == 0 {
-		return errors.New("at least one action required")
+		return invalid("at least one action required")
 	}
 
 	for _, action := range p.Actions {
 		switch action.Type {
 		case "ADD_PROP", "MODIFY_PROP":
 			if action.Prop == nil {
-				return fmt.Errorf("prop required for action %s", action.Type)
+				return invalid("prop required for action %s", action.Type)
 			}
 			if action.Prop.Name == "" {
-				return errors.New("prop name required")
+				return invalid("prop name required")
 			}
 			if action.Prop.Type.Base == BaseEnum && len(action.Prop.Type.EnumVals) == 0 {
-				return fmt.Errorf("enum prop %q must have values", action.Prop.Name)
+				return invalid("enum prop %q must have values", action.Prop.Name)
+			}
+			if action.Prop.Type.Base == BaseVector && action.Prop.Type.Dim < 1 {
+				return invalid("vector prop %q must have a positive length", action.Prop.Name)
 			}
 			if action.Prop.NotNull && action.Prop.DefaultRaw != nil && strings.EqualFold(*action.Prop.DefaultRaw, "null") {
-				return fmt.Errorf("prop %q NOT NULL but default null", action.Prop.Name)
+				return invalid("prop %q NOT NULL but default null", action.Prop.Name)
+			}
+			if action.Prop.TTL != "" && !isExpiryType(action.Prop.Type) {
+				return invalid("TTL prop %q must be a date or datetime", action.Prop.Name)
 			}
 		case "DROP_PROP":
 			if action.PropName == "" {
-				return fmt.Errorf("prop name required for action %s", action.Type)
+				return invalid("prop name required for action %s", action.Type)
 			}
 		case "CHANGE_ENDPOINT":
 			if action.Endpoint != "FROM" && action.Endpoint != "TO" {
-				return fmt.Errorf("endpoint must be FROM or TO, got %q", action.Endpoint)
+				return invalid("endpoint must be FROM or TO, got %q", action.Endpoint)
 			}
 			if action.NewEndpoint == nil {
-				return errors.New("new endpoint required for CHANGE_ENDPOINT")
+				return invalid("new endpoint required for CHANGE_ENDPOINT")
 			}
 			if action.NewEndpoint.Label == "" {
-				return errors.New("endpoint label required")
+				return invalid("endpoint label required")
 			}
 			if _, ok := c.Nodes[action.NewEndpoint.Label]; !ok {
-				return fmt.Errorf("endpoint node type %q not found", action.NewEndpoint.Label)
+				return notFound("endpoint node type %q not found", action.NewEndpoint.Label)
 			}
 		default:
-			return fmt.Errorf("unknown alter edge action: %s", action.Type)
+			return invalid("unknown alter edge action: %s", action.Type)
 		}
 	}
 
@@ -517,16 +621,16 @@ func ApplyDropNode(c *Catalog, p DropNodePayload) (*Catalog, error) {
 
 func validateDropNode(c *Catalog, p DropNodePayload) error {
 	if p.Name == "" {
-		return errors.New("node name required")
+		return invalid("node name required")
 	}
 	if _, ok := c.Nodes[p.Name]; !ok {
-		return fmt.Errorf("node %q does not exist", p.Name)
+		return notFound("node %q does not exist", p.Name)
 	}
 
 	// Check if any edges reference this node
 	for edgeName, edge := range c.Edges {
 		if edge.From.Label == p.Name || edge.To.Label == p.Name {
-			return fmt.Errorf("cannot drop node %q: referenced by edge %q", p.Name, edgeName)
+			return inUse("cannot drop node %q: referenced by edge %q", p.Name, edgeName)
 		}
 	}
 
@@ -549,11 +653,87 @@ func ApplyDropEdge(c *Catalog, p DropEdgePayload) (*Catalog, error) {
 
 func validateDropEdge(c *Catalog, p DropEdgePayload) error {
 	if p.Name == "" {
-		return errors.New("edge name required")
+		return invalid("edge name required")
 	}
 	if _, ok := c.Edges[p.Name]; !ok {
-		return fmt.Errorf("edge %q does not exist", p.Name)
+		return notFound("edge %q does not exist", p.Name)
+	}
+
+	return nil
+}
+
+/* -------------------- FULLTEXT INDEX -------------------- */
+
+// ApplyCreateFulltext returns a new catalog with full-text indexes on the
+// given fields of a node type.
+func ApplyCreateFulltext(c *Catalog, p FulltextIndexPayload) (*Catalog, error) {
+	if err := validateFulltext(c, p); err != nil {
+		return nil, err
+	}
+
+	out := c.Clone()
+	nt := out.Nodes[p.NodeType]
+	if nt.Fulltext == nil {
+		nt.Fulltext = map[string]FulltextSpec{}
+	}
+	for _, f := range p.Fields {
+		if _, exists := nt.Fulltext[f]; exists {
+			return nil, alreadyExists("field %q already has a full-text index", f)
+		}
+		nt.Fulltext[f] = FulltextSpec{Field: f, Stem: p.Stem}
 	}
+	out.Version++
+	return out, nil
+}
 
+// ApplyDropFulltext returns a new catalog without the full-text indexes on
+// the given fields of a node type.
+func ApplyDropFulltext(c *Catalog, p FulltextIndexPayload) (*Catalog, error) {
+	if err := validateFulltext(c, p); err != nil {
+		return nil, err
+	}
+
+	out := c.Clone()
+	nt := out.Nodes[p.NodeType]
+	for _, f := range p.Fields {
+		if _, exists := nt.Fulltext[f]; !exists {
+			return nil, notFound("field %q has no full-text index", f)
+		}
+		delete(nt.Fulltext, f)
+	}
+	out.Version++
+	return out, nil
+}
+
+func validateFulltext(c *Catalog, p FulltextIndexPayload) error {
+	if p.NodeType == "" {
+		return invalid("node name required")
+	}
+	nt, ok := c.Nodes[p.NodeType]
+	if !ok {
+		return notFound("node %q does not exist", p.NodeType)
+	}
+	if len(p.Fields) == 0 {
+		return invalid("at least one field required")
+	}
+	seen := make(map[string]bool, len(p.Fields))
+	for _, f := range p.Fields {
+		if seen[f] {
+			return invalid("duplicate field %q", f)
+		}
+		seen[f] = true
+		fs, ok := nt.Fields[f]
+		if !ok {
+			return notFound("field %q does not exist", f)
+		}
+		if !isTextType(fs.Type) {
+			return invalid("full-text index on %q requires a string or text field", f)
+		}
+	}
 	return nil
 }
+
+// isTextType reports whether t holds text a full-text index can search
+func isTextType(t TypeSpec) bool {
+	return t.Elem == nil && (t.Base == BaseString || t.Base == BaseText)
+}
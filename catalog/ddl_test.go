@@ -1,6 +1,7 @@
 package catalog
 
 import (
+	"errors"
 	"strings"
 	"testing"
 )
@@ -233,7 +234,7 @@ func TestApplyCreateNodeDuplicateName(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error for duplicate node name")
 	}
-	if !strings.Contains(err.Error(), "already exists") {
+	if !errors.Is(err, ErrAlreadyExists) {
 		t.Errorf("unexpected error message: %v", err)
 	}
 }
@@ -443,7 +444,7 @@ func TestApplyCreateEdgeDuplicateName(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error for duplicate edge name")
 	}
-	if !strings.Contains(err.Error(), "already exists") {
+	if !errors.Is(err, ErrAlreadyExists) {
 		t.Errorf("unexpected error message: %v", err)
 	}
 }
@@ -588,7 +589,7 @@ func TestApplyAlterNodeDropPrimaryKeyField(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error when dropping primary key field")
 	}
-	if !strings.Contains(err.Error(), "cannot drop primary key field") {
+	if !errors.Is(err, ErrInvalid) {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
@@ -892,7 +893,7 @@ func TestApplyDropNodeReferencedByEdge(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error when dropping node referenced by edge")
 	}
-	if !strings.Contains(err.Error(), "referenced by edge") {
+	if !errors.Is(err, ErrInUse) {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
@@ -942,7 +943,7 @@ func TestApplyDropNonexistentNode(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error when dropping nonexistent node")
 	}
-	if !strings.Contains(err.Error(), "does not exist") {
+	if !errors.Is(err, ErrNotFound) {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
@@ -956,7 +957,7 @@ func TestApplyDropNonexistentEdge(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error when dropping nonexistent edge")
 	}
-	if !strings.Contains(err.Error(), "does not exist") {
+	if !errors.Is(err, ErrNotFound) {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
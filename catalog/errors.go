@@ -0,0 +1,40 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors returned by DDL validation. Test for them with errors.Is;
+// the error text still names the offending node, edge or field.
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+	ErrInUse         = errors.New("in use")
+	ErrInvalid       = errors.New("invalid definition")
+)
+
+// schemaError keeps the original message while matching one of the sentinels
+type schemaError struct {
+	kind error
+	msg  string
+}
+
+func (e *schemaError) Error() string { return e.msg }
+func (e *schemaError) Unwrap() error { return e.kind }
+
+func notFound(format string, args ...any) error {
+	return &schemaError{kind: ErrNotFound, msg: fmt.Sprintf(format, args...)}
+}
+
+func alreadyExists(format string, args ...any) error {
+	return &schemaError{kind: ErrAlreadyExists, msg: fmt.Sprintf(format, args...)}
+}
+
+func inUse(format string, args ...any) error {
+	return &schemaError{kind: ErrInUse, msg: fmt.Sprintf(format, args...)}
+}
+
+func invalid(format string, args ...any) error {
+	return &schemaError{kind: ErrInvalid, msg: fmt.Sprintf(format, args...)}
+}
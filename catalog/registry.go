@@ -1,6 +1,7 @@
 package catalog
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"sync"
@@ -8,11 +9,12 @@ import (
 )
 
 // Store abstracts snapshot/log persistence.
+// Implementations should give up with ctx.Err() once ctx is done.
 type Store interface {
-	Load() (*Catalog, uint64 /*ddloffset*/, error)
-	AppendDDL(ev DDLEvent) (newOffset uint64, err error) // SYNC
-	Snapshot(cat *Catalog) error                         // SYNC
-	UpdateManifest(catVersion uint64, ddlOffset uint64) error
+	Load(ctx context.Context) (*Catalog, uint64 /*ddloffset*/, error)
+	AppendDDL(ctx context.Context, ev DDLEvent) (newOffset uint64, err error) // SYNC
+	Snapshot(ctx context.Context, cat *Catalog) error                         // SYNC
+	UpdateManifest(ctx context.Context, catVersion uint64, ddlOffset uint64) error
 }
 
 type Registry struct {
@@ -25,8 +27,8 @@ type Registry struct {
 }
 
 // Open initializes the registry by loading snapshot and replaying DDL log.
-func Open(store Store) (*Registry, error) {
-	cat, off, err := store.Load()
+func Open(ctx context.Context, store Store) (*Registry, error) {
+	cat, off, err := store.Load(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -38,14 +40,37 @@ func Open(store Store) (*Registry, error) {
 	return r, nil
 }
 
+// Static returns a registry that always serves cat and rejects DDL, for
+// read-only views such as graph snapshots
+func Static(cat *Catalog) *Registry {
+	r := &Registry{}
+	r.cur.Store(cat)
+	return r
+}
+
 func (r *Registry) Current() *Catalog {
 	return r.cur.Load()
 }
 
+// Restore publishes cat, a catalog recovered from elsewhere, such as the data
+// file of the graph, as the current one without persisting it
+func (r *Registry) Restore(cat *Catalog) {
+	r.muW.Lock()
+	defer r.muW.Unlock()
+	r.cur.Store(cat)
+}
+
 // Apply validates, persists DDL (SYNC), and publishes a new catalog snapshot atomically.
-func (r *Registry) Apply(ev DDLEvent) (*Catalog, error) {
+// Nothing is persisted or published if ctx is done before the DDL event is written.
+func (r *Registry) Apply(ctx context.Context, ev DDLEvent) (*Catalog, error) {
 	r.muW.Lock()
 	defer r.muW.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if r.store == nil {
+		return nil, invalid("catalog is read-only")
+	}
 
 	// 1) Compute the new catalog in memory (copy-on-write)
 	old := r.cur.Load()
@@ -90,15 +115,27 @@ func (r *Registry) Apply(ev DDLEvent) (*Catalog, error) {
 			return nil, err
 		}
 		newCat, err = ApplyDropEdge(old, p)
+	case OpCreateFulltext:
+		var p FulltextIndexPayload
+		if err := decode(ev.Stmt, &p); err != nil {
+			return nil, err
+		}
+		newCat, err = ApplyCreateFulltext(old, p)
+	case OpDropFulltext:
+		var p FulltextIndexPayload
+		if err := decode(ev.Stmt, &p); err != nil {
+			return nil, err
+		}
+		newCat, err = ApplyDropFulltext(old, p)
 	default:
-		return nil, fmt.Errorf("unsupported DDL op %s", ev.Op)
+		return nil, invalid("unsupported DDL op %s", ev.Op)
 	}
 	if err != nil {
 		return nil, err
 	}
 
 	// 2) Persist the DDL event synchronously
-	off, err := r.store.AppendDDL(ev)
+	off, err := r.store.AppendDDL(ctx, ev)
 	if err != nil {
 		return nil, err
 	}
@@ -107,15 +144,16 @@ func (r *Registry) Apply(ev DDLEvent) (*Catalog, error) {
 	r.cur.Store(newCat)
 	r.ddlOffset = off
 
-	// 4) Update manifest (best effort but recommended to be SYNC as well)
-	if err := r.store.UpdateManifest(newCat.Version, off); err != nil {
+	// 4) Update manifest (best effort but recommended to be SYNC as well).
+	// The event is already durable, so cancellation no longer applies.
+	if err := r.store.UpdateManifest(context.WithoutCancel(ctx), newCat.Version, off); err != nil {
 		return nil, err
 	}
 	return newCat, nil
 }
 
-func (r *Registry) Snapshot() error {
-	return r.store.Snapshot(r.cur.Load())
+func (r *Registry) Snapshot(ctx context.Context) error {
+	return r.store.Snapshot(ctx, r.cur.Load())
 }
 
 func decode(src any, dst any) error {
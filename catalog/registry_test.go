@@ -1,6 +1,7 @@
 package catalog
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"testing"
@@ -27,7 +28,7 @@ func newMockStore() *mockStore {
 	}
 }
 
-func (m *mockStore) Load() (*Catalog, uint64, error) {
+func (m *mockStore) Load(ctx context.Context) (*Catalog, uint64, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	
@@ -42,7 +43,7 @@ func (m *mockStore) Load() (*Catalog, uint64, error) {
 	return m.catalog.Clone(), m.ddlOffset, nil
 }
 
-func (m *mockStore) AppendDDL(ev DDLEvent) (uint64, error) {
+func (m *mockStore) AppendDDL(ctx context.Context, ev DDLEvent) (uint64, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	
@@ -55,7 +56,7 @@ func (m *mockStore) AppendDDL(ev DDLEvent) (uint64, error) {
 	return m.ddlOffset, nil
 }
 
-func (m *mockStore) Snapshot(cat *Catalog) error {
+func (m *mockStore) Snapshot(ctx context.Context, cat *Catalog) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	
@@ -67,7 +68,7 @@ func (m *mockStore) Snapshot(cat *Catalog) error {
 	return nil
 }
 
-func (m *mockStore) UpdateManifest(catVersion uint64, ddlOffset uint64) error {
+func (m *mockStore) UpdateManifest(ctx context.Context, catVersion uint64, ddlOffset uint64) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	
@@ -86,7 +87,7 @@ func (m *mockStore) UpdateManifest(catVersion uint64, ddlOffset uint64) error {
 func TestRegistryOpen(t *testing.T) {
 	store := newMockStore()
 	
-	reg, err := Open(store)
+	reg, err := Open(context.Background(), store)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -117,7 +118,7 @@ func TestRegistryOpenWithExistingCatalog(t *testing.T) {
 	store.catalog = existingCat
 	store.ddlOffset = 10
 	
-	reg, err := Open(store)
+	reg, err := Open(context.Background(), store)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -132,7 +133,7 @@ func TestRegistryOpenLoadError(t *testing.T) {
 	store := newMockStore()
 	store.loadErr = errors.New("load failed")
 	
-	_, err := Open(store)
+	_, err := Open(context.Background(), store)
 	if err == nil {
 		t.Fatal("expected error but got none")
 	}
@@ -143,7 +144,7 @@ func TestRegistryOpenLoadError(t *testing.T) {
 
 func TestRegistryApplyCreateNode(t *testing.T) {
 	store := newMockStore()
-	reg, _ := Open(store)
+	reg, _ := Open(context.Background(), store)
 	
 	ev := DDLEvent{
 		Op: OpCreateNode,
@@ -156,7 +157,7 @@ func TestRegistryApplyCreateNode(t *testing.T) {
 		},
 	}
 	
-	newCat, err := reg.Apply(ev)
+	newCat, err := reg.Apply(context.Background(), ev)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -181,9 +182,31 @@ func TestRegistryApplyCreateNode(t *testing.T) {
 	}
 }
 
+func TestRegistryApplyCanceledContext(t *testing.T) {
+	store := newMockStore()
+	reg, _ := Open(context.Background(), store)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ev := DDLEvent{
+		Op:   OpCreateNode,
+		Stmt: CreateNodePayload{Name: "Person"},
+	}
+	if _, err := reg.Apply(ctx, ev); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(store.ddlLog) != 0 {
+		t.Errorf("expected no DDL events, got %d", len(store.ddlLog))
+	}
+	if reg.Current().Version != 0 {
+		t.Errorf("catalog should be unchanged, got version %d", reg.Current().Version)
+	}
+}
+
 func TestRegistryApplyCreateEdge(t *testing.T) {
 	store := newMockStore()
-	reg, _ := Open(store)
+	reg, _ := Open(context.Background(), store)
 	
 	// First create a node
 	nodeEv := DDLEvent{
@@ -195,7 +218,7 @@ func TestRegistryApplyCreateEdge(t *testing.T) {
 			},
 		},
 	}
-	reg.Apply(nodeEv)
+	reg.Apply(context.Background(), nodeEv)
 	
 	// Then create an edge
 	edgeEv := DDLEvent{
@@ -207,7 +230,7 @@ func TestRegistryApplyCreateEdge(t *testing.T) {
 		},
 	}
 	
-	newCat, err := reg.Apply(edgeEv)
+	newCat, err := reg.Apply(context.Background(), edgeEv)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -223,7 +246,7 @@ func TestRegistryApplyCreateEdge(t *testing.T) {
 
 func TestRegistryApplyValidationError(t *testing.T) {
 	store := newMockStore()
-	reg, _ := Open(store)
+	reg, _ := Open(context.Background(), store)
 	
 	ev := DDLEvent{
 		Op: OpCreateNode,
@@ -233,7 +256,7 @@ func TestRegistryApplyValidationError(t *testing.T) {
 		},
 	}
 	
-	_, err := reg.Apply(ev)
+	_, err := reg.Apply(context.Background(), ev)
 	if err == nil {
 		t.Fatal("expected validation error but got none")
 	}
@@ -253,7 +276,7 @@ func TestRegistryApplyValidationError(t *testing.T) {
 func TestRegistryApplyPersistenceError(t *testing.T) {
 	store := newMockStore()
 	store.appendErr = errors.New("disk full")
-	reg, _ := Open(store)
+	reg, _ := Open(context.Background(), store)
 	
 	ev := DDLEvent{
 		Op: OpCreateNode,
@@ -265,7 +288,7 @@ func TestRegistryApplyPersistenceError(t *testing.T) {
 		},
 	}
 	
-	_, err := reg.Apply(ev)
+	_, err := reg.Apply(context.Background(), ev)
 	if err == nil {
 		t.Fatal("expected persistence error but got none")
 	}
@@ -283,7 +306,7 @@ func TestRegistryApplyPersistenceError(t *testing.T) {
 func TestRegistryApplyManifestError(t *testing.T) {
 	store := newMockStore()
 	store.manifestErr = errors.New("manifest write failed")
-	reg, _ := Open(store)
+	reg, _ := Open(context.Background(), store)
 	
 	ev := DDLEvent{
 		Op: OpCreateNode,
@@ -295,7 +318,7 @@ func TestRegistryApplyManifestError(t *testing.T) {
 		},
 	}
 	
-	_, err := reg.Apply(ev)
+	_, err := reg.Apply(context.Background(), ev)
 	if err == nil {
 		t.Fatal("expected manifest error but got none")
 	}
@@ -306,14 +329,14 @@ func TestRegistryApplyManifestError(t *testing.T) {
 
 func TestRegistryApplyUnsupportedOp(t *testing.T) {
 	store := newMockStore()
-	reg, _ := Open(store)
+	reg, _ := Open(context.Background(), store)
 	
 	ev := DDLEvent{
 		Op:   "UNSUPPORTED_OP",
 		Stmt: map[string]any{},
 	}
 	
-	_, err := reg.Apply(ev)
+	_, err := reg.Apply(context.Background(), ev)
 	if err == nil {
 		t.Fatal("expected error for unsupported op but got none")
 	}
@@ -324,7 +347,7 @@ func TestRegistryApplyUnsupportedOp(t *testing.T) {
 
 func TestRegistrySnapshot(t *testing.T) {
 	store := newMockStore()
-	reg, _ := Open(store)
+	reg, _ := Open(context.Background(), store)
 	
 	// Apply some changes first
 	ev := DDLEvent{
@@ -336,9 +359,9 @@ func TestRegistrySnapshot(t *testing.T) {
 			},
 		},
 	}
-	reg.Apply(ev)
+	reg.Apply(context.Background(), ev)
 	
-	err := reg.Snapshot()
+	err := reg.Snapshot(context.Background())
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -361,9 +384,9 @@ func TestRegistrySnapshot(t *testing.T) {
 func TestRegistrySnapshotError(t *testing.T) {
 	store := newMockStore()
 	store.snapshotErr = errors.New("snapshot failed")
-	reg, _ := Open(store)
+	reg, _ := Open(context.Background(), store)
 	
-	err := reg.Snapshot()
+	err := reg.Snapshot(context.Background())
 	if err == nil {
 		t.Fatal("expected snapshot error but got none")
 	}
@@ -374,7 +397,7 @@ func TestRegistrySnapshotError(t *testing.T) {
 
 func TestRegistryConcurrentReads(t *testing.T) {
 	store := newMockStore()
-	reg, _ := Open(store)
+	reg, _ := Open(context.Background(), store)
 	
 	// Apply initial change
 	ev := DDLEvent{
@@ -386,7 +409,7 @@ func TestRegistryConcurrentReads(t *testing.T) {
 			},
 		},
 	}
-	reg.Apply(ev)
+	reg.Apply(context.Background(), ev)
 	
 	// Concurrent reads should all see consistent state
 	const numReaders = 10
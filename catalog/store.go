@@ -2,6 +2,7 @@ package catalog
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,6 +15,12 @@ import (
 type fileStore struct {
 	dir string
 	mu  sync.Mutex
+
+	// ddlLines is the number of complete lines in the DDL log, kept by Load
+	// and AppendDDL so appends need not re-read the file. It is only trusted
+	// when ddlKnown is set; otherwise the next append counts the lines.
+	ddlLines uint64
+	ddlKnown bool
 }
 
 type Manifest struct {
@@ -36,9 +43,12 @@ func (fs *fileStore) snapPath(name string) string { return filepath.Join(fs.dir,
 func (fs *fileStore) ddlPath() string             { return filepath.Join(fs.dir, "catalog-ddl.jsonl") }
 func (fs *fileStore) manifestPath() string        { return filepath.Join(fs.dir, "CATALOG-MANIFEST.json") }
 
-func (fs *fileStore) Load() (*Catalog, uint64, error) {
+func (fs *fileStore) Load(ctx context.Context) (*Catalog, uint64, error) {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
 
 	// read manifest (optional at first boot)
 	var m Manifest
@@ -71,7 +81,11 @@ func (fs *fileStore) Load() (*Catalog, uint64, error) {
 
 	br := bufio.NewReader(f)
 	var pos uint64
+	clean := false // read to EOF with every line complete
 	for {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
 		line, err := br.ReadBytes('\n')
 		if len(line) > 0 {
 			pos++
@@ -108,6 +122,14 @@ func (fs *fileStore) Load() (*Catalog, uint64, error) {
 				var p DropEdgePayload
 				_ = decode(ev.Stmt, &p)
 				cat, err = ApplyDropEdge(cat, p)
+			case OpCreateFulltext:
+				var p FulltextIndexPayload
+				_ = decode(ev.Stmt, &p)
+				cat, err = ApplyCreateFulltext(cat, p)
+			case OpDropFulltext:
+				var p FulltextIndexPayload
+				_ = decode(ev.Stmt, &p)
+				cat, err = ApplyDropFulltext(cat, p)
 			default:
 				err = fmt.Errorf("unknown op %s", ev.Op)
 			}
@@ -117,6 +139,7 @@ func (fs *fileStore) Load() (*Catalog, uint64, error) {
 			}
 		}
 		if err == io.EOF {
+			clean = len(line) == 0
 			break
 		}
 		if err != nil {
@@ -125,41 +148,55 @@ func (fs *fileStore) Load() (*Catalog, uint64, error) {
 	}
 	// pos == total lines; last fully applied line number is pos
 	off = pos
+	// after a stop at a bad line or a torn tail, pos is not the line count
+	fs.ddlLines, fs.ddlKnown = pos, clean
 	return cat, off, nil
 }
 
-func (fs *fileStore) AppendDDL(ev DDLEvent) (uint64, error) {
+func (fs *fileStore) AppendDDL(ctx context.Context, ev DDLEvent) (uint64, error) {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
 
-	f, err := os.OpenFile(fs.ddlPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	b, err := json.Marshal(ev)
 	if err != nil {
 		return 0, err
 	}
-	defer f.Close()
+	if !fs.ddlKnown {
+		// recovery: Load was not called or could not vouch for the count
+		n, err := countLines(fs.ddlPath())
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return 0, err
+		}
+		fs.ddlLines, fs.ddlKnown = n, true
+	}
 
-	b, err := json.Marshal(ev)
+	f, err := os.OpenFile(fs.ddlPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
 	if err != nil {
 		return 0, err
 	}
+	defer f.Close()
+
 	if _, err := f.Write(append(b, '\n')); err != nil {
+		fs.ddlKnown = false // a partial write may have left a torn line
 		return 0, err
 	}
 	if err := f.Sync(); err != nil {
+		fs.ddlKnown = false
 		return 0, err
 	}
-
-	// Count lines to determine new offset (O(n)). For real use, track offset in memory.
-	off, err := countLines(fs.ddlPath())
-	if err != nil {
-		return 0, err
-	}
-	return off, nil
+	fs.ddlLines++
+	return fs.ddlLines, nil
 }
 
-func (fs *fileStore) Snapshot(cat *Catalog) error {
+func (fs *fileStore) Snapshot(ctx context.Context, cat *Catalog) error {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	name := fmt.Sprintf("catalog-snap-%06d.json", cat.Version)
 	path := fs.snapPath(name)
@@ -171,10 +208,13 @@ func (fs *fileStore) Snapshot(cat *Catalog) error {
 		return err
 	}
 	// Sync manifest immediately to bind snapshot with current offset.
-	return fs.UpdateManifest(cat.Version, 0 /* caller should pass real ddl offset after AppendDDL */)
+	return fs.UpdateManifest(ctx, cat.Version, 0 /* caller should pass real ddl offset after AppendDDL */)
 }
 
-func (fs *fileStore) UpdateManifest(catVersion uint64, ddlOffset uint64) error {
+func (fs *fileStore) UpdateManifest(ctx context.Context, catVersion uint64, ddlOffset uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	// Discover latest snapshot file name by version
 	entries, err := os.ReadDir(fs.dir)
 	if err != nil {
@@ -195,6 +235,43 @@ func (fs *fileStore) UpdateManifest(catVersion uint64, ddlOffset uint64) error {
 	return os.Rename(tmp, fs.manifestPath())
 }
 
+// memoryStore keeps nothing: the catalog lives only as long as the registry
+type memoryStore struct {
+	mu       sync.Mutex
+	ddlLines uint64
+}
+
+// NewMemoryStore returns a Store that keeps nothing on disk, for registries
+// that start empty each time
+func NewMemoryStore() Store {
+	return &memoryStore{}
+}
+
+func (ms *memoryStore) Load(ctx context.Context) (*Catalog, uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	return NewEmpty(), 0, nil
+}
+
+func (ms *memoryStore) AppendDDL(ctx context.Context, ev DDLEvent) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.ddlLines++
+	return ms.ddlLines, nil
+}
+
+func (ms *memoryStore) Snapshot(ctx context.Context, cat *Catalog) error {
+	return ctx.Err()
+}
+
+func (ms *memoryStore) UpdateManifest(ctx context.Context, catVersion uint64, ddlOffset uint64) error {
+	return ctx.Err()
+}
+
 func countLines(path string) (uint64, error) {
 	f, err := os.Open(path)
 	if err != nil {
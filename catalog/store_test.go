@@ -1,6 +1,7 @@
 package catalog
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"path/filepath"
@@ -40,7 +41,7 @@ func TestFileStoreLoadEmpty(t *testing.T) {
 	tmpDir := t.TempDir()
 	store, _ := NewFileStore(tmpDir)
 
-	cat, offset, err := store.Load()
+	cat, offset, err := store.Load(context.Background())
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -78,7 +79,7 @@ func TestFileStoreAppendDDLAndLoad(t *testing.T) {
 		},
 	}
 
-	offset, err := store.AppendDDL(ev)
+	offset, err := store.AppendDDL(context.Background(), ev)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -109,7 +110,7 @@ func TestFileStoreAppendDDLAndLoad(t *testing.T) {
 	}
 
 	// Now load and verify replay
-	cat, loadOffset, err := store.Load()
+	cat, loadOffset, err := store.Load(context.Background())
 	if err != nil {
 		t.Fatalf("unexpected load error: %v", err)
 	}
@@ -162,7 +163,7 @@ func TestFileStoreMultipleDDLEvents(t *testing.T) {
 	}
 
 	for i, ev := range events {
-		offset, err := store.AppendDDL(ev)
+		offset, err := store.AppendDDL(context.Background(), ev)
 		if err != nil {
 			t.Fatalf("failed to append event %d: %v", i, err)
 		}
@@ -172,7 +173,7 @@ func TestFileStoreMultipleDDLEvents(t *testing.T) {
 	}
 
 	// Load and verify all events were replayed
-	cat, offset, err := store.Load()
+	cat, offset, err := store.Load(context.Background())
 	if err != nil {
 		t.Fatalf("unexpected load error: %v", err)
 	}
@@ -214,7 +215,7 @@ func TestFileStoreSnapshot(t *testing.T) {
 		Edges: map[string]*EdgeType{},
 	}
 
-	err := store.Snapshot(cat)
+	err := store.Snapshot(context.Background(), cat)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -264,7 +265,7 @@ func TestFileStoreLoadWithSnapshot(t *testing.T) {
 		Edges: map[string]*EdgeType{},
 	}
 
-	store.Snapshot(originalCat)
+	store.Snapshot(context.Background(), originalCat)
 
 	// Add some DDL events after the snapshot
 	ev := DDLEvent{
@@ -276,13 +277,13 @@ func TestFileStoreLoadWithSnapshot(t *testing.T) {
 			},
 		},
 	}
-	store.AppendDDL(ev)
+	store.AppendDDL(context.Background(), ev)
 
 	// Update manifest to point to snapshot at offset 0
-	store.UpdateManifest(3, 0)
+	store.UpdateManifest(context.Background(), 3, 0)
 
 	// Load should start from snapshot and replay DDL
-	cat, offset, err := store.Load()
+	cat, offset, err := store.Load(context.Background())
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -312,7 +313,7 @@ func TestFileStoreUpdateManifest(t *testing.T) {
 	tmpDir := t.TempDir()
 	store, _ := NewFileStore(tmpDir)
 
-	err := store.UpdateManifest(10, 5)
+	err := store.UpdateManifest(context.Background(), 10, 5)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -351,7 +352,7 @@ func TestFileStoreCorruptedDDL(t *testing.T) {
 			},
 		},
 	}
-	store.AppendDDL(validEv)
+	store.AppendDDL(context.Background(), validEv)
 
 	// Manually append corrupted line to DDL file
 	ddlPath := filepath.Join(tmpDir, "catalog-ddl.jsonl")
@@ -363,7 +364,7 @@ func TestFileStoreCorruptedDDL(t *testing.T) {
 	f.Close()
 
 	// Load should stop at corruption but return best-effort catalog
-	cat, offset, err := store.Load()
+	cat, offset, err := store.Load(context.Background())
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -491,7 +492,7 @@ func TestFileStoreConcurrency(t *testing.T) {
 					},
 				},
 			}
-			_, err := store.AppendDDL(ev)
+			_, err := store.AppendDDL(context.Background(), ev)
 			results <- err
 		}(i)
 	}
@@ -504,7 +505,7 @@ func TestFileStoreConcurrency(t *testing.T) {
 	}
 
 	// Verify all events were persisted
-	cat, offset, err := store.Load()
+	cat, offset, err := store.Load(context.Background())
 	if err != nil {
 		t.Fatalf("load failed: %v", err)
 	}
@@ -517,3 +518,72 @@ func TestFileStoreConcurrency(t *testing.T) {
 		t.Errorf("expected %d nodes, got %d", numGoroutines, len(cat.Nodes))
 	}
 }
+
+func TestFileStoreAppendDDLOffsetAfterReopen(t *testing.T) {
+	tmpDir := t.TempDir()
+	ev := func(name string) DDLEvent {
+		return DDLEvent{Op: OpCreateNode, Stmt: CreateNodePayload{
+			Name:   name,
+			Fields: []FieldPayload{{Name: "id", Type: TypeSpec{Base: BaseString}}},
+		}}
+	}
+
+	store, _ := NewFileStore(tmpDir)
+	store.AppendDDL(context.Background(), ev("A"))
+	store.AppendDDL(context.Background(), ev("B"))
+
+	// a new store continues from the count Load saw
+	store, _ = NewFileStore(tmpDir)
+	if _, offset, _ := store.Load(context.Background()); offset != 2 {
+		t.Fatalf("expected load offset 2, got %d", offset)
+	}
+	if offset, err := store.AppendDDL(context.Background(), ev("C")); err != nil || offset != 3 {
+		t.Fatalf("expected offset 3, got %d (%v)", offset, err)
+	}
+
+	// a store that never loaded counts the lines once
+	store, _ = NewFileStore(tmpDir)
+	if offset, err := store.AppendDDL(context.Background(), ev("D")); err != nil || offset != 4 {
+		t.Fatalf("expected offset 4 without load, got %d (%v)", offset, err)
+	}
+
+	// Load stops at a corrupted line, so the next append recounts
+	f, err := os.OpenFile(filepath.Join(tmpDir, "catalog-ddl.jsonl"), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("failed to open DDL file: %v", err)
+	}
+	f.WriteString("invalid json line\n")
+	f.Close()
+	store.AppendDDL(context.Background(), ev("E"))
+	store, _ = NewFileStore(tmpDir)
+	if _, offset, _ := store.Load(context.Background()); offset != 5 {
+		t.Fatalf("expected load to stop at line 5, got %d", offset)
+	}
+	if offset, err := store.AppendDDL(context.Background(), ev("F")); err != nil || offset != 7 {
+		t.Fatalf("expected offset 7 after recovery, got %d (%v)", offset, err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	reg, err := Open(ctx, NewMemoryStore())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	_, err = reg.Apply(ctx, DDLEvent{Op: OpCreateNode, Stmt: CreateNodePayload{
+		Name:   "A",
+		Fields: []FieldPayload{{Name: "id", Type: TypeSpec{Base: BaseString}}},
+	}})
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if _, ok := reg.Current().Nodes["A"]; !ok {
+		t.Error("node type A was not created")
+	}
+
+	// a new store starts empty
+	reg, _ = Open(ctx, NewMemoryStore())
+	if len(reg.Current().Nodes) != 0 {
+		t.Errorf("expected an empty catalog, got %v", reg.Current().Nodes)
+	}
+}
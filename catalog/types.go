@@ -23,14 +23,17 @@ const (
 	BaseDateTime
 	BaseJSON
 	BaseBlob
-	BaseArray // Elem != nil defines the element
-	BaseEnum  // EnumVals non-empty
+	BaseArray  // Elem != nil defines the element
+	BaseEnum   // EnumVals non-empty
+	BaseVector // Dim holds the length
+	BasePoint  // latitude and longitude
 )
 
 type TypeSpec struct {
 	Base     BaseType
 	Elem     *TypeSpec // for arrays
 	EnumVals []string  // for enums
+	Dim      int       `json:",omitempty"` // for vectors
 }
 
 type FieldSpec struct {
@@ -40,6 +43,9 @@ type FieldSpec struct {
 	NotNull bool
 	// NOTE: Defaults are stored as raw string form for now; coercion happens in semantic/DML layer
 	DefaultRaw *string
+	// TTL, an ISO 8601 duration, makes each node or edge expire that long
+	// after the date or datetime in this field
+	TTL string `json:",omitempty"`
 }
 
 type NodeType struct {
@@ -48,6 +54,8 @@ type NodeType struct {
 	PK     string // "" => internal ID
 	// Index metadata (runtime index handles live elsewhere)
 	Indexes map[string]IndexSpec // by field name
+	// Full-text indexes, see CREATE FULLTEXT INDEX
+	Fulltext map[string]FulltextSpec // by field name
 }
 
 type EdgeEndpoint struct {
@@ -68,6 +76,11 @@ type IndexSpec struct {
 	Unique bool
 }
 
+type FulltextSpec struct {
+	Field string
+	Stem  bool // index word stems, so "graphs" matches "graph"
+}
+
 type Catalog struct {
 	Version uint64
 	Nodes   map[string]*NodeType
@@ -108,17 +121,26 @@ func cloneNodeType(n *NodeType) *NodeType {
 			Unique:     v.Unique,
 			NotNull:    v.NotNull,
 			DefaultRaw: d,
+			TTL:        v.TTL,
 		}
 	}
 	idx := make(map[string]IndexSpec, len(n.Indexes))
 	for k, v := range n.Indexes {
 		idx[k] = v
 	}
+	var ft map[string]FulltextSpec
+	if n.Fulltext != nil {
+		ft = make(map[string]FulltextSpec, len(n.Fulltext))
+		for k, v := range n.Fulltext {
+			ft[k] = v
+		}
+	}
 	return &NodeType{
-		Name:    n.Name,
-		Fields:  f,
-		PK:      n.PK,
-		Indexes: idx,
+		Name:     n.Name,
+		Fields:   f,
+		PK:       n.PK,
+		Indexes:  idx,
+		Fulltext: ft,
 	}
 }
 
@@ -139,6 +161,7 @@ func cloneEdgeType(e *EdgeType) *EdgeType {
 			Unique:     v.Unique,
 			NotNull:    v.NotNull,
 			DefaultRaw: d,
+			TTL:        v.TTL,
 		}
 	}
 	return &EdgeType{
@@ -159,6 +182,7 @@ func cloneType(t TypeSpec) TypeSpec {
 		Base:     t.Base,
 		Elem:     elem,
 		EnumVals: slices.Clone(t.EnumVals),
+		Dim:      t.Dim,
 	}
 }
 
@@ -0,0 +1,329 @@
+// Package client is a Go client library for grapho-server. It speaks the framed
+// protocol from package wire and pools connections.
+//
+//	c, err := client.Connect(ctx, "localhost:8080", client.Options{})
+//	if err != nil { ... }
+//	defer c.Close()
+//	rows, err := c.Query(ctx, "MATCH Person WHERE name: 'Ann';")
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"grapho/executor"
+	"grapho/parser"
+	"grapho/wire"
+)
+
+// Options configures a Client. Zero values select the defaults noted below.
+type Options struct {
+	DialTimeout  time.Duration // default 5s
+	Timeout      time.Duration // per-request deadline when ctx has none; default 30s
+	MaxConns     int           // open connections at most; default 4
+	MaxRetries   int           // extra attempts after connection failures; default 2, negative disables
+	RetryBackoff time.Duration // wait before the first retry, doubled each time; default 50ms
+}
+
+func (o Options) withDefaults() Options {
+	if o.DialTimeout <= 0 {
+		o.DialTimeout = 5 * time.Second
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 30 * time.Second
+	}
+	if o.MaxConns <= 0 {
+		o.MaxConns = 4
+	}
+	if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	} else if o.MaxRetries == 0 {
+		o.MaxRetries = 2
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = 50 * time.Millisecond
+	}
+	return o
+}
+
+// ErrClosed is returned by calls on a closed Client
+var ErrClosed = errors.New("client: closed")
+
+// ServerError is a statement the server rejected. The connection stays usable.
+type ServerError struct {
+	Statement int // 1-based index of the failing statement, 0 for parse errors
+	Messages  []string
+}
+
+func (e *ServerError) Error() string {
+	if e.Statement == 0 {
+		return "grapho: parse error: " + strings.Join(e.Messages, "; ")
+	}
+	return fmt.Sprintf("grapho: statement %d: %s", e.Statement, strings.Join(e.Messages, "; "))
+}
+
+// Client is a pool of connections to one server. It is safe for concurrent use.
+type Client struct {
+	addr   string
+	opts   Options
+	sem    chan struct{} // one token per open or dialing connection
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+// Connect creates a client for addr and checks that the server is reachable
+func Connect(ctx context.Context, addr string, opts Options) (*Client, error) {
+	opts = opts.withDefaults()
+	c := &Client{
+		addr: addr,
+		opts: opts,
+		sem:  make(chan struct{}, opts.MaxConns),
+	}
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.put(cn, true)
+	return c, nil
+}
+
+// Close closes idle connections; connections in use are closed when released
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for _, cn := range c.idle {
+		cn.nc.Close()
+		<-c.sem
+	}
+	c.idle = nil
+	return nil
+}
+
+// Exec runs one or more statements, discarding any result rows
+func (c *Client) Exec(ctx context.Context, script string) error {
+	_, err := c.do(ctx, script)
+	return err
+}
+
+// Query runs one or more statements and returns the rows they produce
+func (c *Client) Query(ctx context.Context, script string) ([]Row, error) {
+	return c.do(ctx, script)
+}
+
+// do sends script on a pooled connection, retrying on connection failures.
+// Scripts that mutate state are only retried if sending them failed outright,
+// since the server may have applied them before the connection broke.
+func (c *Client) do(ctx context.Context, script string) ([]Row, error) {
+	line, err := wire.FoldCommand(script)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(line, ";") {
+		line += ";"
+	}
+	readOnly := isReadOnly(line)
+
+	backoff := c.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		cn, err := c.get(ctx)
+		if err == nil {
+			var (
+				rows []Row
+				sent bool
+				serr *ServerError
+			)
+			rows, sent, err = cn.roundTrip(ctx, line, c.opts.Timeout)
+			healthy := err == nil || errors.As(err, &serr)
+			c.put(cn, healthy)
+			if healthy || (sent && !readOnly) {
+				return rows, err
+			}
+		}
+		if errors.Is(err, ErrClosed) || ctx.Err() != nil || attempt >= c.opts.MaxRetries {
+			return nil, err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// isReadOnly reports whether every statement in line is a query
+func isReadOnly(line string) bool {
+	stmts, errs := parser.NewParser(line).ParseScript()
+	if len(errs) > 0 {
+		// the server will reject it without side effects
+		return true
+	}
+	for _, st := range stmts {
+		if executor.Mutates(st) {
+			return false
+		}
+	}
+	return true
+}
+
+// get returns an idle connection or dials a new one once a slot is free
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	if cn, err := c.takeIdle(); cn != nil || err != nil {
+		return cn, err
+	}
+
+	select {
+	case c.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	// another request may have released a connection while we waited
+	if cn, err := c.takeIdle(); cn != nil || err != nil {
+		<-c.sem
+		return cn, err
+	}
+
+	cn, err := dial(ctx, c.addr, c.opts.DialTimeout)
+	if err != nil {
+		<-c.sem
+		return nil, err
+	}
+	return cn, nil
+}
+
+func (c *Client) takeIdle() (*conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrClosed
+	}
+	n := len(c.idle)
+	if n == 0 {
+		return nil, nil
+	}
+	cn := c.idle[n-1]
+	c.idle = c.idle[:n-1]
+	return cn, nil
+}
+
+// put returns cn to the pool, or closes it if it is broken or the client closed
+func (c *Client) put(cn *conn, healthy bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !healthy || c.closed {
+		cn.nc.Close()
+		<-c.sem
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+// conn is one framed-protocol connection
+type conn struct {
+	nc   net.Conn
+	r    *bufio.Reader
+	more bool // the last DONE said the connection's cursor has rows left
+}
+
+func dial(ctx context.Context, addr string, timeout time.Duration) (*conn, error) {
+	d := net.Dialer{Timeout: timeout}
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("client: dial %s: %w", addr, err)
+	}
+	cn := &conn{nc: nc, r: bufio.NewReader(nc)}
+	nc.SetDeadline(time.Now().Add(timeout))
+	if err := cn.handshake(); err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("client: handshake with %s: %w", addr, err)
+	}
+	nc.SetDeadline(time.Time{})
+	return cn, nil
+}
+
+// handshake skips the text welcome message and switches to the framed protocol
+func (cn *conn) handshake() error {
+	for {
+		line, err := cn.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if strings.TrimRight(line, "\r\n") == "" {
+			break
+		}
+	}
+	if _, err := fmt.Fprintf(cn.nc, "%s\n", wire.SwitchCommand); err != nil {
+		return err
+	}
+	f, err := wire.ReadFrame(cn.r)
+	if err != nil {
+		return err
+	}
+	if f.Type != wire.FrameMessage {
+		return fmt.Errorf("unexpected %v frame", f.Type)
+	}
+	return nil
+}
+
+// roundTrip sends one command and reads frames until DONE or ERROR. sent reports
+// whether the command reached the connection, for the retry decision.
+func (cn *conn) roundTrip(ctx context.Context, line string, timeout time.Duration) (rows []Row, sent bool, err error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(timeout)
+	}
+	cn.nc.SetDeadline(deadline)
+	defer cn.nc.SetDeadline(time.Time{})
+	// unblock reads and writes when ctx is cancelled
+	stop := context.AfterFunc(ctx, func() { cn.nc.SetDeadline(time.Now()) })
+	defer stop()
+
+	if _, err := fmt.Fprintf(cn.nc, "%s\n", line); err != nil {
+		return nil, false, fmt.Errorf("client: send: %w", err)
+	}
+	for {
+		f, err := wire.ReadFrame(cn.r)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, true, ctx.Err()
+			}
+			return nil, true, fmt.Errorf("client: read: %w", err)
+		}
+		switch f.Type {
+		case wire.FrameMessage, wire.FrameResultSet:
+		case wire.FrameRow:
+			var wr wire.Row
+			if err := f.Decode(&wr); err != nil {
+				return nil, true, err
+			}
+			props := make(map[string]Value, len(wr.Properties))
+			for k, v := range wr.Properties {
+				props[k] = Value{v: v}
+			}
+			rows = append(rows, Row{Type: wr.Type, ID: wr.ID, Properties: props})
+		case wire.FrameDone:
+			var done wire.Done
+			if err := f.Decode(&done); err != nil {
+				return nil, true, err
+			}
+			cn.more = done.More
+			return rows, true, nil
+		case wire.FrameError:
+			var we wire.Error
+			if err := f.Decode(&we); err != nil {
+				return nil, true, err
+			}
+			return nil, true, &ServerError{Statement: we.Statement, Messages: we.Messages}
+		default:
+			return nil, true, fmt.Errorf("client: unexpected %v frame", f.Type)
+		}
+	}
+}
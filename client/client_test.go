@@ -0,0 +1,256 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"grapho/catalog"
+	"grapho/server"
+)
+
+// startServer runs a server with an empty catalog on a free local port
+func startServer(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	store, err := catalog.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, err := catalog.Open(context.Background(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := server.NewServer(addr, reg)
+	go srv.Start()
+	t.Cleanup(func() { srv.Stop() })
+
+	for i := 0; i < 100; i++ {
+		if c, err := net.Dial("tcp", addr); err == nil {
+			c.Close()
+			return addr
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("server did not start on %s", addr)
+	return ""
+}
+
+func TestExecQuery(t *testing.T) {
+	ctx := context.Background()
+	c, err := Connect(ctx, startServer(t), Options{})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer c.Close()
+
+	err = c.Exec(ctx, `
+		CREATE NODE Person (name: STRING, age: INT); -- schema
+		INSERT NODE Person (name: 'Ann', age: 31);
+		INSERT NODE Person (name: 'Bob', age: 42);`)
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+
+	rows, err := c.Query(ctx, "MATCH Person WHERE name: 'Ann'")
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows, want 1", len(rows))
+	}
+	r := rows[0]
+	if r.Type != "Person" || r.Get("name").String() != "Ann" {
+		t.Errorf("unexpected row %+v", r)
+	}
+	if age, err := r.Get("age").Int64(); err != nil || age != 31 {
+		t.Errorf("age = %d, %v; want 31", age, err)
+	}
+	if !r.Get("missing").IsNull() {
+		t.Errorf("missing property should be null")
+	}
+}
+
+func TestServerError(t *testing.T) {
+	ctx := context.Background()
+	c, err := Connect(ctx, startServer(t), Options{})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer c.Close()
+
+	err = c.Exec(ctx, "INSERT NODE Nope (x: 1);")
+	var serr *ServerError
+	if !errors.As(err, &serr) || serr.Statement != 1 {
+		t.Fatalf("got %v, want ServerError for statement 1", err)
+	}
+
+	err = c.Exec(ctx, "CREATE NODE;")
+	if !errors.As(err, &serr) || serr.Statement != 0 {
+		t.Fatalf("got %v, want parse ServerError", err)
+	}
+
+	// the connection is still usable after server-side errors
+	if err := c.Exec(ctx, "CREATE NODE Thing (x: INT);"); err != nil {
+		t.Fatalf("Exec after error: %v", err)
+	}
+}
+
+func TestConcurrentClients(t *testing.T) {
+	ctx := context.Background()
+	addr := startServer(t)
+	setup, err := Connect(ctx, addr, Options{})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer setup.Close()
+	if err := setup.Exec(ctx, "CREATE NODE Item (n: INT PRIMARY KEY, owner: STRING INDEX);"); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+
+	const clients, each = 8, 25
+	errs := make(chan error, clients)
+	for i := 0; i < clients; i++ {
+		go func() {
+			c, err := Connect(ctx, addr, Options{})
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer c.Close()
+			owner := fmt.Sprintf("c%d", i)
+			for j := 0; j < each; j++ {
+				if err := c.Exec(ctx, fmt.Sprintf("INSERT NODE Item (n: %d, owner: '%s');", i*each+j, owner)); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := c.Query(ctx, fmt.Sprintf("MATCH Item WHERE owner: '%s';", owner)); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for i := 0; i < clients; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows, err := setup.Query(ctx, "MATCH Item;")
+	if err != nil || len(rows) != clients*each {
+		t.Fatalf("got %d rows, %v; want %d", len(rows), err, clients*each)
+	}
+}
+
+func TestClosed(t *testing.T) {
+	ctx := context.Background()
+	c, err := Connect(ctx, startServer(t), Options{})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	c.Close()
+	if _, err := c.Query(ctx, "MATCH Person;"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("got %v, want ErrClosed", err)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	ctx := context.Background()
+	c, err := Connect(ctx, startServer(t), Options{MaxConns: 2})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer c.Close()
+
+	script := "CREATE NODE Item (n: INT);"
+	for i := 0; i < 25; i++ {
+		script += fmt.Sprintf(" INSERT NODE Item (n: %d);", i)
+	}
+	if err := c.Exec(ctx, script); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+
+	cur, err := c.OpenCursor(ctx, "MATCH Item")
+	if err != nil {
+		t.Fatalf("OpenCursor: %v", err)
+	}
+	var sizes []int
+	seen := map[string]bool{}
+	for cur.More() {
+		rows, err := cur.Next(ctx, 10)
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		sizes = append(sizes, len(rows))
+		for _, r := range rows {
+			seen[r.Get("n").String()] = true
+		}
+	}
+	if fmt.Sprint(sizes) != "[10 10 5]" || len(seen) != 25 {
+		t.Fatalf("batches %v, %d distinct rows", sizes, len(seen))
+	}
+	if rows, err := cur.Next(ctx, 10); len(rows) != 0 || err != nil {
+		t.Fatalf("Next after the end = %d rows, %v", len(rows), err)
+	}
+
+	// a cursor reads the graph as it was when opened
+	cur, err = c.OpenCursor(ctx, "MATCH Item WHERE n < 3")
+	if err != nil {
+		t.Fatalf("OpenCursor: %v", err)
+	}
+	if rows, err := cur.Next(ctx, 1); len(rows) != 1 || err != nil || !cur.More() {
+		t.Fatalf("first row = %d rows, %v", len(rows), err)
+	}
+	if err := c.Exec(ctx, "DELETE NODE Item WHERE n < 3;"); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if rows, err := cur.Next(ctx, 10); len(rows) != 2 || err != nil || cur.More() {
+		t.Fatalf("rest = %d rows, %v", len(rows), err)
+	}
+
+	// closing a cursor early frees its connection for other requests
+	cur, err = c.OpenCursor(ctx, "MATCH Item")
+	if err != nil {
+		t.Fatalf("OpenCursor: %v", err)
+	}
+	if err := cur.Close(ctx); err != nil || cur.More() {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if _, err := c.OpenCursor(ctx, "MATCH Item; MATCH Item"); err == nil {
+		t.Fatal("a cursor over two statements should fail")
+	}
+	if _, err := c.OpenCursor(ctx, "MATCH Item SET n: 1"); err == nil {
+		t.Fatal("a cursor over a write should fail")
+	}
+	// an empty result closes the cursor at once
+	cur, err = c.OpenCursor(ctx, "MATCH Item WHERE n < 3")
+	if err != nil || cur.More() {
+		t.Fatalf("cursor over no rows: More = %v, %v", cur.More(), err)
+	}
+}
+
+func TestValueConversions(t *testing.T) {
+	if v, err := (Value{v: "12"}).Int64(); err != nil || v != 12 {
+		t.Errorf("Int64 = %d, %v", v, err)
+	}
+	if v, err := (Value{v: "2.5"}).Float64(); err != nil || v != 2.5 {
+		t.Errorf("Float64 = %v, %v", v, err)
+	}
+	if v, err := (Value{v: true}).Bool(); err != nil || !v {
+		t.Errorf("Bool = %v, %v", v, err)
+	}
+	if _, err := (Value{}).Int64(); err == nil {
+		t.Errorf("Int64 of null should fail")
+	}
+}
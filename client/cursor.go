@@ -0,0 +1,77 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"grapho/wire"
+)
+
+// Cursor reads the rows of a MATCH a batch at a time, for results too large
+// to take in one Query. It keeps one of the client's connections until its
+// last row is read or it is closed; it is not safe for concurrent use.
+type Cursor struct {
+	c  *Client
+	cn *conn // nil once released
+}
+
+// OpenCursor opens a cursor over the rows of query, a single MATCH. The rows
+// are those of the graph as it is now, whatever runs while they are read.
+func (c *Client) OpenCursor(ctx context.Context, query string) (*Cursor, error) {
+	line, err := wire.FoldCommand(query)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(line, ";") {
+		line += ";"
+	}
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cu := &Cursor{c: c, cn: cn}
+	if _, err := cu.roundTrip(ctx, wire.CursorCommand+" "+line); err != nil {
+		return nil, err
+	}
+	return cu, nil
+}
+
+// Next returns up to n more rows, or none once all have been read
+func (cu *Cursor) Next(ctx context.Context, n int) ([]Row, error) {
+	if cu.cn == nil {
+		return nil, nil
+	}
+	if n < 1 {
+		return nil, fmt.Errorf("client: fetch of %d rows", n)
+	}
+	return cu.roundTrip(ctx, fmt.Sprintf("%s %d", wire.FetchCommand, n))
+}
+
+// More reports whether rows are left to read
+func (cu *Cursor) More() bool {
+	return cu.cn != nil
+}
+
+// Close discards the rows left, if any, and releases the connection
+func (cu *Cursor) Close(ctx context.Context) error {
+	if cu.cn == nil {
+		return nil
+	}
+	_, err := cu.roundTrip(ctx, wire.CloseCommand)
+	return err
+}
+
+// roundTrip sends line, releasing the connection once the server reports the
+// cursor closed or the connection fails
+func (cu *Cursor) roundTrip(ctx context.Context, line string) ([]Row, error) {
+	rows, _, err := cu.cn.roundTrip(ctx, line, cu.c.opts.Timeout)
+	var serr *ServerError
+	healthy := err == nil || errors.As(err, &serr)
+	if err != nil || !cu.cn.more {
+		cu.c.put(cu.cn, healthy)
+		cu.cn = nil
+	}
+	return rows, err
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Value is a property value received from the server
+type Value struct {
+	v any
+}
+
+// IsNull reports whether the value is null or absent
+func (v Value) IsNull() bool { return v.v == nil }
+
+// Raw returns the decoded value: nil, string, bool, json.Number, []any or map[string]any
+func (v Value) Raw() any { return v.v }
+
+// String formats the value as text; null becomes ""
+func (v Value) String() string {
+	if v.v == nil {
+		return ""
+	}
+	if s, ok := v.v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v.v)
+}
+
+// Int64 converts numeric values, and strings holding integers, to int64
+func (v Value) Int64() (int64, error) {
+	switch x := v.v.(type) {
+	case json.Number:
+		return x.Int64()
+	case string:
+		return strconv.ParseInt(x, 10, 64)
+	default:
+		return 0, fmt.Errorf("client: cannot convert %T to int64", v.v)
+	}
+}
+
+// Float64 converts numeric values, and strings holding numbers, to float64
+func (v Value) Float64() (float64, error) {
+	switch x := v.v.(type) {
+	case json.Number:
+		return x.Float64()
+	case string:
+		return strconv.ParseFloat(x, 64)
+	default:
+		return 0, fmt.Errorf("client: cannot convert %T to float64", v.v)
+	}
+}
+
+// Bool converts boolean values, and the strings "true"/"false", to bool
+func (v Value) Bool() (bool, error) {
+	switch x := v.v.(type) {
+	case bool:
+		return x, nil
+	case string:
+		return strconv.ParseBool(x)
+	default:
+		return false, fmt.Errorf("client: cannot convert %T to bool", v.v)
+	}
+}
+
+// Row is one result row
+type Row struct {
+	Type       string
+	ID         string
+	Properties map[string]Value
+}
+
+// Get returns the named property; missing properties are null
+func (r Row) Get(name string) Value {
+	return r.Properties[name]
+}
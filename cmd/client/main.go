@@ -6,145 +6,94 @@ import (
 	"fmt"
 	"net"
 	"os"
-	"regexp"
 	"strings"
-)
 
-// matchRenderer holds temporary state while collecting a MATCH response
-type matchRenderer struct {
-	collecting bool
-	lines      []string
-}
+	"grapho/wire"
+)
 
-func (mr *matchRenderer) start() {
-	mr.collecting = true
-	mr.lines = mr.lines[:0]
-}
+// Process exit codes
+const (
+	exitOK     = 0 // every statement succeeded
+	exitFailed = 1 // at least one statement failed
+	exitError  = 2 // the client could not run: bad flags, connection or I/O failure
+)
 
-func (mr *matchRenderer) add(line string) {
-	mr.lines = append(mr.lines, line)
+func main() {
+	var (
+		addr       = flag.String("addr", "localhost:8080", "Server address to connect to")
+		outputPath = flag.String("output", "", "Write query results to this file instead of the terminal")
+		format     = flag.String("format", "", "Result file format: table|csv|json (default: from file extension)")
+		scriptPath = flag.String("f", "", "Execute statements from this file and exit")
+		singleTx   = flag.Bool("single-transaction", false, "With -f, send the script as one batch that stops at the first error")
+		showBar    = flag.Bool("progress", true, "With -f, show a progress bar when stderr is a terminal (not with -single-transaction)")
+		quiet      = flag.Bool("q", false, "Quiet: print only result rows and errors")
+		verbose    = flag.Bool("v", false, "Verbose: echo statements sent and show wire timings")
+		language   = flag.String("language", "grapho", "Query language: grapho|cypher")
+	)
+	flag.Parse()
+	os.Exit(run(*addr, *outputPath, *format, *scriptPath, *language, *singleTx, *showBar && !*quiet, *quiet, *verbose))
 }
 
-func (mr *matchRenderer) reset() {
-	mr.collecting = false
-	mr.lines = mr.lines[:0]
-}
+// run executes the client and returns the process exit code
+func run(addr, outputPath, format, scriptPath, language string, singleTx, showBar, quiet, verbose bool) int {
+	out := &output{quiet: quiet}
+	if outputPath != "" {
+		if err := out.redirect(outputPath, format); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open output: %v\n", err)
+			return exitError
+		}
+	}
+	defer out.close()
 
-// render pretty-prints collected MATCH response lines
-func (mr *matchRenderer) render() {
-	if len(mr.lines) == 0 {
-		return
+	// Connect to server
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to server: %v\n", err)
+		return exitError
 	}
+	defer conn.Close()
 
-	// Patterns: "Nodes of type 'X':" and "  ID: <id>, Properties: map[... ]"
-	sectionRe := regexp.MustCompile(`^Nodes of type '([^']+)':$`)
-	idLineRe := regexp.MustCompile(`^\s*ID:\s*([^,]+),\s*Properties:\s*(.*)$`)
+	sess := newSession(conn, out, format)
+	defer func() { sess.rec.stop() }()
+	sess.quiet, sess.verbose = quiet, verbose
 
-	currentType := ""
-	fmt.Println("MATCH Results (formatted):")
+	sess.info("Connected to Grapho server at %s", addr)
+	sess.info("Type DDL commands or 'quit' to exit")
 
-	for _, ln := range mr.lines {
-		if m := sectionRe.FindStringSubmatch(strings.TrimSpace(ln)); m != nil {
-			currentType = m[1]
-			fmt.Printf("\nType: %s\n", currentType)
-			fmt.Println("------------------------")
-			continue
-		}
-		if m := idLineRe.FindStringSubmatch(strings.TrimSpace(ln)); m != nil {
-			id := strings.TrimSpace(m[1])
-			propsRaw := strings.TrimSpace(m[2])
-			// Parse Go-style map[...] to key=value list (best-effort)
-			props := parseProps(propsRaw)
-			fmt.Printf("- id: %s", id)
-			if currentType != "" {
-				fmt.Printf("  (%s)", currentType)
-			}
-			fmt.Println()
-			if len(props) > 0 {
-				for _, kv := range props {
-					fmt.Printf("    %s\n", kv)
-				}
-			}
-			continue
-		}
-		// Fallback: print any other line inside block
-		if strings.TrimSpace(ln) != "" {
-			fmt.Println(ln)
-		}
+	if err := sess.handshake(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to start session: %v\n", err)
+		return exitError
 	}
-	fmt.Println()
-}
-
-// parseProps converts a "map[k1:v1 k2:v2]" string into []"k=v"
-func parseProps(s string) []string {
-	s = strings.TrimSpace(s)
-	if strings.HasPrefix(s, "map[") && strings.HasSuffix(s, "]") {
-		inner := s[4:len(s)-1]
-		parts := strings.Fields(inner)
-		out := make([]string, 0, len(parts))
-		for _, p := range parts {
-			// keep as "k:v" -> "k=v"
-			out = append(out, strings.ReplaceAll(p, ":", "="))
-		}
-		return out
+	if language != wire.LanguageGrapho {
+		if err := sess.setLanguage(language); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to select language: %v\n", err)
+			return exitError
+		}
 	}
-	return nil
-}
 
-func main() {
-	var addr = flag.String("addr", "localhost:8080", "Server address to connect to")
-	flag.Parse()
-
-	// Connect to server
-	conn, err := net.Dial("tcp", *addr)
-	if err != nil {
-		fmt.Printf("Failed to connect to server: %v\n", err)
-		os.Exit(1)
+	if scriptPath != "" {
+		failed, err := runScript(sess, scriptPath, singleTx, showBar)
+		sess.send("quit")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Script failed: %v\n", err)
+			return exitError
+		}
+		if failed > 0 {
+			return exitFailed
+		}
+		return exitOK
 	}
-	defer conn.Close()
 
-	fmt.Printf("Connected to Grapho server at %s\n", *addr)
-	fmt.Println("Type DDL commands or 'quit' to exit")
-
-	// Start goroutine to read and render server responses
-	go func() {
-		scanner := bufio.NewScanner(conn)
-		mr := &matchRenderer{}
-		for scanner.Scan() {
-			line := scanner.Text()
-
-			// Detect start of MATCH block
-			if strings.HasPrefix(line, "MATCH Results:") {
-				mr.start()
-				// Don't print the raw header; we'll print our own later
-				continue
-			}
-
-			// If collecting MATCH lines, buffer until command completion
-			if mr.collecting {
-				// End conditions: OK -, Error executing, or blank line after OK
-				if strings.HasPrefix(line, "OK - ") || strings.HasPrefix(line, "Error executing") {
-					// First render the collected MATCH output
-					mr.render()
-					mr.reset()
-					// Then print the completion line
-					fmt.Println(line)
-					continue
-				}
-				// Still part of MATCH block
-				mr.add(line)
-				continue
-			}
-
-			// Default: echo line as-is
-			fmt.Println(line)
-		}
-	}()
-
-	// Read user input and send to server
+	// Read user input, send it to the server and wait for each response
 	scanner := bufio.NewScanner(os.Stdin)
+	pending := false
+	failed := 0
 	for {
-		fmt.Print("> ")
+		if pending {
+			fmt.Print("... ")
+		} else {
+			fmt.Print("> ")
+		}
 		if !scanner.Scan() {
 			break
 		}
@@ -154,15 +103,53 @@ func main() {
 			continue
 		}
 
-		if line == "quit" || line == "exit" {
-			fmt.Fprintf(conn, "quit\n")
+		if !pending && (line == "quit" || line == "exit") {
+			sess.send("quit")
 			break
 		}
 
-		fmt.Fprintf(conn, "%s\n", line)
+		if !pending && sess.meta(line) {
+			continue
+		}
+		if !pending && strings.HasPrefix(line, wire.CursorCommand+" ") {
+			sess.cursor = true
+		}
+
+		line, err := sess.vars.substitute(line)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			failed++
+			continue
+		}
+		if err := sess.send(line); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to send command: %v\n", err)
+			return exitError
+		}
+		sess.rec.add(line)
+		pending = !strings.HasSuffix(line, ";")
+		if pending {
+			continue
+		}
+		ok, err := sess.readResponse()
+		sess.cursor = false
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Connection closed: %v\n", err)
+			return exitError
+		}
+		if !ok {
+			failed++
+		}
+		if err := sess.rec.commit(ok); err != nil {
+			sess.errorf("Error writing recording: %v", err)
+		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		fmt.Printf("Error reading input: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+		return exitError
+	}
+	if failed > 0 {
+		return exitFailed
 	}
+	return exitOK
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"grapho/wire"
+)
+
+// meta runs a backslash meta-command locally; it reports whether line was one
+func (s *session) meta(line string) bool {
+	if !strings.HasPrefix(line, "\\") {
+		return false
+	}
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case "\\o":
+		path := ""
+		if len(fields) > 1 {
+			path = fields[1]
+		}
+		if err := s.out.redirect(path, s.format); err != nil {
+			s.errorf("Error: %v", err)
+		} else if path == "" {
+			s.info("Query output restored to terminal")
+		} else {
+			s.info("Query output redirected to %s", path)
+		}
+	case "\\set":
+		switch len(fields) {
+		case 1:
+			names := make([]string, 0, len(s.vars))
+			for name := range s.vars {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Printf("%s = '%s'\n", name, s.vars[name])
+			}
+		default:
+			// value is the rest of the line, so it may contain spaces
+			value := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line[len(fields[0]):]), fields[1]))
+			if err := s.vars.set(fields[1], value); err != nil {
+				s.errorf("Error: %v", err)
+			}
+		}
+	case "\\record":
+		if len(fields) != 2 {
+			s.errorf("Usage: \\record file")
+			break
+		}
+		if s.rec != nil {
+			s.errorf("Already recording to %s; use \\stop first", s.rec.path)
+			break
+		}
+		rec, err := startRecording(fields[1])
+		if err != nil {
+			s.errorf("Error: %v", err)
+			break
+		}
+		s.rec = rec
+		s.info("Recording statements to %s", fields[1])
+	case "\\stop":
+		if s.rec == nil {
+			s.errorf("Not recording")
+			break
+		}
+		path := s.rec.path
+		if err := s.rec.stop(); err != nil {
+			s.errorf("Error: %v", err)
+		}
+		s.rec = nil
+		s.info("Stopped recording to %s", path)
+	case "\\language":
+		if len(fields) != 2 {
+			s.errorf("Usage: \\language grapho|cypher")
+			break
+		}
+		if err := s.setLanguage(fields[1]); err != nil {
+			s.errorf("Error: %v", err)
+		}
+	case wire.CursorCommand:
+		// the server's, opening a cursor over the MATCH that follows
+		return false
+	case wire.FetchCommand, wire.CloseCommand:
+		s.cursorCommand(line)
+	case "\\unset":
+		if len(fields) != 2 {
+			s.errorf("Usage: \\unset name")
+			break
+		}
+		delete(s.vars, fields[1])
+	default:
+		s.errorf("Unknown meta-command: %s", fields[0])
+	}
+	return true
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"grapho/wire"
+)
+
+// Output formats supported for query results
+const (
+	formatTable = "table"
+	formatCSV   = "csv"
+	formatJSON  = "json"
+)
+
+// resultRow is a single row received in a result set
+type resultRow = wire.Row
+
+// output decides where query results go: the terminal or a file set via \o / -output
+type output struct {
+	quiet  bool // don't report rows written to a file
+	path   string
+	file   *os.File
+	format string
+}
+
+// formatFor picks the output format for a file, preferring an explicit format
+func formatFor(path, explicit string) (string, error) {
+	switch strings.ToLower(explicit) {
+	case "":
+	case formatTable, formatCSV, formatJSON:
+		return strings.ToLower(explicit), nil
+	default:
+		return "", fmt.Errorf("unknown output format %q (want table, csv or json)", explicit)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return formatCSV, nil
+	case ".json", ".jsonl":
+		return formatJSON, nil
+	default:
+		return formatTable, nil
+	}
+}
+
+// redirect sends subsequent results to path; an empty path restores the terminal
+func (o *output) redirect(path, format string) error {
+	if o.file != nil {
+		if err := o.file.Close(); err != nil {
+			return fmt.Errorf("close %s: %w", o.path, err)
+		}
+		o.file = nil
+		o.path = ""
+	}
+	if path == "" {
+		return nil
+	}
+
+	f, err := formatFor(path, format)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("open output file: %w", err)
+	}
+	o.file = file
+	o.path = path
+	o.format = f
+	return nil
+}
+
+// close releases the output file, if any
+func (o *output) close() error {
+	return o.redirect("", "")
+}
+
+// writeRows renders rows to the current destination
+func (o *output) writeRows(rows []resultRow) error {
+	if o.file == nil {
+		writeTable(os.Stdout, rows)
+		return nil
+	}
+
+	var err error
+	switch o.format {
+	case formatCSV:
+		err = writeCSV(o.file, rows)
+	case formatJSON:
+		err = writeJSON(o.file, rows)
+	default:
+		writeTable(o.file, rows)
+	}
+	if err != nil {
+		return fmt.Errorf("write %s: %w", o.path, err)
+	}
+	if !o.quiet {
+		fmt.Printf("%d row(s) written to %s\n", len(rows), o.path)
+	}
+	return nil
+}
+
+// writeTable pretty-prints rows grouped by node type
+func writeTable(w io.Writer, rows []resultRow) {
+	fmt.Fprintln(w, "MATCH Results (formatted):")
+	currentType := ""
+	for _, r := range rows {
+		if r.Type != currentType {
+			currentType = r.Type
+			fmt.Fprintf(w, "\nType: %s\n", currentType)
+			fmt.Fprintln(w, "------------------------")
+		}
+		if r.ID == "" {
+			// a joined row from a path MATCH
+			fmt.Fprint(w, "- row")
+		} else {
+			fmt.Fprintf(w, "- id: %s", r.ID)
+		}
+		if r.Type != "" {
+			fmt.Fprintf(w, "  (%s)", r.Type)
+		}
+		fmt.Fprintln(w)
+		for _, k := range sortedKeys(r.Properties) {
+			fmt.Fprintf(w, "    %s=%v\n", k, r.Properties[k])
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// writeCSV writes one header row (type, id, then the union of property keys) followed by the rows
+func writeCSV(w io.Writer, rows []resultRow) error {
+	seen := map[string]bool{}
+	var keys []string
+	for _, r := range rows {
+		for k := range r.Properties {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"type", "id"}, keys...)); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		rec := []string{r.Type, r.ID}
+		for _, k := range keys {
+			v, ok := r.Properties[k]
+			if !ok || v == nil {
+				rec = append(rec, "")
+				continue
+			}
+			rec = append(rec, fmt.Sprint(v))
+		}
+		if err := cw.Write(rec); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeJSON writes one JSON object per row (JSON Lines)
+func writeJSON(w io.Writer, rows []resultRow) error {
+	enc := json.NewEncoder(w)
+	for _, r := range rows {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
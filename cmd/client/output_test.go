@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFormatFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		explicit string
+		want     string
+		wantErr  bool
+	}{
+		{name: "csv extension", path: "out.csv", want: formatCSV},
+		{name: "json extension", path: "out.json", want: formatJSON},
+		{name: "jsonl extension", path: "out.JSONL", want: formatJSON},
+		{name: "other extension", path: "out.txt", want: formatTable},
+		{name: "no extension", path: "out", want: formatTable},
+		{name: "explicit wins", path: "out.csv", explicit: "JSON", want: formatJSON},
+		{name: "unknown format", path: "out.csv", explicit: "xml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := formatFor(tt.path, tt.explicit)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("formatFor(%q, %q) = %q, want an error", tt.path, tt.explicit, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("formatFor(%q, %q) = %q, %v, want %q", tt.path, tt.explicit, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteRows(t *testing.T) {
+	rows := []resultRow{
+		{Type: "Person", ID: "1", Properties: map[string]any{"name": "Ann", "age": 30.0}},
+		{Type: "Person", ID: "2", Properties: map[string]any{"name": "Bo, \"Jr\"", "age": nil}},
+		{Type: "City", ID: "3", Properties: map[string]any{"name": "Oslo", "pop": 700000.0}},
+	}
+	// joined rows from a path MATCH carry no type or ID
+	joined := []resultRow{
+		{Properties: map[string]any{"a.name": "Ann", "c.name": "Oslo"}},
+		{Properties: map[string]any{"a.name": "Bo", "c.name": nil}},
+	}
+	tests := []struct {
+		name  string
+		rows  []resultRow
+		write func(*bytes.Buffer, []resultRow) error
+		want  string
+	}{
+		{
+			name: "table",
+			rows: rows,
+			write: func(b *bytes.Buffer, rows []resultRow) error {
+				writeTable(b, rows)
+				return nil
+			},
+			want: `MATCH Results (formatted):
+
+Type: Person
+------------------------
+- id: 1  (Person)
+    age=30
+    name=Ann
+- id: 2  (Person)
+    age=<nil>
+    name=Bo, "Jr"
+
+Type: City
+------------------------
+- id: 3  (City)
+    name=Oslo
+    pop=700000
+
+`,
+		},
+		{
+			name: "table of joined rows",
+			rows: joined,
+			write: func(b *bytes.Buffer, rows []resultRow) error {
+				writeTable(b, rows)
+				return nil
+			},
+			want: `MATCH Results (formatted):
+- row
+    a.name=Ann
+    c.name=Oslo
+- row
+    a.name=Bo
+    c.name=<nil>
+
+`,
+		},
+		{
+			name: "empty table",
+			write: func(b *bytes.Buffer, rows []resultRow) error {
+				writeTable(b, rows)
+				return nil
+			},
+			want: "MATCH Results (formatted):\n\n",
+		},
+		{
+			name:  "csv",
+			rows:  rows,
+			write: func(b *bytes.Buffer, rows []resultRow) error { return writeCSV(b, rows) },
+			want: `type,id,age,name,pop
+Person,1,30,Ann,
+Person,2,,"Bo, ""Jr""",
+City,3,,Oslo,700000
+`,
+		},
+		{
+			name:  "csv of joined rows",
+			rows:  joined,
+			write: func(b *bytes.Buffer, rows []resultRow) error { return writeCSV(b, rows) },
+			want: `type,id,a.name,c.name
+,,Ann,Oslo
+,,Bo,
+`,
+		},
+		{
+			name:  "empty csv",
+			write: func(b *bytes.Buffer, rows []resultRow) error { return writeCSV(b, rows) },
+			want:  "type,id\n",
+		},
+		{
+			name:  "json",
+			rows:  rows,
+			write: func(b *bytes.Buffer, rows []resultRow) error { return writeJSON(b, rows) },
+			want: `{"type":"Person","id":"1","properties":{"age":30,"name":"Ann"}}
+{"type":"Person","id":"2","properties":{"age":null,"name":"Bo, \"Jr\""}}
+{"type":"City","id":"3","properties":{"name":"Oslo","pop":700000}}
+`,
+		},
+		{
+			name:  "empty json",
+			write: func(b *bytes.Buffer, rows []resultRow) error { return writeJSON(b, rows) },
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := tt.write(&b, tt.rows); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
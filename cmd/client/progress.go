@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// progress draws an in-place progress bar on stderr while a script runs
+type progress struct {
+	total int
+	done  int
+	start time.Time
+	drawn bool
+}
+
+// newProgress returns nil when stderr is not a terminal, so callers can skip drawing
+func newProgress(total int) *progress {
+	fi, err := os.Stderr.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	return &progress{total: total, start: time.Now()}
+}
+
+// clear erases the bar so regular output can be printed on a clean line
+func (p *progress) clear() {
+	if p == nil || !p.drawn {
+		return
+	}
+	fmt.Fprint(os.Stderr, "\r\033[K")
+	p.drawn = false
+}
+
+// step records n finished statements and redraws the bar
+func (p *progress) step(n int) {
+	if p == nil {
+		return
+	}
+	p.done += n
+	p.draw(time.Now())
+}
+
+func (p *progress) draw(now time.Time) {
+	const width = 30
+	frac := float64(p.done) / float64(p.total)
+	filled := int(frac * width)
+	elapsed := now.Sub(p.start).Seconds()
+
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(p.done) / elapsed
+	}
+	eta := remaining(p.total-p.done, rate)
+
+	fmt.Fprintf(os.Stderr, "\r\033[K[%s%s] %d/%d statements  %.1f stmt/s  ETA %s",
+		strings.Repeat("=", filled), strings.Repeat(" ", width-filled),
+		p.done, p.total, rate, eta)
+	p.drawn = true
+}
+
+// remaining estimates how long n statements take at rate per second: to the
+// second, or to a tenth of one when under a second is left. It is "--" with
+// no rate to go by.
+func remaining(n int, rate float64) string {
+	if rate <= 0 || n <= 0 {
+		return "--"
+	}
+	d := time.Duration(float64(n) / rate * float64(time.Second))
+	if d < time.Second {
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+// finish leaves the final bar on its own line
+func (p *progress) finish() {
+	if p == nil || !p.drawn {
+		return
+	}
+	fmt.Fprintln(os.Stderr)
+	p.drawn = false
+}
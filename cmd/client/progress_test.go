@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestRemaining(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		rate float64
+		want string
+	}{
+		{name: "no rate yet", n: 10, rate: 0, want: "--"},
+		{name: "done", n: 0, rate: 5, want: "--"},
+		{name: "seconds", n: 90, rate: 2, want: "45s"},
+		{name: "fractional seconds", n: 7, rate: 2, want: "4s"},
+		{name: "minutes", n: 600, rate: 4, want: "2m30s"},
+		{name: "under a second", n: 1, rate: 2.5, want: "400ms"},
+		{name: "one statement at a fast rate", n: 1, rate: 1000, want: "0s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := remaining(tt.n, tt.rate); got != tt.want {
+				t.Errorf("remaining(%d, %v) = %q, want %q", tt.n, tt.rate, got, tt.want)
+			}
+		})
+	}
+}
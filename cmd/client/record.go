@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// recorder captures statements typed at the prompt into a script that -f can replay.
+// Statements that failed are kept as comments so the replay doesn't stop on them.
+type recorder struct {
+	path    string
+	file    *os.File
+	w       *bufio.Writer
+	pending []string // lines of the statement currently being typed
+}
+
+func startRecording(path string) (*recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open recording: %w", err)
+	}
+	return &recorder{path: path, file: f, w: bufio.NewWriter(f)}, nil
+}
+
+// add buffers one line of the statement in progress
+func (r *recorder) add(line string) {
+	if r == nil {
+		return
+	}
+	r.pending = append(r.pending, line)
+}
+
+// commit writes the buffered statement once the server has answered it
+func (r *recorder) commit(ok bool) error {
+	if r == nil || len(r.pending) == 0 {
+		return nil
+	}
+	for _, ln := range r.pending {
+		if !ok {
+			ln = "-- failed: " + ln
+		}
+		if _, err := r.w.WriteString(strings.TrimRight(ln, " ") + "\n"); err != nil {
+			return err
+		}
+	}
+	r.pending = r.pending[:0]
+	return r.w.Flush()
+}
+
+// stop flushes and closes the recording; an unfinished statement is dropped
+func (r *recorder) stop() error {
+	if r == nil {
+		return nil
+	}
+	if err := r.w.Flush(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
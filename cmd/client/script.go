@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// newlines turns the line breaks in quoted text into spaces
+var newlines = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ")
+
+// splitStatements breaks a script into single-line statements terminated by ';'.
+// Comments are dropped and runs of whitespace outside quotes folded to one space,
+// since the server joins the lines of a command with spaces and would otherwise
+// swallow everything after a '--' comment. Quoted text keeps its spacing; only its
+// newlines become spaces, which is what the server would make of them.
+// A backslash at the start of a statement begins a meta-command that runs to the
+// end of its line. A trailing statement without ';' is returned as-is.
+func splitStatements(script string) []string {
+	var (
+		out    []string
+		cur    strings.Builder
+		spaced bool // cur ends in a space that folded whitespace
+	)
+	flush := func() {
+		st := strings.TrimSpace(cur.String())
+		if st != "" && st != ";" {
+			out = append(out, st)
+		}
+		cur.Reset()
+	}
+	space := func() {
+		if cur.Len() > 0 && !spaced {
+			cur.WriteByte(' ')
+			spaced = true
+		}
+	}
+
+	for i := 0; i < len(script); i++ {
+		ch := script[i]
+		switch {
+		case ch == '\\' && strings.TrimSpace(cur.String()) == "":
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+			cur.Reset()
+			cur.WriteString(script[i : i+end])
+			flush()
+			i += end
+		case ch == '\'' || ch == '`':
+			// copy quoted text verbatim ('' is an escaped quote inside strings)
+			j := i + 1
+			for j < len(script) {
+				if script[j] == ch {
+					if ch == '\'' && j+1 < len(script) && script[j+1] == '\'' {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j >= len(script) {
+				j = len(script) - 1
+			}
+			cur.WriteString(newlines.Replace(script[i : j+1]))
+			spaced = false
+			i = j
+		case ch == '-' && i+1 < len(script) && script[i+1] == '-':
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			space()
+		case ch == '/' && i+1 < len(script) && script[i+1] == '*':
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 3
+			}
+			space()
+		case ch == ';':
+			cur.WriteByte(';')
+			flush()
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == '\f' || ch == '\v':
+			space()
+		default:
+			cur.WriteByte(ch)
+			spaced = false
+		}
+	}
+	flush()
+	return out
+}
+
+// runScript executes the statements in path and returns how many failed.
+// With singleTx the whole script is sent as one command: the server parses all of
+// it before executing anything and stops at the first failing statement. The
+// statements that already ran stay applied, and logged, so a restart keeps them;
+// rolling them back needs server-side transactions.
+// When showProgress is set and stderr is a terminal, a progress bar tracks the run.
+// There is none with singleTx: the script goes to the server as one command, and
+// nothing in the frames it answers with marks where one statement ends.
+func runScript(sess *session, path string, singleTx, showProgress bool) (int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("read script: %w", err)
+	}
+	items := splitStatements(string(b))
+
+	if singleTx {
+		// Meta-commands run up front; the statements become a single command
+		var stmts []string
+		for _, st := range items {
+			if sess.meta(st) {
+				continue
+			}
+			st, err := sess.vars.substitute(st)
+			if err != nil {
+				return 0, err
+			}
+			stmts = append(stmts, terminate(st))
+		}
+		if len(stmts) == 0 {
+			return 0, nil
+		}
+		return sess.exec(strings.Join(stmts, " "))
+	}
+
+	total := 0
+	for _, st := range items {
+		if !strings.HasPrefix(st, "\\") {
+			total++
+		}
+	}
+	var bar *progress
+	if showProgress && total > 1 {
+		bar = newProgress(total)
+	}
+	defer bar.finish()
+
+	failed := 0
+	for _, st := range items {
+		bar.clear()
+		if sess.meta(st) {
+			continue
+		}
+		st, err := sess.vars.substitute(st)
+		if err != nil {
+			return failed, err
+		}
+		n, err := sess.exec(terminate(st))
+		if err != nil {
+			return failed, err
+		}
+		failed += n
+		bar.step(1)
+	}
+	return failed, nil
+}
+
+// exec sends one complete command and returns 1 if it failed, 0 otherwise
+func (s *session) exec(command string) (int, error) {
+	if err := s.send(command); err != nil {
+		return 0, err
+	}
+	ok, err := s.readResponse()
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func terminate(st string) string {
+	if !strings.HasSuffix(st, ";") {
+		return st + ";"
+	}
+	return st
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "one statement per semicolon",
+			script: "CREATE NODE A (x: int);\nINSERT NODE A (x: 1);",
+			want:   []string{"CREATE NODE A (x: int);", "INSERT NODE A (x: 1);"},
+		},
+		{
+			name:   "lines folded into one",
+			script: "MATCH A\n  WHERE x: 1\n  RETURN x;",
+			want:   []string{"MATCH A WHERE x: 1 RETURN x;"},
+		},
+		{
+			name:   "semicolon in a string",
+			script: "INSERT NODE A (s: 'a;b'); MATCH A;",
+			want:   []string{"INSERT NODE A (s: 'a;b');", "MATCH A;"},
+		},
+		{
+			name:   "escaped quote in a string",
+			script: "INSERT NODE A (s: 'it''s; fine');",
+			want:   []string{"INSERT NODE A (s: 'it''s; fine');"},
+		},
+		{
+			name:   "semicolon in backquotes",
+			script: "MATCH `a;b`;",
+			want:   []string{"MATCH `a;b`;"},
+		},
+		{
+			name:   "spaces in a string kept",
+			script: "INSERT NODE A (s: 'a  b\tc');",
+			want:   []string{"INSERT NODE A (s: 'a  b\tc');"},
+		},
+		{
+			name:   "newlines in a string",
+			script: "INSERT NODE A (s: 'a\r\nb\nc ');\nMATCH A;",
+			want:   []string{"INSERT NODE A (s: 'a b c ');", "MATCH A;"},
+		},
+		{
+			name:   "space after a string",
+			script: "MATCH A WHERE s: 'a '\n\t RETURN s;",
+			want:   []string{"MATCH A WHERE s: 'a ' RETURN s;"},
+		},
+		{
+			name:   "line comment with a semicolon",
+			script: "INSERT NODE A (x: 1); -- done; really\nMATCH A;",
+			want:   []string{"INSERT NODE A (x: 1);", "MATCH A;"},
+		},
+		{
+			name:   "line comment inside a statement",
+			script: "MATCH A -- all of them\nRETURN x;",
+			want:   []string{"MATCH A RETURN x;"},
+		},
+		{
+			name:   "block comment with a semicolon",
+			script: "/* one;\ntwo; */ MATCH A;",
+			want:   []string{"MATCH A;"},
+		},
+		{
+			name:   "comment markers in a string",
+			script: "INSERT NODE A (s: 'a -- b /* c */');",
+			want:   []string{"INSERT NODE A (s: 'a -- b /* c */');"},
+		},
+		{
+			name:   "unterminated block comment",
+			script: "MATCH A; /* to the end; MATCH B;",
+			want:   []string{"MATCH A;"},
+		},
+		{
+			name:   "meta-commands run to the end of their line",
+			script: "\\set n 1; 2\nMATCH A;\n  \\o out.csv\nMATCH B;",
+			want:   []string{"\\set n 1; 2", "MATCH A;", "\\o out.csv", "MATCH B;"},
+		},
+		{
+			name:   "empty statements dropped",
+			script: ";;\n ; MATCH A;;",
+			want:   []string{"MATCH A;"},
+		},
+		{
+			name:   "trailing statement without a semicolon",
+			script: "MATCH A; MATCH B",
+			want:   []string{"MATCH A;", "MATCH B"},
+		},
+		{
+			name:   "unterminated string",
+			script: "INSERT NODE A (s: 'a; b",
+			want:   []string{"INSERT NODE A (s: 'a; b"},
+		},
+		{
+			name:   "only comments",
+			script: "-- nothing\n/* here */",
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitStatements(tt.script)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("splitStatements(%q)\n got %q\nwant %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"grapho/wire"
+)
+
+// session drives a synchronous request/response exchange with the server
+type session struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	out    *output
+	format string // explicit -format for \o, "" to infer from the file name
+	vars   variables
+	rec    *recorder // set while \record is active
+	cursor bool      // the command awaiting an answer opens or reads a cursor
+
+	quiet   bool      // print only rows and errors
+	verbose bool      // echo sent statements and response timings
+	sentAt  time.Time // when the last command line was sent
+}
+
+func newSession(conn net.Conn, out *output, format string) *session {
+	return &session{
+		conn:   conn,
+		r:      bufio.NewReader(conn),
+		out:    out,
+		format: format,
+		vars:   variables{},
+	}
+}
+
+// handshake consumes the text welcome message, which ends with a blank line,
+// and switches the connection to the framed protocol
+func (s *session) handshake() error {
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		s.info("%s", line)
+	}
+	if err := s.send(wire.SwitchCommand); err != nil {
+		return err
+	}
+	f, err := wire.ReadFrame(s.r)
+	if err != nil {
+		return err
+	}
+	if f.Type != wire.FrameMessage {
+		return fmt.Errorf("server did not accept framed protocol (got %v)", f.Type)
+	}
+	return nil
+}
+
+// setLanguage asks the server to interpret the following commands as lang
+func (s *session) setLanguage(lang string) error {
+	if err := s.send(wire.LanguageCommand + " " + lang); err != nil {
+		return err
+	}
+	f, err := wire.ReadFrame(s.r)
+	if err != nil {
+		return err
+	}
+	if f.Type == wire.FrameError {
+		var e wire.Error
+		if err := f.Decode(&e); err != nil {
+			return err
+		}
+		return fmt.Errorf("%s", strings.Join(e.Messages, "; "))
+	}
+	var m wire.Message
+	if err := f.Decode(&m); err != nil {
+		return err
+	}
+	s.info("%s", m.Text)
+	return nil
+}
+
+// cursorCommand sends line, a wire.FetchCommand or wire.CloseCommand, and
+// shows the answer
+func (s *session) cursorCommand(line string) {
+	if err := s.send(line); err != nil {
+		s.errorf("Failed to send command: %v", err)
+		return
+	}
+	s.cursor = true
+	defer func() { s.cursor = false }()
+	if _, err := s.readResponse(); err != nil {
+		s.errorf("Connection closed: %v", err)
+	}
+}
+
+// info prints chatter that -q suppresses
+func (s *session) info(format string, args ...any) {
+	if !s.quiet {
+		fmt.Printf(format+"\n", args...)
+	}
+}
+
+// errorf prints a failure to stderr; errors are shown even with -q
+func (s *session) errorf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+// send writes one input line; the server only answers once a line ends with ';'
+func (s *session) send(line string) error {
+	if s.verbose {
+		fmt.Fprintf(os.Stderr, "-> %s\n", line)
+	}
+	s.sentAt = time.Now()
+	_, err := fmt.Fprintf(s.conn, "%s\n", line)
+	return err
+}
+
+// traceResponse reports how long the server took to answer with n frames
+func (s *session) traceResponse(n int) {
+	if s.verbose {
+		fmt.Fprintf(os.Stderr, "<- %d frame(s) in %s\n", n, time.Since(s.sentAt).Round(time.Microsecond))
+	}
+}
+
+// readResponse reads and renders the server's answer to one complete command.
+// It reports whether the command succeeded.
+func (s *session) readResponse() (bool, error) {
+	var (
+		rows      []resultRow
+		resultSet bool
+		frames    int
+	)
+	for {
+		f, err := wire.ReadFrame(s.r)
+		if err != nil {
+			return false, err
+		}
+		frames++
+
+		switch f.Type {
+		case wire.FrameMessage:
+			var m wire.Message
+			if err := f.Decode(&m); err != nil {
+				return false, err
+			}
+			s.info("%s", m.Text)
+		case wire.FrameResultSet:
+			resultSet = true
+		case wire.FrameRow:
+			var r wire.Row
+			if err := f.Decode(&r); err != nil {
+				return false, err
+			}
+			rows = append(rows, r)
+		case wire.FrameDone:
+			var d wire.Done
+			if err := f.Decode(&d); err != nil {
+				return false, err
+			}
+			s.traceResponse(frames)
+			if resultSet && !s.cursor || s.cursor && len(rows) > 0 {
+				if err := s.out.writeRows(rows); err != nil {
+					s.errorf("Error writing results: %v", err)
+					return false, nil
+				}
+			}
+			switch {
+			case s.cursor && d.More:
+				s.info("More rows left; %s N fetches the next N", wire.FetchCommand)
+			case s.cursor:
+				s.info("Cursor closed")
+			case d.Statements == 0:
+				s.info("No statements to execute")
+			default:
+				s.info("OK - %d statement(s) executed successfully", d.Statements)
+			}
+			return true, nil
+		case wire.FrameError:
+			var e wire.Error
+			if err := f.Decode(&e); err != nil {
+				return false, err
+			}
+			s.traceResponse(frames)
+			if e.Statement == 0 {
+				s.errorf("Parse errors:")
+				for _, msg := range e.Messages {
+					s.errorf("  %s", msg)
+				}
+			} else {
+				s.errorf("Error executing statement %d: %s", e.Statement, strings.Join(e.Messages, "; "))
+			}
+			return false, nil
+		default:
+			return false, fmt.Errorf("unexpected frame %v", f.Type)
+		}
+	}
+}
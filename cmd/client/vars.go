@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// variables holds client-side values set with \set and substituted into statements.
+// :name inserts the value as-is and :'name' inserts it as a quoted string literal.
+type variables map[string]string
+
+func (v variables) set(name, value string) error {
+	if name == "" || !isVarStart(name[0]) {
+		return fmt.Errorf("invalid variable name %q", name)
+	}
+	for i := 1; i < len(name); i++ {
+		if !isVarPart(name[i]) {
+			return fmt.Errorf("invalid variable name %q", name)
+		}
+	}
+	v[name] = value
+	return nil
+}
+
+// substitute expands variable references outside of quoted text. References to
+// unset variables are left untouched so "name:'x'" style property lists still work.
+func (v variables) substitute(stmt string) (string, error) {
+	if len(v) == 0 || !strings.Contains(stmt, ":") {
+		return stmt, nil
+	}
+	var out strings.Builder
+	for i := 0; i < len(stmt); i++ {
+		ch := stmt[i]
+		switch {
+		case ch == '\'' || ch == '`':
+			j := i + 1
+			for j < len(stmt) && stmt[j] != ch {
+				j++
+			}
+			if j >= len(stmt) {
+				return "", fmt.Errorf("unterminated quote in %q", stmt)
+			}
+			out.WriteString(stmt[i : j+1])
+			i = j
+		case ch == ':' && i+1 < len(stmt) && isVarStart(stmt[i+1]):
+			j := i + 1
+			for j < len(stmt) && isVarPart(stmt[j]) {
+				j++
+			}
+			if val, ok := v[stmt[i+1:j]]; ok {
+				out.WriteString(val)
+				i = j - 1
+				continue
+			}
+			out.WriteByte(ch)
+		case ch == ':' && i+2 < len(stmt) && stmt[i+1] == '\'' && isVarStart(stmt[i+2]):
+			j := i + 2
+			for j < len(stmt) && isVarPart(stmt[j]) {
+				j++
+			}
+			if j < len(stmt) && stmt[j] == '\'' {
+				if val, ok := v[stmt[i+2:j]]; ok {
+					out.WriteString("'" + strings.ReplaceAll(val, "'", "''") + "'")
+					i = j
+					continue
+				}
+			}
+			out.WriteByte(ch)
+		default:
+			out.WriteByte(ch)
+		}
+	}
+	return out.String(), nil
+}
+
+func isVarStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isVarPart(c byte) bool {
+	return isVarStart(c) || (c >= '0' && c <= '9')
+}
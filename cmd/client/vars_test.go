@@ -0,0 +1,124 @@
+package main
+
+import "testing"
+
+func TestVariablesSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "limit"},
+		{name: "_x1"},
+		{name: "Name"},
+		{name: "", wantErr: true},
+		{name: "1x", wantErr: true},
+		{name: "a-b", wantErr: true},
+		{name: "a b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := variables{}
+			err := v.set(tt.name, "1")
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("set(%q) accepted an invalid name", tt.name)
+				}
+				if len(v) != 0 {
+					t.Errorf("set(%q) stored a value: %v", tt.name, v)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("set(%q): %v", tt.name, err)
+			}
+			if v[tt.name] != "1" {
+				t.Errorf("set(%q) stored %v", tt.name, v)
+			}
+		})
+	}
+}
+
+func TestVariablesSubstitute(t *testing.T) {
+	vars := variables{"n": "10", "name": "O'Neil", "t": "Person"}
+	tests := []struct {
+		name    string
+		vars    variables
+		stmt    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "as-is",
+			vars: vars,
+			stmt: "MATCH :t LIMIT :n;",
+			want: "MATCH Person LIMIT 10;",
+		},
+		{
+			name: "quoted",
+			vars: vars,
+			stmt: "MATCH Person WHERE name: :'name';",
+			want: "MATCH Person WHERE name: 'O''Neil';",
+		},
+		{
+			name: "unset left alone",
+			vars: vars,
+			stmt: "MATCH Person WHERE age: :age, city: :'city';",
+			want: "MATCH Person WHERE age: :age, city: :'city';",
+		},
+		{
+			name: "property list without a space",
+			vars: vars,
+			stmt: "INSERT NODE Person (name:'Ann', age:age);",
+			want: "INSERT NODE Person (name:'Ann', age:age);",
+		},
+		{
+			name: "longest name",
+			vars: vars,
+			stmt: "MATCH Person LIMIT :n1;",
+			want: "MATCH Person LIMIT :n1;",
+		},
+		{
+			name: "inside a string",
+			vars: vars,
+			stmt: "INSERT NODE Note (text: 'at :n and :''name''');",
+			want: "INSERT NODE Note (text: 'at :n and :''name''');",
+		},
+		{
+			name: "inside backquotes",
+			vars: vars,
+			stmt: "MATCH `:t` LIMIT :n;",
+			want: "MATCH `:t` LIMIT 10;",
+		},
+		{
+			name: "no variables",
+			vars: variables{},
+			stmt: "MATCH Person LIMIT :n;",
+			want: "MATCH Person LIMIT :n;",
+		},
+		{
+			name:    "unterminated string",
+			vars:    vars,
+			stmt:    "MATCH Person WHERE name: 'Ann;",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.vars.substitute(tt.stmt)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("substitute(%q) = %q, want an error", tt.stmt, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("substitute(%q): %v", tt.stmt, err)
+			}
+			if got != tt.want {
+				t.Errorf("substitute(%q)\n got %q\nwant %q", tt.stmt, got, tt.want)
+			}
+		})
+	}
+}
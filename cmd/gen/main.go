@@ -0,0 +1,271 @@
+// Command gen generates typed Go structs and repositories from a DDL script.
+//
+//	go run grapho/cmd/gen -ddl schema.gql -pkg models -o models_gen.go
+//
+// The script is applied to a scratch catalog, so ALTER and DROP statements are
+// taken into account. For every node type it emits a struct with grapho tags
+// and a <Type>Repo with Insert, Get, Update and Delete keyed by the primary key
+// (or the node ID when there is none), plus FindBy<Field> for UNIQUE fields.
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"grapho/catalog"
+	"grapho/executor"
+)
+
+func main() {
+	var (
+		ddlPath = flag.String("ddl", "", "DDL script to generate from")
+		pkg     = flag.String("pkg", "models", "Package name of the generated file")
+		outPath = flag.String("o", "", "Output file (default: stdout)")
+	)
+	flag.Parse()
+	if *ddlPath == "" {
+		log.Fatal("gen: -ddl is required")
+	}
+
+	script, err := os.ReadFile(*ddlPath)
+	if err != nil {
+		log.Fatalf("gen: %v", err)
+	}
+	cat, err := loadCatalog(string(script))
+	if err != nil {
+		log.Fatalf("gen: %v", err)
+	}
+	src, err := generate(*pkg, *ddlPath, cat)
+	if err != nil {
+		log.Fatalf("gen: %v", err)
+	}
+
+	if *outPath == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := os.WriteFile(*outPath, src, 0o644); err != nil {
+		log.Fatalf("gen: %v", err)
+	}
+}
+
+// loadCatalog applies script to an empty catalog in a scratch directory
+func loadCatalog(script string) (*catalog.Catalog, error) {
+	dir, err := os.MkdirTemp("", "grapho-gen-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	store, err := catalog.NewFileStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	reg, err := catalog.Open(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+	if err := executor.New(reg).ExecuteScript(ctx, nil, script); err != nil {
+		return nil, err
+	}
+	return reg.Current(), nil
+}
+
+type nodeModel struct {
+	Node   string // node type name
+	Name   string // Go type name
+	Fields []fieldModel
+	Key    fieldModel // field Get/Update/Delete are keyed by
+	Unique []fieldModel
+}
+
+type fieldModel struct {
+	Prop   string // property name
+	Name   string // Go field name
+	GoType string
+	Elem   string // GoType without a leading '*'
+}
+
+func generate(pkg, source string, cat *catalog.Catalog) ([]byte, error) {
+	names := make([]string, 0, len(cat.Nodes))
+	for name := range cat.Nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var nodes []nodeModel
+	for _, name := range names {
+		nt := cat.Nodes[name]
+		m := nodeModel{
+			Node: name,
+			Name: goName(name),
+			Key:  fieldModel{Prop: "_id", Name: "NodeID", GoType: "string", Elem: "string"},
+		}
+
+		props := make([]string, 0, len(nt.Fields))
+		for prop := range nt.Fields {
+			props = append(props, prop)
+		}
+		sort.Slice(props, func(i, j int) bool {
+			// primary key first, then alphabetical
+			if (props[i] == nt.PK) != (props[j] == nt.PK) {
+				return props[i] == nt.PK
+			}
+			return props[i] < props[j]
+		})
+
+		for _, prop := range props {
+			spec := nt.Fields[prop]
+			elem, ok := goType(spec.Type)
+			if !ok {
+				log.Printf("gen: skipping %s.%s: array fields have no Go mapping", name, prop)
+				continue
+			}
+			f := fieldModel{Prop: prop, Name: goName(prop), GoType: elem, Elem: elem}
+			if prop != nt.PK && !spec.NotNull {
+				f.GoType = "*" + elem
+			}
+			m.Fields = append(m.Fields, f)
+			if prop == nt.PK {
+				m.Key = f
+			} else if spec.Unique {
+				m.Unique = append(m.Unique, f)
+			}
+		}
+		nodes = append(nodes, m)
+	}
+
+	var buf bytes.Buffer
+	err := fileTemplate.Execute(&buf, struct {
+		Package string
+		Source  string
+		Nodes   []nodeModel
+	}{pkg, source, nodes})
+	if err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w", err)
+	}
+	return src, nil
+}
+
+// goType maps a catalog type to the Go type generated fields use
+func goType(t catalog.TypeSpec) (string, bool) {
+	switch t.Base {
+	case catalog.BaseInt:
+		return "int64", true
+	case catalog.BaseFloat:
+		return "float64", true
+	case catalog.BaseBool:
+		return "bool", true
+	case catalog.BaseArray:
+		return "", false
+	default:
+		return "string", true
+	}
+}
+
+// goName turns a schema name such as "first_name" into an exported Go name
+func goName(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if b.Len() == 0 && unicode.IsDigit(r) {
+			b.WriteByte('X')
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	name := b.String()
+	if strings.HasSuffix(name, "Id") {
+		name = strings.TrimSuffix(name, "Id") + "ID"
+	}
+	if name == "" {
+		name = "X"
+	}
+	return name
+}
+
+var fileTemplate = template.Must(template.New("file").Parse(`// Code generated by grapho/cmd/gen from {{.Source}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+
+	"grapho"
+)
+{{range .Nodes}}{{$n := .}}
+// {{.Name}} is a {{.Node}} node
+type {{.Name}} struct {
+	NodeID string ` + "`grapho:\"_id\"`" + `
+{{- range .Fields}}
+	{{.Name}} {{.GoType}} ` + "`grapho:\"{{.Prop}}\"`" + `
+{{- end}}
+}
+
+// {{.Name}}Repo reads and writes {{.Node}} nodes
+type {{.Name}}Repo struct {
+	db *grapho.DB
+}
+
+// New{{.Name}}Repo returns a repository backed by db
+func New{{.Name}}Repo(db *grapho.DB) *{{.Name}}Repo {
+	return &{{.Name}}Repo{db: db}
+}
+
+// Insert adds v as a new node
+func (r *{{.Name}}Repo) Insert(ctx context.Context, v *{{.Name}}) error {
+	return r.db.InsertNode(ctx, "{{.Node}}", v)
+}
+
+// Get returns the node whose {{.Key.Prop}} is key, or grapho.ErrNotFound
+func (r *{{.Name}}Repo) Get(ctx context.Context, key {{.Key.Elem}}) (*{{.Name}}, error) {
+	return r.findOne(ctx, "{{.Key.Prop}}", key)
+}
+{{range .Unique}}
+// FindBy{{.Name}} returns the node whose {{.Prop}} is v, or grapho.ErrNotFound
+func (r *{{$n.Name}}Repo) FindBy{{.Name}}(ctx context.Context, v {{.Elem}}) (*{{$n.Name}}, error) {
+	return r.findOne(ctx, "{{.Prop}}", v)
+}
+{{end}}
+// Update writes every field of v to the node with the same {{.Key.Prop}}
+func (r *{{.Name}}Repo) Update(ctx context.Context, v *{{.Name}}) error {
+	return r.db.UpdateNode(ctx, "{{.Node}}", "{{.Key.Prop}}", v)
+}
+
+// Delete removes the node whose {{.Key.Prop}} is key
+func (r *{{.Name}}Repo) Delete(ctx context.Context, key {{.Key.Elem}}) error {
+	return r.db.DeleteNodes(ctx, "{{.Node}}", "{{.Key.Prop}}", key)
+}
+
+func (r *{{.Name}}Repo) findOne(ctx context.Context, field string, v any) (*{{.Name}}, error) {
+	found, err := grapho.FindNodes[{{.Name}}](ctx, r.db, "{{.Node}}", field, v)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, grapho.ErrNotFound
+	}
+	return &found[0], nil
+}
+{{end}}`))
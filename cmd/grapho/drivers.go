@@ -0,0 +1,10 @@
+package main
+
+// grapho import -format sql reads through database/sql, so the drivers it can
+// use are the ones linked into this binary. None are by default, to keep the
+// module free of dependencies; add a blank import here, e.g.
+//
+//	import _ "github.com/jackc/pgx/v5/stdlib" // -driver pgx
+//	import _ "modernc.org/sqlite"             // -driver sqlite
+//
+// and run go mod tidy.
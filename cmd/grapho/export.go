@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"grapho"
+)
+
+// exporters maps the -format values of grapho export to the DB methods
+var exporters = map[string]func(*grapho.DB, context.Context, io.Writer) error{
+	"dot":     (*grapho.DB).ExportDOT,
+	"gexf":    (*grapho.DB).ExportGEXF,
+	"graphml": (*grapho.DB).ExportGraphML,
+	"jsonl":   (*grapho.DB).ExportJSONL,
+}
+
+func runExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	var (
+		dataDir  = fs.String("data", "./data", "Data directory to export")
+		format   = fs.String("format", "graphml", "Output format: graphml|gexf|jsonl|dot|parquet|ntriples")
+		nodeType = fs.String("type", "", "Node type to export (parquet only)")
+		mapping  = fs.String("mapping", "", "JSON file naming types and properties in RDF (ntriples only)")
+		base     = fs.String("base", "urn:grapho:", "Base of the IRIs the mapping leaves out (ntriples only)")
+		outPath  = fs.String("o", "", "Output file (default: stdout)")
+	)
+	fs.Parse(args)
+	export, ok := exporters[*format]
+	switch {
+	case *format == "parquet" && *nodeType == "":
+		return fmt.Errorf("-format parquet needs -type")
+	case *format == "parquet":
+		export = func(db *grapho.DB, ctx context.Context, w io.Writer) error {
+			return db.ExportParquet(ctx, w, *nodeType)
+		}
+	case *format == "ntriples":
+		m := grapho.RDFMapping{Base: *base}
+		if *mapping != "" {
+			f, err := os.Open(*mapping)
+			if err != nil {
+				return err
+			}
+			m, err = grapho.ReadRDFMapping(f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			if m.Base == "" {
+				m.Base = *base
+			}
+		}
+		export = func(db *grapho.DB, ctx context.Context, w io.Writer) error {
+			return db.ExportNTriples(ctx, w, m)
+		}
+	case !ok:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	db, err := grapho.Open(ctx, *dataDir)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if *outPath == "" {
+		return export(db, ctx, os.Stdout)
+	}
+	f, err := os.Create(*outPath)
+	if err != nil {
+		return err
+	}
+	if err := export(db, ctx, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
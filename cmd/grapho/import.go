@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"unicode/utf8"
+
+	"grapho"
+)
+
+func runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	var (
+		dataDir   = fs.String("data", "./data", "Data directory to import into")
+		format    = fs.String("format", "csv", "Input format: csv|graphml|sql")
+		nodeType  = fs.String("type", "", "Node type to insert (csv)")
+		file      = fs.String("file", "", "Input file, or the JSON mapping for sql (default: stdin)")
+		delimiter = fs.String("delimiter", ",", "Field delimiter (csv)")
+		batch     = fs.Int("batch", 500, "Rows per commit log entry (csv)")
+		driver    = fs.String("driver", "", "database/sql driver name (sql)")
+		dsn       = fs.String("dsn", "", "Data source name to connect to (sql)")
+	)
+	fs.Parse(args)
+
+	var importer func(*grapho.DB, *os.File) (grapho.ImportResult, error)
+	switch *format {
+	case "csv":
+		if *nodeType == "" {
+			return errors.New("-type is required")
+		}
+		comma, size := utf8.DecodeRuneInString(*delimiter)
+		if size == 0 || size != len(*delimiter) {
+			return fmt.Errorf("-delimiter must be a single character")
+		}
+		importer = func(db *grapho.DB, in *os.File) (grapho.ImportResult, error) {
+			return db.ImportCSV(ctx, *nodeType, in, grapho.CSVOptions{Comma: comma, BatchSize: *batch})
+		}
+	case "graphml":
+		importer = func(db *grapho.DB, in *os.File) (grapho.ImportResult, error) {
+			return db.ImportGraphML(ctx, in)
+		}
+	case "sql":
+		if !slices.Contains(sql.Drivers(), *driver) {
+			return fmt.Errorf("-driver %q is not compiled in (have %v); see drivers.go", *driver, sql.Drivers())
+		}
+		importer = func(db *grapho.DB, in *os.File) (grapho.ImportResult, error) {
+			mapping, err := grapho.ReadSQLMapping(in)
+			if err != nil {
+				return grapho.ImportResult{}, err
+			}
+			src, err := sql.Open(*driver, *dsn)
+			if err != nil {
+				return grapho.ImportResult{}, err
+			}
+			defer src.Close()
+			return db.ImportSQL(ctx, src, mapping)
+		}
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	in := os.Stdin
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	db, err := grapho.Open(ctx, *dataDir)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	res, err := importer(db, in)
+	for _, lerr := range res.Errors {
+		fmt.Fprintln(os.Stderr, lerr)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("imported %d, skipped %d\n", res.Inserted, len(res.Errors))
+	if len(res.Errors) > 0 {
+		return fmt.Errorf("%d rows failed", len(res.Errors))
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"grapho"
+	"grapho/catalog"
+)
+
+// contents returns the catalog of the database in dir and its nodes and
+// edges, ordered by type and ID
+func contents(t *testing.T, dir string) (*catalog.Catalog, []grapho.Row) {
+	t.Helper()
+	ctx := context.Background()
+	db, err := grapho.Open(ctx, dir)
+	if err != nil {
+		t.Fatalf("open %s: %v", dir, err)
+	}
+	defer db.Close()
+	var rows []grapho.Row
+	for _, q := range []string{"MATCH Person;", "MATCH City;", "MATCH KNOWS;", "MATCH LIVES_IN;"} {
+		got, err := db.Query(ctx, q)
+		if err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+		rows = append(rows, got...)
+	}
+	slices.SortFunc(rows, func(a, b grapho.Row) int {
+		return strings.Compare(a.Type+"\x00"+a.ID, b.Type+"\x00"+b.ID)
+	})
+
+	store, err := catalog.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, err := catalog.Open(ctx, store)
+	if err != nil {
+		t.Fatalf("catalog of %s: %v", dir, err)
+	}
+	return reg.Current(), rows
+}
+
+func TestDumpLoad(t *testing.T) {
+	ctx := context.Background()
+	src := t.TempDir()
+	db, err := grapho.Open(ctx, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec(ctx, `
+CREATE NODE Person (name: string PRIMARY KEY, age: int, bio: text, meta: json);
+CREATE NODE City (name: string PRIMARY KEY, pop: int NOT NULL DEFAULT 0);
+CREATE EDGE KNOWS (FROM Person MANY, TO Person MANY, PROPS (since: int, note: string));
+CREATE EDGE LIVES_IN (FROM Person MANY, TO City ONE);
+INSERT NODE Person (name: 'O''Neil', age: 40, bio: 'says "hi";
+then -- leaves\\', meta: {"quote": "say \"hi\"; it's", "tab": "a\tb\u00e9"});
+INSERT NODE Person (name: 'Zoë', age: null, bio: null);
+INSERT NODE City (name: 'Zürich');
+INSERT EDGE KNOWS FROM Person('O''Neil') TO Person('Zoë') (since: 2020, note: null);
+INSERT EDGE LIVES_IN FROM Person('Zoë') TO City('Zürich');`); err != nil {
+		t.Fatal(err)
+	}
+	// part of the graph in the data files, the rest in the commit log
+	if err := db.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec(ctx, `
+INSERT NODE Person (name: 'back\slash /* not a comment */');
+INSERT EDGE KNOWS FROM Person('Zoë') TO Person('back\slash /* not a comment */') (note: 'tab	and ''quote''');
+UPDATE NODE City SET pop: 400000 WHERE name: 'Zürich';`); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	wantCat, wantRows := contents(t, src)
+	if len(wantRows) != 7 {
+		t.Fatalf("source holds %d nodes and edges, want 7: %v", len(wantRows), wantRows)
+	}
+
+	for _, name := range []string{"data.tar", "data.tar.gz"} {
+		archive := filepath.Join(t.TempDir(), name)
+		if err := runDump([]string{"-data", src, "-out", archive}); err != nil {
+			t.Fatalf("dump to %s: %v", name, err)
+		}
+		dst := filepath.Join(t.TempDir(), "data")
+		if err := runLoad([]string{"-data", dst, "-in", archive}); err != nil {
+			t.Fatalf("load from %s: %v", name, err)
+		}
+		cat, rows := contents(t, dst)
+		if !reflect.DeepEqual(cat.Nodes, wantCat.Nodes) || !reflect.DeepEqual(cat.Edges, wantCat.Edges) {
+			t.Errorf("%s: catalog differs:\n%+v\nwant\n%+v", name, cat, wantCat)
+		}
+		if !reflect.DeepEqual(rows, wantRows) {
+			t.Errorf("%s: nodes and edges differ:\n%v\nwant\n%v", name, rows, wantRows)
+		}
+		if err := runLoad([]string{"-data", dst, "-in", archive}); err == nil {
+			t.Errorf("%s: loaded into a data directory that is not empty", name)
+		}
+	}
+}
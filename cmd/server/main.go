@@ -1,58 +1,277 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 
 	"grapho/catalog"
+	"grapho/executor"
 	"grapho/server"
+	"grapho/storage"
 )
 
 func main() {
+	// offline maintenance subcommands; anything else starts the server
+	if len(os.Args) > 1 {
+		var run func([]string) error
+		switch os.Args[1] {
+		case "dump":
+			run = runDump
+		case "load":
+			run = runLoad
+		}
+		if run != nil {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "grapho-server %s: %v\n", os.Args[1], err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	var (
 		addr      = flag.String("addr", ":8080", "TCP address to listen on")
 		dataDir   = flag.String("data", "./data", "Directory to store catalog data")
+		storeMode = flag.String("storage", "disk", "Where the catalog, commit log and graph are kept: disk (the data directory) or memory (nothing outlives the process)")
 		logFormat = flag.String("log-format", "binary", "Commit log format: text|binary")
+		storeKind = flag.String("graph-store", "data", "Where the graph is kept: data (a data file) or kv (a key-value store)")
+		boltAddr  = flag.String("bolt", "", "TCP address for Neo4j Bolt drivers, e.g. :7687 (default: disabled)")
+		httpAddr  = flag.String("http", "", "TCP address for the JSON HTTP API, e.g. :8081 (default: disabled)")
+		gremAddr  = flag.String("gremlin", "", "TCP address for the experimental Gremlin websocket endpoint, e.g. :8182 (default: disabled)")
+		natsAddr  = flag.String("nats", "", "NATS server for change data capture, e.g. localhost:4222 (default: disabled)")
+		cdcSubj   = flag.String("cdc-subject", "grapho.changes", "NATS subject to publish committed statements to (\"\" to disable)")
+		ingest    = flag.String("ingest-subject", "", "NATS subject to execute incoming scripts from (default: disabled)")
+		flushSize = flag.Int("flush-bytes", storage.DefaultFlushPolicy.MaxBytes, "Sync the commit log once this many bytes are waiting")
+		flushWait = flag.Duration("flush-delay", storage.DefaultFlushPolicy.MaxDelay, "Sync the commit log at most this long after a write")
+		syncEach  = flag.Bool("sync-commit", false, "Answer each command only once it is synced to the commit log")
+		expEvery  = flag.Duration("expire-every", 0, "Delete nodes and edges whose expires_at or TTL has passed this often, e.g. 1m (default: disabled)")
+		expBatch  = flag.Int("expire-batch", 100, "Most expired nodes and edges deleted per commit log entry")
+		vacEvery  = flag.Duration("vacuum-every", 10*time.Minute, "Reclaim the space of deleted nodes and edges this often (0 to disable)")
+		vacRatio  = flag.Float64("vacuum-ratio", executor.DefaultVacuumRatio, "Share of a type's nodes or edges that must be deleted before the background vacuum reclaims them")
+		statEvery = flag.Duration("stats-every", 10*time.Minute, "Collect planner statistics this often (0 to disable)")
+		statSize  = flag.Int("stats-sample", executor.DefaultStatsSample, "Nodes of each type sampled for distinct value counts")
+		snapEvery = flag.Duration("snapshot-every", 0, "Snapshot the graph data and cut the commit log this often, e.g. 10m (default: disabled)")
+		segments  = flag.Bool("segments", false, "Have snapshots put node properties in memory-mapped data segments instead of on the heap")
+		skipBad   = flag.Bool("skip-corrupt", false, "Load graph data past records that fail their checksums, logging each, instead of refusing to start")
+		cacheSize = flag.Int("cache-size", executor.DefaultCacheSize, "Most bytes of data segment nodes kept decoded in memory (0 to disable)")
+		useMmap   = flag.Bool("mmap", false, "Replay the commit log from a memory mapping instead of buffered reads")
+		parts     = flag.Int("partitions", executor.DefaultPartitions, "Number of partitions each node type is split into by primary key")
+		lenient   = flag.Bool("lenient", false, "Store properties the catalog does not declare instead of rejecting them")
+		maxBlob   = flag.Int("max-blob-size", executor.DefaultMaxBlobSize, "Most bytes a blob value may hold")
+		maxData   = flag.Int64("max-data-size", 0, "Most bytes the data directory may hold; writes are refused near it (default: no limit)")
+		dataRes   = flag.Int64("data-size-reserve", 0, "Bytes short of -max-data-size at which writes are refused (default: a twentieth of it)")
+		incBackup = flag.Bool("incremental-backups", false, "Keep the commit log since the last backup through snapshots, so that the next backup can be incremental")
+		layouts   []string
+		restores  []string
 	)
+	flag.Func("time-layout", "A Go time layout dates, times and datetimes may also be written in, e.g. 02/01/2006; may be repeated", func(s string) error {
+		layouts = append(layouts, s)
+		return nil
+	})
+	flag.Func("restore", "Backup archive to restore into the empty data directory before starting; may be repeated, a full backup first and then incremental ones in order", func(s string) error {
+		restores = append(restores, s)
+		return nil
+	})
 	flag.Parse()
 
-	// Create data directory if it doesn't exist
-	if err := os.MkdirAll(*dataDir, 0755); err != nil {
-		log.Fatalf("Failed to create data directory: %v", err)
+	var memory bool
+	switch *storeMode {
+	case "disk":
+	case "memory":
+		// there is no commit log to publish from, and nothing to snapshot
+		if *storeKind != "data" || *snapEvery > 0 || *segments || *natsAddr != "" || *maxData > 0 {
+			log.Fatalf("-storage memory rules out -graph-store, -snapshot-every, -segments, -nats and -max-data-size")
+		}
+		memory = true
+	default:
+		log.Fatalf("Unknown -storage %q: want disk or memory", *storeMode)
+	}
+	var format storage.LogFormat
+	switch *logFormat {
+	case "binary":
+		format = storage.LogFormatBinary
+	default:
+		format = storage.LogFormatText
+	}
+
+	// Unpack backups into the data directory; starting up below replays their
+	// commit log tail over the data file
+	if len(restores) > 0 && (memory || *storeKind != "data") {
+		log.Fatalf("-restore needs -storage disk and -graph-store data")
+	}
+	for _, path := range restores {
+		m, err := storage.RestoreBackup(path, *dataDir, format)
+		if err != nil {
+			log.Fatalf("Failed to restore backup: %v", err)
+		}
+		if m.Incremental {
+			fmt.Printf("Restored incremental backup of %s into %s: %d commit log entries after entry %d\n",
+				m.Created.Format(time.RFC3339), *dataDir, m.LogEntries-m.Entries, m.Entries)
+		} else {
+			fmt.Printf("Restored backup of %s into %s: %d commit log entries, %d to replay\n",
+				m.Created.Format(time.RFC3339), *dataDir, m.LogEntries, m.LogEntries-m.Entries)
+		}
 	}
 
 	// Initialize catalog store and registry
-	store, err := catalog.NewFileStore(*dataDir)
-	if err != nil {
-		log.Fatalf("Failed to create catalog store: %v", err)
+	var (
+		store catalog.Store
+		err   error
+	)
+	if memory {
+		store = catalog.NewMemoryStore()
+	} else {
+		// Create data directory if it doesn't exist
+		if err := os.MkdirAll(*dataDir, 0755); err != nil {
+			log.Fatalf("Failed to create data directory: %v", err)
+		}
+		store, err = catalog.NewFileStore(*dataDir)
+		if err != nil {
+			log.Fatalf("Failed to create catalog store: %v", err)
+		}
 	}
 
-	registry, err := catalog.Open(store)
+	registry, err := catalog.Open(context.Background(), store)
 	if err != nil {
 		log.Fatalf("Failed to open catalog registry: %v", err)
 	}
 
 	// Create and start server
 	srv := server.NewServer(*addr, registry)
+	if err := srv.SetPartitions(*parts); err != nil {
+		log.Fatalf("Invalid -partitions: %v", err)
+	}
+	srv.SetLenient(*lenient)
+	srv.SetTimeLayouts(layouts)
+	srv.SetMaxBlobSize(*maxBlob)
+	if err := srv.SetCacheSize(*cacheSize); err != nil {
+		log.Fatalf("Invalid -cache-size: %v", err)
+	}
 
-	// Open and start commit log with selected format, attach to server
-	var format server.LogFormat
-	switch *logFormat {
-	case "binary":
-		format = server.LogFormatBinary
-	default:
-		format = server.LogFormatText
+	// Open and start commit log with selected format, attach to server,
+	// along with the graph store, unless nothing is to be kept
+	var cl *storage.CommitLog
+	if !memory {
+		cl, err = storage.OpenCommitLogWithFormat(*dataDir, format)
+		if err != nil {
+			log.Fatalf("Failed to open commit log: %v", err)
+		}
+		cl.UseMmap(*useMmap)
+		cl.KeepForBackups(*incBackup)
+		cl.SetFlushPolicy(storage.FlushPolicy{MaxBytes: *flushSize, MaxDelay: *flushWait, Sync: *syncEach})
+		cl.Start()
+		srv.AttachCommitLog(cl)
+		var gs executor.GraphStore
+		switch *storeKind {
+		case "data":
+			if *segments && *snapEvery <= 0 {
+				log.Fatalf("-segments needs -snapshot-every")
+			}
+			var df *executor.DataFile
+			if df, err = executor.OpenDataFile(*dataDir); err == nil {
+				df.SetSegments(*segments)
+				if *skipBad {
+					df.SetOnCorrupt(func(err error) { log.Printf("Skipped: %v", err) })
+				}
+				gs = df
+			}
+		case "kv":
+			if *snapEvery > 0 || *segments {
+				log.Fatalf("-snapshot-every and -segments need -graph-store data")
+			}
+			gs, err = executor.OpenKVStore(context.Background(), *dataDir)
+		default:
+			log.Fatalf("Unknown -graph-store %q: want data or kv", *storeKind)
+		}
+		if err != nil {
+			log.Fatalf("Failed to open graph store: %v", err)
+		}
+		srv.AttachGraphStore(gs)
+		if *maxData > 0 {
+			q, err := storage.NewQuota(*dataDir, storage.QuotaConfig{MaxBytes: *maxData, Reserve: *dataRes})
+			if err != nil {
+				log.Fatalf("Invalid -max-data-size: %v", err)
+			}
+			srv.SetQuota(q)
+		}
 	}
-	cl, err := server.OpenCommitLogWithFormat(*dataDir, format)
-	if err != nil {
-		log.Fatalf("Failed to open commit log: %v", err)
+
+	if *boltAddr != "" {
+		go func() {
+			if err := srv.StartBolt(*boltAddr); err != nil {
+				log.Fatalf("Bolt listener failed: %v", err)
+			}
+		}()
+	}
+
+	if *httpAddr != "" {
+		go func() {
+			if err := srv.StartHTTP(*httpAddr); err != nil {
+				log.Fatalf("HTTP API failed: %v", err)
+			}
+		}()
+	}
+
+	if *gremAddr != "" {
+		go func() {
+			if err := srv.StartGremlin(*gremAddr); err != nil {
+				log.Fatalf("Gremlin endpoint failed: %v", err)
+			}
+		}()
+	}
+
+	if *natsAddr != "" {
+		go func() {
+			cfg := server.CDCConfig{NATS: *natsAddr, Subject: *cdcSubj, Ingest: *ingest}
+			if err := srv.StartCDC(cfg); err != nil {
+				log.Fatalf("Change data capture failed: %v", err)
+			}
+		}()
+	}
+
+	if *expEvery > 0 {
+		go func() {
+			if err := srv.StartExpiry(server.ExpiryConfig{Interval: *expEvery, Batch: *expBatch}); err != nil {
+				log.Fatalf("Expiry sweeper failed: %v", err)
+			}
+		}()
+	}
+
+	if *vacEvery > 0 {
+		go func() {
+			if err := srv.StartVacuum(server.VacuumConfig{Interval: *vacEvery, Ratio: *vacRatio}); err != nil {
+				log.Fatalf("Vacuum failed: %v", err)
+			}
+		}()
+	}
+
+	if *statEvery > 0 {
+		go func() {
+			cfg := server.StatsConfig{Interval: *statEvery, Sample: *statSize}
+			if !memory {
+				cfg.Path = filepath.Join(*dataDir, storage.StatsFile)
+			}
+			if err := srv.StartStats(cfg); err != nil {
+				log.Fatalf("Statistics collector failed: %v", err)
+			}
+		}()
+	}
+
+	if *snapEvery > 0 {
+		go func() {
+			if err := srv.StartSnapshots(server.SnapshotConfig{Interval: *snapEvery}); err != nil {
+				log.Fatalf("Snapshots failed: %v", err)
+			}
+		}()
 	}
-	cl.Start()
-	srv.AttachCommitLog(cl)
 
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -64,14 +283,19 @@ func main() {
 		if err := srv.Stop(); err != nil {
 			log.Printf("Error stopping server: %v", err)
 		}
-		if err := cl.Stop(); err != nil {
-			log.Printf("Error stopping commit log: %v", err)
+		if cl != nil {
+			if err := cl.Stop(); err != nil {
+				log.Printf("Error stopping commit log: %v", err)
+			}
 		}
 		os.Exit(0)
 	}()
 
 	// Start server (blocks until stopped)
 	if err := srv.Start(); err != nil {
+		if errors.Is(err, executor.ErrCorrupt) {
+			log.Fatalf("Server failed: %v; -skip-corrupt loads the rest", err)
+		}
 		log.Fatalf("Server failed: %v", err)
 	}
 }
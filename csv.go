@@ -0,0 +1,216 @@
+package grapho
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"grapho/catalog"
+	"grapho/parser"
+)
+
+// CSVOptions configures ImportCSV
+type CSVOptions struct {
+	// Comma is the field delimiter; zero means ','
+	Comma rune
+	// BatchSize is the number of rows inserted per commit log entry; zero means
+	// the default of 500
+	BatchSize int
+}
+
+// ImportResult reports the outcome of a bulk import
+type ImportResult struct {
+	Inserted int
+	// Errors lists the rows that were skipped, in input order
+	Errors []LineError
+}
+
+// LineError describes why one input line was not imported
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e LineError) Error() string { return fmt.Sprintf("line %d: %v", e.Line, e.Err) }
+
+func (e LineError) Unwrap() error { return e.Err }
+
+// ImportCSV inserts one node of nodeType per record of r. The header row names
+// the fields; cells are converted to the field types and empty or missing cells
+// take the field's DEFAULT. Rows that cannot be converted or inserted are
+// skipped and reported in the result; the returned error is only set when the
+// import could not run at all, e.g. on an unknown column or a read failure.
+func (db *DB) ImportCSV(ctx context.Context, nodeType string, r io.Reader, opts CSVOptions) (ImportResult, error) {
+	var res ImportResult
+	cr := csv.NewReader(r)
+	if opts.Comma != 0 {
+		cr.Comma = opts.Comma
+	}
+	cr.FieldsPerRecord = -1
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = bulkBatchSize
+	}
+
+	header, err := cr.Read()
+	if err != nil {
+		if err == io.EOF {
+			return res, fmt.Errorf("grapho: import: missing header row")
+		}
+		return res, fmt.Errorf("grapho: import: %w", err)
+	}
+	nt, ok := db.exec.Registry().Current().Nodes[nodeType]
+	if !ok {
+		return res, fmt.Errorf("grapho: import: %w", errNodeType(nodeType))
+	}
+	columns := make([]catalog.FieldSpec, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		spec, ok := nt.Fields[name]
+		if !ok {
+			return res, fmt.Errorf("grapho: import: %s has no field '%s'", nodeType, name)
+		}
+		if slices.ContainsFunc(columns[:i], func(c catalog.FieldSpec) bool { return c.Name == name }) {
+			return res, fmt.Errorf("grapho: import: duplicate column '%s'", name)
+		}
+		columns[i] = spec
+	}
+
+	var batch []bulkStmt
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := cr.FieldPos(0)
+		if err != nil {
+			var perr *csv.ParseError
+			if !errors.As(err, &perr) {
+				return res, fmt.Errorf("grapho: import: %w", err)
+			}
+			res.Errors = append(res.Errors, LineError{Line: perr.StartLine, Err: perr.Err})
+			continue
+		}
+		stmt, err := csvInsert(nt, columns, record)
+		if err != nil {
+			res.Errors = append(res.Errors, LineError{Line: line, Err: err})
+			continue
+		}
+		batch = append(batch, bulkStmt{line: line, stmt: stmt})
+		if len(batch) == batchSize {
+			if err := db.flushBulk(ctx, &res, batch); err != nil {
+				return res, err
+			}
+			batch = batch[:0]
+		}
+	}
+	return res, db.flushBulk(ctx, &res, batch)
+}
+
+// csvInsert builds the INSERT for one record, filling in defaults
+func csvInsert(nt *catalog.NodeType, columns []catalog.FieldSpec, record []string) (parser.Stmt, error) {
+	if len(record) > len(columns) {
+		return nil, fmt.Errorf("%d cells but only %d columns", len(record), len(columns))
+	}
+	var props []parser.Property
+	for i, spec := range columns {
+		cell := ""
+		if i < len(record) {
+			cell = strings.TrimSpace(record[i])
+		}
+		if cell == "" {
+			continue
+		}
+		lit, err := coerceLiteral(spec.Type, cell)
+		if err != nil {
+			return nil, fmt.Errorf("field '%s': %w", spec.Name, err)
+		}
+		props = append(props, parser.Prop(spec.Name, lit))
+	}
+	props, err := withDefaults(nt.Fields, props)
+	if err != nil {
+		return nil, err
+	}
+	if len(props) == 0 {
+		return nil, fmt.Errorf("empty row")
+	}
+	return parser.InsertNode(nt.Name, props...), nil
+}
+
+// withDefaults appends the DEFAULT of every field props leaves out, and fails if
+// a NOT NULL field is left without a value
+func withDefaults(fields map[string]catalog.FieldSpec, props []parser.Property) ([]parser.Property, error) {
+	for _, name := range sortedKeys(fields) {
+		spec := fields[name]
+		if slices.ContainsFunc(props, func(p parser.Property) bool { return p.Name == name }) {
+			continue
+		}
+		if spec.DefaultRaw != nil && !isNullDefault(spec) {
+			lit, err := coerceLiteral(spec.Type, *spec.DefaultRaw)
+			if err != nil {
+				return nil, fmt.Errorf("field '%s': default: %w", name, err)
+			}
+			props = append(props, parser.Prop(name, lit))
+			continue
+		}
+		if spec.NotNull {
+			return nil, fmt.Errorf("field '%s' is NOT NULL but has no value", name)
+		}
+	}
+	return props, nil
+}
+
+// coerceLiteral converts the text of a cell to a literal of the field type
+func coerceLiteral(t catalog.TypeSpec, s string) (*parser.Literal, error) {
+	switch {
+	case t.Elem != nil || t.Base == catalog.BaseArray:
+		return nil, fmt.Errorf("array fields cannot be imported")
+	case len(t.EnumVals) > 0:
+		if !slices.Contains(t.EnumVals, s) {
+			return nil, fmt.Errorf("%q is not one of %s", s, strings.Join(t.EnumVals, ", "))
+		}
+		return parser.Str(s), nil
+	}
+	switch t.Base {
+	case catalog.BaseInt:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an int", s)
+		}
+		return parser.Int(n), nil
+	case catalog.BaseFloat:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a float", s)
+		}
+		return parser.Float(f), nil
+	case catalog.BaseBool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a bool", s)
+		}
+		return parser.Bool(b), nil
+	default:
+		return parser.Str(s), nil
+	}
+}
+
+// isNullDefault reports whether a field was declared DEFAULT null. Defaults are
+// stored as raw text, so for text fields 'null' is taken literally.
+func isNullDefault(spec catalog.FieldSpec) bool {
+	switch spec.Type.Base {
+	case catalog.BaseInt, catalog.BaseFloat, catalog.BaseBool:
+		return strings.EqualFold(*spec.DefaultRaw, "null")
+	}
+	return false
+}
+
+// errNodeType reports a missing node type the way the executor does
+func errNodeType(name string) error {
+	return fmt.Errorf("node type '%s' does not exist: %w", name, ErrNotFound)
+}
@@ -0,0 +1,85 @@
+package grapho
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestImportCSV(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	db, err := Open(ctx, dir)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := db.Exec(ctx, "CREATE NODE Person (name: string NOT NULL, age: int, active: bool DEFAULT true, mood: enum<'ok', 'meh'>);"); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	in := `name,age,mood
+Ann,31,ok
+Bob,forty,ok
+,25,meh
+"Cid, Jr.",,meh
+Dee,7,angry
+Eve,-3,
+`
+	res, err := db.ImportCSV(ctx, "Person", strings.NewReader(in), CSVOptions{BatchSize: 2})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if res.Inserted != 2 {
+		t.Errorf("inserted %d, want 2", res.Inserted)
+	}
+	var lines []int
+	for _, e := range res.Errors {
+		lines = append(lines, e.Line)
+	}
+	if want := []int{3, 4, 6, 7}; !equalInts(lines, want) {
+		t.Fatalf("error lines %v, want %v: %v", lines, want, res.Errors)
+	}
+
+	rows, err := db.Query(ctx, "MATCH Person WHERE name: 'Cid, Jr.';")
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("query: %v %v", rows, err)
+	}
+	if rows[0].Properties["active"] != true {
+		t.Errorf("default not applied: %v", rows[0].Properties)
+	}
+	if _, ok := rows[0].Properties["age"]; ok {
+		t.Errorf("empty cell should be left null: %v", rows[0].Properties)
+	}
+	db.Close()
+
+	// imported rows survive a restart
+	db, err = Open(ctx, dir)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer db.Close()
+	rows, err = db.Query(ctx, "MATCH Person;")
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("after reopen: %v %v", rows, err)
+	}
+
+	if _, err := db.ImportCSV(ctx, "Person", strings.NewReader("name,email\n"), CSVOptions{}); err == nil {
+		t.Error("expected unknown column error")
+	}
+	if _, err := db.ImportCSV(ctx, "Nope", strings.NewReader("name\n"), CSVOptions{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
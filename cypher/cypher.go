@@ -0,0 +1,530 @@
+// Package cypher translates a practical subset of openCypher into grapho
+// statements, for users coming from Neo4j. The supported forms are:
+//
+//	CREATE (:Person {name: 'Ann', age: 31}), (:Person {name: 'Bob'})
+//	MATCH (p:Person {name: 'Ann'}) RETURN p
+//	MATCH (p:Person) WHERE p.age = 31 AND p.name = 'Ann' RETURN p.name, p.age
+//	MATCH (a:Person {name: 'Ann'}), (b:Person) WHERE b.name = 'Bob'
+//	CREATE (a)-[:KNOWS {since: 2020}]->(b)
+//
+// Conditions are equalities joined by AND, as in grapho's own WHERE. A
+// relationship endpoint is found the way INSERT EDGE finds it: the first node
+// matching its conditions. Literals may be $parameters when compiled with
+// Compile.
+package cypher
+
+import (
+	"fmt"
+	"strings"
+
+	"grapho/parser"
+)
+
+// Query is one translated Cypher query
+type Query struct {
+	Stmts []parser.Stmt
+	// Columns lists the RETURN items in order; it is empty without RETURN
+	Columns []Column
+}
+
+// Column is one RETURN item: a whole node, or one of its properties
+type Column struct {
+	Name     string // as written, e.g. "p" or "p.name"
+	Property string // "" for the whole node
+}
+
+// Translate converts one or more ';'-separated Cypher queries into grapho
+// statements. Syntax errors and unsupported constructs are reported as
+// parser.ParseErrors.
+func Translate(query string) ([]parser.Stmt, error) {
+	queries, err := Compile(query, nil)
+	if err != nil {
+		return nil, err
+	}
+	var stmts []parser.Stmt
+	for _, q := range queries {
+		stmts = append(stmts, q.Stmts...)
+	}
+	return stmts, nil
+}
+
+// Compile translates one or more ';'-separated Cypher queries, substituting
+// $name references with params. Parameter values may be nil, bool, string,
+// any Go integer or float type.
+func Compile(query string, params map[string]any) ([]Query, error) {
+	t := &translator{lex: newLexer(query), params: params}
+	t.next()
+	var queries []Query
+	for t.tok.kind != tokEOF {
+		if t.tok.is(";") {
+			t.next()
+			continue
+		}
+		q, err := t.query()
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+		if !t.tok.is(";") && t.tok.kind != tokEOF {
+			return nil, t.errorf(t.tok, "expected ';' or end of query, found %s", describe(t.tok))
+		}
+	}
+	return queries, nil
+}
+
+// TranslateScript is Translate followed by parser.FormatScript, giving a grapho
+// script that can be sent to a server or passed to grapho.DB.Exec
+func TranslateScript(query string) (string, error) {
+	stmts, err := Translate(query)
+	if err != nil {
+		return "", err
+	}
+	return parser.FormatScript(stmts)
+}
+
+// nodePattern is (var:Label {props})
+type nodePattern struct {
+	variable string
+	label    string
+	props    []parser.Property
+	tok      token
+}
+
+// binding is a node variable introduced by MATCH
+type binding struct {
+	label string
+	where []parser.Property
+}
+
+type translator struct {
+	lex    *lexer
+	tok    token
+	params map[string]any
+}
+
+func (t *translator) next() { t.tok = t.lex.next() }
+
+func (t *translator) errorf(at token, format string, args ...any) error {
+	return parser.ParseErrors{{Line: at.line, Col: at.col, Msg: fmt.Sprintf(format, args...)}}
+}
+
+func (t *translator) expect(s string) (token, error) {
+	tok := t.tok
+	if !tok.is(s) {
+		return tok, t.errorf(tok, "expected %s, found %s", s, describe(tok))
+	}
+	t.next()
+	return tok, nil
+}
+
+func (t *translator) name() (token, error) {
+	tok := t.tok
+	if tok.kind != tokIdent {
+		return tok, t.errorf(tok, "expected a name, found %s", describe(tok))
+	}
+	t.next()
+	return tok, nil
+}
+
+// query translates one MATCH or CREATE query
+func (t *translator) query() (Query, error) {
+	switch {
+	case t.tok.is("CREATE"):
+		t.next()
+		stmts, err := t.create(nil)
+		return Query{Stmts: stmts}, err
+	case t.tok.is("MATCH"):
+		t.next()
+		return t.match()
+	default:
+		return Query{}, t.errorf(t.tok, "expected MATCH or CREATE, found %s", describe(t.tok))
+	}
+}
+
+func (t *translator) match() (Query, error) {
+	bound := make(map[string]*binding)
+	var order []nodePattern
+	for {
+		n, err := t.nodePattern()
+		if err != nil {
+			return Query{}, err
+		}
+		if n.label == "" {
+			return Query{}, t.errorf(n.tok, "MATCH patterns need a label, e.g. (n:Person)")
+		}
+		if n.variable == "" {
+			return Query{}, t.errorf(n.tok, "MATCH patterns need a variable, e.g. (n:Person)")
+		}
+		if _, dup := bound[n.variable]; dup {
+			return Query{}, t.errorf(n.tok, "variable '%s' is already bound", n.variable)
+		}
+		bound[n.variable] = &binding{label: n.label, where: n.props}
+		order = append(order, n)
+		if !t.tok.is(",") {
+			break
+		}
+		t.next()
+	}
+
+	if t.tok.is("WHERE") {
+		t.next()
+		if err := t.where(bound); err != nil {
+			return Query{}, err
+		}
+	}
+
+	switch {
+	case t.tok.is("RETURN"):
+		if len(order) != 1 {
+			return Query{}, t.errorf(order[1].tok, "MATCH ... RETURN supports a single node pattern")
+		}
+		t.next()
+		n := order[0]
+		columns, err := t.returnItems(n.variable)
+		if err != nil {
+			return Query{}, err
+		}
+		m := parser.Match(n.label, bound[n.variable].where...)
+		for _, c := range columns {
+			if c.Property == "" {
+				m.Return = nil
+				break
+			}
+			m.Return = append(m.Return, c.Property)
+		}
+		return Query{Stmts: []parser.Stmt{m}, Columns: columns}, nil
+	case t.tok.is("CREATE"):
+		t.next()
+		stmts, err := t.create(bound)
+		return Query{Stmts: stmts}, err
+	default:
+		return Query{}, t.errorf(t.tok, "expected WHERE, RETURN or CREATE, found %s", describe(t.tok))
+	}
+}
+
+// where reads var.prop = literal conditions joined by AND
+func (t *translator) where(bound map[string]*binding) error {
+	for {
+		var (
+			v, prop token
+			lit     *parser.Literal
+			err     error
+		)
+		if t.tok.kind == tokIdent {
+			if v, prop, err = t.property(); err != nil {
+				return err
+			}
+			if _, err = t.expect("="); err != nil {
+				return err
+			}
+			if lit, err = t.literal(); err != nil {
+				return err
+			}
+		} else {
+			if lit, err = t.literal(); err != nil {
+				return err
+			}
+			if _, err = t.expect("="); err != nil {
+				return err
+			}
+			if v, prop, err = t.property(); err != nil {
+				return err
+			}
+		}
+		b, ok := bound[v.text]
+		if !ok {
+			return t.errorf(v, "variable '%s' is not defined", v.text)
+		}
+		b.where = append(b.where, parser.Prop(prop.text, lit))
+
+		if t.tok.is("OR") || t.tok.is("XOR") {
+			return t.errorf(t.tok, "only equality conditions joined by AND are supported")
+		}
+		if !t.tok.is("AND") {
+			return nil
+		}
+		t.next()
+	}
+}
+
+// property reads var.prop
+func (t *translator) property() (token, token, error) {
+	v, err := t.name()
+	if err != nil {
+		return v, v, err
+	}
+	if _, err := t.expect("."); err != nil {
+		return v, v, err
+	}
+	prop, err := t.name()
+	return v, prop, err
+}
+
+// returnItems reads the RETURN list: n, n.a, ...
+func (t *translator) returnItems(variable string) ([]Column, error) {
+	var columns []Column
+	for {
+		v, err := t.name()
+		if err != nil {
+			return nil, err
+		}
+		if v.text != variable {
+			return nil, t.errorf(v, "variable '%s' is not defined", v.text)
+		}
+		c := Column{Name: v.text}
+		if t.tok.is(".") {
+			t.next()
+			prop, err := t.name()
+			if err != nil {
+				return nil, err
+			}
+			c.Name, c.Property = v.text+"."+prop.text, prop.text
+		}
+		columns = append(columns, c)
+		if !t.tok.is(",") {
+			return columns, nil
+		}
+		t.next()
+	}
+}
+
+// create reads the comma-separated patterns of a CREATE clause. bound holds
+// the variables of a preceding MATCH, which relationships connect.
+func (t *translator) create(bound map[string]*binding) ([]parser.Stmt, error) {
+	var stmts []parser.Stmt
+	for {
+		n, err := t.nodePattern()
+		if err != nil {
+			return nil, err
+		}
+		if t.tok.is("-") || t.tok.is("<-") {
+			st, err := t.relationship(n, bound)
+			if err != nil {
+				return nil, err
+			}
+			stmts = append(stmts, st)
+		} else {
+			if n.label == "" {
+				return nil, t.errorf(n.tok, "CREATE needs a label, e.g. (:Person {...})")
+			}
+			if _, ok := bound[n.variable]; ok && n.variable != "" {
+				return nil, t.errorf(n.tok, "variable '%s' is already bound", n.variable)
+			}
+			if len(n.props) == 0 {
+				return nil, t.errorf(n.tok, "CREATE needs at least one property")
+			}
+			stmts = append(stmts, parser.InsertNode(n.label, n.props...))
+		}
+		if !t.tok.is(",") {
+			return stmts, nil
+		}
+		t.next()
+	}
+}
+
+// relationship reads -[:TYPE {props}]-> (or <-[...]-) and the far node
+func (t *translator) relationship(left nodePattern, bound map[string]*binding) (parser.Stmt, error) {
+	incoming := t.tok.is("<-")
+	t.next()
+	if _, err := t.expect("["); err != nil {
+		return nil, err
+	}
+	if t.tok.kind == tokIdent {
+		t.next() // relationship variables are accepted and ignored
+	}
+	if _, err := t.expect(":"); err != nil {
+		return nil, err
+	}
+	typ, err := t.name()
+	if err != nil {
+		return nil, err
+	}
+	var props []parser.Property
+	if t.tok.is("{") {
+		if props, err = t.propertyMap(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := t.expect("]"); err != nil {
+		return nil, err
+	}
+	closing := "->"
+	if incoming {
+		closing = "-"
+	}
+	if _, err := t.expect(closing); err != nil {
+		return nil, err
+	}
+	right, err := t.nodePattern()
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := left, right
+	if incoming {
+		from, to = right, left
+	}
+	fromRef, err := t.endpoint(from, bound)
+	if err != nil {
+		return nil, err
+	}
+	toRef, err := t.endpoint(to, bound)
+	if err != nil {
+		return nil, err
+	}
+	return parser.InsertEdge(typ.text, fromRef, toRef, props...), nil
+}
+
+// endpoint resolves a relationship end to the node a MATCH variable describes
+func (t *translator) endpoint(n nodePattern, bound map[string]*binding) (*parser.NodeRef, error) {
+	b, ok := bound[n.variable]
+	if !ok || n.label != "" || len(n.props) > 0 {
+		return nil, t.errorf(n.tok, "relationships can only connect variables bound by MATCH, e.g. (a)-[:KNOWS]->(b)")
+	}
+	if len(b.where) == 0 {
+		return nil, t.errorf(n.tok, "'%s' must be identified by properties to be connected", n.variable)
+	}
+	return parser.NodeWhere(b.label, b.where...), nil
+}
+
+// nodePattern reads (var:Label {props}); every part is optional
+func (t *translator) nodePattern() (nodePattern, error) {
+	n := nodePattern{tok: t.tok}
+	if _, err := t.expect("("); err != nil {
+		return n, err
+	}
+	if t.tok.kind == tokIdent {
+		n.variable = t.tok.text
+		t.next()
+	}
+	if t.tok.is(":") {
+		t.next()
+		label, err := t.name()
+		if err != nil {
+			return n, err
+		}
+		n.label = label.text
+		if t.tok.is(":") {
+			return n, t.errorf(t.tok, "nodes have a single label in grapho")
+		}
+	}
+	if t.tok.is("{") {
+		props, err := t.propertyMap()
+		if err != nil {
+			return n, err
+		}
+		n.props = props
+	}
+	_, err := t.expect(")")
+	return n, err
+}
+
+// propertyMap reads {key: literal, ...}
+func (t *translator) propertyMap() ([]parser.Property, error) {
+	if _, err := t.expect("{"); err != nil {
+		return nil, err
+	}
+	var props []parser.Property
+	for !t.tok.is("}") {
+		key, err := t.name()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := t.expect(":"); err != nil {
+			return nil, err
+		}
+		lit, err := t.literal()
+		if err != nil {
+			return nil, err
+		}
+		props = append(props, parser.Prop(key.text, lit))
+		if !t.tok.is(",") {
+			break
+		}
+		t.next()
+	}
+	_, err := t.expect("}")
+	return props, err
+}
+
+func (t *translator) literal() (*parser.Literal, error) {
+	tok := t.tok
+	switch {
+	case tok.kind == tokString:
+		t.next()
+		return parser.Str(tok.text), nil
+	case tok.kind == tokNumber:
+		t.next()
+		return &parser.Literal{Kind: parser.LitNumber, Text: tok.text}, nil
+	case tok.is("true"), tok.is("false"):
+		t.next()
+		return parser.Bool(strings.EqualFold(tok.text, "true")), nil
+	case tok.is("null"):
+		t.next()
+		return parser.Null(), nil
+	case tok.kind == tokParam:
+		t.next()
+		v, ok := t.params[tok.text]
+		if !ok {
+			return nil, t.errorf(tok, "parameter $%s is not set", tok.text)
+		}
+		lit, err := paramLiteral(v)
+		if err != nil {
+			return nil, t.errorf(tok, "parameter $%s: %v", tok.text, err)
+		}
+		return lit, nil
+	case tok.is("-"):
+		return nil, t.errorf(tok, "negative numbers are not supported")
+	default:
+		return nil, t.errorf(tok, "expected a literal, found %s", describe(tok))
+	}
+}
+
+// paramLiteral converts a parameter value to a literal
+func paramLiteral(v any) (*parser.Literal, error) {
+	switch v := v.(type) {
+	case nil:
+		return parser.Null(), nil
+	case bool:
+		return parser.Bool(v), nil
+	case string:
+		return parser.Str(v), nil
+	case int:
+		return parser.Int(int64(v)), nil
+	case int8:
+		return parser.Int(int64(v)), nil
+	case int16:
+		return parser.Int(int64(v)), nil
+	case int32:
+		return parser.Int(int64(v)), nil
+	case int64:
+		return parser.Int(v), nil
+	case uint8:
+		return parser.Int(int64(v)), nil
+	case uint16:
+		return parser.Int(int64(v)), nil
+	case uint32:
+		return parser.Int(int64(v)), nil
+	case float32:
+		return parser.Float(float64(v)), nil
+	case float64:
+		return parser.Float(v), nil
+	default:
+		return nil, fmt.Errorf("unsupported type %T", v)
+	}
+}
+
+func describe(t token) string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokIllegal:
+		return t.text
+	case tokString:
+		return fmt.Sprintf("string '%s'", t.text)
+	case tokParam:
+		return "$" + t.text
+	default:
+		return fmt.Sprintf("'%s'", t.text)
+	}
+}
@@ -0,0 +1,103 @@
+package cypher
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"grapho/parser"
+)
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			query: `CREATE (:Person {name: 'Ann', age: 31}), (b:Person {name: "Bob \"B\""})`,
+			want:  "INSERT NODE Person (name: 'Ann', age: 31);\nINSERT NODE Person (name: 'Bob \"B\"');",
+		},
+		{
+			query: `match (p:Person {name: 'Ann'}) return p`,
+			want:  "MATCH Person WHERE name: 'Ann';",
+		},
+		{
+			query: `MATCH (p:Person) WHERE p.age = 31 AND 'Ann' = p.name RETURN p.name, p.age;`,
+			want:  "MATCH Person WHERE age: 31, name: 'Ann' RETURN name, age;",
+		},
+		{
+			query: `MATCH (a:Person {name: 'Ann'}), (b:Person) WHERE b.name = 'Bob'
+CREATE (a)-[:KNOWS {since: 2020}]->(b), (a)<-[r:KNOWS]-(b)`,
+			want: "INSERT EDGE KNOWS FROM Person(name: 'Ann') TO Person(name: 'Bob') (since: 2020);\n" +
+				"INSERT EDGE KNOWS FROM Person(name: 'Bob') TO Person(name: 'Ann');",
+		},
+		{
+			query: "CREATE (:`Order` {`from`: true, note: null}); MATCH (o:`Order`) RETURN o",
+			want:  "INSERT NODE Order (`from`: true, note: null);\nMATCH Order;",
+		},
+	}
+	for _, tt := range tests {
+		got, err := TranslateScript(tt.query)
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"MATCH (p) RETURN p", "1:7: MATCH patterns need a label"},
+		{"MATCH (p:Person) WHERE p.age = 1 OR p.age = 2 RETURN p", "only equality conditions"},
+		{"MATCH (p:Person) WHERE q.age = 1 RETURN p", "variable 'q' is not defined"},
+		{"MATCH (a:Person), (b:Person) RETURN a", "single node pattern"},
+		{"CREATE (:A {x: 1})-[:R]->(:B {y: 2})", "relationships can only connect variables bound by MATCH"},
+		{"MATCH (a:P), (b:P {k: 1}) CREATE (a)-[:R]->(b)", "'a' must be identified by properties"},
+		{"CREATE (:A {x: -1})", "negative numbers are not supported"},
+		{"CREATE (:A:B {x: 1})", "single label"},
+		{"DELETE (n)", "expected MATCH or CREATE"},
+		{"CREATE (:A {x: 'open", "unterminated string"},
+	}
+	for _, tt := range tests {
+		_, err := Translate(tt.query)
+		var perrs parser.ParseErrors
+		if !errors.As(err, &perrs) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want error containing %q", tt.query, err, tt.want)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	qs, err := Compile("MATCH (p:Person) WHERE p.name = $name AND p.age = $age RETURN p, p.age; CREATE (:Person {name: $name})",
+		map[string]any{"name": "O'Neil", "age": 31})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if len(qs) != 2 {
+		t.Fatalf("want 2 queries, got %d", len(qs))
+	}
+	want := []Column{{Name: "p"}, {Name: "p.age", Property: "age"}}
+	if len(qs[0].Columns) != 2 || qs[0].Columns[0] != want[0] || qs[0].Columns[1] != want[1] {
+		t.Errorf("columns %v, want %v", qs[0].Columns, want)
+	}
+	got, err := parser.Format(qs[0].Stmts[0])
+	if err != nil || got != "MATCH Person WHERE name: 'O''Neil', age: 31;" {
+		t.Errorf("got %q %v", got, err)
+	}
+	if len(qs[1].Columns) != 0 {
+		t.Errorf("CREATE has no columns: %v", qs[1].Columns)
+	}
+
+	if _, err := Compile("CREATE (:P {x: $missing})", nil); err == nil || !strings.Contains(err.Error(), "$missing is not set") {
+		t.Errorf("got %v", err)
+	}
+	if _, err := Compile("CREATE (:P {x: $v})", map[string]any{"v": []int{1}}); err == nil {
+		t.Error("expected unsupported parameter type")
+	}
+}
@@ -0,0 +1,191 @@
+package cypher
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIllegal
+	tokIdent  // names and keywords; keywords are matched case-insensitively
+	tokNumber // 42, 3.14
+	tokString // 'text' or "text", unescaped
+	tokPunct  // ( ) [ ] { } : , . = ; - -> <-
+	tokParam  // $name, without the $
+)
+
+type token struct {
+	kind      tokenKind
+	text      string
+	quoted    bool // a backquoted identifier, never a keyword
+	line, col int
+}
+
+// is reports whether t is the punctuation or keyword s
+func (t token) is(s string) bool {
+	switch t.kind {
+	case tokPunct:
+		return t.text == s
+	case tokIdent:
+		return !t.quoted && strings.EqualFold(t.text, s)
+	}
+	return false
+}
+
+type lexer struct {
+	input     string
+	pos       int
+	line, col int
+}
+
+func newLexer(input string) *lexer {
+	return &lexer{input: input, line: 1, col: 1}
+}
+
+func (l *lexer) peek(n int) byte {
+	if l.pos+n < len(l.input) {
+		return l.input[l.pos+n]
+	}
+	return 0
+}
+
+func (l *lexer) advance() rune {
+	r, w := utf8.DecodeRuneInString(l.input[l.pos:])
+	l.pos += w
+	if r == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	return r
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.input) {
+		switch {
+		case l.peek(0) == '/' && l.peek(1) == '/':
+			for l.pos < len(l.input) && l.peek(0) != '\n' {
+				l.advance()
+			}
+		case l.peek(0) == '/' && l.peek(1) == '*':
+			l.advance()
+			l.advance()
+			for l.pos < len(l.input) && !(l.peek(0) == '*' && l.peek(1) == '/') {
+				l.advance()
+			}
+			l.advance()
+			l.advance()
+		case unicode.IsSpace(rune(l.peek(0))):
+			l.advance()
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) next() token {
+	l.skipSpace()
+	t := token{line: l.line, col: l.col}
+	if l.pos >= len(l.input) {
+		t.kind = tokEOF
+		return t
+	}
+
+	ch := l.peek(0)
+	switch {
+	case ch == '-' && l.peek(1) == '>', ch == '<' && l.peek(1) == '-':
+		t.kind, t.text = tokPunct, l.input[l.pos:l.pos+2]
+		l.advance()
+		l.advance()
+	case strings.IndexByte("()[]{}:,.=;-", ch) >= 0:
+		t.kind, t.text = tokPunct, string(ch)
+		l.advance()
+	case ch == '\'' || ch == '"':
+		return l.str(t, ch)
+	case ch == '$':
+		l.advance()
+		name := l.next()
+		if name.kind != tokIdent {
+			t.kind, t.text = tokIllegal, "expected a parameter name after $"
+			return t
+		}
+		t.kind, t.text = tokParam, name.text
+	case ch == '`':
+		l.advance()
+		start := l.pos
+		for l.pos < len(l.input) && l.peek(0) != '`' {
+			l.advance()
+		}
+		if l.pos >= len(l.input) {
+			t.kind, t.text = tokIllegal, "unterminated backquoted name"
+			return t
+		}
+		t.kind, t.text, t.quoted = tokIdent, l.input[start:l.pos], true
+		l.advance()
+	case ch >= '0' && ch <= '9':
+		start := l.pos
+		for isDigit(l.peek(0)) {
+			l.advance()
+		}
+		if l.peek(0) == '.' && isDigit(l.peek(1)) {
+			l.advance()
+			for isDigit(l.peek(0)) {
+				l.advance()
+			}
+		}
+		t.kind, t.text = tokNumber, l.input[start:l.pos]
+	default:
+		r, _ := utf8.DecodeRuneInString(l.input[l.pos:])
+		if !unicode.IsLetter(r) && r != '_' {
+			l.advance()
+			t.kind, t.text = tokIllegal, "unexpected character "+string(r)
+			return t
+		}
+		start := l.pos
+		for l.pos < len(l.input) {
+			r, _ := utf8.DecodeRuneInString(l.input[l.pos:])
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+				break
+			}
+			l.advance()
+		}
+		t.kind, t.text = tokIdent, l.input[start:l.pos]
+	}
+	return t
+}
+
+// str reads a quoted string, resolving backslash escapes
+func (l *lexer) str(t token, quote byte) token {
+	l.advance()
+	var b strings.Builder
+	for {
+		if l.pos >= len(l.input) {
+			t.kind, t.text = tokIllegal, "unterminated string"
+			return t
+		}
+		r := l.advance()
+		switch {
+		case r == rune(quote):
+			t.kind, t.text = tokString, b.String()
+			return t
+		case r == '\\' && l.pos < len(l.input):
+			switch e := l.advance(); e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteRune(e)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
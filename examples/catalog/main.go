@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"grapho/catalog"
 )
 
 func main() {
+	ctx := context.Background()
+
 	// at server boot:
 	store, _ := catalog.NewFileStore("./meta/catalog")
-	reg, _ := catalog.Open(store)
+	reg, _ := catalog.Open(ctx, store)
 
 	// use in executor for DDL:
 	ev := catalog.DDLEvent{
@@ -21,7 +24,7 @@ func main() {
 			},
 		},
 	}
-	newCat, err := reg.Apply(ev)
+	newCat, err := reg.Apply(ctx, ev)
 	_ = newCat
 	_ = err
 
@@ -0,0 +1,72 @@
+// Command repo shows the typed repositories generated by grapho/cmd/gen
+package main
+
+//go:generate go run grapho/cmd/gen -ddl schema.gql -pkg main -o models_gen.go
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"grapho"
+)
+
+func main() {
+	ctx := context.Background()
+	dir, err := os.MkdirTemp("", "grapho-repo-")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := grapho.Open(ctx, dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	schema, err := os.ReadFile("schema.gql")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Exec(ctx, string(schema)); err != nil {
+		log.Fatal(err)
+	}
+
+	people := NewPersonRepo(db)
+	age := int64(31)
+	if err := people.Insert(ctx, &Person{Email: "ann@example.com", Name: "Ann", Age: &age}); err != nil {
+		log.Fatal(err)
+	}
+
+	ann, err := people.Get(ctx, "ann@example.com")
+	if err != nil {
+		log.Fatal(err)
+	}
+	*ann.Age++
+	if err := people.Update(ctx, ann); err != nil {
+		log.Fatal(err)
+	}
+	ann, _ = people.Get(ctx, "ann@example.com")
+	fmt.Printf("%s is %d\n", ann.Name, *ann.Age)
+
+	companies := NewCompanyRepo(db)
+	if err := companies.Insert(ctx, &Company{Name: ptr("Acme")}); err != nil {
+		log.Fatal(err)
+	}
+	acme, err := companies.FindByName(ctx, "Acme")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("found company %s (node %s)\n", *acme.Name, acme.NodeID)
+
+	if err := people.Delete(ctx, "ann@example.com"); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := people.Get(ctx, "ann@example.com"); err == grapho.ErrNotFound {
+		fmt.Println("ann deleted")
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,111 @@
+// Code generated by grapho/cmd/gen from schema.gql. DO NOT EDIT.
+
+package main
+
+import (
+	"context"
+
+	"grapho"
+)
+
+// Company is a Company node
+type Company struct {
+	NodeID  string  `grapho:"_id"`
+	Founded *int64  `grapho:"founded"`
+	Name    *string `grapho:"name"`
+}
+
+// CompanyRepo reads and writes Company nodes
+type CompanyRepo struct {
+	db *grapho.DB
+}
+
+// NewCompanyRepo returns a repository backed by db
+func NewCompanyRepo(db *grapho.DB) *CompanyRepo {
+	return &CompanyRepo{db: db}
+}
+
+// Insert adds v as a new node
+func (r *CompanyRepo) Insert(ctx context.Context, v *Company) error {
+	return r.db.InsertNode(ctx, "Company", v)
+}
+
+// Get returns the node whose _id is key, or grapho.ErrNotFound
+func (r *CompanyRepo) Get(ctx context.Context, key string) (*Company, error) {
+	return r.findOne(ctx, "_id", key)
+}
+
+// FindByName returns the node whose name is v, or grapho.ErrNotFound
+func (r *CompanyRepo) FindByName(ctx context.Context, v string) (*Company, error) {
+	return r.findOne(ctx, "name", v)
+}
+
+// Update writes every field of v to the node with the same _id
+func (r *CompanyRepo) Update(ctx context.Context, v *Company) error {
+	return r.db.UpdateNode(ctx, "Company", "_id", v)
+}
+
+// Delete removes the node whose _id is key
+func (r *CompanyRepo) Delete(ctx context.Context, key string) error {
+	return r.db.DeleteNodes(ctx, "Company", "_id", key)
+}
+
+func (r *CompanyRepo) findOne(ctx context.Context, field string, v any) (*Company, error) {
+	found, err := grapho.FindNodes[Company](ctx, r.db, "Company", field, v)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, grapho.ErrNotFound
+	}
+	return &found[0], nil
+}
+
+// Person is a Person node
+type Person struct {
+	NodeID string `grapho:"_id"`
+	Email  string `grapho:"email"`
+	Age    *int64 `grapho:"age"`
+	Name   string `grapho:"name"`
+}
+
+// PersonRepo reads and writes Person nodes
+type PersonRepo struct {
+	db *grapho.DB
+}
+
+// NewPersonRepo returns a repository backed by db
+func NewPersonRepo(db *grapho.DB) *PersonRepo {
+	return &PersonRepo{db: db}
+}
+
+// Insert adds v as a new node
+func (r *PersonRepo) Insert(ctx context.Context, v *Person) error {
+	return r.db.InsertNode(ctx, "Person", v)
+}
+
+// Get returns the node whose email is key, or grapho.ErrNotFound
+func (r *PersonRepo) Get(ctx context.Context, key string) (*Person, error) {
+	return r.findOne(ctx, "email", key)
+}
+
+// Update writes every field of v to the node with the same email
+func (r *PersonRepo) Update(ctx context.Context, v *Person) error {
+	return r.db.UpdateNode(ctx, "Person", "email", v)
+}
+
+// Delete removes the node whose email is key
+func (r *PersonRepo) Delete(ctx context.Context, key string) error {
+	return r.db.DeleteNodes(ctx, "Person", "email", key)
+}
+
+func (r *PersonRepo) findOne(ctx context.Context, field string, v any) (*Person, error) {
+	found, err := grapho.FindNodes[Person](ctx, r.db, "Person", field, v)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, grapho.ErrNotFound
+	}
+	return &found[0], nil
+}
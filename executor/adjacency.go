@@ -0,0 +1,170 @@
+package executor
+
+import (
+	"context"
+	"maps"
+	"slices"
+)
+
+/* ---------------------- Adjacency ---------------------- */
+
+// The edges of a type are kept in one list, in the order they were
+// inserted. Beside it, the type's adjacency lists the positions in that list
+// of the edges leaving and entering each node, so following the edges of a
+// node in a MATCH path, finding the edges between two nodes, or checking the
+// ONE end of an edge type takes time in the edges at those nodes rather than
+// in all the edges of the type. Like the node indexes, a type's adjacency is
+// built the first time a statement needs it and snapshots never build one.
+// INSERT EDGE adds to it and deletes take from it; writes that move the ends
+// of edges, which go over the whole list anyway, drop it to be built again.
+//
+// A deleted edge leaves a tombstone in the list, an edge with no ID, so that
+// the positions of the others stay put and deleting takes time in the edges
+// deleted rather than in the list. VACUUM drops the tombstones.
+
+// adjacency lists the edges of one type by endpoint, as indexes into
+// GraphData.Edges
+type adjacency struct {
+	out, in map[string][]int
+	epoch   uint64 // see NodeSet.epochs
+}
+
+// adjacency returns the adjacency of edgeType, building it if needed. A
+// snapshot that has none builds one for the caller alone.
+func (g *GraphData) adjacency(edgeType string) *adjacency {
+	if a := g.adj[edgeType]; a != nil {
+		return a
+	}
+	a := &adjacency{out: make(map[string][]int), in: make(map[string][]int), epoch: g.epoch}
+	for i := range g.Edges[edgeType] {
+		if inst := &g.Edges[edgeType][i]; !inst.Deleted() {
+			a.add(i, inst)
+		}
+	}
+	if !g.view {
+		g.adj[intern(edgeType)] = a
+	}
+	return a
+}
+
+// add lists inst, the edge at index i, at both its ends
+func (a *adjacency) add(i int, inst *EdgeInstance) {
+	a.out[inst.FromNodeID] = append(a.out[inst.FromNodeID], i)
+	a.in[inst.ToNodeID] = append(a.in[inst.ToNodeID], i)
+}
+
+// addEdge appends inst to the edges of edgeType, and to their adjacency if
+// it is built
+func (g *GraphData) addEdge(edgeType string, inst EdgeInstance) {
+	edgeType = intern(edgeType)
+	g.Edges[edgeType] = append(g.Edges[edgeType], inst)
+	g.edgeWritten(edgeType, inst.ID, len(g.Edges[edgeType])-1)
+	if a := g.ownAdjacency(edgeType); a != nil {
+		a.add(len(g.Edges[edgeType])-1, &inst)
+	}
+}
+
+// deleteEdge leaves a tombstone in place of the edge at index i of edges,
+// the edges of edgeType as ownEdges returned them, and takes it out of their
+// adjacency
+func (g *GraphData) deleteEdge(edgeType string, edges []EdgeInstance, i int) {
+	edgeType = intern(edgeType)
+	g.edgeWritten(edgeType, edges[i].ID, -1)
+	if a := g.ownAdjacency(edgeType); a != nil {
+		a.out[edges[i].FromNodeID] = without(a.out[edges[i].FromNodeID], i)
+		a.in[edges[i].ToNodeID] = without(a.in[edges[i].ToNodeID], i)
+	}
+	edges[i] = EdgeInstance{}
+	g.dead[edgeType]++
+}
+
+// without returns list, a list of an adjacency, less i. The list is copied,
+// as a snapshot may share it; the lists are otherwise only ever appended
+// to, past the end any snapshot sees.
+func without(list []int, i int) []int {
+	if j := slices.Index(list, i); j >= 0 {
+		return slices.Delete(slices.Clone(list), j, j+1)
+	}
+	return list
+}
+
+// ownAdjacency returns the adjacency of edgeType for writing, or nil if it
+// is not built
+func (g *GraphData) ownAdjacency(edgeType string) *adjacency {
+	a := g.adj[edgeType]
+	if a != nil && a.epoch != g.epoch {
+		// a snapshot may share the maps
+		a = &adjacency{out: maps.Clone(a.out), in: maps.Clone(a.in), epoch: g.epoch}
+		g.adj[edgeType] = a
+	}
+	return a
+}
+
+// setEdges replaces the edges of edgeType with edges, which may have moved
+// their ends or dropped tombstones, and drops their adjacency
+func (g *GraphData) setEdges(edgeType string, edges []EdgeInstance) {
+	g.Edges[intern(edgeType)] = edges
+	delete(g.adj, edgeType)
+}
+
+// between returns the indexes of the edges of edgeType from node from to node
+// to, in order
+func (e *Executor) between(edgeType, from, to string) []int {
+	edges := e.graph.Edges[edgeType]
+	var hits []int
+	for _, i := range e.graph.adjacency(edgeType).out[from] {
+		if edges[i].ToNodeID == to {
+			hits = append(hits, i)
+		}
+	}
+	return hits
+}
+
+// Neighbors follows the adjacency of edgeType, building it if need be
+func (g *GraphData) Neighbors(ctx context.Context, edgeType, id string, in bool, fn func(inst *EdgeInstance) bool) error {
+	return g.neighbors(ctx, g.adjacency(edgeType), edgeType, id, in, fn)
+}
+
+func (g *GraphData) neighbors(ctx context.Context, a *adjacency, edgeType, id string, in bool, fn func(inst *EdgeInstance) bool) error {
+	list := a.out[id]
+	if in {
+		list = a.in[id]
+	}
+	edges := g.Edges[edgeType]
+	for n, i := range list {
+		if n > 0 && n%scanCheckEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		if !fn(&edges[i]) {
+			break
+		}
+	}
+	return nil
+}
+
+// viewReader is the GraphReader a statement reads a snapshot through. A
+// snapshot keeps no adjacency it builds, so the reader keeps them, for as
+// long as the statement runs.
+type viewReader struct {
+	*GraphData
+	adj map[string]*adjacency
+}
+
+func (r *viewReader) Neighbors(ctx context.Context, edgeType, id string, in bool, fn func(inst *EdgeInstance) bool) error {
+	a := r.adj[edgeType]
+	if a == nil {
+		a = r.adjacency(edgeType)
+		r.adj[edgeType] = a
+	}
+	return r.neighbors(ctx, a, edgeType, id, in, fn)
+}
+
+// reader returns the GraphReader a statement reads the graph through
+func (e *Executor) reader() GraphReader {
+	if e.graph.view {
+		return &viewReader{GraphData: e.graph, adj: make(map[string]*adjacency)}
+	}
+	return e.graph
+}
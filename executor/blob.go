@@ -0,0 +1,90 @@
+package executor
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"grapho/parser"
+)
+
+/* ---------------------- Blobs ---------------------- */
+
+// A blob field holds bytes. A statement writes them in base64, as a blob
+// literal, data: b64'aGVsbG8=', or as a string holding base64, padded or
+// not, and they are stored decoded. Results, exports and the commit log
+// spell them in padded base64 again, and a WHERE compares them by that
+// spelling. A blob may hold at most SetMaxBlobSize bytes; the limit is not
+// applied on replay, so lowering it leaves the blobs already stored alone.
+
+// DefaultMaxBlobSize is the most bytes a blob holds unless SetMaxBlobSize
+// says otherwise
+const DefaultMaxBlobSize = 16 << 20
+
+// Blob is the value of a blob field
+type Blob struct {
+	data string // the bytes, in a string so that Blob values compare with ==
+}
+
+// Bytes returns a copy of the bytes b holds
+func (b Blob) Bytes() []byte {
+	return []byte(b.data)
+}
+
+// Len returns the number of bytes b holds
+func (b Blob) Len() int {
+	return len(b.data)
+}
+
+// String returns the bytes in padded base64
+func (b Blob) String() string {
+	return base64.StdEncoding.EncodeToString([]byte(b.data))
+}
+
+// MarshalText spells b as String does, so that it is a string in JSON
+func (b Blob) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// SetMaxBlobSize sets the most bytes a blob written by a statement may hold;
+// n <= 0 restores DefaultMaxBlobSize
+func (e *Executor) SetMaxBlobSize(n int) {
+	e.maxBlob = n
+}
+
+// decodeBase64 decodes s, padded or not
+func decodeBase64(s string) ([]byte, bool) {
+	s = strings.TrimSpace(s)
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil {
+		return b, true
+	}
+	b, err := base64.RawStdEncoding.DecodeString(s)
+	return b, err == nil
+}
+
+// blobLiteral returns the bytes lit, a blob literal or a string holding
+// base64, writes
+func blobLiteral(lit *parser.Literal) (Blob, bool) {
+	if lit.Kind != parser.LitBlob && lit.Kind != parser.LitString {
+		return Blob{}, false
+	}
+	b, ok := decodeBase64(lit.Text)
+	return Blob{data: string(b)}, ok
+}
+
+// coerceBlob returns the blob lit writes, within the size limit unless the
+// commit log is replaying
+func (e *Executor) coerceBlob(lit *parser.Literal) (Blob, error) {
+	b, ok := blobLiteral(lit)
+	if !ok {
+		return Blob{}, fmt.Errorf("is a blob, as in b64'aGVsbG8=': got %s", written(lit))
+	}
+	max := e.maxBlob
+	if max <= 0 {
+		max = DefaultMaxBlobSize
+	}
+	if b.Len() > max && !e.replaying {
+		return Blob{}, fmt.Errorf("is a blob of at most %d bytes: got %d", max, b.Len())
+	}
+	return b, nil
+}
@@ -0,0 +1,152 @@
+package executor
+
+import (
+	"slices"
+
+	"grapho/catalog"
+	"grapho/parser"
+)
+
+/* ---------------------- Bloom filters on key fields ---------------------- */
+
+// A node type keeps a bloom filter of the values of its primary key and of
+// each UNIQUE field, built the first time a lookup needs it. A lookup that
+// gives one of those fields a value the filter has never seen matches nothing,
+// so it returns without scanning. Values are only ever added: updates and
+// deletes leave stale bits behind, which cost a scan but never a wrong answer,
+// and a filter that fills up is dropped and rebuilt, twice the size of the
+// set, by the next lookup. Snapshots use the filters they share but never
+// build one, since several goroutines may read a snapshot at once.
+
+const (
+	bloomMinCapacity = 1024
+	bloomBitsPerKey  = 10 // about 1% false positives with bloomHashes hashes
+	bloomHashes      = 7
+)
+
+type bloomFilter struct {
+	bits     []uint64
+	n        int // values added since the filter was built
+	capacity int
+	epoch    uint64 // see NodeSet.epochs
+}
+
+func newBloomFilter(capacity int, epoch uint64) *bloomFilter {
+	capacity = max(capacity, bloomMinCapacity)
+	return &bloomFilter{
+		bits:     make([]uint64, (capacity*bloomBitsPerKey+63)/64),
+		capacity: capacity,
+		epoch:    epoch,
+	}
+}
+
+// bloomHash returns two FNV-1a hashes of key for double hashing
+func bloomHash(key string) (uint64, uint64) {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h, h>>32 | h<<32 | 1
+}
+
+func (f *bloomFilter) add(key string) {
+	h1, h2 := bloomHash(key)
+	m := uint64(len(f.bits) * 64)
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.n++
+}
+
+func (f *bloomFilter) mayContain(key string) bool {
+	h1, h2 := bloomHash(key)
+	m := uint64(len(f.bits) * 64)
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// filter returns the filter of field, building it from the nodes if needed
+func (s *NodeSet) filter(epoch uint64, field string) *bloomFilter {
+	if f := s.filters[field]; f != nil {
+		return f
+	}
+	f := newBloomFilter(2*s.n, epoch)
+	s.Range(func(id string, props map[string]interface{}) bool {
+		if k, ok := partitionKey(props[field]); ok {
+			f.add(k)
+		}
+		return true
+	})
+	if s.filters == nil {
+		s.filters = make(map[string]*bloomFilter)
+	}
+	s.filters[intern(field)] = f
+	return f
+}
+
+// addToFilters records the key values of a node being stored
+func (s *NodeSet) addToFilters(epoch uint64, props map[string]interface{}) {
+	for field, f := range s.filters {
+		k, ok := partitionKey(props[field])
+		if !ok {
+			continue
+		}
+		if f.n >= f.capacity {
+			// full: drop it, and the next lookup builds a bigger one
+			delete(s.filters, field)
+			continue
+		}
+		if f.epoch != epoch {
+			// a snapshot may share it
+			f = &bloomFilter{bits: slices.Clone(f.bits), n: f.n, capacity: f.capacity, epoch: epoch}
+			s.filters[field] = f
+		}
+		f.add(k)
+	}
+}
+
+// absent reports whether conds give a key field of nodeType a value that no
+// node of set has, so that nothing can match
+func (e *Executor) absent(nodeType string, set *NodeSet, conds []parser.Property) bool {
+	if set == nil || len(conds) == 0 {
+		return false
+	}
+	nt, ok := e.registry.Current().Nodes[nodeType]
+	if !ok {
+		return false
+	}
+	for _, c := range conds {
+		if !isKeyField(nt, c.Name) {
+			continue
+		}
+		switch c.Value.Kind {
+		case parser.LitString, parser.LitNumber, parser.LitBool:
+		default:
+			continue
+		}
+		f := set.filters[c.Name]
+		if f == nil && !e.readOnly {
+			f = set.filter(e.graph.epoch, c.Name)
+		}
+		if f != nil && !f.mayContain(c.Value.Text) {
+			return true
+		}
+	}
+	return false
+}
+
+// isKeyField reports whether field is the primary key or a UNIQUE field of nt
+func isKeyField(nt *catalog.NodeType, field string) bool {
+	if field == nt.PK {
+		return true
+	}
+	f, ok := nt.Fields[field]
+	return ok && f.Unique
+}
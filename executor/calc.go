@@ -0,0 +1,235 @@
+package executor
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"grapho/catalog"
+	"grapho/parser"
+)
+
+/* ---------------------- SET expressions ---------------------- */
+
+// SET login_count: login_count + 1, name: upper(name) computes a value from
+// the fields of each node or edge it writes, as they were before the SET, so
+// SET a: b, b: a swaps two fields. In a MATCH the fields are named as
+// alias.field and may be those of any variable of the row. + - * / take
+// numbers: two ints give an int, dividing with the remainder dropped, and
+// anything else a float. A field reads as a number if it is declared int or
+// float, or if it is undeclared and reads as one. A null operand, or a field
+// the node does not have, makes the result null. The result must fit the
+// type of the field it is stored in, as a written value must.
+
+// calcFuncs holds the functions a SET expression may call, by the number of
+// arguments each takes; -1 is one or more
+var calcFuncs = map[string]int{
+	"upper":    1,
+	"lower":    1,
+	"trim":     1,
+	"length":   1,
+	"abs":      1,
+	"concat":   -1,
+	"coalesce": -1,
+}
+
+// checkCalc rejects calls in x of functions that do not exist or with the
+// wrong number of arguments, before anything is read
+func checkCalc(name string, x parser.ValueExpr) error {
+	var err error
+	parser.Inspect(x, func(n parser.Node) bool {
+		call, ok := n.(*parser.FuncCall)
+		if !ok || err != nil {
+			return err == nil
+		}
+		want, ok := calcFuncs[call.Name]
+		switch {
+		case !ok:
+			err = fmt.Errorf("SET %s: unknown function %s()", name, call.Name)
+		case want < 0 && len(call.Args) == 0:
+			err = fmt.Errorf("SET %s: %s() needs at least one argument", name, call.Name)
+		case want >= 0 && len(call.Args) != want:
+			err = fmt.Errorf("SET %s: %s() takes %d argument(s), got %d", name, call.Name, want, len(call.Args))
+		}
+		return err == nil
+	})
+	return err
+}
+
+// calc evaluates x against props, a node, edge or row of sc
+func calc(sc *whereScope, props map[string]interface{}, x parser.ValueExpr) (*parser.Literal, error) {
+	switch x := x.(type) {
+	case *parser.Literal:
+		return x, nil
+	case *parser.FieldRef:
+		return fieldLiteral(sc.fields, x.Name, props[x.Name]), nil
+	case *parser.ArithExpr:
+		a, err := calc(sc, props, x.Left)
+		if err != nil {
+			return nil, err
+		}
+		b, err := calc(sc, props, x.Right)
+		if err != nil {
+			return nil, err
+		}
+		return arith(x.Op, a, b)
+	case *parser.FuncCall:
+		args := make([]*parser.Literal, len(x.Args))
+		for i, arg := range x.Args {
+			lit, err := calc(sc, props, arg)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = lit
+		}
+		return callFunc(x.Name, args)
+	}
+	return nil, fmt.Errorf("cannot evaluate %T", x)
+}
+
+// fieldLiteral returns v, the stored value of field, as a literal
+func fieldLiteral(fields map[string]catalog.FieldSpec, field string, v interface{}) *parser.Literal {
+	switch v := v.(type) {
+	case bool:
+		return &parser.Literal{Kind: parser.LitBool, Text: strconv.FormatBool(v)}
+	case Temporal:
+		return &parser.Literal{Kind: parser.LitString, Text: v.String()}
+	case JSON:
+		return &parser.Literal{Kind: parser.LitJSON, Text: v.String()}
+	case Blob:
+		return &parser.Literal{Kind: parser.LitBlob, Text: v.String()}
+	case string:
+		spec, declared := fields[field]
+		t := spec.Type
+		numeric := declared && t.Elem == nil && (t.Base == catalog.BaseInt || t.Base == catalog.BaseFloat)
+		if !declared {
+			_, err := strconv.ParseFloat(v, 64)
+			numeric = err == nil
+		}
+		if numeric {
+			return &parser.Literal{Kind: parser.LitNumber, Text: v}
+		}
+		return &parser.Literal{Kind: parser.LitString, Text: v}
+	}
+	return nullLiteral()
+}
+
+func nullLiteral() *parser.Literal {
+	return &parser.Literal{Kind: parser.LitNull, Text: "null"}
+}
+
+// arith returns a op b
+func arith(op string, a, b *parser.Literal) (*parser.Literal, error) {
+	if a.Kind == parser.LitNull || b.Kind == parser.LitNull {
+		return nullLiteral(), nil
+	}
+	for _, lit := range []*parser.Literal{a, b} {
+		if lit.Kind != parser.LitNumber {
+			return nil, fmt.Errorf("%s needs numbers: got %s", op, written(lit))
+		}
+	}
+	x, errX := strconv.ParseInt(a.Text, 10, 64)
+	y, errY := strconv.ParseInt(b.Text, 10, 64)
+	if errX == nil && errY == nil {
+		n, ok := intArith(op, x, y)
+		if !ok {
+			if op == "/" && y == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return nil, fmt.Errorf("%s %s %s overflows an int", a.Text, op, b.Text)
+		}
+		return &parser.Literal{Kind: parser.LitNumber, Text: strconv.FormatInt(n, 10)}, nil
+	}
+	f, err := strconv.ParseFloat(a.Text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s needs numbers: got %s", op, a.Text)
+	}
+	g, err := strconv.ParseFloat(b.Text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s needs numbers: got %s", op, b.Text)
+	}
+	var r float64
+	switch op {
+	case "+":
+		r = f + g
+	case "-":
+		r = f - g
+	case "*":
+		r = f * g
+	case "/":
+		if g == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		r = f / g
+	}
+	if math.IsInf(r, 0) || math.IsNaN(r) {
+		return nil, fmt.Errorf("%s %s %s is out of range", a.Text, op, b.Text)
+	}
+	return &parser.Literal{Kind: parser.LitNumber, Text: formatFloat(r)}, nil
+}
+
+// intArith returns x op y, or false if it overflows or divides by zero
+func intArith(op string, x, y int64) (int64, bool) {
+	switch op {
+	case "+":
+		r := x + y
+		return r, (y > 0) == (r > x) || y == 0
+	case "-":
+		r := x - y
+		return r, (y > 0) == (r < x) || y == 0
+	case "*":
+		r := x * y
+		return r, x == 0 || (r/x == y && !(x == -1 && y == math.MinInt64))
+	case "/":
+		if y == 0 || (x == math.MinInt64 && y == -1) {
+			return 0, false
+		}
+		return x / y, true
+	}
+	return 0, false
+}
+
+// callFunc returns the result of function name called with args
+func callFunc(name string, args []*parser.Literal) (*parser.Literal, error) {
+	switch name {
+	case "coalesce":
+		for _, arg := range args {
+			if arg.Kind != parser.LitNull {
+				return arg, nil
+			}
+		}
+		return nullLiteral(), nil
+	case "concat":
+		// like a missing field, a null adds nothing
+		var b strings.Builder
+		for _, arg := range args {
+			if arg.Kind != parser.LitNull {
+				b.WriteString(arg.Text)
+			}
+		}
+		return &parser.Literal{Kind: parser.LitString, Text: b.String()}, nil
+	}
+	arg := args[0]
+	if arg.Kind == parser.LitNull {
+		return arg, nil
+	}
+	switch name {
+	case "upper":
+		return &parser.Literal{Kind: parser.LitString, Text: strings.ToUpper(arg.Text)}, nil
+	case "lower":
+		return &parser.Literal{Kind: parser.LitString, Text: strings.ToLower(arg.Text)}, nil
+	case "trim":
+		return &parser.Literal{Kind: parser.LitString, Text: strings.TrimSpace(arg.Text)}, nil
+	case "length":
+		n := utf8.RuneCountInString(arg.Text)
+		return &parser.Literal{Kind: parser.LitNumber, Text: strconv.Itoa(n)}, nil
+	case "abs":
+		if arg.Kind != parser.LitNumber {
+			return nil, fmt.Errorf("abs() needs a number: got %s", written(arg))
+		}
+		return &parser.Literal{Kind: parser.LitNumber, Text: strings.TrimPrefix(arg.Text, "-")}, nil
+	}
+	return nil, fmt.Errorf("unknown function %s()", name)
+}
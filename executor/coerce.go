@@ -0,0 +1,191 @@
+package executor
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"grapho/catalog"
+	"grapho/parser"
+)
+
+/* ---------------------- Value coercion ---------------------- */
+
+// Values are stored as text, except for bools and times, so a value written
+// to a declared field is first brought to its type's one spelling: age: 25
+// and age: '25' both store "25", and price: 10.50 stores "10.5". Dates,
+// datetimes and times are stored as a Temporal, which spells them one way
+// too, JSON documents as a JSON, and blobs as a Blob. A value that does not
+// fit the type, such as age: 'abc' or name: 25, is rejected. Arrays,
+// vectors and points are stored as written; the last two are checked by
+// checkVectors and checkPoints. So are undeclared fields, which only a
+// lenient executor takes. A field's DEFAULT must fit its type too, and is
+// stored, in the same spelling, by an INSERT that leaves the field out.
+
+// checkValues rejects values that do not fit the types of their fields
+func (e *Executor) checkValues(typeName string, fields map[string]catalog.FieldSpec, props []parser.Property) error {
+	if err := checkVectors(typeName, fields, props); err != nil {
+		return err
+	}
+	if err := checkPoints(typeName, fields, props); err != nil {
+		return err
+	}
+	for _, p := range props {
+		spec, ok := fields[p.Name]
+		if !ok || p.Value == nil {
+			continue
+		}
+		if _, err := e.coerce(spec.Type, p.Value); err != nil {
+			return &ConstraintError{
+				Type:       typeName,
+				Field:      p.Name,
+				Constraint: "type",
+				msg:        fmt.Sprintf("field '%s' %v", p.Name, err),
+			}
+		}
+	}
+	return nil
+}
+
+// checkDefault rejects a DEFAULT that does not fit the type of its field
+func (e *Executor) checkDefault(fd *parser.FieldDef) error {
+	if fd.Default == nil {
+		return nil
+	}
+	if _, err := e.coerce(convertTypeSpec(fd.Type), fd.Default); err != nil {
+		return fmt.Errorf("DEFAULT of field '%s' %v", fd.Name, err)
+	}
+	return nil
+}
+
+// applyDefaults gives props, the properties of a new node or edge, the
+// default of each field of fields they leave out
+func (e *Executor) applyDefaults(fields map[string]catalog.FieldSpec, props map[string]interface{}) {
+	for name, spec := range fields {
+		if spec.DefaultRaw == nil {
+			continue
+		}
+		if _, ok := props[name]; ok {
+			continue
+		}
+		// the catalog keeps only the text of the literal, which every type
+		// also takes quoted; as in CSV imports, a string field takes null as
+		// the text 'null', and other fields as no default
+		lit := &parser.Literal{Kind: parser.LitString, Text: *spec.DefaultRaw}
+		v, err := e.coerce(spec.Type, lit)
+		if err != nil {
+			if strings.EqualFold(lit.Text, "null") {
+				continue
+			}
+			v = storedValue(lit)
+		}
+		props[intern(name)] = v
+	}
+}
+
+// typedValue returns the value lit stores in the field of fields called
+// name: coerced to its type if it is declared, as written if not
+func (e *Executor) typedValue(fields map[string]catalog.FieldSpec, name string, lit *parser.Literal) interface{} {
+	if spec, ok := fields[name]; ok {
+		if v, err := e.coerce(spec.Type, lit); err == nil {
+			return v
+		}
+	}
+	return storedValue(lit)
+}
+
+// coerce returns the value lit stores in a field of type t, or an error
+// saying what t is and why lit does not fit it
+func (e *Executor) coerce(t catalog.TypeSpec, lit *parser.Literal) (interface{}, error) {
+	if lit.Kind == parser.LitJSON && (t.Base != catalog.BaseJSON || t.Elem != nil) {
+		return nil, fmt.Errorf("is not json: got %s", written(lit))
+	}
+	if lit.Kind == parser.LitBlob && (t.Base != catalog.BaseBlob || t.Elem != nil) {
+		return nil, fmt.Errorf("is not a blob: got %s", written(lit))
+	}
+	if lit.Kind == parser.LitNull || t.Elem != nil || t.Base == catalog.BaseVector || t.Base == catalog.BasePoint {
+		return storedValue(lit), nil
+	}
+	text := strings.TrimSpace(lit.Text)
+	if len(t.EnumVals) > 0 {
+		if lit.Kind == parser.LitBool || !slices.Contains(t.EnumVals, lit.Text) {
+			return nil, fmt.Errorf("is an enum of '%s': got %s", strings.Join(t.EnumVals, "', '"), written(lit))
+		}
+		return storedValue(lit), nil
+	}
+	switch t.Base {
+	case catalog.BaseInt:
+		n, err := strconv.ParseInt(text, 10, 64)
+		if lit.Kind == parser.LitBool || err != nil {
+			return nil, fmt.Errorf("is an int: got %s", written(lit))
+		}
+		return strconv.FormatInt(n, 10), nil
+	case catalog.BaseFloat:
+		f, err := strconv.ParseFloat(text, 64)
+		if lit.Kind == parser.LitBool || err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("is a float: got %s", written(lit))
+		}
+		return formatFloat(f), nil
+	case catalog.BaseBool:
+		switch {
+		case lit.Kind == parser.LitBool:
+			return lit.Text == "true", nil
+		case lit.Kind == parser.LitString && (strings.EqualFold(text, "true") || strings.EqualFold(text, "false")):
+			return strings.EqualFold(text, "true"), nil
+		}
+		return nil, fmt.Errorf("is a bool: got %s", written(lit))
+	case catalog.BaseDate:
+		d, ok := e.parseTemporal(t.Base, text)
+		if lit.Kind != parser.LitString || !ok {
+			return nil, fmt.Errorf("is a date, as in '2024-05-01': got %s", written(lit))
+		}
+		return d, nil
+	case catalog.BaseDateTime:
+		d, ok := e.parseTemporal(t.Base, text)
+		if lit.Kind != parser.LitString || !ok {
+			return nil, fmt.Errorf("is a datetime, as in '2024-05-01T09:30:00Z': got %s", written(lit))
+		}
+		return d, nil
+	case catalog.BaseTime:
+		d, ok := e.parseTemporal(t.Base, text)
+		if lit.Kind != parser.LitString || !ok {
+			return nil, fmt.Errorf("is a time, as in '09:30:00': got %s", written(lit))
+		}
+		return d, nil
+	case catalog.BaseJSON:
+		j, ok := jsonLiteral(lit)
+		if !ok {
+			return nil, fmt.Errorf("is json, as in {\"a\": 1} or '[1, 2]': got %s", written(lit))
+		}
+		return j, nil
+	case catalog.BaseBlob:
+		return e.coerceBlob(lit)
+	}
+	// string, text and uuid
+	if lit.Kind != parser.LitString {
+		return nil, fmt.Errorf("is a string: got %s; quote it as '%s'", written(lit), lit.Text)
+	}
+	return storedValue(lit), nil
+}
+
+// formatFloat spells f as a float field stores it: in plain decimals, unless
+// it is very large or small
+func formatFloat(f float64) string {
+	if a := math.Abs(f); a >= 1e21 || a != 0 && a < 1e-6 {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// written returns lit as it was written, for messages
+func written(lit *parser.Literal) string {
+	switch lit.Kind {
+	case parser.LitString:
+		return "'" + lit.Text + "'"
+	case parser.LitBlob:
+		return "b64'" + lit.Text + "'"
+	}
+	return lit.Text
+}
@@ -0,0 +1,98 @@
+package executor
+
+import (
+	"context"
+	"errors"
+
+	"grapho/parser"
+)
+
+/* ---------------------- Cursors ---------------------- */
+
+// A cursor runs a MATCH on a snapshot, on a goroutine of its own, and hands
+// its rows over a batch at a time as they are asked for, so a result of
+// millions of rows is never projected or held in full. Between batches the
+// MATCH waits; what it has matched but not yet handed over costs only the
+// references to the nodes, which later statements do not change, as they
+// do not change any snapshot. Close stops it.
+
+// Cursor reads the rows of a MATCH in batches. Its rows must not be modified.
+type Cursor struct {
+	rows chan ResultRow
+	stop context.CancelFunc
+	next *ResultRow // read ahead, to tell whether rows remain
+	err  error      // of the MATCH, once rows is closed
+}
+
+// OpenCursor starts stmt, which may not SET or DELETE, and returns a cursor
+// over its rows. Like Snapshot, it must be serialized with statements, but
+// reading the cursor need not be. An error stmt fails with before its first
+// row is returned here.
+func (e *Executor) OpenCursor(ctx context.Context, stmt *parser.MatchStmt) (*Cursor, error) {
+	if Mutates(stmt) {
+		return nil, errors.New("a cursor cannot run a MATCH that sets or deletes")
+	}
+	snap := e.Snapshot()
+	ctx, stop := context.WithCancel(ctx)
+	c := &Cursor{rows: make(chan ResultRow), stop: stop}
+	go func() {
+		defer close(c.rows)
+		c.err = snap.Execute(ctx, &cursorOutput{ctx: ctx, rows: c.rows}, stmt)
+	}()
+	if err := c.advance(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Next returns up to n more rows, and whether any remain after them; Next(0)
+// only reports the latter. Once none remain, it returns no rows.
+func (c *Cursor) Next(n int) ([]ResultRow, bool, error) {
+	var rows []ResultRow
+	for c.next != nil && len(rows) < n {
+		rows = append(rows, *c.next)
+		if err := c.advance(); err != nil {
+			return rows, false, err
+		}
+	}
+	return rows, c.next != nil, nil
+}
+
+// Close stops the MATCH, if it is still running, and waits for it to end.
+// It may be called more than once.
+func (c *Cursor) Close() {
+	c.stop()
+	for range c.rows {
+	}
+	c.next = nil
+}
+
+// advance reads the next row into c.next, leaving it nil at the end
+func (c *Cursor) advance() error {
+	r, ok := <-c.rows
+	if !ok {
+		c.next = nil
+		return c.err
+	}
+	c.next = &r
+	return nil
+}
+
+// cursorOutput passes the rows of a MATCH to its cursor
+type cursorOutput struct {
+	ctx  context.Context
+	rows chan<- ResultRow
+}
+
+func (o *cursorOutput) Message(format string, args ...any) {}
+
+func (o *cursorOutput) ResultSet() {}
+
+func (o *cursorOutput) Row(nodeType, id string, props map[string]interface{}) {
+	// once the cursor is closed the MATCH sees ctx done and stops
+	select {
+	case o.rows <- ResultRow{Type: nodeType, ID: id, Properties: props}:
+	case <-o.ctx.Done():
+	}
+}
@@ -0,0 +1,1409 @@
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"grapho/catalog"
+)
+
+/* ---------------------- Data files ---------------------- */
+
+// A data directory keeps its graph in data files: the GraphStore grapho uses
+// unless given another. The nodes of each type, and the edges of each type,
+// have a file of their own in graph-data.types, with a record per write, so
+// that loading a type reads nothing else and dropping one deletes its file.
+// The data file proper, graph-data.jsonl, holds the catalog, the drops and a
+// commit record per commit, which counts the commit log entries whose
+// changes the files hold and gives the length each file written since the
+// last one has reached; commit log entries after them, written by a command
+// whose records never reached the files, are replayed on top when they are
+// loaded. The commit log stays the record of what is durable, so the files
+// are not synced on each commit, and whatever follows the last complete
+// commit is cut off when they are loaded; only before the file of a dropped
+// type is deleted is the data file synced, so that the drop is not lost
+// with it. A data directory from before data files is loaded from its
+// commit log and written out to new ones, and one from before type files,
+// whose records are all in graph-data.jsonl, is loaded from it until the
+// next snapshot.
+// The files only grow, one record per change, until they are rewritten with
+// a record per node and edge instead: a snapshot. Once a snapshot is in
+// place, the commit log entries it holds may be cut from the log. With
+// SetSegments, a snapshot puts the nodes in data segments; see segment.go.
+// Each record starts with a CRC (Castagnoli) of the record without it, so
+// that a record that changed on disk is told apart from one cut short by a
+// crash: a bad record followed by good ones is corrupt, not torn. Records
+// from before checksums are taken as they are, until the first one with a
+// checksum.
+
+// DataFileName is the name of the data file in a data directory
+const DataFileName = "graph-data.jsonl"
+
+// TypeDirName is the directory of a data directory the files of each node
+// and edge type are in
+const TypeDirName = "graph-data.types"
+
+// ErrCorrupt is returned when graph data on disk fails its checksum or
+// cannot be read back
+var ErrCorrupt = errors.New("graph data is corrupt")
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// DataFile is the data file of a data directory, and the files of its types
+type DataFile struct {
+	path      string
+	file      *os.File
+	w         *bufio.Writer        // set by Load
+	entries   int                  // commit log entries covered by the last commit record
+	nextID    int64                // recorded by the last commit record
+	cat       *catalog.Catalog     // the last written
+	types     map[string]*typeFile // by typeKey
+	drops     map[string]int       // times each type was dropped; see DataSnapshot
+	gone      []string             // files of types dropped since the last commit
+	segments  bool                 // see SetSegments
+	onCorrupt func(error)          // see SetOnCorrupt
+	size      int64                // of the data file, with what is not written out yet
+	committed int64                // of the data file up to its last commit record
+}
+
+// typeState is where the data of a type is, as commit records give it
+type typeState struct {
+	Segment string `json:"segment,omitempty"` // with the nodes the file writes over
+	File    string `json:"file,omitempty"`
+	Size    int64  `json:"size,omitempty"` // of the file
+}
+
+// dropKey returns the typeKey of the type a drop record drops
+func dropKey(rec dataRecord) string {
+	if rec.Op == opDropEdges {
+		return typeKey("e", rec.Type)
+	}
+	return typeKey("n", rec.Type)
+}
+
+// typeFile is the file of a type, open for writing once it is written to
+type typeFile struct {
+	typeState
+	file  *os.File
+	w     *bufio.Writer
+	dirty bool // written since the last commit
+}
+
+// typeKey keys the files of the nodes of name if kind is "n", or of the
+// edges if it is "e"
+func typeKey(kind, name string) string {
+	return kind + "/" + name
+}
+
+// dataRecord is one line of a data file
+type dataRecord struct {
+	Op      string                     `json:"op"`
+	Type    string                     `json:"type,omitempty"`
+	ID      string                     `json:"id,omitempty"`
+	From    string                     `json:"from,omitempty"`
+	To      string                     `json:"to,omitempty"`
+	Props   map[string]json.RawMessage `json:"props,omitempty"`
+	Catalog *catalog.Catalog           `json:"catalog,omitempty"`
+	NextID  int64                      `json:"next_id,omitempty"`
+	Entries int                        `json:"entries,omitempty"`
+	File    string                     `json:"file,omitempty"`
+	Files   map[string]typeState       `json:"files,omitempty"` // by typeKey, those written since the last commit
+}
+
+// the ops of data records
+const (
+	opPutNode    = "put_node"
+	opDeleteNode = "delete_node"
+	opPutEdge    = "put_edge"
+	opDeleteEdge = "delete_edge"
+	opDropNodes  = "drop_nodes"
+	opDropEdges  = "drop_edges"
+	opCatalog    = "catalog"
+	opCommit     = "commit"
+	opSegment    = "segment" // in data files from before type files
+)
+
+// OpenDataFile opens the data file of the data directory dir, creating both
+// if need be
+func OpenDataFile(dir string) (*DataFile, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("mkdir data dir: %w", err)
+	}
+	p := filepath.Join(dir, DataFileName)
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open data file: %w", err)
+	}
+	return &DataFile{path: p, file: f, types: make(map[string]*typeFile), drops: make(map[string]int)}, nil
+}
+
+// SetSegments makes snapshots put the nodes of each type in a data segment
+// rather than write a record of each, or stops them doing so. Data files are
+// loaded with their segments either way.
+func (df *DataFile) SetSegments(on bool) {
+	df.segments = on
+}
+
+// SetOnCorrupt makes Load skip corrupt records, and corrupt nodes of data
+// segments, calling fn with each, rather than fail with ErrCorrupt. What
+// they held is lost. A nil fn restores the default.
+func (df *DataFile) SetOnCorrupt(fn func(error)) {
+	df.onCorrupt = fn
+}
+
+// segmentDir returns the directory of the data segments of the data file
+func (df *DataFile) segmentDir() string {
+	return filepath.Join(filepath.Dir(df.path), SegmentDirName)
+}
+
+// typeDir returns the directory of the type files of the data file
+func (df *DataFile) typeDir() string {
+	return filepath.Join(filepath.Dir(df.path), TypeDirName)
+}
+
+// Entries returns the number of commit log entries whose changes the data
+// file holds
+func (df *DataFile) Entries() int {
+	return df.entries
+}
+
+// Close writes out and syncs the data file and the type files, and closes
+// them
+func (df *DataFile) Close() error {
+	if df.file == nil {
+		return nil
+	}
+	var err error
+	for _, tf := range df.types {
+		if cerr := tf.close(true); err == nil {
+			err = cerr
+		}
+	}
+	f := df.file
+	df.file = nil
+	if df.w != nil && err == nil {
+		err = df.w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// close closes the file of tf, if it is open, first writing it out and
+// syncing it if keep is set
+func (tf *typeFile) close(keep bool) error {
+	if tf.file == nil {
+		return nil
+	}
+	f := tf.file
+	tf.file = nil
+	var err error
+	if keep {
+		if err = tf.w.Flush(); err == nil {
+			err = f.Sync()
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Load reads the data file up to its last commit record, and then the type
+// files up to the lengths it gives, cutting off what follows, and leaves
+// them to be written after that
+func (df *DataFile) Load(ctx context.Context, w GraphWriter) (int64, error) {
+	if df.file == nil {
+		return 0, errors.New("data file is closed")
+	}
+	end, err := df.scan(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := df.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(io.LimitReader(df.file, end))
+	var (
+		pending []dataRecord
+		nextID  int64
+		segs    []string // the segments loaded
+		checked bool     // a record with a checksum was read
+		files   = make(map[string]typeState)
+	)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("read data file: %w", err)
+		}
+		rec, err := decodeRecord(line, &checked)
+		if err != nil {
+			continue // reported by scan
+		}
+		if rec.Op != opCommit {
+			pending = append(pending, rec)
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		for _, rec := range pending {
+			var err error
+			switch rec.Op {
+			case opSegment:
+				err = df.loadSegment(ctx, w, rec.Type, rec.File)
+				segs = append(segs, rec.File)
+			case opDropNodes, opDropEdges:
+				delete(files, dropKey(rec))
+				err = apply(w, rec)
+			case opCatalog:
+				df.cat = rec.Catalog
+				err = apply(w, rec)
+			default:
+				err = apply(w, rec)
+			}
+			if err != nil {
+				return 0, fmt.Errorf("data file: %w", err)
+			}
+		}
+		pending = pending[:0]
+		for key, st := range rec.Files {
+			files[key] = st
+		}
+		nextID, df.entries = rec.NextID, rec.Entries
+	}
+	if err := df.file.Truncate(end); err != nil {
+		return 0, fmt.Errorf("truncate data file: %w", err)
+	}
+	if _, err := df.file.Seek(end, io.SeekStart); err != nil {
+		return 0, err
+	}
+	df.w = bufio.NewWriterSize(df.file, 64<<10)
+	df.size, df.committed = end, end
+
+	// the nodes, then the edges
+	keys := sortedKeys(files)
+	slices.SortStableFunc(keys, func(a, b string) int { return -strings.Compare(a[:1], b[:1]) })
+	for _, key := range keys {
+		st := files[key]
+		if st.Segment != "" {
+			if err := df.loadSegment(ctx, w, key[2:], st.Segment); err != nil {
+				return 0, fmt.Errorf("data file: %w", err)
+			}
+			segs = append(segs, st.Segment)
+		}
+		tf, err := df.loadTypeFile(ctx, w, key, st)
+		if err != nil {
+			return 0, fmt.Errorf("data file: %w", err)
+		}
+		df.types[key] = tf
+	}
+	df.nextID = nextID
+	// those of a snapshot that was never put in place, or of dropped types
+	removeSegments(df.segmentDir(), segs)
+	df.removeTypeFiles()
+	return nextID, nil
+}
+
+// scan reads the data file through, reporting the corrupt records, and
+// returns its length up to the last commit record whose type files hold all
+// it says they do. The type files are written out along with the data file
+// but not synced, and so may have lost writes it kept if the machine
+// crashed; the commit log replays them then.
+func (df *DataFile) scan(ctx context.Context) (int64, error) {
+	if _, err := df.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(df.file)
+	var (
+		pos, good int64 // past what has been read, and the last whole commit
+		bad       []error
+		checked   bool
+		files     = make(map[string]typeState)
+		short     = make(map[string]bool)  // types whose file is shorter than given
+		sizes     = make(map[string]int64) // of the type files by name; -1 if missing
+	)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break // a torn last line is cut off with the rest
+		}
+		if err != nil {
+			return 0, fmt.Errorf("read data file: %w", err)
+		}
+		rec, err := decodeRecord(line, &checked)
+		if err != nil {
+			bad = append(bad, fmt.Errorf("%w: data file record at byte %d: %v", ErrCorrupt, pos, err))
+		}
+		pos += int64(len(line))
+		if err != nil {
+			continue // a torn tail if nothing good follows
+		}
+		if len(bad) > 0 {
+			if err := df.corrupt(bad); err != nil {
+				return 0, err
+			}
+			bad = bad[:0]
+		}
+		switch rec.Op {
+		case opDropNodes, opDropEdges:
+			delete(files, dropKey(rec))
+			delete(short, dropKey(rec))
+		case opCommit:
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+			for key, st := range rec.Files {
+				files[key] = st
+				if st.File == "" {
+					delete(short, key)
+					continue
+				}
+				size, ok := sizes[st.File]
+				if !ok {
+					size = -1
+					if info, err := os.Stat(filepath.Join(df.typeDir(), filepath.Base(st.File))); err == nil {
+						size = info.Size()
+					}
+					sizes[st.File] = size
+				}
+				if st.Size > max(size, 0) {
+					short[key] = true
+				} else {
+					delete(short, key)
+				}
+			}
+			if len(short) == 0 {
+				good = pos
+			}
+		}
+	}
+	return good, nil
+}
+
+// loadTypeFile writes the records of the type file of key, as st gives it,
+// to w and opens it to be written after them
+func (df *DataFile) loadTypeFile(ctx context.Context, w GraphWriter, key string, st typeState) (*typeFile, error) {
+	tf := &typeFile{typeState: st}
+	if st.File == "" {
+		return tf, nil
+	}
+	if st.File != filepath.Base(st.File) {
+		return nil, fmt.Errorf("bad type file name %q", st.File)
+	}
+	f, err := os.OpenFile(filepath.Join(df.typeDir(), st.File), os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		if st.Size > 0 {
+			err = df.corrupt([]error{fmt.Errorf("%w: type file %s is missing", ErrCorrupt, st.File)})
+		} else {
+			err = nil // created, but never written out
+		}
+		tf.File, tf.Size = "", 0
+		return tf, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open type file: %w", err)
+	}
+	var (
+		r       = bufio.NewReader(io.LimitReader(f, st.Size))
+		pos     int64
+		bad     []error
+		checked = true
+	)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if pos < st.Size {
+				bad = append(bad, fmt.Errorf("%w: type file %s ends at byte %d, before its last commit at %d", ErrCorrupt, st.File, pos, st.Size))
+			}
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("read type file: %w", err)
+		}
+		if len(bad) == 0 && pos%(64<<10) < int64(len(line)) {
+			if err := ctx.Err(); err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
+		rec, err := decodeRecord(line, &checked)
+		if err == nil {
+			err = apply(w, rec)
+			if err != nil {
+				f.Close()
+				return nil, fmt.Errorf("type file %s: %w", st.File, err)
+			}
+		} else {
+			bad = append(bad, fmt.Errorf("%w: type file %s record at byte %d: %v", ErrCorrupt, st.File, pos, err))
+		}
+		pos += int64(len(line))
+	}
+	if len(bad) > 0 {
+		if err := df.corrupt(bad); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	tf.Size = pos
+	if err := f.Truncate(pos); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("truncate type file: %w", err)
+	}
+	if _, err := f.Seek(pos, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	tf.file, tf.w = f, bufio.NewWriter(f)
+	return tf, nil
+}
+
+// removeTypeFiles removes the files in the type directory no type has
+func (df *DataFile) removeTypeFiles() {
+	var keep []string
+	for _, tf := range df.types {
+		keep = append(keep, tf.File)
+	}
+	entries, err := os.ReadDir(df.typeDir())
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".jsonl") && !slices.Contains(keep, e.Name()) {
+			os.Remove(filepath.Join(df.typeDir(), e.Name()))
+		}
+	}
+}
+
+// corrupt reports errs, the records or nodes found corrupt, to the function
+// SetOnCorrupt gave, or returns the first if there is none
+func (df *DataFile) corrupt(errs []error) error {
+	if df.onCorrupt == nil {
+		if len(errs) > 1 {
+			return fmt.Errorf("%w (and %d more)", errs[0], len(errs)-1)
+		}
+		return errs[0]
+	}
+	for _, err := range errs {
+		df.onCorrupt(err)
+	}
+	return nil
+}
+
+// decodeRecord reads a line of a data file, checking its checksum. A line
+// without one is read as is unless checked is set, and sets it if it has one.
+func decodeRecord(line []byte, checked *bool) (dataRecord, error) {
+	var rec dataRecord
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	if bytes.HasPrefix(line, []byte(crcPrefix)) && len(line) > len(crcPrefix)+10 && string(line[len(crcPrefix)+8:len(crcPrefix)+10]) == `",` {
+		want, err := strconv.ParseUint(string(line[len(crcPrefix):len(crcPrefix)+8]), 16, 32)
+		if err != nil {
+			return rec, errors.New("bad checksum")
+		}
+		// the record as it was checksummed: without the crc key
+		body := line[len(crcPrefix)+9:]
+		body[0] = '{'
+		if crc32.Checksum(body, crcTable) != uint32(want) {
+			return rec, errors.New("checksum mismatch")
+		}
+		line, *checked = body, true
+	} else if *checked {
+		return rec, errors.New("no checksum")
+	}
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return rec, err
+	}
+	return rec, nil
+}
+
+// crcPrefix begins each data file record, followed by its checksum in hex
+const crcPrefix = `{"crc":"`
+
+// segmentLoader is a GraphWriter that takes the nodes of a segment all at
+// once; others are given them one by one
+type segmentLoader interface {
+	// putSegment takes the nodes of seg but those in bad
+	putSegment(nodeType string, seg *segment, bad []int) error
+}
+
+// loadSegment writes the nodes of nodeType in the segment named name to w
+func (df *DataFile) loadSegment(ctx context.Context, w GraphWriter, nodeType, name string) error {
+	if name != filepath.Base(name) {
+		return fmt.Errorf("bad segment name %q", name)
+	}
+	seg, err := openSegment(filepath.Join(df.segmentDir(), name))
+	if errors.Is(err, ErrCorrupt) && df.onCorrupt != nil {
+		df.onCorrupt(fmt.Errorf("%w; skipped the %s nodes in it", err, nodeType))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var (
+		bad  []int
+		errs []error
+	)
+	err = seg.verify(ctx, func(i int, err error) {
+		bad = append(bad, i)
+		errs = append(errs, fmt.Errorf("%w: segment %s: node %q: %v", ErrCorrupt, seg.name, seg.idBytes(i), err))
+	})
+	if err == nil && len(errs) > 0 {
+		err = df.corrupt(errs)
+	}
+	if err != nil {
+		return err
+	}
+	if sl, ok := w.(segmentLoader); ok {
+		return sl.putSegment(nodeType, seg, bad)
+	}
+	for i := range seg.Len() {
+		if slices.Contains(bad, i) {
+			continue
+		}
+		props, err := seg.props(i)
+		if err == nil {
+			err = w.PutNode(nodeType, seg.id(i), props)
+		}
+		if err != nil {
+			return fmt.Errorf("segment %s: node %s: %w", seg.name, seg.id(i), err)
+		}
+	}
+	return nil
+}
+
+// apply writes rec, a catalog, node, edge or drop record, to w
+func apply(w GraphWriter, rec dataRecord) error {
+	switch rec.Op {
+	case opCatalog:
+		if rec.Catalog == nil {
+			return errors.New("catalog record without a catalog")
+		}
+		return w.PutCatalog(rec.Catalog)
+	case opPutNode:
+		props, err := decodeProps(rec.Props)
+		if err != nil {
+			return fmt.Errorf("node %s: %w", rec.ID, err)
+		}
+		return w.PutNode(rec.Type, rec.ID, props)
+	case opDeleteNode:
+		return w.DeleteNode(rec.Type, rec.ID)
+	case opPutEdge:
+		props, err := decodeProps(rec.Props)
+		if err != nil {
+			return fmt.Errorf("edge %s: %w", rec.ID, err)
+		}
+		return w.PutEdge(rec.Type, EdgeInstance{ID: rec.ID, FromNodeID: rec.From, ToNodeID: rec.To, Properties: props})
+	case opDeleteEdge:
+		return w.DeleteEdge(rec.Type, rec.ID)
+	case opDropNodes:
+		return w.DropNodes(rec.Type)
+	case opDropEdges:
+		return w.DropEdges(rec.Type)
+	}
+	return fmt.Errorf("unknown record op %q", rec.Op)
+}
+
+// appendRecord writes rec to w, checksummed, and returns its length
+func appendRecord(w *bufio.Writer, rec dataRecord) (int, error) {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := fmt.Fprintf(w, "%s%08x\",", crcPrefix, crc32.Checksum(b, crcTable))
+	m, _ := w.Write(b[1:])
+	if err := w.WriteByte('\n'); err != nil {
+		return 0, err
+	}
+	return n + m + 1, nil
+}
+
+// loaded returns an error unless the data file is open and loaded
+func (df *DataFile) loaded() error {
+	if df.file == nil {
+		return errors.New("data file is closed")
+	}
+	if df.w == nil {
+		return errors.New("data file is not loaded")
+	}
+	return nil
+}
+
+// write appends rec to the data file
+func (df *DataFile) write(rec dataRecord) error {
+	if err := df.loaded(); err != nil {
+		return err
+	}
+	n, err := appendRecord(df.w, rec)
+	df.size += int64(n)
+	return err
+}
+
+// writeType appends rec to the file of its node type if kind is "n", or of
+// its edge type if it is "e", creating the file if need be
+func (df *DataFile) writeType(kind string, rec dataRecord) error {
+	if err := df.loaded(); err != nil {
+		return err
+	}
+	key := typeKey(kind, rec.Type)
+	tf := df.types[key]
+	if tf == nil {
+		tf = &typeFile{}
+		df.types[key] = tf
+	}
+	if tf.file == nil {
+		if err := tf.create(df.typeDir(), kind, rec.Type); err != nil {
+			return err
+		}
+	}
+	n, err := appendRecord(tf.w, rec)
+	tf.Size += int64(n)
+	tf.dirty = true
+	return err
+}
+
+// create gives tf a new, empty file in dir for the type of kind named name
+func (tf *typeFile) create(dir, kind, name string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("mkdir type dir: %w", err)
+	}
+	prefix := "node-"
+	if kind == "e" {
+		prefix = "edge-"
+	}
+	f, err := os.CreateTemp(dir, prefix+name+"-*.jsonl")
+	if err != nil {
+		return fmt.Errorf("create type file: %w", err)
+	}
+	tf.file, tf.w = f, bufio.NewWriterSize(f, 16<<10)
+	tf.File, tf.Size = filepath.Base(f.Name()), 0
+	return nil
+}
+
+func (df *DataFile) PutCatalog(cat *catalog.Catalog) error {
+	if err := df.write(dataRecord{Op: opCatalog, Catalog: cat}); err != nil {
+		return err
+	}
+	df.cat = cat
+	return nil
+}
+
+func (df *DataFile) PutNode(nodeType, id string, props map[string]interface{}) error {
+	raw, err := encodeProps(props)
+	if err != nil {
+		return err
+	}
+	return df.writeType("n", dataRecord{Op: opPutNode, Type: nodeType, ID: id, Props: raw})
+}
+
+func (df *DataFile) DeleteNode(nodeType, id string) error {
+	return df.writeType("n", dataRecord{Op: opDeleteNode, Type: nodeType, ID: id})
+}
+
+func (df *DataFile) PutEdge(edgeType string, edge EdgeInstance) error {
+	raw, err := encodeProps(edge.Properties)
+	if err != nil {
+		return err
+	}
+	return df.writeType("e", dataRecord{Op: opPutEdge, Type: edgeType, ID: edge.ID, From: edge.FromNodeID, To: edge.ToNodeID, Props: raw})
+}
+
+func (df *DataFile) DeleteEdge(edgeType, id string) error {
+	return df.writeType("e", dataRecord{Op: opDeleteEdge, Type: edgeType, ID: id})
+}
+
+// DropNodes records the drop and lets go of the file of the nodes of
+// nodeType, and their segment, which Commit deletes
+func (df *DataFile) DropNodes(nodeType string) error {
+	return df.drop(dataRecord{Op: opDropNodes, Type: nodeType})
+}
+
+// DropEdges records the drop and lets go of the file of the edges of
+// edgeType, which Commit deletes
+func (df *DataFile) DropEdges(edgeType string) error {
+	return df.drop(dataRecord{Op: opDropEdges, Type: edgeType})
+}
+
+func (df *DataFile) drop(rec dataRecord) error {
+	if err := df.write(rec); err != nil {
+		return err
+	}
+	key := dropKey(rec)
+	df.drops[key]++
+	tf := df.types[key]
+	if tf == nil {
+		return nil
+	}
+	delete(df.types, key)
+	tf.close(false)
+	if tf.File != "" {
+		df.gone = append(df.gone, filepath.Join(df.typeDir(), tf.File))
+	}
+	if tf.Segment != "" {
+		df.gone = append(df.gone, filepath.Join(df.segmentDir(), tf.Segment))
+	}
+	return nil
+}
+
+// Commit writes out the type files written since the last commit, then a
+// commit record with their lengths, without syncing them. Only if a type was
+// dropped is the data file synced, before its files are deleted.
+func (df *DataFile) Commit(nextID int64, entries int) error {
+	if err := df.loaded(); err != nil {
+		return err
+	}
+	var files map[string]typeState
+	for key, tf := range df.types {
+		if !tf.dirty {
+			continue
+		}
+		if err := tf.w.Flush(); err != nil {
+			return err
+		}
+		if files == nil {
+			files = make(map[string]typeState)
+		}
+		files[key] = tf.typeState
+	}
+	if err := df.write(dataRecord{Op: opCommit, NextID: nextID, Entries: entries, Files: files}); err != nil {
+		return err
+	}
+	if err := df.w.Flush(); err != nil {
+		return err
+	}
+	for key := range files {
+		df.types[key].dirty = false
+	}
+	df.entries, df.nextID, df.committed = entries, nextID, df.size
+	if len(df.gone) == 0 {
+		return nil
+	}
+	if err := df.file.Sync(); err != nil {
+		return err
+	}
+	for _, p := range df.gone {
+		os.Remove(p)
+	}
+	df.gone = nil
+	return nil
+}
+
+/* ---------------------- Reading data files ---------------------- */
+
+// A data file keeps no index of what it holds, so reading a type from it
+// replays the records of that type as of the last commit: those in the data
+// file, then its segment and its file, into a typeReader. That costs as much
+// as the records of the type, which is why queries read the graph in memory
+// instead; reading a data file is for tools that look at a store unloaded
+// into an executor, and for comparing the two. Corrupt records are skipped,
+// as Load reported them.
+
+// ScanType replays the nodes of nodeType
+func (df *DataFile) ScanType(ctx context.Context, nodeType string, fn func(id string, props map[string]interface{}) bool) error {
+	tr, err := df.readType(ctx, "n", nodeType)
+	if err != nil {
+		return err
+	}
+	for id, props := range tr.nodes {
+		if !fn(id, props) {
+			break
+		}
+	}
+	return nil
+}
+
+// Neighbors replays the edges of edgeType
+func (df *DataFile) Neighbors(ctx context.Context, edgeType, id string, in bool, fn func(inst *EdgeInstance) bool) error {
+	tr, err := df.readType(ctx, "e", edgeType)
+	if err != nil {
+		return err
+	}
+	for i := range tr.edges {
+		inst := &tr.edges[i]
+		end := inst.FromNodeID
+		if in {
+			end = inst.ToNodeID
+		}
+		if !inst.Deleted() && end == id && !fn(inst) {
+			break
+		}
+	}
+	return nil
+}
+
+// readType replays the nodes of the type named name if kind is "n", or its
+// edges if it is "e"
+func (df *DataFile) readType(ctx context.Context, kind, name string) (*typeReader, error) {
+	if err := df.loaded(); err != nil {
+		return nil, err
+	}
+	key := typeKey(kind, name)
+	tr := &typeReader{nodes: make(map[string]map[string]interface{}), at: make(map[string]int)}
+	r := bufio.NewReader(io.NewSectionReader(df.file, 0, df.committed))
+	var (
+		pending []dataRecord
+		st      typeState // of the type, as of the commit records read
+		checked bool
+	)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read data file: %w", err)
+		}
+		rec, err := decodeRecord(line, &checked)
+		if err != nil {
+			continue
+		}
+		if rec.Op != opCommit {
+			if recordKey(rec) == key {
+				pending = append(pending, rec)
+			}
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for _, rec := range pending {
+			var err error
+			switch rec.Op {
+			case opSegment:
+				err = df.readSegment(ctx, tr, name, rec.File)
+			case opDropNodes, opDropEdges:
+				st = typeState{}
+				err = apply(tr, rec)
+			default:
+				err = apply(tr, rec)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("data file: %w", err)
+			}
+		}
+		pending = pending[:0]
+		if s, ok := rec.Files[key]; ok {
+			st = s
+		}
+	}
+	if st.Segment != "" {
+		if err := df.readSegment(ctx, tr, name, st.Segment); err != nil {
+			return nil, fmt.Errorf("data file: %w", err)
+		}
+	}
+	if st.File == "" {
+		return tr, nil
+	}
+	f, err := os.Open(filepath.Join(df.typeDir(), filepath.Base(st.File)))
+	if errors.Is(err, os.ErrNotExist) {
+		return tr, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open type file: %w", err)
+	}
+	defer f.Close()
+	r = bufio.NewReader(io.LimitReader(f, st.Size))
+	checked = true
+	for n := 0; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read type file: %w", err)
+		}
+		if n%scanCheckEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if rec, err := decodeRecord(line, &checked); err == nil {
+			if err := apply(tr, rec); err != nil {
+				return nil, fmt.Errorf("type file %s: %w", st.File, err)
+			}
+		}
+	}
+	return tr, nil
+}
+
+// recordKey returns the typeKey of the type a node or edge record is of, or
+// "" for other records
+func recordKey(rec dataRecord) string {
+	switch rec.Op {
+	case opPutNode, opDeleteNode, opDropNodes, opSegment:
+		return typeKey("n", rec.Type)
+	case opPutEdge, opDeleteEdge, opDropEdges:
+		return typeKey("e", rec.Type)
+	}
+	return ""
+}
+
+// readSegment writes the nodes of nodeType in the segment named name to w
+func (df *DataFile) readSegment(ctx context.Context, w GraphWriter, nodeType, name string) error {
+	seg, err := openSegment(filepath.Join(df.segmentDir(), filepath.Base(name)))
+	if errors.Is(err, ErrCorrupt) && df.onCorrupt != nil {
+		return nil // skipped by Load
+	}
+	if err != nil {
+		return err
+	}
+	for i := range seg.Len() {
+		if i%scanCheckEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		if props, err := seg.props(i); err == nil {
+			if err := w.PutNode(nodeType, seg.id(i), props); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// typeReader is the GraphWriter the records of a type are replayed into
+type typeReader struct {
+	nodes map[string]map[string]interface{}
+	edges []EdgeInstance
+	at    map[string]int // index of each edge in edges
+}
+
+func (tr *typeReader) PutCatalog(*catalog.Catalog) error { return nil }
+
+func (tr *typeReader) PutNode(_, id string, props map[string]interface{}) error {
+	tr.nodes[id] = props
+	return nil
+}
+
+func (tr *typeReader) DeleteNode(_, id string) error {
+	delete(tr.nodes, id)
+	return nil
+}
+
+func (tr *typeReader) PutEdge(_ string, edge EdgeInstance) error {
+	if i, ok := tr.at[edge.ID]; ok {
+		tr.edges[i] = edge
+		return nil
+	}
+	tr.at[edge.ID] = len(tr.edges)
+	tr.edges = append(tr.edges, edge)
+	return nil
+}
+
+func (tr *typeReader) DeleteEdge(_, id string) error {
+	if i, ok := tr.at[id]; ok {
+		tr.edges[i] = EdgeInstance{}
+		delete(tr.at, id)
+	}
+	return nil
+}
+
+func (tr *typeReader) DropNodes(string) error {
+	clear(tr.nodes)
+	return nil
+}
+
+func (tr *typeReader) DropEdges(string) error {
+	tr.edges = nil
+	clear(tr.at)
+	return nil
+}
+
+// DataSnapshot is a data file, and the files of its types, being rewritten
+// whole; see Executor.SnapshotData
+type DataSnapshot struct {
+	df      *DataFile
+	view    *Executor // the catalog and graph as they were
+	entries int
+	from    map[string]snapFrom  // the type files as of SnapshotData, by typeKey
+	types   map[string]*typeFile // those Write wrote, until installed
+	written bool
+}
+
+// snapFrom is where the writes to a type after SnapshotData begin
+type snapFrom struct {
+	file  string
+	size  int64
+	drops int // see DataFile.drops
+}
+
+// SnapshotData begins rewriting the data file, and the files of its types, as
+// a single record of each node and edge, which they then hold in place of
+// their history. Like CommitData it must be serialized with statements, and
+// so must Install, but Write need not be: it writes from a snapshot of the
+// graph, and Install copies whatever was committed meanwhile over to the new
+// files before putting them in place. Only a data file can be rewritten so.
+func (e *Executor) SnapshotData() (*DataSnapshot, error) {
+	if e.store == nil {
+		return nil, errors.New("no data file is loaded")
+	}
+	df, ok := e.store.(*DataFile)
+	if !ok {
+		return nil, fmt.Errorf("cannot snapshot a %T", e.store)
+	}
+	if err := df.loaded(); err != nil {
+		return nil, err
+	}
+	s := &DataSnapshot{df: df, view: e.Snapshot(), entries: df.entries, from: make(map[string]snapFrom), types: make(map[string]*typeFile)}
+	g := s.view.graph
+	for _, key := range slices.Concat(prefixKeys("n", g.Nodes), prefixKeys("e", g.Edges)) {
+		from := snapFrom{drops: df.drops[key]}
+		if tf := df.types[key]; tf != nil {
+			from.file, from.size = tf.File, tf.Size
+		}
+		s.from[key] = from
+	}
+	return s, nil
+}
+
+// prefixKeys returns the typeKey of kind of each key of m
+func prefixKeys[V any](kind string, m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for name := range m {
+		keys = append(keys, typeKey(kind, name))
+	}
+	return keys
+}
+
+// Entries returns the number of commit log entries whose changes the snapshot
+// holds
+func (s *DataSnapshot) Entries() int {
+	return s.entries
+}
+
+// Write writes a new file for each type of the snapshot, and a segment
+// for each node type with SetSegments
+func (s *DataSnapshot) Write() error {
+	df, g := s.df, s.view.graph
+	s.written = true
+	for _, nodeType := range sortedKeys(g.Nodes) {
+		tf := &typeFile{}
+		s.types[typeKey("n", nodeType)] = tf
+		if err := tf.create(df.typeDir(), "n", nodeType); err != nil {
+			return err
+		}
+		set := g.Nodes[nodeType]
+		if df.segments && set.Len() > 0 {
+			name, err := writeSegment(df.segmentDir(), nodeType, set)
+			if err != nil {
+				return fmt.Errorf("node type %s: %w", nodeType, err)
+			}
+			tf.Segment = name
+			continue
+		}
+		var err error
+		set.Range(func(id string, props map[string]interface{}) bool {
+			var raw map[string]json.RawMessage
+			if raw, err = encodeProps(props); err == nil {
+				err = tf.write(dataRecord{Op: opPutNode, Type: nodeType, ID: id, Props: raw})
+			}
+			if err != nil {
+				err = fmt.Errorf("node %s: %w", id, err)
+			}
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, edgeType := range sortedKeys(g.Edges) {
+		tf := &typeFile{}
+		s.types[typeKey("e", edgeType)] = tf
+		if err := tf.create(df.typeDir(), "e", edgeType); err != nil {
+			return err
+		}
+		for _, inst := range g.Edges[edgeType] {
+			if inst.Deleted() {
+				continue
+			}
+			raw, err := encodeProps(inst.Properties)
+			if err == nil {
+				err = tf.write(dataRecord{Op: opPutEdge, Type: edgeType, ID: inst.ID, From: inst.FromNodeID, To: inst.ToNodeID, Props: raw})
+			}
+			if err != nil {
+				return fmt.Errorf("edge %s: %w", inst.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// write appends rec to the file of tf
+func (tf *typeFile) write(rec dataRecord) error {
+	n, err := appendRecord(tf.w, rec)
+	tf.Size += int64(n)
+	return err
+}
+
+// Install copies the records committed since SnapshotData to the files
+// Write wrote, syncs them, and puts them in place of the type files, with a
+// data file of just the catalog and a commit record in place of the data
+// file. A type dropped since SnapshotData keeps the files it has now. As the
+// snapshot then cuts the commit log, the one commit record must not name a
+// file longer than it is on disk, so the files of types created since
+// SnapshotData are synced too, and so are the directories.
+func (s *DataSnapshot) Install() error {
+	df := s.df
+	if !s.written {
+		return errors.New("snapshot was not written")
+	}
+	if err := df.loaded(); err != nil {
+		return err
+	}
+	if err := df.w.Flush(); err != nil {
+		return err
+	}
+	types := maps.Clone(df.types)
+	var installed []string
+	for key, tf := range s.types {
+		from := s.from[key]
+		if df.drops[key] != from.drops {
+			continue // its data is gone
+		}
+		if cur := df.types[key]; cur != nil && cur.file != nil {
+			if err := cur.w.Flush(); err != nil {
+				return err
+			}
+			start := int64(0)
+			if cur.File == from.file {
+				start = from.size
+			}
+			n, err := io.Copy(tf.w, io.NewSectionReader(cur.file, start, cur.Size-start))
+			if err != nil {
+				return fmt.Errorf("copy to snapshot: %w", err)
+			}
+			tf.Size += n
+		}
+		if err := tf.w.Flush(); err != nil {
+			return err
+		}
+		if err := tf.file.Sync(); err != nil {
+			return err
+		}
+		types[key] = tf
+		installed = append(installed, key)
+	}
+	for key, tf := range types {
+		if tf.file == nil || slices.Contains(installed, key) {
+			continue
+		}
+		if err := tf.w.Flush(); err != nil {
+			return err
+		}
+		if err := tf.file.Sync(); err != nil {
+			return err
+		}
+	}
+	for _, dir := range []string{df.typeDir(), df.segmentDir()} {
+		if err := syncDir(dir); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(df.path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+	states := make(map[string]typeState, len(types))
+	for key, tf := range types {
+		states[key] = tf.typeState
+	}
+	w := bufio.NewWriter(f)
+	var size int
+	if df.cat != nil {
+		size, err = appendRecord(w, dataRecord{Op: opCatalog, Catalog: df.cat})
+	}
+	if err == nil {
+		var n int
+		n, err = appendRecord(w, dataRecord{Op: opCommit, NextID: df.nextID, Entries: df.entries, Files: states})
+		size += n
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), df.path)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	df.file.Close()
+	df.file = f
+	df.w.Reset(f)
+	df.size, df.committed = int64(size), int64(size)
+
+	for _, key := range installed {
+		if cur := df.types[key]; cur != nil {
+			cur.close(false)
+		}
+		delete(s.types, key)
+	}
+	df.types, df.gone = types, nil
+	for _, tf := range types {
+		tf.dirty = false
+	}
+	var segs []string
+	for _, tf := range types {
+		if tf.Segment != "" {
+			segs = append(segs, tf.Segment)
+		}
+	}
+	removeSegments(df.segmentDir(), segs)
+	df.removeTypeFiles()
+	s.Abort() // the files of types dropped meanwhile
+	// the rename, before the commit log is cut
+	return syncDir(filepath.Dir(df.path))
+}
+
+// Abort drops the files the snapshot wrote but did not install
+func (s *DataSnapshot) Abort() {
+	for key, tf := range s.types {
+		tf.close(false)
+		if tf.File != "" {
+			os.Remove(filepath.Join(s.df.typeDir(), tf.File))
+		}
+		if tf.Segment != "" {
+			os.Remove(filepath.Join(s.df.segmentDir(), tf.Segment))
+		}
+		delete(s.types, key)
+	}
+}
+
+// encodeProps spells the values of props in JSON; see encodeValue
+func encodeProps(props map[string]interface{}) (map[string]json.RawMessage, error) {
+	out := make(map[string]json.RawMessage, len(props))
+	for name, v := range props {
+		raw, err := encodeValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("field '%s': %w", name, err)
+		}
+		out[name] = raw
+	}
+	return out, nil
+}
+
+// encodeValue spells v, a stored value, in JSON: a string, bool or null as
+// itself, and a value of another type as an object whose one key names it,
+// such as {"date":"2024-05-01"}
+func encodeValue(v interface{}) (json.RawMessage, error) {
+	var x any
+	switch v := v.(type) {
+	case nil, string, bool:
+		x = v
+	case Temporal:
+		x = map[string]string{temporalTag(v.base): v.String()}
+	case JSON:
+		x = map[string]json.RawMessage{"json": json.RawMessage(v.String())}
+	case Blob:
+		x = map[string]string{"blob": v.String()}
+	default:
+		return nil, fmt.Errorf("cannot store a %T", v)
+	}
+	return json.Marshal(x)
+}
+
+// decodeProps reads back what encodeProps wrote
+func decodeProps(raw map[string]json.RawMessage) (map[string]interface{}, error) {
+	props := make(map[string]interface{}, len(raw))
+	for name, r := range raw {
+		v, err := decodeValue(r)
+		if err != nil {
+			return nil, fmt.Errorf("field '%s': %w", name, err)
+		}
+		props[intern(name)] = v
+	}
+	return props, nil
+}
+
+// decodeValue reads back a value encodeValue wrote
+func decodeValue(raw json.RawMessage) (interface{}, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+		var v any
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+		switch v.(type) {
+		case nil, string, bool:
+			return v, nil
+		}
+		return nil, fmt.Errorf("unexpected value %s", raw)
+	}
+	var tagged map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &tagged); err != nil {
+		return nil, err
+	}
+	if len(tagged) != 1 {
+		return nil, fmt.Errorf("unexpected value %s", raw)
+	}
+	var (
+		tag  string
+		r    json.RawMessage
+		text string
+	)
+	for tag, r = range tagged {
+	}
+	if tag == "json" {
+		j, err := parseJSON(string(r))
+		if err != nil {
+			return nil, err
+		}
+		return j, nil
+	}
+	if err := json.Unmarshal(r, &text); err != nil {
+		return nil, err
+	}
+	if tag == "blob" {
+		b, ok := decodeBase64(text)
+		if !ok {
+			return nil, fmt.Errorf("bad blob %q", text)
+		}
+		return Blob{data: string(b)}, nil
+	}
+	for _, base := range []catalog.BaseType{catalog.BaseDate, catalog.BaseTime, catalog.BaseDateTime} {
+		if tag != temporalTag(base) {
+			continue
+		}
+		v, ok := parseTemporal(base, text, nil)
+		if !ok {
+			return nil, fmt.Errorf("bad %s %q", tag, text)
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("unknown value type %q", tag)
+}
+
+// temporalTag names base, a temporal type, in a data file
+func temporalTag(base catalog.BaseType) string {
+	switch base {
+	case catalog.BaseDate:
+		return "date"
+	case catalog.BaseTime:
+		return "time"
+	}
+	return "datetime"
+}
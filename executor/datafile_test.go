@@ -0,0 +1,95 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"grapho/catalog"
+)
+
+// openData returns an executor with the catalog and data file of dir
+// loaded, and the data file
+func openData(t *testing.T, dir string) (*Executor, *DataFile) {
+	t.Helper()
+	df, err := OpenDataFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { df.Close() })
+	return load(t, dir, df), df
+}
+
+// load returns an executor with the catalog of dir and the graph of st
+// loaded
+func load(t *testing.T, dir string, st GraphStore) *Executor {
+	t.Helper()
+	ctx := context.Background()
+	store, err := catalog.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, err := catalog.Open(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := New(reg)
+	if err := e.LoadData(ctx, st); err != nil {
+		t.Fatalf("load %s: %v", dir, err)
+	}
+	return e
+}
+
+// run executes script and commits its changes as commit log entry entries
+func run(t *testing.T, e *Executor, entries int, script string) {
+	t.Helper()
+	if err := e.ExecuteScript(context.Background(), nil, script); err != nil {
+		t.Fatalf("%s: %v", script, err)
+	}
+	if err := e.CommitData(entries); err != nil {
+		t.Fatalf("commit %d: %v", entries, err)
+	}
+}
+
+func TestDataSnapshotInstall(t *testing.T) {
+	dir := t.TempDir()
+	e, df := openData(t, dir)
+	run(t, e, 1, "CREATE NODE A (name: string PRIMARY KEY); INSERT NODE A (name: 'x');")
+
+	snap, err := e.SnapshotData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.Write(); err != nil {
+		t.Fatal(err)
+	}
+	// between the two, a type the snapshot did not write comes and goes to
+	// its own file, and the one it wrote gets more
+	run(t, e, 2, "CREATE NODE B (name: string PRIMARY KEY); INSERT NODE B (name: 'b'); INSERT NODE A (name: 'y');")
+	if err := snap.Install(); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	if snap.Entries() != 1 || df.Entries() != 2 {
+		t.Errorf("snapshot of %d entries installed in a data file of %d, want 1 and 2", snap.Entries(), df.Entries())
+	}
+	// the one commit record left names every type file at its length on disk
+	if len(df.types) != 2 {
+		t.Errorf("data file has %d types, want A and B", len(df.types))
+	}
+	for key, tf := range df.types {
+		info, err := os.Stat(filepath.Join(df.typeDir(), tf.File))
+		if err != nil || info.Size() != tf.Size {
+			t.Errorf("%s: file %s is %v, %v; the commit record says %d bytes", key, tf.File, info, err, tf.Size)
+		}
+	}
+	if err := df.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	e, _ = openData(t, dir)
+	g := e.Graph()
+	if g.Nodes["A"].Len() != 2 || g.Nodes["B"].Len() != 1 {
+		t.Errorf("reloaded %d A and %d B nodes, want 2 and 1", g.Nodes["A"].Len(), g.Nodes["B"].Len())
+	}
+}
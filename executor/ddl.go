@@ -0,0 +1,487 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"grapho/catalog"
+	"grapho/parser"
+)
+
+// executeCreateNode executes a CREATE NODE statement
+func (e *Executor) executeCreateNode(ctx context.Context, stmt *parser.CreateNodeStmt) error {
+	// Convert parser types to catalog types
+	fields := make([]catalog.FieldPayload, len(stmt.Fields))
+
+	for i, field := range stmt.Fields {
+		if err := e.checkDefault(&field); err != nil {
+			return err
+		}
+		fields[i] = catalog.FieldPayload{
+			Name:       field.Name,
+			Type:       convertTypeSpec(field.Type),
+			PrimaryKey: field.PrimaryKey,
+			Unique:     field.Unique,
+			Index:      field.Index,
+			NotNull:    field.NotNull,
+			TTL:        field.TTL,
+		}
+
+		if field.Default != nil {
+			defaultVal := field.Default.Text
+			fields[i].DefaultRaw = &defaultVal
+		}
+	}
+
+	payload := catalog.CreateNodePayload{
+		Name:   stmt.Name,
+		Fields: fields,
+	}
+
+	_, err := e.registry.Apply(ctx, catalog.DDLEvent{
+		Op:   catalog.OpCreateNode,
+		Stmt: payload,
+	})
+	return err
+}
+
+// executeCreateEdge executes a CREATE EDGE statement
+func (e *Executor) executeCreateEdge(ctx context.Context, stmt *parser.CreateEdgeStmt) error {
+	// Convert parser types to catalog types
+	props := make([]catalog.FieldPayload, len(stmt.Props))
+
+	for i, prop := range stmt.Props {
+		if err := e.checkDefault(&prop); err != nil {
+			return err
+		}
+		if err := checkNotIndexed(&prop); err != nil {
+			return err
+		}
+		props[i] = catalog.FieldPayload{
+			Name:    prop.Name,
+			Type:    convertTypeSpec(prop.Type),
+			Unique:  prop.Unique,
+			NotNull: prop.NotNull,
+			TTL:     prop.TTL,
+		}
+
+		if prop.Default != nil {
+			defaultVal := prop.Default.Text
+			props[i].DefaultRaw = &defaultVal
+		}
+	}
+
+	payload := catalog.CreateEdgePayload{
+		Name: stmt.Name,
+		From: catalog.EdgeEndpoint{
+			Label: stmt.From.Label,
+			Card:  convertCardinality(stmt.From.Card),
+		},
+		To: catalog.EdgeEndpoint{
+			Label: stmt.To.Label,
+			Card:  convertCardinality(stmt.To.Card),
+		},
+		Props: props,
+	}
+
+	_, err := e.registry.Apply(ctx, catalog.DDLEvent{
+		Op:   catalog.OpCreateEdge,
+		Stmt: payload,
+	})
+	return err
+}
+
+// executeAlterNode executes an ALTER NODE statement
+func (e *Executor) executeAlterNode(ctx context.Context, stmt *parser.AlterNodeStmt) error {
+	var action catalog.NodeAlterAction
+
+	switch stmt.Action {
+	case parser.AlterAddField:
+		if err := e.checkDefault(stmt.Field); err != nil {
+			return err
+		}
+		if stmt.Field.NotNull {
+			if err := e.checkFilled(stmt.Name, stmt.Field.Name, false); err != nil {
+				return err
+			}
+		}
+		action.Type = "ADD_FIELD"
+		action.Field = &catalog.FieldPayload{
+			Name:    stmt.Field.Name,
+			Type:    convertTypeSpec(stmt.Field.Type),
+			Unique:  stmt.Field.Unique,
+			Index:   stmt.Field.Index,
+			NotNull: stmt.Field.NotNull,
+			TTL:     stmt.Field.TTL,
+		}
+		if stmt.Field.Default != nil {
+			defaultVal := stmt.Field.Default.Text
+			action.Field.DefaultRaw = &defaultVal
+		}
+	case parser.AlterDropField:
+		action.Type = "DROP_FIELD"
+		action.FieldName = stmt.FieldName
+	case parser.AlterModifyField:
+		if err := e.checkDefault(stmt.Field); err != nil {
+			return err
+		}
+		if stmt.Field.NotNull {
+			if err := e.checkFilled(stmt.Name, stmt.Field.Name, false); err != nil {
+				return err
+			}
+		}
+		action.Type = "MODIFY_FIELD"
+		action.Field = &catalog.FieldPayload{
+			Name:    stmt.Field.Name,
+			Type:    convertTypeSpec(stmt.Field.Type),
+			Unique:  stmt.Field.Unique,
+			Index:   stmt.Field.Index,
+			NotNull: stmt.Field.NotNull,
+			TTL:     stmt.Field.TTL,
+		}
+		if stmt.Field.Default != nil {
+			defaultVal := stmt.Field.Default.Text
+			action.Field.DefaultRaw = &defaultVal
+		}
+	case parser.AlterSetPrimaryKey:
+		action.Type = "SET_PRIMARY_KEY"
+		action.FieldName = strings.Join(stmt.PkFields, ",")
+	default:
+		return fmt.Errorf("unsupported alter node action: %v", stmt.Action)
+	}
+
+	payload := catalog.AlterNodePayload{
+		Name:    stmt.Name,
+		Actions: []catalog.NodeAlterAction{action},
+	}
+
+	if _, err := e.registry.Apply(ctx, catalog.DDLEvent{
+		Op:   catalog.OpAlterNode,
+		Stmt: payload,
+	}); err != nil {
+		return err
+	}
+	// the index of a field is in the order of its type, so the next lookup
+	// that needs it builds it afresh
+	if set := e.graph.Nodes[stmt.Name]; set != nil && action.Type != "SET_PRIMARY_KEY" {
+		field := action.FieldName
+		if action.Field != nil {
+			field = action.Field.Name
+		}
+		delete(set.indexes, field)
+	}
+	return nil
+}
+
+// checkFilled rejects making field of the nodes, or edges if edge is set, of
+// typ NOT NULL while some have no value for it. A DEFAULT does not count, as
+// it is only given to what is inserted later.
+func (e *Executor) checkFilled(typ, field string, edge bool) error {
+	kind, missing := "node", 0
+	if edge {
+		kind = "edge"
+		for _, inst := range e.graph.Edges[typ] {
+			if !inst.Deleted() && inst.Properties[field] == nil {
+				missing++
+			}
+		}
+	} else if nodes := e.graph.Nodes[typ]; nodes != nil {
+		nodes.Range(func(_ string, props map[string]interface{}) bool {
+			if props[field] == nil {
+				missing++
+			}
+			return true
+		})
+	}
+	if missing == 0 {
+		return nil
+	}
+	return &ConstraintError{
+		Type:       typ,
+		Field:      field,
+		Constraint: "NOT NULL",
+		msg:        fmt.Sprintf("%d %s(s) of type '%s' have no value for field '%s'; set one before making it NOT NULL", missing, kind, typ, field),
+	}
+}
+
+// checkCardinalities rejects giving the edges of edgeType the endpoints
+// from and to while a node has more of them than an endpoint declared ONE
+// allows; see checkCardinality
+func (e *Executor) checkCardinalities(edgeType string, from, to catalog.EdgeEndpoint) error {
+	if from.Card != catalog.One && to.Card != catalog.One {
+		return nil
+	}
+	adj := e.graph.adjacency(edgeType)
+	for _, end := range []struct {
+		one, other catalog.EdgeEndpoint
+		edges      map[string][]int
+		name       string
+	}{{to, from, adj.out, "TO"}, {from, to, adj.in, "FROM"}} {
+		if end.one.Card != catalog.One {
+			continue
+		}
+		over := 0
+		for _, at := range end.edges {
+			if len(at) > 1 {
+				over++
+			}
+		}
+		if over > 0 {
+			return &ConstraintError{
+				Type:       edgeType,
+				Constraint: end.name + " cardinality",
+				msg:        fmt.Sprintf("%d %s node(s) have more than one %s edge; delete the extra before making %s %s ONE", over, end.other.Label, edgeType, end.name, end.one.Label),
+			}
+		}
+	}
+	return nil
+}
+
+// checkNotIndexed rejects INDEX on prop, a property of an edge type; only
+// node fields have indexes
+func checkNotIndexed(prop *parser.FieldDef) error {
+	if prop.Index {
+		return fmt.Errorf("edge property '%s' cannot be INDEX; only node fields are indexed", prop.Name)
+	}
+	return nil
+}
+
+// executeAlterEdge executes an ALTER EDGE statement
+func (e *Executor) executeAlterEdge(ctx context.Context, stmt *parser.AlterEdgeStmt) error {
+	var action catalog.EdgeAlterAction
+
+	switch stmt.Action {
+	case parser.AlterAddProp:
+		if err := e.checkDefault(stmt.Prop); err != nil {
+			return err
+		}
+		if err := checkNotIndexed(stmt.Prop); err != nil {
+			return err
+		}
+		if stmt.Prop.NotNull {
+			if err := e.checkFilled(stmt.Name, stmt.Prop.Name, true); err != nil {
+				return err
+			}
+		}
+		action.Type = "ADD_PROP"
+		action.Prop = &catalog.FieldPayload{
+			Name:    stmt.Prop.Name,
+			Type:    convertTypeSpec(stmt.Prop.Type),
+			Unique:  stmt.Prop.Unique,
+			NotNull: stmt.Prop.NotNull,
+			TTL:     stmt.Prop.TTL,
+		}
+		if stmt.Prop.Default != nil {
+			defaultVal := stmt.Prop.Default.Text
+			action.Prop.DefaultRaw = &defaultVal
+		}
+	case parser.AlterDropProp:
+		action.Type = "DROP_PROP"
+		action.PropName = stmt.PropName
+	case parser.AlterModifyProp:
+		if err := e.checkDefault(stmt.Prop); err != nil {
+			return err
+		}
+		if err := checkNotIndexed(stmt.Prop); err != nil {
+			return err
+		}
+		if stmt.Prop.NotNull {
+			if err := e.checkFilled(stmt.Name, stmt.Prop.Name, true); err != nil {
+				return err
+			}
+		}
+		action.Type = "MODIFY_PROP"
+		action.Prop = &catalog.FieldPayload{
+			Name:    stmt.Prop.Name,
+			Type:    convertTypeSpec(stmt.Prop.Type),
+			Unique:  stmt.Prop.Unique,
+			NotNull: stmt.Prop.NotNull,
+			TTL:     stmt.Prop.TTL,
+		}
+		if stmt.Prop.Default != nil {
+			defaultVal := stmt.Prop.Default.Text
+			action.Prop.DefaultRaw = &defaultVal
+		}
+	case parser.AlterSetEndpoints:
+		et, ok := e.registry.Current().Edges[stmt.Name]
+		if !ok {
+			return notFound("edge type '%s' does not exist", stmt.Name)
+		}
+		from, to := et.From, et.To
+		var actions []catalog.EdgeAlterAction
+		if stmt.From != nil {
+			from = catalog.EdgeEndpoint{Label: stmt.From.Label, Card: convertCardinality(stmt.From.Card)}
+			actions = append(actions, catalog.EdgeAlterAction{Type: "CHANGE_ENDPOINT", Endpoint: "FROM", NewEndpoint: &from})
+		}
+		if stmt.To != nil {
+			to = catalog.EdgeEndpoint{Label: stmt.To.Label, Card: convertCardinality(stmt.To.Card)}
+			actions = append(actions, catalog.EdgeAlterAction{Type: "CHANGE_ENDPOINT", Endpoint: "TO", NewEndpoint: &to})
+		}
+		if !e.replaying {
+			if err := e.checkCardinalities(stmt.Name, from, to); err != nil {
+				return err
+			}
+		}
+		_, err := e.registry.Apply(ctx, catalog.DDLEvent{
+			Op:   catalog.OpAlterEdge,
+			Stmt: catalog.AlterEdgePayload{Name: stmt.Name, Actions: actions},
+		})
+		return err
+	default:
+		return fmt.Errorf("unsupported alter edge action: %v", stmt.Action)
+	}
+
+	payload := catalog.AlterEdgePayload{
+		Name:    stmt.Name,
+		Actions: []catalog.EdgeAlterAction{action},
+	}
+
+	_, err := e.registry.Apply(ctx, catalog.DDLEvent{
+		Op:   catalog.OpAlterEdge,
+		Stmt: payload,
+	})
+	return err
+}
+
+// executeDropNode executes a DROP NODE statement
+func (e *Executor) executeDropNode(ctx context.Context, stmt *parser.DropNodeStmt) error {
+	payload := catalog.DropNodePayload{
+		Name: stmt.Name,
+	}
+
+	if _, err := e.registry.Apply(ctx, catalog.DDLEvent{
+		Op:   catalog.OpDropNode,
+		Stmt: payload,
+	}); err != nil {
+		return err
+	}
+	e.graph.dropNodes(stmt.Name)
+	return nil
+}
+
+// executeDropEdge executes a DROP EDGE statement
+func (e *Executor) executeDropEdge(ctx context.Context, stmt *parser.DropEdgeStmt) error {
+	payload := catalog.DropEdgePayload{
+		Name: stmt.Name,
+	}
+
+	if _, err := e.registry.Apply(ctx, catalog.DDLEvent{
+		Op:   catalog.OpDropEdge,
+		Stmt: payload,
+	}); err != nil {
+		return err
+	}
+	e.graph.dropEdges(stmt.Name)
+	return nil
+}
+
+// executeCreateFulltextIndex executes a CREATE FULLTEXT INDEX statement,
+// indexing the nodes already stored
+func (e *Executor) executeCreateFulltextIndex(ctx context.Context, stmt *parser.CreateFulltextIndexStmt) error {
+	payload := catalog.FulltextIndexPayload{
+		NodeType: stmt.NodeType,
+		Fields:   stmt.Fields,
+		Stem:     stmt.Stem,
+	}
+
+	if _, err := e.registry.Apply(ctx, catalog.DDLEvent{
+		Op:   catalog.OpCreateFulltext,
+		Stmt: payload,
+	}); err != nil {
+		return err
+	}
+	if set := e.graph.Nodes[stmt.NodeType]; set != nil {
+		for _, f := range stmt.Fields {
+			set.buildTextIndex(e.graph.epoch, f, stmt.Stem)
+		}
+	}
+	return nil
+}
+
+// executeDropFulltextIndex executes a DROP FULLTEXT INDEX statement
+func (e *Executor) executeDropFulltextIndex(ctx context.Context, stmt *parser.DropFulltextIndexStmt) error {
+	payload := catalog.FulltextIndexPayload{
+		NodeType: stmt.NodeType,
+		Fields:   stmt.Fields,
+	}
+
+	if _, err := e.registry.Apply(ctx, catalog.DDLEvent{
+		Op:   catalog.OpDropFulltext,
+		Stmt: payload,
+	}); err != nil {
+		return err
+	}
+	if set := e.graph.Nodes[stmt.NodeType]; set != nil {
+		for _, f := range stmt.Fields {
+			delete(set.text, f)
+		}
+	}
+	return nil
+}
+
+// Helper functions to convert between parser and catalog types
+
+func convertTypeSpec(t parser.TypeSpec) catalog.TypeSpec {
+	spec := catalog.TypeSpec{
+		Base: convertBaseType(t.Base),
+	}
+
+	if t.Elem != nil {
+		elem := convertTypeSpec(*t.Elem)
+		spec.Elem = &elem
+	}
+
+	spec.Dim = t.Dim
+
+	if len(t.EnumVals) > 0 {
+		spec.EnumVals = make([]string, len(t.EnumVals))
+		copy(spec.EnumVals, t.EnumVals)
+	}
+
+	return spec
+}
+
+func convertBaseType(bt parser.BaseType) catalog.BaseType {
+	switch bt {
+	case parser.BaseString:
+		return catalog.BaseString
+	case parser.BaseText:
+		return catalog.BaseText
+	case parser.BaseInt:
+		return catalog.BaseInt
+	case parser.BaseFloat:
+		return catalog.BaseFloat
+	case parser.BaseBool:
+		return catalog.BaseBool
+	case parser.BaseUUID:
+		return catalog.BaseUUID
+	case parser.BaseDate:
+		return catalog.BaseDate
+	case parser.BaseTime:
+		return catalog.BaseTime
+	case parser.BaseDateTime:
+		return catalog.BaseDateTime
+	case parser.BaseJSON:
+		return catalog.BaseJSON
+	case parser.BaseBlob:
+		return catalog.BaseBlob
+	case parser.BaseVector:
+		return catalog.BaseVector
+	case parser.BasePoint:
+		return catalog.BasePoint
+	default:
+		return catalog.BaseString // fallback
+	}
+}
+
+func convertCardinality(c parser.Cardinality) catalog.Cardinality {
+	switch c {
+	case parser.CardOne:
+		return catalog.One
+	case parser.CardMany:
+		return catalog.Many
+	default:
+		return catalog.One // fallback
+	}
+}
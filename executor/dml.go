@@ -0,0 +1,1036 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"grapho/catalog"
+	"grapho/parser"
+)
+
+/* ---------------------- DML execution methods ---------------------- */
+
+// Simple in-memory data store for demonstration
+// In a real implementation, this would be a proper graph database
+type GraphData struct {
+	Nodes  map[string]*NodeSet       // nodeType -> nodes by ID
+	Edges  map[string][]EdgeInstance // edgeType -> list of edge instances
+	NextID int64                     // Simple ID generator
+
+	partitions int               // per node type; see SetPartitions
+	epoch      uint64            // bumped by Snapshot; see NodeSet.epochs
+	edgeEpochs map[string]uint64 // like NodeSet.epochs, per edge type
+	adj        map[string]*adjacency
+	dead       map[string]int // tombstones by edge type; see adjacency.go
+	changes    *dataChanges   // since the last CommitData; nil without a store
+	view       bool           // a snapshot's; see Snapshot
+}
+
+type EdgeInstance struct {
+	ID         string
+	FromNodeID string
+	ToNodeID   string
+	Properties map[string]interface{}
+}
+
+// Deleted reports whether inst is the tombstone of a deleted edge, which
+// readers of GraphData.Edges skip
+func (inst *EdgeInstance) Deleted() bool {
+	return inst.ID == ""
+}
+
+// EdgeCount returns the number of edges of edgeType, not counting
+// tombstones
+func (g *GraphData) EdgeCount(edgeType string) int {
+	return len(g.Edges[edgeType]) - g.dead[edgeType]
+}
+
+func newGraphData() *GraphData {
+	return &GraphData{
+		Nodes:      make(map[string]*NodeSet),
+		Edges:      make(map[string][]EdgeInstance),
+		NextID:     1,
+		partitions: DefaultPartitions,
+		edgeEpochs: make(map[string]uint64),
+		adj:        make(map[string]*adjacency),
+		dead:       make(map[string]int),
+	}
+}
+
+// executeInsertNode executes an INSERT NODE statement
+func (e *Executor) executeInsertNode(out Output, stmt *parser.InsertNodeStmt) error {
+	// Validate node type exists in catalog
+	cat := e.registry.Current()
+	nodeType, exists := cat.Nodes[stmt.NodeType]
+	if !exists {
+		return notFound("node type '%s' does not exist", stmt.NodeType)
+	}
+	if err := e.checkValues(stmt.NodeType, nodeType.Fields, stmt.Properties); err != nil {
+		return err
+	}
+	if stmt.OnConflict != nil {
+		if err := e.checkMergeSets(stmt.NodeType, nodeType.Fields, nil, stmt.OnConflict.Set); err != nil {
+			return err
+		}
+	}
+	// Build properties
+	properties := make(map[string]interface{})
+	for _, prop := range stmt.Properties {
+		properties[intern(prop.Name)] = e.typedValue(nodeType.Fields, prop.Name, prop.Value)
+	}
+	e.applyDefaults(nodeType.Fields, properties)
+	key, generated := generateKey(nodeType, properties)
+	if err := checkNotNull(stmt.NodeType, nodeType.Fields, properties); err != nil {
+		return err
+	}
+	if stmt.OnConflict != nil {
+		if id, ok := e.conflicting(stmt.NodeType, nodeType, properties); ok {
+			return e.onConflict(out, stmt, nodeType, id)
+		}
+	}
+	next := e.graph.NextID
+	nodeID, err := e.newNodeID(stmt.NodeType, nodeType, properties)
+	if err != nil {
+		return err
+	}
+	// Initialize storage for this node type
+	if e.graph.Nodes[stmt.NodeType] == nil {
+		e.graph.Nodes[intern(stmt.NodeType)] = newNodeSet(e.graph.epoch, e.graph.partitions, nodeType.PK)
+	}
+	properties["_id"] = nodeID
+	if err := e.checkUnique(stmt.NodeType, map[string]map[string]interface{}{nodeID: properties}); err != nil {
+		// give the ID back: replay never sees this insert
+		e.graph.NextID = next
+		return err
+	}
+	// Store the node
+	e.graph.Nodes[stmt.NodeType].put(e.graph.epoch, nodeID, properties)
+	e.graph.nodeWritten(stmt.NodeType, nodeID)
+	if generated {
+		e.key = key
+	}
+	changed(out, Change{NodesInserted: 1, IDs: []string{nodeID}}, "Node inserted with ID: %s", nodeID)
+	return nil
+}
+
+// checkNotNull rejects props, the properties a new node or edge of typ is
+// about to be stored with, if they leave a NOT NULL field of fields out or
+// null
+func checkNotNull(typ string, fields map[string]catalog.FieldSpec, props map[string]interface{}) error {
+	for _, name := range sortedKeys(fields) {
+		if v, ok := props[name]; fields[name].NotNull && v == nil {
+			return nullError(typ, name, ok)
+		}
+	}
+	return nil
+}
+
+// nullError reports that NOT NULL field of typ is left out, or set to null
+// if set
+func nullError(typ, field string, set bool) error {
+	msg := fmt.Sprintf("required field '%s' is missing", field)
+	if set {
+		msg = fmt.Sprintf("required field '%s' cannot be null", field)
+	}
+	return &ConstraintError{Type: typ, Field: field, Constraint: "NOT NULL", msg: msg}
+}
+
+// onConflict does the ON CONFLICT of stmt, whose node would have shared a
+// key with node id
+func (e *Executor) onConflict(out Output, stmt *parser.InsertNodeStmt, nt *catalog.NodeType, id string) error {
+	if stmt.OnConflict.Update {
+		nodes := e.graph.Nodes[stmt.NodeType]
+		old, _ := nodes.Get(id)
+		set := stmt.OnConflict.Set
+		if len(set) == 0 {
+			set = stmt.Properties
+		}
+		sc := &whereScope{fields: nt.Fields}
+		written, err := e.updateHits(stmt.NodeType, nodes, []scanHit{{id, old}}, sc, set)
+		if err != nil {
+			return err
+		}
+		changed(out, Change{NodesUpdated: 1, UpdatedIDs: hitIDs(written)}, "Node exists with ID: %s; updated", id)
+		return nil
+	}
+	if out != nil {
+		out.Message("Node exists with ID: %s; not inserted", id)
+	}
+	return nil
+}
+
+// newNodeID returns the ID of a new node of nodeType with properties: the
+// value of its primary key, or the next generated ID if the type has none
+func (e *Executor) newNodeID(nodeType string, nt *catalog.NodeType, properties map[string]interface{}) (string, error) {
+	if nt.PK == "" {
+		id := strconv.FormatInt(e.graph.NextID, 10)
+		e.graph.NextID++
+		return id, nil
+	}
+	id, ok := partitionKey(properties[nt.PK])
+	if !ok || id == "" {
+		return "", &ConstraintError{
+			Type:       nodeType,
+			Field:      nt.PK,
+			Constraint: "PRIMARY KEY",
+			msg:        fmt.Sprintf("primary key '%s' is missing", nt.PK),
+		}
+	}
+	if set := e.graph.Nodes[nodeType]; set != nil {
+		// a node from before the type had its key keeps its generated ID
+		if _, taken := set.Get(id); taken {
+			return "", uniqueError(nodeType, nt, nt.PK, id, id)
+		}
+	}
+	return id, nil
+}
+
+// movedNodes returns the new IDs of the nodes of nodeType writes, their
+// properties to store by ID, change the primary key of, by old ID. A node
+// inserted before the type had its key keeps its ID.
+func (e *Executor) movedNodes(nodeType string, writes map[string]map[string]interface{}) (map[string]string, error) {
+	nt, ok := e.registry.Current().Nodes[nodeType]
+	set := e.graph.Nodes[nodeType]
+	if !ok || nt.PK == "" || set == nil {
+		return nil, nil
+	}
+	var moved map[string]string
+	for _, id := range sortedKeys(writes) {
+		old, _ := set.Get(id)
+		if was, _ := partitionKey(old[nt.PK]); was != id {
+			continue
+		}
+		to, ok := partitionKey(writes[id][nt.PK])
+		if !ok || to == "" {
+			return nil, &ConstraintError{
+				Type:       nodeType,
+				Field:      nt.PK,
+				Constraint: "PRIMARY KEY",
+				msg:        fmt.Sprintf("primary key '%s' of node %s cannot be null", nt.PK, id),
+			}
+		}
+		if to == id {
+			continue
+		}
+		// checkUnique has ruled out another node with the key, but not one
+		// from before the key whose generated ID it is
+		if _, taken := set.Get(to); taken && writes[to] == nil {
+			return nil, uniqueError(nodeType, nt, nt.PK, to, to)
+		}
+		if moved == nil {
+			moved = make(map[string]string)
+		}
+		moved[id] = to
+	}
+	return moved, nil
+}
+
+// storeNodes stores writes, the properties of nodes of nodeType by ID, moving
+// the nodes in moved, and the edges at them, to their new IDs
+func (e *Executor) storeNodes(nodeType string, writes map[string]map[string]interface{}, moved map[string]string) {
+	set := e.graph.Nodes[nodeType]
+	// take the moved nodes out first, so that two may swap keys
+	for id := range moved {
+		set.delete(e.graph.epoch, id)
+		e.graph.nodeWritten(nodeType, id)
+	}
+	for id, props := range writes {
+		if to, ok := moved[id]; ok {
+			props["_id"] = to
+			id = to
+		}
+		set.put(e.graph.epoch, id, props)
+		e.graph.nodeWritten(nodeType, id)
+	}
+	if len(moved) == 0 {
+		return
+	}
+	cat := e.registry.Current()
+	for _, edgeType := range sortedKeys(e.graph.Edges) {
+		et, ok := cat.Edges[edgeType]
+		if !ok || et.From.Label != nodeType && et.To.Label != nodeType {
+			continue
+		}
+		hit := slices.ContainsFunc(e.graph.Edges[edgeType], func(inst EdgeInstance) bool {
+			_, from := moved[inst.FromNodeID]
+			_, to := moved[inst.ToNodeID]
+			return from && et.From.Label == nodeType || to && et.To.Label == nodeType
+		})
+		if !hit {
+			continue
+		}
+		edges := e.graph.ownEdges(edgeType)
+		for i := range edges {
+			from, to := edges[i].FromNodeID, edges[i].ToNodeID
+			if id, ok := moved[from]; ok && et.From.Label == nodeType {
+				edges[i].FromNodeID = id
+			}
+			if id, ok := moved[to]; ok && et.To.Label == nodeType {
+				edges[i].ToNodeID = id
+			}
+			if edges[i].FromNodeID != from || edges[i].ToNodeID != to {
+				e.graph.edgeWritten(edgeType, edges[i].ID, i)
+			}
+		}
+		e.graph.setEdges(edgeType, edges)
+	}
+}
+
+// executeInsertEdge executes an INSERT EDGE statement
+func (e *Executor) executeInsertEdge(out Output, stmt *parser.InsertEdgeStmt) error {
+	// Validate edge type exists
+	cat := e.registry.Current()
+	edgeType, exists := cat.Edges[stmt.EdgeType]
+	if !exists {
+		return notFound("edge type '%s' does not exist", stmt.EdgeType)
+	}
+	if err := e.checkValues(stmt.EdgeType, edgeType.Props, stmt.Properties); err != nil {
+		return err
+	}
+	// Resolve endpoints
+	fromNodeID, err := e.findNodeID(stmt.FromNode)
+	if err != nil {
+		return fmt.Errorf("FROM node not found: %w", err)
+	}
+	toNodeID, err := e.findNodeID(stmt.ToNode)
+	if err != nil {
+		return fmt.Errorf("TO node not found: %w", err)
+	}
+	if err := checkEndpoints(stmt.EdgeType, edgeType, stmt.FromNode, stmt.ToNode); err != nil {
+		return err
+	}
+	if err := e.checkCardinality(stmt.EdgeType, edgeType, fromNodeID, toNodeID); err != nil {
+		return err
+	}
+	// Properties
+	properties := make(map[string]interface{})
+	for _, prop := range stmt.Properties {
+		properties[intern(prop.Name)] = e.typedValue(edgeType.Props, prop.Name, prop.Value)
+	}
+	e.applyDefaults(edgeType.Props, properties)
+	if err := checkNotNull(stmt.EdgeType, edgeType.Props, properties); err != nil {
+		return err
+	}
+	// the ID is taken only once the edge is sure to be stored, so that
+	// replay, which never sees a failed insert, hands out the same ones
+	edgeID := fmt.Sprintf("edge_%d", e.graph.NextID)
+	if err := e.checkEdgeUnique(stmt.EdgeType, map[string]map[string]interface{}{edgeID: properties}); err != nil {
+		return err
+	}
+	e.graph.NextID++
+	edge := EdgeInstance{ID: edgeID, FromNodeID: fromNodeID, ToNodeID: toNodeID, Properties: properties}
+	e.graph.addEdge(stmt.EdgeType, edge)
+	changed(out, Change{EdgesInserted: 1, IDs: []string{edgeID}}, "Edge inserted with ID: %s", edgeID)
+	return nil
+}
+
+// checkCardinality rejects a new edge of edgeType from fromID to toID if an
+// endpoint declared ONE would get a second one: with TO ONE, each FROM node
+// has at most one edge of the type, and with FROM ONE each TO node. Replay
+// skips it, as commit logs written before ONE was enforced, when it was
+// already the default, may hold edges it would refuse.
+func (e *Executor) checkCardinality(edgeType string, et *catalog.EdgeType, fromID, toID string) error {
+	if e.replaying || et.To.Card != catalog.One && et.From.Card != catalog.One {
+		return nil
+	}
+	adj := e.graph.adjacency(edgeType)
+	if et.To.Card == catalog.One && len(adj.out[fromID]) > 0 {
+		return &ConstraintError{
+			Type:       edgeType,
+			Constraint: "TO cardinality",
+			msg:        fmt.Sprintf("%s node %s already has a %s edge, and TO %s is ONE", et.From.Label, fromID, edgeType, et.To.Label),
+		}
+	}
+	if et.From.Card == catalog.One && len(adj.in[toID]) > 0 {
+		return &ConstraintError{
+			Type:       edgeType,
+			Constraint: "FROM cardinality",
+			msg:        fmt.Sprintf("%s node %s already has a %s edge, and FROM %s is ONE", et.To.Label, toID, edgeType, et.From.Label),
+		}
+	}
+	return nil
+}
+
+// executeMergeNode executes a MERGE NODE statement. Finding no node and
+// inserting one happen in one statement, so as long as statements do not
+// run concurrently, as DB ensures, no write can come in between.
+func (e *Executor) executeMergeNode(out Output, stmt *parser.MergeNodeStmt) error {
+	nt, ok := e.registry.Current().Nodes[stmt.NodeType]
+	if !ok {
+		return notFound("node type '%s' does not exist", stmt.NodeType)
+	}
+	if err := e.checkMergeSets(stmt.NodeType, nt.Fields, stmt.OnCreate, stmt.OnMatch); err != nil {
+		return err
+	}
+	sc := &whereScope{fields: nt.Fields}
+	nodes := e.graph.Nodes[stmt.NodeType]
+	var hits []scanHit
+	if nodes != nil {
+		var err error
+		hits, err = e.scanMatching(context.Background(), stmt.NodeType, nodes, stmt.Properties, nil, sc)
+		if err != nil {
+			return err
+		}
+	}
+	if len(hits) == 0 {
+		insert := &parser.InsertNodeStmt{NodeType: stmt.NodeType, Line: stmt.Line, Col: stmt.Col}
+		props, err := e.createProps(sc, stmt.Properties, stmt.OnCreate)
+		if err != nil {
+			return err
+		}
+		insert.Properties = props
+		return e.executeInsertNode(out, insert)
+	}
+	var c Change
+	if len(stmt.OnMatch) > 0 {
+		written, err := e.updateHits(stmt.NodeType, nodes, hits, sc, stmt.OnMatch)
+		if err != nil {
+			return err
+		}
+		c.NodesUpdated, c.UpdatedIDs = len(written), hitIDs(written)
+	}
+	changed(out, c, "Matched %d node(s)", len(hits))
+	return nil
+}
+
+// executeMergeEdge executes a MERGE EDGE statement, which matches the edges
+// of its type between the two nodes
+func (e *Executor) executeMergeEdge(out Output, stmt *parser.MergeEdgeStmt) error {
+	et, ok := e.registry.Current().Edges[stmt.EdgeType]
+	if !ok {
+		return notFound("edge type '%s' does not exist", stmt.EdgeType)
+	}
+	if err := e.checkMergeSets(stmt.EdgeType, et.Props, stmt.OnCreate, stmt.OnMatch); err != nil {
+		return err
+	}
+	fromNodeID, err := e.findNodeID(stmt.FromNode)
+	if err != nil {
+		return fmt.Errorf("FROM node not found: %w", err)
+	}
+	toNodeID, err := e.findNodeID(stmt.ToNode)
+	if err != nil {
+		return fmt.Errorf("TO node not found: %w", err)
+	}
+	sc := &whereScope{fields: et.Props}
+	var matched []int
+	for _, i := range e.between(stmt.EdgeType, fromNodeID, toNodeID) {
+		if e.matchesConditions(e.graph.Edges[stmt.EdgeType][i].Properties, stmt.Properties) {
+			matched = append(matched, i)
+		}
+	}
+	if len(matched) == 0 {
+		insert := &parser.InsertEdgeStmt{EdgeType: stmt.EdgeType, FromNode: stmt.FromNode, ToNode: stmt.ToNode, Line: stmt.Line, Col: stmt.Col}
+		props, err := e.createProps(sc, stmt.Properties, stmt.OnCreate)
+		if err != nil {
+			return err
+		}
+		insert.Properties = props
+		return e.executeInsertEdge(out, insert)
+	}
+	var c Change
+	if len(stmt.OnMatch) > 0 {
+		if err := e.updateEdges(stmt.EdgeType, matched, sc, stmt.OnMatch); err != nil {
+			return err
+		}
+		c.EdgesUpdated, c.UpdatedIDs = len(matched), e.edgeIDs(stmt.EdgeType, matched)
+	}
+	changed(out, c, "Matched %d edge(s)", len(matched))
+	return nil
+}
+
+// checkMergeSets checks the ON CREATE SET and ON MATCH SET of a MERGE on typ,
+// whose fields are fields, before anything is read
+func (e *Executor) checkMergeSets(typ string, fields map[string]catalog.FieldSpec, onCreate, onMatch []parser.Property) error {
+	for _, set := range [][]parser.Property{onCreate, onMatch} {
+		set, err := setLiterals(set)
+		if err != nil {
+			return err
+		}
+		if err := e.checkValues(typ, fields, set); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createProps returns the properties a MERGE inserts: those it matched on,
+// then its ON CREATE SET, whose CASEs and expressions read the properties
+// matched on
+func (e *Executor) createProps(sc *whereScope, props, onCreate []parser.Property) ([]parser.Property, error) {
+	matched := make(map[string]interface{}, len(props))
+	for _, p := range props {
+		matched[p.Name] = e.typedValue(sc.fields, p.Name, p.Value)
+	}
+	out := slices.Clone(props)
+	for _, p := range onCreate {
+		if p.Case != nil {
+			v := e.caseLiteral(sc, matched, p.Case)
+			if v == nil {
+				v = &parser.Literal{Kind: parser.LitNull, Text: "null", Line: p.Line, Col: p.Col}
+			}
+			p = parser.Property{Name: p.Name, Value: v, Line: p.Line, Col: p.Col}
+		}
+		if p.Calc != nil {
+			// the INSERT checks the value against the type of the field
+			v, err := calc(sc, matched, p.Calc)
+			if err != nil {
+				return nil, fmt.Errorf("SET %s: %w", p.Name, err)
+			}
+			p = parser.Property{Name: p.Name, Value: v, Line: p.Line, Col: p.Col}
+		}
+		i := slices.IndexFunc(out, func(q parser.Property) bool { return q.Name == p.Name })
+		if i < 0 {
+			out = append(out, p)
+		} else {
+			out[i] = p
+		}
+	}
+	return out, nil
+}
+
+// executeUpdateNode executes an UPDATE NODE statement
+func (e *Executor) executeUpdateNode(out Output, stmt *parser.UpdateNodeStmt) error {
+	nodes := e.graph.Nodes[stmt.NodeType]
+	if nodes == nil {
+		return notFound("no nodes of type '%s' found", stmt.NodeType)
+	}
+	set, err := setLiterals(stmt.Set)
+	if err != nil {
+		return err
+	}
+	cat := e.registry.Current()
+	if nt, ok := cat.Nodes[stmt.NodeType]; ok {
+		if err := e.checkValues(stmt.NodeType, nt.Fields, set); err != nil {
+			return err
+		}
+	}
+	if err := checkReturning(cat, stmt.NodeType, stmt.Returning); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	sc, err := e.scopeFor(ctx, stmt.NodeType, stmt.Where, stmt.Filter)
+	if err != nil {
+		return err
+	}
+	// find the nodes first, so the scan never sees a half-updated node
+	hits, err := e.scanMatching(ctx, stmt.NodeType, nodes, stmt.Where, stmt.Filter, sc)
+	if err != nil {
+		return err
+	}
+	written, err := e.updateHits(stmt.NodeType, nodes, hits, sc, stmt.Set)
+	if err != nil {
+		return err
+	}
+	changed(out, Change{NodesUpdated: len(written), UpdatedIDs: hitIDs(written)}, "Updated %d node(s)", len(written))
+	writeReturned(out, stmt.NodeType, stmt.Returning, written)
+	return nil
+}
+
+// updateHits applies set to hits, nodes of nodes, once the changes are
+// checked against the keys of nodeType, and returns the nodes as written, in
+// the order of hits
+func (e *Executor) updateHits(nodeType string, nodes *NodeSet, hits []scanHit, sc *whereScope, set []parser.Property) ([]scanHit, error) {
+	writes := make(map[string]map[string]interface{}, len(hits))
+	for _, hit := range hits {
+		// a snapshot may share the old map, so write a changed copy
+		props := maps.Clone(hit.props)
+		for _, setProp := range set {
+			v, err := e.setValue(sc, nodeType, hit.props, setProp)
+			if err != nil {
+				return nil, err
+			}
+			if v == nil && sc.fields[setProp.Name].NotNull {
+				return nil, nullError(nodeType, setProp.Name, true)
+			}
+			props[intern(setProp.Name)] = v
+		}
+		writes[hit.id] = props
+	}
+	if err := e.checkUnique(nodeType, writes); err != nil {
+		return nil, err
+	}
+	moved, err := e.movedNodes(nodeType, writes)
+	if err != nil {
+		return nil, err
+	}
+	e.storeNodes(nodeType, writes, moved)
+	written := make([]scanHit, len(hits))
+	for i, hit := range hits {
+		id := hit.id
+		if to, ok := moved[id]; ok {
+			id = to
+		}
+		written[i] = scanHit{id: id, props: writes[hit.id]}
+	}
+	return written, nil
+}
+
+// setLiterals returns the assignments of a SET with each CASE replaced by
+// one for every value it may give, so they can all be checked before anything
+// is written, and each expression left out, as its value is only known once
+// computed. It fails on a CASE condition evalExpr could not test, and on an
+// expression calling a function wrongly.
+func setLiterals(set []parser.Property) ([]parser.Property, error) {
+	out := make([]parser.Property, 0, len(set))
+	for _, p := range set {
+		if p.Calc != nil {
+			if err := checkCalc(p.Name, p.Calc); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if p.Case == nil {
+			out = append(out, p)
+			continue
+		}
+		for _, w := range p.Case.Whens {
+			if err := checkExpr(w.Cond); err != nil {
+				return nil, err
+			}
+			out = append(out, parser.Property{Name: p.Name, Value: w.Then, Line: p.Line, Col: p.Col})
+		}
+		if p.Case.Else != nil {
+			out = append(out, parser.Property{Name: p.Name, Value: p.Case.Else, Line: p.Line, Col: p.Col})
+		}
+	}
+	return out, nil
+}
+
+// setValue returns the value an assignment of a SET writes to a node or edge
+// of typ whose properties were props, a row of sc
+func (e *Executor) setValue(sc *whereScope, typ string, props map[string]interface{}, p parser.Property) (interface{}, error) {
+	lit := p.Value
+	switch {
+	case p.Case != nil:
+		if lit = e.caseLiteral(sc, props, p.Case); lit == nil {
+			return nil, nil
+		}
+	case p.Calc != nil:
+		var err error
+		if lit, err = calc(sc, props, p.Calc); err != nil {
+			return nil, fmt.Errorf("SET %s: %w", p.Name, err)
+		}
+		if spec, ok := sc.fields[p.Name]; ok {
+			v, err := e.coerce(spec.Type, lit)
+			if err != nil {
+				_, field, _ := strings.Cut(p.Name, ".")
+				if field == "" {
+					field = p.Name
+				}
+				return nil, &ConstraintError{
+					Type:       typ,
+					Field:      field,
+					Constraint: "type",
+					msg:        fmt.Sprintf("field '%s' %v", field, err),
+				}
+			}
+			return v, nil
+		}
+	}
+	return e.typedValue(sc.fields, p.Name, lit), nil
+}
+
+// executeUpdateEdge executes an UPDATE EDGE statement
+func (e *Executor) executeUpdateEdge(out Output, stmt *parser.UpdateEdgeStmt) error {
+	set, err := setLiterals(stmt.Set)
+	if err != nil {
+		return err
+	}
+	cat := e.registry.Current()
+	if et, ok := cat.Edges[stmt.EdgeType]; ok {
+		if err := e.checkValues(stmt.EdgeType, et.Props, set); err != nil {
+			return err
+		}
+	}
+	if err := checkReturning(cat, stmt.EdgeType, stmt.Returning); err != nil {
+		return err
+	}
+	sc, err := e.scopeFor(context.Background(), stmt.EdgeType, stmt.Where, stmt.Filter)
+	if err != nil {
+		return err
+	}
+	var hits []int
+	for i, edge := range e.graph.Edges[stmt.EdgeType] {
+		if !edge.Deleted() && e.matchesConditions(edge.Properties, stmt.Where) && e.evalExpr(sc, edge.Properties, stmt.Filter) {
+			hits = append(hits, i)
+		}
+	}
+	if err := e.updateEdges(stmt.EdgeType, hits, sc, stmt.Set); err != nil {
+		return err
+	}
+	changed(out, Change{EdgesUpdated: len(hits), UpdatedIDs: e.edgeIDs(stmt.EdgeType, hits)}, "Updated %d edge(s)", len(hits))
+	if stmt.Returning != nil {
+		writeReturned(out, stmt.EdgeType, stmt.Returning, e.edgeHits(stmt.EdgeType, hits))
+	}
+	return nil
+}
+
+// updateEdges applies set to the edges of edgeType at indexes hits, once the
+// values of all are worked out
+func (e *Executor) updateEdges(edgeType string, hits []int, sc *whereScope, set []parser.Property) error {
+	edges := e.graph.Edges[edgeType]
+	writes := make([]map[string]interface{}, len(hits))
+	byID := make(map[string]map[string]interface{}, len(hits))
+	for j, i := range hits {
+		// a snapshot may share the old map, so write a changed copy
+		props := maps.Clone(edges[i].Properties)
+		for _, setProp := range set {
+			v, err := e.setValue(sc, edgeType, edges[i].Properties, setProp)
+			if err != nil {
+				return err
+			}
+			if v == nil && sc.fields[setProp.Name].NotNull {
+				return nullError(edgeType, setProp.Name, true)
+			}
+			props[intern(setProp.Name)] = v
+		}
+		writes[j] = props
+		byID[edges[i].ID] = props
+	}
+	if len(hits) == 0 {
+		return nil
+	}
+	if err := e.checkEdgeUnique(edgeType, byID); err != nil {
+		return err
+	}
+	edges = e.graph.ownEdges(edgeType)
+	for j, i := range hits {
+		edges[i].Properties = writes[j]
+		e.graph.edgeWritten(edgeType, edges[i].ID, i)
+	}
+	return nil
+}
+
+// executeDeleteNode executes a DELETE NODE statement
+func (e *Executor) executeDeleteNode(out Output, stmt *parser.DeleteNodeStmt) error {
+	nodes := e.graph.Nodes[stmt.NodeType]
+	if nodes == nil {
+		return notFound("no nodes of type '%s' found", stmt.NodeType)
+	}
+	if err := checkReturning(e.registry.Current(), stmt.NodeType, stmt.Returning); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	sc, err := e.scopeFor(ctx, stmt.NodeType, stmt.Where, stmt.Filter)
+	if err != nil {
+		return err
+	}
+	hits, err := e.scanMatching(ctx, stmt.NodeType, nodes, stmt.Where, stmt.Filter, sc)
+	if err != nil {
+		return err
+	}
+	for _, hit := range hits {
+		nodes.delete(e.graph.epoch, hit.id)
+		e.graph.nodeWritten(stmt.NodeType, hit.id)
+	}
+	changed(out, Change{NodesDeleted: len(hits), DeletedIDs: hitIDs(hits)}, "Deleted %d node(s)", len(hits))
+	writeReturned(out, stmt.NodeType, stmt.Returning, hits)
+	return nil
+}
+
+// checkEndpoints rejects from and to as the endpoints of an edge of et,
+// called edgeType, if they are not of the node types it connects
+func checkEndpoints(edgeType string, et *catalog.EdgeType, from, to *parser.NodeRef) error {
+	if from.NodeType != et.From.Label {
+		return &ConstraintError{
+			Type:       edgeType,
+			Constraint: "FROM endpoint",
+			msg:        fmt.Sprintf("FROM node type '%s' does not match edge FROM type '%s'", from.NodeType, et.From.Label),
+		}
+	}
+	if to.NodeType != et.To.Label {
+		return &ConstraintError{
+			Type:       edgeType,
+			Constraint: "TO endpoint",
+			msg:        fmt.Sprintf("TO node type '%s' does not match edge TO type '%s'", to.NodeType, et.To.Label),
+		}
+	}
+	return nil
+}
+
+// executeDeleteEdge executes a DELETE EDGE statement. With FROM and TO it
+// deletes only edges between those two nodes, found as INSERT EDGE finds
+// them.
+func (e *Executor) executeDeleteEdge(out Output, stmt *parser.DeleteEdgeStmt) error {
+	if err := checkReturning(e.registry.Current(), stmt.EdgeType, stmt.Returning); err != nil {
+		return err
+	}
+	sc, err := e.scopeFor(context.Background(), stmt.EdgeType, stmt.Where, stmt.Filter)
+	if err != nil {
+		return err
+	}
+	var fromNodeID, toNodeID string
+	between := stmt.FromNode != nil && stmt.ToNode != nil
+	if between {
+		et, ok := e.registry.Current().Edges[stmt.EdgeType]
+		if !ok {
+			return notFound("edge type '%s' does not exist", stmt.EdgeType)
+		}
+		if err := checkEndpoints(stmt.EdgeType, et, stmt.FromNode, stmt.ToNode); err != nil {
+			return err
+		}
+		if fromNodeID, err = e.findNodeID(stmt.FromNode); err != nil {
+			return fmt.Errorf("FROM node not found: %w", err)
+		}
+		if toNodeID, err = e.findNodeID(stmt.ToNode); err != nil {
+			return fmt.Errorf("TO node not found: %w", err)
+		}
+	}
+	edges := e.graph.Edges[stmt.EdgeType]
+	var hits []int
+	ends := namesEdgeKeys(stmt.Where, stmt.Filter)
+	test := func(i int) {
+		props := edges[i].Properties
+		if ends {
+			props = edgeRow(&edges[i])
+		}
+		if e.matchesConditions(props, stmt.Where) && e.evalExpr(sc, props, stmt.Filter) {
+			hits = append(hits, i)
+		}
+	}
+	if between {
+		for _, i := range e.between(stmt.EdgeType, fromNodeID, toNodeID) {
+			test(i)
+		}
+	} else {
+		for i := range edges {
+			if !edges[i].Deleted() {
+				test(i)
+			}
+		}
+	}
+	ids := e.edgeIDs(stmt.EdgeType, hits)
+	var returned []scanHit
+	if stmt.Returning != nil {
+		returned = e.edgeHits(stmt.EdgeType, hits)
+	}
+	if len(hits) > 0 {
+		edges = e.graph.ownEdges(stmt.EdgeType)
+		for _, i := range hits {
+			e.graph.deleteEdge(stmt.EdgeType, edges, i)
+		}
+	}
+	changed(out, Change{EdgesDeleted: len(ids), DeletedIDs: ids}, "Deleted %d edge(s)", len(ids))
+	writeReturned(out, stmt.EdgeType, stmt.Returning, returned)
+	return nil
+}
+
+// namesEdgeKeys reports whether where or filter tests the _id, _from or _to
+// of edges, as a DELETE EDGE may
+func namesEdgeKeys(where []parser.Property, filter parser.Expr) bool {
+	names := exprFields(filter)
+	for _, p := range where {
+		names = append(names, p.Name)
+	}
+	for _, name := range names {
+		if name == "_id" || name == "_from" || name == "_to" {
+			return true
+		}
+	}
+	return false
+}
+
+// executeMatch executes a MATCH statement for querying
+func (e *Executor) executeMatch(ctx context.Context, out Output, stmt *parser.MatchStmt) error {
+	if last := lastStage(stmt); last.Set != nil || last.Delete != nil {
+		return e.executePathWrite(ctx, out, stmt)
+	}
+	if len(stmt.Paths) > 0 {
+		return e.executePathMatch(ctx, out, stmt)
+	}
+	limit, err := matchLimit(stmt)
+	if err != nil {
+		return err
+	}
+	cat := e.registry.Current()
+	if err := checkAliases(cat, stmt); err != nil {
+		return err
+	}
+	order, err := orderFor(cat, stmt)
+	if err != nil {
+		return err
+	}
+	found, err := e.prepareWhere(ctx, matchAliases(stmt), append(caseConds(stmt), stmt.Filter)...)
+	if err != nil {
+		return err
+	}
+	project, err := e.projection(stmt, found)
+	if err != nil {
+		return err
+	}
+	if project == nil {
+		project = func(_ string, props map[string]interface{}) map[string]interface{} { return props }
+	}
+	if out != nil {
+		out.ResultSet()
+	}
+	var seen distinctRows
+	if stmt.Distinct {
+		seen = make(distinctRows)
+	}
+	// emit writes a row and reports whether LIMIT allows another; a reader
+	// such as a Cursor may stop taking rows by cancelling ctx
+	emit := func(nodeType, id string, row map[string]interface{}) bool {
+		if limit == 0 || ctx.Err() != nil {
+			return false
+		}
+		if seen != nil {
+			if !seen.add(row) {
+				return true
+			}
+			nodeType, id = "", ""
+		}
+		if out != nil {
+			out.Row(nodeType, id, row)
+		}
+		if limit > 0 {
+			limit--
+		}
+		return limit != 0
+	}
+	var ranked []rankedHit
+	for _, element := range stmt.Pattern {
+		if element.IsEdge {
+			continue
+		}
+		var hits []scanHit
+		where := whereFor(stmt, element.Alias)
+		sc := &whereScope{fields: typeFields(cat, element.Type), self: element.Alias, prepared: found}
+		if _, isNode := cat.Nodes[element.Type]; !isNode && cat.Edges[element.Type] != nil {
+			hits, err = e.matchEdges(ctx, element.Type, where, sc)
+		} else {
+			hits, err = e.matchNodes(ctx, element.Type, where, sc)
+		}
+		if err != nil {
+			return err
+		}
+		if order != nil {
+			r, err := e.rankByVector(element.Type, order, hits)
+			if err != nil {
+				return err
+			}
+			ranked = append(ranked, r...)
+			continue
+		}
+		for _, hit := range hits {
+			if !emit(element.Type, hit.id, project(element.Type, hit.props)) {
+				break
+			}
+		}
+	}
+	if order == nil {
+		return ctx.Err()
+	}
+	sortRanked(ranked, order.Metric)
+	key := scoreKey(order.Metric)
+	for _, r := range ranked {
+		props := maps.Clone(r.props)
+		props[key] = strconv.FormatFloat(r.score, 'g', 6, 64)
+		if !emit(r.nodeType, r.id, project(r.nodeType, props)) {
+			break
+		}
+	}
+	return ctx.Err()
+}
+
+/* ---------------------- Helper methods ---------------------- */
+
+// findNodeID finds a node ID based on NodeRef (by direct ID or property match)
+func (e *Executor) findNodeID(nodeRef *parser.NodeRef) (string, error) {
+	nodes := e.graph.Nodes[nodeRef.NodeType]
+	if nodes == nil {
+		return "", notFound("no nodes of type '%s' found", nodeRef.NodeType)
+	}
+	// Direct ID reference
+	if nodeRef.ID != nil {
+		nodeID := nodeRef.ID.Text
+		if _, exists := nodes.Get(nodeID); exists {
+			return strings.Clone(nodeID), nil
+		}
+		return "", notFound("node with ID '%s' not found", nodeID)
+	}
+	// Property-based search, in one partition when the primary key is given
+	if e.absent(nodeRef.NodeType, nodes, nodeRef.Properties) {
+		return "", notFound("no matching node found")
+	}
+	found := ""
+	match := func(id string, props map[string]interface{}) bool {
+		if e.matchesConditions(props, nodeRef.Properties) {
+			found = id
+			return false
+		}
+		return true
+	}
+	if i := nodes.pinned(nodeRef.Properties); i >= 0 {
+		nodes.rangePartition(i, match)
+	} else {
+		nodes.Range(match)
+	}
+	if found != "" {
+		return found, nil
+	}
+	return "", notFound("no matching node found")
+}
+
+// matchesConditions checks if properties match the given conditions. A
+// condition name: null also matches a field never set, but not a key missing
+// from a JSON document.
+func (e *Executor) matchesConditions(properties interface{}, conditions []parser.Property) bool {
+	if len(conditions) == 0 {
+		return true
+	}
+
+	props, ok := properties.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	for _, condition := range conditions {
+		propValue, exists := fieldValue(props, condition.Name)
+		if !exists {
+			if condition.Value != nil && condition.Value.Kind == parser.LitNull && unset(props, condition.Name) {
+				continue
+			}
+			return false
+		}
+		if j, ok := propValue.(JSON); ok {
+			if !jsonEqual(j, condition.Value) {
+				return false
+			}
+			continue
+		}
+		if b, ok := propValue.(Blob); ok {
+			if other, ok := blobLiteral(condition.Value); !ok || b != other {
+				return false
+			}
+			continue
+		}
+
+		// Simple equality check
+		var expectedValue interface{}
+		switch condition.Value.Kind {
+		case parser.LitString:
+			expectedValue = condition.Value.Text
+		case parser.LitNumber:
+			expectedValue = condition.Value.Text
+		case parser.LitBool:
+			expectedValue = condition.Value.Text == "true"
+		case parser.LitNull:
+			expectedValue = nil
+		}
+
+		if t, ok := propValue.(Temporal); ok {
+			// as stored, so that it matches as an index of the field would
+			propValue = t.String()
+		}
+		if propValue != expectedValue {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,39 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+
+	"grapho/catalog"
+)
+
+// ErrNotFound matches failures to find a node or edge type, or a node an edge
+// endpoint refers to. It is the same value as catalog.ErrNotFound.
+var ErrNotFound = catalog.ErrNotFound
+
+// ErrBackupAlone is returned for a BACKUP among other statements; it writes
+// its archive with the executor free for other commands, so it runs on its
+// own
+var ErrBackupAlone = errors.New("BACKUP must be the only statement of its script")
+
+// ConstraintError reports data that violates the schema
+type ConstraintError struct {
+	Type       string // node or edge type
+	Field      string // offending field, if any
+	Constraint string // e.g. "NOT NULL" or "FROM endpoint"
+	msg        string
+}
+
+func (e *ConstraintError) Error() string { return e.msg }
+
+// notFoundError keeps the original message while matching ErrNotFound
+type notFoundError struct {
+	msg string
+}
+
+func (e *notFoundError) Error() string { return e.msg }
+func (e *notFoundError) Unwrap() error { return ErrNotFound }
+
+func notFound(format string, args ...any) error {
+	return &notFoundError{msg: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,214 @@
+// Package executor applies parsed statements to the catalog and the in-memory graph.
+package executor
+
+import (
+	"context"
+	"fmt"
+
+	"grapho/catalog"
+	"grapho/parser"
+)
+
+// Output receives what a statement produces
+type Output interface {
+	// Message reports an informational line, e.g. the ID of an inserted node
+	Message(format string, args ...any)
+	// ResultSet announces that result rows follow
+	ResultSet()
+	// Row delivers one result row
+	Row(nodeType, id string, props map[string]interface{})
+}
+
+// Executor runs statements against a catalog registry and the graph data it owns
+type Executor struct {
+	registry *catalog.Registry
+	graph    *GraphData
+	hooks    []Hook
+	readOnly bool // set on snapshots
+	plans    planCache
+	stats    *Statistics // see SetStats
+	lenient  bool        // see SetLenient
+	layouts  []string    // see SetTimeLayouts
+	maxBlob  int         // see SetMaxBlobSize
+	cache    *nodeCache  // see SetCacheSize
+
+	store         GraphStore // see LoadData
+	storedVersion uint64     // of the catalog last written to store
+
+	replaying bool // set by Replay
+
+	key  generatedKey                 // by the statement running
+	keys map[parser.Stmt]generatedKey // by statement; see LogText
+}
+
+// New creates an executor with an empty graph
+func New(registry *catalog.Registry) *Executor {
+	return &Executor{
+		registry: registry,
+		graph:    newGraphData(),
+		cache:    newNodeCache(DefaultCacheSize),
+	}
+}
+
+// Registry returns the catalog registry the executor applies DDL to
+func (e *Executor) Registry() *catalog.Registry {
+	return e.registry
+}
+
+// Graph returns the graph data the executor owns. Callers must serialize access
+// with statement execution and must not modify it.
+func (e *Executor) Graph() *GraphData {
+	return e.graph
+}
+
+// Execute runs a single parsed statement, reporting its output to out.
+// out may be nil when the output is not needed, e.g. during commit log replay.
+// A statement is not started once ctx is done. MATCH scans also stop early, but
+// statements that change data run to completion so they are never half applied.
+func (e *Executor) Execute(ctx context.Context, out Output, stmt parser.Stmt) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if e.readOnly && Mutates(stmt) {
+		return ErrReadOnly
+	}
+	if !e.lenient {
+		if err := e.checkFields(stmt); err != nil {
+			return err
+		}
+	}
+	// a cached plan runs the same statement again
+	delete(e.keys, stmt)
+	e.key = generatedKey{}
+	var err error
+	if len(e.hooks) > 0 {
+		err = e.executeHooked(ctx, out, stmt)
+	} else {
+		err = e.execute(ctx, out, stmt)
+	}
+	if err == nil {
+		e.keepKey(stmt)
+	}
+	return err
+}
+
+// execute dispatches stmt to its implementation
+func (e *Executor) execute(ctx context.Context, out Output, stmt parser.Stmt) error {
+	switch st := stmt.(type) {
+	case *parser.CreateNodeStmt:
+		return e.executeCreateNode(ctx, st)
+	case *parser.CreateEdgeStmt:
+		return e.executeCreateEdge(ctx, st)
+	case *parser.AlterNodeStmt:
+		return e.executeAlterNode(ctx, st)
+	case *parser.AlterEdgeStmt:
+		return e.executeAlterEdge(ctx, st)
+	case *parser.DropNodeStmt:
+		return e.executeDropNode(ctx, st)
+	case *parser.DropEdgeStmt:
+		return e.executeDropEdge(ctx, st)
+	case *parser.CreateFulltextIndexStmt:
+		return e.executeCreateFulltextIndex(ctx, st)
+	case *parser.DropFulltextIndexStmt:
+		return e.executeDropFulltextIndex(ctx, st)
+	case *parser.InsertNodeStmt:
+		return e.executeInsertNode(out, st)
+	case *parser.InsertEdgeStmt:
+		return e.executeInsertEdge(out, st)
+	case *parser.MergeNodeStmt:
+		return e.executeMergeNode(out, st)
+	case *parser.MergeEdgeStmt:
+		return e.executeMergeEdge(out, st)
+	case *parser.UpdateNodeStmt:
+		return e.executeUpdateNode(out, st)
+	case *parser.UpdateEdgeStmt:
+		return e.executeUpdateEdge(out, st)
+	case *parser.DeleteNodeStmt:
+		return e.executeDeleteNode(out, st)
+	case *parser.DeleteEdgeStmt:
+		return e.executeDeleteEdge(out, st)
+	case *parser.MatchStmt:
+		return e.executeMatch(ctx, out, st)
+	case *parser.ExportStmt:
+		return e.executeExport(ctx, out, st)
+	case *parser.ShowStatsStmt:
+		return e.executeShowStats(out, st)
+	case *parser.VacuumStmt:
+		return e.executeVacuum(out, st)
+	case *parser.BackupStmt:
+		// the server and the DB take a lone BACKUP before it gets here
+		return ErrBackupAlone
+	default:
+		return fmt.Errorf("unsupported statement type: %T", stmt)
+	}
+}
+
+// ExecuteScript parses script and executes its statements in order, stopping at
+// the first parse or execution error
+func (e *Executor) ExecuteScript(ctx context.Context, out Output, script string) error {
+	// hooks may keep the statements they see, which a cached plan would rebind
+	return e.runScript(ctx, out, script, e.Execute, len(e.hooks) == 0)
+}
+
+// Replay executes a command read back from the commit log. It produces no
+// output and skips hooks, since the statements already ran once.
+func (e *Executor) Replay(ctx context.Context, script string) error {
+	e.replaying = true
+	defer func() { e.replaying = false }()
+	return e.runScript(ctx, nil, script, e.execute, true)
+}
+
+// runScript runs the statements of script with exec, taking them from the
+// plan cache when cache is set; see scriptShape
+func (e *Executor) runScript(ctx context.Context, out Output, script string, exec func(context.Context, Output, parser.Stmt) error, cache bool) error {
+	stmts, release, err := e.prepare(script, cache)
+	if err != nil {
+		return err
+	}
+	defer release()
+	for _, st := range stmts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := exec(ctx, out, st); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Mutates reports whether stmt changes the catalog or the graph, i.e. whether it
+// must be written to the commit log
+func Mutates(stmt parser.Stmt) bool {
+	switch st := stmt.(type) {
+	case *parser.MatchStmt:
+		last := lastStage(st)
+		return last.Set != nil || last.Delete != nil
+	case *parser.CreateNodeStmt, *parser.CreateEdgeStmt,
+		*parser.AlterNodeStmt, *parser.AlterEdgeStmt,
+		*parser.DropNodeStmt, *parser.DropEdgeStmt,
+		*parser.CreateFulltextIndexStmt, *parser.DropFulltextIndexStmt,
+		*parser.InsertNodeStmt, *parser.InsertEdgeStmt,
+		*parser.MergeNodeStmt, *parser.MergeEdgeStmt,
+		*parser.UpdateNodeStmt, *parser.UpdateEdgeStmt,
+		*parser.DeleteNodeStmt, *parser.DeleteEdgeStmt:
+		return true
+	default:
+		return false
+	}
+}
+
+// OnlyDeletes reports whether stmt changes the catalog or the graph only by
+// deleting from it, which frees space once the data file is snapshotted
+func OnlyDeletes(stmt parser.Stmt) bool {
+	switch st := stmt.(type) {
+	case *parser.MatchStmt:
+		last := lastStage(st)
+		return last.Set == nil && last.Delete != nil
+	case *parser.DropNodeStmt, *parser.DropEdgeStmt, *parser.DropFulltextIndexStmt,
+		*parser.DeleteNodeStmt, *parser.DeleteEdgeStmt:
+		return true
+	default:
+		return false
+	}
+}
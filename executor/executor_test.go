@@ -0,0 +1,163 @@
+package executor
+
+import (
+	"context"
+	"testing"
+
+	"grapho/catalog"
+	"grapho/parser"
+)
+
+// newExecutor returns an executor over an empty catalog kept in memory
+func newExecutor(t *testing.T) *Executor {
+	t.Helper()
+	reg, err := catalog.Open(context.Background(), catalog.NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(reg)
+}
+
+// parse parses script, failing the test on a parse error
+func parse(t *testing.T, script string) []parser.Stmt {
+	t.Helper()
+	stmts, errs := parser.NewParser(script).ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("%s: %v", script, errs)
+	}
+	return stmts
+}
+
+// countingHook counts the statements it sees
+type countingHook struct{ before, after int }
+
+func (h *countingHook) BeforeStatement(context.Context, parser.Stmt) error { h.before++; return nil }
+
+func (h *countingHook) AfterStatement(context.Context, parser.Stmt, Result) { h.after++ }
+
+func TestReplay(t *testing.T) {
+	ctx := context.Background()
+	e := newExecutor(t)
+	e.SetMaxBlobSize(4)
+	hook := &countingHook{}
+	e.AddHook(hook)
+	if err := e.ExecuteScript(ctx, nil, `
+CREATE NODE A (name: string PRIMARY KEY, b: blob);
+CREATE EDGE E (FROM A MANY, TO A ONE);
+INSERT NODE A (name: 'x'); INSERT NODE A (name: 'y'); INSERT NODE A (name: 'z');
+INSERT EDGE E FROM A('x') TO A('y');`); err != nil {
+		t.Fatal(err)
+	}
+	seen := hook.before
+
+	// what a statement is refused now may be in a log written before, and
+	// replays
+	for _, script := range []string{
+		"INSERT NODE A (name: 'w', b: b64'aGVsbG8=');", // over the blob size
+		"INSERT EDGE E FROM A('x') TO A('z');",         // a second edge TO ONE
+	} {
+		if err := e.ExecuteScript(ctx, nil, script); err == nil {
+			t.Errorf("%s: ran", script)
+		}
+		seen = hook.before
+		if err := e.Replay(ctx, script); err != nil {
+			t.Errorf("replay %s: %v", script, err)
+		}
+		if err := e.ExecuteScript(ctx, nil, script); err == nil {
+			t.Errorf("%s: ran after a replay", script)
+		}
+	}
+	if err := e.Replay(ctx, "INSERT NODE A (name: 'v');"); err != nil {
+		t.Fatal(err)
+	}
+	if hook.before != seen+1 || hook.after != hook.before {
+		t.Errorf("hooks saw %d and %d statements, want %d: the replays ran them", hook.before, hook.after, seen+1)
+	}
+	if n := e.Graph().Nodes["A"].Len(); n != 5 {
+		t.Errorf("%d nodes, want 5", n)
+	}
+	if n := e.Graph().EdgeCount("E"); n != 2 {
+		t.Errorf("%d edges, want 2", n)
+	}
+}
+
+func TestLogTextReplaysGeneratedKeys(t *testing.T) {
+	ctx := context.Background()
+	e, replica := newExecutor(t), newExecutor(t)
+	for _, script := range []string{
+		"CREATE NODE U (id: uuid PRIMARY KEY, n: int);",
+		"INSERT NODE U (n: 1); INSERT NODE U (id: null, n: 2);",
+		"INSERT NODE U (n: 3); INSERT NODE U (n: 3, x: 1);", // the second fails
+	} {
+		stmts := parse(t, script)
+		ran := stmts
+		for i, st := range stmts {
+			if err := e.Execute(ctx, nil, st); err != nil {
+				ran = stmts[:i]
+				break
+			}
+		}
+		var logged string
+		var err error
+		if len(ran) < len(stmts) {
+			logged, err = e.LogPrefix(ran)
+		} else {
+			logged, err = e.LogText(script, stmts)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", script, err)
+		}
+		if err := replica.Replay(ctx, logged); err != nil {
+			t.Fatalf("replay %q: %v", logged, err)
+		}
+	}
+	want, got := e.Graph().Nodes["U"], replica.Graph().Nodes["U"]
+	if want.Len() != 3 || got.Len() != 3 {
+		t.Fatalf("%d nodes replayed from %d, want 3", got.Len(), want.Len())
+	}
+	for _, id := range want.IDs() {
+		if _, ok := got.Get(id); !ok {
+			t.Errorf("node %s was not replayed with its key", id)
+		}
+	}
+}
+
+func TestMutates(t *testing.T) {
+	tests := []struct {
+		stmt        string
+		mutates     bool
+		onlyDeletes bool
+	}{
+		{stmt: "MATCH A;"},
+		{stmt: "MATCH (a:A) RETURN a.x;"},
+		{stmt: "VACUUM;"},
+		{stmt: "SHOW STATS;"},
+		{stmt: "CREATE NODE A (x: int);", mutates: true},
+		{stmt: "ALTER NODE A ADD y: int;", mutates: true},
+		{stmt: "CREATE FULLTEXT INDEX ON A (x);", mutates: true},
+		{stmt: "INSERT NODE A (x: 1);", mutates: true},
+		{stmt: "MERGE NODE A (x: 1);", mutates: true},
+		{stmt: "UPDATE NODE A SET x: 2 WHERE x: 1;", mutates: true},
+		{stmt: "MATCH (a:A) SET a.x: 2;", mutates: true},
+		{stmt: "MATCH (a:A) DELETE a;", mutates: true, onlyDeletes: true},
+		{stmt: "DELETE NODE A WHERE x: 1;", mutates: true, onlyDeletes: true},
+		{stmt: "DELETE EDGE E WHERE x: 1;", mutates: true, onlyDeletes: true},
+		{stmt: "DROP NODE A;", mutates: true, onlyDeletes: true},
+		{stmt: "DROP FULLTEXT INDEX ON A (x);", mutates: true, onlyDeletes: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.stmt, func(t *testing.T) {
+			stmts := parse(t, tt.stmt)
+			if len(stmts) != 1 {
+				t.Fatalf("parsed %d statements", len(stmts))
+			}
+			if got := Mutates(stmts[0]); got != tt.mutates {
+				t.Errorf("Mutates = %v, want %v", got, tt.mutates)
+			}
+			if got := OnlyDeletes(stmts[0]); got != tt.onlyDeletes {
+				t.Errorf("OnlyDeletes = %v, want %v", got, tt.onlyDeletes)
+			}
+		})
+	}
+}
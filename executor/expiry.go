@@ -0,0 +1,181 @@
+package executor
+
+import (
+	"slices"
+	"time"
+
+	"grapho/catalog"
+	"grapho/parser"
+)
+
+/* ---------------------- Expiry ---------------------- */
+
+// Nodes and edges can be given a time to live. A date or datetime field
+// marked TTL 'P30D' makes each node or edge of its type expire that long
+// after the time in it; in a type without one, a date or datetime field
+// called expires_at makes each expire at the time in it. A date stands for
+// the start of its day, and a datetime without a zone is taken as UTC.
+// Expired nodes and edges stay until they are deleted: Expired gives the
+// statements that delete them, to be run and written to the commit log like
+// any others, so that replay deletes the same. The edges of an expired node
+// are deleted with it. Each statement tests the expiry field again as it
+// runs, so one that comes after the field was moved on deletes nothing.
+
+// ExpiryField names the field that makes nodes and edges of a type without
+// a TTL field expire
+const ExpiryField = "expires_at"
+
+// Expiration is a statement that deletes expired nodes or edges
+type Expiration struct {
+	Stmt  parser.Stmt
+	Node  bool // deletes a node, not edges
+	Type  string
+	Count int // of the nodes or edges it deletes
+}
+
+// expiryRule makes the nodes or edges of a type expire ttl after the time
+// in field
+type expiryRule struct {
+	field string
+	ttl   parser.Duration
+}
+
+// expiryRuleOf returns the rule of a type with fields, if it has one
+func expiryRuleOf(fields map[string]catalog.FieldSpec) (expiryRule, bool) {
+	for name, f := range fields {
+		if f.TTL != "" {
+			d, err := parser.ParseDuration(f.TTL)
+			return expiryRule{field: name, ttl: d}, err == nil && expiryType(f.Type)
+		}
+	}
+	f, ok := fields[ExpiryField]
+	return expiryRule{field: ExpiryField}, ok && expiryType(f.Type)
+}
+
+// expiryType reports whether a field of type t can make things expire
+func expiryType(t catalog.TypeSpec) bool {
+	return t.Elem == nil && (t.Base == catalog.BaseDate || t.Base == catalog.BaseDateTime)
+}
+
+// cutoff returns the latest time in the field of something expired by now
+func (r expiryRule) cutoff(now time.Time) time.Time {
+	return r.ttl.AddTo(now, true).UTC()
+}
+
+// expired reports whether props have expired by the time cutoff returned
+func (r expiryRule) expired(props map[string]interface{}, cutoff time.Time) bool {
+	t, ok := props[r.field].(Temporal)
+	return ok && !t.Time().After(cutoff)
+}
+
+// filter returns the condition field <= cutoff, with the field qualified by
+// alias unless that is ""
+func (r expiryRule) filter(alias string, cutoff time.Time) parser.Expr {
+	field := r.field
+	if alias != "" {
+		field = alias + "." + field
+	}
+	return &parser.CompareExpr{Field: field, Op: parser.LessEq, Value: parser.Str(cutoff.Format(time.RFC3339Nano))}
+}
+
+// Expired returns the statements that delete the nodes and edges expired
+// by now, in the order they are to run: for each expired node, a path MATCH
+// for each type of edge from and to it, then a DELETE NODE by ID; then, for
+// each edge type, a DELETE EDGE for each expired value of its expiry field,
+// which holds for every edge with that value. Each holds only while the node
+// or edge is still expired by now, so the statements may be worked out on a
+// snapshot and run once statements after it have changed the graph. The
+// counts are of what had expired in e.
+func (e *Executor) Expired(now time.Time) []Expiration {
+	cat := e.registry.Current()
+	g := e.graph
+	var (
+		out  []Expiration
+		adj  = make(map[string]*adjacency)
+		gone = make(map[string]map[int]bool) // edges deleted with their nodes, by type
+	)
+	// deleteEdges deletes the edges of edgeType at i, which run dir from
+	// the node id of nodeType while it is still expired
+	deleteEdges := func(edgeType string, dir parser.EdgeDirection, nodeType, id string, rule expiryRule, cutoff time.Time, at []int) {
+		n := 0
+		for _, i := range at {
+			if !gone[edgeType][i] {
+				gone[edgeType][i] = true
+				n++
+			}
+		}
+		if n == 0 {
+			return
+		}
+		stmt := &parser.MatchStmt{
+			Paths: []parser.PathPattern{{Elements: []parser.MatchElement{
+				{Type: nodeType, Alias: "n", Properties: []parser.Property{parser.Prop("_id", parser.Str(id))}},
+				{Type: edgeType, Alias: "k", IsEdge: true, Direction: dir},
+				{},
+			}}},
+			Filter: rule.filter("n", cutoff),
+			Delete: []string{"k"},
+		}
+		out = append(out, Expiration{Stmt: stmt, Type: edgeType, Count: n})
+	}
+	for _, name := range sortedKeys(cat.Nodes) {
+		rule, ok := expiryRuleOf(cat.Nodes[name].Fields)
+		if !ok || g.Nodes[name] == nil {
+			continue
+		}
+		cutoff := rule.cutoff(now)
+		var ids []string
+		g.Nodes[name].Range(func(id string, props map[string]interface{}) bool {
+			if rule.expired(props, cutoff) {
+				ids = append(ids, id)
+			}
+			return true
+		})
+		slices.SortFunc(ids, compareIDs)
+		for _, id := range ids {
+			for _, edgeType := range sortedKeys(cat.Edges) {
+				et := cat.Edges[edgeType]
+				if et.From.Label != name && et.To.Label != name || len(g.Edges[edgeType]) == 0 {
+					continue
+				}
+				if adj[edgeType] == nil {
+					adj[edgeType], gone[edgeType] = e.graph.adjacency(edgeType), make(map[int]bool)
+				}
+				if et.From.Label == name {
+					deleteEdges(edgeType, parser.DirOut, name, id, rule, cutoff, adj[edgeType].out[id])
+				}
+				if et.To.Label == name {
+					deleteEdges(edgeType, parser.DirIn, name, id, rule, cutoff, adj[edgeType].in[id])
+				}
+			}
+			del := parser.DeleteNode(name, parser.Prop("_id", parser.Str(id)))
+			del.Filter = rule.filter("", cutoff)
+			out = append(out, Expiration{Stmt: del, Node: true, Type: name, Count: 1})
+		}
+	}
+	for _, name := range sortedKeys(cat.Edges) {
+		rule, ok := expiryRuleOf(cat.Edges[name].Props)
+		if !ok {
+			continue
+		}
+		cutoff := rule.cutoff(now)
+		counts := map[string]int{}
+		var values []string
+		for i, inst := range g.Edges[name] {
+			if inst.Deleted() || gone[name][i] || !rule.expired(inst.Properties, cutoff) {
+				continue
+			}
+			v := inst.Properties[rule.field].(Temporal).String()
+			if counts[v] == 0 {
+				values = append(values, v)
+			}
+			counts[v]++
+		}
+		for _, v := range values {
+			del := parser.DeleteEdge(name, parser.Prop(rule.field, parser.Str(v)))
+			del.Filter = rule.filter("", cutoff)
+			out = append(out, Expiration{Stmt: del, Type: name, Count: counts[v]})
+		}
+	}
+	return out
+}
@@ -0,0 +1,446 @@
+package executor
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"grapho/catalog"
+	"grapho/parquet"
+	"grapho/parser"
+)
+
+/* ---------------------- EXPORT ---------------------- */
+
+// JSONLRecord is one line of a JSON Lines export. Nodes come first, ordered by
+// type and ID, then edges ordered by type and insertion order.
+type JSONLRecord struct {
+	Kind       string         `json:"kind"` // "node" or "edge"
+	Type       string         `json:"type"`
+	ID         string         `json:"id"`
+	From       string         `json:"from,omitempty"` // edges only: source node ID
+	To         string         `json:"to,omitempty"`   // edges only: target node ID
+	Properties map[string]any `json:"properties"`
+}
+
+// exportWriters maps file extensions to export formats
+var exportWriters = map[string]func(io.Writer, *exportSet) error{
+	".jsonl":   writeJSONL,
+	".ndjson":  writeJSONL,
+	".dot":     writeDOT,
+	".gv":      writeDOT,
+	".gexf":    writeGEXF,
+	".parquet": writeParquet,
+}
+
+// executeExport writes the graph, or the subgraph a MATCH selects, to the file
+// named by the statement
+func (e *Executor) executeExport(ctx context.Context, out Output, stmt *parser.ExportStmt) error {
+	ext := strings.ToLower(filepath.Ext(stmt.Path))
+	write, ok := exportWriters[ext]
+	if !ok {
+		return fmt.Errorf("unsupported export format '%s' (want .jsonl, .dot, .gexf or .parquet)", ext)
+	}
+	if ext == ".parquet" && stmt.NodeType == "" {
+		return fmt.Errorf("parquet export writes one node type; use EXPORT NODE <type> TO '%s'", stmt.Path)
+	}
+	set, err := e.collectExport(ctx, stmt)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(stmt.Path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = write(w, set)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(stmt.Path)
+		return err
+	}
+	if out != nil {
+		out.Message("Exported %d node(s) and %d edge(s) to %s", len(set.nodes), len(set.edges), stmt.Path)
+	}
+	return nil
+}
+
+// WriteJSONL writes the whole graph to w as JSON Lines, one JSONLRecord per
+// node and edge. int and float fields are written as JSON numbers.
+func (e *Executor) WriteJSONL(ctx context.Context, w io.Writer) error {
+	set, err := e.collectExport(ctx, &parser.ExportStmt{})
+	if err != nil {
+		return err
+	}
+	return writeJSONL(w, set)
+}
+
+// WriteDOT writes the whole graph to w as a Graphviz digraph
+func (e *Executor) WriteDOT(ctx context.Context, w io.Writer) error {
+	set, err := e.collectExport(ctx, &parser.ExportStmt{})
+	if err != nil {
+		return err
+	}
+	return writeDOT(w, set)
+}
+
+// WriteGEXF writes the whole graph to w as a GEXF document for Gephi
+func (e *Executor) WriteGEXF(ctx context.Context, w io.Writer) error {
+	set, err := e.collectExport(ctx, &parser.ExportStmt{})
+	if err != nil {
+		return err
+	}
+	return writeGEXF(w, set)
+}
+
+// WriteParquet writes the nodes of one type to w as a Parquet file
+func (e *Executor) WriteParquet(ctx context.Context, w io.Writer, nodeType string) error {
+	set, err := e.collectExport(ctx, &parser.ExportStmt{NodeType: nodeType})
+	if err != nil {
+		return err
+	}
+	return writeParquet(w, set)
+}
+
+// exportSet is the part of the graph an export writes, with typed properties
+type exportSet struct {
+	nodes []JSONLRecord
+	edges []JSONLRecord
+
+	cat      *catalog.Catalog
+	nodeType *catalog.NodeType // set by EXPORT NODE
+}
+
+// collectExport gathers what stmt exports: the whole graph, the nodes a MATCH
+// selects and the edges between them, the nodes and edges bound by the rows of
+// a path MATCH, or the nodes of one type
+func (e *Executor) collectExport(ctx context.Context, stmt *parser.ExportStmt) (*exportSet, error) {
+	cat := e.registry.Current()
+	set := &exportSet{cat: cat}
+	match := stmt.Match
+	var (
+		types []string
+		path  *pathExport // set by EXPORT of a path MATCH
+		found prepared
+	)
+	switch {
+	case stmt.NodeType != "":
+		nt, ok := cat.Nodes[stmt.NodeType]
+		if !ok {
+			return nil, notFound("node type '%s' does not exist", stmt.NodeType)
+		}
+		set.nodeType = nt
+		types = []string{stmt.NodeType}
+	case match == nil:
+		types = sortedKeys(e.graph.Nodes)
+	case len(match.Paths) > 0:
+		var err error
+		if path, err = e.collectPaths(ctx, match); err != nil {
+			return nil, err
+		}
+		for key := range path.nodes {
+			nodeType, _, _ := strings.Cut(key, "\x00")
+			if !slices.Contains(types, nodeType) {
+				types = append(types, nodeType)
+			}
+		}
+		slices.Sort(types)
+	default:
+		if err := checkAliases(cat, match); err != nil {
+			return nil, err
+		}
+		var err error
+		if found, err = e.prepareWhere(ctx, matchAliases(match), match.Filter); err != nil {
+			return nil, err
+		}
+		for _, el := range match.Pattern {
+			if !el.IsEdge && !slices.Contains(types, el.Type) {
+				types = append(types, el.Type)
+			}
+		}
+		slices.Sort(types)
+	}
+
+	selected := make(map[string]bool)
+	for _, nodeType := range types {
+		var fields map[string]catalog.FieldSpec
+		if nt, ok := cat.Nodes[nodeType]; ok {
+			fields = nt.Fields
+		}
+		where := match
+		sc := &whereScope{fields: fields, prepared: found}
+		if match != nil && path == nil {
+			sc.self = typeAlias(match, nodeType)
+			where = whereFor(match, sc.self)
+		}
+		hits, err := scanNodes(ctx, e.reader(), nodeType, func(props map[string]interface{}) bool {
+			if path != nil {
+				id, _ := props["_id"].(string)
+				return path.nodes[nodeKey(nodeType, id)]
+			}
+			return where == nil || e.matchesConditions(props, where.Where) && e.evalExpr(sc, props, where.Filter)
+		})
+		if err != nil {
+			return nil, err
+		}
+		slices.SortFunc(hits, func(a, b scanHit) int { return compareIDs(a.id, b.id) })
+		for _, hit := range hits {
+			props := make(map[string]any)
+			for name, v := range hit.props {
+				if name != "_id" {
+					props[name] = TypedValue(fields, name, v)
+				}
+			}
+			set.nodes = append(set.nodes, JSONLRecord{Kind: "node", Type: nodeType, ID: hit.id, Properties: props})
+			selected[nodeKey(nodeType, hit.id)] = true
+		}
+	}
+
+	if set.nodeType != nil {
+		return set, nil
+	}
+	for _, edgeType := range sortedKeys(e.graph.Edges) {
+		var fields map[string]catalog.FieldSpec
+		var from, to string
+		if et, ok := cat.Edges[edgeType]; ok {
+			fields, from, to = et.Props, et.From.Label, et.To.Label
+		}
+		for _, edge := range e.graph.Edges[edgeType] {
+			if edge.Deleted() || path != nil && !path.edges[edge.ID] || match != nil && !(selected[nodeKey(from, edge.FromNodeID)] && selected[nodeKey(to, edge.ToNodeID)]) {
+				continue
+			}
+			props := make(map[string]any, len(edge.Properties))
+			for name, v := range edge.Properties {
+				props[name] = TypedValue(fields, name, v)
+			}
+			set.edges = append(set.edges, JSONLRecord{Kind: "edge", Type: edgeType, ID: edge.ID, From: edge.FromNodeID, To: edge.ToNodeID, Properties: props})
+		}
+	}
+	return set, nil
+}
+
+// pathExport is what EXPORT of a path MATCH writes: every node and edge bound
+// in some row
+type pathExport struct {
+	nodes map[string]bool // by nodeKey
+	edges map[string]bool
+}
+
+// nodeKey names a node across types, whose IDs, being their primary keys,
+// may repeat
+func nodeKey(nodeType, id string) string {
+	return nodeType + "\x00" + id
+}
+
+func (e *Executor) collectPaths(ctx context.Context, match *parser.MatchStmt) (*pathExport, error) {
+	limit, err := matchLimit(lastStage(match))
+	if err != nil {
+		return nil, err
+	}
+	m, starts, err := e.stages(ctx, match)
+	if err != nil {
+		return nil, err
+	}
+	path := &pathExport{nodes: make(map[string]bool), edges: make(map[string]bool)}
+	if limit == 0 {
+		return path, nil
+	}
+	rows := 0
+	err = m.runFrom(starts, func() bool {
+		for i, v := range m.vars {
+			if b := m.bound[i]; v.isEdge {
+				for _, id := range b.edges {
+					path.edges[id] = true
+				}
+			} else {
+				path.nodes[nodeKey(b.typ, b.id)] = true
+			}
+		}
+		rows++
+		return limit < 0 || rows < limit
+	})
+	return path, err
+}
+
+func writeJSONL(w io.Writer, set *exportSet) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, rec := range append(set.nodes, set.edges...) {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDOT writes a digraph whose node labels show the type and properties
+// and whose edge labels show the type
+func writeDOT(w io.Writer, set *exportSet) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("digraph grapho {\n")
+	for _, n := range set.nodes {
+		fmt.Fprintf(bw, "  %s [label=%s];\n", dotQuote(n.ID), dotQuote(dotLabel(n)))
+	}
+	for _, e := range set.edges {
+		fmt.Fprintf(bw, "  %s -> %s [label=%s];\n", dotQuote(e.From), dotQuote(e.To), dotQuote(dotLabel(e)))
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// writeParquet writes one node type as columns: _id, then every field in name
+// order. int, float and bool fields keep their types; other fields are
+// strings, with arrays and JSON values written as JSON text.
+func writeParquet(w io.Writer, set *exportSet) error {
+	if set.nodeType == nil {
+		return fmt.Errorf("parquet export needs a node type")
+	}
+	fields := set.nodeType.Fields
+	names := sortedKeys(fields)
+	columns := []parquet.Column{{Name: "_id", Type: parquet.String}}
+	for _, name := range names {
+		typ := parquet.String
+		switch fields[name].Type.Base {
+		case catalog.BaseInt:
+			typ = parquet.Int64
+		case catalog.BaseFloat:
+			typ = parquet.Double
+		case catalog.BaseBool:
+			typ = parquet.Boolean
+		}
+		columns = append(columns, parquet.Column{Name: name, Type: typ})
+	}
+
+	rows := make([][]any, len(set.nodes))
+	for i, n := range set.nodes {
+		row := []any{n.ID}
+		for _, c := range columns[1:] {
+			v, err := parquetValue(c.Type, n.Properties[c.Name])
+			if err != nil {
+				return fmt.Errorf("node %s: field %s: %w", n.ID, c.Name, err)
+			}
+			row = append(row, v)
+		}
+		rows[i] = row
+	}
+	return parquet.Write(w, columns, rows)
+}
+
+// parquetValue converts a typed property to the Go type of a Parquet column
+func parquetValue(typ parquet.Type, v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch typ {
+	case parquet.Double:
+		if n, ok := v.(int64); ok {
+			return float64(n), nil
+		}
+	case parquet.Boolean:
+		if s, ok := v.(string); ok {
+			return strconv.ParseBool(s)
+		}
+	case parquet.String:
+		if _, ok := v.(string); !ok {
+			b, err := json.Marshal(v)
+			return string(b), err
+		}
+	}
+	return v, nil
+}
+
+// dotLabel is the type followed by one "name: value" line per property
+func dotLabel(rec JSONLRecord) string {
+	var b strings.Builder
+	b.WriteString(rec.Type)
+	for _, name := range sortedKeys(rec.Properties) {
+		v := rec.Properties[name]
+		if v == nil {
+			v = "null"
+		}
+		fmt.Fprintf(&b, "\n%s: %v", name, v)
+	}
+	return b.String()
+}
+
+// dotQuote quotes s as a DOT string; newlines become \n line breaks
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// TypedValue converts a stored property to an int64 or float64 where its
+// field type calls for one. Numbers are stored as text, so the field type
+// decides between an integer and a float. A Temporal becomes its text, a
+// JSON its document, with numbers as int64 or float64, and a Blob its
+// base64; other values are returned as is.
+func TypedValue(fields map[string]catalog.FieldSpec, field string, v any) any {
+	switch v := v.(type) {
+	case Temporal:
+		return v.String()
+	case JSON:
+		return plainJSON(v.Value())
+	case Blob:
+		return v.String()
+	}
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	switch fields[field].Type.Base {
+	case catalog.BaseInt:
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	case catalog.BaseFloat:
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return v
+}
+
+// typeAlias returns the alias of the first element of stmt matching nodeType
+func typeAlias(stmt *parser.MatchStmt, nodeType string) string {
+	for _, el := range stmt.Pattern {
+		if el.Type == nodeType && el.Alias != "" {
+			return el.Alias
+		}
+	}
+	return ""
+}
+
+// compareIDs orders IDs by text, but the digits they end in, as generated IDs
+// and edge_N do, by number
+func compareIDs(a, b string) int {
+	if c := cmp.Compare(strings.TrimRight(a, "0123456789"), strings.TrimRight(b, "0123456789")); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(len(a), len(b)); c != 0 {
+		return c
+	}
+	return cmp.Compare(a, b)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
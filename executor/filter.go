@@ -0,0 +1,717 @@
+package executor
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"grapho/catalog"
+	"grapho/parser"
+)
+
+/* ---------------------- WHERE expressions ---------------------- */
+
+// The name: value pairs a WHERE ANDs together are tested by matchesConditions,
+// which the scans can also use to rule out nodes unread. Everything else is
+// the statement's Filter, evaluated here for each node or edge left. IN,
+// BETWEEN, <, <=, > and >= compare values by the type the schema gives their
+// field: int and float fields as numbers, enums in the order their values were
+// declared, date, time and datetime fields in time, and the rest as text.
+// now() and date() are read once per statement, so every row is compared
+// with the same time. STARTS WITH, ENDS WITH,
+// CONTAINS and =~ test the text of a value, so they also work on numbers, and
+// =~ must match all of it. EXISTS (MATCH ...) holds when the path MATCH has a
+// row; a variable of it named like an alias of the outer MATCH, as p in
+// MATCH Person p WHERE EXISTS (MATCH (p)-[:WORKS_AT]->()), stands for the
+// node or edge being tested.
+
+// regexCacheSize bounds the number of compiled regular expressions kept
+const regexCacheSize = 256
+
+var regexCache struct {
+	sync.Mutex
+	m map[string]*regexp.Regexp
+}
+
+// compileRegex compiles the pattern of =~, reusing the last ones compiled
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	regexCache.Lock()
+	defer regexCache.Unlock()
+	if re, ok := regexCache.m[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+	if err != nil {
+		return nil, err
+	}
+	if regexCache.m == nil || len(regexCache.m) >= regexCacheSize {
+		regexCache.m = make(map[string]*regexp.Regexp)
+	}
+	regexCache.m[pattern] = re
+	return re, nil
+}
+
+// checkExpr reports the errors evalExpr would otherwise hide: the parser
+// checks regular expressions and durations too, but a cached plan binds new
+// ones without it
+func checkExpr(x parser.Expr) error {
+	var err error
+	if x == nil {
+		return nil
+	}
+	parser.Inspect(x, func(n parser.Node) bool {
+		switch n := n.(type) {
+		case *parser.StringMatch:
+			if n.Op != parser.RegexMatch {
+				break
+			}
+			if _, cerr := compileRegex(n.Pattern.Text); cerr != nil {
+				err = fmt.Errorf("%s =~ %s: invalid regular expression: %v", n.Field, n.Pattern.Text, cerr)
+			}
+		case *parser.TimeExpr:
+			for _, sh := range n.Shifts {
+				if _, derr := parser.ParseDuration(sh.Duration.Text); derr != nil && err == nil {
+					err = derr
+				}
+			}
+		}
+		return err == nil
+	})
+	return err
+}
+
+// whereScope is what a WHERE is evaluated in besides the row: the types of
+// the row's fields, and what prepareWhere found. A row is a node or edge of
+// the MATCH element named self, whose ID is its _id, or a row of a path MATCH
+// when self is "".
+type whereScope struct {
+	fields map[string]catalog.FieldSpec
+	self   string
+	prepared
+}
+
+// prepared is what prepareWhere works out once for a statement rather than
+// for each row: the rows of each EXISTS, and the value of each now() and
+// date()
+type prepared struct {
+	exists map[*parser.ExistsExpr]*existsRows
+	times  map[*parser.TimeExpr]*parser.Literal
+}
+
+// existsRows holds what the MATCH of an EXISTS found: the IDs of what its
+// variables named like an alias of the outer MATCH were bound to, joined, for
+// each of its rows
+type existsRows struct {
+	aliases []string
+	keys    map[string]struct{}
+}
+
+// prepareWhere checks xs, the filter and CASE conditions of a statement whose
+// aliases are outer, reads the clock for the now() and date() in them, and
+// runs the MATCH of each EXISTS. Each runs once, not once per row: the rows
+// it finds are then looked up by the IDs of the correlated aliases.
+func (e *Executor) prepareWhere(ctx context.Context, outer map[string]bool, xs ...parser.Expr) (prepared, error) {
+	var found prepared
+	var subs []*parser.ExistsExpr
+	var times []*parser.TimeExpr
+	for _, x := range xs {
+		if x == nil {
+			continue
+		}
+		if err := checkExpr(x); err != nil {
+			return found, err
+		}
+		parser.Inspect(x, func(n parser.Node) bool {
+			switch n := n.(type) {
+			case *parser.ExistsExpr:
+				subs = append(subs, n)
+				return false
+			case *parser.TimeExpr:
+				times = append(times, n)
+			}
+			return true
+		})
+	}
+	now := time.Now()
+	for _, t := range times {
+		lit, err := resolveTime(t, now)
+		if err != nil {
+			return found, err
+		}
+		if found.times == nil {
+			found.times = make(map[*parser.TimeExpr]*parser.Literal)
+		}
+		found.times[t] = lit
+	}
+	if len(subs) > 0 {
+		found.exists = make(map[*parser.ExistsExpr]*existsRows, len(subs))
+	}
+	for _, ex := range subs {
+		if len(ex.Match.Paths) == 0 {
+			return found, fmt.Errorf("EXISTS takes a path pattern, as in EXISTS (MATCH (p)-[:WORKS_AT]->())")
+		}
+		if ex.Match.With != nil {
+			return found, fmt.Errorf("the MATCH of EXISTS cannot have WITH")
+		}
+		m, err := e.newPathMatcher(ctx, ex.Match, nil)
+		if err != nil {
+			return found, fmt.Errorf("EXISTS: %w", err)
+		}
+		rows := &existsRows{keys: make(map[string]struct{})}
+		var vars []int
+		for i, v := range m.vars {
+			if v.name != "" && outer[v.name] {
+				rows.aliases = append(rows.aliases, v.name)
+				vars = append(vars, i)
+			}
+		}
+		ids := make([]string, len(vars))
+		err = m.run(func() bool {
+			for i, v := range vars {
+				ids[i] = m.bound[v].id
+			}
+			rows.keys[strings.Join(ids, "\x00")] = struct{}{}
+			// without correlated variables one row is enough
+			return len(vars) > 0
+		})
+		if err != nil {
+			return found, err
+		}
+		found.exists[ex] = rows
+	}
+	return found, nil
+}
+
+// scopeFor checks where and filter, the WHERE of a statement on typ that has
+// no aliases, and returns the scope to evaluate it in
+func (e *Executor) scopeFor(ctx context.Context, typ string, where []parser.Property, filter parser.Expr) (*whereScope, error) {
+	fields := typeFields(e.registry.Current(), typ)
+	names := exprFields(filter)
+	for _, p := range where {
+		names = append(names, p.Name)
+	}
+	for _, name := range names {
+		if field, _, ok := strings.Cut(name, "."); ok && fields != nil && !isJSONField(fields, field) {
+			return nil, fmt.Errorf("WHERE: %s has no json field '%s' to read %s from", typ, field, name)
+		}
+	}
+	found, err := e.prepareWhere(ctx, nil, filter)
+	if err != nil {
+		return nil, err
+	}
+	return &whereScope{fields: fields, prepared: found}, nil
+}
+
+// isJSONField reports whether fields declares field as json
+func isJSONField(fields map[string]catalog.FieldSpec, field string) bool {
+	spec, ok := fields[field]
+	return ok && spec.Type.Base == catalog.BaseJSON && spec.Type.Elem == nil
+}
+
+// holds reports whether the EXISTS x has a row for props
+func (sc *whereScope) holds(x *parser.ExistsExpr, props map[string]interface{}) bool {
+	rows := sc.exists[x]
+	if rows == nil {
+		return false
+	}
+	ids := make([]string, len(rows.aliases))
+	for i, alias := range rows.aliases {
+		key := alias + "._id"
+		if alias == sc.self {
+			key = "_id"
+		}
+		id, ok := props[key].(string)
+		if !ok {
+			return false
+		}
+		ids[i] = id
+	}
+	_, ok := rows.keys[strings.Join(ids, "\x00")]
+	return ok
+}
+
+// evalExpr reports whether props, a row of sc, satisfy x; a nil x is always
+// satisfied
+func (e *Executor) evalExpr(sc *whereScope, props map[string]interface{}, x parser.Expr) bool {
+	switch x := x.(type) {
+	case nil:
+		return true
+	case *parser.Property:
+		return e.matchesConditions(props, []parser.Property{*x})
+	case *parser.LogicalExpr:
+		if x.Op == parser.Or {
+			return e.evalExpr(sc, props, x.Left) || e.evalExpr(sc, props, x.Right)
+		}
+		return e.evalExpr(sc, props, x.Left) && e.evalExpr(sc, props, x.Right)
+	case *parser.NotExpr:
+		return !e.evalExpr(sc, props, x.X)
+	case *parser.ExistsExpr:
+		return sc.holds(x, props)
+	case *parser.InExpr:
+		v, ok := fieldValue(props, x.Field)
+		if !ok {
+			return unset(props, x.Field) && slices.ContainsFunc(x.Values, func(lit *parser.Literal) bool { return lit.Kind == parser.LitNull })
+		}
+		for _, lit := range x.Values {
+			if lit.Kind == parser.LitNull {
+				if v == nil {
+					return true
+				}
+				continue
+			}
+			if c, ok := e.compareValue(sc.fields, x.Field, v, lit); ok && c == 0 {
+				return true
+			}
+		}
+		return false
+	case *parser.BetweenExpr:
+		v, ok := fieldValue(props, x.Field)
+		if !ok {
+			return false
+		}
+		lo, okLo := e.compareValue(sc.fields, x.Field, v, x.Low)
+		hi, okHi := e.compareValue(sc.fields, x.Field, v, x.High)
+		return okLo && okHi && lo >= 0 && hi <= 0
+	case *parser.CompareExpr:
+		v, ok := fieldValue(props, x.Field)
+		if !ok {
+			return false
+		}
+		lit := x.Value
+		if x.Time != nil {
+			lit = sc.times[x.Time]
+		}
+		c, ok := e.compareValue(sc.fields, x.Field, v, lit)
+		if !ok {
+			return false
+		}
+		switch x.Op {
+		case parser.Less:
+			return c < 0
+		case parser.LessEq:
+			return c <= 0
+		case parser.Greater:
+			return c > 0
+		}
+		return c >= 0
+	case *parser.StringMatch:
+		field, _ := fieldValue(props, x.Field)
+		v, ok := field.(string)
+		if s, isText := field.(fmt.Stringer); isText {
+			// a time, JSON document or blob
+			v, ok = s.String(), true
+		}
+		if !ok {
+			return false
+		}
+		switch x.Op {
+		case parser.StartsWith:
+			return strings.HasPrefix(v, x.Pattern.Text)
+		case parser.EndsWith:
+			return strings.HasSuffix(v, x.Pattern.Text)
+		case parser.Contains:
+			return strings.Contains(v, x.Pattern.Text)
+		}
+		re, err := compileRegex(x.Pattern.Text)
+		return err == nil && re.MatchString(v)
+	}
+	// MATCHES and WITHIN are only parsed as plain conditions, which never
+	// reach here
+	return false
+}
+
+// evalCase returns the value of c for props, a row of sc
+func (e *Executor) evalCase(sc *whereScope, props map[string]interface{}, c *parser.CaseExpr) interface{} {
+	if lit := e.caseLiteral(sc, props, c); lit != nil {
+		return storedValue(lit)
+	}
+	return nil
+}
+
+// caseLiteral returns the literal c gives for props, a row of sc: the THEN
+// of the first WHEN whose condition props satisfy, else the ELSE, which is
+// nil when c has none
+func (e *Executor) caseLiteral(sc *whereScope, props map[string]interface{}, c *parser.CaseExpr) *parser.Literal {
+	for _, w := range c.Whens {
+		if e.evalExpr(sc, props, w.Cond) {
+			return w.Then
+		}
+	}
+	return c.Else
+}
+
+// compareValue compares v, a stored value of field, with lit, as the type
+// fields declare for it. A field the schema does not declare, such as _id,
+// is compared as a number when lit is one. It reports false when the two
+// cannot be compared, as when either is null or not a number a numeric field
+// needs.
+func (e *Executor) compareValue(fields map[string]catalog.FieldSpec, field string, v interface{}, lit *parser.Literal) (int, bool) {
+	if lit == nil {
+		return 0, false
+	}
+	switch v := v.(type) {
+	case JSON:
+		if lit.Kind == parser.LitJSON {
+			return strings.Compare(v.String(), lit.Text), true
+		}
+		if other, ok := jsonLiteral(lit); ok {
+			return strings.Compare(v.String(), other.String()), true
+		}
+		return 0, false
+	case Blob:
+		if other, ok := blobLiteral(lit); ok {
+			return strings.Compare(v.String(), other.String()), true
+		}
+		return 0, false
+	case Temporal:
+		if lit.Kind != parser.LitString {
+			return 0, false
+		}
+		if c, ok := e.compareTemporal(v.base, v.t, lit.Text); ok {
+			return c, true
+		}
+		return strings.Compare(v.String(), lit.Text), true
+	case bool:
+		if lit.Kind != parser.LitBool {
+			return 0, false
+		}
+		b := lit.Text == "true"
+		switch {
+		case v == b:
+			return 0, true
+		case b:
+			return -1, true
+		}
+		return 1, true
+	case string:
+		if lit.Kind != parser.LitString && lit.Kind != parser.LitNumber {
+			return 0, false
+		}
+		spec, declared := fields[field]
+		t := spec.Type
+		switch {
+		case declared && t.Elem == nil && (t.Base == catalog.BaseInt || t.Base == catalog.BaseFloat),
+			!declared && lit.Kind == parser.LitNumber:
+			a, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return 0, false
+			}
+			b, err := strconv.ParseFloat(lit.Text, 64)
+			if err != nil {
+				return 0, false
+			}
+			return cmp.Compare(a, b), true
+		case len(t.EnumVals) > 0:
+			i, j := slices.Index(t.EnumVals, v), slices.Index(t.EnumVals, lit.Text)
+			if i < 0 || j < 0 {
+				return 0, false
+			}
+			return cmp.Compare(i, j), true
+		case declared && isTemporal(spec):
+			// the text of a stored time, as an index holds it
+			if a, ok := e.parseTemporal(t.Base, v); ok {
+				return e.compareValue(fields, field, a, lit)
+			}
+		}
+		return strings.Compare(v, lit.Text), true
+	}
+	return 0, false
+}
+
+// typeFields returns the fields of typ, a node type or else an edge type,
+// nil if it does not exist
+func typeFields(cat *catalog.Catalog, typ string) map[string]catalog.FieldSpec {
+	if nt, ok := cat.Nodes[typ]; ok {
+		return nt.Fields
+	}
+	if et, ok := cat.Edges[typ]; ok {
+		return et.Props
+	}
+	return nil
+}
+
+// conditionField returns the field n tests, if it is a condition on one, or
+// the field it reads, if it is one of a SET expression
+func conditionField(n parser.Node) (string, bool) {
+	switch n := n.(type) {
+	case *parser.Property:
+		return n.Name, true
+	case *parser.InExpr:
+		return n.Field, true
+	case *parser.BetweenExpr:
+		return n.Field, true
+	case *parser.CompareExpr:
+		return n.Field, true
+	case *parser.StringMatch:
+		return n.Field, true
+	case *parser.FieldRef:
+		return n.Name, true
+	}
+	return "", false
+}
+
+// exprAliases returns the aliases the conditions in x qualify their fields
+// with, as in p.name: 'Ann', and whether some field has none. An EXISTS uses
+// the aliases in outer that its variables are named after.
+func exprAliases(x parser.Node, outer map[string]bool) (aliases []string, bare bool) {
+	add := func(alias string) {
+		if !slices.Contains(aliases, alias) {
+			aliases = append(aliases, alias)
+		}
+	}
+	parser.Inspect(x, func(n parser.Node) bool {
+		if ex, ok := n.(*parser.ExistsExpr); ok {
+			for _, path := range ex.Match.Paths {
+				for _, el := range path.Elements {
+					if outer[el.Alias] {
+						add(el.Alias)
+					}
+				}
+			}
+			return false
+		}
+		if name, ok := conditionField(n); ok {
+			alias, _, ok := strings.Cut(name, ".")
+			if !ok {
+				bare = true
+			} else {
+				add(alias)
+			}
+		}
+		return true
+	})
+	return aliases, bare
+}
+
+// exprFields returns the fields the conditions in x test, as written, leaving
+// out those inside EXISTS, which its own MATCH checks
+func exprFields(x parser.Node) []string {
+	var fields []string
+	parser.Inspect(x, func(n parser.Node) bool {
+		if _, ok := n.(*parser.ExistsExpr); ok {
+			return false
+		}
+		if name, ok := conditionField(n); ok {
+			fields = append(fields, name)
+		}
+		return true
+	})
+	return fields
+}
+
+// matchAliases returns the aliases of the elements of a MATCH of types
+func matchAliases(stmt *parser.MatchStmt) map[string]bool {
+	known := make(map[string]bool)
+	for _, el := range stmt.Pattern {
+		if el.Alias != "" {
+			known[el.Alias] = true
+		}
+	}
+	return known
+}
+
+// conjuncts splits x into the conditions it ANDs
+func conjuncts(x parser.Expr) []parser.Expr {
+	if l, ok := x.(*parser.LogicalExpr); ok && l.Op == parser.And {
+		return append(conjuncts(l.Left), conjuncts(l.Right)...)
+	}
+	if x == nil {
+		return nil
+	}
+	return []parser.Expr{x}
+}
+
+// andExpr returns l AND r, or r if l is nil
+func andExpr(l, r parser.Expr) parser.Expr {
+	if l == nil {
+		return r
+	}
+	return &parser.LogicalExpr{Op: parser.And, Left: l, Right: r}
+}
+
+// checkAliases checks the aliases in the WHERE of a MATCH of node and edge
+// types: each must name an element whose type has the field, and a
+// condition ANDed with the others may only use one, since each element is
+// matched on its own
+func checkAliases(cat *catalog.Catalog, stmt *parser.MatchStmt) error {
+	known := matchAliases(stmt)
+	var terms []parser.Node
+	for i := range stmt.Where {
+		terms = append(terms, &stmt.Where[i])
+	}
+	for _, x := range conjuncts(stmt.Filter) {
+		terms = append(terms, x)
+	}
+	for _, x := range terms {
+		aliases := knownAliases(x, known)
+		all, _ := exprAliases(x, known)
+		for _, alias := range all {
+			if !known[alias] && !patternHasJSON(cat, stmt, alias) {
+				return fmt.Errorf("WHERE: '%s' is not an alias of the MATCH", alias)
+			}
+		}
+		if len(aliases) > 1 {
+			return fmt.Errorf("WHERE: conditions on '%s' and '%s' can only be combined with AND, since each type is matched on its own", aliases[0], aliases[1])
+		}
+		for _, name := range exprFields(x) {
+			if err := checkAliasField(cat, stmt, "WHERE", name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// knownAliases returns the aliases in known that the conditions in x
+// qualify their fields with. A dotted name whose first part is no alias is a
+// path into a json field.
+func knownAliases(x parser.Node, known map[string]bool) []string {
+	aliases, _ := exprAliases(x, known)
+	return slices.DeleteFunc(aliases, func(alias string) bool { return !known[alias] })
+}
+
+// patternHasJSON reports whether an element of a MATCH of node and edge
+// types has a json field called field
+func patternHasJSON(cat *catalog.Catalog, stmt *parser.MatchStmt, field string) bool {
+	for _, el := range stmt.Pattern {
+		if isJSONField(typeFields(cat, el.Type), field) {
+			return true
+		}
+	}
+	return false
+}
+
+// orderFor returns the ORDER BY of a MATCH of node and edge types with its
+// field as the types hold it: ORDER BY SIMILARITY(d.embedding, ...) ranks by
+// embedding, once the alias is found to have it
+func orderFor(cat *catalog.Catalog, stmt *parser.MatchStmt) (*parser.VectorOrder, error) {
+	order := stmt.OrderBy
+	if order == nil {
+		return nil, nil
+	}
+	alias, field, ok := strings.Cut(order.Field, ".")
+	if !ok {
+		return order, nil
+	}
+	if !matchAliases(stmt)[alias] {
+		return nil, fmt.Errorf("ORDER BY: '%s' is not an alias of the MATCH", alias)
+	}
+	if err := checkAliasField(cat, stmt, "ORDER BY", order.Field); err != nil {
+		return nil, err
+	}
+	// the statement may be a cached plan, so it is copied, not changed
+	cp := *order
+	cp.Field = field
+	return &cp, nil
+}
+
+// checkAliasField checks that name, in clause of a MATCH of node and edge
+// types, is a field of the element's type if it is written alias.field, or
+// alias.field.key for a json field
+func checkAliasField(cat *catalog.Catalog, stmt *parser.MatchStmt, clause, name string) error {
+	alias, field, ok := strings.Cut(name, ".")
+	if !ok || !matchAliases(stmt)[alias] {
+		return nil
+	}
+	field, path, _ := strings.Cut(field, ".")
+	for _, el := range stmt.Pattern {
+		_, isNode := cat.Nodes[el.Type]
+		_, isEdge := cat.Edges[el.Type]
+		if el.Alias != alias || !isNode && !isEdge {
+			continue
+		}
+		if !typeHasField(cat, el.Type, field) {
+			return fmt.Errorf("%s: %s has no field '%s'", clause, el.Type, field)
+		}
+		if path != "" && !isJSONField(typeFields(cat, el.Type), field) {
+			return fmt.Errorf("%s: %s has no json field '%s' to read %s from", clause, el.Type, field, name)
+		}
+	}
+	return nil
+}
+
+// whereFor returns stmt with the WHERE as it applies to the element of the
+// MATCH named alias: its conditions on alias.field test field, and those on
+// the other elements are left out
+func whereFor(stmt *parser.MatchStmt, alias string) *parser.MatchStmt {
+	known := matchAliases(stmt)
+	qualified := false
+	for _, p := range stmt.Where {
+		a, _, ok := strings.Cut(p.Name, ".")
+		qualified = qualified || ok && known[a]
+	}
+	if stmt.Filter != nil {
+		qualified = qualified || len(knownAliases(stmt.Filter, known)) > 0
+	}
+	if !qualified {
+		return stmt
+	}
+	// the statement may be a cached plan, so it is copied, not changed
+	cp := *stmt
+	cp.Where, cp.Filter = nil, nil
+	for _, p := range stmt.Where {
+		a, field, ok := strings.Cut(p.Name, ".")
+		ok = ok && known[a]
+		if ok && a != alias {
+			continue
+		}
+		if ok {
+			p.Name = field
+		}
+		cp.Where = append(cp.Where, p)
+	}
+	for _, x := range conjuncts(stmt.Filter) {
+		if aliases := knownAliases(x, known); len(aliases) > 0 && aliases[0] != alias {
+			continue
+		}
+		cp.Filter = andExpr(cp.Filter, stripAlias(x, alias))
+	}
+	return &cp
+}
+
+// stripAlias returns a copy of x whose conditions on alias.field test field
+func stripAlias(x parser.Expr, alias string) parser.Expr {
+	strip := func(name string) string {
+		if a, field, ok := strings.Cut(name, "."); ok && a == alias {
+			return field
+		}
+		return name
+	}
+	switch x := x.(type) {
+	case *parser.Property:
+		c := *x
+		c.Name = strip(c.Name)
+		return &c
+	case *parser.InExpr:
+		c := *x
+		c.Field = strip(c.Field)
+		return &c
+	case *parser.BetweenExpr:
+		c := *x
+		c.Field = strip(c.Field)
+		return &c
+	case *parser.CompareExpr:
+		c := *x
+		c.Field = strip(c.Field)
+		return &c
+	case *parser.StringMatch:
+		c := *x
+		c.Field = strip(c.Field)
+		return &c
+	case *parser.LogicalExpr:
+		c := *x
+		c.Left, c.Right = stripAlias(x.Left, alias), stripAlias(x.Right, alias)
+		return &c
+	case *parser.NotExpr:
+		c := *x
+		c.X = stripAlias(x.X, alias)
+		return &c
+	}
+	return x
+}
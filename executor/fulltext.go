@@ -0,0 +1,222 @@
+package executor
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"unicode"
+
+	"grapho/parser"
+)
+
+/* ---------------------- Full-text search ---------------------- */
+
+// CREATE FULLTEXT INDEX ON Type(field, ...) keeps an inverted index per field,
+// mapping each word of the field's text to the nodes containing it. Words are
+// runs of letters and digits, lowercased; WITH STEMMING also strips common
+// English endings, so that "graphs" and "graph" index alike. MATCHES(field,
+// 'words') holds for nodes whose field contains every word of the query,
+// looked up in the index rather than by reading the nodes.
+//
+// The index is built when it is created and kept up to date as nodes are
+// stored and deleted. Like the other per-field indexes it is copied before its
+// first change after a snapshot, a word's node list only when that word
+// changes, and snapshots never build one of their own.
+
+type textIndex struct {
+	stem  bool
+	terms map[string]*posting
+	epoch uint64 // see NodeSet.epochs
+}
+
+// posting lists the nodes containing a word, or those in a geohash cell
+type posting struct {
+	ids   map[string]struct{}
+	epoch uint64
+}
+
+// buildTextIndex indexes field of every node in s, replacing any index of it
+func (s *NodeSet) buildTextIndex(epoch uint64, field string, stem bool) *textIndex {
+	idx := &textIndex{stem: stem, terms: make(map[string]*posting), epoch: epoch}
+	s.Range(func(id string, props map[string]interface{}) bool {
+		for term := range fieldTerms(props[field], stem) {
+			ownPosting(idx.terms, epoch, term).ids[id] = struct{}{}
+		}
+		return true
+	})
+	if s.text == nil {
+		s.text = make(map[string]*textIndex)
+	}
+	s.text[intern(field)] = idx
+	return idx
+}
+
+// textIndex returns the index of field, building it if there is none or it
+// was built with another stemming setting
+func (s *NodeSet) textIndex(epoch uint64, field string, stem bool) *textIndex {
+	if idx := s.text[field]; idx != nil && idx.stem == stem {
+		return idx
+	}
+	return s.buildTextIndex(epoch, field, stem)
+}
+
+// indexText updates the indexes for a node changing from old to props; old is
+// nil for a new node and props nil for a deleted one
+func (s *NodeSet) indexText(epoch uint64, id string, old, props map[string]interface{}) {
+	for field, idx := range s.text {
+		before, _ := old[field].(string)
+		after, _ := props[field].(string)
+		if before == after && (old == nil) == (props == nil) {
+			continue
+		}
+		if idx.epoch != epoch {
+			// a snapshot may share it
+			idx = &textIndex{stem: idx.stem, terms: maps.Clone(idx.terms), epoch: epoch}
+			s.text[field] = idx
+		}
+		was, is := fieldTerms(old[field], idx.stem), fieldTerms(props[field], idx.stem)
+		for term := range was {
+			if _, ok := is[term]; !ok {
+				removePosting(idx.terms, epoch, term, id)
+			}
+		}
+		for term := range is {
+			if _, ok := was[term]; !ok {
+				ownPosting(idx.terms, epoch, term).ids[id] = struct{}{}
+			}
+		}
+	}
+}
+
+// ownPosting returns the node list of key in m for writing, creating it or
+// copying it from a snapshot as needed
+func ownPosting(m map[string]*posting, epoch uint64, key string) *posting {
+	p := m[key]
+	switch {
+	case p == nil:
+		p = &posting{ids: make(map[string]struct{}), epoch: epoch}
+		m[key] = p
+	case p.epoch != epoch:
+		p = &posting{ids: maps.Clone(p.ids), epoch: epoch}
+		m[key] = p
+	}
+	return p
+}
+
+// removePosting takes id off the node list of key in m, dropping the list
+// once it is empty
+func removePosting(m map[string]*posting, epoch uint64, key, id string) {
+	if m[key] == nil {
+		return
+	}
+	p := ownPosting(m, epoch, key)
+	delete(p.ids, id)
+	if len(p.ids) == 0 {
+		delete(m, key)
+	}
+}
+
+// words splits text into lowercase words, stemmed if stem is set
+func words(text string, stem bool) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if stem {
+		for i, w := range fields {
+			fields[i] = stemWord(w)
+		}
+	}
+	return fields
+}
+
+// fieldTerms returns the distinct words of a stored value
+func fieldTerms(v interface{}, stem bool) map[string]struct{} {
+	text, ok := v.(string)
+	if !ok {
+		return nil
+	}
+	terms := make(map[string]struct{})
+	for _, w := range words(text, stem) {
+		terms[w] = struct{}{}
+	}
+	return terms
+}
+
+// stemWord strips common English endings: plural s and es, ing and ed. It is
+// deliberately light; stripping more conflates unrelated words.
+func stemWord(w string) string {
+	if len(w) <= 3 {
+		return w
+	}
+	switch {
+	case strings.HasSuffix(w, "ies"):
+		return w[:len(w)-3] + "y"
+	case strings.HasSuffix(w, "sses"), strings.HasSuffix(w, "shes"), strings.HasSuffix(w, "ches"), strings.HasSuffix(w, "xes"):
+		return w[:len(w)-2]
+	case strings.HasSuffix(w, "ss"), strings.HasSuffix(w, "us"), strings.HasSuffix(w, "is"):
+		return w
+	case strings.HasSuffix(w, "s"):
+		return w[:len(w)-1]
+	}
+	for _, suffix := range []string{"ing", "ed"} {
+		if strings.HasSuffix(w, suffix) && len(w)-len(suffix) >= 3 && !strings.HasSuffix(w, "eed") {
+			w = w[:len(w)-len(suffix)]
+			// running -> run, but falling -> fall
+			if n := len(w); w[n-1] == w[n-2] && !strings.ContainsRune("aeiouls", rune(w[n-1])) {
+				w = w[:n-1]
+			}
+			return w
+		}
+	}
+	return w
+}
+
+// textFilters narrows a MATCH down by the MATCHES conditions in search: each
+// word of a query must be in the index of its field. Snapshots without an
+// index look for the words in the text instead. A query without words matches
+// nothing.
+func (e *Executor) textFilters(nodeType string, set *NodeSet, search []parser.TextMatch) ([]indexFilter, error) {
+	if len(search) == 0 {
+		return nil, nil
+	}
+	nt, ok := e.registry.Current().Nodes[nodeType]
+	if !ok {
+		return nil, notFound("node type '%s' does not exist", nodeType)
+	}
+	var filters []indexFilter
+	for _, m := range search {
+		spec, ok := nt.Fulltext[m.Field]
+		if !ok {
+			return nil, fmt.Errorf("%s.%s has no full-text index", nodeType, m.Field)
+		}
+		terms := words(m.Query.Text, spec.Stem)
+		if len(terms) == 0 {
+			filters = append(filters, indexFilter{ids: map[string]struct{}{}})
+			continue
+		}
+		if set != nil && (!e.readOnly || set.text[m.Field] != nil && set.text[m.Field].stem == spec.Stem) {
+			idx := set.textIndex(e.graph.epoch, m.Field, spec.Stem)
+			for _, term := range terms {
+				var ids map[string]struct{}
+				if p := idx.terms[term]; p != nil {
+					ids = p.ids
+				} else {
+					ids = map[string]struct{}{}
+				}
+				filters = append(filters, indexFilter{ids: ids})
+			}
+			continue
+		}
+		field, stem := m.Field, spec.Stem
+		filters = append(filters, indexFilter{keep: func(props map[string]interface{}) bool {
+			have := fieldTerms(props[field], stem)
+			for _, term := range terms {
+				if _, ok := have[term]; !ok {
+					return false
+				}
+			}
+			return true
+		}})
+	}
+	return filters, nil
+}
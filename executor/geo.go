@@ -0,0 +1,316 @@
+package executor
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"strconv"
+	"strings"
+
+	"grapho/catalog"
+	"grapho/parser"
+)
+
+/* ---------------------- Geospatial search ---------------------- */
+
+// A point field holds a location as text, 'latitude, longitude' in degrees.
+// WITHIN(field, 'lat, lon', radius) keeps the nodes within radius of a centre,
+// measured along the earth's surface, and ORDER BY DISTANCE(field, 'lat, lon')
+// puts the nearest first. An index per node type and field files each node
+// under the geohash of its point at a few lengths, so WITHIN only reads the
+// nodes in the cells covering its circle. Like the vector index it is built
+// the first time a query needs it, kept up to date as nodes are stored and
+// deleted, and never built by snapshots, which check every node instead.
+
+// earthRadius is the mean radius of the earth in metres
+const earthRadius = 6371008.8
+
+// geoLevels are the geohash lengths nodes are filed under, for cells about
+// 156 km, 4.9 km and 153 m across
+var geoLevels = [...]int{3, 5, 7}
+
+// geoMaxCells is the most cells WITHIN looks up; a circle that needs more even
+// at the coarsest level is answered by checking every node
+const geoMaxCells = 64
+
+// distanceUnits are the units a WITHIN radius may be given in, in metres
+var distanceUnits = map[string]float64{"": 1, "m": 1, "km": 1000, "mi": 1609.344}
+
+type geoPoint struct {
+	lat, lon float64
+}
+
+type geoIndex struct {
+	cells [len(geoLevels)]map[string]*posting // by geohash
+	epoch uint64                              // see NodeSet.epochs
+}
+
+// parsePoint reads the text of a point value
+func parsePoint(s string) (geoPoint, error) {
+	lat, lon, ok := strings.Cut(s, ",")
+	if !ok {
+		return geoPoint{}, fmt.Errorf("point must be written as 'latitude, longitude'")
+	}
+	var p geoPoint
+	var err error
+	if p.lat, err = strconv.ParseFloat(strings.TrimSpace(lat), 64); err != nil || math.Abs(p.lat) > 90 {
+		return geoPoint{}, fmt.Errorf("latitude %q is not a number from -90 to 90", strings.TrimSpace(lat))
+	}
+	if p.lon, err = strconv.ParseFloat(strings.TrimSpace(lon), 64); err != nil || math.Abs(p.lon) > 180 {
+		return geoPoint{}, fmt.Errorf("longitude %q is not a number from -180 to 180", strings.TrimSpace(lon))
+	}
+	return p, nil
+}
+
+// storedPoint parses a stored point value
+func storedPoint(v interface{}) (geoPoint, bool) {
+	text, ok := v.(string)
+	if !ok {
+		return geoPoint{}, false
+	}
+	p, err := parsePoint(text)
+	return p, err == nil
+}
+
+// checkPoints rejects values of point fields that are not points
+func checkPoints(typeName string, fields map[string]catalog.FieldSpec, props []parser.Property) error {
+	for _, p := range props {
+		spec, ok := fields[p.Name]
+		if !ok || spec.Type.Base != catalog.BasePoint || spec.Type.Elem != nil || p.Value == nil || p.Value.Kind == parser.LitNull {
+			continue
+		}
+		var err error
+		if p.Value.Kind != parser.LitString {
+			err = fmt.Errorf("point must be written as a string, e.g. '52.52, 13.405'")
+		} else {
+			_, err = parsePoint(p.Value.Text)
+		}
+		if err != nil {
+			return &ConstraintError{
+				Type:       typeName,
+				Field:      p.Name,
+				Constraint: "point",
+				msg:        fmt.Sprintf("field '%s' is a point: %v", p.Name, err),
+			}
+		}
+	}
+	return nil
+}
+
+// geoIndex returns the index of field, building it from the nodes if needed
+func (s *NodeSet) geoIndex(epoch uint64, field string) *geoIndex {
+	if idx := s.geo[field]; idx != nil {
+		return idx
+	}
+	idx := &geoIndex{epoch: epoch}
+	for i := range idx.cells {
+		idx.cells[i] = make(map[string]*posting)
+	}
+	s.Range(func(id string, props map[string]interface{}) bool {
+		if p, ok := storedPoint(props[field]); ok {
+			idx.file(epoch, id, p)
+		}
+		return true
+	})
+	if s.geo == nil {
+		s.geo = make(map[string]*geoIndex)
+	}
+	s.geo[intern(field)] = idx
+	return idx
+}
+
+// indexPoints refiles a node changing from old to props; old is nil for a new
+// node and props nil for a deleted one
+func (s *NodeSet) indexPoints(epoch uint64, id string, old, props map[string]interface{}) {
+	for field, idx := range s.geo {
+		before, hadPoint := storedPoint(old[field])
+		after, hasPoint := storedPoint(props[field])
+		if hadPoint == hasPoint && before == after {
+			continue
+		}
+		if idx.epoch != epoch {
+			// a snapshot may share it
+			cp := &geoIndex{epoch: epoch}
+			for i := range idx.cells {
+				cp.cells[i] = maps.Clone(idx.cells[i])
+			}
+			idx = cp
+			s.geo[field] = idx
+		}
+		if hadPoint {
+			for i, n := range geoLevels {
+				removePosting(idx.cells[i], epoch, geohash(before, n), id)
+			}
+		}
+		if hasPoint {
+			idx.file(epoch, id, after)
+		}
+	}
+}
+
+func (idx *geoIndex) file(epoch uint64, id string, p geoPoint) {
+	for i, n := range geoLevels {
+		ownPosting(idx.cells[i], epoch, geohash(p, n)).ids[id] = struct{}{}
+	}
+}
+
+// within returns the nodes filed in the cells covering the circle around c
+// of radius r metres, or nil if that takes more than geoMaxCells cells
+func (idx *geoIndex) within(c geoPoint, r float64) map[string]struct{} {
+	for i := len(geoLevels) - 1; i >= 0; i-- {
+		cells, ok := coveringCells(c, r, geoLevels[i])
+		if !ok {
+			continue
+		}
+		ids := make(map[string]struct{})
+		for _, cell := range cells {
+			if p := idx.cells[i][cell]; p != nil {
+				for id := range p.ids {
+					ids[id] = struct{}{}
+				}
+			}
+		}
+		return ids
+	}
+	return nil
+}
+
+// coveringCells returns the geohashes of length n covering the bounding box
+// of the circle around c of radius r metres, unless there are more than
+// geoMaxCells of them
+func coveringCells(c geoPoint, r float64, n int) ([]string, bool) {
+	lonBits, latBits := (5*n+1)/2, 5*n/2
+	w, h := 360/math.Exp2(float64(lonBits)), 180/math.Exp2(float64(latBits))
+
+	dLat := r / earthRadius * 180 / math.Pi
+	minLat, maxLat := c.lat-dLat, c.lat+dLat
+	if minLat <= -90 || maxLat >= 90 {
+		return nil, false // the circle covers a pole
+	}
+	cos := math.Min(math.Cos(minLat*math.Pi/180), math.Cos(maxLat*math.Pi/180))
+	dLon := dLat / cos
+	if dLon >= 180 {
+		return nil, false
+	}
+	rows := int(math.Floor((maxLat+90)/h)-math.Floor((minLat+90)/h)) + 1
+	cols := int(math.Floor((c.lon+dLon+180)/w)-math.Floor((c.lon-dLon+180)/w)) + 1
+	if rows*cols > geoMaxCells {
+		return nil, false
+	}
+	cells := make([]string, 0, rows*cols)
+	lat0 := math.Floor((minLat+90)/h)*h - 90 + h/2
+	lon0 := math.Floor((c.lon-dLon+180)/w)*w - 180 + w/2
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			lon := lon0 + float64(j)*w
+			// wrap around the antimeridian
+			if lon >= 180 {
+				lon -= 360
+			} else if lon < -180 {
+				lon += 360
+			}
+			cells = append(cells, geohash(geoPoint{lat0 + float64(i)*h, lon}, n))
+		}
+	}
+	return cells, true
+}
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// geohash returns the geohash of p of length n
+func geohash(p geoPoint, n int) string {
+	latLo, latHi, lonLo, lonHi := -90.0, 90.0, -180.0, 180.0
+	b := make([]byte, n)
+	ch, bit, even := 0, 0, true
+	for i := 0; i < n; {
+		if even {
+			mid := (lonLo + lonHi) / 2
+			if p.lon >= mid {
+				ch, lonLo = ch<<1|1, mid
+			} else {
+				ch, lonHi = ch<<1, mid
+			}
+		} else {
+			mid := (latLo + latHi) / 2
+			if p.lat >= mid {
+				ch, latLo = ch<<1|1, mid
+			} else {
+				ch, latHi = ch<<1, mid
+			}
+		}
+		even = !even
+		if bit++; bit == 5 {
+			b[i] = geohashAlphabet[ch]
+			i++
+			ch, bit = 0, 0
+		}
+	}
+	return string(b)
+}
+
+// haversine returns the distance between a and b in metres
+func haversine(a, b geoPoint) float64 {
+	const rad = math.Pi / 180
+	dLat, dLon := (b.lat-a.lat)*rad, (b.lon-a.lon)*rad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(a.lat*rad)*math.Cos(b.lat*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// geoFilters narrows a MATCH down by the WITHIN conditions in within: the
+// index gives the nodes near each centre, whose distance is then checked
+func (e *Executor) geoFilters(nodeType string, set *NodeSet, within []parser.GeoWithin) ([]indexFilter, error) {
+	if len(within) == 0 {
+		return nil, nil
+	}
+	nt, ok := e.registry.Current().Nodes[nodeType]
+	if !ok {
+		return nil, notFound("node type '%s' does not exist", nodeType)
+	}
+	var filters []indexFilter
+	for _, w := range within {
+		spec, ok := nt.Fields[w.Field]
+		if !ok || spec.Type.Base != catalog.BasePoint || spec.Type.Elem != nil {
+			return nil, fmt.Errorf("%s.%s is not a point field", nodeType, w.Field)
+		}
+		center, err := parsePoint(w.Center.Text)
+		if err != nil {
+			return nil, fmt.Errorf("WITHIN centre: %w", err)
+		}
+		r, err := strconv.ParseFloat(w.Radius.Text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("WITHIN radius must be a number, got %s", w.Radius.Text)
+		}
+		r *= distanceUnits[w.Unit]
+
+		field := w.Field
+		f := indexFilter{keep: func(props map[string]interface{}) bool {
+			p, ok := storedPoint(props[field])
+			return ok && haversine(center, p) <= r
+		}}
+		if set != nil && (set.geo[field] != nil || !e.readOnly) {
+			f.ids = set.geoIndex(e.graph.epoch, field).within(center, r)
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// rankByPoint scores hits, the nodes of nodeType a MATCH selected, by their
+// distance in metres from the point of order. Nodes without a point are
+// dropped.
+func rankByPoint(nodeType string, order *parser.VectorOrder, hits []scanHit) ([]rankedHit, error) {
+	if order.Metric != parser.L2 {
+		return nil, fmt.Errorf("%s.%s is a point field: order it by DISTANCE", nodeType, order.Field)
+	}
+	from, err := parsePoint(order.Vector.Text)
+	if err != nil {
+		return nil, fmt.Errorf("query point: %w", err)
+	}
+	ranked := make([]rankedHit, 0, len(hits))
+	for _, hit := range hits {
+		if p, ok := storedPoint(hit.props[order.Field]); ok {
+			ranked = append(ranked, rankedHit{nodeType, hit, haversine(from, p)})
+		}
+	}
+	return ranked, nil
+}
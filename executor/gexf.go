@@ -0,0 +1,195 @@
+package executor
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"grapho/catalog"
+)
+
+// In GEXF exports each node and edge is labelled with its type and carries
+// every property as a typed attribute. When the exported types have a date or datetime field
+// named created_at, the graph is dynamic: each element starts at its
+// created_at, so Gephi's timeline shows the graph growing.
+
+const gexfNS = "http://gexf.net/1.3"
+
+// gexfTimeField is the field that dates nodes and edges in a dynamic graph
+const gexfTimeField = "created_at"
+
+// gexfAttr is an attribute declared for one class, nodes or edges
+type gexfAttr struct {
+	id, typ string
+}
+
+func writeGEXF(w io.Writer, set *exportSet) error {
+	nodeFields := make(map[string]map[string]catalog.FieldSpec)
+	edgeFields := make(map[string]map[string]catalog.FieldSpec)
+	for _, n := range set.nodes {
+		if nt, ok := set.cat.Nodes[n.Type]; ok {
+			nodeFields[n.Type] = nt.Fields
+		}
+	}
+	for _, e := range set.edges {
+		if et, ok := set.cat.Edges[e.Type]; ok {
+			edgeFields[e.Type] = et.Props
+		}
+	}
+	timeFormat := gexfTimeFormat(nodeFields, edgeFields)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<gexf xmlns=%q version=\"1.3\">\n", gexfNS)
+	if timeFormat != "" {
+		fmt.Fprintf(bw, "  <graph defaultedgetype=\"directed\" mode=\"dynamic\" timeformat=%q>\n", timeFormat)
+	} else {
+		bw.WriteString("  <graph defaultedgetype=\"directed\" mode=\"static\">\n")
+	}
+	nodeAttrs := gexfAttributes(bw, "node", "n", nodeFields)
+	edgeAttrs := gexfAttributes(bw, "edge", "e", edgeFields)
+
+	bw.WriteString("    <nodes>\n")
+	for _, n := range set.nodes {
+		fmt.Fprintf(bw, "      <node id=\"%s\" label=\"%s\"%s>", gexfEscape(n.ID), gexfEscape(n.Type), gexfStart(n, nodeFields[n.Type], timeFormat))
+		writeGEXFValues(bw, n, nodeAttrs)
+		bw.WriteString("</node>\n")
+	}
+	bw.WriteString("    </nodes>\n    <edges>\n")
+	for _, e := range set.edges {
+		fmt.Fprintf(bw, "      <edge id=\"%s\" source=\"%s\" target=\"%s\" label=\"%s\"%s>",
+			gexfEscape(e.ID), gexfEscape(e.From), gexfEscape(e.To), gexfEscape(e.Type), gexfStart(e, edgeFields[e.Type], timeFormat))
+		writeGEXFValues(bw, e, edgeAttrs)
+		bw.WriteString("</edge>\n")
+	}
+	bw.WriteString("    </edges>\n  </graph>\n</gexf>\n")
+	return bw.Flush()
+}
+
+// gexfAttributes declares the type attribute and one attribute per property
+// name, and returns them by name. A name used with different types in
+// different element types is declared as a string.
+func gexfAttributes(w io.Writer, class, prefix string, fieldsByType map[string]map[string]catalog.FieldSpec) map[string]gexfAttr {
+	types := make(map[string]string)
+	for _, fields := range fieldsByType {
+		for name, f := range fields {
+			typ := gexfType(f.Type)
+			if prev, ok := types[name]; ok && prev != typ {
+				typ = "string"
+			}
+			types[name] = typ
+		}
+	}
+	attrs := make(map[string]gexfAttr, len(types))
+	fmt.Fprintf(w, "    <attributes class=%q>\n", class)
+	fmt.Fprintf(w, "      <attribute id=\"%s_type\" title=\"_type\" type=\"string\"/>\n", prefix)
+	for i, name := range sortedKeys(types) {
+		a := gexfAttr{id: fmt.Sprintf("%s%d", prefix, i), typ: types[name]}
+		attrs[name] = a
+		fmt.Fprintf(w, "      <attribute id=%q title=\"%s\" type=%q/>\n", a.id, gexfEscape(name), a.typ)
+	}
+	io.WriteString(w, "    </attributes>\n")
+	return attrs
+}
+
+func writeGEXFValues(w io.Writer, rec JSONLRecord, attrs map[string]gexfAttr) {
+	prefix := "n"
+	if rec.Kind == "edge" {
+		prefix = "e"
+	}
+	fmt.Fprintf(w, "<attvalues><attvalue for=\"%s_type\" value=\"%s\"/>", prefix, gexfEscape(rec.Type))
+	for _, name := range sortedKeys(rec.Properties) {
+		a, ok := attrs[name]
+		v := rec.Properties[name]
+		if !ok || v == nil {
+			continue
+		}
+		s, isString := v.(string)
+		if !isString {
+			if a.typ == "string" {
+				b, _ := json.Marshal(v)
+				s = string(b)
+			} else {
+				s = fmt.Sprint(v)
+			}
+		}
+		fmt.Fprintf(w, "<attvalue for=%q value=\"%s\"/>", a.id, gexfEscape(s))
+	}
+	io.WriteString(w, "</attvalues>")
+}
+
+// gexfType maps a field type to a GEXF attribute type
+func gexfType(t catalog.TypeSpec) string {
+	if t.Elem != nil || len(t.EnumVals) > 0 {
+		return "string"
+	}
+	switch t.Base {
+	case catalog.BaseInt:
+		return "long"
+	case catalog.BaseFloat:
+		return "double"
+	case catalog.BaseBool:
+		return "boolean"
+	default:
+		return "string"
+	}
+}
+
+// gexfTimeFormat is "date" when every created_at field is a date, "dateTime"
+// when some are datetimes, and "" when there are none and the graph is static
+func gexfTimeFormat(fieldsByType ...map[string]map[string]catalog.FieldSpec) string {
+	format := ""
+	for _, m := range fieldsByType {
+		for _, fields := range m {
+			f, ok := fields[gexfTimeField]
+			if !ok || f.Type.Elem != nil {
+				continue
+			}
+			switch f.Type.Base {
+			case catalog.BaseDate:
+				if format == "" {
+					format = "date"
+				}
+			case catalog.BaseDateTime:
+				format = "dateTime"
+			}
+		}
+	}
+	return format
+}
+
+// gexfTimeLayouts are the datetime spellings accepted for created_at
+var gexfTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", time.DateTime, time.DateOnly}
+
+// gexfStart is the start attribute of an element with a created_at value, or
+// "" if the graph is static or the element has no usable value
+func gexfStart(rec JSONLRecord, fields map[string]catalog.FieldSpec, format string) string {
+	s, ok := rec.Properties[gexfTimeField].(string)
+	if format == "" || !ok {
+		return ""
+	}
+	if b := fields[gexfTimeField].Type.Base; b != catalog.BaseDate && b != catalog.BaseDateTime {
+		return ""
+	}
+	for _, layout := range gexfTimeLayouts {
+		t, err := time.Parse(layout, strings.TrimSpace(s))
+		if err != nil {
+			continue
+		}
+		if format == "date" {
+			return ` start="` + t.Format(time.DateOnly) + `"`
+		}
+		return ` start="` + t.Format(time.RFC3339) + `"`
+	}
+	return ""
+}
+
+// gexfEscape escapes s for an XML attribute value
+func gexfEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,416 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"grapho/catalog"
+)
+
+/* ---------------------- Graph stores ---------------------- */
+
+// Queries are served from the graph in memory, and a GraphStore keeps it on
+// disk, as a catalog.Store keeps the catalog: LoadData fills the graph from
+// one, and CommitData writes it the nodes and edges each command changed.
+// The data file is the store a data directory has; any other, such as an
+// embedded key-value database, can stand in for it without the executor
+// telling the difference. Statements read nodes and edges through a
+// GraphReader too, scanning a type with ScanType and following the edges of a
+// node with Neighbors; the graph in memory is the reader they are given, and
+// every store can read what it holds the same way.
+
+// GraphWriter takes the schema, nodes and edges of a graph, a change at a time
+type GraphWriter interface {
+	PutCatalog(cat *catalog.Catalog) error
+	PutNode(nodeType, id string, props map[string]interface{}) error
+	DeleteNode(nodeType, id string) error
+	// PutEdge stores edge in place of the edge of edgeType with its ID, if
+	// there is one, or else after the others
+	PutEdge(edgeType string, edge EdgeInstance) error
+	DeleteEdge(edgeType, id string) error
+	// DropNodes deletes all the nodes of nodeType, and DropEdges all the
+	// edges of edgeType
+	DropNodes(nodeType string) error
+	DropEdges(edgeType string) error
+}
+
+// GraphReader reads the nodes and edges of a graph
+type GraphReader interface {
+	// ScanType calls fn with each node of nodeType, in no particular order,
+	// until fn returns false. fn may be called from several goroutines at
+	// once, and must not change props.
+	ScanType(ctx context.Context, nodeType string, fn func(id string, props map[string]interface{}) bool) error
+	// Neighbors calls fn with each edge of edgeType that leaves the node id,
+	// or enters it if in is set, in the order of their list, until fn returns
+	// false. fn must not keep or change inst.
+	Neighbors(ctx context.Context, edgeType, id string, in bool, fn func(inst *EdgeInstance) bool) error
+}
+
+// GraphStore abstracts where the graph is kept. The writes between two
+// commits are kept together or, after a crash, not at all, and its reads see
+// the graph as of the last commit.
+type GraphStore interface {
+	GraphWriter
+	GraphReader
+	// Load writes the graph as of the last commit to w, in the order it was
+	// written, and returns the next generated ID it recorded, or 0 if the
+	// store is empty
+	Load(ctx context.Context, w GraphWriter) (nextID int64, err error)
+	// Commit ends the writes since the last one, recording the next generated
+	// ID and the number of commit log entries whose changes the store holds
+	Commit(nextID int64, entries int) error
+	// Entries returns the entries recorded by the last commit
+	Entries() int
+	Close() error
+}
+
+// dataChanges lists the nodes and edges statements wrote since the last
+// CommitData, and the types they dropped before writing them
+type dataChanges struct {
+	nodes        map[string]map[string]bool // node IDs by type
+	edges        map[string]map[string]int  // edge IDs by type, to their index when written
+	droppedNodes []string
+	droppedEdges []string
+}
+
+func newDataChanges() *dataChanges {
+	return &dataChanges{nodes: make(map[string]map[string]bool), edges: make(map[string]map[string]int)}
+}
+
+// empty reports whether nothing was written
+func (c *dataChanges) empty() bool {
+	return len(c.nodes) == 0 && len(c.edges) == 0 && len(c.droppedNodes) == 0 && len(c.droppedEdges) == 0
+}
+
+// nodeWritten notes that the node of nodeType with id was stored or deleted
+func (g *GraphData) nodeWritten(nodeType, id string) {
+	if g.changes == nil {
+		return
+	}
+	ids := g.changes.nodes[nodeType]
+	if ids == nil {
+		ids = make(map[string]bool)
+		g.changes.nodes[nodeType] = ids
+	}
+	ids[id] = true
+}
+
+// dropNodes deletes the nodes of nodeType, as a dropped type leaves none
+func (g *GraphData) dropNodes(nodeType string) {
+	delete(g.Nodes, nodeType)
+	if g.changes != nil {
+		delete(g.changes.nodes, nodeType)
+		g.changes.droppedNodes = append(g.changes.droppedNodes, nodeType)
+	}
+}
+
+// dropEdges deletes the edges of edgeType, as a dropped type leaves none
+func (g *GraphData) dropEdges(edgeType string) {
+	delete(g.Edges, edgeType)
+	delete(g.edgeEpochs, edgeType)
+	delete(g.adj, edgeType)
+	delete(g.dead, edgeType)
+	if g.changes != nil {
+		delete(g.changes.edges, edgeType)
+		g.changes.droppedEdges = append(g.changes.droppedEdges, edgeType)
+	}
+}
+
+// edgeWritten notes that the edge of edgeType with id was stored at index i
+// of its list, or deleted if i is -1
+func (g *GraphData) edgeWritten(edgeType, id string, i int) {
+	if g.changes == nil {
+		return
+	}
+	at := g.changes.edges[edgeType]
+	if at == nil {
+		at = make(map[string]int)
+		g.changes.edges[edgeType] = at
+	}
+	at[id] = i
+}
+
+// LoadData fills the graph, which must be empty, from st and makes
+// CommitData write to it from then on. The commit log entries after the
+// first st.Entries() are to be replayed next, then committed.
+func (e *Executor) LoadData(ctx context.Context, st GraphStore) error {
+	l := &graphLoader{e: e, edgeAt: make(map[string]map[string]int)}
+	nextID, err := st.Load(ctx, l)
+	if err != nil {
+		return err
+	}
+	l.finish()
+	if nextID != 0 {
+		e.graph.NextID = nextID
+	}
+	e.store, e.storedVersion = st, l.version
+	e.graph.changes = newDataChanges()
+	return nil
+}
+
+// CommitData writes the nodes and edges statements changed since the last
+// call to the store LoadData read, and the catalog if it changed, then
+// commits them as the changes of the first entries entries of the commit
+// log. It does nothing if no store is loaded.
+func (e *Executor) CommitData(entries int) error {
+	st, c := e.store, e.graph.changes
+	if st == nil {
+		return nil
+	}
+	cat := e.registry.Current()
+	if c.empty() && entries == st.Entries() && cat.Version == e.storedVersion {
+		return nil
+	}
+	if cat.Version != e.storedVersion {
+		// first, as the nodes are loaded into the types it gives
+		if err := st.PutCatalog(cat); err != nil {
+			return err
+		}
+	}
+	// then the drops, which the writes after them recreate the types of
+	for _, nodeType := range c.droppedNodes {
+		if err := st.DropNodes(nodeType); err != nil {
+			return fmt.Errorf("node type %s: %w", nodeType, err)
+		}
+	}
+	for _, edgeType := range c.droppedEdges {
+		if err := st.DropEdges(edgeType); err != nil {
+			return fmt.Errorf("edge type %s: %w", edgeType, err)
+		}
+	}
+	for _, nodeType := range sortedKeys(c.nodes) {
+		ids := sortedKeys(c.nodes[nodeType])
+		slices.SortFunc(ids, compareIDs)
+		for _, id := range ids {
+			var err error
+			props, ok := e.graph.nodeProps(nodeType, id)
+			if ok {
+				err = st.PutNode(nodeType, id, props)
+			} else {
+				err = st.DeleteNode(nodeType, id)
+			}
+			if err != nil {
+				return fmt.Errorf("node %s: %w", id, err)
+			}
+		}
+	}
+	for _, edgeType := range sortedKeys(c.edges) {
+		if err := e.storeEdges(st, edgeType, c.edges[edgeType]); err != nil {
+			return err
+		}
+	}
+	if err := st.Commit(e.graph.NextID, entries); err != nil {
+		return err
+	}
+	e.storedVersion = cat.Version
+	e.graph.changes = newDataChanges()
+	return nil
+}
+
+// CopyData loads st, which must be empty, writes the catalog and every node
+// and edge to it, and commits them as the changes of the first entries
+// entries of the commit log. Nodes go in ID order and edges in the order of
+// their lists. Like CollectStats it must be serialized with statements, or
+// run on a snapshot, which is how backups copy the graph while writes go on.
+func (e *Executor) CopyData(ctx context.Context, st GraphStore, entries int) error {
+	if _, err := st.Load(ctx, notEmpty{}); err != nil {
+		return err
+	}
+	if err := st.PutCatalog(e.registry.Current()); err != nil {
+		return err
+	}
+	g := e.graph
+	for _, nodeType := range sortedKeys(g.Nodes) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		set := g.Nodes[nodeType]
+		ids := set.IDs()
+		slices.SortFunc(ids, compareIDs)
+		for _, id := range ids {
+			props, _ := set.Get(id)
+			if err := st.PutNode(nodeType, id, props); err != nil {
+				return fmt.Errorf("node %s: %w", id, err)
+			}
+		}
+	}
+	for _, edgeType := range sortedKeys(g.Edges) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, inst := range g.Edges[edgeType] {
+			if inst.Deleted() {
+				continue
+			}
+			if err := st.PutEdge(edgeType, inst); err != nil {
+				return fmt.Errorf("edge %s: %w", inst.ID, err)
+			}
+		}
+	}
+	return st.Commit(g.NextID, entries)
+}
+
+// notEmpty is the GraphWriter CopyData loads its store into, failing at
+// anything the store holds
+type notEmpty struct{}
+
+var errNotEmpty = errors.New("graph store is not empty")
+
+func (notEmpty) PutCatalog(*catalog.Catalog) error                    { return errNotEmpty }
+func (notEmpty) PutNode(string, string, map[string]interface{}) error { return errNotEmpty }
+func (notEmpty) DeleteNode(string, string) error                      { return errNotEmpty }
+func (notEmpty) PutEdge(string, EdgeInstance) error                   { return errNotEmpty }
+func (notEmpty) DeleteEdge(string, string) error                      { return errNotEmpty }
+func (notEmpty) DropNodes(string) error                               { return errNotEmpty }
+func (notEmpty) DropEdges(string) error                               { return errNotEmpty }
+
+// nodeProps returns the properties of the node of nodeType with id, if it
+// exists
+func (g *GraphData) nodeProps(nodeType, id string) (map[string]interface{}, bool) {
+	set := g.Nodes[nodeType]
+	if set == nil {
+		return nil, false
+	}
+	return set.Get(id)
+}
+
+// storeEdges writes the edges of edgeType in written to w: the deletions,
+// then the edges stored, in the order of their list
+func (e *Executor) storeEdges(w GraphWriter, edgeType string, written map[string]int) error {
+	edges := e.graph.Edges[edgeType]
+	at := make([]int, 0, len(written))
+	for id, i := range written {
+		if i < 0 || i >= len(edges) || edges[i].ID != id {
+			// deleted, or moved up by a deletion: look for them all
+			at = at[:0]
+			for i, inst := range edges {
+				if _, ok := written[inst.ID]; ok {
+					at = append(at, i)
+				}
+			}
+			break
+		}
+		at = append(at, i)
+	}
+	slices.Sort(at)
+	stored := make(map[string]bool, len(at))
+	for _, i := range at {
+		stored[edges[i].ID] = true
+	}
+	ids := sortedKeys(written)
+	slices.SortFunc(ids, compareIDs)
+	for _, id := range ids {
+		if stored[id] {
+			continue
+		}
+		if err := w.DeleteEdge(edgeType, id); err != nil {
+			return fmt.Errorf("edge %s: %w", id, err)
+		}
+	}
+	for _, i := range at {
+		if err := w.PutEdge(edgeType, edges[i]); err != nil {
+			return fmt.Errorf("edge %s: %w", edges[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// graphLoader is the GraphWriter LoadData fills the graph with
+type graphLoader struct {
+	e       *Executor
+	edgeAt  map[string]map[string]int // index of each edge in its list, by type
+	holes   bool                      // an edge was deleted; see finish
+	version uint64                    // of the catalog last restored
+}
+
+func (l *graphLoader) PutCatalog(cat *catalog.Catalog) error {
+	if cat == nil {
+		return errors.New("no catalog")
+	}
+	l.e.registry.Restore(cat)
+	l.version = cat.Version
+	return nil
+}
+
+// nodeSet returns the nodes of nodeType, creating the set if need be
+func (l *graphLoader) nodeSet(nodeType string) *NodeSet {
+	g := l.e.graph
+	set := g.Nodes[nodeType]
+	if set == nil {
+		key := ""
+		if nt, ok := l.e.registry.Current().Nodes[nodeType]; ok {
+			key = nt.PK
+		}
+		set = newNodeSet(g.epoch, g.partitions, key)
+		g.Nodes[intern(nodeType)] = set
+	}
+	return set
+}
+
+func (l *graphLoader) PutNode(nodeType, id string, props map[string]interface{}) error {
+	l.nodeSet(nodeType).put(l.e.graph.epoch, id, props)
+	return nil
+}
+
+func (l *graphLoader) putSegment(nodeType string, seg *segment, bad []int) error {
+	seg.cache = l.e.cache
+	return l.nodeSet(nodeType).attach(l.e.graph.epoch, seg, bad)
+}
+
+func (l *graphLoader) DeleteNode(nodeType, id string) error {
+	g := l.e.graph
+	if set := g.Nodes[nodeType]; set != nil {
+		set.delete(g.epoch, id)
+	}
+	return nil
+}
+
+func (l *graphLoader) PutEdge(edgeType string, edge EdgeInstance) error {
+	g := l.e.graph
+	at := l.edgeAt[edgeType]
+	if at == nil {
+		at = make(map[string]int)
+		l.edgeAt[intern(edgeType)] = at
+	}
+	if i, ok := at[edge.ID]; ok {
+		g.Edges[edgeType][i] = edge
+		return nil
+	}
+	at[edge.ID] = len(g.Edges[edgeType])
+	g.Edges[intern(edgeType)] = append(g.Edges[edgeType], edge)
+	return nil
+}
+
+func (l *graphLoader) DeleteEdge(edgeType, id string) error {
+	at := l.edgeAt[edgeType]
+	if i, ok := at[id]; ok {
+		// a tombstone until finish
+		l.e.graph.Edges[edgeType][i] = EdgeInstance{}
+		delete(at, id)
+		l.holes = true
+	}
+	return nil
+}
+
+func (l *graphLoader) DropNodes(nodeType string) error {
+	delete(l.e.graph.Nodes, nodeType)
+	return nil
+}
+
+func (l *graphLoader) DropEdges(edgeType string) error {
+	delete(l.e.graph.Edges, edgeType)
+	delete(l.edgeAt, edgeType)
+	return nil
+}
+
+// finish drops the tombstones of the edges deleted
+func (l *graphLoader) finish() {
+	if !l.holes {
+		return
+	}
+	for edgeType, edges := range l.e.graph.Edges {
+		l.e.graph.setEdges(edgeType, slices.DeleteFunc(edges, func(inst EdgeInstance) bool { return inst.Deleted() }))
+	}
+}
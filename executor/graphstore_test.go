@@ -0,0 +1,107 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// readerScript fills a graph whose Person nodes and KNOWS edges have been
+// written, rewritten and deleted; readGraph lists seven lines of it
+const readerScript = `
+CREATE NODE Person (name: string PRIMARY KEY, born: date);
+CREATE EDGE KNOWS (FROM Person MANY, TO Person MANY, PROPS (since: int));
+INSERT NODE Person (name: 'ann', born: '1990-01-02');
+INSERT NODE Person (name: 'bob');
+INSERT NODE Person (name: 'cy');
+INSERT EDGE KNOWS FROM Person('ann') TO Person('bob') (since: 1);
+INSERT EDGE KNOWS FROM Person('bob') TO Person('cy') (since: 2);
+INSERT EDGE KNOWS FROM Person('cy') TO Person('cy') (since: 3);
+DELETE EDGE KNOWS WHERE since: 1;
+UPDATE EDGE KNOWS SET since: 4 WHERE since: 2;
+UPDATE NODE Person SET born: '1991-01-01' WHERE name: 'bob';
+DELETE NODE Person WHERE name: 'ann';
+INSERT NODE Person (name: 'dee');`
+
+// readGraph lists what r holds of the nodes of nodeType and the edges of
+// edgeType at them, sorted
+func readGraph(t *testing.T, r GraphReader, nodeType, edgeType string) []string {
+	t.Helper()
+	ctx := context.Background()
+	var (
+		mu    sync.Mutex
+		ids   []string
+		lines []string
+	)
+	err := r.ScanType(ctx, nodeType, func(id string, props map[string]interface{}) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		ids = append(ids, id)
+		lines = append(lines, fmt.Sprintf("node %s %v", id, props))
+		return true
+	})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	for _, id := range ids {
+		for _, in := range []bool{false, true} {
+			err := r.Neighbors(ctx, edgeType, id, in, func(inst *EdgeInstance) bool {
+				lines = append(lines, fmt.Sprintf("at %s in %v: %s %s->%s %v", id, in, inst.ID, inst.FromNodeID, inst.ToNodeID, inst.Properties))
+				return true
+			})
+			if err != nil {
+				t.Fatalf("neighbors: %v", err)
+			}
+		}
+	}
+	slices.Sort(lines)
+	return lines
+}
+
+func TestGraphReaders(t *testing.T) {
+	dir := t.TempDir()
+	e, df := openData(t, dir)
+	run(t, e, 1, readerScript)
+	want := readGraph(t, e.Graph(), "Person", "KNOWS")
+	if len(want) != 7 {
+		t.Fatalf("read from memory:\n%s", strings.Join(want, "\n"))
+	}
+	if got := readGraph(t, e.Snapshot().Graph(), "Person", "KNOWS"); !slices.Equal(got, want) {
+		t.Errorf("read from a snapshot:\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if got := readGraph(t, df, "Person", "KNOWS"); !slices.Equal(got, want) {
+		t.Errorf("read from the data file:\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// writes show once committed
+	if err := df.PutNode("Person", "zed", map[string]interface{}{"name": "zed"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readGraph(t, df, "Person", "KNOWS"); len(got) != len(want) {
+		t.Errorf("read an uncommitted node: %v", got)
+	}
+	if err := df.Commit(100, df.Entries()); err != nil {
+		t.Fatal(err)
+	}
+	if got := readGraph(t, df, "Person", "KNOWS"); len(got) != len(want)+1 {
+		t.Errorf("missed a committed node: %v", got)
+	}
+
+	// a reader stops when fn says so
+	seen := 0
+	err := df.ScanType(context.Background(), "Person", func(string, map[string]interface{}) bool {
+		seen++
+		return false
+	})
+	if err != nil || seen != 1 {
+		t.Errorf("scan went on for %d nodes after fn returned false: %v", seen, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := df.Neighbors(ctx, "KNOWS", "cy", true, func(*EdgeInstance) bool { return true }); err == nil {
+		t.Errorf("followed the edges of a node with the context done")
+	}
+}
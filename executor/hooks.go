@@ -0,0 +1,86 @@
+package executor
+
+import (
+	"context"
+	"time"
+
+	"grapho/parser"
+)
+
+// Hook observes and can veto statement execution, e.g. for auditing, caching
+// or per-tenant access checks. Hooks do not run for commit log replay.
+type Hook interface {
+	// BeforeStatement runs before stmt. Returning an error rejects the
+	// statement; the error is reported as the statement's failure.
+	BeforeStatement(ctx context.Context, stmt parser.Stmt) error
+	// AfterStatement runs after every statement, including rejected ones
+	AfterStatement(ctx context.Context, stmt parser.Stmt, res Result)
+}
+
+// Result describes how a statement went
+type Result struct {
+	Err      error
+	Rows     int // rows delivered to the output
+	Duration time.Duration
+}
+
+// AddHook registers h. Hooks run in the order they were added; add them before
+// executing statements, as the hook list is not guarded against concurrent use.
+func (e *Executor) AddHook(h Hook) {
+	e.hooks = append(e.hooks, h)
+}
+
+// executeHooked runs stmt surrounded by the registered hooks
+func (e *Executor) executeHooked(ctx context.Context, out Output, stmt parser.Stmt) error {
+	start := time.Now()
+	counter := &rowCounter{out: out}
+
+	var err error
+	for _, h := range e.hooks {
+		if err = h.BeforeStatement(ctx, stmt); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = e.execute(ctx, counter, stmt)
+	}
+
+	res := Result{Err: err, Rows: counter.rows, Duration: time.Since(start)}
+	for _, h := range e.hooks {
+		h.AfterStatement(ctx, stmt, res)
+	}
+	return err
+}
+
+// rowCounter forwards to an optional Output while counting rows
+type rowCounter struct {
+	out  Output
+	rows int
+}
+
+func (c *rowCounter) Message(format string, args ...any) {
+	if c.out != nil {
+		c.out.Message(format, args...)
+	}
+}
+
+func (c *rowCounter) Changed(ch Change, msg string) {
+	if r, ok := c.out.(Recorder); ok {
+		r.Changed(ch, msg)
+	} else if c.out != nil {
+		c.out.Message("%s", msg)
+	}
+}
+
+func (c *rowCounter) ResultSet() {
+	if c.out != nil {
+		c.out.ResultSet()
+	}
+}
+
+func (c *rowCounter) Row(nodeType, id string, props map[string]interface{}) {
+	c.rows++
+	if c.out != nil {
+		c.out.Row(nodeType, id, props)
+	}
+}
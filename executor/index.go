@@ -0,0 +1,387 @@
+package executor
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+
+	"grapho/catalog"
+	"grapho/parser"
+)
+
+/* ---------------------- Secondary indexes ---------------------- */
+
+// A node field declared INDEX, UNIQUE or PRIMARY KEY has an index mapping
+// each of its values to the nodes holding it. A WHERE that tests such a field
+// with name: value, IN, BETWEEN, <, <=, > or >=, ANDed with anything else,
+// reads only the nodes the index gives for the most selective of those
+// conditions and checks them against the whole WHERE, rather than scan every
+// node. name: value looks its value up; the others look values up in order,
+// as the comparisons order them. The index sorts its values on the first such
+// lookup, and again after a write adds a value or takes the last node away
+// from one. A WHERE no index narrows, such as one with OR at its top, scans
+// as before. Like the other indexes, one is built the first time a statement
+// needs it, snapshots never build one, and it is kept up to date as nodes are
+// stored and deleted.
+
+type fieldIndex struct {
+	ids    map[string]*idSet // nodes by value
+	sorted []string          // the values in order; nil until a range lookup
+	epoch  uint64            // see NodeSet.epochs
+}
+
+// idSet holds the nodes with one value of an indexed field: in few while
+// there are at most idSetFew, as there are for most values of a UNIQUE or
+// near-unique field, and in many from then on
+type idSet struct {
+	few   []string
+	many  map[string]struct{}
+	epoch uint64 // see NodeSet.epochs
+}
+
+const idSetFew = 8
+
+func (s *idSet) len() int {
+	if s.many != nil {
+		return len(s.many)
+	}
+	return len(s.few)
+}
+
+func (s *idSet) has(id string) bool {
+	if s.many != nil {
+		_, ok := s.many[id]
+		return ok
+	}
+	return slices.Contains(s.few, id)
+}
+
+func (s *idSet) add(id string) {
+	switch {
+	case s.many != nil:
+		s.many[id] = struct{}{}
+	case len(s.few) < idSetFew:
+		s.few = append(s.few, id)
+	default:
+		s.many = make(map[string]struct{}, 2*idSetFew)
+		for _, id := range s.few {
+			s.many[id] = struct{}{}
+		}
+		s.many[id] = struct{}{}
+		s.few = nil
+	}
+}
+
+func (s *idSet) remove(id string) {
+	if s.many != nil {
+		delete(s.many, id)
+		return
+	}
+	if i := slices.Index(s.few, id); i >= 0 {
+		s.few = slices.Delete(s.few, i, i+1)
+	}
+}
+
+// appendTo appends the IDs of s to ids
+func (s *idSet) appendTo(ids []string) []string {
+	if s.many == nil {
+		return append(ids, s.few...)
+	}
+	for id := range s.many {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// clone returns a copy of s to write in epoch
+func (s *idSet) clone(epoch uint64) *idSet {
+	return &idSet{few: slices.Clone(s.few), many: maps.Clone(s.many), epoch: epoch}
+}
+
+// fieldIndex returns the index of field of set, building it if needed, or
+// nil on a snapshot that has none
+func (e *Executor) fieldIndex(set *NodeSet, field string) *fieldIndex {
+	if idx := set.indexes[field]; idx != nil || e.readOnly {
+		return idx
+	}
+	epoch := e.graph.epoch
+	idx := &fieldIndex{ids: make(map[string]*idSet), epoch: epoch}
+	set.Range(func(id string, props map[string]interface{}) bool {
+		if v, ok := partitionKey(props[field]); ok {
+			idx.add(epoch, v, id)
+		}
+		return true
+	})
+	if set.indexes == nil {
+		set.indexes = make(map[string]*fieldIndex)
+	}
+	set.indexes[intern(field)] = idx
+	return idx
+}
+
+// indexFields moves node id in the field indexes from its old properties to
+// props; either may be nil
+func (s *NodeSet) indexFields(epoch uint64, id string, old, props map[string]interface{}) {
+	for field, idx := range s.indexes {
+		before, had := partitionKey(old[field])
+		after, has := partitionKey(props[field])
+		if had == has && before == after {
+			continue
+		}
+		if idx.epoch != epoch {
+			// a snapshot may share it; sorted is only ever replaced
+			idx = &fieldIndex{ids: maps.Clone(idx.ids), sorted: idx.sorted, epoch: epoch}
+			s.indexes[field] = idx
+		}
+		if had {
+			idx.remove(epoch, before, id)
+		}
+		if has {
+			idx.add(epoch, after, id)
+		}
+	}
+}
+
+func (idx *fieldIndex) add(epoch uint64, v, id string) {
+	set := idx.ids[v]
+	switch {
+	case set == nil:
+		set = &idSet{epoch: epoch}
+		idx.ids[v] = set
+		idx.sorted = nil
+	case set.epoch != epoch:
+		set = set.clone(epoch)
+		idx.ids[v] = set
+	}
+	set.add(id)
+}
+
+func (idx *fieldIndex) remove(epoch uint64, v, id string) {
+	set := idx.ids[v]
+	if set == nil || !set.has(id) {
+		return
+	}
+	if set.len() == 1 {
+		delete(idx.ids, v)
+		idx.sorted = nil
+		return
+	}
+	if set.epoch != epoch {
+		set = set.clone(epoch)
+		idx.ids[v] = set
+	}
+	set.remove(id)
+}
+
+// ordered returns the values of idx, the index of field of fields, in the
+// order compareValue gives them. Values that compare with nothing, such as text
+// in an int field, match no range, and are left out.
+func (e *Executor) ordered(idx *fieldIndex, fields map[string]catalog.FieldSpec, field string, keep bool) []string {
+	if idx.sorted != nil {
+		return idx.sorted
+	}
+	sorted := make([]string, 0, len(idx.ids))
+	for v := range idx.ids {
+		if _, ok := e.compareValue(fields, field, v, textLiteral(v)); ok {
+			sorted = append(sorted, v)
+		}
+	}
+	slices.SortFunc(sorted, func(a, b string) int {
+		c, _ := e.compareValue(fields, field, a, textLiteral(b))
+		return c
+	})
+	if keep {
+		idx.sorted = sorted
+	}
+	return sorted
+}
+
+func textLiteral(v string) *parser.Literal {
+	return &parser.Literal{Kind: parser.LitString, Text: v}
+}
+
+// indexLookup is what an index gives for one condition: n nodes, listed by ids
+type indexLookup struct {
+	n   int
+	ids func() []string
+}
+
+// indexedIDs returns the only nodes of set, the nodes of nodeType, that can
+// match conds and filter in sc, from the index lookup of the condition that
+// gives the fewest. It reports false if no condition can use an index.
+func (e *Executor) indexedIDs(nodeType string, set *NodeSet, conds []parser.Property, filter parser.Expr, sc *whereScope) ([]string, bool) {
+	nt, ok := e.registry.Current().Nodes[nodeType]
+	if set == nil || !ok || len(nt.Indexes) == 0 {
+		return nil, false
+	}
+	var best *indexLookup
+	consider := func(l *indexLookup) {
+		if l != nil && (best == nil || l.n < best.n) {
+			best = l
+		}
+	}
+	for i := range conds {
+		consider(e.equalLookup(nt, set, &conds[i]))
+	}
+	for _, x := range conjuncts(filter) {
+		if p, ok := x.(*parser.Property); ok {
+			consider(e.equalLookup(nt, set, p))
+		} else {
+			consider(e.rangeLookup(nt, set, x, sc))
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+	return best.ids(), true
+}
+
+// equalLookup returns the lookup of the nodes p, name: value, can match, or
+// nil if no index serves it
+func (e *Executor) equalLookup(nt *catalog.NodeType, set *NodeSet, p *parser.Property) *indexLookup {
+	if _, ok := nt.Indexes[p.Name]; !ok || p.Value == nil {
+		return nil
+	}
+	switch p.Value.Kind {
+	case parser.LitString, parser.LitNumber, parser.LitBool:
+	default:
+		return nil
+	}
+	idx := e.fieldIndex(set, p.Name)
+	if idx == nil {
+		return nil
+	}
+	hits := idx.ids[p.Value.Text]
+	if hits == nil {
+		return &indexLookup{ids: func() []string { return nil }}
+	}
+	return &indexLookup{n: hits.len(), ids: func() []string { return hits.appendTo(nil) }}
+}
+
+// valueRange is the values from lo to hi, each included if its inc is set;
+// a nil bound is open
+type valueRange struct {
+	lo, hi       *parser.Literal
+	incLo, incHi bool
+}
+
+// rangeLookup returns the lookup of the nodes x, an IN, BETWEEN or
+// comparison, can match, or nil if no index serves it
+func (e *Executor) rangeLookup(nt *catalog.NodeType, set *NodeSet, x parser.Expr, sc *whereScope) *indexLookup {
+	var (
+		field  string
+		ranges []valueRange
+	)
+	switch x := x.(type) {
+	case *parser.InExpr:
+		field = x.Field
+		for _, lit := range x.Values {
+			ranges = append(ranges, valueRange{lo: lit, hi: lit, incLo: true, incHi: true})
+		}
+	case *parser.BetweenExpr:
+		field = x.Field
+		ranges = []valueRange{{lo: x.Low, hi: x.High, incLo: true, incHi: true}}
+	case *parser.CompareExpr:
+		field = x.Field
+		lit := x.Value
+		if x.Time != nil {
+			if sc == nil {
+				return nil
+			}
+			lit = sc.times[x.Time]
+		}
+		switch x.Op {
+		case parser.Less, parser.LessEq:
+			ranges = []valueRange{{hi: lit, incHi: x.Op == parser.LessEq}}
+		default:
+			ranges = []valueRange{{lo: lit, incLo: x.Op == parser.GreaterEq}}
+		}
+	default:
+		return nil
+	}
+	spec, declared := nt.Fields[field]
+	if _, ok := nt.Indexes[field]; !ok || !declared || spec.Type.Base == catalog.BaseBool {
+		// bools are stored as such, which compareValue orders apart from text
+		return nil
+	}
+	idx := e.fieldIndex(set, field)
+	if idx == nil {
+		return nil
+	}
+	sorted := e.ordered(idx, nt.Fields, field, !e.readOnly)
+	// at compares the value at i with lit
+	at := func(i int, lit *parser.Literal) (int, bool) {
+		return e.compareValue(nt.Fields, field, sorted[i], lit)
+	}
+	var spans [][2]int
+	n := 0
+	for _, r := range ranges {
+		for _, lit := range []*parser.Literal{r.lo, r.hi} {
+			if lit == nil {
+				continue
+			}
+			if lit.Kind == parser.LitNull {
+				return nil
+			}
+			if _, ok := at(0, lit); len(sorted) > 0 && !ok {
+				// an IN of a value the field cannot hold, or a
+				// comparison with one: let the scan decide
+				return nil
+			}
+		}
+		lo, hi := 0, len(sorted)
+		if r.lo != nil {
+			lo = sort.Search(len(sorted), func(i int) bool {
+				c, _ := at(i, r.lo)
+				return c > 0 || c == 0 && r.incLo
+			})
+		}
+		if r.hi != nil {
+			hi = sort.Search(len(sorted), func(i int) bool {
+				c, _ := at(i, r.hi)
+				return c > 0 || c == 0 && !r.incHi
+			})
+		}
+		if lo >= hi {
+			continue
+		}
+		spans = append(spans, [2]int{lo, hi})
+		for _, v := range sorted[lo:hi] {
+			n += idx.ids[v].len()
+		}
+	}
+	return &indexLookup{n: n, ids: func() []string {
+		ids := make([]string, 0, n)
+		seen := make(map[string]bool)
+		for _, span := range spans {
+			for _, v := range sorted[span[0]:span[1]] {
+				// IN may list a value twice
+				if seen[v] {
+					continue
+				}
+				seen[v] = true
+				ids = idx.ids[v].appendTo(ids)
+			}
+		}
+		return ids
+	}}
+}
+
+// lookupNodes returns the nodes of set with the given IDs that keep accepts,
+// in ID order
+func lookupNodes(ctx context.Context, set *NodeSet, ids []string, keep func(map[string]interface{}) bool) ([]scanHit, error) {
+	var hits []scanHit
+	for i, id := range ids {
+		if i%scanCheckEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if props, ok := set.Get(id); ok && keep(props) {
+			hits = append(hits, scanHit{id: id, props: props})
+		}
+	}
+	slices.SortFunc(hits, func(a, b scanHit) int { return compareIDs(a.id, b.id) })
+	return hits, nil
+}
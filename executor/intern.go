@@ -0,0 +1,43 @@
+package executor
+
+import (
+	"strings"
+	"unique"
+
+	"grapho/parser"
+)
+
+// Names and values parsed from a statement are substrings of its text, so a
+// node that kept them would keep the whole statement, or a whole bulk-load
+// batch, alive. Property keys and type names repeat across every node of a
+// type and are interned, so all nodes share one copy of each; values that are
+// slices of the text are copied.
+
+// intern returns the canonical copy of s
+func intern(s string) string {
+	return unique.Make(s).Value()
+}
+
+// storedValue converts a literal to the value kept in a property map
+func storedValue(lit *parser.Literal) interface{} {
+	switch lit.Kind {
+	case parser.LitString:
+		return lit.Text // built by the lexer, not a slice of the text
+	case parser.LitNumber:
+		return strings.Clone(lit.Text)
+	case parser.LitBool:
+		return lit.Text == "true"
+	case parser.LitJSON:
+		if j, err := parseJSON(lit.Text); err == nil {
+			return j
+		}
+		return lit.Text
+	case parser.LitBlob:
+		if b, ok := blobLiteral(lit); ok {
+			return b
+		}
+		return lit.Text
+	default:
+		return nil
+	}
+}
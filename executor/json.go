@@ -0,0 +1,171 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"grapho/parser"
+)
+
+/* ---------------------- JSON values ---------------------- */
+
+// A json field holds a JSON document, written as an object or array literal,
+// as in meta: {"address": {"city": "Bern"}}, or as a string holding one. It
+// is decoded once, when written, and kept both decoded and as compact text
+// with object keys in order, which is what two documents are compared by
+// and how one is written out as text. A WHERE reaches
+// into a document with field.key.key: meta.address.city: 'Bern' tests the
+// city, and comparisons, IN and BETWEEN treat what they find like a value of
+// a field the schema does not declare, so numbers compare as numbers. A key
+// that is missing, or a path through something other than an object, finds
+// nothing, as a missing field does.
+
+// JSON is the value of a json field. Its document must not be modified.
+type JSON struct {
+	doc *jsonDoc // a pointer, so that JSON values can be compared with ==
+}
+
+type jsonDoc struct {
+	v    any
+	text string
+}
+
+// parseJSON decodes s, a JSON document
+func parseJSON(s string) (JSON, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return JSON{}, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return JSON{}, fmt.Errorf("text after the JSON value at offset %d", dec.InputOffset())
+	}
+	return newJSON(v), nil
+}
+
+// newJSON wraps v, as encoding/json decodes a document with numbers as
+// json.Number
+func newJSON(v any) JSON {
+	return JSON{doc: &jsonDoc{v: v, text: parser.CompactJSON(v)}}
+}
+
+// Value returns the document as encoding/json decodes it, with numbers as
+// json.Number
+func (j JSON) Value() any {
+	if j.doc == nil {
+		return nil
+	}
+	return j.doc.v
+}
+
+// String returns the document as compact JSON, with object keys in order
+func (j JSON) String() string {
+	if j.doc == nil {
+		return "null"
+	}
+	return j.doc.text
+}
+
+// MarshalJSON returns the document itself, not a string holding it
+func (j JSON) MarshalJSON() ([]byte, error) {
+	return []byte(j.String()), nil
+}
+
+// jsonLiteral returns the document lit holds, for a json field to store
+func jsonLiteral(lit *parser.Literal) (JSON, bool) {
+	if lit.Kind != parser.LitJSON && lit.Kind != parser.LitString {
+		return JSON{}, false
+	}
+	j, err := parseJSON(lit.Text)
+	return j, err == nil
+}
+
+// jsonEqual reports whether j is the document lit, a JSON literal or a
+// string holding one, writes
+func jsonEqual(j JSON, lit *parser.Literal) bool {
+	if lit.Kind == parser.LitJSON {
+		return j.String() == lit.Text
+	}
+	other, ok := jsonLiteral(lit)
+	return ok && j.String() == other.String()
+}
+
+// fieldValue returns the value props hold for name: a field, or a path into
+// a json field, as in meta.address.city or, in a path MATCH, p.meta.city
+func fieldValue(props map[string]interface{}, name string) (interface{}, bool) {
+	if v, ok := props[name]; ok {
+		return v, true
+	}
+	for i := strings.LastIndexByte(name, '.'); i > 0; i = strings.LastIndexByte(name[:i], '.') {
+		if j, ok := props[name[:i]].(JSON); ok {
+			return j.path(name[i+1:])
+		}
+	}
+	return nil, false
+}
+
+// unset reports whether props has no value for name, which fieldValue found
+// nothing for, because the field was never set rather than because a JSON
+// document holds no such key
+func unset(props map[string]interface{}, name string) bool {
+	for i := strings.LastIndexByte(name, '.'); i > 0; i = strings.LastIndexByte(name[:i], '.') {
+		if _, ok := props[name[:i]]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// path returns the value at keys, such as address.city, in j, held as a
+// value of a field the schema does not declare: text for strings and
+// numbers, a bool, nil for null, or a JSON for an object or array
+func (j JSON) path(keys string) (interface{}, bool) {
+	v := j.Value()
+	for _, key := range strings.Split(keys, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	switch v := v.(type) {
+	case json.Number:
+		return string(v), true
+	case map[string]any, []any:
+		return newJSON(v), true
+	}
+	return v, true
+}
+
+// plainJSON returns v, a decoded document, with its numbers as int64, or
+// float64 if they have a fraction or do not fit, for encoders that know
+// nothing of json.Number
+func plainJSON(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = plainJSON(e)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			out[k] = plainJSON(e)
+		}
+		return out
+	}
+	return v
+}
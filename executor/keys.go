@@ -0,0 +1,110 @@
+package executor
+
+import (
+	"crypto/rand"
+	"fmt"
+	"slices"
+	"strings"
+
+	"grapho/catalog"
+	"grapho/parser"
+)
+
+/* ---------------------- Generated keys ---------------------- */
+
+// An INSERT or MERGE that creates a node of a type whose PRIMARY KEY is a
+// uuid, without giving the key, gets a random (version 4) UUID for it. The
+// key is the node's ID, so it is reported and indexed like any other. The
+// commit log keeps statements as written, and running one again would pick
+// another key, so the executor remembers the key each statement generated,
+// and LogText spells the statements with their keys for the log.
+
+// generatedKey is a primary key value an insert made up
+type generatedKey struct {
+	field, value string
+}
+
+// generateKey sets the primary key of props, the properties of a new node
+// of nt, to a new UUID if the key is a uuid and props has none, and reports
+// whether it did
+func generateKey(nt *catalog.NodeType, props map[string]interface{}) (generatedKey, bool) {
+	if nt.PK == "" || nt.Fields[nt.PK].Type.Base != catalog.BaseUUID || props[nt.PK] != nil {
+		return generatedKey{}, false
+	}
+	key := generatedKey{field: nt.PK, value: newUUID()}
+	props[intern(nt.PK)] = key.value
+	return key, true
+}
+
+// newUUID returns a random UUID
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// keepKey remembers the key stmt generated, if any, for LogText
+func (e *Executor) keepKey(stmt parser.Stmt) {
+	if e.key == (generatedKey{}) {
+		return
+	}
+	if e.keys == nil {
+		e.keys = make(map[parser.Stmt]generatedKey)
+	}
+	e.keys[stmt] = e.key
+}
+
+// LogText returns the text the commit log should keep for stmts, which ran
+// from script: script itself, unless some of them generated a primary key,
+// in which case the statements formatted with the keys they generated, so
+// replay gives the nodes the same keys. It forgets the keys.
+func (e *Executor) LogText(script string, stmts []parser.Stmt) (string, error) {
+	if !slices.ContainsFunc(stmts, func(st parser.Stmt) bool { _, ok := e.keys[st]; return ok }) {
+		clear(e.keys)
+		return script, nil
+	}
+	return e.LogPrefix(stmts)
+}
+
+// LogPrefix returns the text the commit log should keep for stmts, the
+// statements of a script that ran before one of them failed: the statements
+// formatted, with the keys they generated, as the script holds more than
+// ran. It forgets the keys.
+func (e *Executor) LogPrefix(stmts []parser.Stmt) (string, error) {
+	defer clear(e.keys)
+	texts := make([]string, len(stmts))
+	for i, st := range stmts {
+		if key, ok := e.keys[st]; ok {
+			st = withKey(st, key)
+		}
+		text, err := parser.Format(st)
+		if err != nil {
+			return "", err
+		}
+		texts[i] = text
+	}
+	return strings.Join(texts, " "), nil
+}
+
+// withKey returns a copy of stmt, an INSERT NODE or MERGE NODE, that gives
+// the key it generated
+func withKey(stmt parser.Stmt, key generatedKey) parser.Stmt {
+	set := func(props []parser.Property) []parser.Property {
+		// a key written as null is replaced
+		props = slices.DeleteFunc(slices.Clone(props), func(p parser.Property) bool { return p.Name == key.field })
+		return append(props, parser.Prop(key.field, parser.Str(key.value)))
+	}
+	switch st := stmt.(type) {
+	case *parser.InsertNodeStmt:
+		cp := *st
+		cp.Properties = set(st.Properties)
+		return &cp
+	case *parser.MergeNodeStmt:
+		cp := *st
+		cp.Properties = set(st.Properties)
+		return &cp
+	}
+	return stmt
+}
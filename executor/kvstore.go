@@ -0,0 +1,445 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"grapho/catalog"
+	"grapho/kv"
+)
+
+/* ---------------------- Key-value stores ---------------------- */
+
+// A KVStore keeps the graph in an embedded key-value store, graph-data.kv,
+// instead of a data file. Each node and edge is a key of its own, which a
+// change overwrites rather than adding to, and the store compacts itself
+// once most of its file is overwritten values. The keys are laid out as
+//
+//	meta                  {"next_id": ..., "entries": ..., "seq": ..., "adjacency": true}
+//	catalog               the catalog, as JSON
+//	n/<type>/<id>         the properties of a node
+//	e/<type>/<seq>        an edge: {"id": ..., "from": ..., "to": ..., "props": ...}
+//	x/<type>/<id>         the seq of the edge with that ID
+//	o/<type>/<from>/<seq> empty, for each edge leaving a node
+//	i/<type>/<to>/<seq>   empty, for each edge entering a node
+//
+// with property values spelled as in a data file. seq is 16 hex digits,
+// numbered across all edges in the order they were first stored, so that
+// scanning the e/ keys of a type gives its edges in the order of its list,
+// and the o/ or i/ keys of a node the edges Neighbors follows. A store from
+// before the o/ and i/ keys has them added when it is opened.
+// Opened on a data directory whose graph is in a data file, the store is
+// filled from it first; the data file is left as it was.
+//
+// The store is a place to keep the graph, not a way to serve one larger than
+// memory. Queries are served from the graph in memory, which LoadData copies
+// whole out of the store on startup, and kv.DB keeps every key in memory
+// besides; what the store saves is snapshots, and the disk the history of a
+// data file takes. Its ScanType and Neighbors read the store itself, but the
+// executor only reads through them when it is given the store as its
+// GraphReader, which it never is: statements check keys, edge ends and
+// indexes against the graph in memory, and a snapshot must keep seeing the
+// graph as it was while later commits overwrite the keys it would read.
+// Serving a graph from the store as queries go is left to be done; data
+// segments are the way to keep node properties off the heap meanwhile. The
+// store is built on package kv rather than BoltDB or Badger because grapho
+// takes nothing outside the standard library.
+
+// KVStoreName is the name of the key-value store in a data directory
+const KVStoreName = "graph-data.kv"
+
+// KVStore is a GraphStore kept in a kv.DB
+type KVStore struct {
+	db   *kv.DB
+	meta kvMeta
+}
+
+// kvMeta is the value of the meta key
+type kvMeta struct {
+	NextID  int64  `json:"next_id"`
+	Entries int    `json:"entries"`
+	Seq     uint64 `json:"seq"` // of the last edge stored
+
+	Adjacency bool `json:"adjacency,omitempty"` // the o/ and i/ keys are kept
+}
+
+// kvEdge is the value of an e/ key
+type kvEdge struct {
+	ID    string                     `json:"id"`
+	From  string                     `json:"from"`
+	To    string                     `json:"to"`
+	Props map[string]json.RawMessage `json:"props"`
+}
+
+// OpenKVStore opens the key-value store of the data directory dir, creating
+// both if need be, and fills a new store from the data file if dir has one
+func OpenKVStore(ctx context.Context, dir string) (*KVStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("mkdir data dir: %w", err)
+	}
+	db, err := kv.Open(filepath.Join(dir, KVStoreName))
+	if err != nil {
+		return nil, err
+	}
+	s := &KVStore{db: db}
+	b, ok, err := db.Get("meta")
+	if err == nil && ok {
+		err = json.Unmarshal(b, &s.meta)
+	}
+	if err == nil && !ok {
+		s.meta.Adjacency = true
+		err = s.migrate(ctx, dir)
+	}
+	if err == nil && !s.meta.Adjacency {
+		err = s.addAdjacency(ctx)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// migrate copies the graph from the data file of dir, if it has one with
+// anything in it, into the store
+func (s *KVStore) migrate(ctx context.Context, dir string) error {
+	info, err := os.Stat(filepath.Join(dir, DataFileName))
+	if errors.Is(err, os.ErrNotExist) || err == nil && info.Size() == 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	df, err := OpenDataFile(dir)
+	if err != nil {
+		return err
+	}
+	defer df.Close()
+	nextID, err := df.Load(ctx, s)
+	if err != nil {
+		return fmt.Errorf("migrate data file: %w", err)
+	}
+	return s.Commit(nextID, df.Entries())
+}
+
+// addAdjacency adds the o/ and i/ keys of every edge, and commits them
+func (s *KVStore) addAdjacency(ctx context.Context) error {
+	err := s.db.Scan("e/", func(key string, b []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		edgeType, seq, _ := strings.Cut(strings.TrimPrefix(key, "e/"), "/")
+		var e kvEdge
+		if err := json.Unmarshal(b, &e); err != nil {
+			return fmt.Errorf("edge %s: %w", seq, err)
+		}
+		return s.putEnds(edgeType, seq, e)
+	})
+	if err != nil {
+		return err
+	}
+	s.meta.Adjacency = true
+	return s.Commit(s.meta.NextID, s.meta.Entries)
+}
+
+// endKeys returns the o/ and i/ keys of the edge of edgeType at seq
+func endKeys(edgeType, seq string, e kvEdge) (out, in string) {
+	return "o/" + edgeType + "/" + e.From + "/" + seq, "i/" + edgeType + "/" + e.To + "/" + seq
+}
+
+func (s *KVStore) putEnds(edgeType, seq string, e kvEdge) error {
+	out, in := endKeys(edgeType, seq, e)
+	if err := s.db.Put(out, nil); err != nil {
+		return err
+	}
+	return s.db.Put(in, nil)
+}
+
+func (s *KVStore) deleteEnds(edgeType, seq string, e kvEdge) error {
+	out, in := endKeys(edgeType, seq, e)
+	if err := s.db.Delete(out); err != nil {
+		return err
+	}
+	return s.db.Delete(in)
+}
+
+// edge returns the edge of edgeType at seq, written or committed
+func (s *KVStore) edge(edgeType, seq string) (kvEdge, bool, error) {
+	var e kvEdge
+	b, ok, err := s.db.Get("e/" + edgeType + "/" + seq)
+	if err != nil || !ok {
+		return e, false, err
+	}
+	if err := json.Unmarshal(b, &e); err != nil {
+		return e, false, fmt.Errorf("edge %s: %w", seq, err)
+	}
+	return e, true, nil
+}
+
+func (s *KVStore) PutCatalog(cat *catalog.Catalog) error {
+	b, err := json.Marshal(cat)
+	if err != nil {
+		return err
+	}
+	return s.db.Put("catalog", b)
+}
+
+func (s *KVStore) PutNode(nodeType, id string, props map[string]interface{}) error {
+	raw, err := encodeProps(props)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return s.db.Put("n/"+nodeType+"/"+id, b)
+}
+
+func (s *KVStore) DeleteNode(nodeType, id string) error {
+	return s.db.Delete("n/" + nodeType + "/" + id)
+}
+
+func (s *KVStore) PutEdge(edgeType string, edge EdgeInstance) error {
+	raw, err := encodeProps(edge.Properties)
+	if err != nil {
+		return err
+	}
+	e := kvEdge{ID: edge.ID, From: edge.FromNodeID, To: edge.ToNodeID, Props: raw}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	seq, ok, err := s.db.Get("x/" + edgeType + "/" + edge.ID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		s.meta.Seq++
+		seq = []byte(fmt.Sprintf("%016x", s.meta.Seq))
+		if err := s.db.Put("x/"+edgeType+"/"+edge.ID, seq); err != nil {
+			return err
+		}
+	} else {
+		old, found, err := s.edge(edgeType, string(seq))
+		if err != nil {
+			return err
+		}
+		if found && old.From == e.From && old.To == e.To {
+			return s.db.Put("e/"+edgeType+"/"+string(seq), b)
+		}
+		if found {
+			if err := s.deleteEnds(edgeType, string(seq), old); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.db.Put("e/"+edgeType+"/"+string(seq), b); err != nil {
+		return err
+	}
+	return s.putEnds(edgeType, string(seq), e)
+}
+
+func (s *KVStore) DeleteEdge(edgeType, id string) error {
+	seq, ok, err := s.db.Get("x/" + edgeType + "/" + id)
+	if err != nil || !ok {
+		return err
+	}
+	old, found, err := s.edge(edgeType, string(seq))
+	if err != nil {
+		return err
+	}
+	if found {
+		if err := s.deleteEnds(edgeType, string(seq), old); err != nil {
+			return err
+		}
+	}
+	if err := s.db.Delete("e/" + edgeType + "/" + string(seq)); err != nil {
+		return err
+	}
+	return s.db.Delete("x/" + edgeType + "/" + id)
+}
+
+func (s *KVStore) DropNodes(nodeType string) error {
+	return s.db.DeletePrefix("n/" + nodeType + "/")
+}
+
+func (s *KVStore) DropEdges(edgeType string) error {
+	for _, kind := range []string{"e/", "x/", "o/", "i/"} {
+		if err := s.db.DeletePrefix(kind + edgeType + "/"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errStop ends a Scan early, for a reader whose fn returned false
+var errStop = errors.New("stop")
+
+// ScanType scans the n/ keys of nodeType. Keys are kept in memory and values
+// on disk, so it reads as many values as the type has nodes, after a pass
+// over the keys in memory.
+func (s *KVStore) ScanType(ctx context.Context, nodeType string, fn func(id string, props map[string]interface{}) bool) error {
+	prefix := "n/" + nodeType + "/"
+	err := s.db.Scan(prefix, func(key string, b []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		id := strings.TrimPrefix(key, prefix)
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return fmt.Errorf("node %s: %w", id, err)
+		}
+		props, err := decodeProps(raw)
+		if err != nil {
+			return fmt.Errorf("node %s: %w", id, err)
+		}
+		if !fn(id, props) {
+			return errStop
+		}
+		return nil
+	})
+	if err == errStop {
+		return nil
+	}
+	return err
+}
+
+// Neighbors reads the edges the o/ or i/ keys of the node list, one value
+// each
+func (s *KVStore) Neighbors(ctx context.Context, edgeType, id string, in bool, fn func(inst *EdgeInstance) bool) error {
+	prefix := "o/" + edgeType + "/" + id + "/"
+	if in {
+		prefix = "i/" + edgeType + "/" + id + "/"
+	}
+	var seqs []string
+	err := s.db.Scan(prefix, func(key string, _ []byte) error {
+		// an ID with a slash in it can make the key of another node match
+		if seq := strings.TrimPrefix(key, prefix); len(seq) == 16 && !strings.Contains(seq, "/") {
+			seqs = append(seqs, seq)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, seq := range seqs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		b, ok, err := s.db.GetCommitted("e/" + edgeType + "/" + seq)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		var e kvEdge
+		if err := json.Unmarshal(b, &e); err != nil {
+			return fmt.Errorf("edge %s: %w", seq, err)
+		}
+		props, err := decodeProps(e.Props)
+		if err != nil {
+			return fmt.Errorf("edge %s: %w", e.ID, err)
+		}
+		if !fn(&EdgeInstance{ID: e.ID, FromNodeID: e.From, ToNodeID: e.To, Properties: props}) {
+			break
+		}
+	}
+	return nil
+}
+
+// Load writes the catalog, then the nodes by type and ID, then the edges of
+// each type in the order they were first stored: the whole graph, which
+// LoadData then holds in memory
+func (s *KVStore) Load(ctx context.Context, w GraphWriter) (int64, error) {
+	b, ok, err := s.db.Get("catalog")
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		var cat *catalog.Catalog
+		if err := json.Unmarshal(b, &cat); err != nil {
+			return 0, fmt.Errorf("catalog: %w", err)
+		}
+		if err := w.PutCatalog(cat); err != nil {
+			return 0, err
+		}
+	}
+	err = s.db.Scan("n/", func(key string, b []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		nodeType, id, _ := strings.Cut(strings.TrimPrefix(key, "n/"), "/")
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return fmt.Errorf("node %s: %w", id, err)
+		}
+		props, err := decodeProps(raw)
+		if err != nil {
+			return fmt.Errorf("node %s: %w", id, err)
+		}
+		return w.PutNode(nodeType, id, props)
+	})
+	if err != nil {
+		return 0, err
+	}
+	err = s.db.Scan("e/", func(key string, b []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		edgeType, seq, _ := strings.Cut(strings.TrimPrefix(key, "e/"), "/")
+		var e kvEdge
+		if err := json.Unmarshal(b, &e); err != nil {
+			return fmt.Errorf("edge %s: %w", seq, err)
+		}
+		props, err := decodeProps(e.Props)
+		if err != nil {
+			return fmt.Errorf("edge %s: %w", e.ID, err)
+		}
+		return w.PutEdge(edgeType, EdgeInstance{ID: e.ID, FromNodeID: e.From, ToNodeID: e.To, Properties: props})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return s.meta.NextID, nil
+}
+
+// Commit commits the writes since the last commit without syncing them, as
+// the commit log holds them too, and compacts the store once more than half
+// of it is dead
+func (s *KVStore) Commit(nextID int64, entries int) error {
+	meta := s.meta
+	meta.NextID, meta.Entries = nextID, entries
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Put("meta", b); err != nil {
+		return err
+	}
+	if err := s.db.Commit(false); err != nil {
+		return err
+	}
+	s.meta = meta
+	if s.db.Garbage() > 0.5 {
+		return s.db.Compact()
+	}
+	return nil
+}
+
+// Entries returns the number of commit log entries whose changes the store
+// holds
+func (s *KVStore) Entries() int {
+	return s.meta.Entries
+}
+
+// Close syncs and closes the store
+func (s *KVStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,113 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"grapho/kv"
+)
+
+// openKV returns an executor with the catalog and key-value store of dir
+// loaded, and the store
+func openKV(t *testing.T, dir string) (*Executor, *KVStore) {
+	t.Helper()
+	st, err := OpenKVStore(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return load(t, dir, st), st
+}
+
+func TestKVStore(t *testing.T) {
+	dir := t.TempDir()
+	e, df := openData(t, dir)
+	run(t, e, 1, readerScript)
+	want := readGraph(t, e.Graph(), "Person", "KNOWS")
+	if err := df.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new store is filled from the data file
+	e, st := openKV(t, dir)
+	if st.Entries() != 1 {
+		t.Errorf("migrated store holds %d entries, want 1", st.Entries())
+	}
+	if got := readGraph(t, st, "Person", "KNOWS"); !slices.Equal(got, want) {
+		t.Errorf("read from the store:\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if got := readGraph(t, e.Graph(), "Person", "KNOWS"); !slices.Equal(got, want) {
+		t.Errorf("loaded from the store:\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// a change overwrites its key, and the store compacts itself once most
+	// of it is overwritten values
+	run(t, e, 2, `
+INSERT EDGE KNOWS FROM Person('dee') TO Person('bob') (since: 5);
+UPDATE EDGE KNOWS SET since: 6 WHERE since: 3;
+UPDATE NODE Person SET name: 'bo' WHERE name: 'bob';
+DELETE NODE Person WHERE name: 'cy';`)
+	for i := range 20 {
+		run(t, e, 3+i, fmt.Sprintf("UPDATE NODE Person SET born: '2000-01-%02d' WHERE name: 'dee';", i+1))
+	}
+	want = readGraph(t, e.Graph(), "Person", "KNOWS")
+	if got := readGraph(t, st, "Person", "KNOWS"); !slices.Equal(got, want) {
+		t.Errorf("read from the store after writes:\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	e, st = openKV(t, dir)
+	if st.Entries() != 22 {
+		t.Errorf("reopened store holds %d entries, want 22", st.Entries())
+	}
+	if got := readGraph(t, e.Graph(), "Person", "KNOWS"); !slices.Equal(got, want) {
+		t.Errorf("reloaded:\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// writes show once committed
+	if err := st.PutNode("Person", "zed", map[string]interface{}{"name": "zed"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readGraph(t, st, "Person", "KNOWS"); len(got) != len(want) {
+		t.Errorf("read an uncommitted node: %v", got)
+	}
+	if err := st.Commit(100, 23); err != nil {
+		t.Fatal(err)
+	}
+	got := readGraph(t, st, "Person", "KNOWS")
+	if len(got) != len(want)+1 {
+		t.Errorf("missed a committed node: %v", got)
+	}
+	want = got
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a store from before the adjacency keys has them added
+	raw, err := kv.Open(filepath.Join(dir, KVStoreName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _, _ := raw.Get("meta")
+	var meta map[string]interface{}
+	json.Unmarshal(b, &meta)
+	delete(meta, "adjacency")
+	b, _ = json.Marshal(meta)
+	raw.Put("meta", b)
+	raw.DeletePrefix("o/")
+	raw.DeletePrefix("i/")
+	if err := raw.Commit(true); err != nil {
+		t.Fatal(err)
+	}
+	raw.Close()
+	_, st = openKV(t, dir)
+	if got := readGraph(t, st, "Person", "KNOWS"); !slices.Equal(got, want) {
+		t.Errorf("read from an old store:\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
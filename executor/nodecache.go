@@ -0,0 +1,139 @@
+package executor
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+/* ---------------------- Node cache ---------------------- */
+
+// Nodes in a data segment are decoded each time they are read. The node
+// cache keeps the properties of those read most recently, up to a limit on
+// the size of their encoding in the segment, evicting the least recently
+// used first; the decoded maps take a few times that. Lookups by ID fill the
+// cache, but scans only read from it, so that one scan of a large type does
+// not push out the nodes looked up often. The cache is shared by an executor
+// and its snapshots.
+
+// DefaultCacheSize is the node cache limit unless SetCacheSize says otherwise
+const DefaultCacheSize = 64 << 20
+
+// NodeCacheStats reports how the node cache has done. Only lookups by ID
+// are counted.
+type NodeCacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Nodes  int    `json:"nodes"` // nodes cached
+	Bytes  int    `json:"bytes"` // their size in their segments
+	Limit  int    `json:"limit"`
+}
+
+// HitRate is the fraction of lookups that found the node cached
+func (s NodeCacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// cacheKey is a node of a segment
+type cacheKey struct {
+	seg *segment
+	i   int
+}
+
+type cacheEntry struct {
+	key   cacheKey
+	props map[string]interface{}
+	size  int
+}
+
+type nodeCache struct {
+	mu     sync.Mutex
+	limit  int
+	bytes  int
+	nodes  map[cacheKey]*list.Element
+	lru    list.List // most recently used first
+	hits   uint64
+	misses uint64
+}
+
+func newNodeCache(limit int) *nodeCache {
+	return &nodeCache{limit: limit, nodes: make(map[cacheKey]*list.Element)}
+}
+
+// SetCacheSize sets the most bytes of segment nodes the node cache keeps; 0
+// turns it off
+func (e *Executor) SetCacheSize(n int) error {
+	if n < 0 {
+		return fmt.Errorf("cache size must not be negative, got %d", n)
+	}
+	c := e.cache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limit = n
+	c.evict()
+	return nil
+}
+
+// NodeCacheStats returns the node cache counters
+func (e *Executor) NodeCacheStats() NodeCacheStats {
+	c := e.cache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return NodeCacheStats{Hits: c.hits, Misses: c.misses, Nodes: len(c.nodes), Bytes: c.bytes, Limit: c.limit}
+}
+
+// peek returns the cached properties of key without counting the lookup or
+// marking key used
+func (c *nodeCache) peek(key cacheKey) (map[string]interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.nodes[key]; ok {
+		return el.Value.(*cacheEntry).props, true
+	}
+	return nil, false
+}
+
+// get returns the cached properties of key, counting the lookup
+func (c *nodeCache) get(key cacheKey) (map[string]interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.nodes[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(el)
+	return el.Value.(*cacheEntry).props, true
+}
+
+// put caches the properties of key, which take size bytes in the segment
+func (c *nodeCache) put(key cacheKey, props map[string]interface{}, size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if size > c.limit {
+		return
+	}
+	if el, ok := c.nodes[key]; ok {
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.nodes[key] = c.lru.PushFront(&cacheEntry{key: key, props: props, size: size})
+	c.bytes += size
+	c.evict()
+}
+
+// evict drops the least recently used nodes until the cache is within its
+// limit
+func (c *nodeCache) evict() {
+	for c.bytes > c.limit {
+		el := c.lru.Back()
+		ent := el.Value.(*cacheEntry)
+		c.lru.Remove(el)
+		delete(c.nodes, ent.key)
+		c.bytes -= ent.size
+	}
+}
@@ -0,0 +1,291 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+
+	"grapho/parser"
+)
+
+/* ---------------------- MATCH ... SET and DELETE ---------------------- */
+
+// A path MATCH may end in SET p.field: value, ... or DELETE p, w, ... rather
+// than RETURN, changing the nodes and edges its variables are bound to. Every
+// row is found before anything changes, so the changes never affect what the
+// MATCH finds. A node or edge bound in several rows is changed once: a CASE
+// or expression is evaluated on the first row that binds it, in the order
+// rows are found. Deleting a variable-length edge deletes every edge it took.
+// As with DELETE NODE, the edges of a deleted node are left alone.
+
+// pathWrite holds what a MATCH ... SET writes to one node or edge
+type pathWrite struct {
+	typ    string
+	values map[string]interface{}
+}
+
+// setTarget is an assignment of a MATCH ... SET to field of variable v
+type setTarget struct {
+	v     int
+	field string
+	p     parser.Property
+}
+
+// executePathWrite executes a MATCH of path patterns with SET or DELETE
+func (e *Executor) executePathWrite(ctx context.Context, out Output, stmt *parser.MatchStmt) error {
+	if len(stmt.Paths) == 0 {
+		return fmt.Errorf("SET and DELETE in a MATCH need a path pattern")
+	}
+	m, starts, err := e.stages(ctx, stmt)
+	if err != nil {
+		return err
+	}
+	last := lastStage(stmt)
+	targets, err := m.compileSet(last.Set)
+	if err != nil {
+		return err
+	}
+	dels, err := m.compileDelete(last.Delete)
+	if err != nil {
+		return err
+	}
+
+	nodes := make(map[string]*pathWrite) // by ID; values is nil to delete
+	edges := make(map[string]*pathWrite)
+	var setErr error
+	err = m.runFrom(starts, func() bool {
+		var row map[string]interface{} // for CASE and expressions
+		for _, t := range targets {
+			b := m.bound[t.v]
+			writes := nodes
+			if m.vars[t.v].isEdge {
+				writes = edges
+			}
+			w := writes[b.id]
+			if w == nil {
+				w = &pathWrite{typ: b.typ, values: make(map[string]interface{})}
+				writes[b.id] = w
+			}
+			if _, done := w.values[t.field]; done {
+				continue
+			}
+			if (t.p.Case != nil || t.p.Calc != nil) && row == nil {
+				row = m.boundRow()
+			}
+			v, err := e.setValue(m.scope, b.typ, row, t.p)
+			if err == nil && v == nil && typeFields(m.cat, b.typ)[t.field].NotNull {
+				err = nullError(b.typ, t.field, true)
+			}
+			if err != nil {
+				setErr = err
+				return false
+			}
+			w.values[t.field] = v
+		}
+		for _, v := range dels {
+			b := m.bound[v]
+			if !m.vars[v].isEdge {
+				nodes[b.id] = &pathWrite{typ: b.typ}
+				continue
+			}
+			for _, id := range b.edges {
+				edges[id] = &pathWrite{}
+			}
+		}
+		return true
+	})
+	if err == nil {
+		err = setErr
+	}
+	if err != nil {
+		return err
+	}
+
+	// the rows are all found; work out the nodes as they will be stored, by
+	// type, and check them against the keys
+	stored := make(map[string]map[string]map[string]interface{})
+	for id, w := range nodes {
+		if w.values == nil {
+			continue
+		}
+		old, ok := e.graph.Nodes[w.typ].Get(id)
+		if !ok {
+			continue
+		}
+		props := maps.Clone(old)
+		for name, v := range w.values {
+			props[intern(name)] = v
+		}
+		if stored[w.typ] == nil {
+			stored[w.typ] = make(map[string]map[string]interface{})
+		}
+		stored[w.typ][id] = props
+	}
+	moved := make(map[string]map[string]string)
+	for _, typ := range sortedKeys(stored) {
+		if err := e.checkUnique(typ, stored[typ]); err != nil {
+			return err
+		}
+		if moved[typ], err = e.movedNodes(typ, stored[typ]); err != nil {
+			return err
+		}
+	}
+
+	// and so the edges, by type
+	edgeWrites := make(map[string]map[string]map[string]interface{})
+	for _, w := range edges {
+		if w.values != nil {
+			edgeWrites[w.typ] = make(map[string]map[string]interface{})
+		}
+	}
+	for edgeType, byID := range edgeWrites {
+		for _, inst := range e.graph.Edges[edgeType] {
+			w := edges[inst.ID]
+			if w == nil || w.values == nil {
+				continue
+			}
+			props := maps.Clone(inst.Properties)
+			for name, v := range w.values {
+				props[intern(name)] = v
+			}
+			byID[inst.ID] = props
+		}
+	}
+	for _, edgeType := range sortedKeys(edgeWrites) {
+		if err := e.checkEdgeUnique(edgeType, edgeWrites[edgeType]); err != nil {
+			return err
+		}
+	}
+
+	// from here on the statement runs to completion
+	for id, w := range nodes {
+		if w.values == nil {
+			e.graph.Nodes[w.typ].delete(e.graph.epoch, id)
+			e.graph.nodeWritten(w.typ, id)
+		}
+	}
+	for typ, writes := range stored {
+		e.storeNodes(typ, writes, moved[typ])
+	}
+	if len(edges) > 0 {
+		for _, edgeType := range sortedKeys(e.graph.Edges) {
+			e.writeEdges(edgeType, edges)
+		}
+	}
+	ids := make([]string, 0, len(nodes)+len(edges))
+	for _, id := range sortedKeys(nodes) {
+		if to, ok := moved[nodes[id].typ][id]; ok {
+			id = to
+		}
+		ids = append(ids, id)
+	}
+	ids = append(ids, sortedKeys(edges)...)
+	verb, c := "Updated", Change{NodesUpdated: len(nodes), EdgesUpdated: len(edges), UpdatedIDs: ids}
+	if len(dels) > 0 {
+		verb, c = "Deleted", Change{NodesDeleted: len(nodes), EdgesDeleted: len(edges), DeletedIDs: ids}
+	}
+	changed(out, c, "%s %d node(s) and %d edge(s)", verb, len(nodes), len(edges))
+	return nil
+}
+
+// writeEdges applies writes, by edge ID, to the edges of edgeType
+func (e *Executor) writeEdges(edgeType string, writes map[string]*pathWrite) {
+	hit := false
+	for _, inst := range e.graph.Edges[edgeType] {
+		if writes[inst.ID] != nil {
+			hit = true
+			break
+		}
+	}
+	if !hit {
+		return
+	}
+	edges := e.graph.ownEdges(edgeType)
+	for i := range edges {
+		w := writes[edges[i].ID]
+		switch {
+		case w == nil:
+		case w.values == nil:
+			e.graph.deleteEdge(edgeType, edges, i)
+		default:
+			props := maps.Clone(edges[i].Properties)
+			for name, v := range w.values {
+				props[intern(name)] = v
+			}
+			edges[i].Properties = props
+			e.graph.edgeWritten(edgeType, edges[i].ID, i)
+		}
+	}
+}
+
+// compileSet checks the assignments of a MATCH ... SET, each to a field of a
+// variable of the pattern
+func (m *pathMatcher) compileSet(set []parser.Property) ([]setTarget, error) {
+	if len(set) == 0 {
+		return nil, nil
+	}
+	literals, err := setLiterals(set)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]setTarget, len(set))
+	for i, p := range set {
+		alias, field, _ := strings.Cut(p.Name, ".")
+		v := m.varIndex(alias)
+		switch {
+		case v < 0:
+			return nil, fmt.Errorf("SET %s: '%s' is not a variable of the pattern", p.Name, alias)
+		case m.vars[v].hops:
+			return nil, fmt.Errorf("SET %s: '%s' is a variable-length edge, whose edges can only be deleted", p.Name, alias)
+		case field == "_id" || field == "_from" || field == "_to":
+			return nil, fmt.Errorf("SET %s: %s cannot be set", p.Name, field)
+		case !m.varHasField(m.vars[v], field):
+			return nil, fmt.Errorf("SET %s: '%s' has no field '%s'", p.Name, alias, field)
+		}
+		if p.Case != nil {
+			for _, w := range p.Case.Whens {
+				if err := m.checkConds("SET "+p.Name, w.Cond); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if p.Calc != nil {
+			if err := m.checkConds("SET "+p.Name, p.Calc); err != nil {
+				return nil, err
+			}
+		}
+		targets[i] = setTarget{v: v, field: field, p: p}
+	}
+	// check vectors and points against the types of labelled variables
+	for _, pv := range m.vars {
+		if pv.label == "" {
+			continue
+		}
+		var fieldSet []parser.Property
+		for _, p := range literals {
+			if alias, field, _ := strings.Cut(p.Name, "."); alias == pv.name {
+				p.Name = field
+				fieldSet = append(fieldSet, p)
+			}
+		}
+		fields := typeFields(m.cat, pv.label)
+		if err := m.e.checkValues(pv.label, fields, fieldSet); err != nil {
+			return nil, err
+		}
+	}
+	return targets, nil
+}
+
+// compileDelete returns the variables a MATCH ... DELETE names
+func (m *pathMatcher) compileDelete(names []string) ([]int, error) {
+	var dels []int
+	for _, name := range names {
+		v := m.varIndex(name)
+		if v < 0 {
+			return nil, fmt.Errorf("DELETE %s: not a variable of the pattern", name)
+		}
+		dels = append(dels, v)
+	}
+	return dels, nil
+}
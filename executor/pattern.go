@@ -0,0 +1,653 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"grapho/catalog"
+	"grapho/parser"
+)
+
+/* ---------------------- Path patterns ---------------------- */
+
+// MATCH (p:Person)-[w:WORKS_AT]->(c:Company) joins nodes along edges. The
+// first node of each path is looked up like a plain MATCH, by the properties
+// written inside its parentheses, and every edge step follows the edges of the
+// node before it, through adjacency lists built from GraphData.Edges for the
+// edge types the query reaches. A variable named more than once binds the
+// same node or edge everywhere, which joins the paths sharing it, and no row
+// uses an edge twice. Each row carries the IDs and properties of the named
+// variables as alias._id and alias.field, and each named path, p = (...),
+// as a JSON array of the IDs of its nodes and edges, in the order walked.
+//
+// A variable-length edge, -[:KNOWS*1..3]->, takes between 1 and 3 edges in a
+// row; see expand.
+
+// pathVar is a variable of a path MATCH; each anonymous element has its own
+type pathVar struct {
+	name   string
+	label  string // node or edge type; "" for any
+	isEdge bool
+	hops   bool // a variable-length edge
+}
+
+// pathStep is an element of a path with the variable it binds
+type pathStep struct {
+	el *parser.MatchElement
+	v  int
+}
+
+// binding is the node or edge a variable is bound to. A variable-length
+// edge binds the edges it took: its ID is a JSON array of theirs, and its
+// only property _hops their number.
+type binding struct {
+	typ      string
+	id       string
+	props    map[string]interface{}
+	edges    []string // for edges
+	from, to string   // for edges, the IDs of the nodes at their ends
+	via      []string // for a variable-length edge, the nodes between its edges
+}
+
+type pathMatcher struct {
+	e     *Executor
+	ctx   context.Context
+	cat   *catalog.Catalog
+	vars  []pathVar
+	paths [][]pathStep
+	names []string  // the name of each path; "" for none
+	bound []binding // id "" while unbound
+	used  map[string]bool
+	graph GraphReader
+	ret   []returnItem // nil without a RETURN
+	seen  int
+
+	// the WHERE, tested on each complete row; its scope holds the types of
+	// alias.field
+	where  []parser.Property
+	filter parser.Expr
+	scope  *whereScope
+
+	// emit is called with each complete row and returns false to stop
+	emit func() bool
+}
+
+// newPathMatcher resolves the variables of stmt's paths, checking that each is
+// used consistently and that the types it names exist. carried are the
+// variables a WITH hands on; they come first in vars.
+func (e *Executor) newPathMatcher(ctx context.Context, stmt *parser.MatchStmt, carried []pathVar) (*pathMatcher, error) {
+	switch {
+	case len(stmt.Search) > 0 || len(stmt.Within) > 0:
+		return nil, fmt.Errorf("MATCHES and WITHIN cannot be used with path patterns")
+	case stmt.OrderBy != nil:
+		return nil, fmt.Errorf("ORDER BY cannot be used with path patterns")
+	}
+	m := &pathMatcher{
+		e:     e,
+		ctx:   ctx,
+		cat:   e.registry.Current(),
+		used:  make(map[string]bool),
+		graph: e.reader(),
+		vars:  slices.Clone(carried),
+	}
+	byName := make(map[string]int)
+	for i, v := range carried {
+		byName[v.name] = i
+	}
+	named := make(map[string]bool)
+	for _, path := range stmt.Paths {
+		if path.Name != "" {
+			if named[path.Name] {
+				return nil, fmt.Errorf("path '%s' is named twice", path.Name)
+			}
+			named[path.Name] = true
+		}
+		steps := make([]pathStep, len(path.Elements))
+		for i := range path.Elements {
+			el := &path.Elements[i]
+			v, ok := byName[el.Alias]
+			if !ok || el.Alias == "" {
+				v = len(m.vars)
+				m.vars = append(m.vars, pathVar{name: el.Alias, isEdge: el.IsEdge, hops: el.Hops != nil})
+				if el.Alias != "" {
+					byName[el.Alias] = v
+				}
+			}
+			pv := &m.vars[v]
+			if pv.isEdge != el.IsEdge {
+				return nil, fmt.Errorf("'%s' is used as both a node and an edge", el.Alias)
+			}
+			if pv.hops != (el.Hops != nil) {
+				return nil, fmt.Errorf("'%s' is used as both a single edge and a variable-length one", el.Alias)
+			}
+			if el.Type != "" {
+				if pv.label != "" && pv.label != el.Type {
+					return nil, fmt.Errorf("'%s' cannot be both %s and %s", el.Alias, pv.label, el.Type)
+				}
+				pv.label = el.Type
+			}
+			steps[i] = pathStep{el: el, v: v}
+		}
+		m.paths = append(m.paths, steps)
+		m.names = append(m.names, path.Name)
+	}
+	for name := range named {
+		if _, ok := byName[name]; ok {
+			return nil, fmt.Errorf("'%s' names both a path and a node or edge", name)
+		}
+	}
+	for _, v := range m.vars {
+		if v.label == "" {
+			continue
+		}
+		if v.isEdge {
+			if _, ok := m.cat.Edges[v.label]; !ok {
+				return nil, notFound("edge type '%s' does not exist", v.label)
+			}
+		} else if _, ok := m.cat.Nodes[v.label]; !ok {
+			return nil, notFound("node type '%s' does not exist", v.label)
+		}
+	}
+	m.bound = make([]binding, len(m.vars))
+	m.scope = &whereScope{fields: make(map[string]catalog.FieldSpec)}
+	for _, v := range m.vars {
+		if v.name == "" || v.label == "" || v.hops {
+			continue
+		}
+		var fields map[string]catalog.FieldSpec
+		if v.isEdge {
+			fields = m.cat.Edges[v.label].Props
+		} else {
+			fields = m.cat.Nodes[v.label].Fields
+		}
+		for name, spec := range fields {
+			m.scope.fields[v.name+"."+name] = spec
+		}
+	}
+	if err := m.compileWhere(stmt); err != nil {
+		return nil, err
+	}
+	if len(stmt.Return) > 0 {
+		if err := m.compileReturn(stmt); err != nil {
+			return nil, err
+		}
+	}
+	known := make(map[string]bool, len(byName))
+	for name := range byName {
+		known[name] = true
+	}
+	found, err := m.e.prepareWhere(m.ctx, known, append(caseConds(stmt), stmt.Filter)...)
+	if err != nil {
+		return nil, err
+	}
+	m.scope.prepared = found
+	return m, nil
+}
+
+// compileWhere checks the WHERE of a path MATCH, whose conditions must each
+// name a variable of the pattern, as in p.name: 'Ann'
+func (m *pathMatcher) compileWhere(stmt *parser.MatchStmt) error {
+	if len(stmt.Where) == 0 && stmt.Filter == nil {
+		return nil
+	}
+	for i := range stmt.Where {
+		if err := m.checkConds("WHERE", &stmt.Where[i]); err != nil {
+			return err
+		}
+	}
+	if stmt.Filter != nil {
+		if err := m.checkConds("WHERE", stmt.Filter); err != nil {
+			return err
+		}
+	}
+	m.where, m.filter = stmt.Where, stmt.Filter
+	return nil
+}
+
+// checkConds checks that the conditions in x, part of clause, each test
+// alias.field for a variable of the pattern whose nodes or edges may have
+// field, so that a misspelt field is an error rather than no rows
+func (m *pathMatcher) checkConds(clause string, x parser.Node) error {
+	known := make(map[string]bool, len(m.vars))
+	for _, v := range m.vars {
+		if v.name != "" {
+			known[v.name] = true
+		}
+	}
+	aliases, bare := exprAliases(x, known)
+	if bare {
+		return fmt.Errorf("%s: conditions on a path pattern name a variable, as in p.name: 'Ann'", clause)
+	}
+	for _, alias := range aliases {
+		if !known[alias] {
+			return fmt.Errorf("%s: '%s' is not a variable of the pattern", clause, alias)
+		}
+	}
+	for _, name := range exprFields(x) {
+		alias, field, _ := strings.Cut(name, ".")
+		// a path into a json field, as in p.meta.city, needs the field
+		field, _, _ = strings.Cut(field, ".")
+		if !m.varHasField(m.vars[m.varIndex(alias)], field) {
+			return fmt.Errorf("%s: '%s' has no field '%s'", clause, alias, field)
+		}
+	}
+	return nil
+}
+
+// varIndex returns the variable called name, or -1
+func (m *pathMatcher) varIndex(name string) int {
+	for i, v := range m.vars {
+		if v.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// accepts reports whether the bound variables satisfy the WHERE
+func (m *pathMatcher) accepts() bool {
+	if len(m.where) == 0 && m.filter == nil {
+		return true
+	}
+	row := m.boundRow()
+	return m.e.matchesConditions(row, m.where) && m.e.evalExpr(m.scope, row, m.filter)
+}
+
+// run calls emit with each row, in the order of the first node's IDs and then
+// of the edges, until emit returns false
+func (m *pathMatcher) run(emit func() bool) error {
+	m.emit = emit
+	_, err := m.step(0, 0)
+	return err
+}
+
+// step matches element ei of path pi onwards; it returns false once emit has
+// asked to stop
+func (m *pathMatcher) step(pi, ei int) (bool, error) {
+	if pi == len(m.paths) {
+		if !m.accepts() {
+			return true, nil
+		}
+		return m.emit(), nil
+	}
+	path := m.paths[pi]
+	switch {
+	case ei == len(path):
+		return m.step(pi+1, 0)
+	case ei == 0:
+		return m.start(pi)
+	default:
+		return m.follow(pi, ei)
+	}
+}
+
+// start binds the first node of path pi
+func (m *pathMatcher) start(pi int) (bool, error) {
+	first := m.paths[pi][0]
+	if b := m.bound[first.v]; b.id != "" {
+		// a variable a WITH carried may have no type until now
+		if label := m.vars[first.v].label; label != "" && label != b.typ || !m.e.matchesConditions(b.props, first.el.Properties) {
+			return true, nil
+		}
+		return m.step(pi, 1)
+	}
+	types := []string{m.vars[first.v].label}
+	if types[0] == "" {
+		types = sortedKeys(m.e.graph.Nodes)
+	}
+	for _, nodeType := range types {
+		set := m.e.graph.Nodes[nodeType]
+		if set == nil {
+			continue
+		}
+		hits, err := m.e.scanMatching(m.ctx, nodeType, set, first.el.Properties, nil, nil)
+		if err != nil {
+			return false, err
+		}
+		slices.SortFunc(hits, func(a, b scanHit) int { return compareIDs(a.id, b.id) })
+		for _, hit := range hits {
+			m.bound[first.v] = binding{typ: nodeType, id: hit.id, props: hit.props}
+			more, err := m.step(pi, 1)
+			m.bound[first.v] = binding{}
+			if err != nil || !more {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// follow binds the edge at ei of path pi and the node after it, taking each
+// edge of the node before it that fits the pattern
+func (m *pathMatcher) follow(pi, ei int) (bool, error) {
+	path := m.paths[pi]
+	from := m.bound[path[ei-1].v]
+	edge := path[ei]
+	if edge.el.Hops != nil {
+		return m.expand(pi, ei, from)
+	}
+	return m.edgesOf(from, m.vars[edge.v].label, edge.el.Direction, func(edgeType string, inst *EdgeInstance, nodeType, id string) (bool, error) {
+		if !m.e.matchesConditions(inst.Properties, edge.el.Properties) {
+			return true, nil
+		}
+		eb := binding{typ: edgeType, id: inst.ID, props: inst.Properties, edges: []string{inst.ID}, from: inst.FromNodeID, to: inst.ToNodeID}
+		return m.bindStep(pi, ei, eb, nodeType, id)
+	})
+}
+
+// edgesOf calls fn with each edge of edgeType, or of any type if it is "",
+// that leaves from the way dir points, and the type and ID of the node at its
+// other end, until fn returns false
+func (m *pathMatcher) edgesOf(from binding, edgeType string, dir parser.EdgeDirection, fn func(edgeType string, inst *EdgeInstance, nodeType, id string) (bool, error)) (bool, error) {
+	types := []string{edgeType}
+	if edgeType == "" {
+		types = sortedKeys(m.cat.Edges)
+	}
+	for _, edgeType := range types {
+		et := m.cat.Edges[edgeType]
+		// out: from is the FROM end and the other node the TO end; in: the reverse
+		for _, out := range []bool{true, false} {
+			if out && dir == parser.DirIn || !out && dir == parser.DirOut {
+				continue
+			}
+			near, far := et.From.Label, et.To.Label
+			if !out {
+				near, far = et.To.Label, et.From.Label
+			}
+			if near != from.typ {
+				continue
+			}
+			var (
+				more = true
+				ferr error
+			)
+			err := m.graph.Neighbors(m.ctx, edgeType, from.id, !out, func(inst *EdgeInstance) bool {
+				if m.seen++; m.seen%scanCheckEvery == 0 {
+					if ferr = m.ctx.Err(); ferr != nil {
+						return false
+					}
+				}
+				farID := inst.ToNodeID
+				if !out {
+					if dir == parser.DirBoth && inst.FromNodeID == inst.ToNodeID {
+						return true // a loop, already taken going out
+					}
+					farID = inst.FromNodeID
+				}
+				more, ferr = fn(edgeType, inst, far, farID)
+				return ferr == nil && more
+			})
+			if err == nil {
+				err = ferr
+			}
+			if err != nil || !more {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// reached is a node a variable-length edge leads to, with the edges taken
+// and the nodes between them
+type reached struct {
+	typ, id string
+	edges   []string
+	via     []string
+}
+
+// expand binds the variable-length edge at ei of path pi, and the node after
+// it, to each node a breadth-first walk from the node before it reaches
+// within the hop range. The walk never enters a node twice, so every node is
+// reached once, by a shortest way, and cycles end the walk. Conditions inside
+// the brackets hold for every edge taken.
+func (m *pathMatcher) expand(pi, ei int, from binding) (bool, error) {
+	edge := m.paths[pi][ei]
+	hops := edge.el.Hops
+	visited := map[string]bool{from.id: true}
+	frontier := []reached{{typ: from.typ, id: from.id}}
+	var found []reached
+	if hops.Min == 0 {
+		found = append(found, frontier[0])
+	}
+	for depth := 1; len(frontier) > 0 && (hops.Max < 0 || depth <= hops.Max); depth++ {
+		var next []reached
+		for _, r := range frontier {
+			_, err := m.edgesOf(binding{typ: r.typ, id: r.id}, m.vars[edge.v].label, edge.el.Direction, func(_ string, inst *EdgeInstance, nodeType, id string) (bool, error) {
+				if visited[id] || m.used[inst.ID] || !m.e.matchesConditions(inst.Properties, edge.el.Properties) {
+					return true, nil
+				}
+				visited[id] = true
+				via := r.via
+				if len(r.edges) > 0 {
+					via = append(slices.Clip(r.via), r.id)
+				}
+				next = append(next, reached{typ: nodeType, id: id, edges: append(slices.Clip(r.edges), inst.ID), via: via})
+				return true, nil
+			})
+			if err != nil {
+				return false, err
+			}
+		}
+		if depth >= hops.Min {
+			found = append(found, next...)
+		}
+		frontier = next
+	}
+	for _, r := range found {
+		ids, _ := json.Marshal(r.edges)
+		eb := binding{
+			typ:   m.vars[edge.v].label,
+			id:    string(ids),
+			props: map[string]interface{}{"_hops": strconv.Itoa(len(r.edges))},
+			edges: r.edges,
+			from:  from.id,
+			to:    r.id,
+			via:   r.via,
+		}
+		if more, err := m.bindStep(pi, ei, eb, r.typ, r.id); err != nil || !more {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// bindStep binds the edge at ei of path pi to eb, and the node after it to
+// node id of nodeType, if both fit the pattern, and matches the rest
+func (m *pathMatcher) bindStep(pi, ei int, eb binding, nodeType, id string) (bool, error) {
+	edge, next := m.paths[pi][ei], m.paths[pi][ei+1]
+	if was := m.bound[edge.v]; was.id != "" {
+		if was.typ != eb.typ || was.id != eb.id {
+			return true, nil
+		}
+	} else {
+		for _, edgeID := range eb.edges {
+			if m.used[edgeID] {
+				return true, nil
+			}
+		}
+	}
+	if label := m.vars[next.v].label; label != "" && label != nodeType {
+		return true, nil
+	}
+	nb := m.bound[next.v]
+	if nb.id == "" {
+		set := m.e.graph.Nodes[nodeType]
+		if set == nil {
+			return true, nil
+		}
+		props, ok := set.Get(id)
+		if !ok {
+			return true, nil
+		}
+		nb = binding{typ: nodeType, id: id, props: props}
+	} else if nb.id != id {
+		return true, nil
+	}
+	if !m.e.matchesConditions(nb.props, next.el.Properties) {
+		return true, nil
+	}
+
+	bindEdge, bindNode := m.bound[edge.v].id == "", m.bound[next.v].id == ""
+	if bindEdge {
+		m.bound[edge.v] = eb
+		for _, edgeID := range eb.edges {
+			m.used[edgeID] = true
+		}
+	}
+	if bindNode {
+		m.bound[next.v] = nb
+	}
+	more, err := m.step(pi, ei+2)
+	if bindEdge {
+		m.bound[edge.v] = binding{}
+		for _, edgeID := range eb.edges {
+			delete(m.used, edgeID)
+		}
+	}
+	if bindNode {
+		m.bound[next.v] = binding{}
+	}
+	return more, err
+}
+
+// boundRow returns alias._id and alias.field for every named variable
+func (m *pathMatcher) boundRow() map[string]interface{} {
+	props := make(map[string]interface{})
+	for i, v := range m.vars {
+		if v.name != "" {
+			putBinding(props, v.name, m.bound[i])
+		}
+	}
+	return props
+}
+
+// pathIDs returns the IDs of the nodes and edges path pi is bound to, in
+// order, as a JSON array
+func (m *pathMatcher) pathIDs(pi int) string {
+	var ids []string
+	stay := false // after a variable-length edge of no hops
+	for _, st := range m.paths[pi] {
+		b := m.bound[st.v]
+		if !m.vars[st.v].isEdge {
+			if !stay {
+				ids = append(ids, b.id)
+			}
+			stay = false
+			continue
+		}
+		stay = len(b.edges) == 0
+		// a variable-length edge walked from its far end is listed backwards
+		edges, via := b.edges, b.via
+		if m.vars[st.v].hops && b.from != ids[len(ids)-1] {
+			edges, via = slices.Clone(edges), slices.Clone(via)
+			slices.Reverse(edges)
+			slices.Reverse(via)
+		}
+		for i, id := range edges {
+			if i > 0 {
+				ids = append(ids, via[i-1])
+			}
+			ids = append(ids, id)
+		}
+	}
+	b, _ := json.Marshal(ids)
+	return string(b)
+}
+
+// row returns the current row: the RETURN items, or boundRow and the
+// named paths
+func (m *pathMatcher) row() map[string]interface{} {
+	if m.ret == nil {
+		props := m.boundRow()
+		for pi, name := range m.names {
+			if name != "" {
+				props[name] = m.pathIDs(pi)
+			}
+		}
+		return props
+	}
+	props := make(map[string]interface{})
+	var all map[string]interface{} // for CASE
+	for _, it := range m.ret {
+		if it.cas != nil {
+			if all == nil {
+				all = m.boundRow()
+			}
+			props[it.key] = m.e.evalCase(m.scope, all, it.cas)
+			continue
+		}
+		if it.path {
+			props[it.key] = m.pathIDs(it.v)
+			continue
+		}
+		b := m.bound[it.v]
+		switch it.field {
+		case "":
+			putBinding(props, it.alias, b)
+		case "_id":
+			props[it.key] = b.id
+		case "_from":
+			props[it.key] = b.from
+		case "_to":
+			props[it.key] = b.to
+		default:
+			if v, ok := b.props[it.field]; ok {
+				props[it.key] = v
+			}
+		}
+	}
+	return props
+}
+
+// putBinding adds the ID and properties of b to props as alias._id and
+// alias.field, and for an edge its ends as alias._from and alias._to
+func putBinding(props map[string]interface{}, alias string, b binding) {
+	for name, v := range b.props {
+		props[alias+"."+name] = v
+	}
+	props[alias+"._id"] = b.id
+	if b.edges != nil {
+		props[alias+"._from"], props[alias+"._to"] = b.from, b.to
+	}
+}
+
+// executePathMatch executes a MATCH of path patterns, emitting one row per way
+// the paths can be bound
+func (e *Executor) executePathMatch(ctx context.Context, out Output, stmt *parser.MatchStmt) error {
+	last := lastStage(stmt)
+	limit, err := matchLimit(last)
+	if err != nil {
+		return err
+	}
+	m, starts, err := e.stages(ctx, stmt)
+	if err != nil {
+		return err
+	}
+	if out != nil {
+		out.ResultSet()
+	}
+	if limit == 0 {
+		return nil
+	}
+	var seen distinctRows
+	if last.Distinct {
+		seen = make(distinctRows)
+	}
+	rows := 0
+	return m.runFrom(starts, func() bool {
+		row := m.row()
+		if seen != nil && !seen.add(row) {
+			return true
+		}
+		if out != nil {
+			out.Row("", "", row)
+		}
+		rows++
+		return limit < 0 || rows < limit
+	})
+}
@@ -0,0 +1,209 @@
+package executor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"grapho/parser"
+)
+
+/* ---------------------- Plan cache ---------------------- */
+
+// planCacheSize bounds the number of statement shapes kept
+const planCacheSize = 256
+
+// A script's shape is its token stream with string and number literals
+// replaced by parameters, so "INSERT NODE P (n: 1);" and
+// "INSERT NODE P (n:2);" share one. The cache keeps the parsed statements of
+// each shape, keyed by shape and catalog version, and a script with a known
+// shape binds its literals into them instead of being parsed again. Only
+// scripts made entirely of INSERT, UPDATE, DELETE and MATCH statements are
+// cached.
+
+// PlanCacheStats reports how the plan cache has done
+type PlanCacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Size   int    `json:"size"` // shapes cached
+}
+
+// HitRate is the fraction of lookups that found a cached plan
+func (s PlanCacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+type planKey struct {
+	shape   string
+	version uint64
+}
+
+// plan is the parsed form of a shape; slots holds its literals in the order
+// of the script's parameters
+type plan struct {
+	stmts []parser.Stmt
+	slots []*parser.Literal
+}
+
+type planCache struct {
+	mu     sync.Mutex
+	plans  map[planKey]*plan
+	hits   uint64
+	misses uint64
+}
+
+// PlanCacheStats returns the plan cache counters
+func (e *Executor) PlanCacheStats() PlanCacheStats {
+	c := &e.plans
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return PlanCacheStats{Hits: c.hits, Misses: c.misses, Size: len(c.plans)}
+}
+
+// take removes and returns the plan for key, so that no other script binds
+// its literals while it runs; put returns it
+func (c *planCache) take(key planKey) *plan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p := c.plans[key]
+	if p != nil {
+		delete(c.plans, key)
+		c.hits++
+	}
+	return p
+}
+
+// put adds p, a plan that was just parsed if miss is set
+func (c *planCache) put(key planKey, p *plan, miss bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if miss {
+		c.misses++
+	}
+	if c.plans == nil {
+		c.plans = make(map[planKey]*plan)
+	}
+	if len(c.plans) >= planCacheSize {
+		for k := range c.plans {
+			delete(c.plans, k)
+			break
+		}
+	}
+	c.plans[key] = p
+}
+
+// scriptShape lexes script into its shape and parameters. ok is false for
+// scripts the lexer rejects, which are left to the parser to report.
+func scriptShape(script string) (shape string, params []parser.Token, ok bool) {
+	var b strings.Builder
+	lx := parser.NewLexer(script)
+	for {
+		tok := lx.NextToken()
+		switch tok.Type {
+		case parser.EOF:
+			return b.String(), params, true
+		case parser.ILLEGAL:
+			return "", nil, false
+		case parser.STRING, parser.NUMBER, parser.BLOBSTR:
+			params = append(params, tok)
+			b.WriteString(strconv.Itoa(int(tok.Type)))
+			b.WriteString("?\x00")
+		default:
+			b.WriteString(strconv.Itoa(int(tok.Type)))
+			b.WriteByte(' ')
+			b.WriteString(tok.Lit)
+			b.WriteByte(0)
+		}
+	}
+}
+
+// newPlan makes a plan of stmts, parsed from a script with params, or returns
+// nil if they cannot be cached
+func newPlan(stmts []parser.Stmt, params []parser.Token) *plan {
+	type pos struct{ line, col int }
+	index := make(map[pos]int, len(params))
+	for i, tok := range params {
+		index[pos{tok.Line, tok.Column}] = i
+	}
+	p := &plan{stmts: stmts, slots: make([]*parser.Literal, len(params))}
+	found := 0
+	for _, st := range stmts {
+		switch st.(type) {
+		case *parser.InsertNodeStmt, *parser.InsertEdgeStmt,
+			*parser.MergeNodeStmt, *parser.MergeEdgeStmt,
+			*parser.UpdateNodeStmt, *parser.UpdateEdgeStmt,
+			*parser.DeleteNodeStmt, *parser.DeleteEdgeStmt,
+			*parser.MatchStmt:
+		default:
+			return nil
+		}
+		parser.Inspect(st, func(n parser.Node) bool {
+			lit, ok := n.(*parser.Literal)
+			if !ok || (lit.Kind != parser.LitString && lit.Kind != parser.LitNumber && lit.Kind != parser.LitBlob) {
+				return true
+			}
+			if i, ok := index[pos{lit.Line, lit.Col}]; ok && p.slots[i] == nil {
+				p.slots[i] = lit
+				found++
+			}
+			return true
+		})
+	}
+	// every parameter must land in a literal the plan can rebind
+	if found != len(params) {
+		return nil
+	}
+	return p
+}
+
+// Prepare parses script for Execute, reusing the statements of an earlier
+// script with the same shape when the plan cache has them. Call release once
+// the statements have run, and do not keep them afterwards: the next script of
+// the same shape rebinds their literals. Hooks may keep the statements they
+// see, so while any are registered every script is parsed afresh.
+func (e *Executor) Prepare(script string) (stmts []parser.Stmt, release func(), err error) {
+	return e.prepare(script, len(e.hooks) == 0)
+}
+
+// prepare parses script, or binds its literals into the cached plan of its
+// shape. release returns the plan to the cache once the statements have run.
+func (e *Executor) prepare(script string, cache bool) (stmts []parser.Stmt, release func(), err error) {
+	release = func() {}
+	var (
+		key    planKey
+		params []parser.Token
+	)
+	if cache {
+		key.version = e.registry.Current().Version
+		key.shape, params, cache = scriptShape(script)
+	}
+	if cache {
+		if p := e.plans.take(key); p != nil {
+			p.bind(params)
+			return p.stmts, func() { e.plans.put(key, p, false) }, nil
+		}
+	}
+
+	stmts, errs := parser.NewParser(script).ParseScript()
+	if len(errs) > 0 {
+		return nil, release, fmt.Errorf("parse error: %w", parser.ParseErrors(errs))
+	}
+	if cache {
+		if p := newPlan(stmts, params); p != nil {
+			release = func() { e.plans.put(key, p, true) }
+		}
+	}
+	return stmts, release, nil
+}
+
+// bind sets the literals of p to params
+func (p *plan) bind(params []parser.Token) {
+	for i, tok := range params {
+		lit := p.slots[i]
+		lit.Text, lit.Line, lit.Col = tok.Lit, tok.Line, tok.Column
+	}
+}
@@ -0,0 +1,312 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"grapho/catalog"
+	"grapho/parser"
+)
+
+/* ---------------------- RETURN projection ---------------------- */
+
+// RETURN lists what each row of a MATCH holds: a field, alias.field for the
+// node or edge an alias names, or a bare alias for all of its fields. Edges
+// also have _from and _to, the IDs of the nodes at their ends. The
+// items are checked against the catalog before anything is read, and rows
+// then carry only them, keyed as written, so that RETURN u.email gives rows
+// with a "u.email" property. A field a node has no value for is left out.
+// RETURN DISTINCT writes each row once, before LIMIT counts it; since such a
+// row may stand for several nodes, it carries no type or ID. CASE WHEN cond
+// THEN value ... END AS name gives each row a name holding the value of the
+// first WHEN whose condition the row satisfies, tested like a WHERE.
+
+// returnItem is an item of a RETURN list
+type returnItem struct {
+	key   string // as written
+	alias string // "" for a bare field
+	field string // "" for every field of alias
+	v     int    // the variable alias names, in a path MATCH
+	path  bool   // v is instead a named path
+	cas   *parser.CaseExpr
+}
+
+// splitReturn splits the RETURN items of stmt into aliases and fields
+func splitReturn(stmt *parser.MatchStmt) []returnItem {
+	items := make([]returnItem, len(stmt.Return))
+	for i, key := range stmt.Return {
+		if stmt.Cases != nil && stmt.Cases[i] != nil {
+			items[i] = returnItem{key: key, cas: stmt.Cases[i]}
+			continue
+		}
+		items[i] = returnItem{key: key, field: key}
+		if alias, field, ok := strings.Cut(key, "."); ok {
+			items[i].alias, items[i].field = alias, field
+		}
+	}
+	return items
+}
+
+// hasField reports whether fields, those of a node or edge type, include
+// name; every node and edge has an _id
+func hasField(fields map[string]catalog.FieldSpec, name string) bool {
+	_, ok := fields[name]
+	return ok || name == "_id"
+}
+
+// edgeHasField reports whether props, those of an edge type, include name;
+// every edge also has _from and _to
+func edgeHasField(props map[string]catalog.FieldSpec, name string) bool {
+	return hasField(props, name) || name == "_from" || name == "_to"
+}
+
+// typeHasField reports whether typ, a node type or else an edge type, has
+// field
+func typeHasField(cat *catalog.Catalog, typ, field string) bool {
+	if nt, ok := cat.Nodes[typ]; ok {
+		return hasField(nt.Fields, field)
+	}
+	if et, ok := cat.Edges[typ]; ok {
+		return edgeHasField(et.Props, field)
+	}
+	return false
+}
+
+// projection checks the RETURN list of a MATCH of node and edge types and
+// returns the function projecting a row of typ, or nil without a RETURN.
+// found is what prepareWhere found for its CASE conditions.
+func (e *Executor) projection(stmt *parser.MatchStmt, found prepared) (func(typ string, props map[string]interface{}) map[string]interface{}, error) {
+	if len(stmt.Return) == 0 {
+		return nil, nil
+	}
+	cat := e.registry.Current()
+	aliases := make(map[string]string)
+	var types []string
+	for _, el := range stmt.Pattern {
+		_, isNode := cat.Nodes[el.Type]
+		_, isEdge := cat.Edges[el.Type]
+		if !isNode && !isEdge {
+			continue // a missing type is reported when it is matched
+		}
+		types = append(types, el.Type)
+		if el.Alias != "" {
+			aliases[el.Alias] = el.Type
+		}
+	}
+	known := make(map[string]bool, len(aliases))
+	for alias := range aliases {
+		known[alias] = true
+	}
+	items := splitReturn(stmt)
+	var cases map[string][]*parser.CaseExpr // by type, per item
+	for i, it := range items {
+		if it.cas != nil {
+			for _, w := range it.cas.Whens {
+				used, _ := exprAliases(w.Cond, known)
+				for _, alias := range used {
+					if !known[alias] && !patternHasJSON(cat, stmt, alias) {
+						return nil, fmt.Errorf("RETURN %s: '%s' is not an alias of the MATCH", it.key, alias)
+					}
+				}
+				for _, name := range exprFields(w.Cond) {
+					if err := checkAliasField(cat, stmt, "RETURN "+it.key, name); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if cases == nil {
+				cases = make(map[string][]*parser.CaseExpr)
+			}
+			for _, typ := range types {
+				if cases[typ] == nil {
+					cases[typ] = make([]*parser.CaseExpr, len(items))
+				}
+				c := it.cas
+				for alias, t := range aliases {
+					if t == typ {
+						c = stripCase(c, alias)
+					}
+				}
+				cases[typ][i] = c
+			}
+			continue
+		}
+		if it.alias == "" {
+			if _, ok := aliases[it.field]; ok {
+				items[i].alias, items[i].field = it.field, ""
+				continue
+			}
+			found := stmt.OrderBy != nil && it.field == scoreKey(stmt.OrderBy.Metric)
+			for _, typ := range types {
+				found = found || typeHasField(cat, typ, it.field)
+			}
+			if !found && len(types) > 0 {
+				return nil, fmt.Errorf("RETURN %s: no such field in %s", it.key, matchedTypes(stmt))
+			}
+			continue
+		}
+		typ, ok := aliases[it.alias]
+		if !ok {
+			return nil, fmt.Errorf("RETURN %s: '%s' is not an alias of the MATCH", it.key, it.alias)
+		}
+		if !typeHasField(cat, typ, it.field) {
+			return nil, fmt.Errorf("RETURN %s: %s has no field '%s'", it.key, typ, it.field)
+		}
+	}
+	scopes := make(map[string]*whereScope, len(types))
+	for _, typ := range types {
+		scopes[typ] = &whereScope{fields: typeFields(cat, typ), prepared: found}
+	}
+	return func(typ string, props map[string]interface{}) map[string]interface{} {
+		row := make(map[string]interface{}, len(items))
+		for i, it := range items {
+			switch {
+			case it.cas != nil:
+				if cs := cases[typ]; cs != nil {
+					row[it.key] = e.evalCase(scopes[typ], props, cs[i])
+				}
+			case it.alias != "" && aliases[it.alias] != typ:
+			case it.field == "":
+				for name, v := range props {
+					row[name] = v
+				}
+			default:
+				if v, ok := props[it.field]; ok {
+					row[it.key] = v
+				}
+			}
+		}
+		return row
+	}, nil
+}
+
+// stripCase returns a copy of c whose conditions on alias.field test field
+func stripCase(c *parser.CaseExpr, alias string) *parser.CaseExpr {
+	cp := *c
+	cp.Whens = make([]parser.CaseWhen, len(c.Whens))
+	for i, w := range c.Whens {
+		cp.Whens[i] = parser.CaseWhen{Cond: stripAlias(w.Cond, alias), Then: w.Then}
+	}
+	return &cp
+}
+
+// caseConds returns the conditions of the CASE items of a RETURN
+func caseConds(stmt *parser.MatchStmt) []parser.Expr {
+	var conds []parser.Expr
+	for _, c := range stmt.Cases {
+		if c == nil {
+			continue
+		}
+		for _, w := range c.Whens {
+			conds = append(conds, w.Cond)
+		}
+	}
+	return conds
+}
+
+// matchedTypes lists the types of a MATCH for messages
+func matchedTypes(stmt *parser.MatchStmt) string {
+	var names []string
+	for _, el := range stmt.Pattern {
+		if !el.IsEdge {
+			names = append(names, el.Type)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// compileReturn checks the RETURN list of a path MATCH: every item names a
+// variable, and a field must belong to its node or edge type, or to some
+// type when the variable has none
+func (m *pathMatcher) compileReturn(stmt *parser.MatchStmt) error {
+	byName := make(map[string]int)
+	for i, v := range m.vars {
+		if v.name != "" {
+			byName[v.name] = i
+		}
+	}
+	items := splitReturn(stmt)
+	for i, it := range items {
+		if it.cas != nil {
+			for _, w := range it.cas.Whens {
+				if err := m.checkConds("RETURN "+it.key, w.Cond); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if it.alias == "" {
+			if pi := slices.Index(m.names, it.field); pi >= 0 {
+				items[i].field, items[i].v, items[i].path = "", pi, true
+				continue
+			}
+			v, ok := byName[it.field]
+			if !ok {
+				return fmt.Errorf("RETURN %s: name a variable of the pattern, or one of its fields as alias.field", it.key)
+			}
+			items[i].alias, items[i].field, items[i].v = it.field, "", v
+			continue
+		}
+		v, ok := byName[it.alias]
+		switch {
+		case !ok && slices.Contains(m.names, it.alias):
+			return fmt.Errorf("RETURN %s: '%s' is a path, which is returned whole", it.key, it.alias)
+		case !ok:
+			return fmt.Errorf("RETURN %s: '%s' is not a variable of the pattern", it.key, it.alias)
+		}
+		items[i].v = v
+		if !m.varHasField(m.vars[v], it.field) {
+			return fmt.Errorf("RETURN %s: no such field for '%s'", it.key, it.alias)
+		}
+	}
+	m.ret = items
+	return nil
+}
+
+// varHasField reports whether the nodes or edges v can bind may have field
+func (m *pathMatcher) varHasField(v pathVar, field string) bool {
+	switch {
+	case v.hops:
+		return field == "_id" || field == "_hops" || field == "_from" || field == "_to"
+	case v.isEdge && v.label != "":
+		return edgeHasField(m.cat.Edges[v.label].Props, field)
+	case v.label != "":
+		return hasField(m.cat.Nodes[v.label].Fields, field)
+	case field == "_id":
+		return true
+	case v.isEdge:
+		if edgeHasField(nil, field) {
+			return true
+		}
+		for _, et := range m.cat.Edges {
+			if hasField(et.Props, field) {
+				return true
+			}
+		}
+	default:
+		for _, nt := range m.cat.Nodes {
+			if hasField(nt.Fields, field) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// distinctRows holds the rows a RETURN DISTINCT has written, by their JSON
+type distinctRows map[string]struct{}
+
+// add reports whether row is new, remembering it
+func (d distinctRows) add(row map[string]interface{}) bool {
+	b, err := json.Marshal(row) // sorts the keys
+	if err != nil {
+		return true
+	}
+	if _, ok := d[string(b)]; ok {
+		return false
+	}
+	d[string(b)] = struct{}{}
+	return true
+}
@@ -0,0 +1,130 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	"grapho/parser"
+)
+
+/* ---------------------- Structured results ---------------------- */
+
+// An Output gets what a statement did as text through Message, which is all
+// a terminal needs. One that also implements Recorder gets each write's
+// summary as a Change too, so a client can read what was inserted, updated
+// or deleted, and their IDs, without scraping the text. ExecuteStatement collects both, and
+// the rows, into a StatementResult.
+
+// Change is what a write statement did
+type Change struct {
+	NodesInserted, NodesUpdated, NodesDeleted int
+	EdgesInserted, EdgesUpdated, EdgesDeleted int
+	IDs                                       []string // of the nodes and edges inserted, in order
+	UpdatedIDs, DeletedIDs                    []string // of those updated and deleted, in order
+}
+
+// Recorder is an Output that also takes what write statements change
+type Recorder interface {
+	Output
+	// Changed reports c, along with msg, the text Message would have been
+	// given for it
+	Changed(c Change, msg string)
+}
+
+// changed reports c to out, as a Change if it is a Recorder and else as the
+// message format and args spell
+func changed(out Output, c Change, format string, args ...any) {
+	if out == nil {
+		return
+	}
+	if r, ok := out.(Recorder); ok {
+		r.Changed(c, fmt.Sprintf(format, args...))
+		return
+	}
+	out.Message(format, args...)
+}
+
+// Add adds the counts of d to c and appends its IDs
+func (c *Change) Add(d Change) {
+	c.NodesInserted += d.NodesInserted
+	c.NodesUpdated += d.NodesUpdated
+	c.NodesDeleted += d.NodesDeleted
+	c.EdgesInserted += d.EdgesInserted
+	c.EdgesUpdated += d.EdgesUpdated
+	c.EdgesDeleted += d.EdgesDeleted
+	c.IDs = append(c.IDs, d.IDs...)
+	c.UpdatedIDs = append(c.UpdatedIDs, d.UpdatedIDs...)
+	c.DeletedIDs = append(c.DeletedIDs, d.DeletedIDs...)
+}
+
+// StatementResult is everything a statement produced
+type StatementResult struct {
+	// Columns names the fields of the rows: those a RETURN lists in its
+	// order, then any others in name order
+	Columns  []string
+	Rows     []ResultRow
+	Change   Change
+	Messages []string
+}
+
+// ResultRow is a row of a StatementResult. A path MATCH row joins several
+// nodes and edges, and has no Type or ID.
+type ResultRow struct {
+	Type       string
+	ID         string
+	Properties map[string]interface{}
+}
+
+// ExecuteStatement runs stmt as Execute does and returns what it produced
+func (e *Executor) ExecuteStatement(ctx context.Context, stmt parser.Stmt) (*StatementResult, error) {
+	rc := &resultCollector{}
+	if err := e.Execute(ctx, rc, stmt); err != nil {
+		return nil, err
+	}
+	rc.res.Columns = resultColumns(stmt, rc.res.Rows)
+	return &rc.res, nil
+}
+
+// resultColumns returns the Columns of a StatementResult of stmt with rows
+func resultColumns(stmt parser.Stmt, rows []ResultRow) []string {
+	seen := make(map[string]bool)
+	for _, r := range rows {
+		for name := range r.Properties {
+			if name != "_id" {
+				seen[name] = true
+			}
+		}
+	}
+	var cols []string
+	if m, ok := stmt.(*parser.MatchStmt); ok {
+		for _, item := range lastStage(m).Return {
+			if seen[item] {
+				cols = append(cols, item)
+				delete(seen, item)
+			}
+		}
+	}
+	return append(cols, sortedKeys(seen)...)
+}
+
+// resultCollector is the Recorder behind ExecuteStatement
+type resultCollector struct {
+	res StatementResult
+}
+
+func (rc *resultCollector) Message(format string, args ...any) {
+	rc.res.Messages = append(rc.res.Messages, fmt.Sprintf(format, args...))
+}
+
+func (rc *resultCollector) ResultSet() {}
+
+func (rc *resultCollector) Row(nodeType, id string, props map[string]interface{}) {
+	// a copy, as the graph may change after the statement
+	rc.res.Rows = append(rc.res.Rows, ResultRow{Type: nodeType, ID: id, Properties: maps.Clone(props)})
+}
+
+func (rc *resultCollector) Changed(c Change, msg string) {
+	rc.res.Change.Add(c)
+	rc.res.Messages = append(rc.res.Messages, msg)
+}
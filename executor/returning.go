@@ -0,0 +1,91 @@
+package executor
+
+import (
+	"fmt"
+
+	"grapho/catalog"
+)
+
+/* ---------------------- RETURNING ---------------------- */
+
+// Besides counting them, the Change of a write lists the IDs of the nodes
+// and edges it inserted, updated and deleted. An UPDATE or DELETE that ends
+// with RETURNING also writes them as rows, as a MATCH would, so a client can
+// go on from them without matching them again: RETURNING * gives all their
+// fields, and RETURNING name, age only those, leaving out any a node has no
+// value for. An UPDATE returns what it wrote, under the new ID of a node
+// whose primary key it changed, and a DELETE what it took away. Edges also
+// have _id, _from and _to. The fields are checked against the catalog
+// before anything is written.
+
+// checkReturning rejects fields, the RETURNING of a write to typ, if one is
+// not a field of typ
+func checkReturning(cat *catalog.Catalog, typ string, fields []string) error {
+	if len(fields) == 1 && fields[0] == "*" || cat.Nodes[typ] == nil && cat.Edges[typ] == nil {
+		// a missing type is reported by the write
+		return nil
+	}
+	for _, field := range fields {
+		if !typeHasField(cat, typ, field) {
+			return fmt.Errorf("RETURNING: %s has no field '%s'", typ, field)
+		}
+	}
+	return nil
+}
+
+// writeReturned writes hits, the nodes or edges of typ a write changed, as
+// the rows of its RETURNING fields; nothing without them
+func writeReturned(out Output, typ string, fields []string, hits []scanHit) {
+	if out == nil || fields == nil {
+		return
+	}
+	out.ResultSet()
+	for _, hit := range hits {
+		row := hit.props
+		if fields[0] != "*" {
+			row = make(map[string]interface{}, len(fields))
+			for _, field := range fields {
+				if v, ok := hit.props[field]; ok {
+					row[field] = v
+				}
+			}
+		}
+		out.Row(typ, hit.id, row)
+	}
+}
+
+// edgeHits returns the edges of edgeType at indexes, with their _id, _from
+// and _to
+func (e *Executor) edgeHits(edgeType string, indexes []int) []scanHit {
+	edges := e.graph.Edges[edgeType]
+	hits := make([]scanHit, len(indexes))
+	for j, i := range indexes {
+		hits[j] = scanHit{id: edges[i].ID, props: edgeRow(&edges[i])}
+	}
+	return hits
+}
+
+// edgeIDs returns the IDs of the edges of edgeType at indexes
+func (e *Executor) edgeIDs(edgeType string, indexes []int) []string {
+	if len(indexes) == 0 {
+		return nil
+	}
+	edges := e.graph.Edges[edgeType]
+	ids := make([]string, len(indexes))
+	for j, i := range indexes {
+		ids[j] = edges[i].ID
+	}
+	return ids
+}
+
+// hitIDs returns the IDs of hits, in order
+func hitIDs(hits []scanHit) []string {
+	if len(hits) == 0 {
+		return nil
+	}
+	ids := make([]string, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.id
+	}
+	return ids
+}
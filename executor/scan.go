@@ -0,0 +1,594 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"grapho/parser"
+)
+
+/* ---------------------- Partitioned node storage and parallel scans ---------------------- */
+
+// DefaultPartitions is the number of partitions each node type is split into
+// unless SetPartitions says otherwise
+const DefaultPartitions = 16
+
+// parallelScanMin is the size below which a type is scanned on one goroutine;
+// for small types starting workers costs more than it saves
+const parallelScanMin = 4096
+
+// scanCheckEvery is how many nodes a scan visits between checks of its context
+const scanCheckEvery = 1024
+
+// NodeSet holds the nodes of one type, split into partitions by a hash of
+// their primary key, or of the node ID when the type has none or a node has
+// no key value. Scans work through the partitions in parallel, and a lookup
+// by primary key only reads the one partition the key hashes to.
+//
+// A deleted node, or the old place of one whose key moved it to another
+// partition, leaves a tombstone in its partition: its ID with nil
+// properties. No reader sees it, and VACUUM drops it.
+type NodeSet struct {
+	shards []map[string]map[string]interface{}
+	n      int
+
+	// removed counts the tombstones in the partitions; see vacuum.go
+	removed int
+
+	// key is the field nodes are placed by, the primary key of the type when
+	// the set was created; "" places them by ID
+	key string
+
+	// epochs records the graph epoch each partition was created in; a
+	// partition from an earlier epoch may be shared with a snapshot and is
+	// copied before it is written
+	epochs []uint64
+
+	// filters holds bloom filters of key field values; see bloom.go
+	filters map[string]*bloomFilter
+
+	// vectors holds the parsed values of vector fields; see vector.go
+	vectors map[string]*vectorIndex
+
+	// text holds full-text indexes; see fulltext.go
+	text map[string]*textIndex
+
+	// geo holds geohash indexes of point fields; see geo.go
+	geo map[string]*geoIndex
+
+	// unique maps the values of key fields to nodes; see unique.go
+	unique map[string]*uniqueIndex
+
+	// indexes maps the values of indexed fields to nodes; see index.go
+	indexes map[string]*fieldIndex
+
+	// seg holds nodes read from a data segment rather than the partitions,
+	// but for those in shadowed, which were rewritten or deleted since and
+	// are copied before they are written from another epoch; see segment.go
+	seg         *segment
+	shadowed    map[string]bool
+	shadowEpoch uint64
+}
+
+// SetPartitions sets the number of partitions each node type is split into. It
+// must be called before any node is inserted; the count is not persisted, so a
+// data directory may be reopened with a different one.
+func (e *Executor) SetPartitions(n int) error {
+	if n < 1 {
+		return fmt.Errorf("partition count must be at least 1, got %d", n)
+	}
+	if len(e.graph.Nodes) > 0 {
+		return fmt.Errorf("cannot change the partition count once nodes exist")
+	}
+	e.graph.partitions = n
+	return nil
+}
+
+func newNodeSet(epoch uint64, partitions int, key string) *NodeSet {
+	s := &NodeSet{
+		shards: make([]map[string]map[string]interface{}, partitions),
+		key:    key,
+		epochs: make([]uint64, partitions),
+	}
+	for i := range s.shards {
+		s.shards[i] = make(map[string]map[string]interface{})
+		s.epochs[i] = epoch
+	}
+	return s
+}
+
+// partitionOf hashes key with FNV-1a
+func partitionOf(key string, partitions int) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h % uint32(partitions))
+}
+
+// partitionKey is the text a stored value is hashed by; null has none
+func partitionKey(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case Temporal:
+		return v.String(), true
+	case JSON:
+		return v.String(), true
+	case Blob:
+		return v.String(), true
+	}
+	return "", false
+}
+
+// place returns the partition a node belongs in
+func (s *NodeSet) place(id string, props map[string]interface{}) int {
+	if s.key != "" {
+		if k, ok := partitionKey(props[s.key]); ok {
+			return partitionOf(k, len(s.shards))
+		}
+	}
+	return partitionOf(id, len(s.shards))
+}
+
+// find returns the partition holding id, or -1
+func (s *NodeSet) find(id string) int {
+	i := partitionOf(id, len(s.shards))
+	if s.shards[i][id] != nil {
+		return i
+	}
+	if s.key == "" {
+		return -1
+	}
+	// nodes placed by key can be in any partition
+	for i, shard := range s.shards {
+		if shard[id] != nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// pinned returns the one partition that can hold nodes matching conds, or -1
+// when conds do not fix the key and every partition must be scanned
+func (s *NodeSet) pinned(conds []parser.Property) int {
+	if s.key == "" {
+		return -1
+	}
+	for _, c := range conds {
+		if c.Name != s.key {
+			continue
+		}
+		switch c.Value.Kind {
+		case parser.LitString, parser.LitNumber, parser.LitBool:
+			return partitionOf(c.Value.Text, len(s.shards))
+		}
+	}
+	return -1
+}
+
+// Len returns the number of nodes in the set
+func (s *NodeSet) Len() int {
+	return s.n
+}
+
+// Partitions returns the number of nodes in each partition, not counting
+// those in a data segment
+func (s *NodeSet) Partitions() []int {
+	sizes := make([]int, len(s.shards))
+	for i, shard := range s.shards {
+		for _, props := range shard {
+			if props != nil {
+				sizes[i]++
+			}
+		}
+	}
+	return sizes
+}
+
+// Get returns the properties of the node with the given ID
+func (s *NodeSet) Get(id string) (map[string]interface{}, bool) {
+	i := s.find(id)
+	if i < 0 {
+		return s.segGet(id)
+	}
+	return s.shards[i][id], true
+}
+
+// Range calls fn for every node, partition by partition, until fn returns false
+func (s *NodeSet) Range(fn func(id string, props map[string]interface{}) bool) {
+	for _, shard := range s.shards {
+		for id, props := range shard {
+			if props != nil && !fn(id, props) {
+				return
+			}
+		}
+	}
+	if s.seg != nil {
+		s.rangeSegment(0, s.seg.Len(), fn)
+	}
+}
+
+// rangePartition calls fn for every node of partition i until fn returns
+// false
+func (s *NodeSet) rangePartition(i int, fn func(id string, props map[string]interface{}) bool) {
+	for id, props := range s.shards[i] {
+		if props != nil && !fn(id, props) {
+			return
+		}
+	}
+	if lo, hi := s.segPartition(i); lo < hi {
+		s.rangeSegment(lo, hi, fn)
+	}
+}
+
+// IDs returns the IDs of all nodes in the set, in no particular order
+func (s *NodeSet) IDs() []string {
+	ids := make([]string, 0, s.n)
+	for _, shard := range s.shards {
+		for id, props := range shard {
+			if props != nil {
+				ids = append(ids, id)
+			}
+		}
+	}
+	if s.seg != nil {
+		for i := range s.seg.Len() {
+			if id := s.seg.id(i); !s.shadowed[id] {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// put stores a node, moving it to another partition if its key changed
+func (s *NodeSet) put(epoch uint64, id string, props map[string]interface{}) {
+	if props == nil {
+		props = map[string]interface{}{} // nil is a tombstone
+	}
+	to := s.place(id, props)
+	var old map[string]interface{}
+	if from := s.find(id); from < 0 {
+		var ok bool
+		if old, ok = s.segGet(id); ok {
+			s.shadow(epoch, id)
+		} else {
+			s.n++
+		}
+	} else {
+		old = s.shards[from][id]
+		if from != to {
+			s.own(epoch, from)[id] = nil
+			s.removed++
+		}
+	}
+	if tomb, ok := s.shards[to][id]; ok && tomb == nil {
+		s.removed--
+	}
+	s.own(epoch, to)[id] = props
+	s.addToFilters(epoch, props)
+	s.indexVectors(epoch, id, props)
+	s.indexText(epoch, id, old, props)
+	s.indexPoints(epoch, id, old, props)
+	s.indexUnique(epoch, id, old, props)
+	s.indexFields(epoch, id, old, props)
+}
+
+func (s *NodeSet) delete(epoch uint64, id string) {
+	old, found := map[string]interface{}(nil), false
+	if i := s.find(id); i >= 0 {
+		old, found = s.shards[i][id], true
+		s.own(epoch, i)[id] = nil
+		s.removed++
+	} else if old, found = s.segGet(id); found {
+		s.shadow(epoch, id)
+	}
+	if found {
+		s.n--
+		s.indexVectors(epoch, id, nil)
+		s.indexText(epoch, id, old, nil)
+		s.indexPoints(epoch, id, old, nil)
+		s.indexUnique(epoch, id, old, nil)
+		s.indexFields(epoch, id, old, nil)
+	}
+}
+
+// own returns partition i for writing, copying it first if it predates epoch
+func (s *NodeSet) own(epoch uint64, i int) map[string]map[string]interface{} {
+	if s.epochs[i] != epoch {
+		s.shards[i] = maps.Clone(s.shards[i])
+		s.epochs[i] = epoch
+	}
+	return s.shards[i]
+}
+
+// share returns a copy of s that shares its partitions; see Snapshot
+func (s *NodeSet) share() *NodeSet {
+	cp := *s
+	cp.shards = slices.Clone(s.shards)
+	cp.epochs = slices.Clone(s.epochs)
+	cp.filters = maps.Clone(s.filters)
+	cp.vectors = maps.Clone(s.vectors)
+	cp.text = maps.Clone(s.text)
+	cp.geo = maps.Clone(s.geo)
+	cp.unique = maps.Clone(s.unique)
+	cp.indexes = maps.Clone(s.indexes)
+	return &cp
+}
+
+// scanHit is a node a scan accepted
+type scanHit struct {
+	id    string
+	props map[string]interface{}
+}
+
+// scanMatching returns the nodes of set, the nodes of nodeType, that match
+// conds and satisfy filter, a filter prepareWhere has checked, in sc. It reads
+// nothing when a bloom filter rules out a key value in conds, only the nodes
+// an index gives when a condition tests an indexed field, and only one
+// partition when conds fix the primary key. With statistics it tests the most
+// selective condition first.
+func (e *Executor) scanMatching(ctx context.Context, nodeType string, set *NodeSet, conds []parser.Property, filter parser.Expr, sc *whereScope) ([]scanHit, error) {
+	if e.absent(nodeType, set, conds) {
+		return nil, ctx.Err()
+	}
+	ordered := e.orderConditions(nodeType, conds)
+	keep := func(props map[string]interface{}) bool {
+		return e.matchesConditions(props, ordered) && e.evalExpr(sc, props, filter)
+	}
+	if ids, ok := e.indexedIDs(nodeType, set, conds, filter, sc); ok {
+		return lookupNodes(ctx, set, ids, keep)
+	}
+	if set != nil {
+		if i := set.pinned(conds); i >= 0 {
+			hits, err := scanShard(ctx, set.shards[i], keep, nil)
+			if lo, hi := set.segPartition(i); err == nil && lo < hi {
+				hits, err = set.scanSegment(ctx, lo, hi, keep, hits)
+			}
+			return hits, err
+		}
+	}
+	return scanNodes(ctx, e.reader(), nodeType, keep)
+}
+
+// matchEdges returns the edges of edgeType that satisfy the WHERE of stmt in
+// sc, in ID order. Each comes as its properties with _id, _from and _to added,
+// which the WHERE can test too.
+func (e *Executor) matchEdges(ctx context.Context, edgeType string, stmt *parser.MatchStmt, sc *whereScope) ([]scanHit, error) {
+	if len(stmt.Search) > 0 || len(stmt.Within) > 0 || stmt.OrderBy != nil {
+		return nil, fmt.Errorf("MATCHES, WITHIN and ORDER BY cannot be used with edge type '%s'", edgeType)
+	}
+	var hits []scanHit
+	for i := range e.graph.Edges[edgeType] {
+		if i%scanCheckEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		inst := &e.graph.Edges[edgeType][i]
+		if inst.Deleted() {
+			continue
+		}
+		props := edgeRow(inst)
+		if e.matchesConditions(props, stmt.Where) && e.evalExpr(sc, props, stmt.Filter) {
+			hits = append(hits, scanHit{id: inst.ID, props: props})
+		}
+	}
+	return hits, nil
+}
+
+// edgeRow returns the properties of inst with its _id, _from and _to
+func edgeRow(inst *EdgeInstance) map[string]interface{} {
+	props := make(map[string]interface{}, len(inst.Properties)+3)
+	for name, v := range inst.Properties {
+		props[name] = v
+	}
+	props["_id"], props["_from"], props["_to"] = inst.ID, inst.FromNodeID, inst.ToNodeID
+	return props
+}
+
+// indexFilter narrows down the nodes a MATCH returns: ids, if not nil, holds
+// the only nodes that can match, typically from an index, and keep, if not
+// nil, must accept each node
+type indexFilter struct {
+	ids  map[string]struct{}
+	keep func(props map[string]interface{}) bool
+}
+
+// matchNodes returns the nodes of nodeType that satisfy the WHERE of stmt in
+// sc. Without MATCHES or WITHIN conditions it is scanMatching; with them it
+// reads only the nodes their indexes allow, and returns them in ID order.
+func (e *Executor) matchNodes(ctx context.Context, nodeType string, stmt *parser.MatchStmt, sc *whereScope) ([]scanHit, error) {
+	set := e.graph.Nodes[nodeType]
+	if len(stmt.Search) == 0 && len(stmt.Within) == 0 {
+		return e.scanMatching(ctx, nodeType, set, stmt.Where, stmt.Filter, sc)
+	}
+	filters, err := e.textFilters(nodeType, set, stmt.Search)
+	if err != nil {
+		return nil, err
+	}
+	geo, err := e.geoFilters(nodeType, set, stmt.Within)
+	if err != nil {
+		return nil, err
+	}
+	filters = append(filters, geo...)
+	if set == nil {
+		return nil, nil
+	}
+
+	ordered := e.orderConditions(nodeType, stmt.Where)
+	var lists []map[string]struct{}
+	keep := func(props map[string]interface{}) bool {
+		if !e.matchesConditions(props, ordered) || !e.evalExpr(sc, props, stmt.Filter) {
+			return false
+		}
+		for _, f := range filters {
+			if f.keep != nil && !f.keep(props) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, f := range filters {
+		if f.ids != nil {
+			lists = append(lists, f.ids)
+		}
+	}
+	if ids, ok := e.indexedIDs(nodeType, set, stmt.Where, stmt.Filter, sc); ok {
+		list := make(map[string]struct{}, len(ids))
+		for _, id := range ids {
+			list[id] = struct{}{}
+		}
+		lists = append(lists, list)
+	}
+
+	var hits []scanHit
+	if len(lists) == 0 {
+		if hits, err = scanNodes(ctx, e.reader(), nodeType, keep); err != nil {
+			return nil, err
+		}
+	} else {
+		// walk the shortest list, looking the others up
+		slices.SortFunc(lists, func(a, b map[string]struct{}) int { return len(a) - len(b) })
+		seen := 0
+	next:
+		for id := range lists[0] {
+			if seen++; seen%scanCheckEvery == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+			}
+			for _, l := range lists[1:] {
+				if _, ok := l[id]; !ok {
+					continue next
+				}
+			}
+			if props, ok := set.Get(id); ok && keep(props) {
+				hits = append(hits, scanHit{id: id, props: props})
+			}
+		}
+	}
+	slices.SortFunc(hits, func(a, b scanHit) int { return compareIDs(a.id, b.id) })
+	return hits, ctx.Err()
+}
+
+// scanNodes returns the nodes of nodeType in r that keep accepts, in no
+// particular order. keep must only read the properties it is given, as r may
+// call it from several goroutines at once.
+func scanNodes(ctx context.Context, r GraphReader, nodeType string, keep func(map[string]interface{}) bool) ([]scanHit, error) {
+	var (
+		mu   sync.Mutex
+		hits []scanHit
+	)
+	err := r.ScanType(ctx, nodeType, func(id string, props map[string]interface{}) bool {
+		if keep(props) {
+			mu.Lock()
+			hits = append(hits, scanHit{id: id, props: props})
+			mu.Unlock()
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hits, nil
+}
+
+// ScanType scans the nodes of nodeType in memory. Large types are scanned by
+// a pool of workers, one partition at a time, the partitions of a data
+// segment after those in memory.
+func (g *GraphData) ScanType(ctx context.Context, nodeType string, fn func(id string, props map[string]interface{}) bool) error {
+	set := g.Nodes[nodeType]
+	if set == nil {
+		return nil
+	}
+	var stop atomic.Bool // fn returned false
+	scanPart := func(i int) error {
+		seen := 0
+		each := func(id string, props map[string]interface{}) bool {
+			if seen++; seen%scanCheckEvery == 0 && (ctx.Err() != nil || stop.Load()) {
+				return false
+			}
+			if !fn(id, props) {
+				stop.Store(true)
+				return false
+			}
+			return true
+		}
+		if i < len(set.shards) {
+			for id, props := range set.shards[i] {
+				if props != nil && !each(id, props) {
+					break
+				}
+			}
+		} else {
+			i -= len(set.shards)
+			set.rangeSegment(int(set.seg.parts[i]), int(set.seg.parts[i+1]), each)
+		}
+		return ctx.Err()
+	}
+	parts := len(set.shards) + set.segParts()
+	workers := min(runtime.GOMAXPROCS(0), parts)
+	if set.Len() < parallelScanMin || workers < 2 {
+		for i := range parts {
+			if err := scanPart(i); err != nil || stop.Load() {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var (
+		errs = make([]error, parts)
+		next = make(chan int)
+		wg   sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if !stop.Load() {
+					errs[i] = scanPart(i)
+				}
+			}
+		}()
+	}
+	for i := range parts {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanShard appends the nodes of a partition that keep accepts to hits
+func scanShard(ctx context.Context, shard map[string]map[string]interface{}, keep func(map[string]interface{}) bool, hits []scanHit) ([]scanHit, error) {
+	seen := 0
+	for id, props := range shard {
+		if seen++; seen%scanCheckEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if props != nil && keep(props) {
+			hits = append(hits, scanHit{id: id, props: props})
+		}
+	}
+	return hits, ctx.Err()
+}
@@ -0,0 +1,487 @@
+package executor
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+/* ---------------------- Data segments ---------------------- */
+
+// A snapshot of a data file may put the nodes of each type in a data segment
+// instead of writing a record for each: a read-only file that loading maps
+// into memory rather than reads, so that the properties of those nodes live
+// in the page cache instead of on the heap, and the graph can be several
+// times larger than the heap without the collector scanning it. A NodeSet
+// keeps the nodes written since in its partitions as usual, ahead of the
+// segment, and the IDs of those it shadows: rewritten, or deleted. Reading a
+// node from a segment decodes its properties afresh, so scans of a type in a
+// segment cost more CPU and short-lived garbage than scans of one in memory.
+// Segments sit in graph-data.segments, named after their type; those no data
+// file refers to any more are removed.
+//
+// A segment holds the ID and properties of each node, as JSON spelled as in
+// a data file, then an index of the nodes, grouped by the partition they
+// were in when it was written and sorted by ID within each, then the
+// partitions, the key field the nodes were placed by, and a footer:
+//
+//	node blocks | index: (offset uint64, id length uint32, props length uint32, crc uint32)...
+//	| partition starts: uint64 x (partitions+1) | key
+//	| footer: index offset uint64, nodes uint64, partitions uint32, key length uint32, crc uint32, magic
+//
+// all big-endian. The CRC (Castagnoli) of an index entry covers the ID and
+// properties of its node, and that of the footer everything from the index
+// to it. Segments of the first version, GRSEG001, have neither.
+
+// SegmentDirName is the directory of a data directory data segments are in
+const SegmentDirName = "graph-data.segments"
+
+// segmentMagic ends every segment
+const segmentMagic = "GRSEG002"
+
+const (
+	segmentEntrySize  = 20
+	segmentFooterSize = 36
+
+	// the sizes in segments without checksums
+	segmentMagicV1      = "GRSEG001"
+	segmentEntrySizeV1  = 16
+	segmentFooterSizeV1 = 32
+)
+
+// segment is a mapped data segment. Its mapping is released once nothing
+// refers to it.
+type segment struct {
+	name  string     // of its file
+	data  []byte     // the mapped file
+	index []byte     // the node index within data
+	parts []uint64   // where each partition begins in the index, and its end
+	key   string     // the field the nodes were placed by; "" for their IDs
+	cache *nodeCache // set when attached; see nodecache.go
+
+	entrySize int  // of the index entries
+	sums      bool // the segment has checksums
+}
+
+// openSegment maps the segment at path
+func openSegment(path string) (*segment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	data, unmap, err := mapFile(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("map segment: %w", err)
+	}
+	seg := &segment{name: filepath.Base(path), data: data}
+	if err := seg.parse(); err != nil {
+		unmap()
+		return nil, fmt.Errorf("segment %s: %w", seg.name, err)
+	}
+	runtime.AddCleanup(seg, func(unmap func() error) { unmap() }, unmap)
+	return seg, nil
+}
+
+// parse reads the footer, partitions and key of the segment and checks that
+// its index fits before them, and matches its checksum
+func (seg *segment) parse() error {
+	d := seg.data
+	footSize := segmentFooterSize
+	seg.entrySize, seg.sums = segmentEntrySize, true
+	switch {
+	case len(d) < len(segmentMagic):
+		return fmt.Errorf("%w: not a data segment", ErrCorrupt)
+	case string(d[len(d)-len(segmentMagicV1):]) == segmentMagicV1:
+		footSize = segmentFooterSizeV1
+		seg.entrySize, seg.sums = segmentEntrySizeV1, false
+	case string(d[len(d)-len(segmentMagic):]) != segmentMagic:
+		return fmt.Errorf("%w: not a data segment", ErrCorrupt)
+	}
+	if len(d) < footSize {
+		return fmt.Errorf("%w: not a data segment", ErrCorrupt)
+	}
+	foot := d[len(d)-footSize:]
+	indexAt := binary.BigEndian.Uint64(foot)
+	n := binary.BigEndian.Uint64(foot[8:])
+	parts := uint64(binary.BigEndian.Uint32(foot[16:]))
+	keyLen := uint64(binary.BigEndian.Uint32(foot[20:]))
+	end := uint64(len(d) - footSize)
+	if seg.sums {
+		if indexAt > end || crc32.Checksum(d[indexAt:end+24], crcTable) != binary.BigEndian.Uint32(foot[24:]) {
+			return fmt.Errorf("%w: footer checksum mismatch", ErrCorrupt)
+		}
+	}
+	size := uint64(seg.entrySize)
+	if parts == 0 || keyLen > end || (parts+1)*8 > end-keyLen || n > end/size {
+		return fmt.Errorf("%w: bad footer", ErrCorrupt)
+	}
+	partsAt := end - keyLen - (parts+1)*8
+	if indexAt > partsAt || partsAt-indexAt != n*size {
+		return fmt.Errorf("%w: bad footer", ErrCorrupt)
+	}
+	seg.index = d[indexAt:partsAt]
+	seg.key = string(d[end-keyLen : end])
+	seg.parts = make([]uint64, parts+1)
+	for i := range seg.parts {
+		seg.parts[i] = binary.BigEndian.Uint64(d[partsAt+uint64(i)*8:])
+		if seg.parts[i] > n || i > 0 && seg.parts[i] < seg.parts[i-1] {
+			return fmt.Errorf("%w: bad partition table", ErrCorrupt)
+		}
+	}
+	if seg.parts[0] != 0 || seg.parts[parts] != n {
+		return fmt.Errorf("%w: bad partition table", ErrCorrupt)
+	}
+	for i := range int(n) {
+		off, idLen, propsLen := seg.entry(i)
+		if off+uint64(idLen)+uint64(propsLen) > indexAt {
+			return fmt.Errorf("%w: node %d lies outside the segment", ErrCorrupt, i)
+		}
+	}
+	return nil
+}
+
+// verify checks the checksum of each node of the segment and that its
+// properties decode, calling bad with those that fail
+func (seg *segment) verify(ctx context.Context, bad func(i int, err error)) error {
+	for i := range seg.Len() {
+		if i%scanCheckEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		if seg.sums {
+			off, idLen, propsLen := seg.entry(i)
+			block := seg.data[off : off+uint64(idLen)+uint64(propsLen)]
+			sum := binary.BigEndian.Uint32(seg.index[i*seg.entrySize+16:])
+			if crc32.Checksum(block, crcTable) != sum {
+				bad(i, errors.New("checksum mismatch"))
+				continue
+			}
+		}
+		if _, err := seg.props(i); err != nil {
+			bad(i, err)
+		}
+	}
+	return nil
+}
+
+// Len returns the number of nodes in the segment
+func (seg *segment) Len() int {
+	return len(seg.index) / seg.entrySize
+}
+
+func (seg *segment) entry(i int) (off uint64, idLen, propsLen uint32) {
+	e := seg.index[i*seg.entrySize:]
+	return binary.BigEndian.Uint64(e), binary.BigEndian.Uint32(e[8:]), binary.BigEndian.Uint32(e[12:])
+}
+
+// idBytes returns the ID of node i, in the mapping
+func (seg *segment) idBytes(i int) []byte {
+	off, idLen, _ := seg.entry(i)
+	return seg.data[off : off+uint64(idLen)]
+}
+
+// id returns the ID of node i
+func (seg *segment) id(i int) string {
+	return string(seg.idBytes(i))
+}
+
+// props decodes the properties of node i
+func (seg *segment) props(i int) (map[string]interface{}, error) {
+	off, idLen, propsLen := seg.entry(i)
+	block := seg.data[off+uint64(idLen) : off+uint64(idLen)+uint64(propsLen)]
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(block, &raw); err != nil {
+		return nil, err
+	}
+	return decodeProps(raw)
+}
+
+// mustProps decodes the properties of node i, which were verified when the
+// segment was attached; a failure now means the file changed underneath
+func (seg *segment) mustProps(i int) map[string]interface{} {
+	props, err := seg.props(i)
+	if err != nil {
+		panic(fmt.Sprintf("segment %s: node %s: %v", seg.name, seg.id(i), err))
+	}
+	return props
+}
+
+// lookup returns the properties of node i for a lookup by ID, through the
+// node cache
+func (seg *segment) lookup(i int) map[string]interface{} {
+	if seg.cache == nil {
+		return seg.mustProps(i)
+	}
+	key := cacheKey{seg, i}
+	if props, ok := seg.cache.get(key); ok {
+		return props
+	}
+	props := seg.mustProps(i)
+	_, _, size := seg.entry(i)
+	seg.cache.put(key, props, int(size))
+	return props
+}
+
+// read returns the properties of node i for a scan, from the node cache if
+// they are in it
+func (seg *segment) read(i int) map[string]interface{} {
+	if seg.cache != nil {
+		if props, ok := seg.cache.peek(cacheKey{seg, i}); ok {
+			return props
+		}
+	}
+	return seg.mustProps(i)
+}
+
+// find returns the index of the node with id, or -1
+func (seg *segment) find(id string) int {
+	search := func(p int) int {
+		lo, hi := int(seg.parts[p]), int(seg.parts[p+1])
+		for lo < hi {
+			m := int(uint(lo+hi) >> 1)
+			if string(seg.idBytes(m)) < id {
+				lo = m + 1
+			} else {
+				hi = m
+			}
+		}
+		if lo < int(seg.parts[p+1]) && string(seg.idBytes(lo)) == id {
+			return lo
+		}
+		return -1
+	}
+	partitions := len(seg.parts) - 1
+	if seg.key == "" {
+		return search(partitionOf(id, partitions))
+	}
+	// nodes placed by key can be in any partition
+	for p := range partitions {
+		if i := search(p); i >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// writeSegment writes the nodes of set, of nodeType, to a new segment in dir
+// and returns the name of its file
+func writeSegment(dir, nodeType string, set *NodeSet) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("mkdir segments: %w", err)
+	}
+	f, err := os.CreateTemp(dir, nodeType+"-*.seg")
+	if err != nil {
+		return "", fmt.Errorf("create segment: %w", err)
+	}
+	if err := writeSegmentTo(f, set); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", fmt.Errorf("write segment: %w", err)
+	}
+	return filepath.Base(f.Name()), nil
+}
+
+func writeSegmentTo(f *os.File, set *NodeSet) error {
+	type indexEntry struct {
+		part            int
+		id              string
+		off             uint64
+		idLen, propsLen uint32
+		sum             uint32
+	}
+	w := bufio.NewWriterSize(f, 64<<10)
+	var (
+		index []indexEntry
+		off   uint64
+		err   error
+	)
+	set.Range(func(id string, props map[string]interface{}) bool {
+		var raw map[string]json.RawMessage
+		if raw, err = encodeProps(props); err != nil {
+			err = fmt.Errorf("node %s: %w", id, err)
+			return false
+		}
+		var b []byte
+		if b, err = json.Marshal(raw); err != nil {
+			return false
+		}
+		index = append(index, indexEntry{part: set.place(id, props), id: id, off: off, idLen: uint32(len(id)), propsLen: uint32(len(b))})
+		index[len(index)-1].sum = crc32.Update(crc32.Checksum([]byte(id), crcTable), crcTable, b)
+		w.WriteString(id)
+		w.Write(b)
+		off += uint64(len(id) + len(b))
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(index, func(a, b indexEntry) int {
+		if a.part != b.part {
+			return a.part - b.part
+		}
+		return strings.Compare(a.id, b.id)
+	})
+	var buf [segmentFooterSize]byte
+	sum := crc32.New(crcTable)
+	meta := io.MultiWriter(w, sum) // what the footer checksum covers
+	parts := make([]uint64, len(set.shards)+1)
+	for _, e := range index {
+		binary.BigEndian.PutUint64(buf[:], e.off)
+		binary.BigEndian.PutUint32(buf[8:], e.idLen)
+		binary.BigEndian.PutUint32(buf[12:], e.propsLen)
+		binary.BigEndian.PutUint32(buf[16:], e.sum)
+		meta.Write(buf[:segmentEntrySize])
+		parts[e.part+1]++
+	}
+	for i := range parts {
+		if i > 0 {
+			parts[i] += parts[i-1]
+		}
+		binary.BigEndian.PutUint64(buf[:], parts[i])
+		meta.Write(buf[:8])
+	}
+	io.WriteString(meta, set.key)
+	binary.BigEndian.PutUint64(buf[:], off)
+	binary.BigEndian.PutUint64(buf[8:], uint64(len(index)))
+	binary.BigEndian.PutUint32(buf[16:], uint32(len(set.shards)))
+	binary.BigEndian.PutUint32(buf[20:], uint32(len(set.key)))
+	meta.Write(buf[:24])
+	binary.BigEndian.PutUint32(buf[24:], sum.Sum32())
+	copy(buf[28:], segmentMagic)
+	w.Write(buf[24:])
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// removeSegments removes the segments in dir other than those in keep
+func removeSegments(dir string, keep []string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".seg") && !slices.Contains(keep, e.Name()) {
+			// a mapping of it stays readable until released
+			os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+}
+
+/* ---------------------- Nodes in segments ---------------------- */
+
+// attach makes seg the segment of s, which must be empty, leaving out the
+// nodes in bad, which failed verify
+func (s *NodeSet) attach(epoch uint64, seg *segment, bad []int) error {
+	if s.n > 0 || s.seg != nil {
+		return errors.New("segment of a node type that has nodes")
+	}
+	s.seg, s.n = seg, seg.Len()
+	for _, i := range bad {
+		s.shadow(epoch, seg.id(i))
+		s.n--
+	}
+	return nil
+}
+
+// segGet returns the properties of the node with id in the segment, unless
+// it is shadowed
+func (s *NodeSet) segGet(id string) (map[string]interface{}, bool) {
+	if s.seg == nil || s.shadowed[id] {
+		return nil, false
+	}
+	i := s.seg.find(id)
+	if i < 0 {
+		return nil, false
+	}
+	return s.seg.lookup(i), true
+}
+
+// shadow marks the node with id in the segment as rewritten or deleted,
+// copying the list first if a snapshot may share it
+func (s *NodeSet) shadow(epoch uint64, id string) {
+	if s.shadowed == nil || s.shadowEpoch != epoch {
+		s.shadowed = maps.Clone(s.shadowed)
+		if s.shadowed == nil {
+			s.shadowed = make(map[string]bool)
+		}
+		s.shadowEpoch = epoch
+	}
+	s.shadowed[id] = true
+}
+
+// segParts returns the number of parts a scan splits the segment into: its
+// partitions
+func (s *NodeSet) segParts() int {
+	if s.seg == nil {
+		return 0
+	}
+	return len(s.seg.parts) - 1
+}
+
+// segPartition returns the part of the segment the nodes of partition i of
+// s are in: the matching partition of the segment if it was written with the
+// partitions s has, and all of it if not
+func (s *NodeSet) segPartition(i int) (lo, hi int) {
+	if s.seg == nil {
+		return 0, 0
+	}
+	if len(s.seg.parts)-1 == len(s.shards) && s.seg.key == s.key {
+		return int(s.seg.parts[i]), int(s.seg.parts[i+1])
+	}
+	return 0, s.seg.Len()
+}
+
+// rangeSegment calls fn for the nodes from lo to hi in the segment that are
+// not shadowed, until fn returns false, and reports whether it did not
+func (s *NodeSet) rangeSegment(lo, hi int, fn func(id string, props map[string]interface{}) bool) bool {
+	for i := lo; i < hi; i++ {
+		id := s.seg.id(i)
+		if s.shadowed[id] {
+			continue
+		}
+		if !fn(id, s.seg.read(i)) {
+			return false
+		}
+	}
+	return true
+}
+
+// scanSegment appends the nodes from lo to hi in the segment of s that keep
+// accepts to hits
+func (s *NodeSet) scanSegment(ctx context.Context, lo, hi int, keep func(map[string]interface{}) bool, hits []scanHit) ([]scanHit, error) {
+	seen := 0
+	var err error
+	s.rangeSegment(lo, hi, func(id string, props map[string]interface{}) bool {
+		if seen++; seen%scanCheckEvery == 0 {
+			if err = ctx.Err(); err != nil {
+				return false
+			}
+		}
+		if keep(props) {
+			hits = append(hits, scanHit{id: id, props: props})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hits, ctx.Err()
+}
@@ -0,0 +1,64 @@
+package executor
+
+import (
+	"errors"
+	"maps"
+	"slices"
+
+	"grapho/catalog"
+)
+
+// ErrReadOnly is returned for statements that change data when they are run
+// on a snapshot
+var ErrReadOnly = errors.New("snapshot is read-only")
+
+// Snapshot returns a read-only executor over the catalog and graph as they are
+// now, for long reads such as exports. Taking it costs O(number of types) and
+// must be serialized with statements like any other call, but reading it need
+// not be: statements run afterwards copy the shards, edge lists and property
+// maps they change instead of writing them in place, so the snapshot never
+// sees them. Statements that change data fail on the snapshot with
+// ErrReadOnly.
+func (e *Executor) Snapshot() *Executor {
+	g := e.graph
+	view := &GraphData{
+		Nodes:      make(map[string]*NodeSet, len(g.Nodes)),
+		Edges:      make(map[string][]EdgeInstance, len(g.Edges)),
+		NextID:     g.NextID,
+		partitions: g.partitions,
+		epoch:      g.epoch,
+		edgeEpochs: map[string]uint64{},
+		adj:        maps.Clone(g.adj),
+		dead:       maps.Clone(g.dead),
+		view:       true,
+	}
+	for t, set := range g.Nodes {
+		view.Nodes[t] = set.share()
+	}
+	for t, edges := range g.Edges {
+		view.Edges[t] = slices.Clip(edges)
+	}
+	// everything that exists now belongs to an older epoch from here on
+	g.epoch++
+	return &Executor{
+		registry: catalog.Static(e.registry.Current()),
+		graph:    view,
+		readOnly: true,
+		stats:    e.stats,
+		layouts:  e.layouts,
+		maxBlob:  e.maxBlob,
+		cache:    e.cache,
+	}
+}
+
+// ownEdges returns the edges of edgeType for writing in place, copying them
+// first if a snapshot may share them
+func (g *GraphData) ownEdges(edgeType string) []EdgeInstance {
+	edges := g.Edges[edgeType]
+	if len(edges) > 0 && g.edgeEpochs[edgeType] != g.epoch {
+		edges = slices.Clone(edges)
+		g.Edges[edgeType] = edges
+		g.edgeEpochs[intern(edgeType)] = g.epoch
+	}
+	return edges
+}
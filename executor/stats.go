@@ -0,0 +1,289 @@
+package executor
+
+import (
+	"context"
+	"math/bits"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"time"
+
+	"grapho/parser"
+)
+
+/* ---------------------- Statistics ---------------------- */
+
+// DefaultStatsSample is the number of nodes of each type CollectStats reads
+// property values from unless told otherwise
+const DefaultStatsSample = 10000
+
+// Statistics describes the graph as it was when CollectStats ran. Node and
+// edge counts and degrees are exact; distinct value counts come from a sample
+// of each node type and are estimates once the type outgrows it.
+type Statistics struct {
+	Collected time.Time            `json:"collected"`
+	Nodes     map[string]NodeStats `json:"nodes"`
+	Edges     map[string]EdgeStats `json:"edges"`
+}
+
+// NodeStats describes the nodes of one type
+type NodeStats struct {
+	Count    int            `json:"count"`
+	Sampled  int            `json:"sampled"`  // nodes whose values were read
+	Distinct map[string]int `json:"distinct"` // estimated distinct values by field
+}
+
+// EdgeStats describes the edges of one type and how they spread over the
+// nodes at either end
+type EdgeStats struct {
+	Count int         `json:"count"`
+	Out   DegreeStats `json:"out"` // edges leaving each FROM node
+	In    DegreeStats `json:"in"`  // edges reaching each TO node
+}
+
+// DegreeStats summarises a degree distribution over the nodes of an endpoint
+// type, counting nodes without edges as degree 0
+type DegreeStats struct {
+	Max  int     `json:"max"`
+	Mean float64 `json:"mean"`
+	P50  int     `json:"p50"`
+	P90  int     `json:"p90"`
+	P99  int     `json:"p99"`
+
+	// Histogram counts the nodes by degree: 0, 1, 2-3, 4-7 and so on, the
+	// ranges doubling
+	Histogram []int `json:"histogram"`
+}
+
+// CollectStats counts the nodes and edges of each type, estimates the distinct
+// values of each field from up to sample nodes of the type, and works out the
+// degree distribution of each edge type. Like a statement it must be
+// serialized with other calls; it reads but does not change the graph, so it
+// may also run on a snapshot.
+func (e *Executor) CollectStats(ctx context.Context, sample int) (*Statistics, error) {
+	if sample <= 0 {
+		sample = DefaultStatsSample
+	}
+	cat := e.registry.Current()
+	st := &Statistics{
+		Collected: time.Now().UTC(),
+		Nodes:     make(map[string]NodeStats, len(cat.Nodes)),
+		Edges:     make(map[string]EdgeStats, len(cat.Edges)),
+	}
+	for name, nt := range cat.Nodes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		ns := NodeStats{Distinct: make(map[string]int, len(nt.Fields))}
+		if set := e.graph.Nodes[name]; set != nil {
+			ns.Count = set.Len()
+			rows := sampleNodes(set, sample)
+			ns.Sampled = len(rows)
+			for field := range nt.Fields {
+				ns.Distinct[field] = estimateDistinct(rows, field, ns.Count)
+			}
+		}
+		st.Nodes[name] = ns
+	}
+	for name, et := range cat.Edges {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		edges := e.graph.Edges[name]
+		out := make(map[string]int)
+		in := make(map[string]int)
+		for _, edge := range edges {
+			if edge.Deleted() {
+				continue
+			}
+			out[edge.FromNodeID]++
+			in[edge.ToNodeID]++
+		}
+		st.Edges[name] = EdgeStats{
+			Count: e.graph.EdgeCount(name),
+			Out:   degreeStats(out, e.nodeCount(et.From.Label)),
+			In:    degreeStats(in, e.nodeCount(et.To.Label)),
+		}
+	}
+	return st, nil
+}
+
+// SetStats gives the planner statistics to work with, typically the latest
+// from CollectStats or ones loaded from disk; nil forgets them. st must not be
+// changed afterwards.
+func (e *Executor) SetStats(st *Statistics) {
+	e.stats = st
+}
+
+// Stats returns the statistics the planner is using, or nil
+func (e *Executor) Stats() *Statistics {
+	return e.stats
+}
+
+// nodeCount returns the number of nodes of nodeType
+func (e *Executor) nodeCount(nodeType string) int {
+	if set := e.graph.Nodes[nodeType]; set != nil {
+		return set.Len()
+	}
+	return 0
+}
+
+// sampleNodes returns the properties of up to n nodes of set, chosen by
+// reservoir sampling
+func sampleNodes(set *NodeSet, n int) []map[string]interface{} {
+	rows := make([]map[string]interface{}, 0, min(n, set.Len()))
+	seen := 0
+	set.Range(func(_ string, props map[string]interface{}) bool {
+		seen++
+		if len(rows) < n {
+			rows = append(rows, props)
+		} else if i := rand.IntN(seen); i < n {
+			rows[i] = props
+		}
+		return true
+	})
+	return rows
+}
+
+// estimateDistinct estimates the number of distinct values of field among
+// total nodes from a sample of them. A sample of the whole type is counted
+// exactly; otherwise the count is scaled up by the Duj1 estimator of Haas et
+// al., which leans on the values seen only once.
+func estimateDistinct(rows []map[string]interface{}, field string, total int) int {
+	counts := make(map[string]int)
+	for _, props := range rows {
+		if v, ok := partitionKey(props[field]); ok {
+			counts[v]++
+		}
+	}
+	n, d := len(rows), len(counts)
+	if n == 0 || n >= total {
+		return d
+	}
+	once := 0
+	for _, c := range counts {
+		if c == 1 {
+			once++
+		}
+	}
+	est := float64(n*d) / (float64(n-once) + float64(once*n)/float64(total))
+	return min(max(int(est+0.5), d), total)
+}
+
+// degreeStats summarises degrees, the edge counts of the nodes that have
+// edges, over nodes nodes in all
+func degreeStats(degrees map[string]int, nodes int) DegreeStats {
+	all := make([]int, max(nodes, len(degrees)))
+	i, sum := len(all)-len(degrees), 0
+	for _, d := range degrees {
+		all[i] = d
+		sum += d
+		i++
+	}
+	if len(all) == 0 {
+		return DegreeStats{}
+	}
+	slices.Sort(all)
+	at := func(p float64) int { return all[int(p*float64(len(all)-1))] }
+	hist := make([]int, bits.Len(uint(all[len(all)-1]))+1)
+	for _, d := range all {
+		hist[bits.Len(uint(d))]++
+	}
+	return DegreeStats{
+		Max:       all[len(all)-1],
+		Mean:      float64(sum) / float64(len(all)),
+		P50:       at(0.5),
+		P90:       at(0.9),
+		P99:       at(0.99),
+		Histogram: hist,
+	}
+}
+
+// degreeRange names bucket i of DegreeStats.Histogram
+func degreeRange(i int) string {
+	if i < 2 {
+		return strconv.Itoa(i)
+	}
+	return strconv.Itoa(1<<(i-1)) + "-" + strconv.Itoa(1<<i-1)
+}
+
+// executeShowStats reports the planner's statistics, one row per type. A row's
+// ID says whether the type is a node or an edge type; its properties are
+// flattened into names such as "distinct.email", "out.p99" and
+// "out.degree.2-3".
+func (e *Executor) executeShowStats(out Output, stmt *parser.ShowStatsStmt) error {
+	st := e.stats
+	if st == nil {
+		if out != nil {
+			out.Message("No statistics collected yet")
+		}
+		return nil
+	}
+	if stmt.Type != "" {
+		_, isNode := st.Nodes[stmt.Type]
+		_, isEdge := st.Edges[stmt.Type]
+		if !isNode && !isEdge {
+			return notFound("no statistics for type '%s'", stmt.Type)
+		}
+	}
+	if out == nil {
+		return nil
+	}
+	out.ResultSet()
+	collected := st.Collected.Format(time.RFC3339)
+	for _, name := range sortedKeys(st.Nodes) {
+		if stmt.Type != "" && name != stmt.Type {
+			continue
+		}
+		ns := st.Nodes[name]
+		props := map[string]interface{}{
+			"collected": collected,
+			"count":     strconv.Itoa(ns.Count),
+			"sampled":   strconv.Itoa(ns.Sampled),
+		}
+		for field, d := range ns.Distinct {
+			props["distinct."+field] = strconv.Itoa(d)
+		}
+		out.Row(name, "node", props)
+	}
+	for _, name := range sortedKeys(st.Edges) {
+		if stmt.Type != "" && name != stmt.Type {
+			continue
+		}
+		es := st.Edges[name]
+		props := map[string]interface{}{
+			"collected": collected,
+			"count":     strconv.Itoa(es.Count),
+		}
+		for dir, ds := range map[string]DegreeStats{"out": es.Out, "in": es.In} {
+			props[dir+".max"] = strconv.Itoa(ds.Max)
+			props[dir+".mean"] = strconv.FormatFloat(ds.Mean, 'f', 2, 64)
+			props[dir+".p50"] = strconv.Itoa(ds.P50)
+			props[dir+".p90"] = strconv.Itoa(ds.P90)
+			props[dir+".p99"] = strconv.Itoa(ds.P99)
+			for i, n := range ds.Histogram {
+				props[dir+".degree."+degreeRange(i)] = strconv.Itoa(n)
+			}
+		}
+		out.Row(name, "edge", props)
+	}
+	return nil
+}
+
+// orderConditions puts the conditions on a node type's most selective fields,
+// those with the most distinct values, first, so that a scan rejects most
+// nodes on the first comparison. Without statistics conds are left as given.
+func (e *Executor) orderConditions(nodeType string, conds []parser.Property) []parser.Property {
+	if len(conds) < 2 || e.stats == nil {
+		return conds
+	}
+	ns, ok := e.stats.Nodes[nodeType]
+	if !ok {
+		return conds
+	}
+	ordered := slices.Clone(conds)
+	slices.SortStableFunc(ordered, func(a, b parser.Property) int {
+		return ns.Distinct[b.Name] - ns.Distinct[a.Name]
+	})
+	return ordered
+}
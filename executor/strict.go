@@ -0,0 +1,116 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+
+	"grapho/catalog"
+	"grapho/parser"
+)
+
+/* ---------------------- Unknown fields ---------------------- */
+
+// INSERT, UPDATE and MERGE may write only the fields the catalog declares
+// for a type, so a misspelt name fails, suggesting the field it is closest
+// to, rather than storing a property nothing reads. MATCH ... SET already
+// checks the fields of each variable. SetLenient turns the check off, for
+// data whose shape the schema does not pin down; commit log replay never
+// makes it, so statements run while lenient replay under either setting.
+
+// SetLenient makes INSERT, UPDATE and MERGE store fields the catalog does
+// not declare as written, rather than reject them
+func (e *Executor) SetLenient(on bool) {
+	e.lenient = on
+}
+
+// checkFields rejects stmt if it writes a field its type does not declare.
+// A statement on a type that does not exist is left for it to report.
+func (e *Executor) checkFields(stmt parser.Stmt) error {
+	cat := e.registry.Current()
+	node := func(typ string, sets ...[]parser.Property) error {
+		if nt, ok := cat.Nodes[typ]; ok {
+			return unknownField("node", typ, nt.Fields, sets)
+		}
+		return nil
+	}
+	edge := func(typ string, sets ...[]parser.Property) error {
+		if et, ok := cat.Edges[typ]; ok {
+			return unknownField("edge", typ, et.Props, sets)
+		}
+		return nil
+	}
+	switch st := stmt.(type) {
+	case *parser.InsertNodeStmt:
+		var set []parser.Property
+		if st.OnConflict != nil {
+			set = st.OnConflict.Set
+		}
+		return node(st.NodeType, st.Properties, set)
+	case *parser.InsertEdgeStmt:
+		return edge(st.EdgeType, st.Properties)
+	case *parser.MergeNodeStmt:
+		return node(st.NodeType, st.Properties, st.OnCreate, st.OnMatch)
+	case *parser.MergeEdgeStmt:
+		return edge(st.EdgeType, st.Properties, st.OnCreate, st.OnMatch)
+	case *parser.UpdateNodeStmt:
+		return node(st.NodeType, st.Set)
+	case *parser.UpdateEdgeStmt:
+		return edge(st.EdgeType, st.Set)
+	}
+	return nil
+}
+
+// unknownField returns an error for the first property of sets that fields,
+// those of the kind of type typ, does not declare
+func unknownField(kind, typ string, fields map[string]catalog.FieldSpec, sets [][]parser.Property) error {
+	for _, set := range sets {
+		for _, p := range set {
+			if _, ok := fields[p.Name]; ok {
+				continue
+			}
+			msg := fmt.Sprintf("%s type '%s' has no field '%s'", kind, typ, p.Name)
+			if near := closestField(fields, p.Name); near != "" {
+				msg += fmt.Sprintf("; did you mean '%s'?", near)
+			}
+			return &ConstraintError{Type: typ, Field: p.Name, Constraint: "unknown field", msg: msg}
+		}
+	}
+	return nil
+}
+
+// closestField returns the field of fields whose name is fewest edits from
+// name, ignoring case, or "" if none is close enough to be a likely typo
+func closestField(fields map[string]catalog.FieldSpec, name string) string {
+	best, bestDist := "", 0
+	for _, field := range sortedKeys(fields) {
+		d := editDistance(strings.ToLower(name), strings.ToLower(field))
+		if n := len([]rune(field)); d >= n || d > max(2, n/3) {
+			continue
+		}
+		if best == "" || d < bestDist {
+			best, bestDist = field, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	row := make([]int, len(t)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		diag := row[0]
+		row[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			diag, row[j] = row[j], min(row[j]+1, row[j-1]+1, diag+cost)
+		}
+	}
+	return row[len(t)]
+}
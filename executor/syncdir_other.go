@@ -0,0 +1,8 @@
+//go:build !unix
+
+package executor
+
+// syncDir does nothing where directories cannot be synced
+func syncDir(dir string) error {
+	return nil
+}
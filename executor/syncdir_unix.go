@@ -0,0 +1,22 @@
+//go:build unix
+
+package executor
+
+import "os"
+
+// syncDir syncs dir, so that the files created in it and renamed into it
+// survive a crash. A missing dir has nothing to sync.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
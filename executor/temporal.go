@@ -0,0 +1,167 @@
+package executor
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"grapho/catalog"
+	"grapho/parser"
+)
+
+/* ---------------------- Dates and times ---------------------- */
+
+// date, time and datetime values are stored as a Temporal, which keeps the
+// instant, or the time of day, along with which of the three it is. It is
+// written out in one spelling whatever it was given in: a date as
+// 2006-01-02, a datetime in RFC 3339 and a time as 15:04:05, each with its
+// fraction of a second if it has one, and a datetime or time with the zone
+// it was given. A WHERE compares them chronologically rather than as text,
+// so that '2024-05-01T10:00:00+02:00' comes before '2024-05-01T09:00:00Z'
+// and '9:30' may be written for 09:30. A value without a zone is taken to be
+// in UTC, and a date stands for its midnight. Time fields compare by time of
+// day alone. Besides the ISO 8601 spellings below, values may be written in
+// the layouts SetTimeLayouts adds.
+
+// datetimeLayouts are the spellings of date and datetime values a WHERE reads
+var datetimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02T15:04", time.DateTime, time.DateOnly}
+
+// clockLayouts are the spellings of time values a WHERE reads
+var clockLayouts = []string{"15:04:05.999999999Z07:00", "15:04:05.999999999", "15:04"}
+
+// Temporal is the stored value of a date, time or datetime field
+type Temporal struct {
+	t     time.Time
+	base  catalog.BaseType
+	zoned bool // for a time, whether it was given a zone
+}
+
+// Time returns the instant v holds: midnight UTC for a date, and a time of
+// day on January 1 of year 0
+func (v Temporal) Time() time.Time { return v.t }
+
+// Base returns the type of the field v is a value of
+func (v Temporal) Base() catalog.BaseType { return v.base }
+
+// String spells v as its type does
+func (v Temporal) String() string {
+	switch {
+	case v.base == catalog.BaseDate:
+		return v.t.Format(time.DateOnly)
+	case v.base == catalog.BaseTime && v.zoned:
+		return v.t.Format("15:04:05.999999999Z07:00")
+	case v.base == catalog.BaseTime:
+		return v.t.Format("15:04:05.999999999")
+	}
+	return v.t.Format(time.RFC3339Nano)
+}
+
+// MarshalText spells v as String does, so that it is a string in JSON
+func (v Temporal) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// SetTimeLayouts adds layouts, as time.Parse takes them, that date, time and
+// datetime values may be written in after the ISO 8601 spellings. Values
+// written in them are stored as any other, so the commit log replays only
+// with the same layouts set.
+func (e *Executor) SetTimeLayouts(layouts []string) {
+	e.layouts = slices.Clone(layouts)
+}
+
+// isTemporal reports whether spec is a date, time or datetime field
+func isTemporal(spec catalog.FieldSpec) bool {
+	t := spec.Type
+	return t.Elem == nil && (t.Base == catalog.BaseDate || t.Base == catalog.BaseTime || t.Base == catalog.BaseDateTime)
+}
+
+// parseTemporal reads s as a value of a field of type base, in the layouts
+// of its type or else those SetTimeLayouts added
+func (e *Executor) parseTemporal(base catalog.BaseType, s string) (Temporal, bool) {
+	return parseTemporal(base, s, e.layouts)
+}
+
+// parseTemporal reads s as a value of a field of type base, in the layouts
+// of its type or else in extra
+func parseTemporal(base catalog.BaseType, s string, extra []string) (Temporal, bool) {
+	s = strings.TrimSpace(s)
+	layouts := datetimeLayouts
+	switch base {
+	case catalog.BaseDate:
+		layouts = []string{time.DateOnly}
+	case catalog.BaseTime:
+		layouts = clockLayouts
+	}
+	for _, layout := range slices.Concat(layouts, extra) {
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			continue
+		}
+		v := Temporal{t: t, base: base}
+		switch base {
+		case catalog.BaseDate:
+			v.t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		case catalog.BaseTime:
+			// a zone is only kept if the layout has one: -07, Z07 or MST
+			v.zoned = strings.Contains(layout, "07") || strings.Contains(layout, "MST")
+			v.t = time.Date(0, 1, 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+		}
+		return v, true
+	}
+	return Temporal{}, false
+}
+
+// readTemporal reads s as a value to compare one of a field of type base
+// with: in the layouts of any temporal type, so that a date field can be
+// compared with a datetime
+func (e *Executor) readTemporal(base catalog.BaseType, s string) (time.Time, bool) {
+	for _, b := range []catalog.BaseType{base, catalog.BaseDateTime, catalog.BaseTime} {
+		if v, ok := e.parseTemporal(b, s); ok {
+			return v.t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// compareTemporal compares v, a value of a field of type base, with the
+// value s spells. It reports false if s cannot be read as a time.
+func (e *Executor) compareTemporal(base catalog.BaseType, v time.Time, s string) (int, bool) {
+	w, ok := e.readTemporal(base, s)
+	if !ok {
+		return 0, false
+	}
+	if base == catalog.BaseTime {
+		v, w = timeOfDay(v), timeOfDay(w)
+	}
+	return v.Compare(w), true
+}
+
+// timeOfDay returns the time of day of t in UTC, on a fixed date
+func timeOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(0, 1, 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// resolveTime returns the value x stands for at now: a datetime in UTC for
+// now(), or a date for date() unless a duration with hours, minutes or
+// seconds moves it off midnight
+func resolveTime(x *parser.TimeExpr, now time.Time) (*parser.Literal, error) {
+	t := now.UTC()
+	dateOnly := x.Func == "date"
+	if dateOnly {
+		t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	for _, sh := range x.Shifts {
+		d, err := parser.ParseDuration(sh.Duration.Text)
+		if err != nil {
+			return nil, err
+		}
+		dateOnly = dateOnly && d.Clock == 0
+		t = d.AddTo(t, sh.Neg)
+	}
+	text := t.Format(time.RFC3339Nano)
+	if dateOnly {
+		text = t.Format(time.DateOnly)
+	}
+	return &parser.Literal{Kind: parser.LitString, Text: text, Line: x.Line, Col: x.Col}, nil
+}
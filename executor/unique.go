@@ -0,0 +1,188 @@
+package executor
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"grapho/catalog"
+)
+
+/* ---------------------- Unique fields ---------------------- */
+
+// No two nodes of a type may share a value of its primary key or of a UNIQUE
+// field. An index per node type and key field maps each value to the node
+// holding it, so INSERT, UPDATE, MERGE and MATCH ... SET look a value up
+// rather than scan for it. A statement writing several nodes is checked as a
+// whole before any is written, so it may swap two values but not give two
+// nodes the same one. Null, or leaving a field out, takes no value: any
+// number of nodes may do so. Like the other indexes, one is built the first
+// time a write needs it and kept up to date as nodes are stored and deleted.
+// No two edges of a type may share a value of a UNIQUE property either;
+// edges have no indexes, so the edges of the type are scanned instead.
+
+type uniqueIndex struct {
+	ids   map[string]string // node ID by value
+	epoch uint64            // see NodeSet.epochs
+}
+
+// uniqueIndex returns the index of field, building it from the nodes if needed
+func (s *NodeSet) uniqueIndex(epoch uint64, field string) *uniqueIndex {
+	if idx := s.unique[field]; idx != nil {
+		return idx
+	}
+	idx := &uniqueIndex{ids: make(map[string]string), epoch: epoch}
+	s.Range(func(id string, props map[string]interface{}) bool {
+		if v, ok := partitionKey(props[field]); ok {
+			idx.ids[v] = id
+		}
+		return true
+	})
+	if s.unique == nil {
+		s.unique = make(map[string]*uniqueIndex)
+	}
+	s.unique[intern(field)] = idx
+	return idx
+}
+
+// indexUnique moves node id in the unique indexes from its old properties to
+// props; either may be nil
+func (s *NodeSet) indexUnique(epoch uint64, id string, old, props map[string]interface{}) {
+	for field, idx := range s.unique {
+		before, had := partitionKey(old[field])
+		after, has := partitionKey(props[field])
+		if had == has && before == after {
+			continue
+		}
+		if idx.epoch != epoch {
+			// a snapshot may share it
+			idx = &uniqueIndex{ids: maps.Clone(idx.ids), epoch: epoch}
+			s.unique[field] = idx
+		}
+		if had && idx.ids[before] == id {
+			delete(idx.ids, before)
+		}
+		if has {
+			idx.ids[after] = id
+		}
+	}
+}
+
+// checkUnique rejects writes, the properties nodes of nodeType are about to
+// be stored with by ID, if they would give two nodes the same value of a key
+// field
+func (e *Executor) checkUnique(nodeType string, writes map[string]map[string]interface{}) error {
+	nt, ok := e.registry.Current().Nodes[nodeType]
+	set := e.graph.Nodes[nodeType]
+	if !ok || set == nil {
+		return nil
+	}
+	ids := sortedKeys(writes)
+	slices.SortFunc(ids, compareIDs)
+	for _, field := range sortedKeys(nt.Fields) {
+		if !isKeyField(nt, field) {
+			continue
+		}
+		idx := set.uniqueIndex(e.graph.epoch, field)
+		taken := make(map[string]string, len(writes))
+		for _, id := range ids {
+			v, ok := partitionKey(writes[id][field])
+			if !ok {
+				continue
+			}
+			other, dup := taken[v]
+			if !dup {
+				// a node the statement writes too is checked by its new value
+				other, dup = idx.ids[v]
+				_, rewritten := writes[other]
+				dup = dup && !rewritten
+			}
+			if dup {
+				return uniqueError(nodeType, nt, field, v, other)
+			}
+			taken[v] = id
+		}
+	}
+	return nil
+}
+
+// checkEdgeUnique rejects writes, the properties edges of edgeType are about
+// to be stored with by ID, if they would give two edges the same value of a
+// UNIQUE property
+func (e *Executor) checkEdgeUnique(edgeType string, writes map[string]map[string]interface{}) error {
+	et, ok := e.registry.Current().Edges[edgeType]
+	if !ok {
+		return nil
+	}
+	ids := sortedKeys(writes)
+	slices.SortFunc(ids, compareIDs)
+	for _, prop := range sortedKeys(et.Props) {
+		if !et.Props[prop].Unique {
+			continue
+		}
+		// an edge the statement writes too is checked by its new value
+		taken := make(map[string]string)
+		for _, inst := range e.graph.Edges[edgeType] {
+			if _, rewritten := writes[inst.ID]; rewritten {
+				continue
+			}
+			if v, ok := partitionKey(inst.Properties[prop]); ok {
+				taken[v] = inst.ID
+			}
+		}
+		for _, id := range ids {
+			v, ok := partitionKey(writes[id][prop])
+			if !ok {
+				continue
+			}
+			if other, dup := taken[v]; dup {
+				return &ConstraintError{
+					Type:       edgeType,
+					Field:      prop,
+					Constraint: "UNIQUE",
+					msg:        fmt.Sprintf("duplicate value '%s' for UNIQUE property '%s' of edge type '%s': edge %s has it", v, prop, edgeType, other),
+				}
+			}
+			taken[v] = id
+		}
+	}
+	return nil
+}
+
+// conflicting returns the node of nodeType that props, the properties of a
+// node about to be inserted, would share a key field value with, trying the
+// primary key first
+func (e *Executor) conflicting(nodeType string, nt *catalog.NodeType, props map[string]interface{}) (string, bool) {
+	set := e.graph.Nodes[nodeType]
+	if set == nil {
+		return "", false
+	}
+	fields := sortedKeys(nt.Fields)
+	if i := slices.Index(fields, nt.PK); i > 0 {
+		fields = slices.Insert(slices.Delete(fields, i, i+1), 0, nt.PK)
+	}
+	for _, field := range fields {
+		v, ok := partitionKey(props[field])
+		if !ok || !isKeyField(nt, field) {
+			continue
+		}
+		if id, ok := set.uniqueIndex(e.graph.epoch, field).ids[v]; ok {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// uniqueError reports that node other already holds value v of field
+func uniqueError(nodeType string, nt *catalog.NodeType, field, v, other string) error {
+	constraint := "UNIQUE"
+	if field == nt.PK {
+		constraint = "PRIMARY KEY"
+	}
+	return &ConstraintError{
+		Type:       nodeType,
+		Field:      field,
+		Constraint: constraint,
+		msg:        fmt.Sprintf("duplicate value '%s' for %s field '%s' of node type '%s': node %s has it", v, constraint, field, nodeType, other),
+	}
+}
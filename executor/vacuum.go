@@ -0,0 +1,100 @@
+package executor
+
+import "grapho/parser"
+
+/* ---------------------- Vacuum ---------------------- */
+
+// Deleting an edge leaves a tombstone in the list of its type (see
+// adjacency.go), and deleting a node one in the map of its partition (see
+// scan.go), so a delete changes nothing but the entries deleted. Vacuum
+// gives the space back: it drops the tombstones of each edge type that has
+// some, which moves the edges after them up and so drops the adjacency of
+// the type, and copies the live nodes of each partition that has
+// tombstones into a map of their size, as Go maps never shrink. What statements see does not change, so VACUUM is not written
+// to the commit log, and snapshots keep the lists and partitions they had.
+
+// DefaultVacuumRatio is the share of a type's nodes or edges that must have
+// been deleted before a background vacuum reclaims their space
+const DefaultVacuumRatio = 0.25
+
+// VacuumStats reports what Vacuum reclaimed
+type VacuumStats struct {
+	Nodes int `json:"nodes"` // node tombstones dropped
+	Edges int `json:"edges"` // tombstones dropped
+}
+
+// Vacuum reclaims the space the deleted nodes and edges of typ take, or of
+// every type if typ is "". A type is vacuumed only once at least ratio of
+// its nodes or edges, counting the deleted, were deleted; VACUUM passes 0.
+func (e *Executor) Vacuum(typ string, ratio float64) (VacuumStats, error) {
+	if e.readOnly {
+		return VacuumStats{}, ErrReadOnly
+	}
+	if typ != "" {
+		cat := e.registry.Current()
+		if cat.Nodes[typ] == nil && cat.Edges[typ] == nil {
+			return VacuumStats{}, notFound("type '%s' does not exist", typ)
+		}
+	}
+	g := e.graph
+	var st VacuumStats
+	for _, edgeType := range sortedKeys(g.Edges) {
+		edges, dead := g.Edges[edgeType], g.dead[edgeType]
+		if typ != "" && edgeType != typ || dead == 0 || float64(dead) < ratio*float64(len(edges)) {
+			continue
+		}
+		// a new list, as a snapshot may share the old one
+		live := make([]EdgeInstance, 0, len(edges)-dead)
+		for _, inst := range edges {
+			if !inst.Deleted() {
+				live = append(live, inst)
+			}
+		}
+		g.setEdges(edgeType, live)
+		g.edgeEpochs[edgeType] = g.epoch
+		delete(g.dead, edgeType)
+		st.Edges += dead
+	}
+	for _, nodeType := range sortedKeys(g.Nodes) {
+		set := g.Nodes[nodeType]
+		if typ != "" && nodeType != typ || set.removed == 0 || float64(set.removed) < ratio*float64(set.n+set.removed) {
+			continue
+		}
+		st.Nodes += set.removed
+		set.compact(g.epoch)
+	}
+	return st, nil
+}
+
+// compact copies the live nodes of each partition of s into a map of their
+// size, dropping the tombstones
+func (s *NodeSet) compact(epoch uint64) {
+	for i, shard := range s.shards {
+		live := 0
+		for _, props := range shard {
+			if props != nil {
+				live++
+			}
+		}
+		fresh := make(map[string]map[string]interface{}, live)
+		for id, props := range shard {
+			if props != nil {
+				fresh[id] = props
+			}
+		}
+		s.shards[i], s.epochs[i] = fresh, epoch
+	}
+	s.removed = 0
+}
+
+// executeVacuum executes a VACUUM statement
+func (e *Executor) executeVacuum(out Output, stmt *parser.VacuumStmt) error {
+	st, err := e.Vacuum(stmt.Type, 0)
+	if err != nil {
+		return err
+	}
+	if out != nil {
+		out.Message("Reclaimed %d deleted node(s) and %d deleted edge(s)", st.Nodes, st.Edges)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// tombstones counts the tombstones in the partitions of s
+func tombstones(s *NodeSet) int {
+	n := 0
+	for _, shard := range s.shards {
+		for _, props := range shard {
+			if props == nil {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func TestNodeTombstones(t *testing.T) {
+	ctx := context.Background()
+	e := newExecutor(t)
+	exec := func(script string) {
+		t.Helper()
+		if err := e.ExecuteScript(ctx, nil, script); err != nil {
+			t.Fatalf("%s: %v", script, err)
+		}
+	}
+	exec("CREATE NODE P (name: string PRIMARY KEY, n: int); INSERT NODE P (name: 'a', n: 1); INSERT NODE P (name: 'b', n: 2); INSERT NODE P (name: 'c', n: 3);")
+	view := e.Snapshot()
+	exec("DELETE NODE P WHERE name: 'a'; UPDATE NODE P SET name: 'd' WHERE name: 'b';")
+
+	set := e.Graph().Nodes["P"]
+	if got := tombstones(set); got != 2 || set.removed != 2 {
+		t.Errorf("after a delete and a move: %d tombstones, %d counted; want 2", got, set.removed)
+	}
+	if set.Len() != 2 || len(set.IDs()) != 2 {
+		t.Errorf("after deleting: %d nodes, IDs %v; want c and d", set.Len(), set.IDs())
+	}
+	if _, ok := set.Get("a"); ok {
+		t.Errorf("a deleted node is still found")
+	}
+	seen := 0
+	if err := e.Graph().ScanType(ctx, "P", func(string, map[string]interface{}) bool { seen++; return true }); err != nil || seen != 2 {
+		t.Errorf("a scan saw %d nodes, %v; want 2", seen, err)
+	}
+	if view.Graph().Nodes["P"].Len() != 3 || tombstones(view.Graph().Nodes["P"]) != 0 {
+		t.Errorf("the snapshot sees the tombstones")
+	}
+
+	// inserting the node again takes the place of its tombstone
+	exec("INSERT NODE P (name: 'a', n: 4);")
+	if got := tombstones(set); got != 1 || set.removed != 1 {
+		t.Errorf("after inserting again: %d tombstones, %d counted; want 1", got, set.removed)
+	}
+	if props, ok := set.Get("a"); !ok || fmt.Sprint(props["n"]) != "4" {
+		t.Errorf("a inserted again: %v, %v", props, ok)
+	}
+
+	st, err := e.Vacuum("P", 0)
+	if err != nil || st != (VacuumStats{Nodes: 1}) {
+		t.Errorf("vacuum: %+v, %v", st, err)
+	}
+	if tombstones(set) != 0 || set.removed != 0 || set.Len() != 3 {
+		t.Errorf("after a vacuum: %d tombstones, %d counted, %d nodes", tombstones(set), set.removed, set.Len())
+	}
+	if view.Graph().Nodes["P"].Len() != 3 {
+		t.Errorf("the vacuum changed the snapshot")
+	}
+}
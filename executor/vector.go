@@ -0,0 +1,240 @@
+package executor
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"grapho/catalog"
+	"grapho/parser"
+)
+
+/* ---------------------- Vector search ---------------------- */
+
+// A vector<float, N> field holds its value as text, a JSON array of N numbers
+// such as '[0.1, 0.2, 0.3]', like every other stored value. ORDER BY
+// SIMILARITY (cosine similarity) or DISTANCE (euclidean distance) compares the
+// query vector with that of every node the MATCH selects, by brute force. The
+// vectors come from an index kept per node type and field, holding them
+// parsed: built the first time a query needs it, kept up to date as nodes are
+// stored and deleted, and copied before its first change after a snapshot,
+// which may share it. As with bloom filters, snapshots never build an index of
+// their own; without one they parse the vectors as they go.
+
+type vectorIndex struct {
+	vecs  map[string][]float32 // by node ID
+	epoch uint64               // see NodeSet.epochs
+}
+
+// parseVector reads the text of a vector value
+func parseVector(s string) ([]float32, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '[' || s[len(s)-1] != ']' {
+		return nil, fmt.Errorf("vector must be written as [x, y, ...]")
+	}
+	s = strings.TrimSpace(s[1 : len(s)-1])
+	if s == "" {
+		return []float32{}, nil
+	}
+	parts := strings.Split(s, ",")
+	vec := make([]float32, len(parts))
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 32)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, fmt.Errorf("%q is not a number", strings.TrimSpace(p))
+		}
+		vec[i] = float32(f)
+	}
+	return vec, nil
+}
+
+// checkVectors rejects values of vector fields that are not vectors of the
+// declared length
+func checkVectors(typeName string, fields map[string]catalog.FieldSpec, props []parser.Property) error {
+	for _, p := range props {
+		spec, ok := fields[p.Name]
+		if !ok || spec.Type.Base != catalog.BaseVector || p.Value == nil || p.Value.Kind == parser.LitNull {
+			continue
+		}
+		var err error
+		if p.Value.Kind != parser.LitString {
+			err = fmt.Errorf("vector must be written as a string, e.g. '[0.1, 0.2]'")
+		} else if vec, perr := parseVector(p.Value.Text); perr != nil {
+			err = perr
+		} else if len(vec) != spec.Type.Dim {
+			err = fmt.Errorf("got %d numbers, want %d", len(vec), spec.Type.Dim)
+		}
+		if err != nil {
+			return &ConstraintError{
+				Type:       typeName,
+				Field:      p.Name,
+				Constraint: "vector",
+				msg:        fmt.Sprintf("field '%s' is a vector<float, %d>: %v", p.Name, spec.Type.Dim, err),
+			}
+		}
+	}
+	return nil
+}
+
+// vectorIndex returns the index of field, building it from the nodes if needed
+func (s *NodeSet) vectorIndex(epoch uint64, field string) *vectorIndex {
+	if idx := s.vectors[field]; idx != nil {
+		return idx
+	}
+	idx := &vectorIndex{vecs: make(map[string][]float32, s.n), epoch: epoch}
+	s.Range(func(id string, props map[string]interface{}) bool {
+		if vec, ok := storedVector(props[field]); ok {
+			idx.vecs[id] = vec
+		}
+		return true
+	})
+	if s.vectors == nil {
+		s.vectors = make(map[string]*vectorIndex)
+	}
+	s.vectors[intern(field)] = idx
+	return idx
+}
+
+// indexVectors records the vectors of a node being stored, or forgets them
+// when props is nil because the node is being deleted
+func (s *NodeSet) indexVectors(epoch uint64, id string, props map[string]interface{}) {
+	for field, idx := range s.vectors {
+		if idx.epoch != epoch {
+			// a snapshot may share it
+			idx = &vectorIndex{vecs: maps.Clone(idx.vecs), epoch: epoch}
+			s.vectors[field] = idx
+		}
+		if vec, ok := storedVector(props[field]); ok {
+			idx.vecs[id] = vec
+		} else {
+			delete(idx.vecs, id)
+		}
+	}
+}
+
+// storedVector parses a stored vector value
+func storedVector(v interface{}) ([]float32, bool) {
+	text, ok := v.(string)
+	if !ok {
+		return nil, false
+	}
+	vec, err := parseVector(text)
+	return vec, err == nil
+}
+
+// rankedHit is a node MATCH returns, with its score for ORDER BY
+type rankedHit struct {
+	nodeType string
+	scanHit
+	score float64
+}
+
+// rankByVector scores hits, the nodes of nodeType a MATCH selected, against
+// the query vector of order. Nodes without a vector of the right length are
+// dropped, since they cannot be ranked.
+func (e *Executor) rankByVector(nodeType string, order *parser.VectorOrder, hits []scanHit) ([]rankedHit, error) {
+	nt, ok := e.registry.Current().Nodes[nodeType]
+	if !ok {
+		return nil, notFound("node type '%s' does not exist", nodeType)
+	}
+	spec, ok := nt.Fields[order.Field]
+	if ok && spec.Type.Base == catalog.BasePoint && spec.Type.Elem == nil {
+		return rankByPoint(nodeType, order, hits)
+	}
+	if !ok || spec.Type.Base != catalog.BaseVector {
+		return nil, fmt.Errorf("%s.%s is not a vector field", nodeType, order.Field)
+	}
+	query, err := parseVector(order.Vector.Text)
+	if err != nil {
+		return nil, fmt.Errorf("query vector: %w", err)
+	}
+	if len(query) != spec.Type.Dim {
+		return nil, fmt.Errorf("query vector has %d numbers, but %s.%s holds %d", len(query), nodeType, order.Field, spec.Type.Dim)
+	}
+
+	var idx *vectorIndex
+	if set := e.graph.Nodes[nodeType]; set != nil && (set.vectors[order.Field] != nil || !e.readOnly) {
+		idx = set.vectorIndex(e.graph.epoch, order.Field)
+	}
+	ranked := make([]rankedHit, 0, len(hits))
+	for _, hit := range hits {
+		var vec []float32
+		if idx != nil {
+			vec = idx.vecs[hit.id]
+		} else {
+			vec, _ = storedVector(hit.props[order.Field])
+		}
+		if len(vec) != len(query) {
+			continue
+		}
+		score := euclidean(vec, query)
+		if order.Metric == parser.Cosine {
+			score = cosine(vec, query)
+		}
+		ranked = append(ranked, rankedHit{nodeType, hit, score})
+	}
+	return ranked, nil
+}
+
+// sortRanked puts the most similar, or nearest, hits first
+func sortRanked(ranked []rankedHit, metric parser.VectorMetric) {
+	slices.SortFunc(ranked, func(a, b rankedHit) int {
+		c := cmp.Compare(a.score, b.score)
+		if metric == parser.Cosine {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+		return compareIDs(a.id, b.id)
+	})
+}
+
+// cosine returns the cosine similarity of a and b, 0 if either is all zeros
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		x, y := float64(a[i]), float64(b[i])
+		dot += x * y
+		na += x * x
+		nb += y * y
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// euclidean returns the euclidean distance between a and b
+func euclidean(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		d := float64(a[i]) - float64(b[i])
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+// scoreKey names the property MATCH adds to rows ranked by metric
+func scoreKey(metric parser.VectorMetric) string {
+	if metric == parser.L2 {
+		return "_distance"
+	}
+	return "_similarity"
+}
+
+// matchLimit reads the LIMIT of stmt, -1 for none
+func matchLimit(stmt *parser.MatchStmt) (int, error) {
+	if stmt.Limit == nil {
+		return -1, nil
+	}
+	n, err := strconv.Atoi(stmt.Limit.Text)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("LIMIT must be a non-negative integer, got %s", stmt.Limit.Text)
+	}
+	return n, nil
+}
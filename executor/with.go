@@ -0,0 +1,130 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"grapho/parser"
+)
+
+/* ---------------------- WITH ---------------------- */
+
+// MATCH (c:Company) WITH c LIMIT 10 MATCH (p)-[:WORKS_AT]->(c) RETURN ...
+// runs in stages. Each stage but the last is matched on its own, and its
+// rows are cut down to the variables the WITH names, each combination of
+// nodes and edges kept once, in the order found, up to the LIMIT. The next
+// stage then runs once for every combination, with those variables already
+// bound, so that they join its paths; its other variables start out unbound.
+// Only the last stage returns rows or changes the graph.
+
+// lastStage returns the stage of stmt after its last WITH
+func lastStage(stmt *parser.MatchStmt) *parser.MatchStmt {
+	for stmt.With != nil {
+		stmt = stmt.With.Next
+	}
+	return stmt
+}
+
+// stages runs the stages of stmt before its last and returns the matcher of
+// the last, with the bindings of the carried variables each of its runs
+// starts from
+func (e *Executor) stages(ctx context.Context, stmt *parser.MatchStmt) (*pathMatcher, [][]binding, error) {
+	var carried []pathVar
+	starts := [][]binding{nil} // without a WITH, one run with nothing bound
+	for {
+		m, err := e.newPathMatcher(ctx, stmt, carried)
+		if err != nil {
+			return nil, nil, err
+		}
+		w := stmt.With
+		if w == nil {
+			return m, starts, nil
+		}
+		if len(w.Next.Paths) == 0 {
+			return nil, nil, fmt.Errorf("the MATCH after WITH needs a path pattern")
+		}
+		limit := -1
+		if w.Limit != nil {
+			if limit, err = strconv.Atoi(w.Limit.Text); err != nil || limit < 0 {
+				return nil, nil, fmt.Errorf("LIMIT must be a non-negative integer, got %s", w.Limit.Text)
+			}
+		}
+		vars, err := m.withVars(w.Vars)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var next [][]binding
+		seen := make(map[string]bool)
+		keys := make([]string, len(vars))
+		if limit != 0 {
+			err = m.runFrom(starts, func() bool {
+				for i, v := range vars {
+					keys[i] = m.bound[v].typ + ":" + m.bound[v].id
+				}
+				key := strings.Join(keys, "\x00")
+				if seen[key] {
+					return true
+				}
+				seen[key] = true
+				row := make([]binding, len(vars))
+				for i, v := range vars {
+					row[i] = m.bound[v]
+				}
+				next = append(next, row)
+				return limit < 0 || len(next) < limit
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		carried = make([]pathVar, len(vars))
+		for i, v := range vars {
+			carried[i] = m.vars[v]
+		}
+		starts, stmt = next, w.Next
+	}
+}
+
+// withVars returns the variables a WITH names
+func (m *pathMatcher) withVars(names []string) ([]int, error) {
+	vars := make([]int, len(names))
+	for i, name := range names {
+		v := m.varIndex(name)
+		if v < 0 {
+			return nil, fmt.Errorf("WITH %s: not a variable of the pattern", name)
+		}
+		for _, prev := range vars[:i] {
+			if prev == v {
+				return nil, fmt.Errorf("WITH %s: named twice", name)
+			}
+		}
+		vars[i] = v
+	}
+	return vars, nil
+}
+
+// runFrom runs m once for each of starts, the bindings of its first
+// variables, calling emit with each row until it returns false
+func (m *pathMatcher) runFrom(starts [][]binding, emit func() bool) error {
+	more := true
+	for _, start := range starts {
+		copy(m.bound, start)
+		clear(m.used)
+		for _, b := range start {
+			for _, id := range b.edges {
+				m.used[id] = true
+			}
+		}
+		err := m.run(func() bool {
+			more = emit()
+			return more
+		})
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package grapho
+
+import (
+	"cmp"
+	"context"
+	"io"
+	"slices"
+	"strings"
+
+	"grapho/catalog"
+	"grapho/executor"
+)
+
+// Edge is one edge of the graph as seen by the exporters
+type Edge struct {
+	Type       string
+	ID         string
+	From, To   string // node IDs
+	Properties map[string]any
+}
+
+// graphSnapshot is a copy of the whole graph for exporters. Nodes are ordered
+// by type and ID, edges by type and insertion order.
+type graphSnapshot struct {
+	cat   *catalog.Catalog
+	nodes []Row
+	edges []Edge
+}
+
+// view returns a read-only snapshot of the executor. Taking it is cheap, and
+// statements can run while it is read.
+func (db *DB) view(ctx context.Context) (*executor.Executor, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return db.exec.Snapshot(), nil
+}
+
+// snapshot copies the catalog and the graph out of a view
+func (db *DB) snapshot(ctx context.Context) (*graphSnapshot, error) {
+	view, err := db.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	g := view.Graph()
+	snap := &graphSnapshot{cat: view.Registry().Current()}
+	for _, nodeType := range sortedKeys(g.Nodes) {
+		start := len(snap.nodes)
+		g.Nodes[nodeType].Range(func(id string, props map[string]interface{}) bool {
+			row := newRow(nodeType, id, props)
+			delete(row.Properties, idProperty)
+			snap.nodes = append(snap.nodes, row)
+			return true
+		})
+		slices.SortFunc(snap.nodes[start:], func(a, b Row) int { return compareIDs(a.ID, b.ID) })
+	}
+	for _, edgeType := range sortedKeys(g.Edges) {
+		for _, e := range g.Edges[edgeType] {
+			if e.Deleted() {
+				continue
+			}
+			row := newRow(edgeType, e.ID, e.Properties)
+			snap.edges = append(snap.edges, Edge{Type: edgeType, ID: e.ID, From: e.FromNodeID, To: e.ToNodeID, Properties: row.Properties})
+		}
+	}
+	return snap, nil
+}
+
+// ExportJSONL writes the graph as JSON Lines, in the format EXPORT TO
+// 'file.jsonl' produces. It writes a snapshot, so statements can run
+// meanwhile and do not show up in the output.
+func (db *DB) ExportJSONL(ctx context.Context, w io.Writer) error {
+	view, err := db.view(ctx)
+	if err != nil {
+		return err
+	}
+	return view.WriteJSONL(ctx, w)
+}
+
+// ExportDOT writes a snapshot of the graph as a Graphviz digraph, in the
+// format EXPORT TO 'file.dot' produces
+func (db *DB) ExportDOT(ctx context.Context, w io.Writer) error {
+	view, err := db.view(ctx)
+	if err != nil {
+		return err
+	}
+	return view.WriteDOT(ctx, w)
+}
+
+// ExportGEXF writes a snapshot of the graph as a GEXF document, in the format
+// EXPORT TO 'file.gexf' produces
+func (db *DB) ExportGEXF(ctx context.Context, w io.Writer) error {
+	view, err := db.view(ctx)
+	if err != nil {
+		return err
+	}
+	return view.WriteGEXF(ctx, w)
+}
+
+// ExportParquet writes a snapshot of the nodes of one type as a Parquet file,
+// in the format EXPORT NODE <type> TO 'file.parquet' produces
+func (db *DB) ExportParquet(ctx context.Context, w io.Writer, nodeType string) error {
+	view, err := db.view(ctx)
+	if err != nil {
+		return err
+	}
+	return view.WriteParquet(ctx, w, nodeType)
+}
+
+// compareIDs orders IDs by text, but the digits they end in, as generated IDs
+// and edge_N do, by number
+func compareIDs(a, b string) int {
+	if c := cmp.Compare(strings.TrimRight(a, "0123456789"), strings.TrimRight(b, "0123456789")); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(len(a), len(b)); c != 0 {
+		return c
+	}
+	return cmp.Compare(a, b)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
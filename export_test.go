@@ -0,0 +1,322 @@
+package grapho
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"grapho/executor"
+	"grapho/parser"
+)
+
+func TestExportJSONL(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(ctx, t.TempDir())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	if err := db.Exec(ctx, socialSchema+`
+INSERT NODE Person (name: 'Ann <3', age: 31);
+INSERT NODE Person (name: 'Bob');
+INSERT EDGE Knows FROM Person(name: 'Ann <3') TO Person(name: 'Bob') (since: 2020);`); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "dump.jsonl")
+	if err := db.Exec(ctx, "EXPORT TO '"+path+"';"); err != nil {
+		t.Fatalf("export statement: %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"kind":"node","type":"Person","id":"1","properties":{"age":31,"name":"Ann <3"}}
+{"kind":"node","type":"Person","id":"2","properties":{"name":"Bob"}}
+{"kind":"edge","type":"Knows","id":"edge_3","from":"1","to":"2","properties":{"since":2020}}
+`
+	if string(got) != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := db.ExportJSONL(ctx, &buf); err != nil {
+		t.Fatalf("ExportJSONL: %v", err)
+	}
+	if buf.String() != want {
+		t.Fatalf("ExportJSONL differs from EXPORT:\n%s", buf.String())
+	}
+
+	if err := db.Exec(ctx, "EXPORT TO '"+filepath.Join(t.TempDir(), "dump.xml")+"';"); err == nil {
+		t.Fatal("expected an error for an unknown extension")
+	}
+}
+
+func TestExportDOT(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(ctx, t.TempDir())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	if err := db.Exec(ctx, socialSchema+`
+INSERT NODE Person (name: 'Ann "A"', age: 31);
+INSERT NODE Person (name: 'Bob', age: 40);
+INSERT NODE Person (name: 'Cid', age: 31);
+INSERT EDGE Knows FROM Person(name: 'Bob') TO Person(name: 'Cid');
+INSERT EDGE Knows FROM Person(name: 'Cid') TO Person(name: 'Ann "A"') (since: 2020);`); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+
+	// the MATCH keeps Ann and Cid, and only the edge between them
+	path := filepath.Join(t.TempDir(), "sub.dot")
+	if err := db.Exec(ctx, "EXPORT MATCH Person WHERE age: 31 TO '"+path+"';"); err != nil {
+		t.Fatalf("export statement: %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph grapho {
+  "1" [label="Person\nage: 31\nname: Ann \"A\""];
+  "3" [label="Person\nage: 31\nname: Cid"];
+  "3" -> "1" [label="Knows\nsince: 2020"];
+}
+`
+	if string(got) != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// a path MATCH keeps what its rows bind
+	if err := db.Exec(ctx, "EXPORT MATCH (b:Person {name: 'Bob'})-[:Knows]->(c) TO '"+path+"';"); err != nil {
+		t.Fatalf("export path: %v", err)
+	}
+	if got, err = os.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	want = `digraph grapho {
+  "2" [label="Person\nage: 40\nname: Bob"];
+  "3" [label="Person\nage: 31\nname: Cid"];
+  "2" -> "3" [label="Knows"];
+}
+`
+	if string(got) != want {
+		t.Fatalf("path export got:\n%s\nwant:\n%s", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := db.ExportDOT(ctx, &buf); err != nil {
+		t.Fatalf("ExportDOT: %v", err)
+	}
+	if n := strings.Count(buf.String(), " -> "); n != 2 {
+		t.Fatalf("whole graph has %d edges:\n%s", n, buf.String())
+	}
+}
+
+func TestExportGEXF(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(ctx, t.TempDir())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	if err := db.Exec(ctx, socialSchema+`
+INSERT NODE Person (name: 'Ann & co', age: 31);
+INSERT NODE Person (name: 'Bob');
+INSERT EDGE Knows FROM Person(name: 'Ann & co') TO Person(name: 'Bob') (since: 2020);`); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "graph.gexf")
+	if err := db.Exec(ctx, "EXPORT TO '"+path+"';"); err != nil {
+		t.Fatalf("export statement: %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<gexf xmlns="http://gexf.net/1.3" version="1.3">
+  <graph defaultedgetype="directed" mode="static">
+    <attributes class="node">
+      <attribute id="n_type" title="_type" type="string"/>
+      <attribute id="n0" title="age" type="long"/>
+      <attribute id="n1" title="name" type="string"/>
+    </attributes>
+    <attributes class="edge">
+      <attribute id="e_type" title="_type" type="string"/>
+      <attribute id="e0" title="since" type="long"/>
+    </attributes>
+    <nodes>
+      <node id="1" label="Person"><attvalues><attvalue for="n_type" value="Person"/><attvalue for="n0" value="31"/><attvalue for="n1" value="Ann &amp; co"/></attvalues></node>
+      <node id="2" label="Person"><attvalues><attvalue for="n_type" value="Person"/><attvalue for="n1" value="Bob"/></attvalues></node>
+    </nodes>
+    <edges>
+      <edge id="edge_3" source="1" target="2" label="Knows"><attvalues><attvalue for="e_type" value="Knows"/><attvalue for="e0" value="2020"/></attvalues></edge>
+    </edges>
+  </graph>
+</gexf>
+`
+	if string(got) != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// a created_at datetime makes the graph dynamic
+	if err := db.Exec(ctx, `
+CREATE NODE Post (title: string, created_at: datetime);
+INSERT NODE Post (title: 'hi', created_at: '2024-03-01 12:30:00');
+INSERT NODE Post (title: 'undated');`); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := db.ExportGEXF(ctx, &buf); err != nil {
+		t.Fatalf("ExportGEXF: %v", err)
+	}
+	for _, s := range []string{
+		`<graph defaultedgetype="directed" mode="dynamic" timeformat="dateTime">`,
+		`<node id="4" label="Post" start="2024-03-01T12:30:00Z">`,
+		`<node id="5" label="Post">`,
+		`<node id="1" label="Person">`,
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("missing %s in:\n%s", s, buf.String())
+		}
+	}
+}
+
+func TestExportParquet(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(ctx, t.TempDir())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	if err := db.Exec(ctx, socialSchema+`
+INSERT NODE Person (name: 'Ann', age: 31);
+INSERT NODE Person (name: 'Bob');
+INSERT EDGE Knows FROM Person(name: 'Ann') TO Person(name: 'Bob');`); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "person.parquet")
+	if err := db.Exec(ctx, "EXPORT NODE Person TO '"+path+"';"); err != nil {
+		t.Fatalf("export statement: %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(got, []byte("PAR1")) || !bytes.HasSuffix(got, []byte("PAR1")) {
+		t.Fatalf("not a Parquet file: %q", got)
+	}
+	for _, col := range []string{"_id", "age", "name", "Ann", "grapho"} {
+		if !bytes.Contains(got, []byte(col)) {
+			t.Errorf("file lacks %q", col)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := db.ExportParquet(ctx, &buf, "Person"); err != nil {
+		t.Fatalf("ExportParquet: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), got) {
+		t.Fatal("ExportParquet differs from EXPORT NODE")
+	}
+
+	// EXPORT NODE works with the other formats too, and leaves the edges out
+	jsonl := filepath.Join(dir, "person.jsonl")
+	if err := db.Exec(ctx, "EXPORT NODE Person TO '"+jsonl+"';"); err != nil {
+		t.Fatalf("export statement: %v", err)
+	}
+	if b, _ := os.ReadFile(jsonl); strings.Count(string(b), "\n") != 2 || strings.Contains(string(b), `"edge"`) {
+		t.Fatalf("got:\n%s", b)
+	}
+
+	if err := db.Exec(ctx, "EXPORT TO '"+filepath.Join(dir, "all.parquet")+"';"); err == nil {
+		t.Fatal("expected an error for a whole-graph Parquet export")
+	}
+	if err := db.Exec(ctx, "EXPORT NODE Nope TO '"+filepath.Join(dir, "nope.parquet")+"';"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown type: got %v", err)
+	}
+}
+
+func TestExportReadsSnapshot(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(ctx, t.TempDir())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	if err := db.Exec(ctx, socialSchema+`
+INSERT NODE Person (name: 'Ann', age: 31);
+INSERT NODE Person (name: 'Bob');
+INSERT EDGE Knows FROM Person(name: 'Ann') TO Person(name: 'Bob') (since: 2020);`); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	var before bytes.Buffer
+	if err := db.ExportJSONL(ctx, &before); err != nil {
+		t.Fatal(err)
+	}
+
+	// the export blocks on the pipe until the writes below are done; if it
+	// held the database lock they would never finish
+	r, w := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := db.ExportJSONL(ctx, w)
+		w.CloseWithError(err)
+		done <- err
+	}()
+	first := make([]byte, 1)
+	if _, err := io.ReadFull(r, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec(ctx, `
+UPDATE NODE Person SET age: 32 WHERE name: 'Ann';
+UPDATE EDGE Knows SET since: 2021;
+DELETE NODE Person WHERE name: 'Bob';
+INSERT NODE Person (name: 'Cid');
+INSERT EDGE Knows FROM Person(name: 'Cid') TO Person(name: 'Ann');`); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := string(first) + string(rest); got != before.String() {
+		t.Fatalf("export saw later writes:\n%s\nwant:\n%s", got, before.String())
+	}
+
+	rows, err := db.Query(ctx, "MATCH Person;")
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("after writes: %v %v", rows, err)
+	}
+
+	// writes after a snapshot copy what they change instead of editing it
+	view := db.exec.Snapshot()
+	if err := db.Exec(ctx, `
+UPDATE NODE Person SET age: 33 WHERE name: 'Ann';
+UPDATE EDGE Knows SET since: 2022;
+DELETE NODE Person WHERE name: 'Cid';`); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	people := view.Graph().Nodes["Person"]
+	if ann, _ := people.Get("1"); people.Len() != 2 || ann["age"] != "32" {
+		t.Errorf("snapshot changed: %d people, Ann %v", people.Len(), ann)
+	}
+	if knows := view.Graph().Edges["Knows"]; len(knows) != 2 || knows[0].Properties["since"] != "2021" {
+		t.Errorf("snapshot edges changed: %v", knows)
+	}
+	if err := view.Execute(ctx, nil, &parser.DeleteNodeStmt{NodeType: "Person"}); !errors.Is(err, executor.ErrReadOnly) {
+		t.Errorf("write to snapshot: got %v", err)
+	}
+}
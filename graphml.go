@@ -0,0 +1,356 @@
+package grapho
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"grapho/catalog"
+	"grapho/executor"
+	"grapho/parser"
+)
+
+// GraphML documents carry the node or edge type in a `_type` data key; the
+// `labels` key written by Neo4j (":Person") is accepted on import as well.
+// Properties become typed keys, one per property name for nodes and one for
+// edges. Node IDs are kept on export; on import new IDs are assigned and edges
+// are reconnected through the IDs in the document.
+
+const graphmlNS = "http://graphml.graphdrawing.org/xmlns"
+
+const typeProperty = "_type"
+
+// ExportGraphML writes the whole graph to w as a GraphML document
+func (db *DB) ExportGraphML(ctx context.Context, w io.Writer) error {
+	snap, err := db.snapshot(ctx)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<graphml xmlns=%q>\n", graphmlNS)
+	fmt.Fprintf(bw, "  <key id=\"type\" for=\"all\" attr.name=%q attr.type=\"string\"/>\n", typeProperty)
+	nodeKeys := graphmlKeys(bw, "node", "n", nodeFieldTypes(snap.cat))
+	edgeKeys := graphmlKeys(bw, "edge", "e", edgePropTypes(snap.cat))
+	bw.WriteString("  <graph id=\"G\" edgedefault=\"directed\">\n")
+	for _, n := range snap.nodes {
+		fmt.Fprintf(bw, "    <node id=\"%s\">", xmlEscape(n.ID))
+		writeGraphMLData(bw, n.Type, n.Properties, nodeKeys)
+		bw.WriteString("</node>\n")
+	}
+	for _, e := range snap.edges {
+		fmt.Fprintf(bw, "    <edge id=\"%s\" source=\"%s\" target=\"%s\">", xmlEscape(e.ID), xmlEscape(e.From), xmlEscape(e.To))
+		writeGraphMLData(bw, e.Type, e.Properties, edgeKeys)
+		bw.WriteString("</edge>\n")
+	}
+	bw.WriteString("  </graph>\n</graphml>\n")
+	return bw.Flush()
+}
+
+// graphmlKeys declares one key per property name and returns the key IDs by name
+func graphmlKeys(w io.Writer, domain, prefix string, types map[string]catalog.TypeSpec) map[string]string {
+	ids := make(map[string]string, len(types))
+	for i, name := range sortedKeys(types) {
+		id := fmt.Sprintf("%s%d", prefix, i)
+		ids[name] = id
+		fmt.Fprintf(w, "  <key id=%q for=%q attr.name=\"%s\" attr.type=%q/>\n", id, domain, xmlEscape(name), graphmlType(types[name]))
+	}
+	return ids
+}
+
+func writeGraphMLData(w io.Writer, typ string, props map[string]any, keys map[string]string) {
+	fmt.Fprintf(w, "<data key=\"type\">%s</data>", xmlEscape(typ))
+	for _, name := range sortedKeys(props) {
+		id, ok := keys[name]
+		if !ok || props[name] == nil {
+			continue
+		}
+		fmt.Fprintf(w, "<data key=%q>%s</data>", id, xmlEscape(fmt.Sprint(props[name])))
+	}
+}
+
+// nodeFieldTypes collects the fields of every node type by name. A name used
+// with different types in different node types is exported as a string.
+func nodeFieldTypes(cat *catalog.Catalog) map[string]catalog.TypeSpec {
+	types := make(map[string]catalog.TypeSpec)
+	for _, nt := range cat.Nodes {
+		mergeFieldTypes(types, nt.Fields)
+	}
+	return types
+}
+
+func edgePropTypes(cat *catalog.Catalog) map[string]catalog.TypeSpec {
+	types := make(map[string]catalog.TypeSpec)
+	for _, et := range cat.Edges {
+		mergeFieldTypes(types, et.Props)
+	}
+	return types
+}
+
+func mergeFieldTypes(types map[string]catalog.TypeSpec, fields map[string]catalog.FieldSpec) {
+	for name, f := range fields {
+		if prev, ok := types[name]; ok && graphmlType(prev) != graphmlType(f.Type) {
+			f.Type = catalog.TypeSpec{Base: catalog.BaseString}
+		}
+		types[name] = f.Type
+	}
+}
+
+// graphmlType maps a field type to a GraphML attr.type
+func graphmlType(t catalog.TypeSpec) string {
+	if t.Elem != nil || len(t.EnumVals) > 0 {
+		return "string"
+	}
+	switch t.Base {
+	case catalog.BaseInt:
+		return "long"
+	case catalog.BaseFloat:
+		return "double"
+	case catalog.BaseBool:
+		return "boolean"
+	default:
+		return "string"
+	}
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+type graphmlKey struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:"attr.name,attr"`
+}
+
+type graphmlData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphmlElem struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphmlData `xml:"data"`
+	line   int
+}
+
+// importedNode records where a node of the document ended up
+type importedNode struct {
+	nodeType string
+	id       string
+}
+
+// ImportGraphML inserts the nodes and edges of a GraphML document. The node and
+// edge types must already exist; data keys that are not fields of the type, such
+// as layout attributes added by visualization tools, are ignored. Elements that
+// cannot be imported are skipped and reported in the result like ImportCSV.
+func (db *DB) ImportGraphML(ctx context.Context, r io.Reader) (ImportResult, error) {
+	var (
+		res   ImportResult
+		keys  = make(map[string]string) // key ID -> attribute name
+		nodes = make(map[string]importedNode)
+		seen  = make(map[string]bool)
+		edges []graphmlElem
+		batch []bulkStmt
+		ids   []*insertedID
+		origs []string
+	)
+	flush := func() error {
+		err := db.flushBulk(ctx, &res, batch)
+		for i, b := range batch {
+			if ids[i].id != "" {
+				nodes[origs[i]] = importedNode{nodeType: b.stmt.(*parser.InsertNodeStmt).NodeType, id: ids[i].id}
+			}
+		}
+		batch, ids, origs = batch[:0], ids[:0], origs[:0]
+		return err
+	}
+
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return res, fmt.Errorf("grapho: import: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		line, _ := dec.InputPos()
+		switch start.Name.Local {
+		case "key":
+			var k graphmlKey
+			if err := dec.DecodeElement(&k, &start); err != nil {
+				return res, fmt.Errorf("grapho: import: %w", err)
+			}
+			keys[k.ID] = k.Name
+		case "node", "edge":
+			el := graphmlElem{line: line}
+			if err := dec.DecodeElement(&el, &start); err != nil {
+				return res, fmt.Errorf("grapho: import: %w", err)
+			}
+			if start.Name.Local == "edge" {
+				edges = append(edges, el)
+				continue
+			}
+			stmt, err := db.graphmlNode(keys, el)
+			if err != nil {
+				res.Errors = append(res.Errors, LineError{Line: line, Err: err})
+				continue
+			}
+			if seen[el.ID] {
+				res.Errors = append(res.Errors, LineError{Line: line, Err: fmt.Errorf("duplicate node id '%s'", el.ID)})
+				continue
+			}
+			seen[el.ID] = true
+			out := &insertedID{}
+			batch = append(batch, bulkStmt{line: line, stmt: stmt, out: out})
+			ids = append(ids, out)
+			origs = append(origs, el.ID)
+			if len(batch) == bulkBatchSize {
+				if err := flush(); err != nil {
+					return res, err
+				}
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return res, err
+	}
+
+	// edges may appear before their endpoints, so they go in once all nodes are in
+	for _, el := range edges {
+		stmt, err := db.graphmlEdge(keys, nodes, el)
+		if err != nil {
+			res.Errors = append(res.Errors, LineError{Line: el.line, Err: err})
+			continue
+		}
+		batch = append(batch, bulkStmt{line: el.line, stmt: stmt})
+		if len(batch) == bulkBatchSize {
+			if err := db.flushBulk(ctx, &res, batch); err != nil {
+				return res, err
+			}
+			batch = batch[:0]
+		}
+	}
+	return res, db.flushBulk(ctx, &res, batch)
+}
+
+// graphmlProps returns the type named by an element's data and its other data
+// by attribute name
+func graphmlProps(keys map[string]string, el graphmlElem) (string, map[string]string) {
+	typ := ""
+	props := make(map[string]string, len(el.Data))
+	for _, d := range el.Data {
+		name := keys[d.Key]
+		if name == "" {
+			name = d.Key
+		}
+		switch name {
+		case typeProperty:
+			typ = strings.TrimSpace(d.Value)
+		case "labels":
+			if typ == "" {
+				typ = strings.TrimPrefix(strings.TrimSpace(d.Value), ":")
+			}
+		default:
+			props[name] = d.Value
+		}
+	}
+	return typ, props
+}
+
+func (db *DB) graphmlNode(keys map[string]string, el graphmlElem) (parser.Stmt, error) {
+	typ, data := graphmlProps(keys, el)
+	if typ == "" {
+		return nil, fmt.Errorf("node '%s' has no %s", el.ID, typeProperty)
+	}
+	nt, ok := db.exec.Registry().Current().Nodes[typ]
+	if !ok {
+		return nil, errNodeType(typ)
+	}
+	props, err := typedProps(nt.Fields, data)
+	if err != nil {
+		return nil, err
+	}
+	if props, err = withDefaults(nt.Fields, props); err != nil {
+		return nil, err
+	}
+	if len(props) == 0 {
+		return nil, fmt.Errorf("node '%s' has no properties", el.ID)
+	}
+	return parser.InsertNode(typ, props...), nil
+}
+
+func (db *DB) graphmlEdge(keys map[string]string, nodes map[string]importedNode, el graphmlElem) (parser.Stmt, error) {
+	typ, data := graphmlProps(keys, el)
+	if typ == "" {
+		return nil, fmt.Errorf("edge '%s' has no %s", el.ID, typeProperty)
+	}
+	et, ok := db.exec.Registry().Current().Edges[typ]
+	if !ok {
+		return nil, fmt.Errorf("edge type '%s' does not exist: %w", typ, ErrNotFound)
+	}
+	from, ok := nodes[el.Source]
+	if !ok {
+		return nil, fmt.Errorf("source node '%s' was not imported", el.Source)
+	}
+	to, ok := nodes[el.Target]
+	if !ok {
+		return nil, fmt.Errorf("target node '%s' was not imported", el.Target)
+	}
+	props, err := typedProps(et.Props, data)
+	if err != nil {
+		return nil, err
+	}
+	if props, err = withDefaults(et.Props, props); err != nil {
+		return nil, err
+	}
+	return parser.InsertEdge(typ,
+		parser.NodeByID(from.nodeType, parser.Str(from.id)),
+		parser.NodeByID(to.nodeType, parser.Str(to.id)),
+		props...), nil
+}
+
+// typedProps converts the values of known fields to literals of their types
+func typedProps(fields map[string]catalog.FieldSpec, data map[string]string) ([]parser.Property, error) {
+	var props []parser.Property
+	for _, name := range sortedKeys(data) {
+		spec, ok := fields[name]
+		if !ok {
+			continue
+		}
+		lit, err := coerceLiteral(spec.Type, strings.TrimSpace(data[name]))
+		if err != nil {
+			return nil, fmt.Errorf("property '%s': %w", name, err)
+		}
+		props = append(props, parser.Prop(name, lit))
+	}
+	return props, nil
+}
+
+// insertedID captures the ID an INSERT reports
+type insertedID struct {
+	id string
+}
+
+func (o *insertedID) Message(format string, args ...any) {}
+
+func (o *insertedID) Changed(c executor.Change, msg string) {
+	if len(c.IDs) == 1 {
+		o.id = c.IDs[0]
+	}
+}
+
+func (o *insertedID) ResultSet() {}
+
+func (o *insertedID) Row(nodeType, id string, props map[string]interface{}) {}
@@ -0,0 +1,94 @@
+package grapho
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+const socialSchema = `
+CREATE NODE Person (name: string, age: int);
+CREATE EDGE Knows (FROM Person MANY, TO Person MANY, PROPS (since: int));`
+
+func TestGraphMLRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src, err := Open(ctx, t.TempDir())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer src.Close()
+	if err := src.Exec(ctx, socialSchema+`
+INSERT NODE Person (name: 'Ann & Co', age: 31);
+INSERT NODE Person (name: 'Bob', age: 40);
+INSERT EDGE Knows FROM Person(name: 'Ann & Co') TO Person(name: 'Bob') (since: 2020);`); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := src.ExportGraphML(ctx, &buf); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	doc := buf.String()
+	for _, want := range []string{
+		`<key id="n0" for="node" attr.name="age" attr.type="long"/>`,
+		`<node id="1"><data key="type">Person</data><data key="n0">31</data><data key="n1">Ann &amp; Co</data></node>`,
+		`source="1" target="2"><data key="type">Knows</data><data key="e0">2020</data></edge>`,
+	} {
+		if !strings.Contains(doc, want) {
+			t.Fatalf("export lacks %s:\n%s", want, doc)
+		}
+	}
+
+	dst, err := Open(ctx, t.TempDir())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer dst.Close()
+	if err := dst.Exec(ctx, socialSchema+" INSERT NODE Person (name: 'Zed');"); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	res, err := dst.ImportGraphML(ctx, strings.NewReader(doc))
+	if err != nil || len(res.Errors) != 0 || res.Inserted != 3 {
+		t.Fatalf("import: %+v %v", res, err)
+	}
+
+	var again bytes.Buffer
+	if err := dst.ExportGraphML(ctx, &again); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	// the new nodes get fresh IDs, so the edge now joins nodes 2 and 3
+	if !strings.Contains(again.String(), `<edge id="edge_4" source="2" target="3"><data key="type">Knows</data><data key="e0">2020</data></edge>`) {
+		t.Fatalf("edge not reconnected:\n%s", again.String())
+	}
+}
+
+func TestImportGraphMLErrors(t *testing.T) {
+	db, ctx := openPeople(t)
+	doc := `<?xml version="1.0"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="l" for="node" attr.name="labels"/>
+  <key id="a" for="node" attr.name="age"/>
+  <key id="x" for="node" attr.name="x"/>
+  <graph edgedefault="directed">
+    <edge source="n1" target="n9"><data key="l">:Knows</data></edge>
+    <node id="n1"><data key="l">:Person</data><data key="a">50</data><data key="x">1.5</data></node>
+    <node id="n2"><data key="l">:Person</data><data key="a">old</data></node>
+    <node id="n3"><data key="a">1</data></node>
+  </graph>
+</graphml>`
+	res, err := db.ImportGraphML(ctx, strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if res.Inserted != 1 {
+		t.Errorf("inserted %d, want 1", res.Inserted)
+	}
+	var lines []int
+	for _, e := range res.Errors {
+		lines = append(lines, e.Line)
+	}
+	if want := []int{9, 10, 7}; !equalInts(lines, want) {
+		t.Fatalf("error lines %v, want %v: %v", lines, want, res.Errors)
+	}
+}
@@ -0,0 +1,569 @@
+// Package grapho embeds the database in-process: it wires the catalog registry,
+// the commit log and the executor together without the TCP server.
+//
+//	db, err := grapho.Open(ctx, "./data")
+//	if err != nil { ... }
+//	defer db.Close()
+//	err = db.Exec(ctx, "CREATE NODE Person (name: string, age: int);")
+//	rows, err := db.Query(ctx, "MATCH Person WHERE name: 'Ann';")
+//
+// Query collects every row; Iter and QueryRows stream them instead.
+package grapho
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"grapho/catalog"
+	"grapho/executor"
+	"grapho/parser"
+	"grapho/storage"
+)
+
+// Errors callers can test for with errors.Is. Parse failures wrap
+// parser.ParseErrors and constraint violations *executor.ConstraintError; use
+// errors.As for those.
+var (
+	ErrClosed        = errors.New("grapho: database is closed")
+	ErrNotFound      = catalog.ErrNotFound
+	ErrAlreadyExists = catalog.ErrAlreadyExists
+	ErrQuotaExceeded = storage.ErrQuotaExceeded
+)
+
+// Options configures an embedded database
+type Options struct {
+	// LogFormat selects the commit log encoding. It must match the format the
+	// data directory was written with. The text format stores one command per
+	// line, so Exec and Query then reject scripts that contain line breaks.
+	LogFormat storage.LogFormat
+
+	// Hooks observe every statement run through the DB, in order
+	Hooks []executor.Hook
+
+	// Partitions is the number of partitions each node type is split into by
+	// a hash of its primary key; 0 means executor.DefaultPartitions
+	Partitions int
+
+	// Mmap replays the commit log from a memory mapping; see
+	// storage.CommitLog.UseMmap
+	Mmap bool
+
+	// Flush says when the commit log is synced to disk; the zero value means
+	// storage.DefaultFlushPolicy. With Flush.Sync set, Exec returns only once
+	// its statements are durable.
+	Flush storage.FlushPolicy
+
+	// Lenient stores properties the catalog does not declare for their type,
+	// which are otherwise rejected; see executor.Executor.SetLenient
+	Lenient bool
+
+	// TimeLayouts are Go time layouts that date, time and datetime values may
+	// also be written in. The commit log replays only with the layouts it was
+	// written with; see executor.Executor.SetTimeLayouts.
+	TimeLayouts []string
+
+	// MaxBlobSize is the most bytes a blob value may hold, or 0 for
+	// executor.DefaultMaxBlobSize; see executor.Executor.SetMaxBlobSize
+	MaxBlobSize int
+
+	// GraphStore keeps the nodes and edges in place of the data file in the
+	// data directory. The database closes it. Snapshot needs the data file.
+	GraphStore executor.GraphStore
+
+	// Segments makes Snapshot put the nodes of each type in a data segment,
+	// which opening the database maps into memory rather than reads onto the
+	// heap; see executor.DataFile.SetSegments. It needs the data file.
+	Segments bool
+
+	// CacheSize is the most bytes of segment nodes kept decoded in memory, 0
+	// for executor.DefaultCacheSize or negative for none; see
+	// executor.Executor.SetCacheSize
+	CacheSize int
+
+	// OnCorrupt, if set, is called with each record or node of the data file
+	// and its segments that fails its checksum, which is then skipped; by
+	// default Open fails with executor.ErrCorrupt. See
+	// executor.DataFile.SetOnCorrupt.
+	OnCorrupt func(error)
+
+	// IncrementalBackups makes Snapshot keep the commit log since the last
+	// backup, so that IncrementalBackup can follow it; see
+	// storage.CommitLog.KeepForBackups
+	IncrementalBackups bool
+
+	// Quota bounds the size of the data directory if Quota.MaxBytes is set:
+	// near it, scripts that would write more than deletions fail with
+	// ErrQuotaExceeded; see storage.Quota
+	Quota storage.QuotaConfig
+}
+
+// DB is an embedded grapho database. It is safe for concurrent use; statements
+// are executed one at a time.
+type DB struct {
+	mu        sync.Mutex
+	snapMu    sync.Mutex // one Snapshot at a time
+	exec      *executor.Executor
+	commitLog *storage.CommitLog
+	store     executor.GraphStore
+	format    storage.LogFormat
+	quota     *storage.Quota // nil without Options.Quota
+	dir       string
+	closed    bool
+}
+
+// Row is a single result row returned by Query
+type Row struct {
+	Type       string
+	ID         string
+	Properties map[string]any
+}
+
+// Open opens (or creates) the database stored in dir. The commit log uses the
+// binary format, the same default as grapho-server, so a server data directory
+// can be opened directly. The nodes and edges are loaded from the data file,
+// and the commit log entries it does not hold yet are replayed on top; see
+// executor.DataFile. ctx bounds loading the catalog and replaying the log.
+func Open(ctx context.Context, dir string) (*DB, error) {
+	return OpenWithOptions(ctx, dir, Options{LogFormat: storage.LogFormatBinary})
+}
+
+// OpenWithOptions opens (or creates) the database stored in dir using opts
+func OpenWithOptions(ctx context.Context, dir string, opts Options) (*DB, error) {
+	store, err := catalog.NewFileStore(dir)
+	if err != nil {
+		return nil, fmt.Errorf("grapho: open catalog store: %w", err)
+	}
+	registry, err := catalog.Open(ctx, store)
+	if err != nil {
+		return nil, fmt.Errorf("grapho: open catalog: %w", err)
+	}
+	cl, err := storage.OpenCommitLogWithFormat(dir, opts.LogFormat)
+	if err != nil {
+		return nil, fmt.Errorf("grapho: %w", err)
+	}
+
+	cl.UseMmap(opts.Mmap)
+	cl.SetFlushPolicy(opts.Flush)
+	cl.KeepForBackups(opts.IncrementalBackups)
+
+	exec := executor.New(registry)
+	exec.SetTimeLayouts(opts.TimeLayouts)
+	exec.SetMaxBlobSize(opts.MaxBlobSize)
+	if opts.CacheSize != 0 {
+		if err := exec.SetCacheSize(max(opts.CacheSize, 0)); err != nil {
+			return nil, fmt.Errorf("grapho: %w", err)
+		}
+	}
+	if opts.Partitions != 0 {
+		if err := exec.SetPartitions(opts.Partitions); err != nil {
+			return nil, fmt.Errorf("grapho: %w", err)
+		}
+	}
+	gs := opts.GraphStore
+	if gs == nil {
+		df, err := executor.OpenDataFile(dir)
+		if err != nil {
+			return nil, fmt.Errorf("grapho: %w", err)
+		}
+		df.SetSegments(opts.Segments)
+		df.SetOnCorrupt(opts.OnCorrupt)
+		gs = df
+	} else if opts.Segments || opts.OnCorrupt != nil {
+		return nil, errors.New("grapho: segments and OnCorrupt need the data file, not a GraphStore")
+	}
+	if err := exec.LoadData(ctx, gs); err != nil {
+		return nil, fmt.Errorf("grapho: load graph store: %w", err)
+	}
+	if gs.Entries() < cl.Dropped() {
+		return nil, fmt.Errorf("grapho: commit log was cut after entry %d, but the graph store holds only %d", cl.Dropped(), gs.Entries())
+	}
+	if err := cl.Replay(ctx, func(line string) error {
+		if cl.Entries() <= gs.Entries() {
+			return nil // the graph store holds its changes
+		}
+		return exec.Replay(ctx, line)
+	}); err != nil {
+		return nil, fmt.Errorf("grapho: replay commit log: %w", err)
+	}
+	if err := exec.CommitData(cl.Entries()); err != nil {
+		return nil, fmt.Errorf("grapho: write graph store: %w", err)
+	}
+	st, err := storage.LoadStats(filepath.Join(dir, storage.StatsFile))
+	if err != nil {
+		return nil, fmt.Errorf("grapho: %w", err)
+	}
+	if st != nil {
+		exec.SetStats(st)
+	}
+	var quota *storage.Quota
+	if opts.Quota.MaxBytes != 0 {
+		if quota, err = storage.NewQuota(dir, opts.Quota); err != nil {
+			return nil, fmt.Errorf("grapho: %w", err)
+		}
+	}
+	cl.Start()
+	exec.SetLenient(opts.Lenient)
+	for _, h := range opts.Hooks {
+		exec.AddHook(h)
+	}
+
+	return &DB{exec: exec, commitLog: cl, store: gs, format: opts.LogFormat, quota: quota, dir: dir}, nil
+}
+
+// Close flushes the commit log and the graph store and releases the database
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+	err := db.commitLog.Stop()
+	if cerr := db.store.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Snapshot rewrites the data file as one record of each node and edge, then
+// cuts the commit log entries it holds from the log, so that neither grows
+// without bound; see executor.Executor.SnapshotData. Statements may run while
+// it writes. Once the log has been cut, the database no longer opens without
+// its data file.
+func (db *DB) Snapshot() error {
+	db.snapMu.Lock()
+	defer db.snapMu.Unlock()
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return ErrClosed
+	}
+	snap, err := db.exec.SnapshotData()
+	db.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("grapho: snapshot: %w", err)
+	}
+	defer snap.Abort()
+	if err := snap.Write(); err != nil {
+		return fmt.Errorf("grapho: snapshot: %w", err)
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	if err := snap.Install(); err != nil {
+		return fmt.Errorf("grapho: snapshot: %w", err)
+	}
+	if err := db.commitLog.Truncate(snap.Entries(), math.MaxInt64); err != nil {
+		return fmt.Errorf("grapho: snapshot: %w", err)
+	}
+	return nil
+}
+
+// CollectStats gathers the statistics the planner works from, reading the
+// values of up to sample nodes of each type, or executor.DefaultStatsSample
+// if sample is 0; see executor.Executor.CollectStats. The planner uses them
+// from then on, SHOW STATS reports them, and they are saved in the data
+// directory, where Open finds them again. They are collected from a
+// snapshot, so statements may run meanwhile.
+func (db *DB) CollectStats(ctx context.Context, sample int) (*executor.Statistics, error) {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return nil, ErrClosed
+	}
+	view := db.exec.Snapshot()
+	db.mu.Unlock()
+	st, err := view.CollectStats(ctx, sample)
+	if err != nil {
+		return nil, fmt.Errorf("grapho: collect statistics: %w", err)
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	db.exec.SetStats(st)
+	if err := storage.SaveStats(filepath.Join(db.dir, storage.StatsFile), st); err != nil {
+		return nil, fmt.Errorf("grapho: save statistics: %w", err)
+	}
+	return st, nil
+}
+
+// Backup writes a backup archive of the database to path, gzipped if it
+// ends in .tar.gz or .tgz: a catalog snapshot and data file of the graph,
+// the commit log entries written while they were copied, and a manifest; see
+// storage.WriteBackup. Statements may run while it writes. BACKUP TO 'path',
+// alone in its script, does the same.
+func (db *DB) Backup(ctx context.Context, path string) (*storage.BackupManifest, error) {
+	db.snapMu.Lock()
+	defer db.snapMu.Unlock()
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return nil, ErrClosed
+	}
+	view, entries := db.exec.Snapshot(), db.commitLog.Entries()
+	db.mu.Unlock()
+	m, err := storage.WriteBackup(ctx, path, view, entries, db.commitLog)
+	if err != nil {
+		return nil, fmt.Errorf("grapho: backup: %w", err)
+	}
+	return m, nil
+}
+
+// IncrementalBackup writes a backup archive to path of the commit log
+// entries after the first since, typically the LogEntries of the last
+// backup; see storage.WriteIncrementalBackup. Snapshots cut the entries it
+// needs unless Options.IncrementalBackups is set. BACKUP TO 'path' SINCE
+// since does the same.
+func (db *DB) IncrementalBackup(ctx context.Context, path string, since int) (*storage.BackupManifest, error) {
+	db.snapMu.Lock()
+	defer db.snapMu.Unlock()
+	db.mu.Lock()
+	closed := db.closed
+	db.mu.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+	m, err := storage.WriteIncrementalBackup(ctx, path, since, db.commitLog)
+	if err != nil {
+		return nil, fmt.Errorf("grapho: backup: %w", err)
+	}
+	return m, nil
+}
+
+// Exec runs one or more statements, discarding any result rows. A failing
+// statement stops the script; those before it stay applied, and logged.
+func (db *DB) Exec(ctx context.Context, script string) error {
+	return db.run(ctx, script, nil)
+}
+
+// Query runs one or more statements and returns the rows they produce
+func (db *DB) Query(ctx context.Context, script string) ([]Row, error) {
+	rc := &rowCollector{}
+	if err := db.run(ctx, script, rc); err != nil {
+		return nil, err
+	}
+	return rc.rows, nil
+}
+
+// run parses and executes script, appending it to the commit log if it mutated state
+func (db *DB) run(ctx context.Context, script string, out executor.Output) error {
+	stmts, release, err := db.parse(script)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return db.execute(ctx, script, stmts, out)
+}
+
+// parse parses script, rejecting scripts the commit log could not store.
+// release must be called once the statements have run; see
+// executor.Executor.Prepare.
+func (db *DB) parse(script string) (stmts []parser.Stmt, release func(), err error) {
+	if db.format == storage.LogFormatText && strings.ContainsAny(script, "\r\n") {
+		return nil, nil, fmt.Errorf("grapho: multi-line scripts need the binary commit log format")
+	}
+	stmts, release, err = db.exec.Prepare(script)
+	if err != nil {
+		return nil, nil, fmt.Errorf("grapho: %w", err)
+	}
+	return stmts, release, nil
+}
+
+// execute runs the parsed statements of script under the database lock,
+// then waits for the commit log to sync it, if it does, without the lock, so
+// that scripts arriving meanwhile share the sync
+func (db *DB) execute(ctx context.Context, script string, stmts []parser.Stmt, out executor.Output) error {
+	if b, ok := storage.LoneBackup(stmts); ok {
+		since, err := storage.BackupSince(b)
+		if err != nil {
+			return fmt.Errorf("grapho: %w", err)
+		}
+		if since < 0 {
+			_, err = db.Backup(ctx, b.Path)
+		} else {
+			_, err = db.IncrementalBackup(ctx, b.Path, since)
+		}
+		return err
+	}
+	db.mu.Lock()
+	wait, err := db.executeLocked(ctx, script, stmts, out)
+	db.mu.Unlock()
+	if wait == nil {
+		return err
+	}
+	// the statements before a failing one are logged, and synced, all the same
+	if err := wait(); err != nil {
+		return fmt.Errorf("grapho: sync commit log: %w", err)
+	}
+	return err
+}
+
+// executeLocked runs stmts and appends script to the commit log if they
+// mutated state, returning the wait for its sync; db.mu must be held. When a
+// statement fails, those that ran before it stay applied, so they are logged
+// on their own, and the wait is returned with the error.
+func (db *DB) executeLocked(ctx context.Context, script string, stmts []parser.Stmt, out executor.Output) (wait func() error, err error) {
+	if db.closed {
+		return nil, ErrClosed
+	}
+	if db.quota != nil {
+		if err := db.quota.Check(stmts); err != nil {
+			return nil, fmt.Errorf("grapho: %w", err)
+		}
+	}
+
+	mutated, ran, failed := false, stmts, error(nil)
+	for i, st := range stmts {
+		if err := ctx.Err(); err != nil {
+			ran, failed = stmts[:i], err
+			break
+		}
+		if err := db.exec.Execute(ctx, out, st); err != nil {
+			ran, failed = stmts[:i], fmt.Errorf("grapho: statement %d: %w", i+1, err)
+			break
+		}
+		if executor.Mutates(st) {
+			mutated = true
+		}
+	}
+	if !mutated {
+		return func() error { return nil }, failed
+	}
+
+	// LogText and LogPrefix both forget the keys, so only one may run
+	var logged string
+	if len(ran) < len(stmts) {
+		logged, err = db.exec.LogPrefix(ran)
+	} else {
+		logged, err = db.exec.LogText(script, stmts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("grapho: %w", err)
+	}
+	toAppend := strings.TrimSpace(logged)
+	if !strings.HasSuffix(toAppend, ";") {
+		toAppend += ";"
+	}
+	if wait, err = db.commitLog.Enqueue(context.WithoutCancel(ctx), toAppend); err != nil {
+		return nil, fmt.Errorf("grapho: append commit log: %w", err)
+	}
+	if db.quota != nil {
+		db.quota.Grew(len(toAppend))
+	}
+	if err := db.exec.CommitData(db.commitLog.Entries()); err != nil {
+		return nil, fmt.Errorf("grapho: write graph store: %w", err)
+	}
+	return wait, failed
+}
+
+// rowCollector gathers result rows for Query
+type rowCollector struct {
+	rows []Row
+}
+
+func (rc *rowCollector) Message(format string, args ...any) {}
+
+func (rc *rowCollector) ResultSet() {}
+
+func (rc *rowCollector) Row(nodeType, id string, props map[string]interface{}) {
+	rc.rows = append(rc.rows, newRow(nodeType, id, props))
+}
+
+// newRow copies props so rows stay valid after later statements modify the graph
+func newRow(nodeType, id string, props map[string]interface{}) Row {
+	cp := make(map[string]any, len(props))
+	for k, v := range props {
+		cp[k] = v
+	}
+	return Row{Type: nodeType, ID: id, Properties: cp}
+}
+
+// bulkBatchSize is the default number of statements per bulk-load batch
+const bulkBatchSize = 500
+
+// bulkStmt is one statement of a bulk load, tagged with its input line. out,
+// if set, receives the statement's output.
+type bulkStmt struct {
+	line int
+	stmt parser.Stmt
+	out  executor.Output
+}
+
+// bulkExec is the bulk-load path: it runs batch under a single lock and writes
+// the statements that succeeded to the commit log as one entry. Statements that
+// fail are reported per line and left out of the log.
+func (db *DB) bulkExec(ctx context.Context, batch []bulkStmt) (int, []LineError, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return 0, nil, ErrClosed
+	}
+	if db.quota != nil {
+		stmts := make([]parser.Stmt, len(batch))
+		for i, b := range batch {
+			stmts[i] = b.stmt
+		}
+		if err := db.quota.Check(stmts); err != nil {
+			return 0, nil, fmt.Errorf("grapho: %w", err)
+		}
+	}
+	var (
+		lineErrs []LineError
+		done     []string
+	)
+	for _, b := range batch {
+		if err := ctx.Err(); err != nil {
+			return len(done), lineErrs, db.appendBulk(ctx, done, err)
+		}
+		text, err := parser.Format(b.stmt)
+		if err == nil {
+			err = db.exec.Execute(ctx, b.out, b.stmt)
+		}
+		if err == nil {
+			text, err = db.exec.LogText(text, []parser.Stmt{b.stmt})
+		}
+		if err != nil {
+			lineErrs = append(lineErrs, LineError{Line: b.line, Err: err})
+			continue
+		}
+		done = append(done, text)
+	}
+	return len(done), lineErrs, db.appendBulk(ctx, done, nil)
+}
+
+// flushBulk runs batch through bulkExec and adds the outcome to res
+func (db *DB) flushBulk(ctx context.Context, res *ImportResult, batch []bulkStmt) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	inserted, errs, err := db.bulkExec(ctx, batch)
+	res.Inserted += inserted
+	res.Errors = append(res.Errors, errs...)
+	return err
+}
+
+// appendBulk logs the statements a bulk batch applied, then returns cause
+func (db *DB) appendBulk(ctx context.Context, texts []string, cause error) error {
+	if len(texts) > 0 {
+		entry := strings.Join(texts, " ")
+		if err := db.commitLog.Append(context.WithoutCancel(ctx), entry); err != nil {
+			return fmt.Errorf("grapho: append commit log: %w", err)
+		}
+		if db.quota != nil {
+			db.quota.Grew(len(entry))
+		}
+		if err := db.exec.CommitData(db.commitLog.Entries()); err != nil {
+			return fmt.Errorf("grapho: write graph store: %w", err)
+		}
+	}
+	return cause
+}
@@ -0,0 +1,210 @@
+package gremlin
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// typed is a GraphSON 3.0 value with an explicit type
+type typed struct {
+	Type  string `json:"@type"`
+	Value any    `json:"@value"`
+}
+
+// ToGraphSON converts a traversal result to GraphSON 3.0, ready for encoding
+// as JSON
+func ToGraphSON(v any) any {
+	switch v := v.(type) {
+	case int64:
+		return typed{"g:Int64", v}
+	case float64:
+		return typed{"g:Double", v}
+	case []any:
+		l := make([]any, len(v))
+		for i, e := range v {
+			l[i] = ToGraphSON(e)
+		}
+		return typed{"g:List", l}
+	case map[string]any:
+		// g:Map is a flat list of alternating keys and values
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		l := make([]any, 0, 2*len(v))
+		for _, k := range keys {
+			l = append(l, k, ToGraphSON(v[k]))
+		}
+		return typed{"g:Map", l}
+	case Vertex:
+		props := make(map[string]any, len(v.Properties))
+		for k, p := range v.Properties {
+			props[k] = []any{typed{"g:VertexProperty", map[string]any{
+				"id":    ToGraphSON(v.ID + "." + k),
+				"label": k,
+				"value": ToGraphSON(p),
+			}}}
+		}
+		return typed{"g:Vertex", map[string]any{
+			"id":         ToGraphSON(idValue(v.ID)),
+			"label":      v.Label,
+			"properties": props,
+		}}
+	case Edge:
+		props := make(map[string]any, len(v.Properties))
+		for k, p := range v.Properties {
+			props[k] = typed{"g:Property", map[string]any{"key": k, "value": ToGraphSON(p)}}
+		}
+		return typed{"g:Edge", map[string]any{
+			"id":         ToGraphSON(idValue(v.ID)),
+			"label":      v.Label,
+			"outV":       ToGraphSON(idValue(v.OutV)),
+			"inV":        ToGraphSON(idValue(v.InV)),
+			"properties": props,
+		}}
+	}
+	return v
+}
+
+// FromGraphSON converts a decoded GraphSON 3.0 value to the plain values
+// traversals use. JSON must have been decoded with UseNumber.
+func FromGraphSON(v any) (any, error) {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		return v.Float64()
+	case []any:
+		l := make([]any, len(v))
+		for i, e := range v {
+			var err error
+			if l[i], err = FromGraphSON(e); err != nil {
+				return nil, err
+			}
+		}
+		return l, nil
+	case map[string]any:
+		t, ok := v["@type"].(string)
+		if !ok {
+			m := make(map[string]any, len(v))
+			for k, e := range v {
+				var err error
+				if m[k], err = FromGraphSON(e); err != nil {
+					return nil, err
+				}
+			}
+			return m, nil
+		}
+		return fromTyped(t, v["@value"])
+	}
+	return v, nil
+}
+
+func fromTyped(t string, v any) (any, error) {
+	switch t {
+	case "g:Int32", "g:Int64":
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("gremlin: %s value is not a number", t)
+		}
+		return n.Int64()
+	case "g:Float", "g:Double":
+		switch n := v.(type) {
+		case json.Number:
+			return n.Float64()
+		case string: // NaN and the infinities are sent as strings
+			switch n {
+			case "NaN":
+				return math.NaN(), nil
+			case "Infinity":
+				return math.Inf(1), nil
+			case "-Infinity":
+				return math.Inf(-1), nil
+			}
+		}
+		return nil, fmt.Errorf("gremlin: bad %s value", t)
+	case "g:List", "g:Set":
+		return FromGraphSON(orEmpty(v))
+	case "g:Map":
+		l, _ := orEmpty(v).([]any)
+		m := make(map[string]any, len(l)/2)
+		for i := 0; i+1 < len(l); i += 2 {
+			k, err := FromGraphSON(l[i])
+			if err != nil {
+				return nil, err
+			}
+			if m[fmt.Sprint(k)], err = FromGraphSON(l[i+1]); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case "g:P":
+		m, _ := v.(map[string]any)
+		op, _ := m["predicate"].(string)
+		if !predicates[op] {
+			return nil, fmt.Errorf("gremlin: unsupported predicate %q", op)
+		}
+		arg, err := FromGraphSON(m["value"])
+		if err != nil {
+			return nil, err
+		}
+		return newPredicate(op, []any{arg})
+	case "g:Bytecode":
+		return FromBytecode(v)
+	}
+	return nil, fmt.Errorf("gremlin: unsupported GraphSON type %s", t)
+}
+
+func orEmpty(v any) any {
+	if v == nil {
+		return []any{}
+	}
+	return v
+}
+
+// FromBytecode converts the @value of a g:Bytecode to a traversal. Only the
+// step instructions are used; source instructions such as withStrategies are
+// rejected.
+func FromBytecode(v any) (Traversal, error) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("gremlin: bytecode must be an object")
+	}
+	if m["@type"] == "g:Bytecode" {
+		m, _ = m["@value"].(map[string]any)
+	}
+	if src, _ := m["source"].([]any); len(src) > 0 {
+		return nil, fmt.Errorf("gremlin: traversal source instructions are not supported")
+	}
+	steps, _ := m["step"].([]any)
+	t := make(Traversal, 0, len(steps))
+	for _, s := range steps {
+		inst, _ := s.([]any)
+		if len(inst) == 0 {
+			return nil, fmt.Errorf("gremlin: empty instruction")
+		}
+		name, ok := inst[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("gremlin: instruction name must be a string")
+		}
+		args := make([]any, len(inst)-1)
+		for i, a := range inst[1:] {
+			var err error
+			if args[i], err = FromGraphSON(a); err != nil {
+				return nil, fmt.Errorf("gremlin: %s(): %w", name, err)
+			}
+		}
+		if !terminal[name] && !strings.HasPrefix(name, "with") {
+			t = append(t, Step{Name: name, Args: args})
+		}
+	}
+	if len(t) == 0 {
+		return nil, fmt.Errorf("gremlin: empty traversal")
+	}
+	return t, nil
+}
@@ -0,0 +1,238 @@
+package gremlin
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// memGraph is an in-memory Graph
+type memGraph struct {
+	vertices []Vertex
+	edges    []Edge
+}
+
+func (g *memGraph) Vertices(ctx context.Context) ([]Vertex, error) { return g.vertices, nil }
+
+func (g *memGraph) Edges(ctx context.Context) ([]Edge, error) { return g.edges, nil }
+
+func (g *memGraph) AddVertex(ctx context.Context, label string, props map[string]any) (Vertex, error) {
+	v := Vertex{ID: fmt.Sprint(len(g.vertices) + 1), Label: label, Properties: props}
+	g.vertices = append(g.vertices, v)
+	return v, nil
+}
+
+func social() *memGraph {
+	return &memGraph{
+		vertices: []Vertex{
+			{ID: "1", Label: "Person", Properties: map[string]any{"name": "Ann", "age": int64(31)}},
+			{ID: "2", Label: "Person", Properties: map[string]any{"name": "Bob", "age": int64(25)}},
+			{ID: "3", Label: "Company", Properties: map[string]any{"name": "Acme"}},
+		},
+		edges: []Edge{
+			{ID: "edge_1", Label: "KNOWS", OutV: "1", InV: "2", Properties: map[string]any{}},
+			{ID: "edge_2", Label: "WORKS_AT", OutV: "1", InV: "3", Properties: map[string]any{"since": int64(2020)}},
+		},
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	got, err := ParseScript(`g.V().has('Person', "age", P.gt(30)).has('name', within('Ann', 'Bob')).limit(2L).values('name').toList();`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Traversal{
+		{Name: "V", Args: nil},
+		{Name: "has", Args: []any{"Person", "age", Predicate{Op: "gt", Value: int64(30)}}},
+		{Name: "has", Args: []any{"name", Predicate{Op: "within", Value: []any{"Ann", "Bob"}}}},
+		{Name: "limit", Args: []any{int64(2)}},
+		{Name: "values", Args: []any{"name"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v\nwant %#v", got, want)
+	}
+
+	for _, bad := range []string{"", "x.V()", "g.V(", "g.V().has('a', foo(1))", "g.V().has('a)"} {
+		if _, err := ParseScript(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		script string
+		want   []any
+	}{
+		{"g.V().count()", []any{int64(3)}},
+		{"g.V().hasLabel('Person').values('name')", []any{"Ann", "Bob"}},
+		{"g.V().has('age', gte(31)).values('name')", []any{"Ann"}},
+		{"g.V().has('Person', 'name', neq('Ann')).id()", []any{int64(2)}},
+		{"g.V(1).out('KNOWS').values('name')", []any{"Bob"}},
+		{"g.V(1).out().label()", []any{"Person", "Company"}},
+		{"g.V(3).in().values('name')", []any{"Ann"}},
+		{"g.V(1).outE('WORKS_AT').values('since')", []any{int64(2020)}},
+		{"g.E().hasLabel('KNOWS').inV().values('name')", []any{"Bob"}},
+		{"g.V().has('name').limit(1).valueMap('name')", []any{map[string]any{"name": []any{"Ann"}}}},
+		{"g.V().has('name', 'Zed')", nil},
+	}
+	for _, tt := range tests {
+		tr, err := ParseScript(tt.script)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.script, err)
+		}
+		got, err := Evaluate(context.Background(), social(), tr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.script, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.script, got, tt.want)
+		}
+	}
+
+	g := social()
+	tr, _ := ParseScript("g.addV('Person').property('name', 'Cid').property('age', 40).values('age')")
+	got, err := Evaluate(context.Background(), g, tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []any{int64(40)}) || len(g.vertices) != 4 {
+		t.Errorf("addV: got %#v with %d vertices", got, len(g.vertices))
+	}
+
+	tr, _ = ParseScript("g.V().repeat(out())")
+	if _, err := Evaluate(context.Background(), g, tr); err == nil {
+		t.Error("expected an error for an unsupported step")
+	}
+}
+
+func TestFromBytecode(t *testing.T) {
+	const bytecode = `{"@type":"g:Bytecode","@value":{"step":[["V"],
+		["has","Person","age",{"@type":"g:P","@value":{"predicate":"lt","value":{"@type":"g:Int32","@value":30}}}],
+		["values","name"],["toList"]]}}`
+	dec := json.NewDecoder(strings.NewReader(bytecode))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	tr, err := FromBytecode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Evaluate(context.Background(), social(), tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []any{"Bob"}) {
+		t.Errorf("got %#v", got)
+	}
+}
+
+// wsClient is a minimal websocket client for the handler test
+type wsClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, url string) *wsClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(conn, "GET /gremlin HTTP/1.1\r\nHost: x\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake: %s %v", resp.Status, resp.Header)
+	}
+	return &wsClient{conn: conn, r: r}
+}
+
+func (c *wsClient) send(t *testing.T, op byte, msg []byte) {
+	t.Helper()
+	mask := [4]byte{1, 2, 3, 4}
+	b := []byte{0x80 | op}
+	if len(msg) < 126 {
+		b = append(b, 0x80|byte(len(msg)))
+	} else {
+		b = binary.BigEndian.AppendUint16(append(b, 0x80|126), uint16(len(msg)))
+	}
+	b = append(b, mask[:]...)
+	for i, c := range msg {
+		b = append(b, c^mask[i%4])
+	}
+	if _, err := c.conn.Write(b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *wsClient) receive(t *testing.T) Response {
+	t.Helper()
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		t.Fatal(err)
+	}
+	n := int(hdr[1] & 0x7F)
+	if n == 126 {
+		var ext [2]byte
+		io.ReadFull(c.r, ext[:])
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		t.Fatal(err)
+	}
+	var resp Response
+	if err := json.Unmarshal(payload, &resp); err != nil {
+		t.Fatalf("%v: %s", err, payload)
+	}
+	return resp
+}
+
+func TestHandler(t *testing.T) {
+	srv := httptest.NewServer(Handler(social()))
+	defer srv.Close()
+	c := dial(t, srv.URL)
+	defer c.conn.Close()
+
+	// a driver sends bytecode in a binary frame behind its mime type
+	mime := "application/vnd.gremlin-v3.0+json"
+	req := `{"requestId":{"@type":"g:UUID","@value":"r1"},"op":"bytecode","processor":"traversal",` +
+		`"args":{"gremlin":{"@type":"g:Bytecode","@value":{"step":[["V"],["hasLabel","Person"],["count"]]}},"aliases":{"g":"g"}}}`
+	c.send(t, opBinary, append(append([]byte{byte(len(mime))}, mime...), req...))
+	resp := c.receive(t)
+	want := map[string]any{"@type": "g:List", "@value": []any{map[string]any{"@type": "g:Int64", "@value": float64(2)}}}
+	if resp.RequestID != "r1" || resp.Status.Code != StatusSuccess || !reflect.DeepEqual(resp.Result.Data, want) {
+		t.Errorf("bytecode: %+v", resp)
+	}
+
+	c.send(t, opText, []byte(`{"requestId":"r2","op":"eval","args":{"gremlin":"g.V().has('name','Zed')"}}`))
+	if resp := c.receive(t); resp.RequestID != "r2" || resp.Status.Code != StatusNoContent {
+		t.Errorf("empty eval: %+v", resp)
+	}
+
+	c.send(t, opText, []byte(`{"requestId":"r3","op":"eval","args":{"gremlin":"g.V().sideEffect()"}}`))
+	if resp := c.receive(t); resp.Status.Code != StatusEvaluation || resp.Status.Message == "" {
+		t.Errorf("failed eval: %+v", resp)
+	}
+
+	c.send(t, opText, []byte(`{"requestId":"r4","op":"authentication","args":{}}`))
+	if resp := c.receive(t); resp.Status.Code != StatusInvalidRequest {
+		t.Errorf("unsupported op: %+v", resp)
+	}
+}
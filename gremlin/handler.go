@@ -0,0 +1,156 @@
+package gremlin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Gremlin Server response status codes
+const (
+	StatusSuccess        = 200
+	StatusNoContent      = 204
+	StatusInvalidRequest = 499
+	StatusEvaluation     = 597
+	StatusServerError    = 599
+)
+
+// Request is a Gremlin Server request message
+type Request struct {
+	RequestID any            `json:"requestId"`
+	Op        string         `json:"op"`
+	Processor string         `json:"processor"`
+	Args      map[string]any `json:"args"`
+}
+
+// Response is a Gremlin Server response message
+type Response struct {
+	RequestID string         `json:"requestId"`
+	Status    ResponseStatus `json:"status"`
+	Result    ResponseResult `json:"result"`
+}
+
+// ResponseStatus reports how a request went
+type ResponseStatus struct {
+	Code       int    `json:"code"`
+	Message    string `json:"message"`
+	Attributes any    `json:"attributes"`
+}
+
+// ResponseResult carries the GraphSON result of a request
+type ResponseResult struct {
+	Data any `json:"data"`
+	Meta any `json:"meta"`
+}
+
+// Handler serves the Gremlin Server websocket protocol at any path; drivers
+// usually connect to ws://host:8182/gremlin. Requests are GraphSON 3.0, either
+// as text frames or as binary frames carrying the mime type prefix. Only
+// "bytecode" and "eval" requests are answered, and results come back in a
+// single response.
+func Handler(g Graph) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer c.conn.Close()
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		// closing the connection unblocks the read when the server shuts down
+		stop := context.AfterFunc(ctx, func() { c.conn.Close() })
+		defer stop()
+
+		for {
+			op, msg, err := c.readMessage()
+			if err != nil {
+				return
+			}
+			if op == opBinary {
+				// a binary request starts with a length-prefixed mime type
+				if len(msg) == 0 || int(msg[0])+1 > len(msg) {
+					return
+				}
+				msg = msg[1+int(msg[0]):]
+			}
+			resp := serve(ctx, g, msg)
+			b, err := json.Marshal(resp)
+			if err != nil {
+				b, _ = json.Marshal(failure(resp.RequestID, StatusServerError, err))
+			}
+			if err := c.writeMessage(op, b); err != nil {
+				return
+			}
+		}
+	})
+}
+
+// serve answers one request
+func serve(ctx context.Context, g Graph, msg []byte) Response {
+	var req Request
+	dec := json.NewDecoder(bytes.NewReader(msg))
+	dec.UseNumber()
+	if err := dec.Decode(&req); err != nil {
+		return failure("", StatusInvalidRequest, fmt.Errorf("bad request: %w", err))
+	}
+	id := requestID(req.RequestID)
+
+	var (
+		t   Traversal
+		err error
+	)
+	switch req.Op {
+	case "bytecode":
+		t, err = FromBytecode(req.Args["gremlin"])
+	case "eval":
+		if b, _ := req.Args["bindings"].(map[string]any); len(b) > 0 {
+			return failure(id, StatusInvalidRequest, fmt.Errorf("script bindings are not supported"))
+		}
+		script, ok := req.Args["gremlin"].(string)
+		if !ok {
+			return failure(id, StatusInvalidRequest, fmt.Errorf("eval needs a gremlin script"))
+		}
+		t, err = ParseScript(script)
+	default:
+		return failure(id, StatusInvalidRequest, fmt.Errorf("unsupported op %q", req.Op))
+	}
+	if err != nil {
+		return failure(id, StatusInvalidRequest, err)
+	}
+
+	result, err := Evaluate(ctx, g, t)
+	if err != nil {
+		return failure(id, StatusEvaluation, err)
+	}
+	if len(result) == 0 {
+		return respond(id, StatusNoContent, "", nil)
+	}
+	return respond(id, StatusSuccess, "", ToGraphSON(result))
+}
+
+// requestID accepts a plain string or a g:UUID
+func requestID(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case map[string]any:
+		s, _ := v["@value"].(string)
+		return s
+	}
+	return ""
+}
+
+func respond(id string, code int, message string, data any) Response {
+	empty := typed{"g:Map", []any{}}
+	return Response{
+		RequestID: id,
+		Status:    ResponseStatus{Code: code, Message: message, Attributes: empty},
+		Result:    ResponseResult{Data: data, Meta: empty},
+	}
+}
+
+func failure(id string, code int, err error) Response {
+	return respond(id, code, err.Error(), nil)
+}
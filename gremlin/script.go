@@ -0,0 +1,214 @@
+package gremlin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// terminal steps only tell a script engine how to iterate; they are dropped
+var terminal = map[string]bool{"toList": true, "next": true, "iterate": true, "toSet": true}
+
+// predicates accepted as has() values, with or without the P. prefix
+var predicates = map[string]bool{
+	"eq": true, "neq": true, "gt": true, "gte": true, "lt": true, "lte": true,
+	"within": true, "without": true,
+}
+
+// ParseScript reads a traversal written in Gremlin-Groovy, such as
+// g.V().hasLabel('Person').has('age', gt(30)).values('name')
+func ParseScript(script string) (Traversal, error) {
+	p := &scriptParser{s: strings.TrimSpace(script)}
+	p.s = strings.TrimSuffix(p.s, ";")
+	if name := p.ident(); name != "g" {
+		return nil, p.errorf("a traversal must start with g")
+	}
+	var t Traversal
+	for {
+		p.space()
+		if p.pos == len(p.s) {
+			break
+		}
+		if !p.accept('.') {
+			return nil, p.errorf("expected '.'")
+		}
+		st, err := p.step()
+		if err != nil {
+			return nil, err
+		}
+		if !terminal[st.Name] {
+			t = append(t, st)
+		}
+	}
+	if len(t) == 0 {
+		return nil, p.errorf("empty traversal")
+	}
+	return t, nil
+}
+
+type scriptParser struct {
+	s   string
+	pos int
+}
+
+func (p *scriptParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("gremlin: offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *scriptParser) space() {
+	for p.pos < len(p.s) && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *scriptParser) accept(c byte) bool {
+	p.space()
+	if p.pos < len(p.s) && p.s[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *scriptParser) ident() string {
+	p.space()
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := rune(p.s[p.pos])
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' {
+			break
+		}
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// step reads name(args...)
+func (p *scriptParser) step() (Step, error) {
+	name := p.ident()
+	if name == "" {
+		return Step{}, p.errorf("expected a step name")
+	}
+	args, err := p.args()
+	if err != nil {
+		return Step{}, err
+	}
+	return Step{Name: name, Args: args}, nil
+}
+
+func (p *scriptParser) args() ([]any, error) {
+	if !p.accept('(') {
+		return nil, p.errorf("expected '('")
+	}
+	var args []any
+	if p.accept(')') {
+		return args, nil
+	}
+	for {
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+		if p.accept(')') {
+			return args, nil
+		}
+		if !p.accept(',') {
+			return nil, p.errorf("expected ',' or ')'")
+		}
+	}
+}
+
+// value reads a literal or a predicate such as gt(30) or P.within('a', 'b')
+func (p *scriptParser) value() (any, error) {
+	p.space()
+	if p.pos == len(p.s) {
+		return nil, p.errorf("expected a value")
+	}
+	switch c := p.s[p.pos]; {
+	case c == '\'' || c == '"':
+		return p.str(c)
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.number()
+	}
+
+	name := p.ident()
+	switch name {
+	case "true", "false":
+		return name == "true", nil
+	case "null":
+		return nil, nil
+	case "P":
+		if !p.accept('.') {
+			return nil, p.errorf("expected '.' after P")
+		}
+		name = p.ident()
+	}
+	if !predicates[name] {
+		return nil, p.errorf("unsupported value %q", name)
+	}
+	args, err := p.args()
+	if err != nil {
+		return nil, err
+	}
+	return newPredicate(name, args)
+}
+
+func newPredicate(op string, args []any) (Predicate, error) {
+	if op == "within" || op == "without" {
+		if len(args) == 1 {
+			if list, ok := args[0].([]any); ok {
+				args = list
+			}
+		}
+		return Predicate{Op: op, Value: args}, nil
+	}
+	if len(args) != 1 {
+		return Predicate{}, fmt.Errorf("gremlin: %s() takes one value", op)
+	}
+	return Predicate{Op: op, Value: args[0]}, nil
+}
+
+func (p *scriptParser) str(quote byte) (any, error) {
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		p.pos++
+		switch {
+		case c == quote:
+			return b.String(), nil
+		case c == '\\' && p.pos < len(p.s):
+			b.WriteByte(p.s[p.pos])
+			p.pos++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return nil, p.errorf("unterminated string")
+}
+
+// number reads an integer or a float; Groovy type suffixes such as 1L are
+// accepted and ignored
+func (p *scriptParser) number() (any, error) {
+	start := p.pos
+	if p.s[p.pos] == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.s) && (p.s[p.pos] >= '0' && p.s[p.pos] <= '9' || p.s[p.pos] == '.') {
+		p.pos++
+	}
+	text := p.s[start:p.pos]
+	if p.pos < len(p.s) && strings.IndexByte("lLdDfF", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return n, nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, p.errorf("bad number %q", text)
+	}
+	return f, nil
+}
@@ -0,0 +1,505 @@
+// Package gremlin is an experimental endpoint for TinkerPop tooling. It accepts
+// Gremlin traversals, as bytecode or as script text, over the Gremlin Server
+// websocket protocol and evaluates a subset of the steps against a Graph.
+//
+// The supported steps are V, E, addV, property, hasLabel, has, hasId, out,
+// in, both, outE, inE, outV, inV, values, valueMap, id, label, count and limit.
+// has accepts a value or one of the predicates eq, neq, gt, gte, lt, lte and
+// within.
+package gremlin
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// Vertex is a node of the graph
+type Vertex struct {
+	ID         string
+	Label      string
+	Properties map[string]any
+}
+
+// Edge is a directed edge of the graph
+type Edge struct {
+	ID         string
+	Label      string
+	OutV, InV  string // IDs of the source and target vertices
+	Properties map[string]any
+}
+
+// Graph is what traversals run against. Property values are nil, bool,
+// string, int64 or float64.
+type Graph interface {
+	Vertices(ctx context.Context) ([]Vertex, error)
+	Edges(ctx context.Context) ([]Edge, error)
+	AddVertex(ctx context.Context, label string, props map[string]any) (Vertex, error)
+}
+
+// Step is one traversal step and its arguments
+type Step struct {
+	Name string
+	Args []any
+}
+
+// Traversal is a sequence of steps starting at the graph source g
+type Traversal []Step
+
+// Predicate is a comparison used by has, e.g. gt(30)
+type Predicate struct {
+	Op    string
+	Value any
+}
+
+// Evaluate runs t against g and returns the objects it produces
+func Evaluate(ctx context.Context, g Graph, t Traversal) ([]any, error) {
+	if len(t) == 0 {
+		return nil, fmt.Errorf("gremlin: empty traversal")
+	}
+	ev := &evaluator{ctx: ctx, g: g}
+	var (
+		cur   []any
+		err   error
+		steps = t[1:]
+	)
+	switch start := t[0]; start.Name {
+	case "V":
+		cur, err = ev.vertices(start.Args)
+	case "E":
+		cur, err = ev.edges(start.Args)
+	case "addV":
+		cur, err = ev.addV(start.Args, steps)
+		// addV consumes the property steps that follow it
+		steps = steps[countProperty(steps):]
+	default:
+		return nil, fmt.Errorf("gremlin: unsupported start step %s()", start.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range steps {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if cur, err = ev.step(st, cur); err != nil {
+			return nil, err
+		}
+	}
+	return cur, nil
+}
+
+func countProperty(t Traversal) int {
+	n := 0
+	for n < len(t) && t[n].Name == "property" {
+		n++
+	}
+	return n
+}
+
+type evaluator struct {
+	ctx      context.Context
+	g        Graph
+	byID     map[string]Vertex // loaded on first use
+	edgeList []Edge
+}
+
+func (ev *evaluator) loadVertices() (map[string]Vertex, error) {
+	if ev.byID == nil {
+		vs, err := ev.g.Vertices(ev.ctx)
+		if err != nil {
+			return nil, err
+		}
+		ev.byID = make(map[string]Vertex, len(vs))
+		for _, v := range vs {
+			ev.byID[v.ID] = v
+		}
+	}
+	return ev.byID, nil
+}
+
+func (ev *evaluator) loadEdges() ([]Edge, error) {
+	if ev.edgeList == nil {
+		es, err := ev.g.Edges(ev.ctx)
+		if err != nil {
+			return nil, err
+		}
+		ev.edgeList = es
+	}
+	return ev.edgeList, nil
+}
+
+// vertices starts at every vertex, or at the vertices with the given IDs
+func (ev *evaluator) vertices(ids []any) ([]any, error) {
+	vs, err := ev.loadVertices()
+	if err != nil {
+		return nil, err
+	}
+	var out []any
+	if len(ids) > 0 {
+		for _, id := range ids {
+			if v, ok := vs[idString(id)]; ok {
+				out = append(out, v)
+			}
+		}
+		return out, nil
+	}
+	keys := make([]string, 0, len(vs))
+	for id := range vs {
+		keys = append(keys, id)
+	}
+	slices.SortFunc(keys, compareIDs)
+	for _, id := range keys {
+		out = append(out, vs[id])
+	}
+	return out, nil
+}
+
+func (ev *evaluator) edges(ids []any) ([]any, error) {
+	es, err := ev.loadEdges()
+	if err != nil {
+		return nil, err
+	}
+	var out []any
+	for _, e := range es {
+		if len(ids) == 0 || slices.ContainsFunc(ids, func(id any) bool { return idString(id) == e.ID }) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (ev *evaluator) addV(args []any, rest Traversal) ([]any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("gremlin: addV() needs a label")
+	}
+	label, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("gremlin: addV() label must be a string")
+	}
+	props := make(map[string]any)
+	for _, st := range rest[:countProperty(rest)] {
+		if len(st.Args) != 2 {
+			return nil, fmt.Errorf("gremlin: property() needs a key and a value")
+		}
+		key, ok := st.Args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("gremlin: property() key must be a string")
+		}
+		props[key] = st.Args[1]
+	}
+	v, err := ev.g.AddVertex(ev.ctx, label, props)
+	if err != nil {
+		return nil, err
+	}
+	return []any{v}, nil
+}
+
+// step applies one step to the current traversers
+func (ev *evaluator) step(st Step, cur []any) ([]any, error) {
+	var out []any
+	switch st.Name {
+	case "hasLabel":
+		for _, o := range cur {
+			if slices.ContainsFunc(st.Args, func(l any) bool { return l == labelOf(o) }) {
+				out = append(out, o)
+			}
+		}
+	case "hasId":
+		for _, o := range cur {
+			if slices.ContainsFunc(st.Args, func(id any) bool { return idString(id) == idOf(o) }) {
+				out = append(out, o)
+			}
+		}
+	case "has":
+		label, key, want, err := hasArgs(st.Args)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range cur {
+			if label != "" && labelOf(o) != label {
+				continue
+			}
+			v, ok := propertiesOf(o)[key]
+			if !ok {
+				continue
+			}
+			if want == nil || want.match(v) {
+				out = append(out, o)
+			}
+		}
+	case "out", "in", "both", "outE", "inE", "bothE":
+		es, err := ev.loadEdges()
+		if err != nil {
+			return nil, err
+		}
+		vs, err := ev.loadVertices()
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range cur {
+			v, ok := o.(Vertex)
+			if !ok {
+				return nil, fmt.Errorf("gremlin: %s() needs vertices", st.Name)
+			}
+			for _, e := range es {
+				if len(st.Args) > 0 && !slices.Contains(st.Args, any(e.Label)) {
+					continue
+				}
+				outgoing := e.OutV == v.ID && st.Name != "in" && st.Name != "inE"
+				incoming := e.InV == v.ID && st.Name != "out" && st.Name != "outE"
+				switch {
+				case st.Name[len(st.Name)-1] == 'E':
+					if outgoing || incoming {
+						out = append(out, e)
+					}
+				case outgoing:
+					out = append(out, vs[e.InV])
+				case incoming:
+					out = append(out, vs[e.OutV])
+				}
+			}
+		}
+	case "outV", "inV":
+		vs, err := ev.loadVertices()
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range cur {
+			e, ok := o.(Edge)
+			if !ok {
+				return nil, fmt.Errorf("gremlin: %s() needs edges", st.Name)
+			}
+			id := e.OutV
+			if st.Name == "inV" {
+				id = e.InV
+			}
+			out = append(out, vs[id])
+		}
+	case "values":
+		for _, o := range cur {
+			props := propertiesOf(o)
+			for _, key := range propertyKeys(props, st.Args) {
+				out = append(out, props[key])
+			}
+		}
+	case "valueMap":
+		for _, o := range cur {
+			props := propertiesOf(o)
+			m := make(map[string]any)
+			for _, key := range propertyKeys(props, st.Args) {
+				m[key] = []any{props[key]} // valueMap lists every value of a key
+			}
+			out = append(out, m)
+		}
+	case "id":
+		for _, o := range cur {
+			out = append(out, idValue(idOf(o)))
+		}
+	case "label":
+		for _, o := range cur {
+			out = append(out, labelOf(o))
+		}
+	case "count":
+		return []any{int64(len(cur))}, nil
+	case "limit":
+		if len(st.Args) != 1 {
+			return nil, fmt.Errorf("gremlin: limit() needs a count")
+		}
+		n, ok := st.Args[0].(int64)
+		if !ok || n < 0 {
+			return nil, fmt.Errorf("gremlin: limit() needs a non-negative integer")
+		}
+		return cur[:min(int(n), len(cur))], nil
+	default:
+		return nil, fmt.Errorf("gremlin: unsupported step %s()", st.Name)
+	}
+	return out, nil
+}
+
+// hasArgs reads has(key), has(key, value) or has(label, key, value)
+func hasArgs(args []any) (label, key string, want *Predicate, err error) {
+	strs := func(n int) bool {
+		for _, a := range args[:n] {
+			if _, ok := a.(string); !ok {
+				return false
+			}
+		}
+		return true
+	}
+	switch {
+	case len(args) == 1 && strs(1):
+		return "", args[0].(string), nil, nil
+	case len(args) == 2 && strs(1):
+		return "", args[0].(string), predicate(args[1]), nil
+	case len(args) == 3 && strs(2):
+		return args[0].(string), args[1].(string), predicate(args[2]), nil
+	}
+	return "", "", nil, fmt.Errorf("gremlin: has() takes a key and optionally a label and a value")
+}
+
+func predicate(v any) *Predicate {
+	if p, ok := v.(Predicate); ok {
+		return &p
+	}
+	return &Predicate{Op: "eq", Value: v}
+}
+
+// match reports whether v satisfies the predicate
+func (p *Predicate) match(v any) bool {
+	switch p.Op {
+	case "eq":
+		return equal(v, p.Value)
+	case "neq":
+		return !equal(v, p.Value)
+	case "within":
+		vals, _ := p.Value.([]any)
+		return slices.ContainsFunc(vals, func(w any) bool { return equal(v, w) })
+	case "without":
+		vals, _ := p.Value.([]any)
+		return !slices.ContainsFunc(vals, func(w any) bool { return equal(v, w) })
+	}
+	c, ok := compare(v, p.Value)
+	if !ok {
+		return false
+	}
+	switch p.Op {
+	case "gt":
+		return c > 0
+	case "gte":
+		return c >= 0
+	case "lt":
+		return c < 0
+	case "lte":
+		return c <= 0
+	}
+	return false
+}
+
+func equal(a, b any) bool {
+	if c, ok := compare(a, b); ok {
+		return c == 0
+	}
+	return a == b
+}
+
+// compare orders two numbers or two strings
+func compare(a, b any) (int, bool) {
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	if x, ok := a.(string); ok {
+		if y, ok := b.(string); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func labelOf(o any) any {
+	switch o := o.(type) {
+	case Vertex:
+		return o.Label
+	case Edge:
+		return o.Label
+	}
+	return nil
+}
+
+func idOf(o any) string {
+	switch o := o.(type) {
+	case Vertex:
+		return o.ID
+	case Edge:
+		return o.ID
+	}
+	return ""
+}
+
+func propertiesOf(o any) map[string]any {
+	switch o := o.(type) {
+	case Vertex:
+		return o.Properties
+	case Edge:
+		return o.Properties
+	}
+	return nil
+}
+
+// propertyKeys returns the requested keys present in props, or all of them
+// in sorted order
+func propertyKeys(props map[string]any, want []any) []string {
+	var keys []string
+	if len(want) == 0 {
+		for k := range props {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		return keys
+	}
+	for _, w := range want {
+		if k, ok := w.(string); ok {
+			if _, present := props[k]; present {
+				keys = append(keys, k)
+			}
+		}
+	}
+	return keys
+}
+
+// idString accepts numeric and string IDs alike
+func idString(id any) string {
+	switch id := id.(type) {
+	case int64:
+		return strconv.FormatInt(id, 10)
+	case string:
+		return id
+	}
+	return fmt.Sprint(id)
+}
+
+// idValue returns numeric IDs as numbers, which is what TinkerPop clients expect
+func idValue(id string) any {
+	if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+		return n
+	}
+	return id
+}
+
+func compareIDs(a, b string) int {
+	if len(a) != len(b) {
+		return len(a) - len(b)
+	}
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
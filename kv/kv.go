@@ -0,0 +1,477 @@
+// Package kv is a small embedded key-value store in the manner of Bitcask:
+// every write is appended to a single file, and an index in memory maps each
+// key to where its latest value sits in the file, so that only the keys take
+// up memory and a value costs one read. Writes are grouped into batches that
+// a crash keeps whole or not at all. Compact rewrites the file without the
+// values that were overwritten or deleted.
+package kv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrClosed is returned once the store is closed
+var ErrClosed = errors.New("kv: store closed")
+
+// ErrCorrupt is returned by Open when a record the file holds is damaged
+// but committed batches follow it, so cutting the file short at it would lose
+// them
+var ErrCorrupt = errors.New("kv: corrupt record")
+
+// record ops
+const (
+	opPut    byte = 'p'
+	opDelete byte = 'd'
+	opCommit byte = 'c'
+)
+
+// A record is a 13-byte header, then the key and the value:
+//
+//	crc32 (4) | op (1) | key length (4) | value length (4)
+//
+// all big-endian, with the CRC (Castagnoli) over everything after it
+const headerSize = 13
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// loc is where a value sits in the file
+type loc struct {
+	off int64
+	n   int
+}
+
+// DB is an open store. Its methods are safe for concurrent use.
+type DB struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	w       *bufio.Writer
+	keys    map[string]loc
+	pending map[string]*loc // writes since the last Commit; nil for a deletion
+	end     int64           // of what has been written, committed or not
+	dead    int64           // bytes of records Compact would drop
+}
+
+// Open opens the store in the file at path, creating it if need be. Writes
+// after the last complete commit, cut short by a crash, are cut off; a damaged
+// record anywhere before it fails the open with ErrCorrupt and leaves the file
+// as it is.
+func Open(path string) (*DB, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("kv: %w", err)
+	}
+	db := &DB{path: path, file: f, keys: make(map[string]loc), pending: make(map[string]*loc)}
+	if err := db.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	db.w = bufio.NewWriterSize(f, 64<<10)
+	return db, nil
+}
+
+// load builds the index from the file and cuts off what follows the last
+// commit, provided that is a torn tail and not a damaged record with more
+// commits after it
+func (db *DB) load() error {
+	r := bufio.NewReaderSize(db.file, 64<<10)
+	var (
+		pos, good int64
+		batch     = make(map[string]*loc)
+	)
+	for {
+		op, key, n, size, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// a torn tail has no commit after it, as the commit comes last
+			later, ferr := db.commitAfter(pos + 1)
+			if ferr != nil {
+				return fmt.Errorf("kv: %w", ferr)
+			}
+			if later {
+				return fmt.Errorf("%w at offset %d of %s: %v", ErrCorrupt, pos, db.path, err)
+			}
+			break
+		}
+		switch op {
+		case opPut:
+			batch[key] = &loc{off: pos + headerSize + int64(len(key)), n: n}
+		case opDelete:
+			batch[key] = nil
+		case opCommit:
+			for key, l := range batch {
+				db.apply(key, l)
+			}
+			clear(batch)
+			db.dead += size
+			good = pos + size
+		}
+		pos += size
+	}
+	if err := db.file.Truncate(good); err != nil {
+		return fmt.Errorf("kv: %w", err)
+	}
+	if _, err := db.file.Seek(good, io.SeekStart); err != nil {
+		return fmt.Errorf("kv: %w", err)
+	}
+	db.end = good
+	return nil
+}
+
+// commitRecord is the one record a commit writes, which is the same every time
+var commitRecord = func() []byte {
+	b := make([]byte, headerSize)
+	b[4] = opCommit
+	binary.BigEndian.PutUint32(b, crc32.Checksum(b[4:], crcTable))
+	return b
+}()
+
+// commitAfter reports whether a commit record starts anywhere in the file at
+// or after off. A value that happens to hold one looks the same, which only
+// ever errs on the side of refusing the file.
+func (db *DB) commitAfter(off int64) (bool, error) {
+	buf := make([]byte, 64<<10)
+	keep := 0 // bytes carried over from the last read, in case a record spans two
+	for {
+		n, err := db.file.ReadAt(buf[keep:], off)
+		if bytes.Contains(buf[:keep+n], commitRecord) {
+			return true, nil
+		}
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		off += int64(n)
+		if keep+n >= headerSize-1 {
+			keep = copy(buf, buf[keep+n-(headerSize-1):keep+n])
+		} else {
+			keep += n
+		}
+	}
+}
+
+// readRecord reads a record, returning its value's length rather than the
+// value, and the bytes it took
+func readRecord(r *bufio.Reader) (op byte, key string, n int, size int64, err error) {
+	var hdr [headerSize]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return
+	}
+	op = hdr[4]
+	kn := int(binary.BigEndian.Uint32(hdr[5:]))
+	n = int(binary.BigEndian.Uint32(hdr[9:]))
+	if kn > 1<<16 || n > 1<<30 {
+		return 0, "", 0, 0, errors.New("kv: bad record length")
+	}
+	body := make([]byte, kn+n)
+	if _, err = io.ReadFull(r, body); err != nil {
+		return
+	}
+	crc := crc32.Update(crc32.Checksum(hdr[4:], crcTable), crcTable, body)
+	if crc != binary.BigEndian.Uint32(hdr[:4]) {
+		return 0, "", 0, 0, errors.New("kv: checksum mismatch")
+	}
+	return op, string(body[:kn]), n, int64(headerSize + kn + n), nil
+}
+
+// apply points key at l in the index, or drops it if l is nil, counting the
+// records that leaves behind as dead
+func (db *DB) apply(key string, l *loc) {
+	if old, ok := db.keys[key]; ok {
+		db.dead += int64(headerSize + len(key) + old.n)
+	}
+	if l == nil {
+		delete(db.keys, key)
+		db.dead += int64(headerSize + len(key))
+		return
+	}
+	db.keys[key] = *l
+}
+
+// write appends a record
+func (db *DB) write(op byte, key string, value []byte) error {
+	if db.file == nil {
+		return ErrClosed
+	}
+	var hdr [headerSize]byte
+	hdr[4] = op
+	binary.BigEndian.PutUint32(hdr[5:], uint32(len(key)))
+	binary.BigEndian.PutUint32(hdr[9:], uint32(len(value)))
+	crc := crc32.Checksum(hdr[4:], crcTable)
+	crc = crc32.Update(crc, crcTable, []byte(key))
+	crc = crc32.Update(crc, crcTable, value)
+	binary.BigEndian.PutUint32(hdr[:4], crc)
+	db.w.Write(hdr[:])
+	db.w.WriteString(key)
+	if _, err := db.w.Write(value); err != nil {
+		return fmt.Errorf("kv: %w", err)
+	}
+	db.end += int64(headerSize + len(key) + len(value))
+	return nil
+}
+
+// Put sets key to value as of the next Commit
+func (db *DB) Put(key string, value []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if err := db.write(opPut, key, value); err != nil {
+		return err
+	}
+	db.pending[key] = &loc{off: db.end - int64(len(value)), n: len(value)}
+	return nil
+}
+
+// Delete removes key as of the next Commit
+func (db *DB) Delete(key string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if err := db.write(opDelete, key, nil); err != nil {
+		return err
+	}
+	db.pending[key] = nil
+	return nil
+}
+
+// DeletePrefix removes every key that starts with prefix, those written
+// since the last commit included, as of the next Commit
+func (db *DB) DeletePrefix(prefix string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var keys []string
+	for key := range db.keys {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	for key, l := range db.pending {
+		if l != nil && strings.HasPrefix(key, prefix) {
+			if _, ok := db.keys[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if err := db.write(opDelete, key, nil); err != nil {
+			return err
+		}
+		db.pending[key] = nil
+	}
+	return nil
+}
+
+// Commit makes the writes since the last commit take effect together and
+// writes them out. It syncs the file only if sync is set.
+func (db *DB) Commit(sync bool) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if err := db.write(opCommit, "", nil); err != nil {
+		return err
+	}
+	if err := db.w.Flush(); err != nil {
+		return fmt.Errorf("kv: %w", err)
+	}
+	if sync {
+		if err := db.file.Sync(); err != nil {
+			return fmt.Errorf("kv: %w", err)
+		}
+	}
+	for key, l := range db.pending {
+		db.apply(key, l)
+	}
+	clear(db.pending)
+	db.dead += headerSize
+	return nil
+}
+
+// GetCommitted returns the value of key as of the last commit
+func (db *DB) GetCommitted(key string) ([]byte, bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.file == nil {
+		return nil, false, ErrClosed
+	}
+	l, ok := db.keys[key]
+	if !ok {
+		return nil, false, nil
+	}
+	v, err := db.read(l)
+	return v, err == nil, err
+}
+
+// Get returns the value of key, taking writes not yet committed into account
+func (db *DB) Get(key string) ([]byte, bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.file == nil {
+		return nil, false, ErrClosed
+	}
+	l, ok := db.keys[key]
+	if p, written := db.pending[key]; written {
+		if p == nil {
+			return nil, false, nil
+		}
+		if err := db.w.Flush(); err != nil {
+			return nil, false, fmt.Errorf("kv: %w", err)
+		}
+		l, ok = *p, true
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	v, err := db.read(l)
+	return v, err == nil, err
+}
+
+func (db *DB) read(l loc) ([]byte, error) {
+	v := make([]byte, l.n)
+	if _, err := db.file.ReadAt(v, l.off); err != nil {
+		return nil, fmt.Errorf("kv: %w", err)
+	}
+	return v, nil
+}
+
+// Scan calls fn with each committed key that starts with prefix, and its
+// value, in key order, until fn returns an error, which Scan returns
+func (db *DB) Scan(prefix string, fn func(key string, value []byte) error) error {
+	db.mu.Lock()
+	if db.file == nil {
+		db.mu.Unlock()
+		return ErrClosed
+	}
+	var keys []string
+	for key := range db.keys {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	db.mu.Unlock()
+	slices.Sort(keys)
+	for _, key := range keys {
+		db.mu.Lock()
+		l, ok := db.keys[key]
+		var (
+			v   []byte
+			err error
+		)
+		if ok {
+			v, err = db.read(l)
+		}
+		db.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue // deleted meanwhile
+		}
+		if err := fn(key, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Len returns the number of committed keys
+func (db *DB) Len() int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return len(db.keys)
+}
+
+// Garbage returns the share of the file, from 0 to 1, that Compact would
+// free
+func (db *DB) Garbage() float64 {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.end == 0 {
+		return 0
+	}
+	return float64(db.dead) / float64(db.end)
+}
+
+// Compact rewrites the file with only the committed values keys lead to. It
+// must not run while a batch is being written.
+func (db *DB) Compact() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.file == nil {
+		return ErrClosed
+	}
+	if len(db.pending) > 0 {
+		return errors.New("kv: compact with writes not committed")
+	}
+	tmp, err := os.OpenFile(db.path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("kv: %w", err)
+	}
+	out := &DB{path: db.path, file: tmp, w: bufio.NewWriterSize(tmp, 64<<10), keys: make(map[string]loc, len(db.keys))}
+	keys := make([]string, 0, len(db.keys))
+	for key := range db.keys {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		v, err := db.read(db.keys[key])
+		if err == nil {
+			err = out.write(opPut, key, v)
+		}
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+		out.keys[key] = loc{off: out.end - int64(len(v)), n: len(v)}
+	}
+	err = out.write(opCommit, "", nil)
+	if err == nil {
+		err = out.w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), db.path)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("kv: compact: %w", err)
+	}
+	db.file.Close()
+	db.file, db.w, db.keys, db.end, db.dead = tmp, out.w, out.keys, out.end, headerSize
+	return nil
+}
+
+// Close writes out and syncs the file and closes the store. Writes not
+// committed are lost, as in a crash.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.file == nil {
+		return nil
+	}
+	f := db.file
+	db.file = nil
+	err := db.w.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,217 @@
+package kv
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func get(t *testing.T, db *DB, key string) string {
+	t.Helper()
+	v, ok, err := db.Get(key)
+	if err != nil {
+		t.Fatalf("get %s: %v", key, err)
+	}
+	if !ok {
+		return "<none>"
+	}
+	return string(v)
+}
+
+func TestPutGetDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.kv")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put("a", []byte("1"))
+	db.Put("b", []byte("2"))
+	if got := get(t, db, "a"); got != "1" {
+		t.Errorf("uncommitted a = %s, want 1", got)
+	}
+	if _, ok, _ := db.GetCommitted("a"); ok {
+		t.Error("GetCommitted found a before its commit")
+	}
+	if err := db.Commit(false); err != nil {
+		t.Fatal(err)
+	}
+	db.Put("a", []byte("3"))
+	db.Delete("b")
+	db.Put("c", nil)
+	if err := db.Commit(true); err != nil {
+		t.Fatal(err)
+	}
+	db.Put("d", []byte("never committed"))
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for key, want := range map[string]string{"a": "3", "b": "<none>", "c": "", "d": "<none>"} {
+		if got := get(t, db, key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if db.Len() != 2 {
+		t.Errorf("Len = %d, want 2", db.Len())
+	}
+}
+
+func TestTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.kv")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put("a", []byte("1"))
+	db.Commit(false)
+	db.Put("a", []byte("2"))
+	db.Commit(false)
+	db.Close()
+	info, _ := os.Stat(path)
+
+	// a commit record cut short, and then a corrupt one
+	for _, cut := range []int64{info.Size() - 1, info.Size()} {
+		if err := os.Truncate(path, cut); err != nil {
+			t.Fatal(err)
+		}
+		if cut == info.Size() {
+			f, _ := os.OpenFile(path, os.O_RDWR, 0)
+			f.WriteAt([]byte{0xff}, cut-2)
+			f.Close()
+		}
+		db, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := get(t, db, "a"); got != "1" {
+			t.Errorf("cut at %d: a = %s, want 1", cut, got)
+		}
+		// and the store takes writes again after the cut
+		db.Put("a", []byte("2"))
+		db.Commit(false)
+		db.Close()
+		info, _ = os.Stat(path)
+	}
+}
+
+func TestCorruptBeforeCommit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.kv")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put("a", []byte("1"))
+	db.Commit(false)
+	db.Put("b", []byte("2"))
+	db.Commit(false)
+	db.Close()
+	before, _ := os.ReadFile(path)
+
+	// a byte flipped in the first record, with a commit after it
+	f, _ := os.OpenFile(path, os.O_RDWR, 0)
+	f.WriteAt([]byte{before[headerSize] ^ 0xff}, headerSize)
+	f.Close()
+	if _, err := Open(path); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("open = %v, want ErrCorrupt", err)
+	}
+	if info, _ := os.Stat(path); info.Size() != int64(len(before)) {
+		t.Errorf("size after a refused open = %d, want %d", info.Size(), len(before))
+	}
+}
+
+func TestScanAndCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.kv")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for round := range 3 {
+		for i := range 10 {
+			db.Put(fmt.Sprintf("n/%02d", i), []byte(fmt.Sprint(round)))
+		}
+		db.Put("m", []byte("meta"))
+		db.Commit(false)
+	}
+	db.Delete("n/05")
+	db.Commit(false)
+	if g := db.Garbage(); g < 0.3 {
+		t.Errorf("Garbage = %v after rewriting every key twice", g)
+	}
+	before, _ := os.Stat(path)
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size() {
+		t.Errorf("compacted to %d bytes from %d", after.Size(), before.Size())
+	}
+
+	var keys []string
+	err = db.Scan("n/", func(key string, value []byte) error {
+		if string(value) != "2" {
+			t.Errorf("%s = %s, want 2", key, value)
+		}
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"n/00", "n/01", "n/02", "n/03", "n/04", "n/06", "n/07", "n/08", "n/09"}
+	if !slices.Equal(keys, want) {
+		t.Errorf("scan = %v, want %v", keys, want)
+	}
+
+	// writes go on after compaction, and survive a reopen
+	db.Put("n/10", []byte("x"))
+	db.Commit(false)
+	db.Close()
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := get(t, db, "n/10"); got != "x" {
+		t.Errorf("n/10 = %s, want x", got)
+	}
+	if got := get(t, db, "m"); got != "meta" {
+		t.Errorf("m = %s, want meta", got)
+	}
+}
+
+func TestDeletePrefix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.kv")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put("n/a/1", []byte("1"))
+	db.Put("n/ab/1", []byte("2"))
+	db.Commit(false)
+	db.Put("n/a/2", []byte("3"))
+	if err := db.DeletePrefix("n/a/"); err != nil {
+		t.Fatal(err)
+	}
+	db.Put("n/a/3", []byte("4"))
+	db.Commit(false)
+	db.Close()
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for key, want := range map[string]string{"n/a/1": "<none>", "n/a/2": "<none>", "n/a/3": "4", "n/ab/1": "2"} {
+		if got := get(t, db, key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+// Package nats is a minimal client for the NATS core protocol: publish,
+// subscribe and request/reply over a single connection, without reconnects
+package nats
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrClosed is returned once the connection is closed or broken
+var ErrClosed = errors.New("nats: connection closed")
+
+// Msg is a message delivered to a subscription
+type Msg struct {
+	Subject string
+	Reply   string // subject to answer on, if the sender expects a reply
+	Data    []byte
+}
+
+// Conn is a connection to a NATS server. Its methods are safe for concurrent
+// use; subscription handlers run one at a time on the reading goroutine, so a
+// handler must not wait for a Flush or Request on the same connection.
+type Conn struct {
+	conn net.Conn
+
+	wmu sync.Mutex
+	w   *bufio.Writer
+
+	mu      sync.Mutex
+	subs    map[int]func(*Msg)
+	nextSID int
+	pongs   []chan struct{}
+	inbox   string // prefix of reply subjects, once Request has subscribed
+	replies map[string]chan *Msg
+	nextReq int
+	err     error
+	done    chan struct{}
+}
+
+// Dial connects to the NATS server at addr (host:port) and waits until the
+// server has accepted the connection
+func Dial(ctx context.Context, addr string) (*Conn, error) {
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(nc)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("nats: read INFO: %w", err)
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		nc.Close()
+		return nil, fmt.Errorf("nats: expected INFO, got %q", strings.TrimSpace(line))
+	}
+
+	c := &Conn{
+		conn:    nc,
+		w:       bufio.NewWriter(nc),
+		subs:    make(map[int]func(*Msg)),
+		replies: make(map[string]chan *Msg),
+		done:    make(chan struct{}),
+	}
+	opts, _ := json.Marshal(map[string]any{"verbose": false, "pedantic": false, "name": "grapho", "lang": "go", "protocol": 1})
+	if err := c.write("CONNECT " + string(opts) + "\r\n"); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	go c.read(r)
+	if err := c.Flush(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close closes the connection
+func (c *Conn) Close() error {
+	c.fail(ErrClosed)
+	return nil
+}
+
+// Publish sends data to subject. It returns once the message is written;
+// Flush confirms that the server has received it.
+func (c *Conn) Publish(subject string, data []byte) error {
+	return c.publish(subject, "", data)
+}
+
+func (c *Conn) publish(subject, reply string, data []byte) error {
+	if reply != "" {
+		subject += " " + reply
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	fmt.Fprintf(c.w, "PUB %s %d\r\n", subject, len(data))
+	c.w.Write(data)
+	c.w.WriteString("\r\n")
+	return c.flushLocked()
+}
+
+// Flush sends buffered messages and waits until the server has processed them
+func (c *Conn) Flush(ctx context.Context) error {
+	pong := make(chan struct{})
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.closedErr()
+	}
+	c.pongs = append(c.pongs, pong)
+	c.mu.Unlock()
+	if err := c.write("PING\r\n"); err != nil {
+		return err
+	}
+	select {
+	case <-pong:
+		return nil
+	case <-c.done:
+		return c.closedErr()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Subscribe calls fn for each message published to subject, which may contain
+// wildcards. With a queue group, each message goes to one member of the group.
+func (c *Conn) Subscribe(subject, queue string, fn func(*Msg)) error {
+	c.mu.Lock()
+	c.nextSID++
+	sid := c.nextSID
+	c.subs[sid] = fn
+	c.mu.Unlock()
+	if queue != "" {
+		subject += " " + queue
+	}
+	return c.write(fmt.Sprintf("SUB %s %d\r\n", subject, sid))
+}
+
+// Request publishes data to subject and waits for the first reply
+func (c *Conn) Request(ctx context.Context, subject string, data []byte) (*Msg, error) {
+	c.mu.Lock()
+	sub := ""
+	if c.inbox == "" {
+		var b [8]byte
+		rand.Read(b[:])
+		c.inbox = "_INBOX." + hex.EncodeToString(b[:]) + "."
+		c.nextSID++
+		c.subs[c.nextSID] = c.deliverReply
+		sub = fmt.Sprintf("SUB %s* %d\r\n", c.inbox, c.nextSID)
+	}
+	c.nextReq++
+	reply := c.inbox + strconv.Itoa(c.nextReq)
+	ch := make(chan *Msg, 1)
+	c.replies[reply] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.replies, reply)
+		c.mu.Unlock()
+	}()
+
+	if sub != "" {
+		if err := c.write(sub); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.publish(subject, reply, data); err != nil {
+		return nil, err
+	}
+	select {
+	case msg := <-ch:
+		return msg, nil
+	case <-c.done:
+		return nil, c.closedErr()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Conn) deliverReply(m *Msg) {
+	c.mu.Lock()
+	ch := c.replies[m.Subject]
+	c.mu.Unlock()
+	if ch != nil {
+		select {
+		case ch <- m:
+		default:
+		}
+	}
+}
+
+// write sends s along with anything buffered
+func (c *Conn) write(s string) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.w.WriteString(s)
+	return c.flushLocked()
+}
+
+func (c *Conn) flushLocked() error {
+	if err := c.w.Flush(); err != nil {
+		c.fail(err)
+		return c.closedErr()
+	}
+	return nil
+}
+
+// read handles everything the server sends until the connection breaks
+func (c *Conn) read(r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		op, args, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(op) {
+		case "MSG":
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			f := strings.Fields(args)
+			if len(f) != 3 && len(f) != 4 {
+				c.fail(fmt.Errorf("nats: malformed MSG %q", line))
+				return
+			}
+			n, err1 := strconv.Atoi(f[len(f)-1])
+			sid, err2 := strconv.Atoi(f[1])
+			if err1 != nil || err2 != nil || n < 0 {
+				c.fail(fmt.Errorf("nats: malformed MSG %q", line))
+				return
+			}
+			payload := make([]byte, n+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				c.fail(err)
+				return
+			}
+			msg := &Msg{Subject: f[0], Data: payload[:n]}
+			if len(f) == 4 {
+				msg.Reply = f[2]
+			}
+			c.mu.Lock()
+			fn := c.subs[sid]
+			c.mu.Unlock()
+			if fn != nil {
+				fn(msg)
+			}
+		case "PING":
+			if err := c.write("PONG\r\n"); err != nil {
+				return
+			}
+		case "PONG":
+			c.mu.Lock()
+			if len(c.pongs) > 0 {
+				close(c.pongs[0])
+				c.pongs = c.pongs[1:]
+			}
+			c.mu.Unlock()
+		case "-ERR":
+			c.fail(fmt.Errorf("nats: server error: %s", strings.Trim(args, "' ")))
+			return
+		case "+OK", "INFO":
+		default:
+			c.fail(fmt.Errorf("nats: unexpected %q", line))
+			return
+		}
+	}
+}
+
+// fail records the first error and closes the connection
+func (c *Conn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+	c.conn.Close()
+}
+
+func (c *Conn) closedErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if errors.Is(c.err, ErrClosed) {
+		return ErrClosed
+	}
+	return fmt.Errorf("%w: %v", ErrClosed, c.err)
+}
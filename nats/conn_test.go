@@ -0,0 +1,188 @@
+package nats
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer routes PUB to SUB on exact subjects, or on a prefix ending in *
+type fakeServer struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	subs []fakeSub
+}
+
+type fakeSub struct {
+	subject string
+	sid     string
+	w       *bufio.Writer
+	wmu     *sync.Mutex
+}
+
+func startFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	wmu := &sync.Mutex{}
+	send := func(format string, args ...any) {
+		wmu.Lock()
+		fmt.Fprintf(w, format, args...)
+		w.Flush()
+		wmu.Unlock()
+	}
+	send("INFO {\"server_id\":\"fake\"}\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		switch f[0] {
+		case "CONNECT":
+		case "PING":
+			send("PONG\r\n")
+		case "SUB":
+			if f[1] == "forbidden" {
+				send("-ERR 'Permissions Violation for Subscription to \"forbidden\"'\r\n")
+				return
+			}
+			s.mu.Lock()
+			s.subs = append(s.subs, fakeSub{subject: f[1], sid: f[len(f)-1], w: w, wmu: wmu})
+			s.mu.Unlock()
+		case "PUB":
+			n, _ := strconv.Atoi(f[len(f)-1])
+			payload := make([]byte, n+2)
+			io.ReadFull(r, payload)
+			reply := ""
+			if len(f) == 4 {
+				reply = " " + f[2]
+			}
+			s.mu.Lock()
+			for _, sub := range s.subs {
+				prefix, wild := strings.CutSuffix(sub.subject, "*")
+				if sub.subject == f[1] || wild && strings.HasPrefix(f[1], prefix) {
+					sub.wmu.Lock()
+					fmt.Fprintf(sub.w, "MSG %s %s%s %d\r\n%s\r\n", f[1], sub.sid, reply, n, payload[:n])
+					sub.w.Flush()
+					sub.wmu.Unlock()
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	s := startFakeServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub, err := Dial(ctx, s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	got := make(chan *Msg, 10)
+	if err := sub.Subscribe("changes", "", func(m *Msg) { got <- m }); err != nil {
+		t.Fatal(err)
+	}
+	// answer requests with the payload reversed
+	if err := sub.Subscribe("reverse", "workers", func(m *Msg) {
+		b := m.Data
+		for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+			b[i], b[j] = b[j], b[i]
+		}
+		sub.Publish(m.Reply, b)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := Dial(ctx, s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close()
+	for _, data := range []string{"one", "", "two\r\nlines"} {
+		if err := pub.Publish("changes", []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pub.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"one", "", "two\r\nlines"} {
+		select {
+		case m := <-got:
+			if m.Subject != "changes" || string(m.Data) != want {
+				t.Errorf("got %s %q, want %q", m.Subject, m.Data, want)
+			}
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for a message")
+		}
+	}
+
+	for _, in := range []string{"abc", "grapho"} {
+		reply, err := pub.Request(ctx, "reverse", []byte(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[string]string{"abc": "cba", "grapho": "ohparg"}[in]; string(reply.Data) != want {
+			t.Errorf("reply %q, want %q", reply.Data, want)
+		}
+	}
+}
+
+func TestServerError(t *testing.T) {
+	s := startFakeServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Subscribe("forbidden", "", func(*Msg) {})
+	err = c.Flush(ctx)
+	if !errors.Is(err, ErrClosed) || !strings.Contains(err.Error(), "Permissions Violation") {
+		t.Fatalf("got %v", err)
+	}
+	if err := c.Publish("x", nil); err == nil {
+		if err = c.Flush(ctx); !errors.Is(err, ErrClosed) {
+			t.Fatalf("publish after failure: %v", err)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// decoder reads Thrift compact structs as maps from field id to value, enough
+// to check what Write produced
+type decoder struct {
+	b   []byte
+	pos int
+}
+
+func (d *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.b[d.pos:])
+	d.pos += n
+	return v
+}
+
+func (d *decoder) value(typ byte) any {
+	switch typ {
+	case compactTrue:
+		return true
+	case compactFalse:
+		return false
+	case compactI32, compactI64:
+		v, n := binary.Varint(d.b[d.pos:])
+		d.pos += n
+		return v
+	case compactBinary:
+		n := int(d.uvarint())
+		d.pos += n
+		return string(d.b[d.pos-n : d.pos])
+	case compactList:
+		hdr := d.b[d.pos]
+		d.pos++
+		n := int(hdr >> 4)
+		if n == 15 {
+			n = int(d.uvarint())
+		}
+		items := make([]any, n)
+		for i := range items {
+			items[i] = d.value(hdr & 0x0F)
+		}
+		return items
+	case compactStruct:
+		return d.structure()
+	}
+	panic("unexpected type")
+}
+
+func (d *decoder) structure() map[int16]any {
+	s := map[int16]any{}
+	id := int16(0)
+	for {
+		hdr := d.b[d.pos]
+		d.pos++
+		if hdr == 0 {
+			return s
+		}
+		if delta := int16(hdr >> 4); delta != 0 {
+			id += delta
+		} else {
+			v, n := binary.Varint(d.b[d.pos:])
+			d.pos += n
+			id = int16(v)
+		}
+		s[id] = d.value(hdr & 0x0F)
+	}
+}
+
+// footer decodes the file metadata
+func footer(t *testing.T, file []byte) map[int16]any {
+	t.Helper()
+	if !bytes.HasPrefix(file, []byte(magic)) || !bytes.HasSuffix(file, []byte(magic)) {
+		t.Fatal("missing PAR1 magic")
+	}
+	size := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	d := &decoder{b: file[len(file)-8-size : len(file)-8]}
+	meta := d.structure()
+	if d.pos != size {
+		t.Fatalf("footer is %d bytes, decoded %d", size, d.pos)
+	}
+	return meta
+}
+
+// readColumn decodes the data page of a column chunk
+func readColumn(t *testing.T, file []byte, chunk map[int16]any) []any {
+	t.Helper()
+	md := chunk[3].(map[int16]any)
+	d := &decoder{b: file, pos: int(md[9].(int64))}
+	header := d.structure()
+	page := file[d.pos : d.pos+int(header[3].(int64))]
+	n := int(header[5].(map[int16]any)[1].(int64))
+
+	levelsLen := int(binary.LittleEndian.Uint32(page))
+	levels := &decoder{b: page[4 : 4+levelsLen]}
+	if run := levels.uvarint(); run != uint64((n+7)/8)<<1|1 {
+		t.Fatalf("unexpected definition level run %x", run)
+	}
+	bits := levels.b[levels.pos:]
+	values := page[4+levelsLen:]
+
+	var out []any
+	nonNull := 0
+	for i := range n {
+		if bits[i/8]&(1<<(i%8)) == 0 {
+			out = append(out, nil)
+			continue
+		}
+		switch md[1].(int64) {
+		case physicalInt64:
+			out = append(out, int64(binary.LittleEndian.Uint64(values)))
+			values = values[8:]
+		case physicalDouble:
+			out = append(out, math.Float64frombits(binary.LittleEndian.Uint64(values)))
+			values = values[8:]
+		case physicalBoolean:
+			out = append(out, values[nonNull/8]&(1<<(nonNull%8)) != 0)
+		case physicalByteArray:
+			l := binary.LittleEndian.Uint32(values)
+			out = append(out, string(values[4:4+l]))
+			values = values[4+l:]
+		}
+		nonNull++
+	}
+	return out
+}
+
+func TestWrite(t *testing.T) {
+	columns := []Column{{"name", String}, {"age", Int64}, {"score", Double}, {"active", Boolean}}
+	rows := [][]any{
+		{"Ann", int64(31), 1.5, true},
+		{nil, int64(-2), nil, false},
+		{"Zoë", nil, math.Inf(-1), nil},
+		{"", int64(7), 0.0, true},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, columns, rows); err != nil {
+		t.Fatal(err)
+	}
+	file := buf.Bytes()
+	meta := footer(t, file)
+
+	if meta[3] != int64(4) || meta[6] != "grapho" {
+		t.Errorf("num_rows %v, created_by %v", meta[3], meta[6])
+	}
+	schema := meta[2].([]any)
+	if len(schema) != 5 || schema[0].(map[int16]any)[5] != int64(4) {
+		t.Fatalf("schema %v", schema)
+	}
+	for i, c := range columns {
+		el := schema[i+1].(map[int16]any)
+		if el[4] != c.Name || el[1] != int64(physicalType(c.Type)) || el[3] != int64(repetitionOptional) {
+			t.Errorf("schema element %d: %v", i, el)
+		}
+	}
+
+	groups := meta[4].([]any)
+	if len(groups) != 1 {
+		t.Fatalf("%d row groups", len(groups))
+	}
+	chunks := groups[0].(map[int16]any)[1].([]any)
+	for i := range columns {
+		got := readColumn(t, file, chunks[i].(map[int16]any))
+		var want []any
+		for _, row := range rows {
+			want = append(want, row[i])
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("column %s: got %v, want %v", columns[i].Name, got, want)
+		}
+	}
+}
+
+func TestWriteRowGroups(t *testing.T) {
+	rows := make([][]any, RowGroupSize+1)
+	for i := range rows {
+		rows[i] = []any{int64(i)}
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, []Column{{"n", Int64}}, rows); err != nil {
+		t.Fatal(err)
+	}
+	file := buf.Bytes()
+	var sizes []any
+	for _, g := range footer(t, file)[4].([]any) {
+		sizes = append(sizes, g.(map[int16]any)[3])
+	}
+	if !reflect.DeepEqual(sizes, []any{int64(RowGroupSize), int64(1)}) {
+		t.Fatalf("row group sizes %v", sizes)
+	}
+	chunks := footer(t, file)[4].([]any)[1].(map[int16]any)[1].([]any)
+	if got := readColumn(t, file, chunks[0].(map[int16]any)); !reflect.DeepEqual(got, []any{int64(RowGroupSize)}) {
+		t.Errorf("last row group: %v", got)
+	}
+
+	buf.Reset()
+	if err := Write(&buf, []Column{{"n", Int64}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if meta := footer(t, buf.Bytes()); meta[3] != int64(0) {
+		t.Errorf("empty file: %v", meta)
+	}
+}
+
+func TestWriteTypeMismatch(t *testing.T) {
+	err := Write(io.Discard, []Column{{"age", Int64}}, [][]any{{"31"}})
+	if err == nil || !strings.Contains(err.Error(), "column age") {
+		t.Errorf("got %v", err)
+	}
+}
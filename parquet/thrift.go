@@ -0,0 +1,98 @@
+package parquet
+
+import "encoding/binary"
+
+// A minimal Thrift compact protocol encoder, enough for Parquet's page headers
+// and file metadata. Structs are given as their fields in id order.
+
+// compact protocol type codes
+const (
+	compactTrue   = 1
+	compactFalse  = 2
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// tField is one struct field; value is an int32, int64, bool, string, tStruct
+// or tList. A nil value leaves an optional field out.
+type tField struct {
+	id    int16
+	value any
+}
+
+type tStruct []tField
+
+// tList is a list whose elements all have the compact type elem
+type tList struct {
+	elem  byte
+	items []any
+}
+
+func (s tStruct) append(b []byte) []byte {
+	last := int16(0)
+	for _, f := range s {
+		if f.value == nil {
+			continue
+		}
+		typ := typeOf(f.value)
+		if v, ok := f.value.(bool); ok && !v {
+			typ = compactFalse
+		}
+		if delta := f.id - last; delta > 0 && delta <= 15 {
+			b = append(b, byte(delta)<<4|typ)
+		} else {
+			b = append(b, typ)
+			b = binary.AppendVarint(b, int64(f.id))
+		}
+		last = f.id
+		if _, ok := f.value.(bool); !ok {
+			b = appendValue(b, f.value)
+		}
+	}
+	return append(b, 0) // stop
+}
+
+func typeOf(v any) byte {
+	switch v.(type) {
+	case bool:
+		return compactTrue
+	case int32:
+		return compactI32
+	case int64:
+		return compactI64
+	case string:
+		return compactBinary
+	case tList:
+		return compactList
+	}
+	return compactStruct
+}
+
+func appendValue(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case int32:
+		return binary.AppendVarint(b, int64(v))
+	case int64:
+		return binary.AppendVarint(b, v)
+	case string:
+		b = binary.AppendUvarint(b, uint64(len(v)))
+		return append(b, v...)
+	case tList:
+		if len(v.items) < 15 {
+			b = append(b, byte(len(v.items))<<4|v.elem)
+		} else {
+			b = append(b, 0xF0|v.elem)
+			b = binary.AppendUvarint(b, uint64(len(v.items)))
+		}
+		for _, item := range v.items {
+			b = appendValue(b, item)
+		}
+		return b
+	case tStruct:
+		return v.append(b)
+	}
+	panic("parquet: unsupported thrift value")
+}
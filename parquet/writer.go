@@ -0,0 +1,216 @@
+// Package parquet writes tables as Apache Parquet files: uncompressed, PLAIN
+// encoded, with every column optional
+package parquet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Type is a column type
+type Type uint8
+
+const (
+	String Type = iota
+	Int64
+	Double
+	Boolean
+)
+
+func (t Type) String() string {
+	switch t {
+	case Int64:
+		return "int64"
+	case Double:
+		return "double"
+	case Boolean:
+		return "boolean"
+	}
+	return "string"
+}
+
+// Column is a nullable column
+type Column struct {
+	Name string
+	Type Type
+}
+
+// RowGroupSize is the number of rows per row group
+const RowGroupSize = 128 * 1024
+
+const magic = "PAR1"
+
+// enum values from parquet.thrift
+const (
+	physicalBoolean    = 0
+	physicalInt64      = 2
+	physicalDouble     = 5
+	physicalByteArray  = 6
+	repetitionOptional = 1
+	convertedUTF8      = 0
+	encodingPlain      = 0
+	encodingRLE        = 3
+	codecUncompressed  = 0
+	pageData           = 0
+)
+
+// Write writes rows as a Parquet file. Each value must be nil, for a null, or
+// match its column: a string, int64, float64 or bool.
+func Write(w io.Writer, columns []Column, rows [][]any) error {
+	bw := bufio.NewWriter(w)
+	pos := int64(len(magic))
+	bw.WriteString(magic)
+
+	var groups []any
+	for start := 0; start < len(rows); start += RowGroupSize {
+		group := rows[start:min(start+RowGroupSize, len(rows))]
+		var chunks []any
+		var groupSize int64
+		for col, c := range columns {
+			page, err := dataPage(c, col, group)
+			if err != nil {
+				return err
+			}
+			header := tStruct{
+				{1, int32(pageData)},
+				{2, int32(len(page))},
+				{3, int32(len(page))},
+				{5, tStruct{
+					{1, int32(len(group))},
+					{2, int32(encodingPlain)},
+					{3, int32(encodingRLE)},
+					{4, int32(encodingRLE)},
+				}},
+			}.append(nil)
+			size := int64(len(header) + len(page))
+			chunks = append(chunks, tStruct{
+				{2, pos},
+				{3, tStruct{
+					{1, int32(physicalType(c.Type))},
+					{2, tList{compactI32, []any{int32(encodingPlain), int32(encodingRLE)}}},
+					{3, tList{compactBinary, []any{c.Name}}},
+					{4, int32(codecUncompressed)},
+					{5, int64(len(group))},
+					{6, size},
+					{7, size},
+					{9, pos},
+				}},
+			})
+			bw.Write(header)
+			bw.Write(page)
+			pos += size
+			groupSize += size
+		}
+		groups = append(groups, tStruct{
+			{1, tList{compactStruct, chunks}},
+			{2, groupSize},
+			{3, int64(len(group))},
+		})
+	}
+
+	schema := []any{tStruct{{4, "schema"}, {5, int32(len(columns))}}}
+	for _, c := range columns {
+		el := tStruct{
+			{1, int32(physicalType(c.Type))},
+			{3, int32(repetitionOptional)},
+			{4, c.Name},
+		}
+		if c.Type == String {
+			// converted type UTF8 and logical type STRING
+			el = append(el, tField{6, int32(convertedUTF8)}, tField{10, tStruct{{1, tStruct{}}}})
+		}
+		schema = append(schema, el)
+	}
+	meta := tStruct{
+		{1, int32(1)},
+		{2, tList{compactStruct, schema}},
+		{3, int64(len(rows))},
+		{4, tList{compactStruct, groups}},
+		{6, "grapho"},
+	}.append(nil)
+	bw.Write(meta)
+	bw.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(meta))))
+	bw.WriteString(magic)
+	return bw.Flush()
+}
+
+func physicalType(t Type) int {
+	switch t {
+	case Int64:
+		return physicalInt64
+	case Double:
+		return physicalDouble
+	case Boolean:
+		return physicalBoolean
+	}
+	return physicalByteArray
+}
+
+// dataPage encodes column col of rows as a v1 data page: the definition
+// levels, RLE encoded behind their length, then the non-null values PLAIN
+// encoded
+func dataPage(c Column, col int, rows [][]any) ([]byte, error) {
+	// definition levels as one bit-packed run of 8-value groups
+	groups := (len(rows) + 7) / 8
+	levels := binary.AppendUvarint(nil, uint64(groups)<<1|1)
+	levels = append(levels, make([]byte, groups)...)
+	bits := levels[len(levels)-groups:]
+
+	var values []byte
+	var bools []byte
+	nonNull := 0
+	for i, row := range rows {
+		v := row[col]
+		if v == nil {
+			continue
+		}
+		bits[i/8] |= 1 << (i % 8)
+		ok := false
+		switch c.Type {
+		case Int64:
+			var x int64
+			if x, ok = v.(int64); ok {
+				values = binary.LittleEndian.AppendUint64(values, uint64(x))
+			}
+		case Double:
+			var x float64
+			if x, ok = v.(float64); ok {
+				values = binary.LittleEndian.AppendUint64(values, math.Float64bits(x))
+			}
+		case Boolean:
+			var x bool
+			if x, ok = v.(bool); ok {
+				if nonNull%8 == 0 {
+					bools = append(bools, 0)
+				}
+				if x {
+					bools[nonNull/8] |= 1 << (nonNull % 8)
+				}
+			}
+		default:
+			var s string
+			if s, ok = v.(string); ok {
+				values = binary.LittleEndian.AppendUint32(values, uint32(len(s)))
+				values = append(values, s...)
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("column %s: %T value in a %s column", c.Name, v, c.Type)
+		}
+		nonNull++
+	}
+	if c.Type == Boolean {
+		values = bools
+	}
+
+	page := binary.LittleEndian.AppendUint32(nil, uint32(len(levels)))
+	page = append(page, levels...)
+	page = append(page, values...)
+	if len(page) > math.MaxInt32 {
+		return nil, fmt.Errorf("column %s: page larger than 2 GiB", c.Name)
+	}
+	return page, nil
+}
@@ -19,12 +19,15 @@ const (
 	BaseDateTime
 	BaseJSON
 	BaseBlob
+	BaseVector // Dim holds the length
+	BasePoint  // latitude and longitude
 )
 
 type TypeSpec struct {
 	Base     BaseType
 	Elem     *TypeSpec // for array<>
 	EnumVals []string  // for enum<>
+	Dim      int       // for vector<float, N>
 }
 
 type FieldDef struct {
@@ -32,8 +35,10 @@ type FieldDef struct {
 	Type       TypeSpec
 	PrimaryKey bool
 	Unique     bool
+	Index      bool
 	NotNull    bool
 	Default    *Literal
+	TTL        string // TTL 'P30D', an ISO 8601 duration
 	Line, Col  int
 }
 
@@ -76,6 +81,8 @@ const (
 	LitNumber
 	LitBool
 	LitNull
+	LitJSON // an object or array; Text is compact JSON, keys in order
+	LitBlob // bytes; Text is their standard, padded base64
 )
 
 type Literal struct {
@@ -142,12 +149,38 @@ type DropEdgeStmt struct {
 func (*DropEdgeStmt) node()             {}
 func (s *DropEdgeStmt) Pos() (int, int) { return s.Line, s.Col }
 
+// FULLTEXT INDEX statement types
+
+// CreateFulltextIndexStmt represents CREATE FULLTEXT INDEX ON type(fields)
+// [WITH STEMMING]
+type CreateFulltextIndexStmt struct {
+	NodeType  string
+	Fields    []string
+	Stem      bool // WITH STEMMING
+	Line, Col int
+}
+
+func (*CreateFulltextIndexStmt) node()             {}
+func (s *CreateFulltextIndexStmt) Pos() (int, int) { return s.Line, s.Col }
+
+// DropFulltextIndexStmt represents DROP FULLTEXT INDEX ON type(fields)
+type DropFulltextIndexStmt struct {
+	NodeType  string
+	Fields    []string
+	Line, Col int
+}
+
+func (*DropFulltextIndexStmt) node()             {}
+func (s *DropFulltextIndexStmt) Pos() (int, int) { return s.Line, s.Col }
+
 // DML statement types
 
 // Property represents a key-value pair for node/edge properties
 type Property struct {
 	Name      string
 	Value     *Literal
+	Case      *CaseExpr // in a SET, the CASE computing the value instead
+	Calc      ValueExpr // in a SET, the expression computing the value instead
 	Line, Col int
 }
 
@@ -155,9 +188,18 @@ type Property struct {
 type InsertNodeStmt struct {
 	NodeType   string
 	Properties []Property
+	OnConflict *OnConflict // nil fails on a key conflict
 	Line, Col  int
 }
 
+// OnConflict is what an INSERT NODE does instead when the node would share
+// its primary key or a UNIQUE value with another: DO NOTHING, or DO UPDATE
+// that node, with Set or, if empty, the properties the INSERT gives
+type OnConflict struct {
+	Update bool
+	Set    []Property
+}
+
 func (*InsertNodeStmt) node()             {}
 func (s *InsertNodeStmt) Pos() (int, int) { return s.Line, s.Col }
 
@@ -173,6 +215,33 @@ type InsertEdgeStmt struct {
 func (*InsertEdgeStmt) node()             {}
 func (s *InsertEdgeStmt) Pos() (int, int) { return s.Line, s.Col }
 
+// MergeNodeStmt represents MERGE NODE: the nodes whose properties match
+// Properties get the OnMatch assignments, and if there are none a node is
+// inserted with Properties and the OnCreate assignments
+type MergeNodeStmt struct {
+	NodeType          string
+	Properties        []Property
+	OnCreate, OnMatch []Property // ON CREATE SET and ON MATCH SET
+	Line, Col         int
+}
+
+func (*MergeNodeStmt) node()             {}
+func (s *MergeNodeStmt) Pos() (int, int) { return s.Line, s.Col }
+
+// MergeEdgeStmt represents MERGE EDGE, which does the same for the edges
+// between two nodes
+type MergeEdgeStmt struct {
+	EdgeType          string
+	FromNode          *NodeRef
+	ToNode            *NodeRef
+	Properties        []Property
+	OnCreate, OnMatch []Property // ON CREATE SET and ON MATCH SET
+	Line, Col         int
+}
+
+func (*MergeEdgeStmt) node()             {}
+func (s *MergeEdgeStmt) Pos() (int, int) { return s.Line, s.Col }
+
 // NodeRef represents a reference to a node (by ID or property match)
 type NodeRef struct {
 	NodeType   string
@@ -185,7 +254,9 @@ type NodeRef struct {
 type UpdateNodeStmt struct {
 	NodeType   string
 	Where      []Property // WHERE conditions
+	Filter     Expr       // further WHERE conditions, ANDed with Where
 	Set        []Property // SET assignments
+	Returning  []string   // RETURNING fields, ["*"] for all of them; nil without RETURNING
 	Line, Col  int
 }
 
@@ -196,7 +267,9 @@ func (s *UpdateNodeStmt) Pos() (int, int) { return s.Line, s.Col }
 type UpdateEdgeStmt struct {
 	EdgeType   string
 	Where      []Property // WHERE conditions
+	Filter     Expr       // further WHERE conditions, ANDed with Where
 	Set        []Property // SET assignments
+	Returning  []string   // RETURNING fields, ["*"] for all of them; nil without RETURNING
 	Line, Col  int
 }
 
@@ -207,6 +280,8 @@ func (s *UpdateEdgeStmt) Pos() (int, int) { return s.Line, s.Col }
 type DeleteNodeStmt struct {
 	NodeType   string
 	Where      []Property // WHERE conditions
+	Filter     Expr       // further WHERE conditions, ANDed with Where
+	Returning  []string   // RETURNING fields, as in UpdateNodeStmt
 	Line, Col  int
 }
 
@@ -216,7 +291,11 @@ func (s *DeleteNodeStmt) Pos() (int, int) { return s.Line, s.Col }
 // DeleteEdgeStmt represents DELETE EDGE statement
 type DeleteEdgeStmt struct {
 	EdgeType   string
+	FromNode   *NodeRef   // nil, or the node the edges must start at
+	ToNode     *NodeRef   // nil, or the node the edges must end at
 	Where      []Property // WHERE conditions
+	Filter     Expr       // further WHERE conditions, ANDed with Where
+	Returning  []string   // RETURNING fields, as in UpdateNodeStmt
 	Line, Col  int
 }
 
@@ -225,20 +304,310 @@ func (s *DeleteEdgeStmt) Pos() (int, int) { return s.Line, s.Col }
 
 // MatchStmt represents MATCH statement for querying
 type MatchStmt struct {
-	Pattern    []MatchElement
-	Where      []Property // Optional WHERE conditions
-	Return     []string   // RETURN fields
+	Pattern    []MatchElement // MATCH Type alias, ...: each type matched on its own
+	Paths      []PathPattern  // MATCH (a:Type)-[e:EDGE]->(b), ...: joined
+	Where      []Property     // Optional WHERE conditions
+	Filter     Expr           // further WHERE conditions, ANDed with Where
+	Search     []TextMatch    // MATCHES(...) conditions in WHERE
+	Within     []GeoWithin    // WITHIN(...) conditions in WHERE
+	Return     []string       // RETURN items: field, alias or alias.field
+	Cases      []*CaseExpr    // nil, or per RETURN item its CASE, named by AS
+	Distinct   bool           // RETURN DISTINCT: drop repeated rows
+	OrderBy    *VectorOrder   // Optional ORDER BY
+	Limit      *Literal       // Optional LIMIT
+	Set        []Property     // MATCH ... SET alias.field: value, ... on a path
+	Delete     []string       // MATCH ... DELETE alias, ... on a path
+	With       *WithStage     // MATCH ... WITH a, ... MATCH ...: the next stage
 	Line, Col  int
 }
 
 func (*MatchStmt) node()             {}
 func (s *MatchStmt) Pos() (int, int) { return s.Line, s.Col }
 
+// WithStage is the WITH of a path MATCH: the variables it carries, each
+// combination once and at most Limit of them, into the MATCH that follows
+type WithStage struct {
+	Vars      []string
+	Limit     *Literal // Optional LIMIT
+	Next      *MatchStmt
+	Line, Col int
+}
+
 // MatchElement represents a node or edge pattern in MATCH
 type MatchElement struct {
-	Type       string     // Node or edge type
-	Alias      string     // Optional alias
-	Properties []Property // Property constraints
-	IsEdge     bool       // true for edges, false for nodes
+	Type       string        // Node or edge type; "" for any
+	Alias      string        // Optional alias
+	Properties []Property    // Property constraints
+	IsEdge     bool          // true for edges, false for nodes
+	Direction  EdgeDirection // for edges
+	Hops       *HopRange     // for variable-length edges; nil for one edge
 	Line, Col  int
 }
+
+// HopRange is the *min..max of a variable-length edge pattern
+type HopRange struct {
+	Min int
+	Max int // -1 for no limit
+}
+
+// PathPattern is a chain of node and edge patterns: its elements alternate
+// node, edge, node, ..., starting and ending with a node
+type PathPattern struct {
+	Name     string // p in MATCH p = (a)-[]->(b); "" for none
+	Elements []MatchElement
+}
+
+// EdgeDirection is the way an edge pattern points
+type EdgeDirection int
+
+const (
+	DirOut  EdgeDirection = iota // (a)-[]->(b): from a to b
+	DirIn                        // (a)<-[]-(b): from b to a
+	DirBoth                      // (a)-[]-(b): either way
+)
+
+// Expr is a condition of a WHERE clause: a *Property, holding when the field
+// equals the value, an *InExpr, *BetweenExpr, *CompareExpr, *StringMatch or
+// *ExistsExpr, or a *LogicalExpr or *NotExpr combining others. The
+// parser puts the name: value conditions a WHERE ANDs together in the Where
+// of its statement, where the executor can look nodes up by them, and only
+// the rest in Filter. MATCHES and WITHIN are conditions too, but only ever
+// ANDed with the others, and go to Search and Within.
+type Expr interface {
+	Node
+	expr()
+}
+
+func (*Property) expr()    {}
+func (*LogicalExpr) expr() {}
+func (*NotExpr) expr()     {}
+func (*InExpr) expr()      {}
+func (*BetweenExpr) expr() {}
+func (*CompareExpr) expr() {}
+func (*StringMatch) expr() {}
+func (*ExistsExpr) expr()  {}
+func (*TextMatch) expr()   {}
+func (*GeoWithin) expr()   {}
+
+// LogicalOp is the operator of a LogicalExpr
+type LogicalOp int
+
+const (
+	And LogicalOp = iota
+	Or
+)
+
+// LogicalExpr represents Left AND Right or Left OR Right
+type LogicalExpr struct {
+	Op          LogicalOp
+	Left, Right Expr
+	Line, Col   int
+}
+
+// NotExpr represents NOT X
+type NotExpr struct {
+	X         Expr
+	Line, Col int
+}
+
+// InExpr represents field IN (v, ...), which holds when the field equals one
+// of the values
+type InExpr struct {
+	Field     string
+	Values    []*Literal
+	Line, Col int
+}
+
+// BetweenExpr represents field BETWEEN low AND high, which holds when the
+// field lies between the two, both included
+type BetweenExpr struct {
+	Field     string
+	Low, High *Literal
+	Line, Col int
+}
+
+// CompareOp is the operator of a CompareExpr
+type CompareOp int
+
+const (
+	Less      CompareOp = iota // field < v
+	LessEq                     // field <= v
+	Greater                    // field > v
+	GreaterEq                  // field >= v
+)
+
+// CompareExpr represents field < v, <=, > or >=, where v is Value or, in a
+// MATCH, Time
+type CompareExpr struct {
+	Field     string
+	Op        CompareOp
+	Value     *Literal
+	Time      *TimeExpr
+	Line, Col int
+}
+
+// TimeExpr represents now() or date(), the current datetime or date, with
+// durations such as duration('P7D') added to or subtracted from it
+type TimeExpr struct {
+	Func      string // "now" or "date"
+	Shifts    []Shift
+	Line, Col int
+}
+
+// Shift is a + duration('...') or - duration('...') of a TimeExpr. The
+// duration is in ISO 8601, as P1Y2M3W4DT5H6M7S.
+type Shift struct {
+	Neg      bool
+	Duration *Literal
+}
+
+// StringOp is how a StringMatch compares a field with its pattern
+type StringOp int
+
+const (
+	StartsWith StringOp = iota // field STARTS WITH 'prefix'
+	EndsWith                   // field ENDS WITH 'suffix'
+	Contains                   // field CONTAINS 'text'
+	RegexMatch                 // field =~ 'regex', matching the whole value
+)
+
+// StringMatch represents a comparison of a string field with Pattern
+type StringMatch struct {
+	Field     string
+	Op        StringOp
+	Pattern   *Literal
+	Line, Col int
+}
+
+// ExistsExpr represents EXISTS (MATCH ...), which holds when the path MATCH
+// has a row. Its variables named like an alias of the enclosing MATCH stand
+// for the node or edge the alias is bound to.
+type ExistsExpr struct {
+	Match     *MatchStmt
+	Line, Col int
+}
+
+// CaseExpr represents CASE WHEN cond THEN value ... [ELSE value] END, whose
+// value is that of the first WHEN whose condition holds, else Else
+type CaseExpr struct {
+	Whens     []CaseWhen
+	Else      *Literal // nil for null
+	Line, Col int
+}
+
+// CaseWhen is a WHEN cond THEN value of a CaseExpr
+type CaseWhen struct {
+	Cond Expr
+	Then *Literal
+}
+
+// ValueExpr is an expression a SET computes a value with from the fields
+// being set: a *Literal, *FieldRef, *ArithExpr or *FuncCall
+type ValueExpr interface {
+	Node
+	valueExpr()
+}
+
+func (*Literal) valueExpr()   {}
+func (*FieldRef) valueExpr()  {}
+func (*ArithExpr) valueExpr() {}
+func (*FuncCall) valueExpr()  {}
+
+// FieldRef is the current value of a field, named as alias.field in a MATCH
+type FieldRef struct {
+	Name      string
+	Line, Col int
+}
+
+// ArithExpr represents Left Op Right, where Op is one of + - * /
+type ArithExpr struct {
+	Op          string
+	Left, Right ValueExpr
+	Line, Col   int
+}
+
+// FuncCall represents a call of a function, as in upper(name)
+type FuncCall struct {
+	Name      string // in lower case
+	Args      []ValueExpr
+	Line, Col int
+}
+
+// VectorMetric is how ORDER BY compares a vector field with a query vector
+type VectorMetric int
+
+const (
+	Cosine VectorMetric = iota // SIMILARITY(field, v): most similar first
+	L2                         // DISTANCE(field, v): nearest first
+)
+
+// VectorOrder represents ORDER BY SIMILARITY(field, v) or DISTANCE(field, v)
+type VectorOrder struct {
+	Metric    VectorMetric
+	Field     string   // field, or alias.field
+	Vector    *Literal // the query vector, e.g. '[0.1, 0.2, 0.3]'
+	Line, Col int
+}
+
+// TextMatch represents MATCHES(field, 'words') in a WHERE clause, which holds
+// for nodes whose field contains every one of the words
+type TextMatch struct {
+	Field     string
+	Query     *Literal
+	Line, Col int
+}
+
+// GeoWithin represents WITHIN(field, 'lat, lon', radius) in a WHERE clause,
+// which holds for nodes whose point field lies within radius of the centre
+type GeoWithin struct {
+	Field     string
+	Center    *Literal // 'latitude, longitude'
+	Radius    *Literal
+	Unit      string // m, km or mi; "" for metres
+	Line, Col int
+}
+
+// ExportStmt represents EXPORT [MATCH ... | NODE type] TO 'path'; the path's
+// extension picks the format
+type ExportStmt struct {
+	Match     *MatchStmt // nil exports the whole graph
+	NodeType  string     // set by EXPORT NODE: the nodes of one type, no edges
+	Path      string
+	Line, Col int
+}
+
+func (*ExportStmt) node()             {}
+func (s *ExportStmt) Pos() (int, int) { return s.Line, s.Col }
+
+// ShowStatsStmt represents SHOW STATS [type], which reports the statistics the
+// planner works from
+type ShowStatsStmt struct {
+	Type      string // "" for every type
+	Line, Col int
+}
+
+func (*ShowStatsStmt) node()             {}
+func (s *ShowStatsStmt) Pos() (int, int) { return s.Line, s.Col }
+
+// VacuumStmt represents VACUUM [type], which reclaims the space deleted nodes
+// and edges still take
+type VacuumStmt struct {
+	Type      string // "" for every type
+	Line, Col int
+}
+
+func (*VacuumStmt) node()             {}
+func (s *VacuumStmt) Pos() (int, int) { return s.Line, s.Col }
+
+// BackupStmt represents BACKUP TO 'path' [SINCE n], which archives the
+// catalog, the graph and the commit log while writes go on, or with SINCE
+// only the commit log entries after the first n. It must be the only
+// statement of its script.
+type BackupStmt struct {
+	Path      string
+	Since     *Literal // Optional SINCE
+	Line, Col int
+}
+
+func (*BackupStmt) node()             {}
+func (s *BackupStmt) Pos() (int, int) { return s.Line, s.Col }
@@ -0,0 +1,128 @@
+package parser
+
+import "strconv"
+
+// Builders for constructing statements in code. Pair them with Format to get
+// statement text that parses back to the same AST:
+//
+//	stmt := parser.InsertNode("Person", parser.Prop("name", parser.Str("O'Neil")))
+//	text, err := parser.Format(stmt) // INSERT NODE Person (name: 'O''Neil');
+
+// Str returns a string literal
+func Str(s string) *Literal { return &Literal{Kind: LitString, Text: s} }
+
+// Int returns a number literal. The language has no negative literals, so
+// Format rejects n < 0.
+func Int(n int64) *Literal { return &Literal{Kind: LitNumber, Text: strconv.FormatInt(n, 10)} }
+
+// Float returns a number literal; as with Int, f must not be negative
+func Float(f float64) *Literal {
+	return &Literal{Kind: LitNumber, Text: strconv.FormatFloat(f, 'f', -1, 64)}
+}
+
+// Bool returns a boolean literal
+func Bool(b bool) *Literal { return &Literal{Kind: LitBool, Text: strconv.FormatBool(b)} }
+
+// Null returns the null literal
+func Null() *Literal { return &Literal{Kind: LitNull, Text: "null"} }
+
+// Prop pairs a property name with a value, for property lists, SET and WHERE
+func Prop(name string, v *Literal) Property { return Property{Name: name, Value: v} }
+
+// Type returns a scalar type
+func Type(base BaseType) TypeSpec { return TypeSpec{Base: base} }
+
+// ArrayOf returns an array<elem> type
+func ArrayOf(elem TypeSpec) TypeSpec { return TypeSpec{Base: BaseString, Elem: &elem} }
+
+// EnumOf returns an enum<...> type
+func EnumOf(vals ...string) TypeSpec { return TypeSpec{Base: BaseString, EnumVals: vals} }
+
+// VectorOf returns a vector<float, dim> type
+func VectorOf(dim int) TypeSpec { return TypeSpec{Base: BaseVector, Dim: dim} }
+
+// Field returns a field definition; set PrimaryKey, Unique, NotNull or Default
+// on the result as needed
+func Field(name string, t TypeSpec) FieldDef { return FieldDef{Name: name, Type: t} }
+
+// CreateNode builds CREATE NODE name (fields...)
+func CreateNode(name string, fields ...FieldDef) *CreateNodeStmt {
+	return &CreateNodeStmt{Name: name, Fields: fields}
+}
+
+// One and Many build edge endpoints
+func One(label string) Endpoint  { return Endpoint{Label: label, Card: CardOne} }
+func Many(label string) Endpoint { return Endpoint{Label: label, Card: CardMany} }
+
+// CreateEdge builds CREATE EDGE name (FROM from, TO to, PROPS (props...))
+func CreateEdge(name string, from, to Endpoint, props ...FieldDef) *CreateEdgeStmt {
+	return &CreateEdgeStmt{Name: name, From: from, To: to, Props: props}
+}
+
+// DropNode builds DROP NODE name
+func DropNode(name string) *DropNodeStmt { return &DropNodeStmt{Name: name} }
+
+// DropEdge builds DROP EDGE name
+func DropEdge(name string) *DropEdgeStmt { return &DropEdgeStmt{Name: name} }
+
+// InsertNode builds INSERT NODE nodeType (props...)
+func InsertNode(nodeType string, props ...Property) *InsertNodeStmt {
+	return &InsertNodeStmt{NodeType: nodeType, Properties: props}
+}
+
+// NodeByID references a node by its ID
+func NodeByID(nodeType string, id *Literal) *NodeRef {
+	return &NodeRef{NodeType: nodeType, ID: id}
+}
+
+// NodeWhere references the first node matching props
+func NodeWhere(nodeType string, props ...Property) *NodeRef {
+	return &NodeRef{NodeType: nodeType, Properties: props}
+}
+
+// InsertEdge builds INSERT EDGE edgeType FROM from TO to (props...)
+func InsertEdge(edgeType string, from, to *NodeRef, props ...Property) *InsertEdgeStmt {
+	return &InsertEdgeStmt{EdgeType: edgeType, FromNode: from, ToNode: to, Properties: props}
+}
+
+// MergeNode builds MERGE NODE nodeType (props...); set OnCreate and OnMatch
+// for its SET clauses
+func MergeNode(nodeType string, props ...Property) *MergeNodeStmt {
+	return &MergeNodeStmt{NodeType: nodeType, Properties: props}
+}
+
+// MergeEdge builds MERGE EDGE edgeType FROM from TO to (props...)
+func MergeEdge(edgeType string, from, to *NodeRef, props ...Property) *MergeEdgeStmt {
+	return &MergeEdgeStmt{EdgeType: edgeType, FromNode: from, ToNode: to, Properties: props}
+}
+
+// UpdateNode builds UPDATE NODE nodeType SET set... WHERE where...
+func UpdateNode(nodeType string, set []Property, where ...Property) *UpdateNodeStmt {
+	return &UpdateNodeStmt{NodeType: nodeType, Set: set, Where: where}
+}
+
+// UpdateEdge builds UPDATE EDGE edgeType SET set... WHERE where...
+func UpdateEdge(edgeType string, set []Property, where ...Property) *UpdateEdgeStmt {
+	return &UpdateEdgeStmt{EdgeType: edgeType, Set: set, Where: where}
+}
+
+// DeleteNode builds DELETE NODE nodeType WHERE where...
+func DeleteNode(nodeType string, where ...Property) *DeleteNodeStmt {
+	return &DeleteNodeStmt{NodeType: nodeType, Where: where}
+}
+
+// DeleteEdge builds DELETE EDGE edgeType WHERE where...
+func DeleteEdge(edgeType string, where ...Property) *DeleteEdgeStmt {
+	return &DeleteEdgeStmt{EdgeType: edgeType, Where: where}
+}
+
+// DeleteEdgeBetween builds DELETE EDGE edgeType FROM from TO to, with
+// WHERE where... if any are given
+func DeleteEdgeBetween(edgeType string, from, to *NodeRef, where ...Property) *DeleteEdgeStmt {
+	return &DeleteEdgeStmt{EdgeType: edgeType, FromNode: from, ToNode: to, Where: where}
+}
+
+// Match builds MATCH nodeType WHERE where...; set Return for a RETURN list
+func Match(nodeType string, where ...Property) *MatchStmt {
+	return &MatchStmt{Pattern: []MatchElement{{Type: nodeType}}, Where: where}
+}
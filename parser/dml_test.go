@@ -2,7 +2,10 @@ package parser
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestInsertNodeParsing(t *testing.T) {
@@ -242,6 +245,16 @@ func TestMatchParsing(t *testing.T) {
 			input:   "MATCH User WHERE age: 25 RETURN name, email;",
 			wantErr: false,
 		},
+		{
+			name:    "match returning alias fields",
+			input:   "MATCH User u RETURN u.name, u;",
+			wantErr: false,
+		},
+		{
+			name:    "return item cut short",
+			input:   "MATCH User u RETURN u.;",
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -279,6 +292,615 @@ func TestMatchParsing(t *testing.T) {
 	}
 }
 
+func TestMatchPathParsing(t *testing.T) {
+	stmts, errs := NewParser("MATCH (p:Person {name: 'Ann'})-[w:WORKS_AT]->(c:Company)<-[:OWNS]-(o), (c)-[]-(x);").ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	stmt := stmts[0].(*MatchStmt)
+	if len(stmt.Pattern) != 0 || len(stmt.Paths) != 2 {
+		t.Fatalf("expected 2 paths and no pattern, got %+v", stmt)
+	}
+	els := stmt.Paths[0].Elements
+	if len(els) != 5 {
+		t.Fatalf("expected 5 elements, got %d", len(els))
+	}
+	if els[0].Alias != "p" || els[0].Type != "Person" || len(els[0].Properties) != 1 || els[0].IsEdge {
+		t.Errorf("first node: %+v", els[0])
+	}
+	if !els[1].IsEdge || els[1].Alias != "w" || els[1].Type != "WORKS_AT" || els[1].Direction != DirOut {
+		t.Errorf("first edge: %+v", els[1])
+	}
+	if els[3].Alias != "" || els[3].Type != "OWNS" || els[3].Direction != DirIn {
+		t.Errorf("second edge: %+v", els[3])
+	}
+	if e := stmt.Paths[1].Elements[1]; e.Type != "" || e.Direction != DirBoth {
+		t.Errorf("undirected edge: %+v", e)
+	}
+
+	hops := map[string]HopRange{
+		"MATCH (a)-[:KNOWS*1..3]->(b);": {1, 3},
+		"MATCH (a)-[*]->(b);":           {1, -1},
+		"MATCH (a)-[k*2]-(b);":          {2, 2},
+		"MATCH (a)-[*..4]->(b);":        {1, 4},
+		"MATCH (a)<-[*0..]-(b);":        {0, -1},
+	}
+	for q, want := range hops {
+		stmts, errs := NewParser(q).ParseScript()
+		if len(errs) > 0 {
+			t.Errorf("%s: %v", q, errs)
+			continue
+		}
+		if h := stmts[0].(*MatchStmt).Paths[0].Elements[1].Hops; h == nil || *h != want {
+			t.Errorf("%s: got %+v, want %+v", q, h, want)
+		}
+	}
+
+	for _, bad := range []string{
+		"MATCH (a)-[*3..1]->(b);",
+		"MATCH (a)-[*1.5]->(b);",
+		"MATCH (a*2)-[]->(b);",
+		"MATCH (a)<-[e]->(b);",
+		"MATCH (a)-[e]>(b);",
+		"MATCH (a)-(b);",
+		"MATCH (a:Person {name: 'x'}-[e]->(b);",
+	} {
+		if _, errs := NewParser(bad).ParseScript(); len(errs) == 0 {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestBooleanWhereParsing(t *testing.T) {
+	stmts, errs := NewParser("MATCH User WHERE a: 1 OR b: 2 AND NOT c: 3, d: 4, (e: 5 OR f: 6) AND g: 7;").ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	stmt := stmts[0].(*MatchStmt)
+	// plain conditions ANDed at the top stay in Where
+	if len(stmt.Where) != 2 || stmt.Where[0].Name != "d" || stmt.Where[1].Name != "g" {
+		t.Fatalf("where: %+v", stmt.Where)
+	}
+	and, ok := stmt.Filter.(*LogicalExpr)
+	if !ok || and.Op != And {
+		t.Fatalf("filter: %#v", stmt.Filter)
+	}
+	or, ok := and.Left.(*LogicalExpr)
+	if !ok || or.Op != Or || or.Left.(*Property).Name != "a" {
+		t.Fatalf("AND binds tighter than OR: %#v", and.Left)
+	}
+	if inner := or.Right.(*LogicalExpr); inner.Op != And {
+		t.Errorf("b AND NOT c: %#v", inner)
+	} else if not, ok := inner.Right.(*NotExpr); !ok || not.X.(*Property).Name != "c" {
+		t.Errorf("NOT c: %#v", inner.Right)
+	}
+	if grouped := and.Right.(*LogicalExpr); grouped.Op != Or {
+		t.Errorf("parenthesized OR: %#v", grouped)
+	}
+
+	// fields may be called and or or
+	if _, errs := NewParser("DELETE NODE User WHERE and: 1 OR or: 2;").ParseScript(); len(errs) > 0 {
+		t.Errorf("fields named and, or: %v", errs)
+	}
+
+	for _, bad := range []string{
+		"MATCH User WHERE a: 1 OR MATCHES(body, 'x');",
+		"MATCH User WHERE NOT WITHIN(loc, '0, 0', 5);",
+		"UPDATE NODE User SET a: 1 WHERE MATCHES(body, 'x');",
+		"MATCH User WHERE (a: 1 OR b: 2;",
+		"MATCH User WHERE a: 1 AND;",
+		"DELETE NODE User WHERE NOT;",
+	} {
+		if _, errs := NewParser(bad).ParseScript(); len(errs) == 0 {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestInBetweenParsing(t *testing.T) {
+	stmts, errs := NewParser("MATCH User WHERE city IN ('Oslo', 'Rome'), age BETWEEN 18 AND 30 AND in: 1;").ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	stmt := stmts[0].(*MatchStmt)
+	if len(stmt.Where) != 1 || stmt.Where[0].Name != "in" {
+		t.Fatalf("where: %+v", stmt.Where)
+	}
+	and := stmt.Filter.(*LogicalExpr)
+	in, ok := and.Left.(*InExpr)
+	if !ok || in.Field != "city" || len(in.Values) != 2 || in.Values[1].Text != "Rome" {
+		t.Errorf("IN: %#v", and.Left)
+	}
+	// the AND of BETWEEN is not a logical AND
+	b, ok := and.Right.(*BetweenExpr)
+	if !ok || b.Field != "age" || b.Low.Text != "18" || b.High.Text != "30" {
+		t.Errorf("BETWEEN: %#v", and.Right)
+	}
+
+	for _, bad := range []string{
+		"MATCH User WHERE city IN ();",
+		"MATCH User WHERE city IN 'Oslo';",
+		"MATCH User WHERE age BETWEEN 18;",
+		"MATCH User WHERE age BETWEEN 18 OR 30;",
+	} {
+		if _, errs := NewParser(bad).ParseScript(); len(errs) == 0 {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestStringMatchParsing(t *testing.T) {
+	ops := map[string]StringOp{
+		"MATCH User WHERE name STARTS WITH 'An';":   StartsWith,
+		"MATCH User WHERE name ends with 'n';":      EndsWith,
+		"DELETE NODE User WHERE name CONTAINS 'n';": Contains,
+		"MATCH User WHERE name =~ 'A.*';":           RegexMatch,
+	}
+	for q, want := range ops {
+		stmts, errs := NewParser(q).ParseScript()
+		if len(errs) > 0 {
+			t.Errorf("%s: %v", q, errs)
+			continue
+		}
+		var filter Expr
+		switch s := stmts[0].(type) {
+		case *MatchStmt:
+			filter = s.Filter
+		case *DeleteNodeStmt:
+			filter = s.Filter
+		}
+		if m, ok := filter.(*StringMatch); !ok || m.Op != want || m.Field != "name" {
+			t.Errorf("%s: got %#v", q, filter)
+		}
+	}
+
+	for _, bad := range []string{
+		"MATCH User WHERE name STARTS 'A';",
+		"MATCH User WHERE name CONTAINS 1;",
+		"MATCH User WHERE name =~ '(';",
+		"MATCH User WHERE name = 'A';",
+	} {
+		if _, errs := NewParser(bad).ParseScript(); len(errs) == 0 {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestReturnDistinctParsing(t *testing.T) {
+	for q, want := range map[string]string{
+		"MATCH User RETURN DISTINCT name, age;":                              "true name,age",
+		"MATCH User RETURN distinct;":                                        "false distinct",
+		"MATCH User RETURN distinct, name;":                                  "false distinct,name",
+		"MATCH User RETURN DISTINCT distinct;":                               "true distinct",
+		"MATCH User RETURN distinct LIMIT 2;":                                "false distinct",
+		"MATCH (distinct) RETURN distinct.name;":                             "false distinct.name",
+		"MATCH (a)-[]->(b) RETURN DISTINCT b ORDER BY SIMILARITY(v, '[1]');": "true b",
+	} {
+		stmts, errs := NewParser(q).ParseScript()
+		if len(errs) > 0 {
+			t.Errorf("%s: %v", q, errs)
+			continue
+		}
+		stmt := stmts[0].(*MatchStmt)
+		if got := fmt.Sprintf("%v %s", stmt.Distinct, strings.Join(stmt.Return, ",")); got != want {
+			t.Errorf("%s: got %s, want %s", q, got, want)
+		}
+	}
+}
+
+func TestAliasedConditionParsing(t *testing.T) {
+	stmts, errs := NewParser("MATCH Person p WHERE p.name: 'Alice', age: 3 OR p.age IN (4) RETURN p.email;").ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	stmt := stmts[0].(*MatchStmt)
+	if len(stmt.Where) != 1 || stmt.Where[0].Name != "p.name" {
+		t.Errorf("where: %+v", stmt.Where)
+	}
+	if or := stmt.Filter.(*LogicalExpr); or.Right.(*InExpr).Field != "p.age" {
+		t.Errorf("filter: %#v", or.Right)
+	}
+
+	// outside a MATCH a dotted name is a path into a json field
+	stmts, errs = NewParser("DELETE NODE Person WHERE meta.address.city: 'Bern';").ParseScript()
+	if len(errs) > 0 || stmts[0].(*DeleteNodeStmt).Where[0].Name != "meta.address.city" {
+		t.Errorf("json path: %v %+v", errs, stmts)
+	}
+
+	for _, bad := range []string{
+		"DELETE NODE Person WHERE meta.: 'Bern';",
+		"MATCH Person p WHERE p.: 'Alice';",
+	} {
+		if _, errs := NewParser(bad).ParseScript(); len(errs) == 0 {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestExistsParsing(t *testing.T) {
+	stmts, errs := NewParser("MATCH Person p WHERE NOT EXISTS (MATCH (p)-[:WORKS_AT]->(c:Company) WHERE c.name: 'Acme'), age: 3;").ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	stmt := stmts[0].(*MatchStmt)
+	if len(stmt.Where) != 1 || stmt.Where[0].Name != "age" {
+		t.Errorf("where: %+v", stmt.Where)
+	}
+	ex, ok := stmt.Filter.(*NotExpr).X.(*ExistsExpr)
+	if !ok {
+		t.Fatalf("filter: %#v", stmt.Filter)
+	}
+	if len(ex.Match.Paths) != 1 || len(ex.Match.Where) != 1 || ex.Match.Where[0].Name != "c.name" {
+		t.Errorf("subquery: %+v", ex.Match)
+	}
+
+	// a field called exists is still a field
+	stmts, errs = NewParser("MATCH Person WHERE exists: true;").ParseScript()
+	if len(errs) > 0 || stmts[0].(*MatchStmt).Where[0].Name != "exists" {
+		t.Errorf("exists field: %v", errs)
+	}
+
+	for _, bad := range []string{
+		"MATCH Person p WHERE EXISTS (MATCH Company);",
+		"MATCH Person p WHERE EXISTS (MATCH (p)-[:WORKS_AT]->() RETURN p);",
+		"MATCH Person p WHERE EXISTS (MATCH (p)-[:WORKS_AT]->() LIMIT 1);",
+		"MATCH Person p WHERE EXISTS (MATCH (p)-[:WORKS_AT]->();",
+		"UPDATE NODE Person SET age: 1 WHERE EXISTS (MATCH (p)-[:WORKS_AT]->());",
+	} {
+		if _, errs := NewParser(bad).ParseScript(); len(errs) == 0 {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestCaseParsing(t *testing.T) {
+	stmts, errs := NewParser(`
+		MATCH Person p RETURN p.name, CASE WHEN p.age BETWEEN 0 AND 17 THEN 'minor' WHEN p.age: null THEN null ELSE 'adult' END AS band, case;
+		UPDATE NODE Person SET band: CASE WHEN age IN (1, 2) OR name: 'Ann' THEN 'small' END, seen: true WHERE name: 'Ann';
+	`).ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	m := stmts[0].(*MatchStmt)
+	if strings.Join(m.Return, " ") != "p.name band case" || len(m.Cases) != 3 || m.Cases[0] != nil || m.Cases[2] != nil {
+		t.Fatalf("return: %v %v", m.Return, m.Cases)
+	}
+	c := m.Cases[1]
+	if len(c.Whens) != 2 || c.Else == nil || c.Else.Text != "adult" {
+		t.Errorf("case: %+v", c)
+	}
+	if b, ok := c.Whens[0].Cond.(*BetweenExpr); !ok || b.Field != "p.age" || c.Whens[0].Then.Text != "minor" {
+		t.Errorf("first WHEN: %#v", c.Whens[0])
+	}
+	u := stmts[1].(*UpdateNodeStmt)
+	if len(u.Set) != 2 || u.Set[0].Case == nil || u.Set[0].Value != nil || u.Set[0].Case.Else != nil || u.Set[1].Value == nil {
+		t.Errorf("set: %+v", u.Set)
+	}
+
+	for _, bad := range []string{
+		"MATCH Person RETURN CASE WHEN age: 1 THEN 'a' END;",
+		"MATCH Person RETURN CASE WHEN age: 1 THEN 'a' AS band;",
+		"MATCH Person RETURN CASE WHEN age: 1 'a' END AS band;",
+		"MATCH Person RETURN CASE WHEN MATCHES(bio, 'go') THEN 'a' END AS band;",
+		"UPDATE NODE Person SET band: CASE ELSE 'a' END WHERE age: 1;",
+	} {
+		if _, errs := NewParser(bad).ParseScript(); len(errs) == 0 {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestComparisonParsing(t *testing.T) {
+	stmts, errs := NewParser(`
+		MATCH Event e WHERE e.at >= now() - duration('P7D') AND e.day < date() + duration('P1M') - duration('PT12H'), e.n <= 3;
+		DELETE NODE Event WHERE at > '2024-01-01';
+	`).ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	m := stmts[0].(*MatchStmt)
+	and, ok := m.Filter.(*LogicalExpr)
+	if !ok {
+		t.Fatalf("filter: %#v", m.Filter)
+	}
+	inner := and.Left.(*LogicalExpr)
+	at, ok := inner.Left.(*CompareExpr)
+	if !ok || at.Field != "e.at" || at.Op != GreaterEq || at.Time == nil || at.Time.Func != "now" || len(at.Time.Shifts) != 1 || !at.Time.Shifts[0].Neg {
+		t.Errorf("first comparison: %#v", inner.Left)
+	}
+	day := inner.Right.(*CompareExpr)
+	if day.Op != Less || day.Time.Func != "date" || len(day.Time.Shifts) != 2 || day.Time.Shifts[0].Neg || day.Time.Shifts[1].Duration.Text != "PT12H" {
+		t.Errorf("second comparison: %#v", day.Time)
+	}
+	if n := and.Right.(*CompareExpr); n.Op != LessEq || n.Value == nil || n.Value.Text != "3" {
+		t.Errorf("third comparison: %#v", n)
+	}
+	d := stmts[1].(*DeleteNodeStmt)
+	if c, ok := d.Filter.(*CompareExpr); !ok || c.Op != Greater || c.Value.Text != "2024-01-01" {
+		t.Errorf("delete: %#v", d.Filter)
+	}
+
+	for _, bad := range []string{
+		"DELETE NODE Event WHERE at < now();",
+		"UPDATE NODE Event SET old: true WHERE day < date();",
+		"MATCH Event WHERE at > now() - duration('7 days');",
+		"MATCH Event WHERE at > now() - 'P7D';",
+		"MATCH Event WHERE at > today();",
+		"MATCH Event WHERE at >;",
+	} {
+		if _, errs := NewParser(bad).ParseScript(); len(errs) == 0 {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for s, want := range map[string]Duration{
+		"P7D":       {Days: 7},
+		"P1Y2M3W4D": {Years: 1, Months: 2, Days: 25},
+		"PT1H30M":   {Clock: 90 * time.Minute},
+		"P1DT0.5S":  {Days: 1, Clock: 500 * time.Millisecond},
+		"PT36H":     {Clock: 36 * time.Hour},
+	} {
+		if got, err := ParseDuration(s); err != nil || got != want {
+			t.Errorf("%s: got %+v, %v; want %+v", s, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "P", "PT", "P1DT", "7D", "P1.5D", "P1H", "PT1D", "P-1D", "P1D2"} {
+		if _, err := ParseDuration(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestMergeParsing(t *testing.T) {
+	stmts, errs := NewParser(`
+		MERGE NODE Person (name: 'Ann') ON CREATE SET visits: 1 ON MATCH SET visits: 2, seen: true;
+		MERGE EDGE KNOWS FROM Person(name: 'Ann') TO Person(3) (since: 2020) ON MATCH SET since: CASE WHEN since: null THEN 2020 END;
+		merge node Person (name: 'Bob');
+	`).ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	n := stmts[0].(*MergeNodeStmt)
+	if n.NodeType != "Person" || len(n.Properties) != 1 || len(n.OnCreate) != 1 || len(n.OnMatch) != 2 || n.OnMatch[1].Name != "seen" {
+		t.Errorf("merge node: %+v", n)
+	}
+	e := stmts[1].(*MergeEdgeStmt)
+	if e.EdgeType != "KNOWS" || e.FromNode.Properties[0].Name != "name" || e.ToNode.ID.Text != "3" || len(e.Properties) != 1 || e.OnCreate != nil || e.OnMatch[0].Case == nil {
+		t.Errorf("merge edge: %+v", e)
+	}
+	if b := stmts[2].(*MergeNodeStmt); b.OnCreate != nil || b.OnMatch != nil {
+		t.Errorf("plain merge: %+v", b)
+	}
+
+	for _, bad := range []string{
+		"MERGE NODE Person;",
+		"MERGE NODE Person ();",
+		"MERGE Person (name: 'Ann');",
+		"MERGE NODE Person (name: 'Ann') ON UPDATE SET a: 1;",
+		"MERGE NODE Person (name: 'Ann') ON MATCH SET a: 1 ON MATCH SET a: 2;",
+		"MERGE NODE Person (name: 'Ann') ON CREATE a: 1;",
+		"MERGE EDGE KNOWS FROM Person(1) (since: 1);",
+	} {
+		if _, errs := NewParser(bad).ParseScript(); len(errs) == 0 {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestMatchWriteParsing(t *testing.T) {
+	stmts, errs := NewParser(`
+		MATCH (p:Person)-[w:WORKS_AT]->(c:Company {name: 'Acme'}) WHERE p.age > 30 SET p.senior: true, w.role: CASE WHEN c.size: 1 THEN 'all' END;
+		MATCH (p:Person {name: 'Ann'})-[k:KNOWS]-() DELETE k;
+	`).ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	m := stmts[0].(*MatchStmt)
+	if len(m.Set) != 2 || m.Set[0].Name != "p.senior" || m.Set[1].Name != "w.role" || m.Set[1].Case == nil || m.Delete != nil {
+		t.Errorf("set: %+v", m.Set)
+	}
+	if d := stmts[1].(*MatchStmt); len(d.Delete) != 1 || d.Delete[0] != "k" || d.Set != nil {
+		t.Errorf("delete: %+v", d.Delete)
+	}
+
+	for _, bad := range []string{
+		"MATCH Person p SET p.a: 1;",
+		"MATCH Person DELETE Person;",
+		"MATCH (p) SET a: 1;",
+		"MATCH (p) SET p.a: 1 RETURN p;",
+		"MATCH (p) DELETE p LIMIT 1;",
+		"MATCH (p) WHERE p.at < now() DELETE p;",
+		"MATCH (p) SET p.a: 1 DELETE p;",
+		"MATCH Person p WHERE EXISTS (MATCH (p)-[k]->() DELETE k);",
+		"EXPORT MATCH (p) DELETE p TO 'out.json';",
+	} {
+		if _, errs := NewParser(bad).ParseScript(); len(errs) == 0 {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestNamedPathParsing(t *testing.T) {
+	stmts, errs := NewParser(`
+		MATCH p = (a:Person)-[:KNOWS*1..3]->(b), (b)-[w]-(c), q = (c) RETURN p, q;
+	`).ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	m := stmts[0].(*MatchStmt)
+	if len(m.Paths) != 3 || m.Paths[0].Name != "p" || m.Paths[1].Name != "" || m.Paths[2].Name != "q" {
+		t.Fatalf("paths: %+v", m.Paths)
+	}
+	if len(m.Paths[0].Elements) != 3 || m.Paths[0].Elements[0].Alias != "a" {
+		t.Errorf("elements: %+v", m.Paths[0].Elements)
+	}
+
+	for _, bad := range []string{
+		"MATCH p = Person RETURN p;",
+		"MATCH p = RETURN p;",
+		"MATCH (a), p = RETURN p;",
+	} {
+		if _, errs := NewParser(bad).ParseScript(); len(errs) == 0 {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestWithParsing(t *testing.T) {
+	stmts, errs := NewParser(`
+		MATCH (c:Company) WHERE c.size > 10 WITH c LIMIT 10 MATCH (p)-[:WORKS_AT]->(c) WITH p, c MATCH (p) RETURN p.name, c.name LIMIT 5;
+	`).ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	m := stmts[0].(*MatchStmt)
+	w := m.With
+	if w == nil || len(w.Vars) != 1 || w.Vars[0] != "c" || w.Limit == nil || w.Limit.Text != "10" || m.Filter == nil || m.Return != nil {
+		t.Fatalf("first stage: %+v", m)
+	}
+	second := w.Next
+	if len(second.Paths) != 1 || second.With == nil || len(second.With.Vars) != 2 || second.With.Limit != nil {
+		t.Fatalf("second stage: %+v", second)
+	}
+	if last := second.With.Next; len(last.Return) != 2 || last.Limit == nil || last.With != nil {
+		t.Errorf("last stage: %+v", last)
+	}
+
+	for _, bad := range []string{
+		"MATCH (c) WITH c;",
+		"MATCH (c) WITH c RETURN c;",
+		"MATCH (c) WITH MATCH (c);",
+		"MATCH Company c WITH c MATCH (c);",
+		"MATCH (c) WITH c MATCH Company RETURN name;",
+		"MATCH (c) WITH c LIMIT x MATCH (c);",
+		"MATCH (c) RETURN c WITH c MATCH (c);",
+		"MATCH (c) WHERE c.at < now() WITH c MATCH (c) DELETE c;",
+		"MATCH (a) WHERE EXISTS (MATCH (a)-[]->(b) WITH b MATCH (b));",
+	} {
+		if _, errs := NewParser(bad).ParseScript(); len(errs) == 0 {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestOnConflictParsing(t *testing.T) {
+	stmts, errs := NewParser(`
+		INSERT NODE Person (name: 'Ann') ON CONFLICT DO NOTHING;
+		INSERT NODE Person (name: 'Ann', age: 30) ON CONFLICT DO UPDATE;
+		insert node Person (name: 'Ann') on conflict do update set visits: CASE WHEN visits: null THEN 1 END, seen: true;
+		INSERT NODE Person (name: 'Bob');
+	`).ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if n := stmts[0].(*InsertNodeStmt); n.OnConflict == nil || n.OnConflict.Update {
+		t.Errorf("do nothing: %+v", n.OnConflict)
+	}
+	if n := stmts[1].(*InsertNodeStmt); n.OnConflict == nil || !n.OnConflict.Update || n.OnConflict.Set != nil {
+		t.Errorf("do update: %+v", n.OnConflict)
+	}
+	if n := stmts[2].(*InsertNodeStmt); n.OnConflict == nil || len(n.OnConflict.Set) != 2 || n.OnConflict.Set[0].Case == nil {
+		t.Errorf("do update set: %+v", n.OnConflict)
+	}
+	if n := stmts[3].(*InsertNodeStmt); n.OnConflict != nil {
+		t.Errorf("plain insert: %+v", n.OnConflict)
+	}
+
+	for _, bad := range []string{
+		"INSERT NODE Person (name: 'Ann') ON CONFLICT;",
+		"INSERT NODE Person (name: 'Ann') ON CONFLICT DO;",
+		"INSERT NODE Person (name: 'Ann') ON CONFLICT DO REPLACE;",
+		"INSERT NODE Person (name: 'Ann') ON DUPLICATE DO NOTHING;",
+		"INSERT NODE Person (name: 'Ann') ON CONFLICT DO UPDATE SET;",
+		"INSERT EDGE KNOWS FROM Person(1) TO Person(2) ON CONFLICT DO NOTHING;",
+	} {
+		if _, errs := NewParser(bad).ParseScript(); len(errs) == 0 {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestSetExpressionParsing(t *testing.T) {
+	stmts, errs := NewParser(`
+		UPDATE NODE User SET logins: logins + 1, name: upper(name) WHERE name: 'ann';
+		UPDATE NODE User SET score: (a + b) * 2 - c / 4, age: 30;
+		MATCH (u:User)-[:IN]->(g:Group) SET u.label: concat(g.name, '/', u.name);
+	`).ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	set := stmts[0].(*UpdateNodeStmt).Set
+	sum, ok := set[0].Calc.(*ArithExpr)
+	if !ok || sum.Op != "+" || sum.Left.(*FieldRef).Name != "logins" || sum.Right.(*Literal).Text != "1" {
+		t.Errorf("logins: %+v", set[0])
+	}
+	if call, ok := set[1].Calc.(*FuncCall); !ok || call.Name != "upper" || len(call.Args) != 1 {
+		t.Errorf("name: %+v", set[1])
+	}
+
+	set = stmts[1].(*UpdateNodeStmt).Set
+	// (a + b) * 2 - c / 4 is a subtraction of two products
+	diff, ok := set[0].Calc.(*ArithExpr)
+	if !ok || diff.Op != "-" || diff.Left.(*ArithExpr).Op != "*" || diff.Right.(*ArithExpr).Op != "/" {
+		t.Errorf("score: %+v", set[0].Calc)
+	}
+	if set[1].Calc != nil || set[1].Value == nil || set[1].Value.Text != "30" {
+		t.Errorf("a plain literal should stay a Value: %+v", set[1])
+	}
+
+	call, ok := stmts[2].(*MatchStmt).Set[0].Calc.(*FuncCall)
+	if !ok || len(call.Args) != 3 || call.Args[0].(*FieldRef).Name != "g.name" {
+		t.Errorf("concat: %+v", stmts[2].(*MatchStmt).Set[0])
+	}
+
+	for _, bad := range []string{
+		"UPDATE NODE User SET logins: logins +;",
+		"UPDATE NODE User SET score: (a + b;",
+		"UPDATE NODE User SET name: upper(name;",
+		"MATCH (u:User) SET u.logins: logins + 1;",
+	} {
+		if _, errs := NewParser(bad).ParseScript(); len(errs) == 0 {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestDeleteEdgeBetweenParsing(t *testing.T) {
+	stmts, errs := NewParser(`
+		DELETE EDGE WORKS_AT FROM Person(name: 'Alice') TO Company(name: 'Acme');
+		DELETE EDGE WORKS_AT FROM Person(1) TO Company(2) WHERE since: 2020;
+		DELETE EDGE WORKS_AT WHERE since: 2020;
+	`).ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	d := stmts[0].(*DeleteEdgeStmt)
+	if d.FromNode == nil || d.FromNode.NodeType != "Person" || d.FromNode.Properties[0].Value.Text != "Alice" ||
+		d.ToNode == nil || d.ToNode.NodeType != "Company" || d.Where != nil || d.Filter != nil {
+		t.Errorf("between: %+v", d)
+	}
+	d = stmts[1].(*DeleteEdgeStmt)
+	if d.FromNode == nil || d.FromNode.ID.Text != "1" || d.ToNode.ID.Text != "2" || len(d.Where) != 1 {
+		t.Errorf("between with WHERE: %+v", d)
+	}
+	if d := stmts[2].(*DeleteEdgeStmt); d.FromNode != nil || d.ToNode != nil || len(d.Where) != 1 {
+		t.Errorf("plain: %+v", d)
+	}
+
+	for _, bad := range []string{
+		"DELETE EDGE WORKS_AT;",
+		"DELETE EDGE WORKS_AT FROM Person(1);",
+		"DELETE EDGE WORKS_AT FROM Person(1) TO Company(2) WHERE;",
+		"DELETE EDGE WORKS_AT TO Company(2);",
+	} {
+		if _, errs := NewParser(bad).ParseScript(); len(errs) == 0 {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
 func TestMixedDMLStatements(t *testing.T) {
 	input := `
 		INSERT NODE User (name: 'John', age: 25);
@@ -319,3 +941,100 @@ func TestMixedDMLStatements(t *testing.T) {
 		}
 	}
 }
+
+func TestJSONLiteralParsing(t *testing.T) {
+	stmts, errs := NewParser(`INSERT NODE Doc (meta: {"b": [1, -2.5, true, null], 'a': {"x": "say \"hi\"\n"}}, tags: []);`).ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	props := stmts[0].(*InsertNodeStmt).Properties
+	if v := props[0].Value; v.Kind != LitJSON || v.Text != `{"a":{"x":"say \"hi\"\n"},"b":[1,-2.5,true,null]}` {
+		t.Errorf("object: %+v", v)
+	}
+	if v := props[1].Value; v.Kind != LitJSON || v.Text != "[]" {
+		t.Errorf("array: %+v", v)
+	}
+
+	for _, bad := range []string{
+		`INSERT NODE Doc (meta: {"a" 1});`,
+		`INSERT NODE Doc (meta: {a: 1});`,
+		`INSERT NODE Doc (meta: [1 2]);`,
+		`INSERT NODE Doc (meta: {"a": 1);`,
+		`INSERT NODE Doc (name: "Ann");`,
+	} {
+		if _, errs := NewParser(bad).ParseScript(); len(errs) == 0 {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestBlobLiteralParsing(t *testing.T) {
+	stmts, errs := NewParser(`INSERT NODE File (a: b64'aGk', b: B64'aGk=', b64: '');`).ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	props := stmts[0].(*InsertNodeStmt).Properties
+	for _, p := range props[:2] {
+		if p.Value.Kind != LitBlob || p.Value.Text != "aGk=" {
+			t.Errorf("%s: %+v", p.Name, p.Value)
+		}
+	}
+	if props[2].Name != "b64" || props[2].Value.Kind != LitString {
+		t.Errorf("a field named b64: %+v", props[2])
+	}
+	text, err := Format(stmts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `INSERT NODE File (a: b64'aGk=', b: b64'aGk=', b64: '');`; text != want {
+		t.Errorf("formatted as %s, want %s", text, want)
+	}
+
+	for _, bad := range []string{
+		`INSERT NODE File (a: b64'not base64!');`,
+		`INSERT NODE File (a: b64'aGk);`,
+	} {
+		if _, errs := NewParser(bad).ParseScript(); len(errs) == 0 {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestReturningParsing(t *testing.T) {
+	for _, src := range []string{
+		"UPDATE NODE Person SET age: 1 WHERE name: 'Ann' RETURNING *;",
+		"UPDATE EDGE Knows SET since: 2020 RETURNING _from, _to;",
+		"DELETE NODE Person WHERE age < 18 RETURNING name, age;",
+		"DELETE EDGE Knows FROM Person(1) TO Person(2) RETURNING *;",
+	} {
+		stmts, errs := NewParser(src).ParseScript()
+		if len(errs) > 0 {
+			t.Fatalf("%s: %v", src, errs)
+		}
+		text, err := Format(stmts[0])
+		if err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+		if text != src {
+			t.Errorf("formatted as %s, want %s", text, src)
+		}
+	}
+	stmts, _ := NewParser("DELETE NODE Person WHERE age < 18 RETURNING name, age;").ParseScript()
+	if r := stmts[0].(*DeleteNodeStmt).Returning; !slices.Equal(r, []string{"name", "age"}) {
+		t.Errorf("returning = %v", r)
+	}
+	stmts, _ = NewParser("DELETE NODE Person WHERE age < 18;").ParseScript()
+	if r := stmts[0].(*DeleteNodeStmt).Returning; r != nil {
+		t.Errorf("returning without RETURNING = %v", r)
+	}
+
+	for _, bad := range []string{
+		"DELETE NODE Person WHERE age < 18 RETURNING;",
+		"UPDATE NODE Person SET age: 1 RETURNING name,;",
+		"DELETE NODE Person WHERE age < 18 RETURNING *, name;",
+	} {
+		if _, errs := NewParser(bad).ParseScript(); len(errs) == 0 {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
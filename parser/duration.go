@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Duration is an ISO 8601 duration such as P1Y2M10DT2H30M. Years, months and
+// days are kept apart from the clock part, since how long they last depends
+// on the date they are added to.
+type Duration struct {
+	Years, Months, Days int
+	Clock               time.Duration
+}
+
+// ParseDuration parses an ISO 8601 duration: P, then any of nY, nM, nW and
+// nD, then T and any of nH, nM and nS, where only seconds may have a
+// fraction. At least one part must be given.
+func ParseDuration(s string) (Duration, error) {
+	var d Duration
+	bad := func() (Duration, error) {
+		return Duration{}, fmt.Errorf("invalid duration %q: expected ISO 8601, as in 'P7D' or 'PT1H30M'", s)
+	}
+	if len(s) < 3 || s[0] != 'P' {
+		return bad()
+	}
+	clock := false
+	parts, clockParts := 0, 0
+	for i := 1; i < len(s); {
+		if s[i] == 'T' && !clock {
+			clock = true
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+			j++
+		}
+		if j == i || j == len(s) {
+			return bad()
+		}
+		num, unit := s[i:j], s[j]
+		i = j + 1
+		parts++
+		if clock {
+			clockParts++
+		}
+		if unit == 'S' && clock {
+			secs, err := strconv.ParseFloat(num, 64)
+			if err != nil {
+				return bad()
+			}
+			d.Clock += time.Duration(secs * float64(time.Second))
+			continue
+		}
+		n, err := strconv.Atoi(num)
+		if err != nil {
+			return bad()
+		}
+		switch {
+		case !clock && unit == 'Y':
+			d.Years += n
+		case !clock && unit == 'M':
+			d.Months += n
+		case !clock && unit == 'W':
+			d.Days += 7 * n
+		case !clock && unit == 'D':
+			d.Days += n
+		case clock && unit == 'H':
+			d.Clock += time.Duration(n) * time.Hour
+		case clock && unit == 'M':
+			d.Clock += time.Duration(n) * time.Minute
+		default:
+			return bad()
+		}
+	}
+	if parts == 0 || clock && clockParts == 0 {
+		return bad()
+	}
+	return d, nil
+}
+
+// AddTo returns t plus d, or minus d if neg
+func (d Duration) AddTo(t time.Time, neg bool) time.Time {
+	if neg {
+		return t.AddDate(-d.Years, -d.Months, -d.Days).Add(-d.Clock)
+	}
+	return t.AddDate(d.Years, d.Months, d.Days).Add(d.Clock)
+}
@@ -0,0 +1,733 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format renders stmt as statement text, terminated by ';', that parses back
+// to an equivalent statement. Names that are keywords or not plain identifiers
+// are quoted with backticks. It fails for values the language cannot express,
+// such as negative numbers or names containing a backtick.
+func Format(stmt Stmt) (string, error) {
+	f := &formatter{}
+	f.stmt(stmt)
+	if f.err != nil {
+		return "", f.err
+	}
+	f.b.WriteByte(';')
+	return f.b.String(), nil
+}
+
+// FormatScript formats each statement on its own line
+func FormatScript(stmts []Stmt) (string, error) {
+	lines := make([]string, len(stmts))
+	for i, st := range stmts {
+		s, err := Format(st)
+		if err != nil {
+			return "", fmt.Errorf("statement %d: %w", i+1, err)
+		}
+		lines[i] = s
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+type formatter struct {
+	b   strings.Builder
+	err error
+}
+
+func (f *formatter) fail(format string, args ...any) {
+	if f.err == nil {
+		f.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (f *formatter) printf(format string, args ...any) {
+	fmt.Fprintf(&f.b, format, args...)
+}
+
+func (f *formatter) stmt(stmt Stmt) {
+	switch s := stmt.(type) {
+	case *CreateNodeStmt:
+		f.printf("CREATE NODE %s (", f.ident(s.Name))
+		f.fields(s.Fields)
+		f.b.WriteByte(')')
+	case *CreateEdgeStmt:
+		f.printf("CREATE EDGE %s (FROM %s, TO %s", f.ident(s.Name), f.endpoint(s.From), f.endpoint(s.To))
+		if len(s.Props) > 0 {
+			f.b.WriteString(", PROPS (")
+			f.fields(s.Props)
+			f.b.WriteByte(')')
+		}
+		f.b.WriteByte(')')
+	case *AlterNodeStmt:
+		f.printf("ALTER NODE %s ", f.ident(s.Name))
+		switch s.Action {
+		case AlterAddField, AlterModifyField:
+			if s.Field == nil {
+				f.fail("ALTER NODE %s: missing field", s.Name)
+				return
+			}
+			if s.Action == AlterAddField {
+				f.b.WriteString("ADD ")
+			} else {
+				f.b.WriteString("MODIFY ")
+			}
+			f.field(*s.Field)
+		case AlterDropField:
+			f.printf("DROP %s", f.ident(s.FieldName))
+		case AlterSetPrimaryKey:
+			names := make([]string, len(s.PkFields))
+			for i, n := range s.PkFields {
+				names[i] = f.ident(n)
+			}
+			f.printf("SET PRIMARY KEY (%s)", strings.Join(names, ", "))
+		default:
+			f.fail("ALTER NODE %s: unsupported action %d", s.Name, s.Action)
+		}
+	case *AlterEdgeStmt:
+		f.printf("ALTER EDGE %s ", f.ident(s.Name))
+		switch s.Action {
+		case AlterAddProp, AlterModifyProp:
+			if s.Prop == nil {
+				f.fail("ALTER EDGE %s: missing prop", s.Name)
+				return
+			}
+			if s.Action == AlterAddProp {
+				f.b.WriteString("ADD ")
+			} else {
+				f.b.WriteString("MODIFY ")
+			}
+			f.field(*s.Prop)
+		case AlterDropProp:
+			f.printf("DROP %s", f.ident(s.PropName))
+		case AlterSetEndpoints:
+			if s.From == nil || s.To == nil {
+				f.fail("ALTER EDGE %s: SET needs both endpoints", s.Name)
+				return
+			}
+			f.printf("SET FROM %s TO %s", f.endpoint(*s.From), f.endpoint(*s.To))
+		default:
+			f.fail("ALTER EDGE %s: unsupported action %d", s.Name, s.Action)
+		}
+	case *DropNodeStmt:
+		f.printf("DROP NODE %s", f.ident(s.Name))
+	case *DropEdgeStmt:
+		f.printf("DROP EDGE %s", f.ident(s.Name))
+	case *CreateFulltextIndexStmt:
+		f.printf("CREATE FULLTEXT INDEX ON %s(%s)", f.ident(s.NodeType), f.idents(s.Fields))
+		if s.Stem {
+			f.b.WriteString(" WITH STEMMING")
+		}
+	case *DropFulltextIndexStmt:
+		f.printf("DROP FULLTEXT INDEX ON %s(%s)", f.ident(s.NodeType), f.idents(s.Fields))
+	case *InsertNodeStmt:
+		f.printf("INSERT NODE %s", f.ident(s.NodeType))
+		if len(s.Properties) > 0 {
+			f.printf(" (%s)", f.props(s.Properties))
+		}
+		switch oc := s.OnConflict; {
+		case oc == nil:
+		case !oc.Update:
+			f.b.WriteString(" ON CONFLICT DO NOTHING")
+		case len(oc.Set) == 0:
+			f.b.WriteString(" ON CONFLICT DO UPDATE")
+		default:
+			f.printf(" ON CONFLICT DO UPDATE SET %s", f.props(oc.Set))
+		}
+	case *InsertEdgeStmt:
+		f.printf("INSERT EDGE %s FROM %s TO %s", f.ident(s.EdgeType), f.nodeRef(s.FromNode), f.nodeRef(s.ToNode))
+		if len(s.Properties) > 0 {
+			f.printf(" (%s)", f.props(s.Properties))
+		}
+	case *MergeNodeStmt:
+		f.printf("MERGE NODE %s (%s)", f.ident(s.NodeType), f.props(s.Properties))
+		f.onSet(s.OnCreate, s.OnMatch)
+	case *MergeEdgeStmt:
+		f.printf("MERGE EDGE %s FROM %s TO %s", f.ident(s.EdgeType), f.nodeRef(s.FromNode), f.nodeRef(s.ToNode))
+		if len(s.Properties) > 0 {
+			f.printf(" (%s)", f.props(s.Properties))
+		}
+		f.onSet(s.OnCreate, s.OnMatch)
+	case *UpdateNodeStmt:
+		f.printf("UPDATE NODE %s SET %s", f.ident(s.NodeType), f.props(s.Set))
+		f.where(s.Where, s.Filter)
+		f.returning(s.Returning)
+	case *UpdateEdgeStmt:
+		f.printf("UPDATE EDGE %s SET %s", f.ident(s.EdgeType), f.props(s.Set))
+		f.where(s.Where, s.Filter)
+		f.returning(s.Returning)
+	case *DeleteNodeStmt:
+		f.printf("DELETE NODE %s WHERE %s", f.ident(s.NodeType), f.conditions(s.Where, s.Filter))
+		f.returning(s.Returning)
+	case *DeleteEdgeStmt:
+		f.printf("DELETE EDGE %s", f.ident(s.EdgeType))
+		switch {
+		case s.FromNode != nil && s.ToNode != nil:
+			f.printf(" FROM %s TO %s", f.nodeRef(s.FromNode), f.nodeRef(s.ToNode))
+			f.where(s.Where, s.Filter)
+		case s.FromNode != nil || s.ToNode != nil:
+			f.fail("DELETE EDGE needs both FROM and TO")
+		default:
+			f.printf(" WHERE %s", f.conditions(s.Where, s.Filter))
+		}
+		f.returning(s.Returning)
+	case *MatchStmt:
+		f.b.WriteString("MATCH")
+		for i, el := range s.Pattern {
+			if i > 0 {
+				f.b.WriteByte(',')
+			}
+			f.printf(" %s", f.ident(el.Type))
+			if el.Alias != "" {
+				f.printf(" %s", f.ident(el.Alias))
+			}
+		}
+		for i, path := range s.Paths {
+			if i > 0 {
+				f.b.WriteByte(',')
+			}
+			f.b.WriteByte(' ')
+			f.path(path)
+		}
+		f.matchWhere(s.Where, s.Filter, s.Search, s.Within)
+		switch {
+		case s.Distinct && len(s.Return) == 0:
+			f.fail("DISTINCT without RETURN items")
+		case s.Cases != nil && len(s.Cases) != len(s.Return):
+			f.fail("%d CASE entries for %d RETURN items", len(s.Cases), len(s.Return))
+		case s.Distinct:
+			f.printf(" RETURN DISTINCT %s", f.returnItems(s.Return, s.Cases))
+		case len(s.Return) > 0:
+			f.printf(" RETURN %s", f.returnItems(s.Return, s.Cases))
+		}
+		if o := s.OrderBy; o != nil {
+			fn := "SIMILARITY"
+			if o.Metric == L2 {
+				fn = "DISTANCE"
+			}
+			f.printf(" ORDER BY %s(%s, %s)", fn, f.dotted(o.Field), f.literal(o.Vector))
+		}
+		if s.Limit != nil {
+			f.printf(" LIMIT %s", f.literal(s.Limit))
+		}
+		switch {
+		case len(s.Set) > 0 && len(s.Delete) > 0:
+			f.fail("a MATCH cannot have both SET and DELETE")
+		case len(s.Set) > 0:
+			parts := make([]string, len(s.Set))
+			for i, p := range s.Set {
+				parts[i] = f.dotted(p.Name) + ": " + f.value(p)
+			}
+			f.printf(" SET %s", strings.Join(parts, ", "))
+		case len(s.Delete) > 0:
+			f.printf(" DELETE %s", f.idents(s.Delete))
+		}
+		if w := s.With; w != nil {
+			f.printf(" WITH %s", f.idents(w.Vars))
+			if w.Limit != nil {
+				f.printf(" LIMIT %s", f.literal(w.Limit))
+			}
+			f.b.WriteByte(' ')
+			f.stmt(w.Next)
+		}
+	case *ExportStmt:
+		f.b.WriteString("EXPORT ")
+		switch {
+		case s.Match != nil:
+			f.stmt(s.Match)
+			f.b.WriteByte(' ')
+		case s.NodeType != "":
+			f.printf("NODE %s ", f.ident(s.NodeType))
+		}
+		f.printf("TO %s", quote(s.Path))
+	case *ShowStatsStmt:
+		f.b.WriteString("SHOW STATS")
+		if s.Type != "" {
+			f.printf(" %s", f.ident(s.Type))
+		}
+	case *BackupStmt:
+		f.printf("BACKUP TO %s", quote(s.Path))
+		if s.Since != nil {
+			f.printf(" SINCE %s", f.literal(s.Since))
+		}
+	case *VacuumStmt:
+		f.b.WriteString("VACUUM")
+		if s.Type != "" {
+			f.printf(" %s", f.ident(s.Type))
+		}
+	default:
+		f.fail("cannot format %T", stmt)
+	}
+}
+
+func (f *formatter) fields(fields []FieldDef) {
+	for i, fd := range fields {
+		if i > 0 {
+			f.b.WriteString(", ")
+		}
+		f.field(fd)
+	}
+}
+
+func (f *formatter) field(fd FieldDef) {
+	f.printf("%s: %s", f.ident(fd.Name), f.typeSpec(fd.Type))
+	if fd.PrimaryKey {
+		f.b.WriteString(" PRIMARY KEY")
+	}
+	if fd.Unique {
+		f.b.WriteString(" UNIQUE")
+	}
+	if fd.Index {
+		f.b.WriteString(" INDEX")
+	}
+	if fd.NotNull {
+		f.b.WriteString(" NOT NULL")
+	}
+	if fd.Default != nil {
+		f.printf(" DEFAULT %s", f.literal(fd.Default))
+	}
+	if fd.TTL != "" {
+		f.printf(" TTL %s", quote(fd.TTL))
+	}
+}
+
+var baseTypeNames = map[BaseType]string{
+	BaseString:   "string",
+	BaseText:     "text",
+	BaseInt:      "int",
+	BaseFloat:    "float",
+	BaseBool:     "bool",
+	BaseUUID:     "uuid",
+	BaseDate:     "date",
+	BaseTime:     "time",
+	BaseDateTime: "datetime",
+	BaseJSON:     "json",
+	BaseBlob:     "blob",
+	BasePoint:    "point",
+}
+
+func (f *formatter) typeSpec(t TypeSpec) string {
+	switch {
+	case t.Elem != nil:
+		return "array<" + f.typeSpec(*t.Elem) + ">"
+	case t.Base == BaseVector:
+		return fmt.Sprintf("vector<float, %d>", t.Dim)
+	case len(t.EnumVals) > 0:
+		vals := make([]string, len(t.EnumVals))
+		for i, v := range t.EnumVals {
+			vals[i] = quote(v)
+		}
+		return "enum<" + strings.Join(vals, ", ") + ">"
+	}
+	name, ok := baseTypeNames[t.Base]
+	if !ok {
+		f.fail("unknown base type %d", t.Base)
+	}
+	return name
+}
+
+func (f *formatter) endpoint(e Endpoint) string {
+	if e.Card == CardMany {
+		return f.ident(e.Label) + " MANY"
+	}
+	return f.ident(e.Label) + " ONE"
+}
+
+func (f *formatter) nodeRef(r *NodeRef) string {
+	if r == nil {
+		f.fail("missing node reference")
+		return ""
+	}
+	switch {
+	case r.ID != nil:
+		if r.ID.Kind != LitString && r.ID.Kind != LitNumber {
+			f.fail("node ID must be a string or number")
+		}
+		return fmt.Sprintf("%s(%s)", f.ident(r.NodeType), f.literal(r.ID))
+	case len(r.Properties) > 0:
+		return fmt.Sprintf("%s(%s)", f.ident(r.NodeType), f.props(r.Properties))
+	default:
+		return f.ident(r.NodeType)
+	}
+}
+
+// onSet prints the ON CREATE SET and ON MATCH SET of a MERGE
+func (f *formatter) onSet(onCreate, onMatch []Property) {
+	if len(onCreate) > 0 {
+		f.printf(" ON CREATE SET %s", f.props(onCreate))
+	}
+	if len(onMatch) > 0 {
+		f.printf(" ON MATCH SET %s", f.props(onMatch))
+	}
+}
+
+func (f *formatter) where(props []Property, filter Expr) {
+	if len(props) > 0 || filter != nil {
+		f.printf(" WHERE %s", f.conditions(props, filter))
+	}
+}
+
+// returning prints the RETURNING of an UPDATE or DELETE, if it has one
+func (f *formatter) returning(fields []string) {
+	switch {
+	case fields == nil:
+	case len(fields) == 0:
+		f.fail("RETURNING without fields")
+	case len(fields) == 1 && fields[0] == "*":
+		f.b.WriteString(" RETURNING *")
+	default:
+		names := make([]string, len(fields))
+		for i, name := range fields {
+			names[i] = f.ident(name)
+		}
+		f.printf(" RETURNING %s", strings.Join(names, ", "))
+	}
+}
+
+// conditions prints the key: value pairs of a WHERE and then its filter
+func (f *formatter) conditions(props []Property, filter Expr) string {
+	if len(props) == 0 && filter == nil {
+		f.fail("empty property list")
+	}
+	parts := make([]string, 0, len(props)+1)
+	for _, p := range props {
+		parts = append(parts, f.dotted(p.Name)+": "+f.literal(p.Value))
+	}
+	if filter != nil {
+		parts = append(parts, f.expr(filter, 0))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Precedences of the boolean operators, loosest first
+const (
+	precOr = iota + 1
+	precAnd
+	precNot
+)
+
+// expr prints x, parenthesized if its operator binds more loosely than prec
+func (f *formatter) expr(x Expr, prec int) string {
+	var s string
+	var own int
+	switch x := x.(type) {
+	case *Property:
+		return f.dotted(x.Name) + ": " + f.literal(x.Value)
+	case *LogicalExpr:
+		op := " OR "
+		own = precOr
+		if x.Op == And {
+			op, own = " AND ", precAnd
+		}
+		// both operators are associative, but keep the tree as parsed
+		s = f.expr(x.Left, own) + op + f.expr(x.Right, own+1)
+	case *NotExpr:
+		s, own = "NOT "+f.expr(x.X, precNot), precNot
+	case *InExpr:
+		if len(x.Values) == 0 {
+			f.fail("empty IN list")
+		}
+		vals := make([]string, len(x.Values))
+		for i, v := range x.Values {
+			vals[i] = f.literal(v)
+		}
+		return f.dotted(x.Field) + " IN (" + strings.Join(vals, ", ") + ")"
+	case *StringMatch:
+		op := map[StringOp]string{StartsWith: "STARTS WITH", EndsWith: "ENDS WITH", Contains: "CONTAINS", RegexMatch: "=~"}[x.Op]
+		if op == "" {
+			f.fail("unknown string operator %d", x.Op)
+		}
+		if x.Pattern != nil && x.Pattern.Kind != LitString {
+			f.fail("the pattern of %s must be a string", op)
+		}
+		return f.dotted(x.Field) + " " + op + " " + f.literal(x.Pattern)
+	case *BetweenExpr:
+		return f.dotted(x.Field) + " BETWEEN " + f.literal(x.Low) + " AND " + f.literal(x.High)
+	case *CompareExpr:
+		op := map[CompareOp]string{Less: "<", LessEq: "<=", Greater: ">", GreaterEq: ">="}[x.Op]
+		if op == "" {
+			f.fail("unknown comparison operator %d", x.Op)
+		}
+		if x.Time != nil {
+			return f.dotted(x.Field) + " " + op + " " + f.timeExpr(x.Time)
+		}
+		return f.dotted(x.Field) + " " + op + " " + f.literal(x.Value)
+	case *ExistsExpr:
+		if x.Match == nil {
+			f.fail("EXISTS without a MATCH")
+			return ""
+		}
+		sub := &formatter{}
+		sub.stmt(x.Match)
+		if sub.err != nil {
+			f.fail("EXISTS: %v", sub.err)
+		}
+		return "EXISTS (" + sub.b.String() + ")"
+	case nil:
+		f.fail("missing condition")
+		return ""
+	default:
+		f.fail("%T cannot be used in a boolean expression", x)
+		return ""
+	}
+	if own < prec {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+func (f *formatter) timeExpr(x *TimeExpr) string {
+	if x.Func != "now" && x.Func != "date" {
+		f.fail("unknown time function %q", x.Func)
+	}
+	s := x.Func + "()"
+	for _, sh := range x.Shifts {
+		if sh.Duration == nil || sh.Duration.Kind != LitString {
+			f.fail("a duration must be a string")
+			return s
+		}
+		op := " + "
+		if sh.Neg {
+			op = " - "
+		}
+		s += op + "duration(" + quote(sh.Duration.Text) + ")"
+	}
+	return s
+}
+
+func (f *formatter) path(path PathPattern) {
+	if path.Name != "" {
+		f.b.WriteString(f.ident(path.Name) + " = ")
+	}
+	for _, el := range path.Elements {
+		body := ""
+		if el.Alias != "" {
+			body = f.ident(el.Alias)
+		}
+		if el.Type != "" {
+			body += ":" + f.ident(el.Type)
+		}
+		if h := el.Hops; h != nil {
+			switch {
+			case h.Min == 1 && h.Max < 0:
+				body += "*"
+			case h.Min == h.Max:
+				body += fmt.Sprintf("*%d", h.Min)
+			case h.Max < 0:
+				body += fmt.Sprintf("*%d..", h.Min)
+			default:
+				body += fmt.Sprintf("*%d..%d", h.Min, h.Max)
+			}
+		}
+		if len(el.Properties) > 0 {
+			if body != "" {
+				body += " "
+			}
+			body += "{" + f.props(el.Properties) + "}"
+		}
+		if !el.IsEdge {
+			f.printf("(%s)", body)
+			continue
+		}
+		switch el.Direction {
+		case DirOut:
+			f.printf("-[%s]->", body)
+		case DirIn:
+			f.printf("<-[%s]-", body)
+		default:
+			f.printf("-[%s]-", body)
+		}
+	}
+}
+
+func (f *formatter) matchWhere(props []Property, filter Expr, search []TextMatch, within []GeoWithin) {
+	parts := make([]string, 0, len(props)+len(search)+len(within)+1)
+	if len(props) > 0 || filter != nil {
+		parts = append(parts, f.conditions(props, filter))
+	}
+	for _, m := range search {
+		parts = append(parts, fmt.Sprintf("MATCHES(%s, %s)", f.ident(m.Field), f.literal(m.Query)))
+	}
+	for _, w := range within {
+		parts = append(parts, fmt.Sprintf("WITHIN(%s, %s, %s%s)", f.ident(w.Field), f.literal(w.Center), f.literal(w.Radius), w.Unit))
+	}
+	if len(parts) > 0 {
+		f.printf(" WHERE %s", strings.Join(parts, ", "))
+	}
+}
+
+func (f *formatter) idents(names []string) string {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = f.ident(n)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func (f *formatter) returnItems(items []string, cases []*CaseExpr) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		if cases != nil && cases[i] != nil {
+			quoted[i] = f.caseExpr(cases[i]) + " AS " + f.ident(item)
+			continue
+		}
+		quoted[i] = f.dotted(item)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func (f *formatter) caseExpr(c *CaseExpr) string {
+	if len(c.Whens) == 0 {
+		f.fail("CASE without WHEN")
+	}
+	var b strings.Builder
+	b.WriteString("CASE")
+	for _, w := range c.Whens {
+		fmt.Fprintf(&b, " WHEN %s THEN %s", f.expr(w.Cond, 0), f.literal(w.Then))
+	}
+	if c.Else != nil {
+		fmt.Fprintf(&b, " ELSE %s", f.literal(c.Else))
+	}
+	b.WriteString(" END")
+	return b.String()
+}
+
+// dotted returns a name that may be alias.field, or a path into a json
+// field, as written in a statement
+func (f *formatter) dotted(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = f.ident(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+func (f *formatter) props(props []Property) string {
+	if len(props) == 0 {
+		f.fail("empty property list")
+	}
+	parts := make([]string, len(props))
+	for i, p := range props {
+		parts[i] = f.ident(p.Name) + ": " + f.value(p)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// value prints the value of p: a literal, CASE or expression
+func (f *formatter) value(p Property) string {
+	switch {
+	case p.Case != nil:
+		return f.caseExpr(p.Case)
+	case p.Calc != nil:
+		return f.valueExpr(p.Calc, 0)
+	}
+	return f.literal(p.Value)
+}
+
+// valueExpr prints x, parenthesized if its operator binds more loosely than
+// prec: 1 for + and -, 2 for * and /
+func (f *formatter) valueExpr(x ValueExpr, prec int) string {
+	switch x := x.(type) {
+	case *Literal:
+		return f.literal(x)
+	case *FieldRef:
+		return f.dotted(x.Name)
+	case *FuncCall:
+		args := make([]string, len(x.Args))
+		for i, arg := range x.Args {
+			args[i] = f.valueExpr(arg, 0)
+		}
+		return f.ident(x.Name) + "(" + strings.Join(args, ", ") + ")"
+	case *ArithExpr:
+		p := 1
+		switch x.Op {
+		case "*", "/":
+			p = 2
+		case "+", "-":
+		default:
+			f.fail("unknown operator %q", x.Op)
+		}
+		// the right operand binds first, so a - (b - c) keeps its parentheses
+		s := f.valueExpr(x.Left, p) + " " + x.Op + " " + f.valueExpr(x.Right, p+1)
+		if p < prec {
+			return "(" + s + ")"
+		}
+		return s
+	}
+	f.fail("unknown value expression %T", x)
+	return ""
+}
+
+func (f *formatter) literal(l *Literal) string {
+	if l == nil {
+		f.fail("missing literal")
+		return ""
+	}
+	switch l.Kind {
+	case LitString:
+		return quote(l.Text)
+	case LitNumber:
+		if !isNumber(l.Text) {
+			f.fail("%q is not a number the language can express", l.Text)
+		}
+		return l.Text
+	case LitBool:
+		if l.Text != "true" && l.Text != "false" {
+			f.fail("%q is not a boolean", l.Text)
+		}
+		return l.Text
+	case LitNull:
+		return "null"
+	case LitJSON:
+		return l.Text
+	case LitBlob:
+		return "b64" + quote(l.Text)
+	default:
+		f.fail("unknown literal kind %d", l.Kind)
+		return ""
+	}
+}
+
+// ident returns name as written in a statement, quoting it when needed
+func (f *formatter) ident(name string) string {
+	if name == "" {
+		f.fail("empty name")
+		return ""
+	}
+	plain := LookupIdent(name) == IDENT
+	for i, r := range name {
+		if (i == 0 && !isIdentStart(r)) || !isIdentPart(r) {
+			plain = false
+		}
+	}
+	if plain {
+		return name
+	}
+	if strings.ContainsRune(name, '`') {
+		f.fail("name %q cannot contain '`'", name)
+	}
+	return "`" + name + "`"
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// isNumber reports whether s lexes as a single NUMBER token
+func isNumber(s string) bool {
+	digits := 0
+	dot := false
+	for i, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '.' && !dot && i > 0:
+			dot = true
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
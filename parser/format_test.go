@@ -0,0 +1,237 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatBuilders(t *testing.T) {
+	id := Field("id", Type(BaseUUID))
+	id.PrimaryKey = true
+	name := Field("name", Type(BaseString))
+	name.NotNull = true
+	name.Default = Str("n/a")
+
+	tests := []struct {
+		name string
+		stmt Stmt
+		want string
+	}{
+		{
+			name: "create node",
+			stmt: CreateNode("Person", id, name, Field("tags", ArrayOf(Type(BaseString))), Field("mood", EnumOf("ok", "it's fine"))),
+			want: "CREATE NODE Person (id: uuid PRIMARY KEY, name: string NOT NULL DEFAULT 'n/a', tags: array<string>, mood: enum<'ok', 'it''s fine'>);",
+		},
+		{
+			name: "create edge",
+			stmt: CreateEdge("KNOWS", Many("Person"), One("Person"), Field("since", Type(BaseDate))),
+			want: "CREATE EDGE KNOWS (FROM Person MANY, TO Person ONE, PROPS (since: date));",
+		},
+		{
+			name: "insert node quotes strings and keyword names",
+			stmt: InsertNode("Person", Prop("name", Str("O'Neil")), Prop("from", Int(3)), Prop("ok", Bool(true)), Prop("x", Null())),
+			want: "INSERT NODE Person (name: 'O''Neil', `from`: 3, ok: true, x: null);",
+		},
+		{
+			name: "insert edge",
+			stmt: InsertEdge("KNOWS", NodeByID("Person", Int(1)), NodeWhere("Person", Prop("name", Str("Bob"))), Prop("w", Float(0.5))),
+			want: "INSERT EDGE KNOWS FROM Person(1) TO Person(name: 'Bob') (w: 0.5);",
+		},
+		{
+			name: "update node",
+			stmt: UpdateNode("Person", []Property{Prop("age", Int(31))}, Prop("name", Str("Ann"))),
+			want: "UPDATE NODE Person SET age: 31 WHERE name: 'Ann';",
+		},
+		{
+			name: "delete edge",
+			stmt: DeleteEdge("KNOWS", Prop("w", Float(0.5))),
+			want: "DELETE EDGE KNOWS WHERE w: 0.5;",
+		},
+		{
+			name: "delete edge between",
+			stmt: DeleteEdgeBetween("KNOWS", NodeByID("Person", Int(1)), NodeWhere("Person", Prop("name", Str("Bob")))),
+			want: "DELETE EDGE KNOWS FROM Person(1) TO Person(name: 'Bob');",
+		},
+		{
+			name: "match with odd names",
+			stmt: &MatchStmt{Pattern: []MatchElement{{Type: "My Type"}}, Return: []string{"name", "match"}},
+			want: "MATCH `My Type` RETURN name, `match`;",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format(tt.stmt)
+			if err != nil {
+				t.Fatalf("format: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got  %s\nwant %s", got, tt.want)
+			}
+			if _, errs := NewParser(got).ParseScript(); len(errs) > 0 {
+				t.Fatalf("formatted statement does not parse: %v", errs)
+			}
+		})
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	script := `
+		CREATE NODE User (id: uuid PRIMARY KEY, email: string UNIQUE NOT NULL, score: float DEFAULT 1.5);
+		CREATE EDGE FOLLOWS (FROM User MANY, TO User MANY, PROPS (since: datetime TTL 'P30D'));
+		CREATE NODE Doc (embedding: vector<float, 3>);
+		ALTER NODE User ADD nick: text;
+		ALTER NODE User MODIFY nick: text INDEX;
+		ALTER NODE User DROP nick;
+		ALTER NODE User MODIFY score: int NOT NULL;
+		ALTER NODE User SET PRIMARY KEY (email);
+		ALTER EDGE FOLLOWS ADD weight: float;
+		ALTER EDGE FOLLOWS DROP weight;
+		ALTER EDGE FOLLOWS SET FROM User ONE TO User MANY;
+		INSERT NODE User (email: 'a@b.c', score: 2);
+		INSERT EDGE FOLLOWS FROM User('1') TO User(email: 'a@b.c');
+		UPDATE EDGE FOLLOWS SET since: null WHERE since: '2024-01-01';
+		DELETE NODE User WHERE email: 'a@b.c';
+		MATCH User u WHERE score: 2 RETURN email;
+		MATCH User u RETURN DISTINCT u.email, score LIMIT 3;
+		MATCH User u WHERE u.email: 'a', score: 1, u.score IN (1, 2) OR NOT u.email STARTS WITH 'b' RETURN u.email;
+		MATCH (a:User)-[f:FOLLOWS]->(b) WHERE a.score BETWEEN 1 AND 2, f.since: null RETURN b;
+		MATCH User RETURN distinct LIMIT 1;
+		MATCH User WHERE score: 2, (email: 'a' OR NOT email: 'b') AND (score: 1 OR score: 3);
+		MATCH User WHERE NOT (score: 1 AND email: 'a') OR score: 2 AND NOT NOT score: 3 RETURN email;
+		UPDATE NODE User SET score: 1 WHERE email: 'a' OR email: 'b';
+		DELETE NODE User WHERE NOT email: 'a';
+		MATCH User WHERE email IN ('a', 'b', null) AND score BETWEEN 1 AND 2.5 OR NOT score IN (3);
+		UPDATE EDGE FOLLOWS SET since: null WHERE since BETWEEN '2020-01-01' AND '2021-01-01';
+		MATCH User WHERE email STARTS WITH 'a' OR email ENDS WITH '.org' AND NOT email CONTAINS 'spam', email =~ '[a-z]+@.*';
+		MATCH User u WHERE EXISTS (MATCH (u)-[:FOLLOWS]->(v:User) WHERE v.email: 'a') OR NOT EXISTS (MATCH (u)<-[:FOLLOWS]-());
+		MATCH User u RETURN DISTINCT u.email, CASE WHEN u.score BETWEEN 1 AND 5 OR u.email: null THEN 'low' WHEN u.score IN (6) THEN 6 ELSE false END AS band;
+		UPDATE NODE User SET band: CASE WHEN score: 1 THEN 'one' END, flag: true WHERE email ENDS WITH '.org';
+		MATCH User u WHERE u.seen >= now() - duration('P7D') + duration('PT1H') OR u.born < date(), u.score > 2 RETURN CASE WHEN u.score <= 5 THEN 'low' END AS band;
+		DELETE NODE User WHERE score >= 10;
+		MERGE NODE User (email: 'a') ON MATCH SET score: CASE WHEN score: null THEN 1 END ON CREATE SET score: 0, flag: true;
+		INSERT NODE User (email: 'a') ON CONFLICT DO NOTHING;
+		INSERT NODE User (email: 'j', meta: {"tags": ["a", 'b'], "n": -1.5, "ok": true, "no": null, "q": "it's \"x\""});
+		UPDATE NODE User SET meta: [] WHERE meta.address.city: 'Bern' OR meta.n > 2;
+		INSERT NODE User (email: 'a', score: 2) ON CONFLICT DO UPDATE;
+		INSERT NODE User (email: 'a') ON CONFLICT DO UPDATE SET score: CASE WHEN score: null THEN 1 END;
+		UPDATE NODE User SET score: (score + 1) * 2 - (score - (1 - score)) / 3, email: lower(trim(email)) WHERE email: 'a';
+		MATCH (a:User)-[f:FOLLOWS]->(b) SET f.since: coalesce(f.since, b.score * 1.5), a.email: concat(a.email, '+', length(b.email));
+		MERGE EDGE FOLLOWS FROM User(email: 'a') TO User(7) (since: 2020);
+		MATCH (a:User)-[f:FOLLOWS]->(b) WHERE b.score > 3 SET a.flag: true, f.since: CASE WHEN b.score: 5 THEN 2020 END;
+		MATCH (a:User {email: 'a'})-[f:FOLLOWS*1..2]->() DELETE f, a;
+		DELETE EDGE FOLLOWS WHERE since: 1 OR (since: 2 OR since: 3);
+		DELETE EDGE FOLLOWS FROM User(email: 'a') TO User(7) WHERE since: 1 OR since > 2;
+		MATCH Doc ORDER BY SIMILARITY(embedding, '[0.1, 0.2, 0.3]') LIMIT 10;
+		MATCH Doc d WHERE d.lang: 'en' ORDER BY DISTANCE(d.embedding, '[1, 0, 0]') LIMIT 3;
+		MATCH Doc WHERE lang: 'en' ORDER BY distance(embedding, '[1, 0, 0]');
+		MATCH User LIMIT 5;
+		MATCH (p:Person {name: 'Ann'})-[w:WORKS_AT]->(c:Company) RETURN p.name, w, c.founded LIMIT 10;
+		MATCH (a)<-[:FOLLOWS]-(b:User)-[]-(c), (c)-[e {since: 2020}]->(:Team);
+		MATCH (a:User)-[k:KNOWS*1..3]->(b), (b)-[*]-(c)<-[*2]-(d)-[:KNOWS*0.. {since: 2020}]->(e) LIMIT 5;
+		MATCH p = (a:User)-[:KNOWS*]->(b), (b)-[]-(c), q = (c) RETURN DISTINCT p, q, b.name;
+		MATCH (c:Company) WHERE c.size > 10 WITH c LIMIT 3 MATCH (p)-[w:WORKS_AT]->(c) WITH p, w MATCH (p)-[]-(f) SET f.seen: true;
+		CREATE FULLTEXT INDEX ON Article(title, body) WITH STEMMING;
+		MATCH Article WHERE MATCHES(body, 'graph database'), lang: 'en' LIMIT 3;
+		MATCH Article WHERE matches: 1;
+		CREATE NODE Place (name: string, location: point, point: int);
+		MATCH Place WHERE WITHIN(location, '52.52, 13.405', 5km), MATCHES(name, 'cafe') ORDER BY DISTANCE(location, '52.52, 13.405');
+		MATCH Place WHERE WITHIN(location, '0, 0', 250) LIMIT 2;
+		DROP FULLTEXT INDEX ON Article(body);
+		EXPORT TO 'dump.jsonl';
+		EXPORT MATCH User WHERE score: 2 TO 'users.dot';
+		EXPORT NODE User TO 'users.parquet';
+		SHOW STATS;
+		SHOW STATS User;
+		VACUUM;
+		VACUUM Follows;
+		BACKUP TO 'backup.tar.gz';
+		BACKUP TO 'backup-2.tar' SINCE 120;
+		DROP EDGE FOLLOWS;
+		DROP NODE User;
+	`
+	stmts, errs := NewParser(script).ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("parse: %v", errs)
+	}
+	first, err := FormatScript(stmts)
+	if err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	again, errs := NewParser(first).ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("reparse: %v\n%s", errs, first)
+	}
+	second, err := FormatScript(again)
+	if err != nil {
+		t.Fatalf("format again: %v", err)
+	}
+	if first != second {
+		t.Fatalf("formatting is not stable:\n%s\n---\n%s", first, second)
+	}
+	if n := strings.Count(first, "\n") + 1; n != len(stmts) {
+		t.Fatalf("expected %d lines, got %d", len(stmts), n)
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	bad := []Stmt{
+		InsertNode("Person", Prop("age", Int(-1))),
+		InsertNode("Per`son"),
+		DeleteNode("Person"),
+		InsertNode("Person", Prop("x", nil)),
+	}
+	for _, st := range bad {
+		if s, err := Format(st); err == nil {
+			t.Errorf("expected error, got %s", s)
+		}
+	}
+}
+
+func TestWalkAndInspect(t *testing.T) {
+	stmts, errs := NewParser("INSERT EDGE E FROM A(1) TO B(name: 'x') (w: 2); MATCH A WHERE k: true;").ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("parse: %v", errs)
+	}
+
+	var literals []string
+	for _, st := range stmts {
+		Inspect(st, func(n Node) bool {
+			if lit, ok := n.(*Literal); ok {
+				literals = append(literals, lit.Text)
+			}
+			return true
+		})
+	}
+	if got := strings.Join(literals, ","); got != "1,x,2,true" {
+		t.Fatalf("literals = %s", got)
+	}
+
+	// visitors may rewrite the tree in place
+	Inspect(stmts[0], func(n Node) bool {
+		if p, ok := n.(*Property); ok && p.Name == "name" {
+			p.Value = Str("y")
+		}
+		return true
+	})
+	got, err := Format(stmts[0])
+	if err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	if got != "INSERT EDGE E FROM A(1) TO B(name: 'y') (w: 2);" {
+		t.Fatalf("got %s", got)
+	}
+
+	// returning false skips children
+	count := 0
+	Inspect(stmts[0], func(n Node) bool {
+		if n != nil {
+			count++
+		}
+		_, isRef := n.(*NodeRef)
+		return !isRef
+	})
+	if count != 5 { // stmt, 2 refs, property, literal
+		t.Fatalf("visited %d nodes, want 5", count)
+	}
+}
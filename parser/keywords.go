@@ -51,6 +51,14 @@ var keywords = map[string]TokenType{
 	"MATCH":    MATCH,
 	"WHERE":    WHERE,
 	"RETURN":   RETURN,
+	"RETURNING": RETURNING,
+	"EXPORT":   EXPORT,
+	"STATS":    STATS,
+	"VECTOR":   VECTOR,
+	"FULLTEXT": FULLTEXT,
+	"MERGE":    MERGE,
+	"VACUUM":   VACUUM,
+	"BACKUP":   BACKUP,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"unicode"
@@ -56,10 +58,21 @@ func (l *Lexer) NextToken() Token {
 		return l.makeToken(RPAREN, ")")
 	case '<':
 		l.advance()
+		if l.peek() == '=' {
+			l.advance()
+			return l.makeToken(LE, "<=")
+		}
 		return l.makeToken(LT, "<")
 	case '>':
 		l.advance()
+		if l.peek() == '=' {
+			l.advance()
+			return l.makeToken(GE, ">=")
+		}
 		return l.makeToken(GT, ">")
+	case '+':
+		l.advance()
+		return l.makeToken(PLUS, "+")
 	case ',':
 		l.advance()
 		return l.makeToken(COMMA, ",")
@@ -69,10 +82,50 @@ func (l *Lexer) NextToken() Token {
 	case ':':
 		l.advance()
 		return l.makeToken(COLON, ":")
+	case '[':
+		l.advance()
+		return l.makeToken(LBRACK, "[")
+	case ']':
+		l.advance()
+		return l.makeToken(RBRACK, "]")
+	case '{':
+		l.advance()
+		return l.makeToken(LBRACE, "{")
+	case '}':
+		l.advance()
+		return l.makeToken(RBRACE, "}")
+	case '-':
+		// "--" starts a comment, handled above
+		l.advance()
+		return l.makeToken(DASH, "-")
+	case '.':
+		l.advance()
+		if l.peek() == '.' {
+			l.advance()
+			return l.makeToken(DOTDOT, "..")
+		}
+		return l.makeToken(DOT, ".")
+	case '*':
+		l.advance()
+		return l.makeToken(STAR, "*")
+	case '/':
+		// "/*" starts a comment, handled above
+		l.advance()
+		return l.makeToken(SLASH, "/")
+	case '=':
+		if l.peekN(1) == '~' {
+			l.advance()
+			l.advance()
+			return l.makeToken(REGEX, "=~")
+		}
+		l.advance()
+		return l.makeToken(EQ, "=")
 	case '`':
 		return l.lexQuotedIdent()
 	case '\'':
 		return l.lexString()
+	case '"':
+		return l.lexJSONString()
 	}
 
 	// Identifiers / keywords / booleans / null
@@ -95,6 +148,9 @@ func (l *Lexer) lexIdentOrKeyword() Token {
 		l.advance()
 	}
 	lit := l.input[l.start:l.pos]
+	if strings.EqualFold(lit, "b64") && l.peek() == '\'' {
+		return l.lexBlob()
+	}
 	tokType := LookupIdent(lit)
 	if tokType == BOOL {
 		return l.makeToken(BOOL, strings.ToLower(lit))
@@ -144,11 +200,52 @@ func (l *Lexer) lexString() Token {
 	return l.makeToken(STRING, string(val))
 }
 
+// lexBlob lexes the quoted base64 of a blob literal, b64'...', padded or
+// not, giving it padded
+func (l *Lexer) lexBlob() Token {
+	t := l.lexString()
+	if t.Type != STRING {
+		return t
+	}
+	b, err := base64.StdEncoding.DecodeString(t.Lit)
+	if err != nil {
+		if b, err = base64.RawStdEncoding.DecodeString(t.Lit); err != nil {
+			return l.errorToken(fmt.Sprintf("invalid base64 in blob literal %q", t.Lit))
+		}
+	}
+	t.Type, t.Lit = BLOBSTR, base64.StdEncoding.EncodeToString(b)
+	return t
+}
+
+// lexJSONString lexes a double-quoted string, escaped as in JSON, which only
+// JSON literals take
+func (l *Lexer) lexJSONString() Token {
+	l.advance() // skip opening quote
+	for {
+		if l.pos >= len(l.input) {
+			return l.errorToken("unterminated string literal")
+		}
+		switch l.peek() {
+		case '\\':
+			l.advance()
+		case '"':
+			l.advance()
+			var val string
+			if err := json.Unmarshal([]byte(l.input[l.start:l.pos]), &val); err != nil {
+				return l.errorToken(fmt.Sprintf("invalid JSON string %s", l.input[l.start:l.pos]))
+			}
+			return l.makeToken(DQSTRING, val)
+		}
+		l.advance()
+	}
+}
+
 func (l *Lexer) lexNumber() Token {
 	for unicode.IsDigit(l.peek()) {
 		l.advance()
 	}
-	if l.peek() == '.' {
+	// 1..3 is a range, not 1. followed by .3
+	if l.peek() == '.' && l.peekN(1) != '.' {
 		l.advance()
 		for unicode.IsDigit(l.peek()) {
 			l.advance()
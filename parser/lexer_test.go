@@ -164,7 +164,7 @@ func TestBooleansAndNullNormalization(t *testing.T) {
 }
 
 func TestSymbols(t *testing.T) {
-	input := `( ) < > , ; :`
+	input := `( ) < > , ; : [ ] { } - . .. * =~ <= >= + = 1..3`
 	want := []Token{
 		{Type: LPAREN, Lit: "("},
 		{Type: RPAREN, Lit: ")"},
@@ -173,6 +173,22 @@ func TestSymbols(t *testing.T) {
 		{Type: COMMA, Lit: ","},
 		{Type: SEMI, Lit: ";"},
 		{Type: COLON, Lit: ":"},
+		{Type: LBRACK, Lit: "["},
+		{Type: RBRACK, Lit: "]"},
+		{Type: LBRACE, Lit: "{"},
+		{Type: RBRACE, Lit: "}"},
+		{Type: DASH, Lit: "-"},
+		{Type: DOT, Lit: "."},
+		{Type: DOTDOT, Lit: ".."},
+		{Type: STAR, Lit: "*"},
+		{Type: REGEX, Lit: "=~"},
+		{Type: LE, Lit: "<="},
+		{Type: GE, Lit: ">="},
+		{Type: PLUS, Lit: "+"},
+		{Type: EQ, Lit: "="},
+		{Type: NUMBER, Lit: "1"},
+		{Type: DOTDOT, Lit: ".."},
+		{Type: NUMBER, Lit: "3"},
 		{Type: EOF, Lit: ""},
 	}
 	assertTokens(t, input, want)
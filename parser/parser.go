@@ -1,13 +1,17 @@
 package parser
 
 import (
+	"encoding/json"
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
 type Parser struct {
 	l   *Lexer
 	tok Token
-	// one-token lookahead only; lexer already provides tokens
+	// one token of lookahead, and peek for a second
 	errors []ParseError
 }
 
@@ -19,6 +23,17 @@ type ParseError struct {
 
 func (e ParseError) Error() string { return fmt.Sprintf("%d:%d: %s", e.Line, e.Col, e.Msg) }
 
+// ParseErrors is the error form of the list ParseScript returns
+type ParseErrors []ParseError
+
+func (e ParseErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, pe := range e {
+		msgs[i] = pe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
 func NewParser(input string) *Parser {
 	lex := NewLexer(input)
 	p := &Parser{l: lex}
@@ -30,6 +45,12 @@ func (p *Parser) next() {
 	p.tok = p.l.NextToken()
 }
 
+// peek returns the token after p.tok without moving past it
+func (p *Parser) peek() Token {
+	l := *p.l
+	return l.NextToken()
+}
+
 func (p *Parser) expect(tt TokenType) Token {
 	t := p.tok
 	if t.Type != tt {
@@ -98,6 +119,16 @@ func (p *Parser) parseStmt() Stmt {
 		return p.parseDelete()
 	case MATCH:
 		return p.parseMatch()
+	case MERGE:
+		return p.parseMerge()
+	case EXPORT:
+		return p.parseExport()
+	case SHOW:
+		return p.parseShow()
+	case VACUUM:
+		return p.parseVacuum()
+	case BACKUP:
+		return p.parseBackup()
 	default:
 		t := p.tok
 		p.errf(t.Line, t.Column, "unexpected token %v at start of statement", t.Type)
@@ -115,9 +146,12 @@ func (p *Parser) parseCreate() Stmt {
 	case EDGE:
 		p.next()
 		return p.parseCreateEdge(createTok.Line, createTok.Column)
+	case FULLTEXT:
+		p.next()
+		return p.parseCreateFulltextIndex(createTok.Line, createTok.Column)
 	default:
 		t := p.tok
-		p.errf(t.Line, t.Column, "expected NODE or EDGE after CREATE")
+		p.errf(t.Line, t.Column, "expected NODE, EDGE or FULLTEXT after CREATE")
 		return nil
 	}
 }
@@ -168,6 +202,9 @@ loop:
 		case UNIQUE:
 			p.next()
 			fd.Unique = true
+		case INDEX:
+			p.next()
+			fd.Index = true
 		case NOT:
 			p.next()
 			p.expect(NULL)
@@ -177,13 +214,25 @@ loop:
 			lit := p.parseLiteral()
 			fd.Default = &lit
 		default:
-			break loop
+			// ttl is not a keyword, so fields may still be called ttl
+			if !p.matchWord("ttl") {
+				break loop
+			}
+			d := p.expect(STRING)
+			if _, err := ParseDuration(d.Lit); err != nil {
+				p.errf(d.Line, d.Column, "TTL: %v", err)
+			}
+			fd.TTL = d.Lit
 		}
 	}
 	return fd
 }
 
 func (p *Parser) parseTypeSpec() TypeSpec {
+	// point is not a keyword, so fields may still be called point
+	if p.matchWord("point") {
+		return TypeSpec{Base: BasePoint}
+	}
 	switch p.tok.Type {
 	case STRINGKW:
 		p.next()
@@ -218,6 +267,18 @@ func (p *Parser) parseTypeSpec() TypeSpec {
 	case BLOB:
 		p.next()
 		return TypeSpec{Base: BaseBlob}
+	case VECTOR:
+		p.next()
+		p.expect(LT)
+		p.expect(FLOAT)
+		p.expect(COMMA)
+		t := p.expect(NUMBER)
+		dim, err := strconv.Atoi(t.Lit)
+		if err != nil || dim < 1 {
+			p.errf(t.Line, t.Column, "vector length must be a positive integer, found %q", t.Lit)
+		}
+		p.expect(GT)
+		return TypeSpec{Base: BaseVector, Dim: dim}
 
 	case ARRAY:
 		p.next()
@@ -257,12 +318,21 @@ func (p *Parser) parseLiteral() Literal {
 	case NUMBER:
 		p.next()
 		return Literal{Kind: LitNumber, Text: t.Lit, Line: t.Line, Col: t.Column}
+	case BLOBSTR:
+		p.next()
+		return Literal{Kind: LitBlob, Text: t.Lit, Line: t.Line, Col: t.Column}
 	case BOOL:
 		p.next()
 		return Literal{Kind: LitBool, Text: t.Lit, Line: t.Line, Col: t.Column}
 	case NULL:
 		p.next()
 		return Literal{Kind: LitNull, Text: "null", Line: t.Line, Col: t.Column}
+	case LBRACE, LBRACK:
+		v, ok := p.parseJSON()
+		if !ok {
+			return Literal{Kind: LitNull, Text: "null", Line: t.Line, Col: t.Column}
+		}
+		return Literal{Kind: LitJSON, Text: CompactJSON(v), Line: t.Line, Col: t.Column}
 	default:
 		p.errf(t.Line, t.Column, "expected literal, found %v", t.Type)
 		p.next()
@@ -270,6 +340,93 @@ func (p *Parser) parseLiteral() Literal {
 	}
 }
 
+// parseJSON parses a JSON value, as encoding/json would decode it with
+// numbers as json.Number. Strings may also be quoted as in the language, and
+// negative numbers written with a space after the sign. It reports false
+// after an error.
+func (p *Parser) parseJSON() (any, bool) {
+	t := p.tok
+	switch t.Type {
+	case STRING, DQSTRING:
+		p.next()
+		return t.Lit, true
+	case NUMBER:
+		p.next()
+		return json.Number(t.Lit), true
+	case DASH:
+		p.next()
+		n := p.tok
+		if n.Type != NUMBER {
+			p.errf(n.Line, n.Column, "expected a number after -, found %v (%q)", n.Type, n.Lit)
+			return nil, false
+		}
+		p.next()
+		return json.Number("-" + n.Lit), true
+	case BOOL:
+		p.next()
+		return t.Lit == "true", true
+	case NULL:
+		p.next()
+		return nil, true
+	case LBRACK:
+		p.next()
+		list := []any{}
+		for !p.match(RBRACK) {
+			if len(list) > 0 && !p.match(COMMA) {
+				p.errf(p.tok.Line, p.tok.Column, "expected , or ] in a JSON array, found %v (%q)", p.tok.Type, p.tok.Lit)
+				return nil, false
+			}
+			v, ok := p.parseJSON()
+			if !ok {
+				return nil, false
+			}
+			list = append(list, v)
+		}
+		return list, true
+	case LBRACE:
+		p.next()
+		obj := map[string]any{}
+		for first := true; !p.match(RBRACE); first = false {
+			if !first && !p.match(COMMA) {
+				p.errf(p.tok.Line, p.tok.Column, "expected , or } in a JSON object, found %v (%q)", p.tok.Type, p.tok.Lit)
+				return nil, false
+			}
+			k := p.tok
+			if k.Type != STRING && k.Type != DQSTRING {
+				p.errf(k.Line, k.Column, "expected a quoted key in a JSON object, found %v (%q)", k.Type, k.Lit)
+				return nil, false
+			}
+			p.next()
+			if p.tok.Type != COLON {
+				p.errf(p.tok.Line, p.tok.Column, "expected : after the key %q, found %v (%q)", k.Lit, p.tok.Type, p.tok.Lit)
+				return nil, false
+			}
+			p.next()
+			v, ok := p.parseJSON()
+			if !ok {
+				return nil, false
+			}
+			obj[k.Lit] = v
+		}
+		return obj, true
+	}
+	p.errf(t.Line, t.Column, "expected a JSON value, found %v (%q)", t.Type, t.Lit)
+	return nil, false
+}
+
+// CompactJSON returns v, a value encoding/json can encode, as the Text of a
+// JSON literal: without spaces, with object keys in order, and with <, > and
+// & as they are
+func CompactJSON(v any) string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "null"
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
 /* ---------------------- CREATE EDGE ----------------------- */
 
 func (p *Parser) parseCreateEdge(line, col int) *CreateEdgeStmt {
@@ -451,9 +608,13 @@ func (p *Parser) parseDrop() Stmt {
 	case EDGE:
 		p.next()
 		return p.parseDropEdge(dropTok.Line, dropTok.Column)
+	case FULLTEXT:
+		p.next()
+		nodeType, fields := p.parseIndexTarget()
+		return &DropFulltextIndexStmt{NodeType: nodeType, Fields: fields, Line: dropTok.Line, Col: dropTok.Column}
 	default:
 		t := p.tok
-		p.errf(t.Line, t.Column, "expected NODE or EDGE after DROP")
+		p.errf(t.Line, t.Column, "expected NODE, EDGE or FULLTEXT after DROP")
 		return nil
 	}
 }
@@ -476,6 +637,38 @@ func (p *Parser) parseDropEdge(line, col int) *DropEdgeStmt {
 	}
 }
 
+/* ---------------------- FULLTEXT INDEX ----------------------- */
+
+func (p *Parser) parseCreateFulltextIndex(line, col int) *CreateFulltextIndexStmt {
+	nodeType, fields := p.parseIndexTarget()
+	stmt := &CreateFulltextIndexStmt{NodeType: nodeType, Fields: fields, Line: line, Col: col}
+	// WITH STEMMING; neither word is a keyword
+	if p.matchWord("WITH") {
+		if !p.matchWord("STEMMING") {
+			p.errf(p.tok.Line, p.tok.Column, "expected STEMMING after WITH, found %v (%q)", p.tok.Type, p.tok.Lit)
+		}
+		stmt.Stem = true
+	}
+	return stmt
+}
+
+// parseIndexTarget parses INDEX ON type(field, ...)
+func (p *Parser) parseIndexTarget() (string, []string) {
+	p.expect(INDEX)
+	p.expect(ON)
+	nodeType := p.expect(IDENT).Lit
+	p.expect(LPAREN)
+	var fields []string
+	for {
+		fields = append(fields, p.expect(IDENT).Lit)
+		if !p.match(COMMA) {
+			break
+		}
+	}
+	p.expect(RPAREN)
+	return nodeType, fields
+}
+
 /* ---------------------- DML statements ---------------------- */
 
 // parseInsert handles INSERT NODE and INSERT EDGE statements
@@ -508,12 +701,37 @@ func (p *Parser) parseInsertNode(line, col int) *InsertNodeStmt {
 		p.expect(RPAREN)
 	}
 
-	return &InsertNodeStmt{
+	stmt := &InsertNodeStmt{
 		NodeType:   nodeType,
 		Properties: properties,
 		Line:       line,
 		Col:        col,
 	}
+	if p.match(ON) {
+		stmt.OnConflict = p.parseOnConflict()
+	}
+	return stmt
+}
+
+// parseOnConflict parses CONFLICT DO NOTHING or CONFLICT DO UPDATE [SET ...]
+// after the ON of an INSERT NODE. None of the three words is a keyword.
+func (p *Parser) parseOnConflict() *OnConflict {
+	if !p.matchWord("CONFLICT") || !p.matchWord("DO") {
+		p.errf(p.tok.Line, p.tok.Column, "expected CONFLICT DO after ON, found %v (%q)", p.tok.Type, p.tok.Lit)
+		return nil
+	}
+	oc := &OnConflict{}
+	switch {
+	case p.matchWord("NOTHING"):
+	case p.match(UPDATE):
+		oc.Update = true
+		if p.match(SET) {
+			oc.Set = p.parseSetList(false)
+		}
+	default:
+		p.errf(p.tok.Line, p.tok.Column, "expected NOTHING or UPDATE after DO, found %v (%q)", p.tok.Type, p.tok.Lit)
+	}
+	return oc
 }
 
 // parseInsertEdge handles INSERT EDGE statements
@@ -548,6 +766,61 @@ func (p *Parser) parseInsertEdge(line, col int) *InsertEdgeStmt {
 	}
 }
 
+// parseMerge handles MERGE NODE type (props) and MERGE EDGE type FROM ref TO
+// ref [(props)], each followed by ON CREATE SET ... and ON MATCH SET ... in
+// either order
+func (p *Parser) parseMerge() Stmt {
+	line, col := p.tok.Line, p.tok.Column
+	p.expect(MERGE)
+	var stmt Stmt
+	var onCreate, onMatch *[]Property
+	switch p.tok.Type {
+	case NODE:
+		p.next()
+		s := &MergeNodeStmt{NodeType: p.expect(IDENT).Lit, Line: line, Col: col}
+		p.expect(LPAREN)
+		s.Properties = p.parsePropertyList()
+		p.expect(RPAREN)
+		stmt, onCreate, onMatch = s, &s.OnCreate, &s.OnMatch
+	case EDGE:
+		p.next()
+		s := &MergeEdgeStmt{EdgeType: p.expect(IDENT).Lit, Line: line, Col: col}
+		p.expect(FROM)
+		s.FromNode = p.parseNodeRef()
+		p.expect(TO)
+		s.ToNode = p.parseNodeRef()
+		if p.match(LPAREN) {
+			s.Properties = p.parsePropertyList()
+			p.expect(RPAREN)
+		}
+		stmt, onCreate, onMatch = s, &s.OnCreate, &s.OnMatch
+	default:
+		p.errf(p.tok.Line, p.tok.Column, "expected NODE or EDGE after MERGE, found %v", p.tok.Type)
+		return nil
+	}
+	for p.tok.Type == ON {
+		t := p.tok
+		p.next()
+		var set *[]Property
+		switch p.tok.Type {
+		case CREATE:
+			set = onCreate
+		case MATCH:
+			set = onMatch
+		default:
+			p.errf(p.tok.Line, p.tok.Column, "expected CREATE or MATCH after ON, found %v", p.tok.Type)
+			return stmt
+		}
+		if *set != nil {
+			p.errf(t.Line, t.Column, "ON %v SET given twice", p.tok.Type)
+		}
+		p.next()
+		p.expect(SET)
+		*set = p.parseSetList(false)
+	}
+	return stmt
+}
+
 // parseUpdate handles UPDATE NODE and UPDATE EDGE statements
 func (p *Parser) parseUpdate() Stmt {
 	line, col := p.tok.Line, p.tok.Column
@@ -573,20 +846,25 @@ func (p *Parser) parseUpdateNode(line, col int) *UpdateNodeStmt {
 
 	// Parse SET clause
 	p.expect(SET)
-	setProps := p.parsePropertyList()
+	setProps := p.parseSetList(false)
 
 	// Parse optional WHERE clause
-	var whereProps []Property
+	var (
+		whereProps []Property
+		filter     Expr
+	)
 	if p.match(WHERE) {
-		whereProps = p.parsePropertyList()
+		whereProps, filter = p.parseWhere()
 	}
 
 	return &UpdateNodeStmt{
-		NodeType: nodeType,
-		Set:      setProps,
-		Where:    whereProps,
-		Line:     line,
-		Col:      col,
+		NodeType:  nodeType,
+		Set:       setProps,
+		Where:     whereProps,
+		Filter:    filter,
+		Returning: p.parseReturning(),
+		Line:      line,
+		Col:       col,
 	}
 }
 
@@ -599,20 +877,25 @@ func (p *Parser) parseUpdateEdge(line, col int) *UpdateEdgeStmt {
 
 	// Parse SET clause
 	p.expect(SET)
-	setProps := p.parsePropertyList()
+	setProps := p.parseSetList(false)
 
 	// Parse optional WHERE clause
-	var whereProps []Property
+	var (
+		whereProps []Property
+		filter     Expr
+	)
 	if p.match(WHERE) {
-		whereProps = p.parsePropertyList()
+		whereProps, filter = p.parseWhere()
 	}
 
 	return &UpdateEdgeStmt{
-		EdgeType: edgeType,
-		Set:      setProps,
-		Where:    whereProps,
-		Line:     line,
-		Col:      col,
+		EdgeType:  edgeType,
+		Set:       setProps,
+		Where:     whereProps,
+		Filter:    filter,
+		Returning: p.parseReturning(),
+		Line:      line,
+		Col:       col,
 	}
 }
 
@@ -641,33 +924,57 @@ func (p *Parser) parseDeleteNode(line, col int) *DeleteNodeStmt {
 
 	// Parse WHERE clause
 	p.expect(WHERE)
-	whereProps := p.parsePropertyList()
+	whereProps, filter := p.parseWhere()
 
 	return &DeleteNodeStmt{
-		NodeType: nodeType,
-		Where:    whereProps,
-		Line:     line,
-		Col:      col,
+		NodeType:  nodeType,
+		Where:     whereProps,
+		Filter:    filter,
+		Returning: p.parseReturning(),
+		Line:      line,
+		Col:       col,
 	}
 }
 
-// parseDeleteEdge handles DELETE EDGE statements
+// parseDeleteEdge handles DELETE EDGE statements, which name the edges by a
+// WHERE, by FROM ref TO ref, or by both
 func (p *Parser) parseDeleteEdge(line, col int) *DeleteEdgeStmt {
 	p.expect(EDGE)
 
 	// Parse edge type
 	edgeType := p.expect(IDENT).Lit
+	stmt := &DeleteEdgeStmt{EdgeType: edgeType, Line: line, Col: col}
 
-	// Parse WHERE clause
-	p.expect(WHERE)
-	whereProps := p.parsePropertyList()
+	// Parse optional FROM ... TO ..., as in INSERT EDGE
+	if p.match(FROM) {
+		stmt.FromNode = p.parseNodeRef()
+		p.expect(TO)
+		stmt.ToNode = p.parseNodeRef()
+		if p.match(WHERE) {
+			stmt.Where, stmt.Filter = p.parseWhere()
+		}
+	} else {
+		p.expect(WHERE)
+		stmt.Where, stmt.Filter = p.parseWhere()
+	}
+	stmt.Returning = p.parseReturning()
+	return stmt
+}
 
-	return &DeleteEdgeStmt{
-		EdgeType: edgeType,
-		Where:    whereProps,
-		Line:     line,
-		Col:      col,
+// parseReturning parses the RETURNING * or RETURNING field, ... an UPDATE
+// or DELETE may end with, returning nil if there is none
+func (p *Parser) parseReturning() []string {
+	if !p.match(RETURNING) {
+		return nil
+	}
+	if p.match(STAR) {
+		return []string{"*"}
 	}
+	fields := []string{p.expect(IDENT).Lit}
+	for p.match(COMMA) {
+		fields = append(fields, p.expect(IDENT).Lit)
+	}
+	return fields
 }
 
 // parseMatch handles MATCH statements for querying
@@ -676,10 +983,21 @@ func (p *Parser) parseMatch() *MatchStmt {
 	p.expect(MATCH)
 
 	// Parse pattern elements
-	var pattern []MatchElement
+	var (
+		pattern []MatchElement
+		paths   []PathPattern
+	)
+	if p.tok.Type == LPAREN || p.tok.Type == IDENT && p.peek().Type == EQ {
+		for {
+			paths = append(paths, p.parsePath())
+			if !p.match(COMMA) {
+				break
+			}
+		}
+	}
 
 	// Simple pattern parsing - can be extended for more complex patterns
-	for p.tok.Type == IDENT {
+	for paths == nil && p.tok.Type == IDENT {
 		element := MatchElement{
 			Type:   p.tok.Lit,
 			IsEdge: false, // Simplified - assume nodes for now
@@ -689,7 +1007,7 @@ func (p *Parser) parseMatch() *MatchStmt {
 		p.next()
 
 		// Optional alias
-		if p.tok.Type == IDENT {
+		if p.tok.Type == IDENT && !p.isWord("ORDER") && !p.isWord("LIMIT") {
 			element.Alias = p.tok.Lit
 			p.next()
 		}
@@ -702,29 +1020,673 @@ func (p *Parser) parseMatch() *MatchStmt {
 	}
 
 	// Parse optional WHERE clause
-	var whereProps []Property
+	var (
+		whereProps []Property
+		filter     Expr
+		search     []TextMatch
+		within     []GeoWithin
+	)
 	if p.match(WHERE) {
-		whereProps = p.parsePropertyList()
+		whereProps, filter, search, within = p.parseMatchWhere()
+	}
+
+	// WITH hands variables of a path MATCH on to the next one, which holds
+	// the rest of the statement
+	if t := p.tok; p.matchWord("WITH") {
+		with := &WithStage{Line: t.Line, Col: t.Column}
+		for {
+			with.Vars = append(with.Vars, p.expect(IDENT).Lit)
+			if !p.match(COMMA) {
+				break
+			}
+		}
+		if p.matchWord("LIMIT") {
+			n := p.expect(NUMBER)
+			with.Limit = &Literal{Kind: LitNumber, Text: n.Lit, Line: n.Line, Col: n.Column}
+		}
+		if p.tok.Type != MATCH {
+			p.errf(p.tok.Line, p.tok.Column, "expected MATCH after WITH, found %v (%q)", p.tok.Type, p.tok.Lit)
+			return &MatchStmt{Pattern: pattern, Paths: paths, Line: line, Col: col}
+		}
+		with.Next = p.parseMatch()
+		last := with.Next
+		for last.With != nil {
+			last = last.With.Next
+		}
+		switch {
+		case paths == nil:
+			p.errf(t.Line, t.Column, "WITH needs a path pattern, as in MATCH (c:Company) WITH c MATCH (p)-[:WORKS_AT]->(c) ...")
+		case with.Next.Paths == nil:
+			p.errf(with.Next.Line, with.Next.Col, "the MATCH after WITH needs a path pattern")
+		case search != nil || within != nil:
+			p.errf(t.Line, t.Column, "MATCHES and WITHIN cannot be used with path patterns")
+		}
+		if filter != nil && (last.Set != nil || last.Delete != nil) {
+			p.rejectTime(filter, "MATCH ... SET or DELETE")
+		}
+		return &MatchStmt{
+			Paths:  paths,
+			Where:  whereProps,
+			Filter: filter,
+			With:   with,
+			Line:   line,
+			Col:    col,
+		}
+	}
+
+	// a path MATCH may change what it finds instead of returning it
+	var (
+		set []Property
+		del []string
+	)
+	if t := p.tok; t.Type == SET || t.Type == DELETE {
+		p.next()
+		if t.Type == SET {
+			set = p.parseSetList(true)
+		} else {
+			for {
+				del = append(del, p.expect(IDENT).Lit)
+				if !p.match(COMMA) {
+					break
+				}
+			}
+		}
+		switch {
+		case paths == nil:
+			p.errf(t.Line, t.Column, "%v needs a path pattern, as in MATCH (p:Person {name: 'Ann'}) %v ...; use UPDATE or DELETE for a type", t.Type, t.Type)
+		case p.tok.Type == RETURN || p.isWord("ORDER") || p.isWord("LIMIT"):
+			p.errf(p.tok.Line, p.tok.Column, "a MATCH with %v cannot have RETURN, ORDER BY or LIMIT", t.Type)
+		}
+		if filter != nil {
+			p.rejectTime(filter, "MATCH ... "+t.Type.String())
+		}
+		for _, s := range set {
+			if s.Case != nil {
+				p.rejectTime(s.Case, "MATCH ... SET")
+			}
+		}
 	}
 
 	// Parse RETURN clause
 	var returnFields []string
+	var cases []*CaseExpr
+	var distinct bool
 	if p.match(RETURN) {
+		var first *Token
+		if p.isWord("DISTINCT") {
+			// unless a field or alias is called distinct
+			t := p.tok
+			p.next()
+			if p.tok.Type == IDENT && !p.isWord("ORDER") && !p.isWord("LIMIT") {
+				distinct = true
+			} else {
+				first = &t
+			}
+		}
 		for {
-			returnFields = append(returnFields, p.expect(IDENT).Lit)
+			// field, alias, alias.field or CASE ... END AS name
+			var item Token
+			if first != nil {
+				item, first = *first, nil
+			} else {
+				item = p.expect(IDENT)
+			}
+			var c *CaseExpr
+			switch {
+			case strings.EqualFold(item.Lit, "CASE") && p.isWord("WHEN"):
+				c = p.parseCase(item.Line, item.Column, true)
+				if !p.matchWord("AS") {
+					p.errf(p.tok.Line, p.tok.Column, "expected AS and a name after CASE ... END, found %v (%q)", p.tok.Type, p.tok.Lit)
+				}
+				item.Lit = p.expect(IDENT).Lit
+			case p.match(DOT):
+				item.Lit += "." + p.expect(IDENT).Lit
+			}
+			if c != nil && cases == nil {
+				cases = make([]*CaseExpr, len(returnFields))
+			}
+			if cases != nil {
+				cases = append(cases, c)
+			}
+			returnFields = append(returnFields, item.Lit)
 			if !p.match(COMMA) {
 				break
 			}
 		}
 	}
 
+	// Parse optional ORDER BY and LIMIT
+	var order *VectorOrder
+	if p.matchWord("ORDER") {
+		if !p.matchWord("BY") {
+			p.errf(p.tok.Line, p.tok.Column, "expected BY after ORDER, found %v (%q)", p.tok.Type, p.tok.Lit)
+		}
+		order = p.parseVectorOrder()
+	}
+	var limit *Literal
+	if p.matchWord("LIMIT") {
+		t := p.expect(NUMBER)
+		limit = &Literal{Kind: LitNumber, Text: t.Lit, Line: t.Line, Col: t.Column}
+	}
+
 	return &MatchStmt{
-		Pattern: pattern,
-		Where:   whereProps,
-		Return:  returnFields,
-		Line:    line,
-		Col:     col,
+		Pattern:  pattern,
+		Paths:    paths,
+		Where:    whereProps,
+		Filter:   filter,
+		Search:   search,
+		Within:   within,
+		Return:   returnFields,
+		Cases:    cases,
+		Distinct: distinct,
+		OrderBy:  order,
+		Limit:    limit,
+		Set:      set,
+		Delete:   del,
+		Line:     line,
+		Col:      col,
+	}
+}
+
+// rejectTime reports the now() and date() in n, part of a statement that is
+// replayed from the commit log, where they would give other times
+func (p *Parser) rejectTime(n Node, clause string) {
+	Inspect(n, func(n Node) bool {
+		if t, ok := n.(*TimeExpr); ok {
+			p.errf(t.Line, t.Col, "%s() cannot be used in %s, since it is replayed from the commit log", t.Func, clause)
+		}
+		return true
+	})
+}
+
+// parsePath parses a chain of node and edge patterns such as
+// (p:Person {name: 'Ann'})-[w:WORKS_AT]->(c:Company), which name = may name
+func (p *Parser) parsePath() PathPattern {
+	var path PathPattern
+	if p.tok.Type == IDENT && p.peek().Type == EQ {
+		path.Name = p.tok.Lit
+		p.next()
+		p.next()
+	}
+	path.Elements = append(path.Elements, p.parseNodePattern())
+	for p.tok.Type == DASH || p.tok.Type == LT {
+		path.Elements = append(path.Elements, p.parseEdgePattern(), p.parseNodePattern())
+	}
+	return path
+}
+
+// parseNodePattern parses (alias:Type {props}), every part optional
+func (p *Parser) parseNodePattern() MatchElement {
+	el := MatchElement{Line: p.tok.Line, Col: p.tok.Column}
+	p.expect(LPAREN)
+	p.parseElementBody(&el)
+	p.expect(RPAREN)
+	return el
+}
+
+// parseEdgePattern parses -[alias:TYPE {props}]->, <-[...]- or -[...]-
+func (p *Parser) parseEdgePattern() MatchElement {
+	el := MatchElement{IsEdge: true, Direction: DirBoth, Line: p.tok.Line, Col: p.tok.Column}
+	in := p.match(LT)
+	p.expect(DASH)
+	p.expect(LBRACK)
+	p.parseElementBody(&el)
+	p.expect(RBRACK)
+	p.expect(DASH)
+	out := p.tok.Type == GT
+	if out {
+		p.next()
+	}
+	switch {
+	case in && out:
+		p.errf(el.Line, el.Col, "an edge pattern points one way or neither, not both")
+	case in:
+		el.Direction = DirIn
+	case out:
+		el.Direction = DirOut
 	}
+	return el
+}
+
+// parseElementBody parses the alias, :Type and {props} inside the brackets of
+// a node or edge pattern
+func (p *Parser) parseElementBody(el *MatchElement) {
+	if p.tok.Type == IDENT {
+		el.Alias = p.tok.Lit
+		p.next()
+	}
+	if p.match(COLON) {
+		el.Type = p.expect(IDENT).Lit
+	}
+	if el.IsEdge && p.tok.Type == STAR {
+		el.Hops = p.parseHops()
+	}
+	if p.match(LBRACE) {
+		el.Properties = p.parsePropertyList()
+		p.expect(RBRACE)
+	}
+}
+
+// parseHops parses the *min..max of a variable-length edge: * alone is one
+// or more hops, *n exactly n, and either bound of a range may be left out
+func (p *Parser) parseHops() *HopRange {
+	star := p.expect(STAR)
+	h := &HopRange{Min: 1, Max: -1}
+	if p.tok.Type == NUMBER {
+		h.Min = p.parseHopCount()
+		h.Max = h.Min
+	}
+	if p.match(DOTDOT) {
+		h.Max = -1
+		if p.tok.Type == NUMBER {
+			h.Max = p.parseHopCount()
+		}
+	}
+	if h.Max >= 0 && h.Min > h.Max {
+		p.errf(star.Line, star.Column, "hop range *%d..%d is empty", h.Min, h.Max)
+	}
+	return h
+}
+
+func (p *Parser) parseHopCount() int {
+	t := p.expect(NUMBER)
+	n, err := strconv.Atoi(t.Lit)
+	if err != nil {
+		p.errf(t.Line, t.Column, "hop count must be a whole number, found %s", t.Lit)
+	}
+	return n
+}
+
+// parseWhere parses the conditions of an UPDATE or DELETE; see parseConditions
+func (p *Parser) parseWhere() ([]Property, Expr) {
+	props, filter, _, _ := p.parseConditions(false)
+	return props, filter
+}
+
+// parseMatchWhere parses the conditions of a MATCH, which may also include
+// MATCHES(field, 'words') and WITHIN(field, 'lat, lon', radius)
+func (p *Parser) parseMatchWhere() ([]Property, Expr, []TextMatch, []GeoWithin) {
+	return p.parseConditions(true)
+}
+
+// parseConditions parses a WHERE clause: conditions separated by commas,
+// which AND them, each built from name: value comparisons with AND, OR, NOT
+// and parentheses. The conditions ANDed at the top are sorted out: name:
+// value comparisons go to props and MATCHES and WITHIN to search and within,
+// and whatever remains is ANDed into filter.
+func (p *Parser) parseConditions(match bool) (props []Property, filter Expr, search []TextMatch, within []GeoWithin) {
+	var terms []Expr
+	for {
+		terms = appendConjuncts(terms, p.parseOr(match))
+		if !p.match(COMMA) {
+			break
+		}
+	}
+	for _, t := range terms {
+		switch t := t.(type) {
+		case *Property:
+			props = append(props, *t)
+		case *TextMatch:
+			search = append(search, *t)
+		case *GeoWithin:
+			within = append(within, *t)
+		default:
+			Inspect(t, func(n Node) bool {
+				switch n.(type) {
+				case *TextMatch, *GeoWithin:
+					line, col := n.Pos()
+					p.errf(line, col, "MATCHES and WITHIN can only be combined with other conditions by AND")
+				case *ExistsExpr:
+					return false // its MATCH has a WHERE of its own
+				}
+				return true
+			})
+			if filter == nil {
+				filter = t
+			} else {
+				line, col := filter.Pos()
+				filter = &LogicalExpr{Op: And, Left: filter, Right: t, Line: line, Col: col}
+			}
+		}
+	}
+	return props, filter, search, within
+}
+
+// parseStringMatch parses what follows the field name of STARTS WITH,
+// ENDS WITH, CONTAINS or =~ and its pattern, or returns nil if none of them
+// does. Regular expressions are checked here, so a bad one is a syntax error.
+func (p *Parser) parseStringMatch(name Token) *StringMatch {
+	m := &StringMatch{Field: name.Lit, Line: name.Line, Col: name.Column}
+	switch {
+	case p.isWord("STARTS"), p.isWord("ENDS"):
+		if p.isWord("ENDS") {
+			m.Op = EndsWith
+		}
+		p.next()
+		if !p.matchWord("WITH") {
+			p.errf(p.tok.Line, p.tok.Column, "expected WITH, found %v (%q)", p.tok.Type, p.tok.Lit)
+		}
+	case p.isWord("CONTAINS"):
+		m.Op = Contains
+		p.next()
+	case p.tok.Type == REGEX:
+		m.Op = RegexMatch
+		p.next()
+	default:
+		return nil
+	}
+	t := p.expect(STRING)
+	m.Pattern = &Literal{Kind: LitString, Text: t.Lit, Line: t.Line, Col: t.Column}
+	if m.Op == RegexMatch && t.Type == STRING {
+		if _, err := regexp.Compile(t.Lit); err != nil {
+			p.errf(t.Line, t.Column, "invalid regular expression: %v", err)
+		}
+	}
+	return m
+}
+
+// appendConjuncts appends x to terms, split into the conditions it ANDs
+func appendConjuncts(terms []Expr, x Expr) []Expr {
+	if l, ok := x.(*LogicalExpr); ok && l.Op == And {
+		return appendConjuncts(appendConjuncts(terms, l.Left), l.Right)
+	}
+	return append(terms, x)
+}
+
+// parseOr parses conditions joined by OR, which binds more loosely than AND.
+// AND and OR are not keywords, so fields may still be called and or or.
+func (p *Parser) parseOr(match bool) Expr {
+	x := p.parseAnd(match)
+	for p.isWord("OR") {
+		line, col := p.tok.Line, p.tok.Column
+		p.next()
+		x = &LogicalExpr{Op: Or, Left: x, Right: p.parseAnd(match), Line: line, Col: col}
+	}
+	return x
+}
+
+// parseAnd parses conditions joined by AND
+func (p *Parser) parseAnd(match bool) Expr {
+	x := p.parseNot(match)
+	for p.isWord("AND") {
+		line, col := p.tok.Line, p.tok.Column
+		p.next()
+		x = &LogicalExpr{Op: And, Left: x, Right: p.parseNot(match), Line: line, Col: col}
+	}
+	return x
+}
+
+// parseNot parses a condition with any number of NOTs before it
+func (p *Parser) parseNot(match bool) Expr {
+	if p.tok.Type == NOT {
+		line, col := p.tok.Line, p.tok.Column
+		p.next()
+		return &NotExpr{X: p.parseNot(match), Line: line, Col: col}
+	}
+	return p.parseCondition(match)
+}
+
+// parseCondition parses a parenthesized group or a single condition: name:
+// value, name IN (v, ...), name BETWEEN low AND high, name < value and the
+// like, a string comparison such as name STARTS WITH 'prefix', or in a MATCH
+// also MATCHES(...), WITHIN(...) or EXISTS (MATCH ...). In a MATCH the value
+// of <, <=, > and >= may also be now() or date() give or take durations, and
+// the name may be alias.field. MATCHES, WITHIN and EXISTS are not keywords,
+// so fields with those names are told apart by the parenthesis that follows.
+func (p *Parser) parseCondition(match bool) Expr {
+	if p.tok.Type == LPAREN {
+		p.next()
+		x := p.parseOr(match)
+		p.expect(RPAREN)
+		return x
+	}
+	name := p.expect(IDENT)
+	for p.tok.Type == DOT {
+		// alias.field, or a key in a json field, as in meta.address.city
+		p.next()
+		name.Lit += "." + p.expect(IDENT).Lit
+	}
+	switch {
+	case match && p.tok.Type == LPAREN && strings.EqualFold(name.Lit, "WITHIN"):
+		p.next()
+		w := &GeoWithin{Field: p.expect(IDENT).Lit, Line: name.Line, Col: name.Column}
+		p.expect(COMMA)
+		c := p.expect(STRING)
+		w.Center = &Literal{Kind: LitString, Text: c.Lit, Line: c.Line, Col: c.Column}
+		p.expect(COMMA)
+		r := p.expect(NUMBER)
+		w.Radius = &Literal{Kind: LitNumber, Text: r.Lit, Line: r.Line, Col: r.Column}
+		if p.tok.Type == IDENT {
+			// 5km lexes as a number and a word
+			switch unit := strings.ToLower(p.tok.Lit); unit {
+			case "m", "km", "mi":
+				w.Unit = unit
+			default:
+				p.errf(p.tok.Line, p.tok.Column, "expected m, km or mi after the radius, found %q", p.tok.Lit)
+			}
+			p.next()
+		}
+		p.expect(RPAREN)
+		return w
+	case match && p.tok.Type == LPAREN && strings.EqualFold(name.Lit, "MATCHES"):
+		p.next()
+		m := &TextMatch{Field: p.expect(IDENT).Lit, Line: name.Line, Col: name.Column}
+		p.expect(COMMA)
+		q := p.expect(STRING)
+		m.Query = &Literal{Kind: LitString, Text: q.Lit, Line: q.Line, Col: q.Column}
+		p.expect(RPAREN)
+		return m
+	case match && p.tok.Type == LPAREN && strings.EqualFold(name.Lit, "EXISTS"):
+		p.next()
+		sub := p.parseMatch()
+		x := &ExistsExpr{Match: sub, Line: name.Line, Col: name.Column}
+		switch {
+		case len(sub.Paths) == 0:
+			p.errf(sub.Line, sub.Col, "EXISTS takes a path pattern, as in EXISTS (MATCH (p)-[:WORKS_AT]->())")
+		case len(sub.Return) > 0 || sub.OrderBy != nil || sub.Limit != nil:
+			p.errf(sub.Line, sub.Col, "the MATCH of EXISTS cannot have RETURN, ORDER BY or LIMIT")
+		case sub.Set != nil || sub.Delete != nil:
+			p.errf(sub.Line, sub.Col, "the MATCH of EXISTS cannot have SET or DELETE")
+		case sub.With != nil:
+			p.errf(sub.With.Line, sub.With.Col, "the MATCH of EXISTS cannot have WITH")
+		default:
+			p.expect(RPAREN)
+		}
+		return x
+	}
+	if p.isWord("IN") {
+		p.next()
+		in := &InExpr{Field: name.Lit, Line: name.Line, Col: name.Column}
+		p.expect(LPAREN)
+		for {
+			lit := p.parseLiteral()
+			in.Values = append(in.Values, &lit)
+			if !p.match(COMMA) {
+				break
+			}
+		}
+		p.expect(RPAREN)
+		return in
+	}
+	if p.isWord("BETWEEN") {
+		p.next()
+		b := &BetweenExpr{Field: name.Lit, Line: name.Line, Col: name.Column}
+		low := p.parseLiteral()
+		if !p.matchWord("AND") {
+			p.errf(p.tok.Line, p.tok.Column, "expected AND after the lower bound of BETWEEN, found %v (%q)", p.tok.Type, p.tok.Lit)
+		}
+		high := p.parseLiteral()
+		b.Low, b.High = &low, &high
+		return b
+	}
+	if m := p.parseStringMatch(name); m != nil {
+		return m
+	}
+	if op, ok := compareOps[p.tok.Type]; ok {
+		p.next()
+		c := &CompareExpr{Field: name.Lit, Op: op, Line: name.Line, Col: name.Column}
+		if p.tok.Type == DATE || p.tok.Type == IDENT {
+			c.Time = p.parseTimeExpr()
+			if !match {
+				p.errf(c.Time.Line, c.Time.Col, "%s() cannot be used in UPDATE or DELETE, since they are replayed from the commit log", c.Time.Func)
+			}
+			return c
+		}
+		lit := p.parseLiteral()
+		c.Value = &lit
+		return c
+	}
+	prop := &Property{Name: name.Lit, Line: p.tok.Line, Col: p.tok.Column}
+	p.expect(COLON)
+	lit := p.parseLiteral()
+	prop.Value = &lit
+	return prop
+}
+
+var compareOps = map[TokenType]CompareOp{LT: Less, LE: LessEq, GT: Greater, GE: GreaterEq}
+
+// parseTimeExpr parses now() or date(), then any number of + duration('...')
+// or - duration('...'). now and duration are not keywords; date is one.
+func (p *Parser) parseTimeExpr() *TimeExpr {
+	t := p.tok
+	x := &TimeExpr{Line: t.Line, Col: t.Column}
+	switch {
+	case t.Type == DATE:
+		x.Func = "date"
+	case p.isWord("now"):
+		x.Func = "now"
+	default:
+		p.errf(t.Line, t.Column, "expected a literal, now() or date(), found %q", t.Lit)
+	}
+	p.next()
+	p.expect(LPAREN)
+	p.expect(RPAREN)
+	for p.tok.Type == PLUS || p.tok.Type == DASH {
+		sh := Shift{Neg: p.tok.Type == DASH}
+		p.next()
+		if !p.matchWord("duration") {
+			p.errf(p.tok.Line, p.tok.Column, "expected duration('...') after + or -, found %q", p.tok.Lit)
+			return x
+		}
+		p.expect(LPAREN)
+		d := p.expect(STRING)
+		if _, err := ParseDuration(d.Lit); err != nil && d.Type == STRING {
+			p.errf(d.Line, d.Column, "%v", err)
+		}
+		p.expect(RPAREN)
+		sh.Duration = &Literal{Kind: LitString, Text: d.Lit, Line: d.Line, Col: d.Column}
+		x.Shifts = append(x.Shifts, sh)
+	}
+	return x
+}
+
+// isWord reports whether the current token is the identifier w, in any case.
+// ORDER, BY and LIMIT are read this way rather than as keywords, so that
+// types and fields may still be called Order or limit.
+func (p *Parser) isWord(w string) bool {
+	return p.tok.Type == IDENT && strings.EqualFold(p.tok.Lit, w)
+}
+
+// matchWord consumes the identifier w if it is next
+func (p *Parser) matchWord(w string) bool {
+	if p.isWord(w) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// parseVectorOrder parses SIMILARITY(field, 'vector') or DISTANCE(field,
+// 'vector'). The function names are not keywords either.
+func (p *Parser) parseVectorOrder() *VectorOrder {
+	t := p.expect(IDENT)
+	order := &VectorOrder{Line: t.Line, Col: t.Column}
+	switch strings.ToUpper(t.Lit) {
+	case "SIMILARITY":
+		order.Metric = Cosine
+	case "DISTANCE":
+		order.Metric = L2
+	default:
+		p.errf(t.Line, t.Column, "expected SIMILARITY or DISTANCE after ORDER BY, found %q", t.Lit)
+	}
+	p.expect(LPAREN)
+	order.Field = p.expect(IDENT).Lit
+	if p.match(DOT) {
+		order.Field += "." + p.expect(IDENT).Lit
+	}
+	p.expect(COMMA)
+	v := p.expect(STRING)
+	order.Vector = &Literal{Kind: LitString, Text: v.Lit, Line: v.Line, Col: v.Column}
+	p.expect(RPAREN)
+	return order
+}
+
+/* ---------------------- EXPORT ----------------------- */
+
+func (p *Parser) parseExport() *ExportStmt {
+	line, col := p.tok.Line, p.tok.Column
+	p.expect(EXPORT)
+	stmt := &ExportStmt{Line: line, Col: col}
+	switch p.tok.Type {
+	case MATCH:
+		stmt.Match = p.parseMatch()
+		if stmt.Match.Set != nil || stmt.Match.Delete != nil {
+			p.errf(stmt.Match.Line, stmt.Match.Col, "the MATCH of EXPORT cannot have SET or DELETE")
+		}
+
+	case NODE:
+		p.next()
+		stmt.NodeType = p.expect(IDENT).Lit
+	}
+	p.expect(TO)
+	stmt.Path = p.expect(STRING).Lit
+	return stmt
+}
+
+/* ---------------------- SHOW ----------------------- */
+
+func (p *Parser) parseShow() Stmt {
+	line, col := p.tok.Line, p.tok.Column
+	p.expect(SHOW)
+	switch p.tok.Type {
+	case STATS:
+		p.next()
+		stmt := &ShowStatsStmt{Line: line, Col: col}
+		if p.tok.Type == IDENT {
+			stmt.Type = p.tok.Lit
+			p.next()
+		}
+		return stmt
+	default:
+		t := p.tok
+		p.errf(t.Line, t.Column, "expected STATS after SHOW, found %v", t.Type)
+		return nil
+	}
+}
+
+/* ---------------------- VACUUM ----------------------- */
+
+func (p *Parser) parseVacuum() Stmt {
+	t := p.expect(VACUUM)
+	stmt := &VacuumStmt{Line: t.Line, Col: t.Column}
+	if p.tok.Type == IDENT {
+		stmt.Type = p.tok.Lit
+		p.next()
+	}
+	return stmt
+}
+
+/* ---------------------- BACKUP ----------------------- */
+
+func (p *Parser) parseBackup() Stmt {
+	t := p.expect(BACKUP)
+	p.expect(TO)
+	stmt := &BackupStmt{Path: p.expect(STRING).Lit, Line: t.Line, Col: t.Column}
+	if p.matchWord("SINCE") {
+		n := p.expect(NUMBER)
+		stmt.Since = &Literal{Kind: LitNumber, Text: n.Lit, Line: n.Line, Col: n.Column}
+	}
+	return stmt
 }
 
 /* ---------------------- Helper functions ---------------------- */
@@ -754,6 +1716,129 @@ func (p *Parser) parsePropertyList() []Property {
 	return properties
 }
 
+// parseSetList parses the assignments of a SET, whose values may also be
+// CASE ... END or an expression of the fields set. In a MATCH each names the
+// variable it sets a field of, as in p.name: 'Ann'.
+func (p *Parser) parseSetList(match bool) []Property {
+	var props []Property
+	for {
+		name := p.expect(IDENT)
+		if match {
+			p.expect(DOT)
+			name.Lit += "." + p.expect(IDENT).Lit
+		}
+		prop := Property{Name: name.Lit, Line: p.tok.Line, Col: p.tok.Column}
+		p.expect(COLON)
+		if t := p.tok; p.isWord("CASE") {
+			p.next()
+			prop.Case = p.parseCase(t.Line, t.Column, match)
+		} else if x := p.parseValue(match); x != nil {
+			if lit, ok := x.(*Literal); ok {
+				prop.Value = lit
+			} else {
+				prop.Calc = x
+			}
+		}
+		props = append(props, prop)
+		if !p.match(COMMA) {
+			break
+		}
+	}
+	return props
+}
+
+// parseValue parses the value of a SET assignment: a literal, or literals,
+// fields and function calls joined by + - * /, which bind as usual, and
+// grouped by parentheses. In a MATCH fields are named as alias.field.
+func (p *Parser) parseValue(match bool) ValueExpr {
+	x := p.parseTerm(match)
+	for p.tok.Type == PLUS || p.tok.Type == DASH {
+		op := p.tok
+		p.next()
+		x = &ArithExpr{Op: op.Lit, Left: x, Right: p.parseTerm(match), Line: op.Line, Col: op.Column}
+	}
+	return x
+}
+
+func (p *Parser) parseTerm(match bool) ValueExpr {
+	x := p.parseFactor(match)
+	for p.tok.Type == STAR || p.tok.Type == SLASH {
+		op := p.tok
+		p.next()
+		x = &ArithExpr{Op: op.Lit, Left: x, Right: p.parseFactor(match), Line: op.Line, Col: op.Column}
+	}
+	return x
+}
+
+func (p *Parser) parseFactor(match bool) ValueExpr {
+	t := p.tok
+	switch t.Type {
+	case LPAREN:
+		p.next()
+		x := p.parseValue(match)
+		p.expect(RPAREN)
+		return x
+	case IDENT:
+		p.next()
+		if p.match(LPAREN) {
+			call := &FuncCall{Name: strings.ToLower(t.Lit), Line: t.Line, Col: t.Column}
+			for p.tok.Type != RPAREN && p.tok.Type != EOF {
+				call.Args = append(call.Args, p.parseValue(match))
+				if !p.match(COMMA) {
+					break
+				}
+			}
+			p.expect(RPAREN)
+			return call
+		}
+		name := t.Lit
+		if match {
+			p.expect(DOT)
+			name += "." + p.expect(IDENT).Lit
+		}
+		return &FieldRef{Name: name, Line: t.Line, Col: t.Column}
+	}
+	lit := p.parseLiteral()
+	return &lit
+}
+
+// parseCase parses the WHEN cond THEN value ... [ELSE value] END of a CASE at
+// line, col. The conditions are those of a WHERE, but without MATCHES, WITHIN
+// or EXISTS; in a MATCH they may name fields as alias.field.
+func (p *Parser) parseCase(line, col int, match bool) *CaseExpr {
+	c := &CaseExpr{Line: line, Col: col}
+	for p.matchWord("WHEN") {
+		cond := p.parseOr(match)
+		if !p.matchWord("THEN") {
+			p.errf(p.tok.Line, p.tok.Column, "expected THEN, found %v (%q)", p.tok.Type, p.tok.Lit)
+			return c
+		}
+		then := p.parseLiteral()
+		c.Whens = append(c.Whens, CaseWhen{Cond: cond, Then: &then})
+		Inspect(cond, func(n Node) bool {
+			switch n.(type) {
+			case *TextMatch, *GeoWithin, *ExistsExpr:
+				line, col := n.Pos()
+				p.errf(line, col, "MATCHES, WITHIN and EXISTS cannot be used in CASE")
+				return false
+			}
+			return true
+		})
+	}
+	if len(c.Whens) == 0 {
+		p.errf(p.tok.Line, p.tok.Column, "expected WHEN, found %v (%q)", p.tok.Type, p.tok.Lit)
+		return c
+	}
+	if p.matchWord("ELSE") {
+		lit := p.parseLiteral()
+		c.Else = &lit
+	}
+	if !p.matchWord("END") {
+		p.errf(p.tok.Line, p.tok.Column, "expected END, found %v (%q)", p.tok.Type, p.tok.Lit)
+	}
+	return c
+}
+
 // parseNodeRef parses a node reference (by ID or properties)
 func (p *Parser) parseNodeRef() *NodeRef {
 	nodeRef := &NodeRef{
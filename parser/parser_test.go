@@ -136,7 +136,8 @@ func TestParseFieldOptions(t *testing.T) {
 	src := `CREATE NODE N(
         id: uuid PRIMARY KEY,
         email: string UNIQUE NOT NULL,
-        name: string DEFAULT 'Anon'
+        name: string DEFAULT 'Anon',
+        age: int INDEX NOT NULL
     );`
 	p := NewParser(src)
 	stmts, errs := p.ParseScript()
@@ -153,6 +154,9 @@ func TestParseFieldOptions(t *testing.T) {
 	if n.Fields[2].Default == nil || n.Fields[2].Default.Kind != LitString || n.Fields[2].Default.Text != "Anon" {
 		t.Fatalf("bad default: %#v", n.Fields[2].Default)
 	}
+	if !n.Fields[3].Index || !n.Fields[3].NotNull || n.Fields[1].Index {
+		t.Fatalf("INDEX flags wrong: %#v, %#v", n.Fields[3], n.Fields[1])
+	}
 }
 
 func TestTrailingCommasAndEmptyFields(t *testing.T) {
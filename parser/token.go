@@ -10,11 +10,13 @@ const (
 	ILLEGAL
 
 	// Identifiers + literals
-	IDENT  // Person, email, ...
-	NUMBER // 42, 3.14
-	STRING // 'hello'
-	BOOL   // true, false
-	NULL   // null
+	IDENT    // Person, email, ...
+	NUMBER   // 42, 3.14
+	STRING   // 'hello'
+	DQSTRING // "hello", in a JSON literal
+	BLOBSTR  // b64'aGVsbG8=', bytes written in base64
+	BOOL     // true, false
+	NULL     // null
 
 	// Keywords (normalized to upper case)
 	CREATE
@@ -63,6 +65,14 @@ const (
 	MATCH
 	WHERE
 	RETURN
+	RETURNING
+	EXPORT
+	STATS
+	VECTOR
+	FULLTEXT
+	MERGE
+	VACUUM
+	BACKUP
 
 	// Symbols
 	LPAREN // (
@@ -73,6 +83,20 @@ const (
 	SEMI   // ;
 	COLON  // :
 	QUOTE  // `
+	LBRACK // [
+	RBRACK // ]
+	LBRACE // {
+	RBRACE // }
+	DASH   // -
+	DOT    // .
+	DOTDOT // ..
+	STAR   // *
+	REGEX  // =~
+	LE     // <=
+	GE     // >=
+	PLUS   // +
+	EQ     // =
+	SLASH  // /
 )
 
 type Token struct {
@@ -95,6 +119,10 @@ func (tt TokenType) String() string {
 		return "number"
 	case STRING:
 		return "string"
+	case DQSTRING:
+		return "JSON string"
+	case BLOBSTR:
+		return "blob literal"
 	case BOOL:
 		return "boolean"
 	case NULL:
@@ -183,10 +211,26 @@ func (tt TokenType) String() string {
 		return "DELETE"
 	case MATCH:
 		return "MATCH"
+	case MERGE:
+		return "MERGE"
 	case WHERE:
 		return "WHERE"
 	case RETURN:
 		return "RETURN"
+	case RETURNING:
+		return "RETURNING"
+	case EXPORT:
+		return "EXPORT"
+	case STATS:
+		return "STATS"
+	case VECTOR:
+		return "VECTOR"
+	case FULLTEXT:
+		return "FULLTEXT"
+	case VACUUM:
+		return "VACUUM"
+	case BACKUP:
+		return "BACKUP"
 	case LPAREN:
 		return "("
 	case RPAREN:
@@ -203,6 +247,34 @@ func (tt TokenType) String() string {
 		return ":"
 	case QUOTE:
 		return "`"
+	case LBRACK:
+		return "["
+	case RBRACK:
+		return "]"
+	case LBRACE:
+		return "{"
+	case RBRACE:
+		return "}"
+	case DASH:
+		return "-"
+	case DOT:
+		return "."
+	case DOTDOT:
+		return ".."
+	case STAR:
+		return "*"
+	case REGEX:
+		return "=~"
+	case LE:
+		return "<="
+	case GE:
+		return ">="
+	case PLUS:
+		return "+"
+	case EQ:
+		return "="
+	case SLASH:
+		return "/"
 	default:
 		return fmt.Sprintf("TokenType(%d)", int(tt))
 	}
@@ -0,0 +1,284 @@
+package parser
+
+// Node is any element of a parsed statement: a Stmt, or one of *FieldDef,
+// *Endpoint, *Property, *Literal, *NodeRef, *MatchElement, *LogicalExpr,
+// *NotExpr, *InExpr, *BetweenExpr, *CompareExpr, *TimeExpr, *StringMatch,
+// *ExistsExpr, *CaseExpr, *FieldRef, *ArithExpr, *FuncCall, *TextMatch,
+// *GeoWithin and *VectorOrder
+type Node interface {
+	Pos() (line, col int)
+}
+
+func (f *FieldDef) Pos() (int, int)     { return f.Line, f.Col }
+func (p *Property) Pos() (int, int)     { return p.Line, p.Col }
+func (l *Literal) Pos() (int, int)      { return l.Line, l.Col }
+func (r *NodeRef) Pos() (int, int)      { return r.Line, r.Col }
+func (m *MatchElement) Pos() (int, int) { return m.Line, m.Col }
+func (m *TextMatch) Pos() (int, int)    { return m.Line, m.Col }
+func (w *GeoWithin) Pos() (int, int)    { return w.Line, w.Col }
+func (o *VectorOrder) Pos() (int, int)  { return o.Line, o.Col }
+func (x *LogicalExpr) Pos() (int, int)  { return x.Line, x.Col }
+func (x *NotExpr) Pos() (int, int)      { return x.Line, x.Col }
+func (x *InExpr) Pos() (int, int)       { return x.Line, x.Col }
+func (x *BetweenExpr) Pos() (int, int)  { return x.Line, x.Col }
+func (x *CompareExpr) Pos() (int, int)  { return x.Line, x.Col }
+func (x *TimeExpr) Pos() (int, int)     { return x.Line, x.Col }
+func (x *StringMatch) Pos() (int, int)  { return x.Line, x.Col }
+func (x *ExistsExpr) Pos() (int, int)   { return x.Line, x.Col }
+func (x *CaseExpr) Pos() (int, int)     { return x.Line, x.Col }
+func (x *FieldRef) Pos() (int, int)     { return x.Line, x.Col }
+func (x *ArithExpr) Pos() (int, int)    { return x.Line, x.Col }
+func (x *FuncCall) Pos() (int, int)     { return x.Line, x.Col }
+
+// Endpoint carries no position of its own
+func (e *Endpoint) Pos() (int, int) { return 0, 0 }
+
+// Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children of
+// node with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses a statement in depth-first order, like go/ast.Walk. Children
+// are passed as pointers into the statement, so a visitor may modify them.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *CreateNodeStmt:
+		walkFields(v, n.Fields)
+	case *CreateEdgeStmt:
+		Walk(v, &n.From)
+		Walk(v, &n.To)
+		walkFields(v, n.Props)
+	case *AlterNodeStmt:
+		if n.Field != nil {
+			Walk(v, n.Field)
+		}
+	case *AlterEdgeStmt:
+		if n.Prop != nil {
+			Walk(v, n.Prop)
+		}
+		if n.From != nil {
+			Walk(v, n.From)
+		}
+		if n.To != nil {
+			Walk(v, n.To)
+		}
+	case *InsertNodeStmt:
+		walkProps(v, n.Properties)
+		if n.OnConflict != nil {
+			walkProps(v, n.OnConflict.Set)
+		}
+	case *InsertEdgeStmt:
+		if n.FromNode != nil {
+			Walk(v, n.FromNode)
+		}
+		if n.ToNode != nil {
+			Walk(v, n.ToNode)
+		}
+		walkProps(v, n.Properties)
+	case *MergeNodeStmt:
+		walkProps(v, n.Properties)
+		walkProps(v, n.OnCreate)
+		walkProps(v, n.OnMatch)
+	case *MergeEdgeStmt:
+		if n.FromNode != nil {
+			Walk(v, n.FromNode)
+		}
+		if n.ToNode != nil {
+			Walk(v, n.ToNode)
+		}
+		walkProps(v, n.Properties)
+		walkProps(v, n.OnCreate)
+		walkProps(v, n.OnMatch)
+	case *UpdateNodeStmt:
+		walkProps(v, n.Set)
+		walkProps(v, n.Where)
+		walkExpr(v, n.Filter)
+	case *UpdateEdgeStmt:
+		walkProps(v, n.Set)
+		walkProps(v, n.Where)
+		walkExpr(v, n.Filter)
+	case *DeleteNodeStmt:
+		walkProps(v, n.Where)
+		walkExpr(v, n.Filter)
+	case *DeleteEdgeStmt:
+		if n.FromNode != nil {
+			Walk(v, n.FromNode)
+		}
+		if n.ToNode != nil {
+			Walk(v, n.ToNode)
+		}
+		walkProps(v, n.Where)
+		walkExpr(v, n.Filter)
+	case *MatchStmt:
+		for i := range n.Pattern {
+			Walk(v, &n.Pattern[i])
+		}
+		for _, path := range n.Paths {
+			for i := range path.Elements {
+				Walk(v, &path.Elements[i])
+			}
+		}
+		walkProps(v, n.Where)
+		walkExpr(v, n.Filter)
+		for _, c := range n.Cases {
+			if c != nil {
+				Walk(v, c)
+			}
+		}
+		for i := range n.Search {
+			Walk(v, &n.Search[i])
+		}
+		for i := range n.Within {
+			Walk(v, &n.Within[i])
+		}
+		if n.OrderBy != nil {
+			Walk(v, n.OrderBy)
+		}
+		if n.Limit != nil {
+			Walk(v, n.Limit)
+		}
+		walkProps(v, n.Set)
+		if w := n.With; w != nil {
+			if w.Limit != nil {
+				Walk(v, w.Limit)
+			}
+			Walk(v, w.Next)
+		}
+	case *LogicalExpr:
+		walkExpr(v, n.Left)
+		walkExpr(v, n.Right)
+	case *NotExpr:
+		walkExpr(v, n.X)
+	case *InExpr:
+		for _, lit := range n.Values {
+			Walk(v, lit)
+		}
+	case *BetweenExpr:
+		if n.Low != nil {
+			Walk(v, n.Low)
+		}
+		if n.High != nil {
+			Walk(v, n.High)
+		}
+	case *CompareExpr:
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+		if n.Time != nil {
+			Walk(v, n.Time)
+		}
+	case *TimeExpr:
+		for _, s := range n.Shifts {
+			if s.Duration != nil {
+				Walk(v, s.Duration)
+			}
+		}
+	case *StringMatch:
+		if n.Pattern != nil {
+			Walk(v, n.Pattern)
+		}
+	case *ExistsExpr:
+		if n.Match != nil {
+			Walk(v, n.Match)
+		}
+	case *TextMatch:
+		if n.Query != nil {
+			Walk(v, n.Query)
+		}
+	case *GeoWithin:
+		if n.Center != nil {
+			Walk(v, n.Center)
+		}
+		if n.Radius != nil {
+			Walk(v, n.Radius)
+		}
+	case *VectorOrder:
+		if n.Vector != nil {
+			Walk(v, n.Vector)
+		}
+	case *ExportStmt:
+		if n.Match != nil {
+			Walk(v, n.Match)
+		}
+	case *FieldDef:
+		if n.Default != nil {
+			Walk(v, n.Default)
+		}
+	case *Property:
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+		if n.Case != nil {
+			Walk(v, n.Case)
+		}
+		if n.Calc != nil {
+			Walk(v, n.Calc)
+		}
+	case *ArithExpr:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case *FuncCall:
+		for _, arg := range n.Args {
+			Walk(v, arg)
+		}
+	case *CaseExpr:
+		for _, w := range n.Whens {
+			walkExpr(v, w.Cond)
+			if w.Then != nil {
+				Walk(v, w.Then)
+			}
+		}
+		if n.Else != nil {
+			Walk(v, n.Else)
+		}
+	case *NodeRef:
+		if n.ID != nil {
+			Walk(v, n.ID)
+		}
+		walkProps(v, n.Properties)
+	case *MatchElement:
+		walkProps(v, n.Properties)
+	}
+
+	v.Visit(nil)
+}
+
+func walkFields(v Visitor, fields []FieldDef) {
+	for i := range fields {
+		Walk(v, &fields[i])
+	}
+}
+
+func walkExpr(v Visitor, x Expr) {
+	if x != nil {
+		Walk(v, x)
+	}
+}
+
+func walkProps(v Visitor, props []Property) {
+	for i := range props {
+		Walk(v, &props[i])
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses node in depth-first order, calling f for each node and,
+// once a node's children are done, f(nil). If f returns false, the children
+// of that node are skipped.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,248 @@
+package grapho
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"grapho/catalog"
+	"grapho/executor"
+)
+
+// RDFMapping describes how ExportNTriples names the graph in RDF. Every node
+// becomes an IRI with an rdf:type triple, every property a literal triple and
+// every edge a triple from its source node to its target node. Edge properties
+// have no place in plain triples and are not exported. Anything the mapping
+// leaves out is named under Base. It is usually written as JSON; see
+// ReadRDFMapping.
+type RDFMapping struct {
+	// Base prefixes the default IRIs: Base+"Person" for the class of Person
+	// nodes, Base+"Person/1" for node 1, Base+"Person#name" for the name
+	// property and Base+"Knows" for Knows edges
+	Base  string                    `json:"base"`
+	Nodes map[string]RDFNodeMapping `json:"nodes,omitempty"`
+	Edges map[string]RDFEdgeMapping `json:"edges,omitempty"`
+}
+
+// RDFNodeMapping names one node type in RDF
+type RDFNodeMapping struct {
+	// Class is the IRI of the rdf:type of the nodes
+	Class string `json:"class,omitempty"`
+	// IRI is a template for node IRIs in which {field} is replaced by the
+	// node's value of field, percent-encoded, and {_id} by its ID; e.g.
+	// "http://example.org/people/{email}" to name people by a natural key
+	IRI string `json:"iri,omitempty"`
+	// Properties maps field names to predicate IRIs
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// RDFEdgeMapping names one edge type in RDF
+type RDFEdgeMapping struct {
+	Predicate string `json:"predicate,omitempty"`
+}
+
+// ReadRDFMapping decodes a JSON mapping and rejects unknown keys
+func ReadRDFMapping(r io.Reader) (RDFMapping, error) {
+	var m RDFMapping
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return m, fmt.Errorf("grapho: rdf mapping: %w", err)
+	}
+	return m, nil
+}
+
+const (
+	rdfType = "http://www.w3.org/1999/02/22-rdf-syntax-ns#type"
+	xsdNS   = "http://www.w3.org/2001/XMLSchema#"
+)
+
+// rdfTemplateVar matches the {field} placeholders of an IRI template
+var rdfTemplateVar = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// ExportNTriples writes the graph to w as N-Triples, naming nodes, types and
+// properties as m describes. Triples come in node order, then edge order. The
+// mapping is checked against the catalog before anything is written; a node
+// whose IRI template refers to a field it has no value for is an error.
+func (db *DB) ExportNTriples(ctx context.Context, w io.Writer, m RDFMapping) error {
+	if u, err := url.Parse(m.Base); err != nil || !u.IsAbs() {
+		return fmt.Errorf("grapho: rdf mapping: base %q is not an absolute IRI", m.Base)
+	}
+	snap, err := db.snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	if err := checkRDFMapping(snap.cat, m); err != nil {
+		return err
+	}
+
+	iris := make(map[[2]string]string, len(snap.nodes)) // type and ID -> IRI
+	bw := bufio.NewWriter(w)
+	for _, n := range snap.nodes {
+		nm := m.Nodes[n.Type]
+		iri, err := rdfNodeIRI(m.Base, nm, n)
+		if err != nil {
+			return err
+		}
+		iris[[2]string{n.Type, n.ID}] = iri
+		class := nm.Class
+		if class == "" {
+			class = m.Base + n.Type
+		}
+		fmt.Fprintf(bw, "%s %s %s .\n", ntIRI(iri), ntIRI(rdfType), ntIRI(class))
+
+		var fields map[string]catalog.FieldSpec
+		if nt, ok := snap.cat.Nodes[n.Type]; ok {
+			fields = nt.Fields
+		}
+		for _, name := range sortedKeys(n.Properties) {
+			pred := nm.Properties[name]
+			if pred == "" {
+				pred = m.Base + n.Type + "#" + name
+			}
+			t := fields[name].Type
+			values := []any{n.Properties[name]}
+			if list, ok := n.Properties[name].([]any); ok && t.Elem != nil {
+				values, t = list, *t.Elem
+			}
+			for _, v := range values {
+				if v != nil {
+					fmt.Fprintf(bw, "%s %s %s .\n", ntIRI(iri), ntIRI(pred), ntLiteral(v, t))
+				}
+			}
+		}
+	}
+	for _, e := range snap.edges {
+		et := snap.cat.Edges[e.Type]
+		if et == nil {
+			continue
+		}
+		from, to := iris[[2]string{et.From.Label, e.From}], iris[[2]string{et.To.Label, e.To}]
+		if from == "" || to == "" {
+			continue
+		}
+		pred := m.Edges[e.Type].Predicate
+		if pred == "" {
+			pred = m.Base + e.Type
+		}
+		fmt.Fprintf(bw, "%s %s %s .\n", ntIRI(from), ntIRI(pred), ntIRI(to))
+	}
+	return bw.Flush()
+}
+
+// checkRDFMapping rejects mappings that name types or fields the catalog does
+// not have
+func checkRDFMapping(cat *catalog.Catalog, m RDFMapping) error {
+	for _, nodeType := range sortedKeys(m.Nodes) {
+		nt, ok := cat.Nodes[nodeType]
+		if !ok {
+			return fmt.Errorf("grapho: rdf mapping: %w", errNodeType(nodeType))
+		}
+		nm := m.Nodes[nodeType]
+		var names []string
+		for _, match := range rdfTemplateVar.FindAllStringSubmatch(nm.IRI, -1) {
+			names = append(names, match[1])
+		}
+		names = append(names, sortedKeys(nm.Properties)...)
+		for _, name := range names {
+			if _, ok := nt.Fields[name]; !ok && name != idProperty {
+				return fmt.Errorf("grapho: rdf mapping: node type '%s' has no field '%s'", nodeType, name)
+			}
+		}
+	}
+	for _, edgeType := range sortedKeys(m.Edges) {
+		if _, ok := cat.Edges[edgeType]; !ok {
+			return fmt.Errorf("grapho: rdf mapping: edge type '%s' does not exist", edgeType)
+		}
+	}
+	return nil
+}
+
+// rdfNodeIRI fills in the IRI template of n's type, or names n under base
+func rdfNodeIRI(base string, nm RDFNodeMapping, n Row) (string, error) {
+	if nm.IRI == "" {
+		return base + n.Type + "/" + url.PathEscape(n.ID), nil
+	}
+	var missing string
+	iri := rdfTemplateVar.ReplaceAllStringFunc(nm.IRI, func(s string) string {
+		name := s[1 : len(s)-1]
+		if name == idProperty {
+			return url.PathEscape(n.ID)
+		}
+		v, ok := n.Properties[name]
+		if !ok || v == nil {
+			missing = name
+			return ""
+		}
+		return url.PathEscape(fmt.Sprint(v))
+	})
+	if missing != "" {
+		return "", fmt.Errorf("grapho: %s node %s has no '%s' for its IRI", n.Type, n.ID, missing)
+	}
+	return iri, nil
+}
+
+// ntIRI writes an IRI reference, escaping the characters N-Triples forbids
+func ntIRI(iri string) string {
+	var b strings.Builder
+	b.WriteByte('<')
+	for _, r := range iri {
+		if r <= ' ' || strings.ContainsRune("<>\"{}|^`\\", r) {
+			fmt.Fprintf(&b, `\u%04X`, r)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+// ntLiteral writes a stored value as a literal typed by its field type.
+// Strings are plain literals; a datetime that does not parse is one too.
+func ntLiteral(v any, t catalog.TypeSpec) string {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case bool, int, int64, float64, executor.Temporal, executor.Blob:
+		s = fmt.Sprint(v)
+	default:
+		b, _ := json.Marshal(v)
+		s = string(b)
+	}
+	quoted := `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`).Replace(s) + `"`
+
+	datatype := ""
+	if t.Elem == nil && len(t.EnumVals) == 0 {
+		switch t.Base {
+		case catalog.BaseInt:
+			datatype = "integer"
+		case catalog.BaseFloat:
+			datatype = "double"
+		case catalog.BaseBool:
+			datatype = "boolean"
+		case catalog.BaseDate:
+			datatype = "date"
+		case catalog.BaseTime:
+			datatype = "time"
+		case catalog.BaseDateTime:
+			for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", time.DateTime} {
+				if ts, err := time.Parse(layout, s); err == nil {
+					quoted = `"` + ts.Format("2006-01-02T15:04:05.999999999Z07:00") + `"`
+					datatype = "dateTime"
+					break
+				}
+			}
+		}
+	}
+	if datatype == "" {
+		return quoted
+	}
+	return quoted + "^^" + ntIRI(xsdNS+datatype)
+}
@@ -0,0 +1,80 @@
+package grapho
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestExportNTriples(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(ctx, t.TempDir())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	if err := db.Exec(ctx, `
+CREATE NODE Person (email: string, name: string, age: int, born: date);
+CREATE NODE City (name: string);
+CREATE EDGE Knows (FROM Person MANY, TO Person MANY, PROPS (since: int));
+CREATE EDGE LivesIn (FROM Person MANY, TO City ONE);
+INSERT NODE Person (email: 'ann@example.org', name: 'Ann "A"', age: 31, born: '1993-02-01');
+INSERT NODE Person (email: 'bob@example.org', name: 'Bob');
+INSERT NODE City (name: 'Oslo');
+INSERT EDGE Knows FROM Person(name: 'Bob') TO Person(email: 'ann@example.org') (since: 2020);
+INSERT EDGE LivesIn FROM Person(name: 'Bob') TO City(name: 'Oslo');`); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+
+	m, err := ReadRDFMapping(strings.NewReader(`{
+		"base": "http://example.org/",
+		"nodes": {
+			"Person": {
+				"class": "http://xmlns.com/foaf/0.1/Person",
+				"iri": "http://example.org/people/{email}",
+				"properties": {"name": "http://xmlns.com/foaf/0.1/name"}
+			}
+		},
+		"edges": {"Knows": {"predicate": "http://xmlns.com/foaf/0.1/knows"}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	if err := db.ExportNTriples(ctx, &buf, m); err != nil {
+		t.Fatalf("ExportNTriples: %v", err)
+	}
+	want := `<http://example.org/City/3> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://example.org/City> .
+<http://example.org/City/3> <http://example.org/City#name> "Oslo" .
+<http://example.org/people/ann@example.org> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://xmlns.com/foaf/0.1/Person> .
+<http://example.org/people/ann@example.org> <http://example.org/Person#age> "31"^^<http://www.w3.org/2001/XMLSchema#integer> .
+<http://example.org/people/ann@example.org> <http://example.org/Person#born> "1993-02-01"^^<http://www.w3.org/2001/XMLSchema#date> .
+<http://example.org/people/ann@example.org> <http://example.org/Person#email> "ann@example.org" .
+<http://example.org/people/ann@example.org> <http://xmlns.com/foaf/0.1/name> "Ann \"A\"" .
+<http://example.org/people/bob@example.org> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://xmlns.com/foaf/0.1/Person> .
+<http://example.org/people/bob@example.org> <http://example.org/Person#email> "bob@example.org" .
+<http://example.org/people/bob@example.org> <http://xmlns.com/foaf/0.1/name> "Bob" .
+<http://example.org/people/bob@example.org> <http://xmlns.com/foaf/0.1/knows> <http://example.org/people/ann@example.org> .
+<http://example.org/people/bob@example.org> <http://example.org/LivesIn> <http://example.org/City/3> .
+`
+	if buf.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	for _, tc := range []struct {
+		mapping, err string
+	}{
+		{`{"base": "example"}`, "not an absolute IRI"},
+		{`{"base": "urn:x:", "nodes": {"Person": {"iri": "urn:p:{mail}"}}}`, "has no field 'mail'"},
+		{`{"base": "urn:x:", "edges": {"Likes": {}}}`, "edge type 'Likes' does not exist"},
+		{`{"base": "urn:x:", "nodes": {"Person": {"iri": "urn:p:{age}"}}}`, "Person node 2 has no 'age'"},
+	} {
+		m, err := ReadRDFMapping(strings.NewReader(tc.mapping))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.ExportNTriples(ctx, &buf, m); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: got %v, want %q", tc.mapping, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package grapho
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"grapho/catalog"
+	"grapho/parser"
+)
+
+// FindNodes returns the nodes of nodeType whose field equals value, scanned
+// into T with the same mapping as Rows.ScanStruct
+func FindNodes[T any](ctx context.Context, db *DB, nodeType, field string, value any) ([]T, error) {
+	lit, err := literal(reflect.ValueOf(&value).Elem(), db.fieldBase(nodeType, field))
+	if err != nil {
+		return nil, fmt.Errorf("grapho: FindNodes %q: %w", field, err)
+	}
+	text, err := parser.Format(parser.Match(nodeType, parser.Prop(field, lit)))
+	if err != nil {
+		return nil, fmt.Errorf("grapho: FindNodes: %w", err)
+	}
+	rows, err := db.QueryRows(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []T
+	for rows.Next() {
+		var v T
+		if err := rows.ScanStruct(&v); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// UpdateNode writes every mapped field of the struct src points to onto the
+// nodes of nodeType whose key field matches src's key field. key may be "_id"
+// to update by node ID.
+func (db *DB) UpdateNode(ctx context.Context, nodeType, key string, src any) error {
+	rv, err := structPointer(src)
+	if err != nil {
+		return err
+	}
+	fields, err := structMapping(db.exec.Registry().Current(), rv.Type(), nodeType)
+	if err != nil {
+		return err
+	}
+
+	var (
+		set   []parser.Property
+		where *parser.Property
+	)
+	for _, f := range fields {
+		if f.name != key && f.name == idProperty {
+			continue
+		}
+		lit, err := literal(rv.FieldByIndex(f.index), f.base)
+		if err != nil {
+			return fmt.Errorf("grapho: UpdateNode field %q: %w", f.name, err)
+		}
+		p := parser.Prop(f.name, lit)
+		if f.name == key {
+			where = &p
+			continue
+		}
+		set = append(set, p)
+	}
+	if where == nil {
+		return fmt.Errorf("grapho: UpdateNode: %s has no field mapped to %q", rv.Type(), key)
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	return db.execStmt(ctx, parser.UpdateNode(nodeType, set, *where))
+}
+
+// DeleteNodes deletes the nodes of nodeType whose field equals value
+func (db *DB) DeleteNodes(ctx context.Context, nodeType, field string, value any) error {
+	lit, err := literal(reflect.ValueOf(&value).Elem(), db.fieldBase(nodeType, field))
+	if err != nil {
+		return fmt.Errorf("grapho: DeleteNodes %q: %w", field, err)
+	}
+	return db.execStmt(ctx, parser.DeleteNode(nodeType, parser.Prop(field, lit)))
+}
+
+// fieldBase returns the type of field of nodeType, which spells a time.Time
+// value given for it
+func (db *DB) fieldBase(nodeType, field string) catalog.BaseType {
+	if nt, ok := db.exec.Registry().Current().Nodes[nodeType]; ok {
+		return nt.Fields[field].Type.Base
+	}
+	return catalog.BaseDateTime
+}
@@ -0,0 +1,40 @@
+package grapho
+
+import "testing"
+
+func TestFindUpdateDeleteNodes(t *testing.T) {
+	db, ctx := openPeople(t)
+
+	type person struct {
+		ID   string `grapho:"_id"`
+		Name string `grapho:"name"`
+		Age  int    `grapho:"age"`
+	}
+	found, err := FindNodes[person](ctx, db, "Person", "name", "Bob")
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if len(found) != 1 || found[0].Age != 40 || found[0].ID == "" {
+		t.Fatalf("found %+v", found)
+	}
+
+	type ageOnly struct {
+		Name string `grapho:"name"`
+		Age  int    `grapho:"age"`
+	}
+	if err := db.UpdateNode(ctx, "Person", "name", &ageOnly{Name: "Bob", Age: 41}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	found, err = FindNodes[person](ctx, db, "Person", "age", 41)
+	if err != nil || len(found) != 1 || found[0].Name != "Bob" {
+		t.Fatalf("after update: %+v, %v", found, err)
+	}
+
+	if err := db.DeleteNodes(ctx, "Person", "name", "Bob"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	found, err = FindNodes[person](ctx, db, "Person", "name", "Bob")
+	if err != nil || len(found) != 0 {
+		t.Fatalf("after delete: %+v, %v", found, err)
+	}
+}
@@ -0,0 +1,252 @@
+package grapho
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"reflect"
+	"strconv"
+
+	"grapho/executor"
+	"grapho/parser"
+)
+
+// errStopped ends execution once an iterator's consumer has stopped
+var errStopped = errors.New("grapho: iteration stopped")
+
+// Iter runs script and yields its rows one at a time, without collecting them.
+// An error is yielded once, with a zero Row, and ends the sequence.
+//
+// The database lock is held while iterating, so the loop body must not call
+// back into db. Breaking out of a read-only script stops its scans early; a
+// script that changes data always runs to completion, and the rows it would
+// still produce are discarded.
+func (db *DB) Iter(ctx context.Context, script string) iter.Seq2[Row, error] {
+	return func(yield func(Row, error) bool) {
+		stmts, release, err := db.parse(script)
+		if err != nil {
+			yield(Row{}, err)
+			return
+		}
+		defer release()
+
+		mutates := false
+		for _, st := range stmts {
+			if executor.Mutates(st) {
+				mutates = true
+			}
+		}
+
+		ctx, cancel := context.WithCancelCause(ctx)
+		defer cancel(nil)
+		ry := &rowYielder{yield: yield}
+		if !mutates {
+			ry.stop = func() { cancel(errStopped) }
+		}
+
+		err = db.execute(ctx, script, stmts, ry)
+		if ry.stopped {
+			return
+		}
+		if err != nil {
+			yield(Row{}, err)
+		}
+	}
+}
+
+// rowYielder passes rows from the executor to a range-over-func loop
+type rowYielder struct {
+	yield   func(Row, error) bool
+	stop    func() // aborts execution, nil if the script must run to completion
+	stopped bool
+}
+
+func (ry *rowYielder) Message(format string, args ...any) {}
+
+func (ry *rowYielder) ResultSet() {}
+
+func (ry *rowYielder) Row(nodeType, id string, props map[string]interface{}) {
+	if ry.stopped {
+		return
+	}
+	if !ry.yield(newRow(nodeType, id, props), nil) {
+		ry.stopped = true
+		if ry.stop != nil {
+			ry.stop()
+		}
+	}
+}
+
+// Rows is a cursor over the result of QueryRows. Always Close it, or read it to
+// the end: the database stays locked until then.
+//
+//	rows, err := db.QueryRows(ctx, "MATCH Person RETURN name, age;")
+//	if err != nil { ... }
+//	defer rows.Close()
+//	for rows.Next() {
+//		var name string
+//		var age int64
+//		if err := rows.Scan(&name, &age); err != nil { ... }
+//	}
+//	err = rows.Err()
+type Rows struct {
+	db      *DB
+	next    func() (Row, error, bool)
+	stop    func()
+	columns []string
+	cur     Row
+	err     error
+	done    bool
+}
+
+// QueryRows runs script and returns a cursor over its rows. Parse errors are
+// returned immediately; execution errors are reported by Err.
+func (db *DB) QueryRows(ctx context.Context, script string) (*Rows, error) {
+	stmts, release, err := db.parse(script)
+	if err != nil {
+		return nil, err
+	}
+	var columns []string
+	for _, st := range stmts {
+		if m, ok := st.(*parser.MatchStmt); ok {
+			columns = m.Return
+		}
+	}
+	release() // Iter prepares the script again when the cursor starts
+	next, stop := iter.Pull2(db.Iter(ctx, script))
+	return &Rows{db: db, next: next, stop: stop, columns: columns}, nil
+}
+
+// Next advances to the next row, returning false at the end or on error
+func (r *Rows) Next() bool {
+	if r.done {
+		return false
+	}
+	row, err, ok := r.next()
+	if !ok || err != nil {
+		r.err = err
+		r.Close()
+		return false
+	}
+	r.cur = row
+	return true
+}
+
+// Row returns the current row
+func (r *Rows) Row() Row {
+	return r.cur
+}
+
+// Columns returns the RETURN fields of the script's last MATCH, the properties
+// Scan reads
+func (r *Rows) Columns() []string {
+	return r.columns
+}
+
+// Scan copies the current row's Columns into dest, which must be pointers to
+// strings, integers, floats, bools or any (or pointers to those, for nulls).
+// Missing properties leave the destination untouched.
+func (r *Rows) Scan(dest ...any) error {
+	if len(r.columns) == 0 {
+		return errors.New("grapho: Scan needs a MATCH with a RETURN list; use Row instead")
+	}
+	if len(dest) != len(r.columns) {
+		return fmt.Errorf("grapho: Scan expected %d destinations, got %d", len(r.columns), len(dest))
+	}
+	for i, col := range r.columns {
+		v, ok := r.cur.Properties[col]
+		if !ok {
+			continue
+		}
+		if err := assign(dest[i], v); err != nil {
+			return fmt.Errorf("grapho: Scan column %q: %w", col, err)
+		}
+	}
+	return nil
+}
+
+// Err returns the error that ended iteration, if any
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// Close releases the cursor and the database lock. It is safe to call twice.
+func (r *Rows) Close() error {
+	if !r.done {
+		r.done = true
+		r.stop()
+	}
+	return nil
+}
+
+// assign stores v in the pointer dest, converting between the stored forms
+func assign(dest, v any) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("destination must be a non-nil pointer, got %T", dest)
+	}
+	return setValue(rv.Elem(), v)
+}
+
+// setValue stores v in dst. Numbers are kept as text by the executor, so they
+// are parsed here; null sets dst to its zero value.
+func setValue(dst reflect.Value, v any) error {
+	if v == nil {
+		dst.SetZero()
+		return nil
+	}
+	if t, ok := v.(executor.Temporal); ok && dst.Type() == timeType {
+		dst.Set(reflect.ValueOf(t.Time()))
+		return nil
+	}
+	if j, ok := v.(executor.JSON); ok && dst.Kind() != reflect.String {
+		// a fresh decoding, which dst may change
+		return json.Unmarshal([]byte(j.String()), dst.Addr().Interface())
+	}
+	if b, ok := v.(executor.Blob); ok && dst.Type() == bytesType {
+		dst.SetBytes(b.Bytes())
+		return nil
+	}
+	s := fmt.Sprint(v)
+	switch dst.Kind() {
+	case reflect.Pointer:
+		p := reflect.New(dst.Type().Elem())
+		if err := setValue(p.Elem(), v); err != nil {
+			return err
+		}
+		dst.Set(p)
+	case reflect.Interface:
+		dst.Set(reflect.ValueOf(v))
+	case reflect.String:
+		dst.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, dst.Type().Bits())
+		if err != nil {
+			return err
+		}
+		dst.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, dst.Type().Bits())
+		if err != nil {
+			return err
+		}
+		dst.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, dst.Type().Bits())
+		if err != nil {
+			return err
+		}
+		dst.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		dst.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported destination %s", dst.Type())
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package grapho
+
+import (
+	"context"
+	"testing"
+)
+
+func openPeople(t *testing.T) (*DB, context.Context) {
+	t.Helper()
+	ctx := context.Background()
+	db, err := Open(ctx, t.TempDir())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Exec(ctx, `
+CREATE NODE Person (name: string, age: int);
+INSERT NODE Person (name: 'Ann', age: 31);
+INSERT NODE Person (name: 'Bob', age: 40);
+INSERT NODE Person (name: 'Cid', age: 25);`); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	return db, ctx
+}
+
+func TestIter(t *testing.T) {
+	db, ctx := openPeople(t)
+
+	n := 0
+	for row, err := range db.Iter(ctx, "MATCH Person;") {
+		if err != nil {
+			t.Fatalf("iter: %v", err)
+		}
+		if row.Type != "Person" {
+			t.Fatalf("bad row: %#v", row)
+		}
+		n++
+	}
+	if n != 3 {
+		t.Fatalf("want 3 rows, got %d", n)
+	}
+
+	n = 0
+	for _, err := range db.Iter(ctx, "MATCH Person;") {
+		if err != nil {
+			t.Fatalf("iter: %v", err)
+		}
+		n++
+		break
+	}
+	if n != 1 {
+		t.Fatalf("want 1 row before break, got %d", n)
+	}
+
+	for _, err := range db.Iter(ctx, "MATCH;") {
+		if err == nil {
+			t.Fatal("expected parse error")
+		}
+	}
+
+	// the lock was released after breaking out
+	if err := db.Exec(ctx, "INSERT NODE Person (name: 'Dee', age: 50);"); err != nil {
+		t.Fatalf("exec after iter: %v", err)
+	}
+}
+
+func TestQueryRowsScan(t *testing.T) {
+	db, ctx := openPeople(t)
+
+	rows, err := db.QueryRows(ctx, "MATCH Person WHERE name: 'Bob' RETURN name, age;")
+	if err != nil {
+		t.Fatalf("query rows: %v", err)
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var (
+			name string
+			age  int64
+		)
+		if err := rows.Scan(&name, &age); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		if name != "Bob" || age != 40 {
+			t.Fatalf("got %s, %d", name, age)
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("rows: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("want 1 row, got %d", n)
+	}
+}
+
+func TestReturnProjection(t *testing.T) {
+	db, ctx := openPeople(t)
+
+	rows, err := db.QueryRows(ctx, "MATCH Person p WHERE name: 'Cid' RETURN p.name, age, _id;")
+	if err != nil {
+		t.Fatalf("query rows: %v", err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		t.Fatalf("expected a row: %v", rows.Err())
+	}
+	if got := rows.Row().Properties; len(got) != 3 || got["p.name"] != "Cid" || got["age"] != "25" || got["_id"] != "3" {
+		t.Fatalf("projected row: %#v", got)
+	}
+	var (
+		name, id string
+		age      int64
+	)
+	if err := rows.Scan(&name, &age, &id); err != nil || name != "Cid" || age != 25 || id != "3" {
+		t.Fatalf("scan: %s %d %s, %v", name, age, id, err)
+	}
+	rows.Close()
+
+	all, err := db.Query(ctx, "MATCH Person p WHERE name: 'Ann' RETURN p;")
+	if err != nil || len(all) != 1 || len(all[0].Properties) != 3 {
+		t.Fatalf("whole node: %v, %v", all, err)
+	}
+
+	for _, bad := range []string{
+		"MATCH Person RETURN email;",
+		"MATCH Person p RETURN q.name;",
+		"MATCH Person p RETURN p.email;",
+		"MATCH Person RETURN _similarity;",
+	} {
+		if _, err := db.Query(ctx, bad); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestReturnDistinct(t *testing.T) {
+	db, ctx := openPeople(t)
+	if err := db.Exec(ctx, `
+INSERT NODE Person (name: 'Ann', age: 25);
+INSERT NODE Person (name: 'Bob', age: 40);
+CREATE EDGE Knows (FROM Person MANY, TO Person MANY);
+INSERT EDGE Knows FROM Person(name: 'Cid') TO Person(age: 31);
+INSERT EDGE Knows FROM Person(name: 'Cid') TO Person(age: 40);
+INSERT EDGE Knows FROM Person(age: 31) TO Person(age: 40);`); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	count := func(q string) int {
+		t.Helper()
+		rows, err := db.Query(ctx, q)
+		if err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+		for _, r := range rows {
+			if q != "MATCH Person RETURN name;" && (r.ID != "" || r.Type != "") {
+				t.Errorf("%s: distinct row %#v has an ID", q, r)
+			}
+		}
+		return len(rows)
+	}
+	for q, want := range map[string]int{
+		"MATCH Person RETURN name;":                                 5,
+		"MATCH Person RETURN DISTINCT name;":                        3,
+		"MATCH Person RETURN DISTINCT name, age;":                   4,
+		"MATCH Person RETURN DISTINCT age LIMIT 2;":                 2,
+		"MATCH Person WHERE name: 'Bob' RETURN DISTINCT name, age;": 1,
+		"MATCH (a)-[:Knows]->(b) RETURN DISTINCT b.name;":           2,
+		"MATCH (a)-[:Knows]->(b) RETURN DISTINCT a.name LIMIT 1;":   1,
+	} {
+		if got := count(q); got != want {
+			t.Errorf("%s: got %d rows, want %d", q, got, want)
+		}
+	}
+}
+
+func TestQueryRowsClose(t *testing.T) {
+	db, ctx := openPeople(t)
+
+	rows, err := db.QueryRows(ctx, "MATCH Person;")
+	if err != nil {
+		t.Fatalf("query rows: %v", err)
+	}
+	if !rows.Next() {
+		t.Fatalf("expected a row: %v", rows.Err())
+	}
+	var name string
+	if err := rows.Scan(&name); err == nil {
+		t.Fatal("expected Scan to fail without RETURN")
+	}
+	if rows.Row().Properties["name"] == nil {
+		t.Fatalf("bad row: %#v", rows.Row())
+	}
+	rows.Close()
+	rows.Close()
+
+	if err := db.Exec(ctx, "INSERT NODE Person (name: 'Dee', age: 50);"); err != nil {
+		t.Fatalf("exec after close: %v", err)
+	}
+}
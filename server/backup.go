@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+
+	"grapho/parser"
+	"grapho/storage"
+)
+
+/* ---------------------- Backups ---------------------- */
+
+// BACKUP runs outside the executor, under the lock snapshots take, so that
+// no snapshot cuts the commit log tail a backup copies; the archive itself
+// is written by package storage.
+
+// Backup writes a backup archive of the server to path while statements go
+// on running
+func (s *Server) Backup(ctx context.Context, path string) (*storage.BackupManifest, error) {
+	s.snapshots.mu.Lock()
+	defer s.snapshots.mu.Unlock()
+
+	s.execMu.Lock()
+	view, entries := s.exec.Snapshot(), 0
+	if s.commitLog != nil {
+		entries = s.commitLog.Entries()
+	}
+	s.execMu.Unlock()
+	return storage.WriteBackup(ctx, path, view, entries, s.commitLog)
+}
+
+// IncrementalBackup writes a backup archive to path of the commit log
+// entries after the first since; see storage.WriteIncrementalBackup
+func (s *Server) IncrementalBackup(ctx context.Context, path string, since int) (*storage.BackupManifest, error) {
+	s.snapshots.mu.Lock()
+	defer s.snapshots.mu.Unlock()
+	return storage.WriteIncrementalBackup(ctx, path, since, s.commitLog)
+}
+
+// executeBackup runs a lone BACKUP statement. s.execMu is held, as for
+// executeStatements, but let go while the backup is written.
+func (s *Server) executeBackup(ctx context.Context, out responder, stmt *parser.BackupStmt) {
+	since, err := storage.BackupSince(stmt)
+	if err != nil {
+		out.failed(1, err)
+		return
+	}
+	s.execMu.Unlock()
+	var m *storage.BackupManifest
+	if since < 0 {
+		m, err = s.Backup(ctx, stmt.Path)
+	} else {
+		m, err = s.IncrementalBackup(ctx, stmt.Path, since)
+	}
+	s.execMu.Lock()
+	if err != nil {
+		out.failed(1, err)
+		return
+	}
+	if m.Incremental {
+		out.Message("Backed up %d commit log entries after entry %d to %s", m.LogEntries-m.Entries, m.Entries, stmt.Path)
+	} else {
+		out.Message("Backed up the graph and commit log up to entry %d to %s", m.LogEntries, stmt.Path)
+	}
+	out.done(1)
+}
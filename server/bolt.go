@@ -0,0 +1,283 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+
+	"grapho/bolt"
+	"grapho/catalog"
+	"grapho/cypher"
+	"grapho/executor"
+	"grapho/parser"
+)
+
+// boltAgent is the server agent reported to drivers. Drivers expect a Neo4j
+// agent string, so the shim reports the Neo4j version whose protocol it speaks.
+const boltAgent = "Neo4j/4.4.0"
+
+var boltConnections atomic.Int64
+
+// StartBolt accepts Bolt connections from Neo4j drivers on addr and runs their
+// queries through the Cypher subset. It blocks until the server is stopped;
+// queries wait until Start has replayed the commit log.
+func (s *Server) StartBolt(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	s.mu.Lock()
+	s.boltListener = listener
+	s.mu.Unlock()
+	fmt.Printf("Bolt listening on %s\n", addr)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return nil
+			}
+			fmt.Printf("Failed to accept bolt connection: %v\n", err)
+			continue
+		}
+		s.mu.Lock()
+		s.clients[conn] = true
+		s.mu.Unlock()
+		go s.handleBolt(conn)
+	}
+}
+
+// boltSession is the state of one Bolt connection
+type boltSession struct {
+	s       *Server
+	conn    net.Conn
+	failed  bool    // after a FAILURE, requests are IGNORED until RESET
+	records [][]any // result of the last RUN, waiting for PULL
+	inTx    bool
+}
+
+func (s *Server) handleBolt(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	select {
+	case <-s.ready:
+	case <-s.ctx.Done():
+		return
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+
+	r := bufio.NewReader(conn)
+	v, err := bolt.Handshake(struct {
+		io.Reader
+		io.Writer
+	}{r, conn})
+	if err != nil {
+		fmt.Printf("Bolt handshake with %s failed: %v\n", conn.RemoteAddr(), err)
+		return
+	}
+	fmt.Printf("Bolt client connected: %s (protocol %s)\n", conn.RemoteAddr(), v)
+
+	bs := &boltSession{s: s, conn: conn}
+	for {
+		msg, err := bolt.Receive(r)
+		if err != nil {
+			return
+		}
+		if msg.Tag == bolt.MsgGoodbye {
+			return
+		}
+		if err := bs.handle(ctx, msg); err != nil {
+			return
+		}
+	}
+}
+
+// handle answers one request
+func (bs *boltSession) handle(ctx context.Context, msg bolt.Struct) error {
+	switch msg.Tag {
+	case bolt.MsgHello:
+		id := boltConnections.Add(1)
+		return bs.success(map[string]any{"server": boltAgent, "connection_id": fmt.Sprintf("bolt-%d", id)})
+	case bolt.MsgReset:
+		bs.failed, bs.records, bs.inTx = false, nil, false
+		return bs.success(nil)
+	}
+	if bs.failed {
+		return bolt.Send(bs.conn, bolt.MsgIgnored)
+	}
+
+	switch msg.Tag {
+	case bolt.MsgRun:
+		return bs.run(ctx, msg)
+	case bolt.MsgPull:
+		return bs.pull(msg)
+	case bolt.MsgDiscard:
+		bs.records = nil
+		return bs.success(map[string]any{"has_more": false})
+	case bolt.MsgBegin:
+		bs.inTx = true
+		return bs.success(nil)
+	case bolt.MsgCommit:
+		bs.inTx = false
+		return bs.success(map[string]any{"bookmark": "grapho"})
+	case bolt.MsgRollback:
+		bs.inTx = false
+		return bs.failure("Neo.ClientError.Transaction.Invalid", "rollback is not supported: statements are applied as they run")
+	case bolt.MsgRoute:
+		return bs.failure("Neo.ClientError.Request.Invalid", "routing is not supported; connect with the bolt:// scheme")
+	default:
+		return bs.failure("Neo.ClientError.Request.Invalid", fmt.Sprintf("unsupported message 0x%02X", msg.Tag))
+	}
+}
+
+// run executes RUN {query, parameters, extra}, keeping the records for PULL
+func (bs *boltSession) run(ctx context.Context, msg bolt.Struct) error {
+	if len(msg.Fields) < 2 {
+		return bs.failure("Neo.ClientError.Request.Invalid", "RUN needs a query and parameters")
+	}
+	query, _ := msg.Fields[0].(string)
+	params, _ := msg.Fields[1].(map[string]any)
+	fmt.Printf("Executing bolt query: %s\n", query)
+
+	queries, err := cypher.Compile(query, params)
+	if err != nil {
+		return bs.failure("Neo.ClientError.Statement.SyntaxError", err.Error())
+	}
+	var (
+		columns []cypher.Column
+		rows    []boltRow
+	)
+	for _, q := range queries {
+		out := &boltCollector{}
+		bs.s.executeTranslated(ctx, out, q.Stmts)
+		if out.err != nil {
+			return bs.failure("Neo.ClientError.Statement.ExecutionFailed", out.err.Error())
+		}
+		columns, rows = q.Columns, out.rows
+	}
+
+	cat := bs.s.exec.Registry().Current()
+	bs.records = bs.records[:0]
+	for _, row := range rows {
+		rec := make([]any, len(columns))
+		for i, c := range columns {
+			if c.Property == "" {
+				rec[i] = boltNode(cat, row)
+			} else {
+				rec[i] = boltValue(cat, row.nodeType, c.Property, row.props[c.Property])
+			}
+		}
+		bs.records = append(bs.records, rec)
+	}
+
+	fields := make([]any, len(columns))
+	for i, c := range columns {
+		fields[i] = c.Name
+	}
+	meta := map[string]any{"fields": fields, "t_first": int64(0)}
+	if bs.inTx {
+		meta["qid"] = int64(0)
+	}
+	return bs.success(meta)
+}
+
+// pull streams PULL {n} records; n is -1 for all of them
+func (bs *boltSession) pull(msg bolt.Struct) error {
+	n := int64(-1)
+	if len(msg.Fields) > 0 {
+		if extra, ok := msg.Fields[0].(map[string]any); ok {
+			if v, ok := extra["n"].(int64); ok {
+				n = v
+			}
+		}
+	}
+	count := len(bs.records)
+	if n >= 0 && int(n) < count {
+		count = int(n)
+	}
+	for _, rec := range bs.records[:count] {
+		if err := bolt.Send(bs.conn, bolt.MsgRecord, rec); err != nil {
+			return err
+		}
+	}
+	bs.records = bs.records[count:]
+	return bs.success(map[string]any{"has_more": len(bs.records) > 0, "t_last": int64(0), "type": "rw"})
+}
+
+func (bs *boltSession) success(meta map[string]any) error {
+	if meta == nil {
+		meta = map[string]any{}
+	}
+	return bolt.Send(bs.conn, bolt.MsgSuccess, meta)
+}
+
+func (bs *boltSession) failure(code, message string) error {
+	bs.failed = true
+	bs.records = nil
+	return bolt.Send(bs.conn, bolt.MsgFailure, map[string]any{"code": code, "message": message})
+}
+
+type boltRow struct {
+	nodeType, id string
+	props        map[string]any
+}
+
+// boltCollector gathers the rows and the first error of a translated query
+type boltCollector struct {
+	rows []boltRow
+	err  error
+}
+
+func (c *boltCollector) Message(format string, args ...any) {}
+
+func (c *boltCollector) ResultSet() {}
+
+func (c *boltCollector) Row(nodeType, id string, props map[string]interface{}) {
+	cp := make(map[string]any, len(props))
+	for k, v := range props {
+		cp[k] = v
+	}
+	c.rows = append(c.rows, boltRow{nodeType: nodeType, id: id, props: cp})
+}
+
+func (c *boltCollector) parseErrors(errs []parser.ParseError) {
+	c.err = parser.ParseErrors(errs)
+}
+
+func (c *boltCollector) failed(stmt int, err error) {
+	c.err = err
+}
+
+func (c *boltCollector) done(n int) {}
+
+// boltNode converts a result row to a node structure
+func boltNode(cat *catalog.Catalog, row boltRow) bolt.Struct {
+	id, _ := strconv.ParseInt(row.id, 10, 64)
+	props := make(map[string]any, len(row.props))
+	for name, v := range row.props {
+		if name == "_id" {
+			continue
+		}
+		props[name] = boltValue(cat, row.nodeType, name, v)
+	}
+	return bolt.Struct{Tag: bolt.TagNode, Fields: []any{id, []string{row.nodeType}, props}}
+}
+
+// boltValue converts a stored node property to its driver type
+func boltValue(cat *catalog.Catalog, nodeType, field string, v any) any {
+	var fields map[string]catalog.FieldSpec
+	if nt, ok := cat.Nodes[nodeType]; ok {
+		fields = nt.Fields
+	}
+	return executor.TypedValue(fields, field, v)
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"grapho/nats"
+	"grapho/storage"
+	"grapho/wire"
+)
+
+// CDCConfig configures StartCDC
+type CDCConfig struct {
+	NATS    string // host:port of the NATS server
+	Subject string // subject to publish committed statements to; "" disables publishing
+	Ingest  string // subject to take scripts to execute from; "" disables ingest
+}
+
+// CDCEvent is the message published for each commit log entry
+type CDCEvent struct {
+	// Offset is the commit log byte offset just past the entry. It grows with
+	// every entry, so consumers can use it to drop redeliveries.
+	Offset    int64  `json:"offset"`
+	Statement string `json:"statement"`
+}
+
+// cdcPollInterval is how often the publisher looks for new commit log entries
+const cdcPollInterval = 200 * time.Millisecond
+
+// StartCDC connects to NATS and runs the change stream until the server is
+// stopped. Publishing is at least once: the offset of the last entry the NATS
+// server confirmed is kept in cdc.offset next to the commit log, and entries
+// after it are published again after a restart. Ingested scripts run like
+// client commands; a reply, if the sender asked for one, goes out once the
+// script has been appended to the commit log.
+func (s *Server) StartCDC(cfg CDCConfig) error {
+	if s.commitLog == nil {
+		return errors.New("CDC needs a commit log")
+	}
+	if cfg.Subject != "" {
+		// hold back snapshots until the offset is read
+		s.snapshots.publishing.Store(true)
+	}
+	select {
+	case <-s.ready:
+	case <-s.ctx.Done():
+		return nil
+	}
+	conn, err := nats.Dial(s.ctx, cfg.NATS)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS at %s: %w", cfg.NATS, err)
+	}
+	defer conn.Close()
+
+	if cfg.Ingest != "" {
+		msgs := make(chan *nats.Msg, 1024)
+		if err := conn.Subscribe(cfg.Ingest, "grapho", func(m *nats.Msg) {
+			select {
+			case msgs <- m:
+			case <-s.ctx.Done():
+			}
+		}); err != nil {
+			return err
+		}
+		go s.ingest(conn, msgs)
+		fmt.Printf("CDC ingesting from %s on %s\n", cfg.Ingest, cfg.NATS)
+	}
+	if cfg.Subject == "" {
+		<-s.ctx.Done()
+		return nil
+	}
+	fmt.Printf("CDC publishing to %s on %s\n", cfg.Subject, cfg.NATS)
+	return s.publishChanges(conn, cfg.Subject)
+}
+
+// publishChanges tails the commit log, publishing each entry to subject
+func (s *Server) publishChanges(conn *nats.Conn, subject string) error {
+	offsetPath := filepath.Join(s.commitLog.Dir(), "cdc.offset")
+	pos, err := storage.ReadOffset(offsetPath)
+	if err != nil {
+		return err
+	}
+	s.snapshots.published.Store(pos)
+
+	ticker := time.NewTicker(cdcPollInterval)
+	defer ticker.Stop()
+	for {
+		next, err := s.commitLog.ReadFrom(s.ctx, pos, func(entry string, next int64) error {
+			b, _ := json.Marshal(CDCEvent{Offset: next, Statement: entry})
+			return conn.Publish(subject, b)
+		})
+		if err == nil && next != pos {
+			// record progress only once the NATS server has everything
+			if err = conn.Flush(s.ctx); err == nil {
+				err = storage.WriteOffset(offsetPath, next)
+				pos = next
+				s.snapshots.published.Store(pos)
+			}
+		}
+		if s.ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("CDC publish: %w", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return nil
+		}
+	}
+}
+
+// ingest executes the scripts in msgs in order and answers each message that
+// has a reply subject with the JSON the HTTP API would return
+func (s *Server) ingest(conn *nats.Conn, msgs <-chan *nats.Msg) {
+	for {
+		var m *nats.Msg
+		select {
+		case m = <-msgs:
+		case <-s.ctx.Done():
+			return
+		}
+		out := &httpCollector{
+			reg:  s.exec.Registry(),
+			resp: QueryResponse{Messages: []string{}, Rows: []wire.Row{}},
+		}
+		s.executeCommand(s.ctx, out, string(m.Data))
+		if m.Reply == "" {
+			continue
+		}
+		var reply any = out.resp
+		switch {
+		case out.parseErrs != nil:
+			reply = out.parseErrs
+		case out.err != nil:
+			reply = out.err
+		}
+		b, _ := json.Marshal(reply)
+		if err := conn.Publish(m.Reply, b); err != nil {
+			fmt.Printf("CDC ingest reply failed: %v\n", err)
+		}
+	}
+}
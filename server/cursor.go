@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"grapho/cypher"
+	"grapho/executor"
+	"grapho/parser"
+	"grapho/wire"
+)
+
+/* ---------------------- Cursors ---------------------- */
+
+// A connection may hold one cursor: wire.CursorCommand opens it over the rows
+// of a MATCH and wire.FetchCommand sends them a batch at a time, so a client
+// can read a huge result at its own pace and stop early. The cursor reads a
+// snapshot, so commands run on the connection meanwhile do not change its
+// rows. It is closed once its last row is sent, by wire.CloseCommand, by
+// opening another and when the connection ends.
+
+// cursorResponder is a responder of a connection that may open a cursor
+type cursorResponder interface {
+	responder
+	// fetched ends the answer to opening or fetching from a cursor, which
+	// sent n rows and has more left if more is set
+	fetched(n int, more bool)
+}
+
+// openCursor opens a cursor over the rows of command, a single MATCH in
+// language lang, reporting any error to out
+func (s *Server) openCursor(ctx context.Context, out cursorResponder, lang, command string) *executor.Cursor {
+	var (
+		stmts []parser.Stmt
+		err   error
+	)
+	if lang == wire.LanguageCypher {
+		stmts, err = cypher.Translate(command)
+	} else {
+		// parsed afresh, as a cached plan is rebound by the next command
+		// with its shape while the cursor still reads it
+		var errs []parser.ParseError
+		if stmts, errs = parser.NewParser(command).ParseScript(); len(errs) > 0 {
+			err = parser.ParseErrors(errs)
+		}
+	}
+	if err != nil {
+		var perrs parser.ParseErrors
+		if errors.As(err, &perrs) {
+			out.parseErrors(perrs)
+		} else {
+			out.failed(0, err)
+		}
+		return nil
+	}
+	var m *parser.MatchStmt
+	if len(stmts) == 1 {
+		m, _ = stmts[0].(*parser.MatchStmt)
+	}
+	if m == nil {
+		out.failed(0, fmt.Errorf("%s takes a single MATCH", wire.CursorCommand))
+		return nil
+	}
+	s.execMu.Lock()
+	cur, err := s.exec.OpenCursor(ctx, m)
+	s.execMu.Unlock()
+	if err != nil {
+		out.failed(1, err)
+		return nil
+	}
+	out.ResultSet()
+	_, more, _ := cur.Next(0)
+	out.fetched(0, more)
+	if !more {
+		cur.Close()
+		return nil
+	}
+	return cur
+}
+
+// fetch sends up to arg, a row count, of the next rows of cur, and returns
+// cur, or nil once it is closed
+func fetch(out cursorResponder, cur *executor.Cursor, arg string) *executor.Cursor {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 {
+		out.failed(0, fmt.Errorf("%s takes a row count, as in '%s 1000'", wire.FetchCommand, wire.FetchCommand))
+		return cur
+	}
+	if cur == nil {
+		out.failed(0, errors.New("no cursor is open"))
+		return nil
+	}
+	rows, more, err := cur.Next(n)
+	for _, r := range rows {
+		out.Row(r.Type, r.ID, r.Properties)
+	}
+	if err != nil {
+		cur.Close()
+		out.failed(0, err)
+		return nil
+	}
+	out.fetched(len(rows), more)
+	if !more {
+		cur.Close()
+		return nil
+	}
+	return cur
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"grapho/executor"
+	"grapho/parser"
+)
+
+// ExpiryField names the field that makes nodes and edges expire without a
+// TTL; see executor.ExpiryField
+const ExpiryField = executor.ExpiryField
+
+// ExpiryConfig configures StartExpiry
+type ExpiryConfig struct {
+	Interval time.Duration // time between sweeps
+	Batch    int           // most deletions per commit log entry; default 100
+}
+
+// ExpiryStats counts the nodes and edges the sweeper has deleted, by type
+type ExpiryStats struct {
+	Nodes     map[string]int64 `json:"nodes"`
+	Edges     map[string]int64 `json:"edges"`
+	LastSweep time.Time        `json:"last_sweep,omitzero"`
+}
+
+// expiryState is the sweeper's running count, read by the stats endpoint
+type expiryState struct {
+	mu    sync.Mutex
+	stats ExpiryStats
+}
+
+// StartExpiry deletes expired nodes and edges every cfg.Interval until the
+// server is stopped. Deletions are ordinary DELETE statements, run through the
+// executor and written to the commit log like a client's, at most cfg.Batch
+// to an entry so that no single entry holds up other commands for long.
+func (s *Server) StartExpiry(cfg ExpiryConfig) error {
+	if cfg.Interval <= 0 {
+		return fmt.Errorf("expiry interval must be positive, got %v", cfg.Interval)
+	}
+	if cfg.Batch <= 0 {
+		cfg.Batch = 100
+	}
+	select {
+	case <-s.ready:
+	case <-s.ctx.Done():
+		return nil
+	}
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		s.sweepExpired(cfg.Batch, time.Now())
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return nil
+		}
+	}
+}
+
+// ExpiryStats returns what the sweeper has deleted so far
+func (s *Server) ExpiryStats() ExpiryStats {
+	s.expiry.mu.Lock()
+	defer s.expiry.mu.Unlock()
+	st := ExpiryStats{Nodes: map[string]int64{}, Edges: map[string]int64{}, LastSweep: s.expiry.stats.LastSweep}
+	for t, n := range s.expiry.stats.Nodes {
+		st.Nodes[t] = n
+	}
+	for t, n := range s.expiry.stats.Edges {
+		st.Edges[t] = n
+	}
+	return st
+}
+
+// sweepExpired deletes what has expired by now; see executor.Expired. The
+// statements are worked out on a snapshot, so as not to hold up others, and
+// the stats count what they deleted when they ran.
+func (s *Server) sweepExpired(batch int, now time.Time) {
+	dels := s.snapshot().Expired(now)
+	for len(dels) > 0 && s.ctx.Err() == nil {
+		n := min(batch, len(dels))
+		stmts := make([]parser.Stmt, n)
+		for i, d := range dels[:n] {
+			stmts[i] = d.Stmt
+		}
+		out := &sweepCollector{httpCollector: httpCollector{reg: s.exec.Registry()}}
+		s.executeTranslated(s.ctx, out, stmts)
+		if out.err != nil {
+			fmt.Printf("Expiry sweep failed: %s\n", strings.Join(out.err.Messages, "; "))
+			break
+		}
+		s.expiry.mu.Lock()
+		if s.expiry.stats.Nodes == nil {
+			s.expiry.stats.Nodes, s.expiry.stats.Edges = map[string]int64{}, map[string]int64{}
+		}
+		for i, d := range dels[:len(out.changes)] {
+			if d.Node {
+				s.expiry.stats.Nodes[d.Type] += int64(out.changes[i].NodesDeleted)
+			} else {
+				s.expiry.stats.Edges[d.Type] += int64(out.changes[i].EdgesDeleted)
+			}
+		}
+		s.expiry.mu.Unlock()
+		dels = dels[n:]
+	}
+	s.expiry.mu.Lock()
+	s.expiry.stats.LastSweep = now
+	s.expiry.mu.Unlock()
+}
+
+// sweepCollector is the output of a batch of the sweeper's statements, which
+// keeps what each changed, in order
+type sweepCollector struct {
+	httpCollector
+	changes []executor.Change
+}
+
+func (c *sweepCollector) Changed(ch executor.Change, msg string) {
+	c.httpCollector.Changed(ch, msg)
+	c.changes = append(c.changes, ch)
+}
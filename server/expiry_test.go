@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"grapho/storage"
+)
+
+func TestStartExpiry(t *testing.T) {
+	s, hs := newTestServer(t)
+	cl, err := storage.OpenCommitLog(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl.Start()
+	defer cl.Stop()
+	s.AttachCommitLog(cl)
+
+	now := time.Now().UTC()
+	at := func(d time.Duration) string { return now.Add(d).Format(time.RFC3339Nano) }
+	script := fmt.Sprintf(`
+CREATE NODE User (name: string PRIMARY KEY);
+CREATE NODE Session (token: string PRIMARY KEY, expires_at: datetime);
+CREATE EDGE OWNS (FROM User MANY, TO Session MANY, PROPS (at: datetime TTL 'PT1H'));
+INSERT NODE User (name: 'ann');
+INSERT NODE Session (token: 's1', expires_at: '%[1]s');
+INSERT NODE Session (token: 's2', expires_at: '%[1]s');
+INSERT NODE Session (token: 's3', expires_at: '%[1]s');
+INSERT NODE Session (token: 's4', expires_at: '%[1]s');
+INSERT NODE Session (token: 's5', expires_at: '%[1]s');
+INSERT NODE Session (token: 's6', expires_at: '%[2]s');
+INSERT NODE Session (token: 's7');
+INSERT NODE Session (token: 's8', expires_at: '%[3]s');
+INSERT EDGE OWNS FROM User('ann') TO Session('s1') (at: '%[4]s');
+INSERT EDGE OWNS FROM User('ann') TO Session('s6') (at: '%[5]s');
+INSERT EDGE OWNS FROM User('ann') TO Session('s7') (at: '%[4]s');`,
+		at(-time.Hour), at(time.Hour), at(500*time.Millisecond), at(0), at(-2*time.Hour))
+	if resp, data := query(t, hs, script); resp.StatusCode != http.StatusOK {
+		t.Fatalf("setup: %s: %s", resp.Status, data)
+	}
+	before := cl.Entries()
+
+	// the first sweep deletes s1 to s5, the edge to s1 with it and the edge
+	// to s6, which is past its TTL, in seven statements: two to a commit log
+	// entry. s8 expires after it, for a later sweep.
+	go s.StartExpiry(ExpiryConfig{Interval: 10 * time.Millisecond, Batch: 2})
+	deadline := time.Now().Add(5 * time.Second)
+	for s.ExpiryStats().Nodes["Session"] < 6 {
+		if time.Now().After(deadline) {
+			t.Fatalf("sweeper stats after 5s: %+v", s.ExpiryStats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats := s.ExpiryStats()
+	if stats.Nodes["Session"] != 6 || stats.Nodes["User"] != 0 || stats.Edges["OWNS"] != 2 || stats.LastSweep.IsZero() {
+		t.Errorf("sweeper stats: %+v", stats)
+	}
+	if n := cl.Entries() - before; n != 5 {
+		t.Errorf("sweeps wrote %d commit log entries, want 4 and then 1", n)
+	}
+
+	resp, data := query(t, hs, "MATCH Session RETURN token;")
+	var qr QueryResponse
+	if err := json.Unmarshal(data, &qr); resp.StatusCode != http.StatusOK || err != nil {
+		t.Fatalf("sessions: %s, %v: %s", resp.Status, err, data)
+	}
+	var sessions []string
+	for _, row := range qr.Rows {
+		sessions = append(sessions, row.Properties["token"].(string))
+	}
+	slices.Sort(sessions)
+	if !slices.Equal(sessions, []string{"s6", "s7"}) {
+		t.Errorf("sessions left: %v, want s6 and s7", sessions)
+	}
+	g := s.snapshot().Graph()
+	if n := g.EdgeCount("OWNS"); n != 1 {
+		t.Errorf("%d OWNS edges left, want the one to s7", n)
+	}
+	if n := g.Nodes["User"].Len(); n != 1 {
+		t.Errorf("%d users left", n)
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"grapho/catalog"
+	"grapho/executor"
+	"grapho/gremlin"
+	"grapho/parser"
+)
+
+// StartGremlin serves the experimental Gremlin websocket endpoint on addr for
+// TinkerPop drivers and consoles. It blocks until the server is stopped;
+// requests wait until Start has replayed the commit log.
+func (s *Server) StartGremlin(addr string) error {
+	return s.serveHTTP(addr, "Gremlin", gremlin.Handler(gremlinGraph{s}))
+}
+
+// gremlinGraph exposes the executor's graph to traversals
+type gremlinGraph struct {
+	s *Server
+}
+
+func (g gremlinGraph) Vertices(ctx context.Context) ([]gremlin.Vertex, error) {
+	snap := g.s.snapshot()
+	cat := snap.Registry().Current()
+	var vs []gremlin.Vertex
+	for nodeType, nodes := range snap.Graph().Nodes {
+		var fields map[string]catalog.FieldSpec
+		if nt, ok := cat.Nodes[nodeType]; ok {
+			fields = nt.Fields
+		}
+		nodes.Range(func(id string, props map[string]interface{}) bool {
+			vs = append(vs, gremlinVertex(nodeType, id, props, fields))
+			return true
+		})
+	}
+	return vs, nil
+}
+
+func (g gremlinGraph) Edges(ctx context.Context) ([]gremlin.Edge, error) {
+	snap := g.s.snapshot()
+	cat := snap.Registry().Current()
+	var es []gremlin.Edge
+	edges := snap.Graph().Edges
+	types := make([]string, 0, len(edges))
+	for t := range edges {
+		types = append(types, t)
+	}
+	slices.Sort(types)
+	for _, edgeType := range types {
+		var fields map[string]catalog.FieldSpec
+		if et, ok := cat.Edges[edgeType]; ok {
+			fields = et.Props
+		}
+		for _, e := range edges[edgeType] {
+			if e.Deleted() {
+				continue
+			}
+			props := make(map[string]any, len(e.Properties))
+			for name, v := range e.Properties {
+				props[name] = executor.TypedValue(fields, name, v)
+			}
+			es = append(es, gremlin.Edge{ID: e.ID, Label: edgeType, OutV: e.FromNodeID, InV: e.ToNodeID, Properties: props})
+		}
+	}
+	return es, nil
+}
+
+// AddVertex runs an INSERT NODE through the commit-logged path
+func (g gremlinGraph) AddVertex(ctx context.Context, label string, props map[string]any) (gremlin.Vertex, error) {
+	stmt := parser.InsertNode(label)
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		lit, err := gremlinLiteral(props[name])
+		if err != nil {
+			return gremlin.Vertex{}, fmt.Errorf("property %s: %w", name, err)
+		}
+		stmt.Properties = append(stmt.Properties, parser.Prop(name, lit))
+	}
+
+	out := &insertCollector{}
+	g.s.executeTranslated(ctx, out, []parser.Stmt{stmt})
+	if out.err != nil {
+		return gremlin.Vertex{}, out.err
+	}
+	snap := g.s.snapshot()
+	cat := snap.Registry().Current()
+	var stored map[string]interface{}
+	if nodes := snap.Graph().Nodes[label]; nodes != nil {
+		stored, _ = nodes.Get(out.id)
+	}
+	return gremlinVertex(label, out.id, stored, cat.Nodes[label].Fields), nil
+}
+
+// gremlinVertex converts a stored node, dropping the internal _id property
+func gremlinVertex(nodeType, id string, stored map[string]interface{}, fields map[string]catalog.FieldSpec) gremlin.Vertex {
+	props := make(map[string]any, len(stored))
+	for name, v := range stored {
+		if name == "_id" {
+			continue
+		}
+		props[name] = executor.TypedValue(fields, name, v)
+	}
+	return gremlin.Vertex{ID: id, Label: nodeType, Properties: props}
+}
+
+func gremlinLiteral(v any) (*parser.Literal, error) {
+	switch v := v.(type) {
+	case nil:
+		return parser.Null(), nil
+	case bool:
+		return parser.Bool(v), nil
+	case string:
+		return parser.Str(v), nil
+	case int64:
+		return parser.Int(v), nil
+	case float64:
+		return parser.Float(v), nil
+	}
+	return nil, fmt.Errorf("unsupported value of type %T", v)
+}
+
+// insertCollector captures the ID an INSERT reports, and any error
+type insertCollector struct {
+	boltCollector
+	id string
+}
+
+func (c *insertCollector) Changed(ch executor.Change, msg string) {
+	if len(ch.IDs) == 1 {
+		c.id = ch.IDs[0]
+	}
+}
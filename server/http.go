@@ -0,0 +1,451 @@
+package server
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"grapho/arrow"
+	"grapho/catalog"
+	"grapho/executor"
+	"grapho/parser"
+	"grapho/storage"
+	"grapho/wire"
+)
+
+// openAPISpec describes the HTTP API; keep it in step with the handlers below
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// StartHTTP serves the JSON HTTP API on addr. It blocks until the server is
+// stopped; requests wait until Start has replayed the commit log.
+func (s *Server) StartHTTP(addr string) error {
+	mux := http.NewServeMux()
+	for pattern, h := range s.httpRoutes() {
+		mux.HandleFunc(pattern, h)
+	}
+	return s.serveHTTP(addr, "HTTP API", mux)
+}
+
+// httpRoutes returns the handlers of the HTTP API by pattern, as
+// http.ServeMux takes them; openapi.json describes each
+func (s *Server) httpRoutes() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"POST /query": s.handleQuery,
+		"GET /schema": s.handleSchema,
+		"GET /health": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		},
+		"GET /admin/stats": s.handleStats,
+		"GET /openapi.json": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(openAPISpec)
+		},
+	}
+}
+
+// serveHTTP serves h on addr until the server is stopped. Requests wait for
+// the commit log replay.
+func (s *Server) serveHTTP(addr, name string, h http.Handler) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	hs := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-s.ready:
+			case <-r.Context().Done():
+				return
+			}
+			h.ServeHTTP(w, r)
+		}),
+		BaseContext: func(net.Listener) context.Context { return s.ctx },
+	}
+	s.mu.Lock()
+	s.httpServers = append(s.httpServers, hs)
+	s.mu.Unlock()
+	fmt.Printf("%s listening on %s\n", name, addr)
+
+	if err := hs.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// QueryRequest is the body of POST /query
+type QueryRequest struct {
+	Query    string `json:"query"`
+	Language string `json:"language,omitempty"` // wire.LanguageGrapho (default) or wire.LanguageCypher
+}
+
+// QueryResponse is the result of a successful POST /query
+type QueryResponse struct {
+	Statements int           `json:"statements"`
+	Messages   []string      `json:"messages"`
+	Rows       []wire.Row    `json:"rows"`
+	Affected   wire.Affected `json:"affected"` // summed over the statements
+}
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	var req QueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, wire.Error{Messages: []string{"bad request body: " + err.Error()}})
+		return
+	}
+	out := &httpCollector{
+		reg:  s.exec.Registry(),
+		resp: QueryResponse{Messages: []string{}, Rows: []wire.Row{}},
+	}
+	switch req.Language {
+	case "", wire.LanguageGrapho:
+		s.executeCommand(r.Context(), out, req.Query)
+	case wire.LanguageCypher:
+		s.executeCypher(r.Context(), out, req.Query)
+	default:
+		writeJSON(w, http.StatusBadRequest, wire.Error{Messages: []string{fmt.Sprintf("unknown language '%s'", req.Language)}})
+		return
+	}
+
+	switch {
+	case out.parseErrs != nil:
+		writeJSON(w, http.StatusBadRequest, *out.parseErrs)
+	case out.err != nil:
+		writeJSON(w, out.status, *out.err)
+	case acceptsArrow(r):
+		fields, rows := arrowTable(out.resp.Rows)
+		w.Header().Set("Content-Type", arrow.MIMEType)
+		if err := arrow.WriteStream(w, fields, rows); err != nil {
+			fmt.Printf("Error writing Arrow response: %v\n", err)
+		}
+	default:
+		writeJSON(w, http.StatusOK, out.resp)
+	}
+}
+
+// acceptsArrow reports whether the client asked for an Arrow IPC stream
+func acceptsArrow(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mt := range strings.Split(accept, ",") {
+			mt, _, _ = strings.Cut(mt, ";")
+			if strings.EqualFold(strings.TrimSpace(mt), arrow.MIMEType) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// arrowTable lays rows out as columns: _type, _id, then every property in
+// name order. A property column is int64 or bool if all its values are,
+// float64 if they are all numbers, and utf8 otherwise, with values that are
+// not strings written as JSON.
+func arrowTable(rows []wire.Row) ([]arrow.Field, [][]any) {
+	kinds := map[string]arrow.Type{}
+	for _, row := range rows {
+		for name, v := range row.Properties {
+			kind, seen := kinds[name]
+			switch v.(type) {
+			case nil:
+				continue
+			case int64:
+				if !seen || kind == arrow.Int64 {
+					kinds[name] = arrow.Int64
+				} else if kind != arrow.Float64 {
+					kinds[name] = arrow.Utf8
+				}
+			case float64:
+				if !seen || kind == arrow.Int64 || kind == arrow.Float64 {
+					kinds[name] = arrow.Float64
+				} else {
+					kinds[name] = arrow.Utf8
+				}
+			case bool:
+				if !seen || kind == arrow.Bool {
+					kinds[name] = arrow.Bool
+				} else {
+					kinds[name] = arrow.Utf8
+				}
+			default:
+				kinds[name] = arrow.Utf8
+			}
+		}
+	}
+
+	fields := []arrow.Field{{Name: "_type", Type: arrow.Utf8}, {Name: "_id", Type: arrow.Utf8}}
+	for _, name := range sortedNames(kinds) {
+		fields = append(fields, arrow.Field{Name: name, Type: kinds[name]})
+	}
+	table := make([][]any, len(rows))
+	for i, row := range rows {
+		values := []any{row.Type, row.ID}
+		for _, f := range fields[2:] {
+			v := row.Properties[f.Name]
+			if n, ok := v.(int64); ok && f.Type == arrow.Float64 {
+				v = float64(n)
+			}
+			if _, ok := v.(string); !ok && v != nil && f.Type == arrow.Utf8 {
+				b, _ := json.Marshal(v)
+				v = string(b)
+			}
+			values = append(values, v)
+		}
+		table[i] = values
+	}
+	return fields, table
+}
+
+// SchemaField describes a node field or an edge property
+type SchemaField struct {
+	Name    string  `json:"name"`
+	Type    string  `json:"type"` // as written in DDL, e.g. "int" or "array<string>"
+	Unique  bool    `json:"unique,omitempty"`
+	Index   bool    `json:"index,omitempty"` // INDEX, for a node field
+	NotNull bool    `json:"notNull,omitempty"`
+	Default *string `json:"default,omitempty"`
+
+	// Fulltext is "words", or "stems" WITH STEMMING, for a node field with a
+	// full-text index
+	Fulltext string `json:"fulltext,omitempty"`
+}
+
+// SchemaNode describes a node type
+type SchemaNode struct {
+	Name       string        `json:"name"`
+	PrimaryKey string        `json:"primaryKey,omitempty"`
+	Fields     []SchemaField `json:"fields"`
+}
+
+// SchemaEdge describes an edge type
+type SchemaEdge struct {
+	Name  string        `json:"name"`
+	From  string        `json:"from"` // e.g. "Person MANY"
+	To    string        `json:"to"`
+	Props []SchemaField `json:"props"`
+}
+
+// Schema is the result of GET /schema
+type Schema struct {
+	Nodes []SchemaNode `json:"nodes"`
+	Edges []SchemaEdge `json:"edges"`
+}
+
+func (s *Server) handleSchema(w http.ResponseWriter, r *http.Request) {
+	cat := s.exec.Registry().Current()
+	schema := Schema{Nodes: []SchemaNode{}, Edges: []SchemaEdge{}}
+	for _, name := range sortedNames(cat.Nodes) {
+		nt := cat.Nodes[name]
+		fields := schemaFields(nt.Fields)
+		for i, f := range fields {
+			if idx, ok := nt.Indexes[f.Name]; ok && !idx.Unique {
+				fields[i].Index = true
+			}
+			if ft, ok := nt.Fulltext[f.Name]; ok {
+				fields[i].Fulltext = "words"
+				if ft.Stem {
+					fields[i].Fulltext = "stems"
+				}
+			}
+		}
+		schema.Nodes = append(schema.Nodes, SchemaNode{Name: name, PrimaryKey: nt.PK, Fields: fields})
+	}
+	for _, name := range sortedNames(cat.Edges) {
+		et := cat.Edges[name]
+		schema.Edges = append(schema.Edges, SchemaEdge{
+			Name:  name,
+			From:  schemaEndpoint(et.From),
+			To:    schemaEndpoint(et.To),
+			Props: schemaFields(et.Props),
+		})
+	}
+	writeJSON(w, http.StatusOK, schema)
+}
+
+// Stats is the result of GET /admin/stats
+type Stats struct {
+	Nodes   map[string]int `json:"nodes"` // node count by type
+	Edges   map[string]int `json:"edges"` // edge count by type
+	Clients int            `json:"clients"`
+
+	// Quota says how full the data directory is, if it has a quota; see
+	// SetQuota
+	Quota *storage.QuotaStats `json:"quota,omitempty"`
+
+	// LogEntries numbers the last commit log entry, counting those snapshots
+	// cut; BACKUP ... SINCE takes such a number. 0 without a commit log.
+	LogEntries int `json:"log_entries"`
+
+	// PlanCache counts how often scripts reused the parsed statements of an
+	// earlier script with the same shape
+	PlanCache executor.PlanCacheStats `json:"plan_cache"`
+
+	// NodeCache counts how often lookups found a node of a data segment
+	// decoded already; see executor.Executor.SetCacheSize
+	NodeCache executor.NodeCacheStats `json:"node_cache"`
+
+	// Expired counts what the expiry sweeper has deleted; see StartExpiry
+	Expired ExpiryStats `json:"expired"`
+
+	// Vacuumed counts what the background vacuum has reclaimed; see
+	// StartVacuum
+	Vacuumed VacuumStats `json:"vacuumed"`
+
+	// Planner holds the latest statistics StartStats collected, if any
+	Planner *executor.Statistics `json:"planner,omitempty"`
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	stats := Stats{Nodes: map[string]int{}, Edges: map[string]int{}}
+	s.execMu.Lock()
+	g := s.exec.Graph()
+	for t, nodes := range g.Nodes {
+		stats.Nodes[t] = nodes.Len()
+	}
+	for t := range g.Edges {
+		stats.Edges[t] = g.EdgeCount(t)
+	}
+	stats.PlanCache = s.exec.PlanCacheStats()
+	stats.NodeCache = s.exec.NodeCacheStats()
+	stats.Planner = s.exec.Stats()
+	if s.commitLog != nil {
+		stats.LogEntries = s.commitLog.Entries()
+	}
+	s.execMu.Unlock()
+	stats.Expired = s.ExpiryStats()
+	stats.Vacuumed = s.VacuumStats()
+	if s.quota != nil {
+		qs := s.quota.Stats()
+		stats.Quota = &qs
+	}
+	s.mu.RLock()
+	stats.Clients = len(s.clients)
+	s.mu.RUnlock()
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func schemaFields(fields map[string]catalog.FieldSpec) []SchemaField {
+	out := []SchemaField{}
+	for _, name := range sortedNames(fields) {
+		f := fields[name]
+		out = append(out, SchemaField{Name: name, Type: schemaType(f.Type), Unique: f.Unique, NotNull: f.NotNull, Default: f.DefaultRaw})
+	}
+	return out
+}
+
+// schemaType spells t the way DDL does
+func schemaType(t catalog.TypeSpec) string {
+	switch {
+	case t.Elem != nil:
+		return "array<" + schemaType(*t.Elem) + ">"
+	case len(t.EnumVals) > 0:
+		vals := make([]string, len(t.EnumVals))
+		for i, v := range t.EnumVals {
+			vals[i] = "'" + strings.ReplaceAll(v, "'", "''") + "'"
+		}
+		return "enum<" + strings.Join(vals, ", ") + ">"
+	case t.Base == catalog.BaseVector:
+		return fmt.Sprintf("vector<float, %d>", t.Dim)
+	}
+	names := [...]string{
+		catalog.BaseString: "string", catalog.BaseText: "text", catalog.BaseInt: "int",
+		catalog.BaseFloat: "float", catalog.BaseBool: "bool", catalog.BaseUUID: "uuid",
+		catalog.BaseDate: "date", catalog.BaseTime: "time", catalog.BaseDateTime: "datetime",
+		catalog.BaseJSON: "json", catalog.BaseBlob: "blob", catalog.BasePoint: "point",
+	}
+	if int(t.Base) < len(names) {
+		return names[t.Base]
+	}
+	return "string"
+}
+
+func schemaEndpoint(e catalog.EdgeEndpoint) string {
+	if e.Card == catalog.Many {
+		return e.Label + " MANY"
+	}
+	return e.Label + " ONE"
+}
+
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+// httpCollector gathers a query's output into the JSON response
+type httpCollector struct {
+	reg       *catalog.Registry
+	resp      QueryResponse
+	change    executor.Change
+	parseErrs *wire.Error
+	err       *wire.Error
+	status    int
+}
+
+func (c *httpCollector) Message(format string, args ...any) {
+	c.resp.Messages = append(c.resp.Messages, fmt.Sprintf(format, args...))
+}
+
+func (c *httpCollector) Changed(ch executor.Change, msg string) {
+	c.resp.Messages = append(c.resp.Messages, msg)
+	c.change.Add(ch)
+}
+
+func (c *httpCollector) ResultSet() {}
+
+func (c *httpCollector) Row(nodeType, id string, props map[string]interface{}) {
+	var fields map[string]catalog.FieldSpec
+	if nt, ok := c.reg.Current().Nodes[nodeType]; ok {
+		fields = nt.Fields
+	}
+	typed := make(map[string]any, len(props))
+	for name, v := range props {
+		if name != "_id" {
+			typed[name] = executor.TypedValue(fields, name, v)
+		}
+	}
+	c.resp.Rows = append(c.resp.Rows, wire.Row{Type: nodeType, ID: id, Properties: typed})
+}
+
+func (c *httpCollector) parseErrors(errs []parser.ParseError) {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	c.parseErrs = &wire.Error{Messages: msgs}
+}
+
+// failed maps missing types and nodes to 404, writes refused for the disk
+// quota to 507 and other failures to 422
+func (c *httpCollector) failed(stmt int, err error) {
+	c.status = http.StatusUnprocessableEntity
+	switch {
+	case errors.Is(err, executor.ErrNotFound):
+		c.status = http.StatusNotFound
+	case errors.Is(err, storage.ErrQuotaExceeded):
+		c.status = http.StatusInsufficientStorage
+	}
+	c.err = &wire.Error{Statement: stmt, Messages: []string{err.Error()}}
+}
+
+func (c *httpCollector) done(n int) {
+	c.resp.Statements = n
+	c.resp.Affected = *wireAffected(c.change)
+}
@@ -0,0 +1,374 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"grapho/arrow"
+	"grapho/catalog"
+	"grapho/storage"
+	"grapho/wire"
+)
+
+// newTestServer returns a server with an empty catalog and no commit log,
+// ready for statements, and an HTTP server of its API
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	reg, err := catalog.Open(context.Background(), catalog.NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer("127.0.0.1:0", reg)
+	close(s.ready)
+	mux := http.NewServeMux()
+	for pattern, h := range s.httpRoutes() {
+		mux.HandleFunc(pattern, h)
+	}
+	hs := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		hs.Close()
+		s.Stop()
+	})
+	return s, hs
+}
+
+// post sends body to POST /query, accepting the media types in accept if
+// it is set, and returns the response with its body read
+func post(t *testing.T, hs *httptest.Server, body, accept string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest("POST", hs.URL+"/query", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := hs.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, data
+}
+
+// query runs script through POST /query
+func query(t *testing.T, hs *httptest.Server, script string) (*http.Response, []byte) {
+	t.Helper()
+	body, _ := json.Marshal(QueryRequest{Query: script})
+	return post(t, hs, string(body), "")
+}
+
+// get fetches path and decodes its JSON body into v
+func get(t *testing.T, hs *httptest.Server, path string, v any) {
+	t.Helper()
+	resp, err := hs.Client().Get(hs.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("GET %s: %s, %s", path, resp.Status, resp.Header.Get("Content-Type"))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+}
+
+const testSchema = `
+CREATE NODE Person (name: string PRIMARY KEY, age: int INDEX);
+CREATE NODE Company (name: string PRIMARY KEY);
+CREATE EDGE WORKS_AT (FROM Person MANY, TO Company ONE, PROPS (since: int));
+INSERT NODE Person (name: 'ann', age: 31);
+INSERT NODE Person (name: 'bob');
+INSERT NODE Company (name: 'acme');
+INSERT EDGE WORKS_AT FROM Person('ann') TO Company('acme') (since: 2020);`
+
+func TestHTTPQuery(t *testing.T) {
+	_, hs := newTestServer(t)
+
+	resp, data := query(t, hs, testSchema)
+	var qr QueryResponse
+	if err := json.Unmarshal(data, &qr); resp.StatusCode != http.StatusOK || err != nil {
+		t.Fatalf("setup: %s, %v: %s", resp.Status, err, data)
+	}
+	want := wire.Affected{NodesInserted: 3, EdgesInserted: 1, IDs: []string{"ann", "bob", "acme", "edge_1"}}
+	if qr.Statements != 7 || !reflect.DeepEqual(qr.Affected, want) || len(qr.Messages) != 4 {
+		t.Errorf("setup: %+v", qr)
+	}
+
+	resp, data = query(t, hs, "MATCH Person WHERE name: 'ann';")
+	qr = QueryResponse{}
+	if err := json.Unmarshal(data, &qr); resp.StatusCode != http.StatusOK || err != nil {
+		t.Fatalf("match: %s, %v: %s", resp.Status, err, data)
+	}
+	row := wire.Row{Type: "Person", ID: "ann", Properties: map[string]any{"name": "ann", "age": float64(31)}}
+	if qr.Statements != 1 || len(qr.Rows) != 1 || !reflect.DeepEqual(qr.Rows[0], row) {
+		t.Errorf("match: %+v", qr)
+	}
+
+	for _, tc := range []struct {
+		name, body string
+		status     int
+		statement  int
+	}{
+		{"bad body", `{"query": `, http.StatusBadRequest, 0},
+		{"unknown language", `{"query": "MATCH Person;", "language": "sql"}`, http.StatusBadRequest, 0},
+		{"parse error", `{"query": "MATCH Person WHERE;"}`, http.StatusBadRequest, 0},
+		{"missing type", `{"query": "MATCH Person; INSERT NODE Robot (name: 'r2');"}`, http.StatusNotFound, 2},
+		{"missing node", `{"query": "INSERT EDGE WORKS_AT FROM Person('cid') TO Company('acme');"}`, http.StatusNotFound, 1},
+		{"constraint", `{"query": "INSERT NODE Person (name: 'ann');"}`, http.StatusUnprocessableEntity, 1},
+		{"type error", `{"query": "INSERT NODE Person (name: 'cid', age: 'old');"}`, http.StatusUnprocessableEntity, 1},
+	} {
+		resp, data := post(t, hs, tc.body, "")
+		var e wire.Error
+		if err := json.Unmarshal(data, &e); err != nil {
+			t.Errorf("%s: %v: %s", tc.name, err, data)
+			continue
+		}
+		if resp.StatusCode != tc.status || e.Statement != tc.statement || len(e.Messages) == 0 {
+			t.Errorf("%s: %s, %+v; want %d for statement %d", tc.name, resp.Status, e, tc.status, tc.statement)
+		}
+	}
+
+	// nothing of a failed script is left behind
+	resp, data = query(t, hs, "MATCH Person;")
+	qr = QueryResponse{}
+	if err := json.Unmarshal(data, &qr); err != nil || len(qr.Rows) != 2 {
+		t.Errorf("after failures: %s, %v: %s", resp.Status, err, data)
+	}
+}
+
+func TestHTTPQueryLogsWhatRan(t *testing.T) {
+	s, hs := newTestServer(t)
+	cl, err := storage.OpenCommitLog(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl.Start()
+	s.AttachCommitLog(cl)
+	if resp, data := query(t, hs, testSchema+" CREATE NODE Device (id: uuid PRIMARY KEY, serial: string);"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("setup: %s: %s", resp.Status, data)
+	}
+
+	before := cl.Entries()
+
+	// the statements before the one that fails stay applied, so they are
+	// logged, with the key the device was given
+	resp, data := post(t, hs, `{"query": "INSERT NODE Person (name: 'cid'); INSERT NODE Device (serial: 'a1'); INSERT NODE Person (name: 'dee', age: 'old'); INSERT NODE Person (name: 'eve');"}`, "")
+	var e wire.Error
+	if err := json.Unmarshal(data, &e); err != nil || resp.StatusCode != http.StatusUnprocessableEntity || e.Statement != 3 {
+		t.Fatalf("failed script: %s, %v: %s", resp.Status, err, data)
+	}
+	if n := cl.Entries() - before; n != 1 {
+		t.Errorf("failed script wrote %d commit log entries, want 1", n)
+	}
+	if err := cl.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	if err := cl.Replay(context.Background(), func(line string) error {
+		lines = append(lines, line)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := regexp.MustCompile(`^INSERT NODE Person \(name: 'cid'\); INSERT NODE Device \(serial: 'a1', id: '[0-9a-f-]{36}'\);$`)
+	if last := lines[len(lines)-1]; !want.MatchString(last) {
+		t.Errorf("commit log ends with %q, want the first two inserts", last)
+	}
+}
+
+func TestHTTPArrow(t *testing.T) {
+	_, hs := newTestServer(t)
+	if resp, data := query(t, hs, testSchema); resp.StatusCode != http.StatusOK {
+		t.Fatalf("setup: %s: %s", resp.Status, data)
+	}
+
+	var want bytes.Buffer
+	fields := []arrow.Field{
+		{Name: "_type", Type: arrow.Utf8},
+		{Name: "_id", Type: arrow.Utf8},
+		{Name: "age", Type: arrow.Int64},
+		{Name: "name", Type: arrow.Utf8},
+	}
+	if err := arrow.WriteStream(&want, fields, [][]any{{"Person", "ann", int64(31), "ann"}}); err != nil {
+		t.Fatal(err)
+	}
+	body := `{"query": "MATCH Person WHERE name: 'ann';"}`
+	for _, accept := range []string{arrow.MIMEType, "application/json;q=0.5, " + arrow.MIMEType + ";q=1"} {
+		resp, data := post(t, hs, body, accept)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != arrow.MIMEType {
+			t.Errorf("Accept %s: %s, %s", accept, resp.Status, resp.Header.Get("Content-Type"))
+		}
+		if !bytes.Equal(data, want.Bytes()) {
+			t.Errorf("Accept %s: the stream differs from the one written for the row", accept)
+		}
+	}
+
+	// JSON unless Arrow is asked for, and errors are JSON either way
+	if resp, _ := post(t, hs, body, "application/json"); resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Accept application/json: %s", resp.Header.Get("Content-Type"))
+	}
+	resp, data := post(t, hs, `{"query": "INSERT NODE Robot (name: 'r2');"}`, arrow.MIMEType)
+	if resp.StatusCode != http.StatusNotFound || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("error with Accept %s: %s, %s: %s", arrow.MIMEType, resp.Status, resp.Header.Get("Content-Type"), data)
+	}
+}
+
+func TestHTTPSchemaHealthStats(t *testing.T) {
+	s, hs := newTestServer(t)
+	if resp, data := query(t, hs, testSchema); resp.StatusCode != http.StatusOK {
+		t.Fatalf("setup: %s: %s", resp.Status, data)
+	}
+
+	var schema Schema
+	get(t, hs, "/schema", &schema)
+	want := Schema{
+		Nodes: []SchemaNode{
+			{Name: "Company", PrimaryKey: "name", Fields: []SchemaField{{Name: "name", Type: "string"}}},
+			{Name: "Person", PrimaryKey: "name", Fields: []SchemaField{
+				{Name: "age", Type: "int", Index: true},
+				{Name: "name", Type: "string"},
+			}},
+		},
+		Edges: []SchemaEdge{
+			{Name: "WORKS_AT", From: "Person MANY", To: "Company ONE", Props: []SchemaField{{Name: "since", Type: "int"}}},
+		},
+	}
+	if !reflect.DeepEqual(schema, want) {
+		t.Errorf("schema:\n%+v\nwant\n%+v", schema, want)
+	}
+
+	var health map[string]string
+	get(t, hs, "/health", &health)
+	if !reflect.DeepEqual(health, map[string]string{"status": "ok"}) {
+		t.Errorf("health: %v", health)
+	}
+
+	now := time.Now()
+	s.expiry.stats = ExpiryStats{Nodes: map[string]int64{"Person": 2}, Edges: map[string]int64{}, LastSweep: now}
+	var stats Stats
+	get(t, hs, "/admin/stats", &stats)
+	if !reflect.DeepEqual(stats.Nodes, map[string]int{"Person": 2, "Company": 1}) || !reflect.DeepEqual(stats.Edges, map[string]int{"WORKS_AT": 1}) {
+		t.Errorf("stats counts: %v, %v", stats.Nodes, stats.Edges)
+	}
+	if stats.LogEntries != 0 || stats.Quota != nil || stats.Clients != 0 {
+		t.Errorf("stats without a commit log, quota or clients: %+v", stats)
+	}
+	if stats.Expired.Nodes["Person"] != 2 || !stats.Expired.LastSweep.Equal(now) {
+		t.Errorf("expired: %+v", stats.Expired)
+	}
+}
+
+// TestOpenAPI checks that openapi.json describes every route, and every
+// field of the JSON the routes answer with
+func TestOpenAPI(t *testing.T) {
+	s, hs := newTestServer(t)
+	var spec struct {
+		Paths      map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	get(t, hs, "/openapi.json", &spec)
+
+	for pattern := range s.httpRoutes() {
+		method, path, _ := strings.Cut(pattern, " ")
+		if _, ok := spec.Paths[path][strings.ToLower(method)]; !ok {
+			t.Errorf("%s is not in openapi.json", pattern)
+		}
+	}
+	if len(spec.Paths) != len(s.httpRoutes()) {
+		t.Errorf("openapi.json has %d paths, the server %d routes", len(spec.Paths), len(s.httpRoutes()))
+	}
+
+	// resolve follows a $ref to the schema it names
+	resolve := func(schema any) map[string]any {
+		m, _ := schema.(map[string]any)
+		if ref, ok := m["$ref"].(string); ok {
+			m, _ = spec.Components.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]any)
+		}
+		return m
+	}
+	// walk checks that schema describes the fields of a value of typ
+	var walk func(typ reflect.Type, schema map[string]any, where string)
+	walk = func(typ reflect.Type, schema map[string]any, where string) {
+		for typ.Kind() == reflect.Pointer {
+			typ = typ.Elem()
+		}
+		if _, ok := reflect.New(typ).Interface().(json.Marshaler); ok || typ == reflect.TypeFor[time.Time]() {
+			return
+		}
+		switch typ.Kind() {
+		case reflect.Slice:
+			if items := resolve(schema["items"]); items != nil {
+				walk(typ.Elem(), items, where+"[]")
+			}
+		case reflect.Map:
+			if values := resolve(schema["additionalProperties"]); values != nil {
+				walk(typ.Elem(), values, where+"{}")
+			}
+		case reflect.Struct:
+			props, _ := schema["properties"].(map[string]any)
+			for i := 0; i < typ.NumField(); i++ {
+				f := typ.Field(i)
+				tag := f.Tag.Get("json")
+				if f.Anonymous && tag == "" {
+					walk(f.Type, schema, where)
+					continue
+				}
+				name, _, _ := strings.Cut(tag, ",")
+				if !f.IsExported() || name == "-" {
+					continue
+				}
+				if name == "" {
+					name = f.Name
+				}
+				prop := resolve(props[name])
+				if prop == nil {
+					t.Errorf("%s.%s is not in openapi.json", where, name)
+					continue
+				}
+				walk(f.Type, prop, where+"."+name)
+			}
+		}
+	}
+	for _, tc := range []struct {
+		path, method, status string
+		v                    any
+	}{
+		{"/query", "post", "200", QueryResponse{}},
+		{"/query", "post", "400", wire.Error{}},
+		{"/query", "post", "404", wire.Error{}},
+		{"/query", "post", "422", wire.Error{}},
+		{"/query", "post", "507", wire.Error{}},
+		{"/schema", "get", "200", Schema{}},
+		{"/admin/stats", "get", "200", Stats{}},
+	} {
+		op, _ := spec.Paths[tc.path][tc.method].(map[string]any)
+		responses, _ := op["responses"].(map[string]any)
+		resp, _ := responses[tc.status].(map[string]any)
+		content, _ := resp["content"].(map[string]any)
+		media, _ := content["application/json"].(map[string]any)
+		schema := resolve(media["schema"])
+		if schema == nil {
+			t.Errorf("%s %s has no JSON schema for %s", tc.method, tc.path, tc.status)
+			continue
+		}
+		walk(reflect.TypeOf(tc.v), schema, tc.path)
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"fmt"
+	"io"
+
+	"grapho/executor"
+	"grapho/parser"
+	"grapho/wire"
+)
+
+// responder delivers command output to a client in its negotiated protocol
+type responder interface {
+	executor.Output
+	parseErrors(errs []parser.ParseError)
+	failed(stmt int, err error)
+	done(n int)
+}
+
+// textResponder writes the human-readable protocol used by telnet-style clients
+type textResponder struct {
+	w           io.Writer
+	currentType string
+}
+
+func (r *textResponder) Message(format string, args ...any) {
+	fmt.Fprintf(r.w, format+"\n", args...)
+}
+
+func (r *textResponder) ResultSet() {
+	r.currentType = ""
+	fmt.Fprintf(r.w, "MATCH Results:\n")
+}
+
+func (r *textResponder) Row(nodeType, id string, props map[string]interface{}) {
+	if nodeType == "" {
+		// a row joining several nodes, from a path MATCH
+		fmt.Fprintf(r.w, "  %v\n", props)
+		return
+	}
+	if nodeType != r.currentType {
+		r.currentType = nodeType
+		fmt.Fprintf(r.w, "\nNodes of type '%s':\n", nodeType)
+	}
+	fmt.Fprintf(r.w, "  ID: %s, Properties: %v\n", id, props)
+}
+
+func (r *textResponder) parseErrors(errs []parser.ParseError) {
+	fmt.Fprintf(r.w, "Parse errors:\n")
+	for _, err := range errs {
+		fmt.Fprintf(r.w, "  %s\n", err.Error())
+	}
+	fmt.Fprintf(r.w, "\n")
+}
+
+// failed reports err; stmt is 0 for errors that concern no particular statement
+func (r *textResponder) failed(stmt int, err error) {
+	if stmt == 0 {
+		fmt.Fprintf(r.w, "Error: %s\n", err.Error())
+		return
+	}
+	fmt.Fprintf(r.w, "Error executing statement %d: %s\n", stmt, err.Error())
+}
+
+func (r *textResponder) done(n int) {
+	if n == 0 {
+		fmt.Fprintf(r.w, "No statements to execute\n\n")
+		return
+	}
+	fmt.Fprintf(r.w, "OK - %d statement(s) executed successfully\n\n", n)
+}
+
+func (r *textResponder) fetched(n int, more bool) {
+	if more {
+		fmt.Fprintf(r.w, "Fetched %d row(s); send '%s N' for more\n\n", n, wire.FetchCommand)
+		return
+	}
+	fmt.Fprintf(r.w, "Fetched %d row(s); cursor closed\n\n", n)
+}
+
+// frameResponder writes wire frames for clients that sent wire.SwitchCommand
+type frameResponder struct {
+	w    io.Writer
+	rows *wire.RowWriter // reused across rows; see wire.RowWriter
+}
+
+func (r *frameResponder) Message(format string, args ...any) {
+	_ = wire.WriteFrame(r.w, wire.FrameMessage, wire.Message{Text: fmt.Sprintf(format, args...)})
+}
+
+func (r *frameResponder) Changed(c executor.Change, msg string) {
+	_ = wire.WriteFrame(r.w, wire.FrameMessage, wire.Message{Text: msg, Affected: wireAffected(c)})
+}
+
+// wireAffected converts c for the wire
+func wireAffected(c executor.Change) *wire.Affected {
+	return &wire.Affected{
+		NodesInserted: c.NodesInserted,
+		NodesUpdated:  c.NodesUpdated,
+		NodesDeleted:  c.NodesDeleted,
+		EdgesInserted: c.EdgesInserted,
+		EdgesUpdated:  c.EdgesUpdated,
+		EdgesDeleted:  c.EdgesDeleted,
+		IDs:           c.IDs,
+		UpdatedIDs:    c.UpdatedIDs,
+		DeletedIDs:    c.DeletedIDs,
+	}
+}
+
+func (r *frameResponder) ResultSet() {
+	_ = wire.WriteFrame(r.w, wire.FrameResultSet, wire.ResultSet{})
+}
+
+func (r *frameResponder) Row(nodeType, id string, props map[string]interface{}) {
+	if r.rows == nil {
+		r.rows = wire.NewRowWriter(r.w)
+	}
+	_ = r.rows.WriteRow(nodeType, id, props)
+}
+
+func (r *frameResponder) parseErrors(errs []parser.ParseError) {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	_ = wire.WriteFrame(r.w, wire.FrameError, wire.Error{Messages: msgs})
+}
+
+func (r *frameResponder) failed(stmt int, err error) {
+	_ = wire.WriteFrame(r.w, wire.FrameError, wire.Error{Statement: stmt, Messages: []string{err.Error()}})
+}
+
+func (r *frameResponder) done(n int) {
+	_ = wire.WriteFrame(r.w, wire.FrameDone, wire.Done{Statements: n})
+}
+
+func (r *frameResponder) fetched(n int, more bool) {
+	_ = wire.WriteFrame(r.w, wire.FrameDone, wire.Done{More: more})
+}
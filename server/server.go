@@ -2,41 +2,121 @@ package server
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"strings"
 	"sync"
 
 	"grapho/catalog"
+	"grapho/cypher"
+	"grapho/executor"
 	"grapho/parser"
+	"grapho/storage"
+	"grapho/wire"
 )
 
 // Server represents a TCP server that executes DDL commands
 type Server struct {
-	addr     string
-	registry *catalog.Registry
-	listener net.Listener
-	mu       sync.RWMutex
-	clients  map[net.Conn]bool
-	commitLog *CommitLog
+	addr      string
+	exec      *executor.Executor
+	listener  net.Listener
+	mu        sync.RWMutex
+	clients   map[net.Conn]bool
+	commitLog *storage.CommitLog
+	store     executor.GraphStore
 	replaying bool
+
+	// execMu serializes the executor, which connections share: statements
+	// and their commit log appends, opening cursors, and reads of the graph
+	// or the plan cache, which take a snapshot under it where they can
+	execMu sync.Mutex
+
+	// ctx is cancelled by Stop, aborting replay and running queries
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// ready is closed once the commit log has been replayed
+	ready        chan struct{}
+	boltListener net.Listener
+	httpServers  []*http.Server // the HTTP API and the Gremlin endpoint
+	expiry       expiryState
+	vacuum       vacuumState
+	snapshots    snapshotState
+	quota        *storage.Quota // see SetQuota
 }
 
 // NewServer creates a new server instance
 func NewServer(addr string, registry *catalog.Registry) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Server{
-		addr:     addr,
-		registry: registry,
-		clients:  make(map[net.Conn]bool),
+		addr:    addr,
+		exec:    executor.New(registry),
+		clients: make(map[net.Conn]bool),
+		ctx:     ctx,
+		cancel:  cancel,
+		ready:   make(chan struct{}),
 	}
 }
 
 // AttachCommitLog associates a commit log with the server
-func (s *Server) AttachCommitLog(cl *CommitLog) {
+func (s *Server) AttachCommitLog(cl *storage.CommitLog) {
 	s.commitLog = cl
 }
 
+// AttachGraphStore has the server keep its graph in st, such as a data file,
+// loading it on Start before the commit log entries it does not hold are
+// replayed; see executor.GraphStore. Stop closes it.
+func (s *Server) AttachGraphStore(st executor.GraphStore) {
+	s.store = st
+}
+
+// AddHook registers an execution hook; call it before Start
+func (s *Server) AddHook(h executor.Hook) {
+	s.exec.AddHook(h)
+}
+
+// SetPartitions sets the number of partitions each node type is split into;
+// call it before Start
+func (s *Server) SetPartitions(n int) error {
+	return s.exec.SetPartitions(n)
+}
+
+// SetQuota bounds the size of the data directory; writes are refused while
+// it is at q's limit. Call it before Start.
+func (s *Server) SetQuota(q *storage.Quota) {
+	s.quota = q
+}
+
+// SetLenient makes INSERT, UPDATE and MERGE store fields the catalog does
+// not declare rather than reject them; see executor.Executor.SetLenient
+func (s *Server) SetLenient(on bool) {
+	s.exec.SetLenient(on)
+}
+
+// SetTimeLayouts adds spellings of date, time and datetime values; call it
+// before Start, which replays the commit log. See
+// executor.Executor.SetTimeLayouts.
+func (s *Server) SetTimeLayouts(layouts []string) {
+	s.exec.SetTimeLayouts(layouts)
+}
+
+// SetMaxBlobSize sets the most bytes a blob value may hold; see
+// executor.Executor.SetMaxBlobSize
+func (s *Server) SetMaxBlobSize(n int) {
+	s.exec.SetMaxBlobSize(n)
+}
+
+// SetCacheSize bounds the node cache; see executor.Executor.SetCacheSize
+func (s *Server) SetCacheSize(n int) error {
+	s.execMu.Lock()
+	defer s.execMu.Unlock()
+	return s.exec.SetCacheSize(n)
+}
+
 // Start begins listening for connections
 func (s *Server) Start() error {
 	listener, err := net.Listen("tcp", s.addr)
@@ -44,32 +124,36 @@ func (s *Server) Start() error {
 		return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
 	}
 
-	// On startup, replay commit log if present
+	// On startup, load the graph store and replay the commit log on top
+	if s.store != nil {
+		if err := s.exec.LoadData(s.ctx, s.store); err != nil {
+			return fmt.Errorf("load graph store failed: %w", err)
+		}
+		if s.commitLog != nil && s.store.Entries() < s.commitLog.Dropped() {
+			return fmt.Errorf("commit log was cut after entry %d, but the graph store holds only %d", s.commitLog.Dropped(), s.store.Entries())
+		}
+	}
 	if s.commitLog != nil {
 		s.replaying = true
-		if err := s.commitLog.Replay(func(line string) error {
-			// Apply without emitting to any client and without re-appending
-			p := parser.NewParser(line)
-			stmts, errs := p.ParseScript()
-			if len(errs) > 0 {
-				// stop replay on parse error to avoid corrupting state
-				return fmt.Errorf("replay parse error: %v", errs)
-			}
-			for _, st := range stmts {
-				if err := s.executeStatement(nil, st); err != nil {
-					return fmt.Errorf("replay exec error: %w", err)
-				}
+		if err := s.commitLog.Replay(s.ctx, func(line string) error {
+			if s.store != nil && s.commitLog.Entries() <= s.store.Entries() {
+				return nil // the graph store holds its changes
 			}
-			return nil
+			// Apply without emitting to any client and without re-appending
+			return s.exec.Replay(s.ctx, line)
 		}); err != nil {
 			return fmt.Errorf("replay commit log failed: %w", err)
 		}
 		s.replaying = false
+		if err := s.exec.CommitData(s.commitLog.Entries()); err != nil {
+			return fmt.Errorf("write graph store failed: %w", err)
+		}
 	}
+	close(s.ready)
 
 	s.listener = listener
 	fmt.Printf("Server listening on %s\n", s.addr)
-	
+
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
@@ -82,28 +166,42 @@ func (s *Server) Start() error {
 				continue
 			}
 		}
-		
+
 		s.mu.Lock()
 		s.clients[conn] = true
 		s.mu.Unlock()
-		
+
 		go s.handleConnection(conn)
 	}
 }
 
 // Stop shuts down the server
 func (s *Server) Stop() error {
+	s.cancel()
 	if s.listener != nil {
 		s.listener.Close()
 	}
-	
+	s.mu.Lock()
+	if s.boltListener != nil {
+		s.boltListener.Close()
+	}
+	for _, hs := range s.httpServers {
+		hs.Close()
+	}
+	s.mu.Unlock()
+
 	s.mu.Lock()
 	for conn := range s.clients {
 		conn.Close()
 	}
 	s.clients = make(map[net.Conn]bool)
 	s.mu.Unlock()
-	
+
+	if s.store != nil {
+		s.execMu.Lock()
+		defer s.execMu.Unlock()
+		return s.store.Close()
+	}
 	return nil
 }
 
@@ -115,689 +213,262 @@ func (s *Server) handleConnection(conn net.Conn) {
 		s.mu.Unlock()
 		conn.Close()
 	}()
-	
+
 	fmt.Printf("Client connected: %s\n", conn.RemoteAddr())
-	
+
 	// Send welcome message
 	fmt.Fprintf(conn, "Welcome to Grapho DDL Server\n")
 	fmt.Fprintf(conn, "Enter DDL commands (CREATE, ALTER, DROP) followed by semicolon\n")
 	fmt.Fprintf(conn, "Type 'quit' to exit\n\n")
-	
+
+	// Cancelled when the client goes away or the server stops
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+
 	scanner := bufio.NewScanner(conn)
 	var commandBuffer strings.Builder
-	
+	var out cursorResponder = &textResponder{w: conn}
+	lang := wire.LanguageGrapho
+	var cur *executor.Cursor
+	defer func() {
+		if cur != nil {
+			cur.Close()
+		}
+	}()
+	cursor := false // the command being read opens a cursor
+
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
-		
+
 		if line == "quit" || line == "exit" {
 			fmt.Fprintf(conn, "Goodbye!\n")
 			return
 		}
-		
+
 		if line == "" {
 			continue
 		}
-		
+
+		// Session commands are only recognised between statements
+		if commandBuffer.Len() == 0 && line == wire.SwitchCommand {
+			out = &frameResponder{w: conn}
+			out.Message("protocol: framed")
+			continue
+		}
+		if commandBuffer.Len() == 0 && strings.HasPrefix(line, wire.LanguageCommand+" ") {
+			switch l := strings.TrimSpace(strings.TrimPrefix(line, wire.LanguageCommand)); l {
+			case wire.LanguageGrapho, wire.LanguageCypher:
+				lang = l
+				out.Message("language: %s", lang)
+			default:
+				out.failed(0, fmt.Errorf("unknown language '%s' (want %s or %s)", l, wire.LanguageGrapho, wire.LanguageCypher))
+			}
+			continue
+		}
+		if commandBuffer.Len() == 0 && (line == wire.FetchCommand || strings.HasPrefix(line, wire.FetchCommand+" ")) {
+			cur = fetch(out, cur, strings.TrimSpace(strings.TrimPrefix(line, wire.FetchCommand)))
+			continue
+		}
+		if commandBuffer.Len() == 0 && line == wire.CloseCommand {
+			if cur != nil {
+				cur.Close()
+				cur = nil
+			}
+			out.fetched(0, false)
+			continue
+		}
+		if commandBuffer.Len() == 0 && strings.HasPrefix(line, wire.CursorCommand+" ") {
+			cursor = true
+			line = strings.TrimSpace(strings.TrimPrefix(line, wire.CursorCommand))
+		}
+
 		// Add line to command buffer
 		commandBuffer.WriteString(line)
 		commandBuffer.WriteString(" ")
-		
+
 		// Check if command is complete (ends with semicolon)
 		if strings.HasSuffix(line, ";") {
 			command := commandBuffer.String()
 			commandBuffer.Reset()
-			
-			s.executeCommand(conn, command)
+
+			if cursor {
+				cursor = false
+				if cur != nil {
+					cur.Close()
+				}
+				cur = s.openCursor(ctx, out, lang, command)
+			} else if lang == wire.LanguageCypher {
+				s.executeCypher(ctx, out, command)
+			} else {
+				s.executeCommand(ctx, out, command)
+			}
 		}
 	}
-	
+
 	if err := scanner.Err(); err != nil && err != io.EOF {
 		fmt.Printf("Error reading from client %s: %v\n", conn.RemoteAddr(), err)
 	}
-	
+
 	fmt.Printf("Client disconnected: %s\n", conn.RemoteAddr())
 }
 
 // executeCommand parses and executes a DDL command
-func (s *Server) executeCommand(conn net.Conn, command string) {
+func (s *Server) executeCommand(ctx context.Context, out responder, command string) {
 	command = strings.TrimSpace(command)
 	if command == "" {
 		return
 	}
-	
+
 	fmt.Printf("Executing command: %s\n", command)
-	
-	// Parse the command
-	p := parser.NewParser(command)
-	stmts, errs := p.ParseScript()
-	
-	if len(errs) > 0 {
-		fmt.Fprintf(conn, "Parse errors:\n")
-		for _, err := range errs {
-			fmt.Fprintf(conn, "  %s\n", err.Error())
+
+	s.execMu.Lock()
+	defer s.execMu.Unlock()
+
+	// Parse the command, or reuse the statements of one with the same shape
+	stmts, release, err := s.exec.Prepare(command)
+	if err != nil {
+		var perrs parser.ParseErrors
+		if errors.As(err, &perrs) {
+			out.parseErrors(perrs)
+		} else {
+			out.failed(0, err)
 		}
-		fmt.Fprintf(conn, "\n")
 		return
 	}
-	
-	if len(stmts) == 0 {
-		fmt.Fprintf(conn, "No statements to execute\n\n")
-		return
-	}
-	
-    // Execute each statement and track whether any mutates state
-    mutated := false
-    for i, stmt := range stmts {
-        if err := s.executeStatement(conn, stmt); err != nil {
-            fmt.Fprintf(conn, "Error executing statement %d: %s\n", i+1, err.Error())
-            return
-        }
-        switch stmt.(type) {
-        case *parser.CreateNodeStmt, *parser.CreateEdgeStmt,
-            *parser.AlterNodeStmt, *parser.AlterEdgeStmt,
-            *parser.DropNodeStmt, *parser.DropEdgeStmt,
-            *parser.InsertNodeStmt, *parser.InsertEdgeStmt,
-            *parser.UpdateNodeStmt, *parser.UpdateEdgeStmt,
-            *parser.DeleteNodeStmt, *parser.DeleteEdgeStmt:
-            mutated = true
-        }
-    }
-    
-    fmt.Fprintf(conn, "OK - %d statement(s) executed successfully\n\n", len(stmts))
-
-    // Append the original command to the commit log only if there was a mutation
-    if mutated && s.commitLog != nil && !s.replaying {
-        toAppend := strings.TrimSpace(command)
-        if !strings.HasSuffix(toAppend, ";") {
-            toAppend += ";"
-        }
-        _ = s.commitLog.Append(toAppend)
-    }
-}
+	defer release()
 
-// executeStatement executes a single parsed statement
-func (s *Server) executeStatement(conn net.Conn, stmt parser.Stmt) error {
-	switch st := stmt.(type) {
-	case *parser.CreateNodeStmt:
-		return s.executeCreateNode(st)
-	case *parser.CreateEdgeStmt:
-		return s.executeCreateEdge(st)
-	case *parser.AlterNodeStmt:
-		return s.executeAlterNode(st)
-	case *parser.AlterEdgeStmt:
-		return s.executeAlterEdge(st)
-	case *parser.DropNodeStmt:
-		return s.executeDropNode(st)
-	case *parser.DropEdgeStmt:
-		return s.executeDropEdge(st)
-	case *parser.InsertNodeStmt:
-		return s.executeInsertNode(conn, st)
-	case *parser.InsertEdgeStmt:
-		return s.executeInsertEdge(conn, st)
-	case *parser.UpdateNodeStmt:
-		return s.executeUpdateNode(conn, st)
-	case *parser.UpdateEdgeStmt:
-		return s.executeUpdateEdge(conn, st)
-	case *parser.DeleteNodeStmt:
-		return s.executeDeleteNode(conn, st)
-	case *parser.DeleteEdgeStmt:
-		return s.executeDeleteEdge(conn, st)
-	case *parser.MatchStmt:
-		return s.executeMatch(conn, st)
-	default:
-		return fmt.Errorf("unsupported statement type: %T", stmt)
-	}
+	s.executeStatements(ctx, out, command, stmts)
 }
 
-// executeCreateNode executes a CREATE NODE statement
-func (s *Server) executeCreateNode(stmt *parser.CreateNodeStmt) error {
-	// Convert parser types to catalog types
-	fields := make([]catalog.FieldPayload, len(stmt.Fields))
-	
-	for i, field := range stmt.Fields {
-		fields[i] = catalog.FieldPayload{
-			Name:       field.Name,
-			Type:       convertTypeSpec(field.Type),
-			PrimaryKey: field.PrimaryKey,
-			Unique:     field.Unique,
-			NotNull:    field.NotNull,
-		}
-		
-		if field.Default != nil {
-			defaultVal := field.Default.Text
-			fields[i].DefaultRaw = &defaultVal
-		}
-	}
-	
-	payload := catalog.CreateNodePayload{
-		Name:   stmt.Name,
-		Fields: fields,
+// executeCypher translates a Cypher command and executes the result. The
+// translated statements, not the Cypher text, go to the commit log.
+func (s *Server) executeCypher(ctx context.Context, out responder, command string) {
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return
 	}
-	
-	_, err := s.registry.Apply(catalog.DDLEvent{
-		Op:   catalog.OpCreateNode,
-		Stmt: payload,
-	})
-	return err
-}
 
-// executeCreateEdge executes a CREATE EDGE statement
-func (s *Server) executeCreateEdge(stmt *parser.CreateEdgeStmt) error {
-	// Convert parser types to catalog types
-	props := make([]catalog.FieldPayload, len(stmt.Props))
-	
-	for i, prop := range stmt.Props {
-		props[i] = catalog.FieldPayload{
-			Name:    prop.Name,
-			Type:    convertTypeSpec(prop.Type),
-			Unique:  prop.Unique,
-			NotNull: prop.NotNull,
-		}
-		
-		if prop.Default != nil {
-			defaultVal := prop.Default.Text
-			props[i].DefaultRaw = &defaultVal
-		}
-	}
-	
-	payload := catalog.CreateEdgePayload{
-		Name: stmt.Name,
-		From: catalog.EdgeEndpoint{
-			Label: stmt.From.Label,
-			Card:  convertCardinality(stmt.From.Card),
-		},
-		To: catalog.EdgeEndpoint{
-			Label: stmt.To.Label,
-			Card:  convertCardinality(stmt.To.Card),
-		},
-		Props: props,
-	}
-	
-	_, err := s.registry.Apply(catalog.DDLEvent{
-		Op:   catalog.OpCreateEdge,
-		Stmt: payload,
-	})
-	return err
-}
+	fmt.Printf("Executing cypher: %s\n", command)
 
-// executeAlterNode executes an ALTER NODE statement
-func (s *Server) executeAlterNode(stmt *parser.AlterNodeStmt) error {
-	var action catalog.NodeAlterAction
-	
-	switch stmt.Action {
-	case parser.AlterAddField:
-		action.Type = "ADD_FIELD"
-		action.Field = &catalog.FieldPayload{
-			Name:    stmt.Field.Name,
-			Type:    convertTypeSpec(stmt.Field.Type),
-			Unique:  stmt.Field.Unique,
-			NotNull: stmt.Field.NotNull,
-		}
-		if stmt.Field.Default != nil {
-			defaultVal := stmt.Field.Default.Text
-			action.Field.DefaultRaw = &defaultVal
-		}
-	case parser.AlterDropField:
-		action.Type = "DROP_FIELD"
-		action.FieldName = stmt.FieldName
-	case parser.AlterModifyField:
-		action.Type = "MODIFY_FIELD"
-		action.Field = &catalog.FieldPayload{
-			Name:    stmt.Field.Name,
-			Type:    convertTypeSpec(stmt.Field.Type),
-			Unique:  stmt.Field.Unique,
-			NotNull: stmt.Field.NotNull,
-		}
-		if stmt.Field.Default != nil {
-			defaultVal := stmt.Field.Default.Text
-			action.Field.DefaultRaw = &defaultVal
+	stmts, err := cypher.Translate(command)
+	if err != nil {
+		var perrs parser.ParseErrors
+		if errors.As(err, &perrs) {
+			out.parseErrors(perrs)
+		} else {
+			out.failed(0, err)
 		}
-	case parser.AlterSetPrimaryKey:
-		action.Type = "SET_PRIMARY_KEY"
-		action.FieldName = strings.Join(stmt.PkFields, ",")
-	default:
-		return fmt.Errorf("unsupported alter node action: %v", stmt.Action)
-	}
-	
-	payload := catalog.AlterNodePayload{
-		Name:    stmt.Name,
-		Actions: []catalog.NodeAlterAction{action},
+		return
 	}
-	
-	_, err := s.registry.Apply(catalog.DDLEvent{
-		Op:   catalog.OpAlterNode,
-		Stmt: payload,
-	})
-	return err
+	s.executeTranslated(ctx, out, stmts)
 }
 
-// executeAlterEdge executes an ALTER EDGE statement
-func (s *Server) executeAlterEdge(stmt *parser.AlterEdgeStmt) error {
-	var action catalog.EdgeAlterAction
-	
-	switch stmt.Action {
-	case parser.AlterAddProp:
-		action.Type = "ADD_PROP"
-		action.Prop = &catalog.FieldPayload{
-			Name:    stmt.Prop.Name,
-			Type:    convertTypeSpec(stmt.Prop.Type),
-			Unique:  stmt.Prop.Unique,
-			NotNull: stmt.Prop.NotNull,
-		}
-		if stmt.Prop.Default != nil {
-			defaultVal := stmt.Prop.Default.Text
-			action.Prop.DefaultRaw = &defaultVal
-		}
-	case parser.AlterDropProp:
-		action.Type = "DROP_PROP"
-		action.PropName = stmt.PropName
-	case parser.AlterModifyProp:
-		action.Type = "MODIFY_PROP"
-		action.Prop = &catalog.FieldPayload{
-			Name:    stmt.Prop.Name,
-			Type:    convertTypeSpec(stmt.Prop.Type),
-			Unique:  stmt.Prop.Unique,
-			NotNull: stmt.Prop.NotNull,
-		}
-		if stmt.Prop.Default != nil {
-			defaultVal := stmt.Prop.Default.Text
-			action.Prop.DefaultRaw = &defaultVal
-		}
-	case parser.AlterSetEndpoints:
-		// For SET FROM/TO, we need separate actions
-		// This is a simplification - in reality we might need to handle both endpoints
-		if stmt.From != nil {
-			action.Type = "CHANGE_ENDPOINT"
-			action.Endpoint = "FROM"
-			action.NewEndpoint = &catalog.EdgeEndpoint{
-				Label: stmt.From.Label,
-				Card:  convertCardinality(stmt.From.Card),
-			}
-		} else if stmt.To != nil {
-			action.Type = "CHANGE_ENDPOINT"
-			action.Endpoint = "TO"
-			action.NewEndpoint = &catalog.EdgeEndpoint{
-				Label: stmt.To.Label,
-				Card:  convertCardinality(stmt.To.Card),
-			}
+// executeTranslated executes statements built by a translator, logging their
+// grapho form
+func (s *Server) executeTranslated(ctx context.Context, out responder, stmts []parser.Stmt) {
+	texts := make([]string, len(stmts))
+	for i, st := range stmts {
+		var err error
+		if texts[i], err = parser.Format(st); err != nil {
+			out.failed(i+1, err)
+			return
 		}
-	default:
-		return fmt.Errorf("unsupported alter edge action: %v", stmt.Action)
-	}
-	
-	payload := catalog.AlterEdgePayload{
-		Name:    stmt.Name,
-		Actions: []catalog.EdgeAlterAction{action},
-	}
-	
-	_, err := s.registry.Apply(catalog.DDLEvent{
-		Op:   catalog.OpAlterEdge,
-		Stmt: payload,
-	})
-	return err
-}
-
-// executeDropNode executes a DROP NODE statement
-func (s *Server) executeDropNode(stmt *parser.DropNodeStmt) error {
-	payload := catalog.DropNodePayload{
-		Name: stmt.Name,
 	}
-	
-	_, err := s.registry.Apply(catalog.DDLEvent{
-		Op:   catalog.OpDropNode,
-		Stmt: payload,
-	})
-	return err
+	s.execMu.Lock()
+	defer s.execMu.Unlock()
+	s.executeStatements(ctx, out, strings.Join(texts, " "), stmts)
 }
 
-// executeDropEdge executes a DROP EDGE statement
-func (s *Server) executeDropEdge(stmt *parser.DropEdgeStmt) error {
-	payload := catalog.DropEdgePayload{
-		Name: stmt.Name,
-	}
-	
-	_, err := s.registry.Apply(catalog.DDLEvent{
-		Op:   catalog.OpDropEdge,
-		Stmt: payload,
-	})
-	return err
+// snapshot returns a read-only view of the graph as it is between statements
+func (s *Server) snapshot() *executor.Executor {
+	s.execMu.Lock()
+	defer s.execMu.Unlock()
+	return s.exec.Snapshot()
 }
 
-// Helper functions to convert between parser and catalog types
-
-func convertTypeSpec(t parser.TypeSpec) catalog.TypeSpec {
-	spec := catalog.TypeSpec{
-		Base: convertBaseType(t.Base),
-	}
-	
-	if t.Elem != nil {
-		elem := convertTypeSpec(*t.Elem)
-		spec.Elem = &elem
+// executeStatements runs the parsed statements of command, appending command to
+// the commit log if any of them mutated state. s.execMu must be held, so that
+// the log keeps commands in the order they ran; it is let go while a sync
+// commit waits for its sync, so that commands arriving meanwhile share it.
+// When a statement fails, those before it stay applied, so they are logged on
+// their own before the failure is reported.
+func (s *Server) executeStatements(ctx context.Context, out responder, command string, stmts []parser.Stmt) {
+	if len(stmts) == 0 {
+		out.done(0)
+		return
 	}
-	
-	if len(t.EnumVals) > 0 {
-		spec.EnumVals = make([]string, len(t.EnumVals))
-		copy(spec.EnumVals, t.EnumVals)
+	if b, ok := storage.LoneBackup(stmts); ok {
+		s.executeBackup(ctx, out, b)
+		return
 	}
-	
-	return spec
-}
-
-func convertBaseType(bt parser.BaseType) catalog.BaseType {
-	switch bt {
-	case parser.BaseString:
-		return catalog.BaseString
-	case parser.BaseText:
-		return catalog.BaseText
-	case parser.BaseInt:
-		return catalog.BaseInt
-	case parser.BaseFloat:
-		return catalog.BaseFloat
-	case parser.BaseBool:
-		return catalog.BaseBool
-	case parser.BaseUUID:
-		return catalog.BaseUUID
-	case parser.BaseDate:
-		return catalog.BaseDate
-	case parser.BaseTime:
-		return catalog.BaseTime
-	case parser.BaseDateTime:
-		return catalog.BaseDateTime
-	case parser.BaseJSON:
-		return catalog.BaseJSON
-	case parser.BaseBlob:
-		return catalog.BaseBlob
-	default:
-		return catalog.BaseString // fallback
+	if s.quota != nil {
+		if err := s.quota.Check(stmts); err != nil {
+			out.failed(0, err)
+			return
+		}
 	}
-}
 
-func convertCardinality(c parser.Cardinality) catalog.Cardinality {
-	switch c {
-	case parser.CardOne:
-		return catalog.One
-	case parser.CardMany:
-		return catalog.Many
-	default:
-		return catalog.One // fallback
+	// Execute each statement and track whether any mutates state
+	var (
+		mutated  bool
+		ran      = stmts
+		failedAt int
+		failure  error
+	)
+	for i, stmt := range stmts {
+		if err := s.exec.Execute(ctx, out, stmt); err != nil {
+			ran, failedAt, failure = stmts[:i], i+1, err
+			break
+		}
+		if executor.Mutates(stmt) {
+			mutated = true
+		}
 	}
-}
 
-/* ---------------------- DML execution methods ---------------------- */
-
-// Simple in-memory data store for demonstration
-// In a real implementation, this would be a proper graph database
-type GraphData struct {
-	Nodes  map[string]map[string]interface{} // nodeType -> nodeID -> properties
-	Edges  map[string][]EdgeInstance         // edgeType -> list of edge instances
-	NextID int64                             // Simple ID generator
-}
-
-type EdgeInstance struct {
-	ID         string
-	FromNodeID string
-	ToNodeID   string
-	Properties map[string]interface{}
-}
-
-var graphData = &GraphData{
-	Nodes:  make(map[string]map[string]interface{}),
-	Edges:  make(map[string][]EdgeInstance),
-	NextID: 1,
-}
-
-// executeInsertNode executes an INSERT NODE statement
-func (s *Server) executeInsertNode(conn net.Conn, stmt *parser.InsertNodeStmt) error {
-    // Validate node type exists in catalog
-    cat := s.registry.Current()
-    nodeType, exists := cat.Nodes[stmt.NodeType]
-    if !exists {
-        return fmt.Errorf("node type '%s' does not exist", stmt.NodeType)
-    }
-    // Generate new node ID
-    nodeID := fmt.Sprintf("%d", graphData.NextID)
-    graphData.NextID++
-    // Initialize storage for this node type
-    if graphData.Nodes[stmt.NodeType] == nil {
-        graphData.Nodes[stmt.NodeType] = make(map[string]interface{})
-    }
-    // Build properties
-    properties := make(map[string]interface{})
-    for _, prop := range stmt.Properties {
-        switch prop.Value.Kind {
-        case parser.LitString:
-            properties[prop.Name] = prop.Value.Text
-        case parser.LitNumber:
-            properties[prop.Name] = prop.Value.Text
-        case parser.LitBool:
-            properties[prop.Name] = prop.Value.Text == "true"
-        case parser.LitNull:
-            properties[prop.Name] = nil
-        }
-    }
-    // Simple required field check
-    for fieldName, fieldSpec := range nodeType.Fields {
-        if fieldSpec.NotNull {
-            if _, ok := properties[fieldName]; !ok {
-                return fmt.Errorf("required field '%s' is missing", fieldName)
-            }
-        }
-    }
-    // Add synthetic ID
-    properties["_id"] = nodeID
-    // Store the node
-    graphData.Nodes[stmt.NodeType][nodeID] = properties
-    if conn != nil {
-        fmt.Fprintf(conn, "Node inserted with ID: %s\n", nodeID)
-    }
-    return nil
-}
-
-// executeInsertEdge executes an INSERT EDGE statement
-func (s *Server) executeInsertEdge(conn net.Conn, stmt *parser.InsertEdgeStmt) error {
-    // Validate edge type exists
-    cat := s.registry.Current()
-    edgeType, exists := cat.Edges[stmt.EdgeType]
-    if !exists {
-        return fmt.Errorf("edge type '%s' does not exist", stmt.EdgeType)
-    }
-    // Resolve endpoints
-    fromNodeID, err := s.findNodeID(stmt.FromNode)
-    if err != nil { return fmt.Errorf("FROM node not found: %v", err) }
-    toNodeID, err := s.findNodeID(stmt.ToNode)
-    if err != nil { return fmt.Errorf("TO node not found: %v", err) }
-    if stmt.FromNode.NodeType != edgeType.From.Label {
-        return fmt.Errorf("FROM node type '%s' does not match edge FROM type '%s'", stmt.FromNode.NodeType, edgeType.From.Label)
-    }
-    if stmt.ToNode.NodeType != edgeType.To.Label {
-        return fmt.Errorf("TO node type '%s' does not match edge TO type '%s'", stmt.ToNode.NodeType, edgeType.To.Label)
-    }
-    // Generate ID
-    edgeID := fmt.Sprintf("edge_%d", graphData.NextID)
-    graphData.NextID++
-    // Properties
-    properties := make(map[string]interface{})
-    for _, prop := range stmt.Properties {
-        switch prop.Value.Kind {
-        case parser.LitString:
-            properties[prop.Name] = prop.Value.Text
-        case parser.LitNumber:
-            properties[prop.Name] = prop.Value.Text
-        case parser.LitBool:
-            properties[prop.Name] = prop.Value.Text == "true"
-        case parser.LitNull:
-            properties[prop.Name] = nil
-        }
-    }
-    edge := EdgeInstance{ ID: edgeID, FromNodeID: fromNodeID, ToNodeID: toNodeID, Properties: properties }
-    graphData.Edges[stmt.EdgeType] = append(graphData.Edges[stmt.EdgeType], edge)
-    if conn != nil {
-        fmt.Fprintf(conn, "Edge inserted with ID: %s\n", edgeID)
-    }
-    return nil
-}
-
-// executeUpdateNode executes an UPDATE NODE statement
-func (s *Server) executeUpdateNode(conn net.Conn, stmt *parser.UpdateNodeStmt) error {
-    nodes := graphData.Nodes[stmt.NodeType]
-    if nodes == nil { return fmt.Errorf("no nodes of type '%s' found", stmt.NodeType) }
-    updated := 0
-    for _, nodeProps := range nodes {
-        if s.matchesConditions(nodeProps, stmt.Where) {
-            for _, setProp := range stmt.Set {
-                switch setProp.Value.Kind {
-                case parser.LitString:
-                    nodeProps.(map[string]interface{})[setProp.Name] = setProp.Value.Text
-                case parser.LitNumber:
-                    nodeProps.(map[string]interface{})[setProp.Name] = setProp.Value.Text
-                case parser.LitBool:
-                    nodeProps.(map[string]interface{})[setProp.Name] = setProp.Value.Text == "true"
-                case parser.LitNull:
-                    nodeProps.(map[string]interface{})[setProp.Name] = nil
-                }
-            }
-            updated++
-        }
-    }
-    if conn != nil { fmt.Fprintf(conn, "Updated %d node(s)\n", updated) }
-    return nil
-}
-
-// executeUpdateEdge executes an UPDATE EDGE statement
-func (s *Server) executeUpdateEdge(conn net.Conn, stmt *parser.UpdateEdgeStmt) error {
-    edges := graphData.Edges[stmt.EdgeType]
-    updated := 0
-    for i := range edges {
-        if s.matchesConditions(edges[i].Properties, stmt.Where) {
-            for _, setProp := range stmt.Set {
-                switch setProp.Value.Kind {
-                case parser.LitString:
-                    edges[i].Properties[setProp.Name] = setProp.Value.Text
-                case parser.LitNumber:
-                    edges[i].Properties[setProp.Name] = setProp.Value.Text
-                case parser.LitBool:
-                    edges[i].Properties[setProp.Name] = setProp.Value.Text == "true"
-                case parser.LitNull:
-                    edges[i].Properties[setProp.Name] = nil
-                }
-            }
-            updated++
-        }
-    }
-    if conn != nil { fmt.Fprintf(conn, "Updated %d edge(s)\n", updated) }
-    return nil
-}
-
-// executeDeleteNode executes a DELETE NODE statement
-func (s *Server) executeDeleteNode(conn net.Conn, stmt *parser.DeleteNodeStmt) error {
-    nodes := graphData.Nodes[stmt.NodeType]
-    if nodes == nil { return fmt.Errorf("no nodes of type '%s' found", stmt.NodeType) }
-    deleted := 0
-    for nodeID, nodeProps := range nodes {
-        if s.matchesConditions(nodeProps, stmt.Where) {
-            delete(nodes, nodeID)
-            deleted++
-        }
-    }
-    if conn != nil { fmt.Fprintf(conn, "Deleted %d node(s)\n", deleted) }
-    return nil
-}
-
-// executeDeleteEdge executes a DELETE EDGE statement
-func (s *Server) executeDeleteEdge(conn net.Conn, stmt *parser.DeleteEdgeStmt) error {
-    edges := graphData.Edges[stmt.EdgeType]
-    var remaining []EdgeInstance
-    deleted := 0
-    for _, edge := range edges {
-        if s.matchesConditions(edge.Properties, stmt.Where) {
-            deleted++
-        } else {
-            remaining = append(remaining, edge)
-        }
-    }
-    graphData.Edges[stmt.EdgeType] = remaining
-    if conn != nil { fmt.Fprintf(conn, "Deleted %d edge(s)\n", deleted) }
-    return nil
-}
-
-// executeMatch executes a MATCH statement for querying
-func (s *Server) executeMatch(conn net.Conn, stmt *parser.MatchStmt) error {
-    if conn != nil { fmt.Fprintf(conn, "MATCH Results:\n") }
-    for _, element := range stmt.Pattern {
-        if !element.IsEdge {
-            nodes := graphData.Nodes[element.Type]
-            if nodes != nil {
-                if conn != nil { fmt.Fprintf(conn, "\nNodes of type '%s':\n", element.Type) }
-                for nodeID, props := range nodes {
-                    if len(stmt.Where) == 0 || s.matchesConditions(props, stmt.Where) {
-                        if conn != nil { fmt.Fprintf(conn, "  ID: %s, Properties: %v\n", nodeID, props) }
-                    }
-                }
-            }
-        }
-    }
-    return nil
-}
-
-/* ---------------------- Helper methods ---------------------- */
-
-// findNodeID finds a node ID based on NodeRef (by direct ID or property match)
-func (s *Server) findNodeID(nodeRef *parser.NodeRef) (string, error) {
-    nodes := graphData.Nodes[nodeRef.NodeType]
-    if nodes == nil {
-        return "", fmt.Errorf("no nodes of type '%s' found", nodeRef.NodeType)
-    }
-    // Direct ID reference
-    if nodeRef.ID != nil {
-        nodeID := nodeRef.ID.Text
-        if _, exists := nodes[nodeID]; exists {
-            return nodeID, nil
-        }
-        return "", fmt.Errorf("node with ID '%s' not found", nodeID)
-    }
-    // Property-based search
-    for nodeID, nodeProps := range nodes {
-        if s.matchesConditions(nodeProps, nodeRef.Properties) {
-            return nodeID, nil
-        }
-    }
-    return "", fmt.Errorf("no matching node found")
-}
-
-// matchesConditions checks if properties match the given conditions
-func (s *Server) matchesConditions(properties interface{}, conditions []parser.Property) bool {
-	if len(conditions) == 0 {
-		return true
-	}
-	
-	props, ok := properties.(map[string]interface{})
-	if !ok {
-		return false
-	}
-	
-	for _, condition := range conditions {
-		propValue, exists := props[condition.Name]
-		if !exists {
-			return false
+	// Append the command, with any keys it generated, to the commit log only
+	// if there was a mutation, before answering, so that a sync commit is
+	// durable once the client hears back
+	if mutated && s.commitLog != nil && !s.replaying {
+		// LogText and LogPrefix both forget the keys, so only one may run
+		var logged string
+		var err error
+		if len(ran) < len(stmts) {
+			logged, err = s.exec.LogPrefix(ran)
+		} else {
+			logged, err = s.exec.LogText(command, stmts)
 		}
-		
-		// Simple equality check
-		var expectedValue interface{}
-		switch condition.Value.Kind {
-		case parser.LitString:
-			expectedValue = condition.Value.Text
-		case parser.LitNumber:
-			expectedValue = condition.Value.Text
-		case parser.LitBool:
-			expectedValue = condition.Value.Text == "true"
-		case parser.LitNull:
-			expectedValue = nil
+		if err != nil {
+			out.failed(0, fmt.Errorf("commit log: %w", err))
+			return
+		}
+		toAppend := strings.TrimSpace(logged)
+		if !strings.HasSuffix(toAppend, ";") {
+			toAppend += ";"
 		}
-		
-		if propValue != expectedValue {
-			return false
+		wait, err := s.commitLog.Enqueue(context.WithoutCancel(ctx), toAppend)
+		if err != nil {
+			out.failed(0, fmt.Errorf("commit log: %w", err))
+			return
 		}
+		if s.quota != nil {
+			s.quota.Grew(len(toAppend))
+		}
+		if err := s.exec.CommitData(s.commitLog.Entries()); err != nil {
+			out.failed(0, fmt.Errorf("graph store: %w", err))
+			return
+		}
+		s.execMu.Unlock()
+		err = wait()
+		s.execMu.Lock()
+		if err != nil {
+			out.failed(0, fmt.Errorf("commit log: %w", err))
+			return
+		}
+	}
+
+	if failure != nil {
+		out.failed(failedAt, failure)
+		return
 	}
-	
-	return true
+	out.done(len(stmts))
 }
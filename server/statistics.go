@@ -0,0 +1,76 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"grapho/executor"
+	"grapho/storage"
+)
+
+// StatsConfig configures StartStats
+type StatsConfig struct {
+	Interval time.Duration // time between collections
+	Sample   int           // nodes of each type sampled; default executor.DefaultStatsSample
+	Path     string        // file the statistics are kept in across restarts; "" keeps them in memory
+}
+
+// StartStats collects planner statistics every cfg.Interval until the server
+// is stopped; see executor.CollectStats. Statistics saved at cfg.Path by an
+// earlier run are loaded first, so the planner has them from the start;
+// without them the first collection runs at once. Each collection replaces
+// the file. SHOW STATS and GET /admin/stats report the latest.
+func (s *Server) StartStats(cfg StatsConfig) error {
+	if cfg.Interval <= 0 {
+		return fmt.Errorf("stats interval must be positive, got %v", cfg.Interval)
+	}
+	select {
+	case <-s.ready:
+	case <-s.ctx.Done():
+		return nil
+	}
+	due := true
+	if cfg.Path != "" {
+		st, err := storage.LoadStats(cfg.Path)
+		if err != nil {
+			return err
+		}
+		if st != nil {
+			s.setStats(st)
+			due = false
+		}
+	}
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if !due {
+			select {
+			case <-ticker.C:
+			case <-s.ctx.Done():
+				return nil
+			}
+		}
+		due = false
+		// on a snapshot, so that statements run meanwhile
+		st, err := s.snapshot().CollectStats(s.ctx, cfg.Sample)
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		s.setStats(st)
+		if cfg.Path != "" {
+			if err := storage.SaveStats(cfg.Path, st); err != nil {
+				fmt.Printf("Saving statistics failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// setStats hands st to the planner between statements
+func (s *Server) setStats(st *executor.Statistics) {
+	s.execMu.Lock()
+	defer s.execMu.Unlock()
+	s.exec.SetStats(st)
+}
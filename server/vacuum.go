@@ -0,0 +1,73 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"grapho/executor"
+)
+
+// VacuumConfig configures StartVacuum
+type VacuumConfig struct {
+	Interval time.Duration // time between vacuums
+	Ratio    float64       // see executor.Executor.Vacuum; default executor.DefaultVacuumRatio
+}
+
+// VacuumStats counts what the background vacuum has reclaimed
+type VacuumStats struct {
+	executor.VacuumStats
+	LastVacuum time.Time `json:"last_vacuum,omitzero"`
+}
+
+// vacuumState is the background vacuum's running count, read by the stats
+// endpoint
+type vacuumState struct {
+	mu    sync.Mutex
+	stats VacuumStats
+}
+
+// StartVacuum reclaims the space of deleted nodes and edges every
+// cfg.Interval until the server is stopped, for each type at least cfg.Ratio
+// of whose nodes or edges were deleted. It holds up statements while it
+// copies a type, as VACUUM does.
+func (s *Server) StartVacuum(cfg VacuumConfig) error {
+	if cfg.Interval <= 0 {
+		return fmt.Errorf("vacuum interval must be positive, got %v", cfg.Interval)
+	}
+	if cfg.Ratio <= 0 {
+		cfg.Ratio = executor.DefaultVacuumRatio
+	}
+	select {
+	case <-s.ready:
+	case <-s.ctx.Done():
+		return nil
+	}
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return nil
+		}
+		s.execMu.Lock()
+		st, err := s.exec.Vacuum("", cfg.Ratio)
+		s.execMu.Unlock()
+		if err != nil {
+			return err
+		}
+		s.vacuum.mu.Lock()
+		s.vacuum.stats.Nodes += st.Nodes
+		s.vacuum.stats.Edges += st.Edges
+		s.vacuum.stats.LastVacuum = time.Now()
+		s.vacuum.mu.Unlock()
+	}
+}
+
+// VacuumStats returns what the background vacuum has reclaimed so far
+func (s *Server) VacuumStats() VacuumStats {
+	s.vacuum.mu.Lock()
+	defer s.vacuum.mu.Unlock()
+	return s.vacuum.stats
+}
@@ -0,0 +1,305 @@
+package grapho
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"grapho/catalog"
+	"grapho/parser"
+)
+
+// SQLMapping describes how ImportSQL turns relational tables into a graph:
+// tables become node types and foreign keys become edge types. It is usually
+// written as JSON; see ReadSQLMapping.
+type SQLMapping struct {
+	Nodes []SQLNodeMapping `json:"nodes"`
+	Edges []SQLEdgeMapping `json:"edges"`
+}
+
+// SQLNodeMapping maps the rows of a table to nodes of one type
+type SQLNodeMapping struct {
+	Table string `json:"table"`
+	// Query replaces SELECT * FROM Table, e.g. to filter rows
+	Query string `json:"query,omitempty"`
+	Type  string `json:"type"`
+	// Key is the column foreign keys refer to; empty means "id"
+	Key string `json:"key,omitempty"`
+	// Columns maps column names to fields; empty means every column named
+	// like a field of Type
+	Columns map[string]string `json:"columns,omitempty"`
+}
+
+// SQLEdgeMapping maps the rows of a table to edges of one type. For a foreign
+// key, Table is the referencing table; for a many-to-many relation, it is the
+// join table.
+type SQLEdgeMapping struct {
+	Table string `json:"table"`
+	Query string `json:"query,omitempty"`
+	Type  string `json:"type"`
+	From  SQLRef `json:"from"`
+	To    SQLRef `json:"to"`
+	// Columns maps column names to edge properties; empty means every column
+	// named like a property of Type
+	Columns map[string]string `json:"columns,omitempty"`
+}
+
+// SQLRef names the column of an edge table that holds the key of a node
+// mapping's table
+type SQLRef struct {
+	Column string `json:"column"`
+	Table  string `json:"table"`
+}
+
+// ReadSQLMapping decodes a JSON mapping and rejects unknown keys
+func ReadSQLMapping(r io.Reader) (SQLMapping, error) {
+	var m SQLMapping
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return m, fmt.Errorf("grapho: sql mapping: %w", err)
+	}
+	return m, nil
+}
+
+// ImportSQL reads the tables of src as m describes and bulk-loads them: every
+// node mapping in order, then every edge mapping. The node and edge types must
+// already exist. Rows that cannot be imported are skipped and reported in the
+// result like ImportCSV, with Line counting rows of their table from 1; rows
+// whose foreign key is NULL produce no edge. The returned error is only set
+// when the import could not run at all, e.g. on a bad mapping or a failed
+// query.
+func (db *DB) ImportSQL(ctx context.Context, src *sql.DB, m SQLMapping) (ImportResult, error) {
+	var res ImportResult
+	keys := make(map[string]map[string]importedNode) // table -> key -> node
+	cat := db.exec.Registry().Current()
+
+	for _, nm := range m.Nodes {
+		nt, ok := cat.Nodes[nm.Type]
+		if !ok {
+			return res, fmt.Errorf("grapho: import: %w", errNodeType(nm.Type))
+		}
+		if _, dup := keys[nm.Table]; dup {
+			return res, fmt.Errorf("grapho: import: table '%s' is mapped twice", nm.Table)
+		}
+		if err := checkColumns(nt.Name, nt.Fields, nm.Columns); err != nil {
+			return res, err
+		}
+		byKey := make(map[string]importedNode)
+		keys[nm.Table] = byKey
+		keyCol := nm.Key
+		if keyCol == "" {
+			keyCol = "id"
+		}
+
+		var (
+			batch  []bulkStmt
+			ids    []*insertedID
+			rowKey []string
+		)
+		flush := func() error {
+			err := db.flushBulk(ctx, &res, batch)
+			for i := range batch {
+				if ids[i].id != "" && rowKey[i] != "" {
+					byKey[rowKey[i]] = importedNode{nodeType: nt.Name, id: ids[i].id}
+				}
+			}
+			batch, ids, rowKey = batch[:0], ids[:0], rowKey[:0]
+			return err
+		}
+		err := scanTable(ctx, src, nm.Table, nm.Query, func(line int, row map[string]any) error {
+			props, err := sqlProps(nt.Fields, nm.Columns, row)
+			if err == nil {
+				props, err = withDefaults(nt.Fields, props)
+			}
+			if err == nil && len(props) == 0 {
+				err = fmt.Errorf("empty row")
+			}
+			if err != nil {
+				res.Errors = append(res.Errors, LineError{Line: line, Err: fmt.Errorf("%s: %w", nm.Table, err)})
+				return nil
+			}
+			out := &insertedID{}
+			batch = append(batch, bulkStmt{line: line, stmt: parser.InsertNode(nt.Name, props...), out: out})
+			ids = append(ids, out)
+			rowKey = append(rowKey, sqlText(row[keyCol], catalog.TypeSpec{}))
+			if len(batch) == bulkBatchSize {
+				return flush()
+			}
+			return nil
+		})
+		if err == nil {
+			err = flush()
+		}
+		if err != nil {
+			return res, err
+		}
+	}
+
+	for _, em := range m.Edges {
+		et, ok := cat.Edges[em.Type]
+		if !ok {
+			return res, fmt.Errorf("grapho: import: edge type '%s' does not exist: %w", em.Type, ErrNotFound)
+		}
+		if err := checkColumns(et.Name, et.Props, em.Columns); err != nil {
+			return res, err
+		}
+		for _, ref := range []SQLRef{em.From, em.To} {
+			if _, ok := keys[ref.Table]; !ok {
+				return res, fmt.Errorf("grapho: import: %s refers to table '%s', which no node mapping reads", em.Type, ref.Table)
+			}
+		}
+
+		var batch []bulkStmt
+		err := scanTable(ctx, src, em.Table, em.Query, func(line int, row map[string]any) error {
+			if row[em.From.Column] == nil || row[em.To.Column] == nil {
+				return nil
+			}
+			stmt, err := sqlEdge(et, em, keys, row)
+			if err != nil {
+				res.Errors = append(res.Errors, LineError{Line: line, Err: fmt.Errorf("%s: %w", em.Table, err)})
+				return nil
+			}
+			batch = append(batch, bulkStmt{line: line, stmt: stmt})
+			if len(batch) == bulkBatchSize {
+				err := db.flushBulk(ctx, &res, batch)
+				batch = batch[:0]
+				return err
+			}
+			return nil
+		})
+		if err == nil {
+			err = db.flushBulk(ctx, &res, batch)
+		}
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// checkColumns fails if a column mapping names a field typ does not have
+func checkColumns(typ string, fields map[string]catalog.FieldSpec, columns map[string]string) error {
+	for _, col := range sortedKeys(columns) {
+		if _, ok := fields[columns[col]]; !ok {
+			return fmt.Errorf("grapho: import: column '%s' maps to '%s', which %s does not have", col, columns[col], typ)
+		}
+	}
+	return nil
+}
+
+// scanTable runs query, or SELECT * FROM table, and calls fn with each row by
+// column name. NULLs are nil.
+func scanTable(ctx context.Context, src *sql.DB, table, query string, fn func(line int, row map[string]any) error) error {
+	if query == "" {
+		query = "SELECT * FROM " + table
+	}
+	rows, err := src.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("grapho: import: %s: %w", table, err)
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("grapho: import: %s: %w", table, err)
+	}
+
+	values := make([]any, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for line := 1; rows.Next(); line++ {
+		if err := rows.Scan(ptrs...); err != nil {
+			return fmt.Errorf("grapho: import: %s: %w", table, err)
+		}
+		row := make(map[string]any, len(cols))
+		for i, col := range cols {
+			row[col] = values[i]
+		}
+		if err := fn(line, row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("grapho: import: %s: %w", table, err)
+	}
+	return nil
+}
+
+// sqlProps converts the mapped columns of a row to literals of their field
+// types. Without a column mapping, columns that are not fields are ignored.
+func sqlProps(fields map[string]catalog.FieldSpec, columns map[string]string, row map[string]any) ([]parser.Property, error) {
+	if len(columns) == 0 {
+		columns = make(map[string]string)
+		for col := range row {
+			if _, ok := fields[col]; ok {
+				columns[col] = col
+			}
+		}
+	}
+	var props []parser.Property
+	for _, col := range sortedKeys(columns) {
+		name := columns[col]
+		spec := fields[name]
+		v, ok := row[col]
+		if !ok {
+			return nil, fmt.Errorf("no column '%s'", col)
+		}
+		if v == nil {
+			continue
+		}
+		lit, err := coerceLiteral(spec.Type, sqlText(v, spec.Type))
+		if err != nil {
+			return nil, fmt.Errorf("column '%s': %w", col, err)
+		}
+		props = append(props, parser.Prop(name, lit))
+	}
+	return props, nil
+}
+
+// sqlEdge builds the INSERT EDGE for one row of an edge table
+func sqlEdge(et *catalog.EdgeType, em SQLEdgeMapping, keys map[string]map[string]importedNode, row map[string]any) (parser.Stmt, error) {
+	var ends [2]importedNode
+	for i, ref := range []SQLRef{em.From, em.To} {
+		key := sqlText(row[ref.Column], catalog.TypeSpec{})
+		n, ok := keys[ref.Table][key]
+		if !ok {
+			return nil, fmt.Errorf("no imported %s row with key '%s'", ref.Table, key)
+		}
+		ends[i] = n
+	}
+	props, err := sqlProps(et.Props, em.Columns, row)
+	if err != nil {
+		return nil, err
+	}
+	if props, err = withDefaults(et.Props, props); err != nil {
+		return nil, err
+	}
+	return parser.InsertEdge(et.Name,
+		parser.NodeByID(ends[0].nodeType, parser.Str(ends[0].id)),
+		parser.NodeByID(ends[1].nodeType, parser.Str(ends[1].id)),
+		props...), nil
+}
+
+// sqlText renders a value a driver returned as the text coerceLiteral expects
+func sqlText(v any, t catalog.TypeSpec) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case time.Time:
+		switch t.Base {
+		case catalog.BaseDate:
+			return v.Format(time.DateOnly)
+		case catalog.BaseTime:
+			return v.Format(time.TimeOnly)
+		}
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,164 @@
+package grapho
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTables is a database/sql driver serving fixed result sets by query text
+type fakeTables map[string]fakeResult
+
+type fakeResult struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (t fakeTables) Connect(context.Context) (driver.Conn, error) { return fakeConn{t}, nil }
+func (t fakeTables) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ tables fakeTables }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	res, ok := c.tables[query]
+	if !ok {
+		return nil, fmt.Errorf("no such query: %s", query)
+	}
+	return &fakeRows{res: res}, nil
+}
+
+type fakeRows struct {
+	res fakeResult
+	i   int
+}
+
+func (r *fakeRows) Columns() []string { return r.res.cols }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i == len(r.res.rows) {
+		return io.EOF
+	}
+	copy(dest, r.res.rows[r.i])
+	r.i++
+	return nil
+}
+
+func TestImportSQL(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(ctx, t.TempDir())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	if err := db.Exec(ctx, `
+CREATE NODE Customer (name: string NOT NULL, joined: date);
+CREATE NODE Order (total: float, paid: bool);
+CREATE EDGE Placed (FROM Customer MANY, TO Order MANY);
+CREATE EDGE Referred (FROM Customer MANY, TO Customer MANY, PROPS (bonus: int));`); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+
+	src := sql.OpenDB(fakeTables{
+		"SELECT * FROM customers": {
+			cols: []string{"id", "name", "joined"},
+			rows: [][]driver.Value{
+				{int64(10), []byte("Ann"), time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)},
+				{int64(11), "Bob", nil},
+				{int64(12), nil, nil}, // violates NOT NULL
+			},
+		},
+		"SELECT * FROM orders WHERE total > 0": {
+			cols: []string{"order_no", "customer_id", "amount", "paid"},
+			rows: [][]driver.Value{
+				{"A1", int64(10), 9.5, true},
+				{"A2", int64(11), int64(3), false},
+				{"A3", nil, 1.0, true},      // no customer: no edge
+				{"A4", int64(12), 2.0, nil}, // customer 12 was skipped
+			},
+		},
+		"SELECT * FROM referrals": {
+			cols: []string{"referrer", "referee", "bonus"},
+			rows: [][]driver.Value{{int64(10), int64(11), int64(5)}},
+		},
+	})
+	defer src.Close()
+
+	mapping, err := ReadSQLMapping(strings.NewReader(`{
+		"nodes": [
+			{"table": "customers", "type": "Customer"},
+			{"table": "orders", "query": "SELECT * FROM orders WHERE total > 0", "type": "Order",
+			 "key": "order_no", "columns": {"amount": "total", "paid": "paid"}}
+		],
+		"edges": [
+			{"table": "orders", "query": "SELECT * FROM orders WHERE total > 0", "type": "Placed",
+			 "from": {"column": "customer_id", "table": "customers"}, "to": {"column": "order_no", "table": "orders"}},
+			{"table": "referrals", "type": "Referred",
+			 "from": {"column": "referrer", "table": "customers"}, "to": {"column": "referee", "table": "customers"}}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := db.ImportSQL(ctx, src, mapping)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if res.Inserted != 9 {
+		t.Errorf("inserted %d, want 9", res.Inserted)
+	}
+	var msgs []string
+	for _, e := range res.Errors {
+		msgs = append(msgs, e.Error())
+	}
+	want := []string{
+		"line 3: customers: field 'name' is NOT NULL but has no value",
+		"line 4: orders: no imported customers row with key '12'",
+	}
+	if strings.Join(msgs, "\n") != strings.Join(want, "\n") {
+		t.Errorf("errors:\n%s\nwant:\n%s", strings.Join(msgs, "\n"), strings.Join(want, "\n"))
+	}
+
+	rows, err := db.Query(ctx, "MATCH Customer WHERE name: 'Ann';")
+	if err != nil || len(rows) != 1 || fmt.Sprint(rows[0].Properties["joined"]) != "2023-05-01" {
+		t.Fatalf("Ann: %v %v", rows, err)
+	}
+	rows, err = db.Query(ctx, "MATCH Order WHERE paid: false;")
+	if err != nil || len(rows) != 1 || fmt.Sprint(rows[0].Properties["total"]) != "3" {
+		t.Fatalf("unpaid order: %v %v", rows, err)
+	}
+	var dump strings.Builder
+	if err := db.ExportJSONL(ctx, &dump); err != nil {
+		t.Fatal(err)
+	}
+	for _, edge := range []string{
+		`"type":"Placed","id":"edge_7","from":"1","to":"3","properties":{}`,
+		`"type":"Placed","id":"edge_8","from":"2","to":"4","properties":{}`,
+		`"type":"Referred","id":"edge_9","from":"1","to":"2","properties":{"bonus":5}`,
+	} {
+		if !strings.Contains(dump.String(), edge) {
+			t.Errorf("missing edge %s in:\n%s", edge, dump.String())
+		}
+	}
+	if n := strings.Count(dump.String(), `"kind":"edge"`); n != 3 {
+		t.Errorf("%d edges, want 3", n)
+	}
+
+	if _, err := ReadSQLMapping(strings.NewReader(`{"nodes": [{"tabel": "x"}]}`)); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+	bad := SQLMapping{Nodes: []SQLNodeMapping{{Table: "customers", Type: "Customer", Columns: map[string]string{"name": "nom"}}}}
+	if _, err := db.ImportSQL(ctx, src, bad); err == nil || !strings.Contains(err.Error(), "'nom'") {
+		t.Errorf("unknown field: got %v", err)
+	}
+}
@@ -0,0 +1,363 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"grapho/catalog"
+	"grapho/executor"
+	"grapho/parser"
+)
+
+/* ---------------------- Backups ---------------------- */
+
+// A backup is an archive of a data directory that can be taken while writes
+// go on: a catalog snapshot and a data file holding the graph as it was after
+// some commit log entry, the commit log from that entry on as far as it was
+// written while the graph was copied, and a manifest. Replaying the log tail
+// over the data file brings the graph up to the end of the backup. Snapshots
+// are held up while a backup is taken, so that they do not cut the tail.
+// An incremental backup holds only the commit log entries since an earlier
+// backup ended. grapho-server -restore checks an archive against its
+// manifest before it unpacks it into an empty data directory, or for an
+// incremental backup appends its entries to the log restored there.
+
+// BackupManifestFile names the manifest in a backup archive
+const BackupManifestFile = "BACKUP.json"
+
+// BackupManifest describes a backup archive. Commit log entries are numbered
+// from the first the log ever held, counting those snapshots cut, so
+// LogEntries of one backup is where an incremental backup after it starts.
+type BackupManifest struct {
+	Created     time.Time         `json:"created"`
+	Incremental bool              `json:"incremental,omitempty"` // the archive holds only a commit log
+	LogFormat   string            `json:"log_format,omitempty"`  // of commit.log, if the archive has one
+	Entries     int               `json:"entries"`               // commit log entries before those in the archive
+	LogEntries  int               `json:"log_entries"`           // commit log entries up to the end of the archive
+	LogOffset   int64             `json:"log_offset,omitempty"`  // commit log byte offset the archive ends at
+	Files       map[string]string `json:"files"`                 // SHA-256 of each other file, by name
+}
+
+// WriteBackup writes a backup archive to path: the catalog and graph of
+// view, taken when the commit log held entries entries, and the entries of
+// cl after those. cl may be nil for a server that keeps no log. The archive
+// is gzipped if path says so, and nothing is left at path unless all of it
+// is written.
+func WriteBackup(ctx context.Context, path string, view *executor.Executor, entries int, cl *CommitLog) (*BackupManifest, error) {
+	return writeBackup(ctx, path, &BackupManifest{Entries: entries}, cl, func(stage string) error {
+		cs, err := catalog.NewFileStore(stage)
+		if err != nil {
+			return err
+		}
+		if err := cs.Snapshot(ctx, view.Registry().Current()); err != nil {
+			return err
+		}
+		df, err := executor.OpenDataFile(stage)
+		if err != nil {
+			return err
+		}
+		err = view.CopyData(ctx, df, entries)
+		if cerr := df.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	})
+}
+
+// WriteIncrementalBackup writes a backup archive to path that holds only the
+// entries of cl after the first since, to be restored after a backup that
+// ends there. Those entries must still be in the log; see
+// CommitLog.KeepForBackups.
+func WriteIncrementalBackup(ctx context.Context, path string, since int, cl *CommitLog) (*BackupManifest, error) {
+	if cl == nil {
+		return nil, errors.New("incremental backups need a commit log")
+	}
+	return writeBackup(ctx, path, &BackupManifest{Incremental: true, Entries: since}, cl, nil)
+}
+
+// writeBackup stages the files fill writes, the commit log after m.Entries
+// and the manifest m, then archives them at path and records in the data
+// directory where the backup ended
+func writeBackup(ctx context.Context, path string, m *BackupManifest, cl *CommitLog, fill func(stage string) error) (*BackupManifest, error) {
+	stage, err := os.MkdirTemp(filepath.Dir(path), ".backup-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(stage)
+
+	m.Created, m.LogEntries, m.Files = time.Now().UTC(), m.Entries, map[string]string{}
+	if fill != nil {
+		if err := fill(stage); err != nil {
+			return nil, err
+		}
+	}
+	if cl != nil {
+		m.LogFormat = cl.format.String()
+		f, err := os.Create(filepath.Join(stage, "commit.log"))
+		if err != nil {
+			return nil, err
+		}
+		m.LogEntries, m.LogOffset, err = cl.WriteTail(ctx, f, m.Entries)
+		if err := syncClose(f, err); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := filepath.WalkDir(stage, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		sum, err := fileSum(p)
+		if err != nil {
+			return err
+		}
+		name, _ := filepath.Rel(stage, p)
+		m.Files[filepath.ToSlash(name)] = sum
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(stage, BackupManifestFile), data, 0o644); err != nil {
+		return nil, err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	_, err = WriteArchive(f, stage, IsGzip(path))
+	if err = syncClose(f, err); err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if cl != nil {
+		if err := WriteOffset(cl.backupOffsetPath(), m.LogOffset); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// syncClose syncs and closes f, which err, if set, says failed to be written
+func syncClose(f *os.File, err error) error {
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// fileSum returns the hex SHA-256 of the file at path
+func fileSum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// RestoreBackup unpacks the backup archive at path into dir once it has
+// checked every file against the manifest and found the commit log in
+// format. A full backup goes into a dir that is empty or does not exist; an
+// incremental one adds its commit log entries to a dir a backup was restored
+// into, which must hold those before them. Nothing is written to dir unless
+// the archive checks out. Opening dir then replays the log tail over the data
+// file, which brings the graph up to the end of the last backup restored.
+func RestoreBackup(path, dir string, format LogFormat) (*BackupManifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stage, err := os.MkdirTemp(filepath.Dir(filepath.Clean(dir)), ".restore-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(stage)
+	if _, err := ReadArchive(f, stage, IsGzip(path)); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(stage, BackupManifestFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s is not a backup archive: it has no %s", path, BackupManifestFile)
+	} else if err != nil {
+		return nil, err
+	}
+	m := &BackupManifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", BackupManifestFile, err)
+	}
+	if err := m.check(stage, format); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if m.Incremental {
+		if err := appendBackupLog(stage, dir, m, format); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return m, nil
+	}
+
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("%s is not empty", dir)
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	// the manifest describes the archive, not the data directory
+	if err := os.Remove(filepath.Join(stage, BackupManifestFile)); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(stage, 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err := os.Rename(stage, dir); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// appendBackupLog appends the commit log entries of the incremental backup
+// m, unpacked in stage, to the commit log in dir
+func appendBackupLog(stage, dir string, m *BackupManifest, format LogFormat) error {
+	ctx := context.Background()
+	if _, err := os.Stat(filepath.Join(dir, "commit.log")); err != nil {
+		return fmt.Errorf("an incremental backup goes after another backup: %w", err)
+	}
+	dst, err := OpenCommitLogWithFormat(dir, format)
+	if err != nil {
+		return err
+	}
+	defer dst.file.Close()
+	n := dst.Dropped()
+	end, err := dst.ReadFrom(ctx, 0, func(string, int64) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if info, err := dst.file.Stat(); err != nil {
+		return err
+	} else if info.Size() != end-dst.base.offset+dst.base.size {
+		return fmt.Errorf("commit log in %s ends in a partial entry", dir)
+	}
+	if m.Entries > n {
+		return fmt.Errorf("backup starts after commit log entry %d, but %s holds only %d", m.Entries, dir, n)
+	}
+	if m.LogEntries <= n {
+		return fmt.Errorf("%s already holds the commit log entries up to %d", dir, m.LogEntries)
+	}
+
+	src, err := OpenCommitLogWithFormat(stage, format)
+	if err != nil {
+		return err
+	}
+	defer src.file.Close()
+	f, err := os.OpenFile(dst.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	_, _, err = src.writeTail(ctx, f, n, false)
+	return syncClose(f, err)
+}
+
+// check compares the files under dir, an unpacked archive, with m
+func (m *BackupManifest) check(dir string, format LogFormat) error {
+	if m.LogEntries < m.Entries {
+		return fmt.Errorf("manifest has %d commit log entries, fewer than the %d of the data file", m.LogEntries, m.Entries)
+	}
+	if _, ok := m.Files["commit.log"]; ok != (m.LogFormat != "") {
+		return errors.New("manifest and files disagree on whether there is a commit log")
+	}
+	if m.Incremental && m.LogFormat == "" {
+		return errors.New("incremental backup has no commit log")
+	}
+	if m.LogFormat != "" && m.LogFormat != format.String() {
+		return fmt.Errorf("commit log is in %s format, not %s", m.LogFormat, format)
+	}
+	seen := 0
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name, _ := filepath.Rel(dir, p)
+		name = filepath.ToSlash(name)
+		if name == BackupManifestFile {
+			return nil
+		}
+		want, ok := m.Files[name]
+		if !ok {
+			return fmt.Errorf("%s is not in the manifest", name)
+		}
+		sum, err := fileSum(p)
+		if err != nil {
+			return err
+		}
+		if sum != want {
+			return fmt.Errorf("%s does not match its checksum", name)
+		}
+		seen++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if seen < len(m.Files) {
+		for name := range m.Files {
+			if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+				return fmt.Errorf("%s is missing", name)
+			}
+		}
+	}
+	return nil
+}
+
+// LoneBackup returns the BACKUP statement of stmts if it is their only one.
+// BACKUP runs outside the executor, which refuses it among other statements.
+func LoneBackup(stmts []parser.Stmt) (*parser.BackupStmt, bool) {
+	if len(stmts) != 1 {
+		return nil, false
+	}
+	b, ok := stmts[0].(*parser.BackupStmt)
+	return b, ok
+}
+
+// BackupSince returns n for BACKUP ... SINCE n, or -1 for a full backup
+func BackupSince(stmt *parser.BackupStmt) (int, error) {
+	if stmt.Since == nil {
+		return -1, nil
+	}
+	n, err := strconv.Atoi(stmt.Since.Text)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("SINCE must be a non-negative integer, got %s", stmt.Since.Text)
+	}
+	return n, nil
+}
@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"grapho/catalog"
+	"grapho/executor"
+)
+
+// backupDB is an executor whose commands go to a commit log, as a server's do
+type backupDB struct {
+	t    *testing.T
+	dir  string
+	exec *executor.Executor
+	log  *CommitLog
+}
+
+func newBackupDB(t *testing.T) *backupDB {
+	t.Helper()
+	reg, err := catalog.Open(context.Background(), catalog.NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	db := &backupDB{t: t, dir: dir, exec: executor.New(reg), log: openLog(t, dir, LogFormatBinary, FlushPolicy{Sync: true})}
+	t.Cleanup(func() { db.log.Stop() })
+	return db
+}
+
+// run executes command and logs it
+func (db *backupDB) run(command string) {
+	db.t.Helper()
+	if err := db.exec.ExecuteScript(context.Background(), nil, command); err != nil {
+		db.t.Fatalf("%s: %v", command, err)
+	}
+	appendAll(db.t, db.log, command)
+}
+
+// restored returns the number of nodes of type in the data file restored to
+// dir, and the commit log entries to replay over it
+func restored(t *testing.T, dir, typ string) (int, []string) {
+	t.Helper()
+	ctx := context.Background()
+	store, err := catalog.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, err := catalog.Open(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	df, err := executor.OpenDataFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer df.Close()
+	e := executor.New(reg)
+	if err := e.LoadData(ctx, df); err != nil {
+		t.Fatalf("load %s: %v", dir, err)
+	}
+	cl, err := OpenCommitLogWithFormat(dir, LogFormatBinary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := replay(t, cl)
+	return e.Graph().Nodes[typ].Len(), lines
+}
+
+// rewrite unpacks the archive at path, applies change to its files and packs
+// them again
+func rewrite(t *testing.T, path string, change func(dir string)) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer f.Close()
+	stage := t.TempDir()
+	if _, err := ReadArchive(f, stage, IsGzip(path)); err != nil {
+		t.Fatalf("read archive: %v", err)
+	}
+	change(stage)
+	out := filepath.Join(t.TempDir(), "changed.tar")
+	w, err := os.Create(out)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	defer w.Close()
+	if _, err := WriteArchive(w, stage, false); err != nil {
+		t.Fatalf("write archive: %v", err)
+	}
+	return out
+}
+
+func TestBackup(t *testing.T) {
+	ctx := context.Background()
+	db := newBackupDB(t)
+	db.run("CREATE NODE User (email: string PRIMARY KEY);")
+	db.run("INSERT NODE User (email: 'alice@example.org');")
+	db.run("INSERT NODE User (email: 'bob@example.org');")
+
+	// a backup holds the commands committed while the graph was copied
+	view, entries := db.exec.Snapshot(), db.log.Entries()
+	db.run("INSERT NODE User (email: 'carol@example.org');")
+	for _, name := range []string{"full.tar", "full.tar.gz"} {
+		path := filepath.Join(t.TempDir(), name)
+		m, err := WriteBackup(ctx, path, view, entries, db.log)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if m.Incremental || m.Entries != entries || m.LogEntries != entries+1 {
+			t.Errorf("%s holds %d + %d entries, want %d + 1", name, m.Entries, m.LogEntries-m.Entries, entries)
+		}
+		if names := slices.Sorted(maps.Keys(m.Files)); !slices.Contains(names, "commit.log") || !slices.Contains(names, executor.DataFileName) {
+			t.Errorf("%s files %v lack the commit log or the data file", name, names)
+		}
+		to := filepath.Join(t.TempDir(), "data")
+		if _, err := RestoreBackup(path, to, LogFormatBinary); err != nil {
+			t.Fatalf("restore %s: %v", name, err)
+		}
+		n, lines := restored(t, to, "User")
+		if n != 2 || !slices.Equal(lines, []string{"INSERT NODE User (email: 'carol@example.org');"}) {
+			t.Errorf("restored %s: %d users and log %q, want 2 and carol's insert", name, n, lines)
+		}
+	}
+
+	// restoring checks the archive and where it goes
+	full := filepath.Join(t.TempDir(), "full.tar")
+	if _, err := WriteBackup(ctx, full, view, entries, db.log); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RestoreBackup(full, db.dir, LogFormatBinary); err == nil {
+		t.Error("restored into a non-empty directory")
+	}
+	if _, err := RestoreBackup(full, t.TempDir(), LogFormatText); err == nil {
+		t.Error("restored a binary commit log as text")
+	}
+	for name, change := range map[string]func(string){
+		"no manifest": func(dir string) { os.Remove(filepath.Join(dir, BackupManifestFile)) },
+		"corrupt log": func(dir string) {
+			if err := os.WriteFile(filepath.Join(dir, "commit.log"), []byte("garbage"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		},
+		"missing file": func(dir string) { os.Remove(filepath.Join(dir, executor.DataFileName)) },
+	} {
+		to := filepath.Join(t.TempDir(), "data")
+		if _, err := RestoreBackup(rewrite(t, full, change), to, LogFormatBinary); err == nil {
+			t.Errorf("restored an archive with %s", name)
+		}
+		if _, err := os.Stat(to); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("failed restore of an archive with %s left %s behind: %v", name, to, err)
+		}
+	}
+}
+
+func TestIncrementalBackup(t *testing.T) {
+	ctx := context.Background()
+	db := newBackupDB(t)
+	db.log.KeepForBackups(true)
+	db.run("CREATE NODE User (email: string PRIMARY KEY);")
+	db.run("INSERT NODE User (email: 'alice@example.org');")
+	backups := t.TempDir()
+	full, err := WriteBackup(ctx, filepath.Join(backups, "full.tar"), db.exec.Snapshot(), db.log.Entries(), db.log)
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+
+	// a truncate keeps the entries since the last backup
+	db.run("INSERT NODE User (email: 'bob@example.org');")
+	db.run("INSERT NODE User (email: 'carol@example.org');")
+	if err := db.log.Truncate(db.log.Entries(), math.MaxInt64); err != nil {
+		t.Fatal(err)
+	}
+	inc1, err := WriteIncrementalBackup(ctx, filepath.Join(backups, "inc1.tar"), full.LogEntries, db.log)
+	if err != nil {
+		t.Fatalf("incremental backup: %v", err)
+	}
+	if !inc1.Incremental || inc1.Entries != full.LogEntries || inc1.LogEntries != full.LogEntries+2 {
+		t.Errorf("incremental backup holds entries %d to %d, want %d to %d", inc1.Entries, inc1.LogEntries, full.LogEntries, full.LogEntries+2)
+	}
+	if names := slices.Sorted(maps.Keys(inc1.Files)); !slices.Equal(names, []string{"commit.log"}) {
+		t.Errorf("incremental backup files = %v, want only the commit log", names)
+	}
+	db.run("DELETE NODE User WHERE email: 'bob@example.org';")
+	if _, err := WriteIncrementalBackup(ctx, filepath.Join(backups, "inc2.tar"), inc1.LogEntries, db.log); err != nil {
+		t.Fatalf("incremental backup: %v", err)
+	}
+	if err := db.log.Truncate(db.log.Entries(), math.MaxInt64); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WriteIncrementalBackup(ctx, filepath.Join(backups, "cut.tar"), 0, db.log); err == nil {
+		t.Error("incremental backup of entries a truncate cut")
+	}
+	if _, err := WriteIncrementalBackup(ctx, filepath.Join(backups, "none.tar"), 0, nil); err == nil {
+		t.Error("incremental backup without a commit log")
+	}
+
+	restore := func(names ...string) (string, error) {
+		to := filepath.Join(t.TempDir(), "data")
+		for _, name := range names {
+			if _, err := RestoreBackup(filepath.Join(backups, name), to, LogFormatBinary); err != nil {
+				return to, err
+			}
+		}
+		return to, nil
+	}
+	to, err := restore("full.tar", "inc1.tar", "inc2.tar")
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	want := []string{
+		"INSERT NODE User (email: 'bob@example.org');",
+		"INSERT NODE User (email: 'carol@example.org');",
+		"DELETE NODE User WHERE email: 'bob@example.org';",
+	}
+	if n, lines := restored(t, to, "User"); n != 1 || !slices.Equal(lines, want) {
+		t.Errorf("restored %d users and log %q, want alice and %q", n, lines, want)
+	}
+
+	for _, names := range [][]string{
+		{"inc1.tar"},                         // no full backup
+		{"full.tar", "inc2.tar"},             // a gap
+		{"full.tar", "inc1.tar", "inc1.tar"}, // twice
+	} {
+		if _, err := restore(names...); err == nil {
+			t.Errorf("restored %v", names)
+		}
+	}
+}
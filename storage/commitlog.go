@@ -0,0 +1,817 @@
+// Package storage keeps what a database leaves on disk besides the catalog:
+// the commit log, the backup archives taken of it, the data size quota and
+// the saved planner statistics. The server and the embedded database in
+// package grapho both build on it.
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type CommitLog struct {
+	path    string
+	file    *os.File
+	w       *bufio.Writer
+	wmu     sync.Mutex // guards w and file between the writer and synchronous appends
+	mu      sync.Mutex
+	queue   chan logEntry
+	closed  chan struct{}
+	started bool
+	done    chan struct{}
+	format  LogFormat
+	mmap    bool // replay from a memory mapping; see UseMmap
+	backups bool // see KeepForBackups
+	policy  FlushPolicy
+	entries atomic.Int64 // see Entries
+	base    logBase      // see Truncate; guarded by wmu
+}
+
+// logBase records what Truncate cut from the front of the log. Offsets and
+// Entries keep counting what was cut, so the log opens with a header entry
+// saying how much that was, which is not replayed.
+type logBase struct {
+	offset  int64 // of the first entry kept
+	entries int   // entries cut
+	size    int64 // of the header in the file
+}
+
+// baseHeaderFormat spells the header; it reads as a comment to the parser
+const baseHeaderFormat = "-- base offset %d entries %d"
+
+// logEntry is a queued command; done, if set, receives the result of the
+// sync that makes it durable
+type logEntry struct {
+	line string
+	done chan error
+}
+
+// FlushPolicy controls when the commit log writes out and syncs the entries
+// it has buffered. Entries queued together are written as one batch, and the
+// batch is synced as soon as any of these holds.
+type FlushPolicy struct {
+	// MaxBytes syncs once this many bytes are waiting
+	MaxBytes int
+	// MaxDelay syncs this long after the first entry of a batch arrived
+	MaxDelay time.Duration
+	// Sync makes every Append wait until its entry is on disk, like AppendSync
+	Sync bool
+}
+
+// DefaultFlushPolicy syncs every 64 KiB, and within 10ms of a write
+var DefaultFlushPolicy = FlushPolicy{MaxBytes: 64 << 10, MaxDelay: 10 * time.Millisecond}
+
+// ErrLogClosed is returned by AppendSync once the log has been stopped
+var ErrLogClosed = errors.New("commit log closed")
+
+// ErrEmptyCommand is returned by Append for an empty command
+var ErrEmptyCommand = errors.New("empty command")
+
+// LogFormat controls how entries are encoded on disk
+type LogFormat int
+
+const (
+	LogFormatText LogFormat = iota
+	LogFormatBinary
+)
+
+func (f LogFormat) String() string {
+	if f == LogFormatBinary {
+		return "binary"
+	}
+	return "text"
+}
+
+// OpenCommitLog opens or creates an append-only commit log at dataDir/commit.log using text format
+func OpenCommitLog(dataDir string) (*CommitLog, error) {
+	return OpenCommitLogWithFormat(dataDir, LogFormatText)
+}
+
+// OpenCommitLogWithFormat opens or creates a commit log with the specified format
+func OpenCommitLogWithFormat(dataDir string, format LogFormat) (*CommitLog, error) {
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return nil, fmt.Errorf("mkdir data dir: %w", err)
+	}
+	p := filepath.Join(dataDir, "commit.log")
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open commit log: %w", err)
+	}
+	cl := &CommitLog{
+		path:   p,
+		file:   f,
+		w:      bufio.NewWriterSize(f, 64<<10),
+		queue:  make(chan logEntry, 1024),
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+		format: format,
+		policy: DefaultFlushPolicy,
+	}
+	if cl.base, err = readBase(f, format); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("open commit log: %w", err)
+	}
+	cl.entries.Store(int64(cl.base.entries))
+	return cl, nil
+}
+
+// readBase reads the header Truncate left at the start of f, if any
+func readBase(f *os.File, format LogFormat) (logBase, error) {
+	r := bufio.NewReader(io.NewSectionReader(f, 0, 1<<10))
+	var first string
+	switch format {
+	case LogFormatBinary:
+		var hdr [4]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return logBase{}, nil
+		}
+		n := int(hdr[0])<<24 | int(hdr[1])<<16 | int(hdr[2])<<8 | int(hdr[3])
+		if n > len(baseHeaderFormat)+40 {
+			return logBase{}, nil // too long to be the header
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return logBase{}, nil
+		}
+		first = string(buf)
+	default:
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return logBase{}, nil
+		}
+		first = strings.TrimSuffix(line, "\n")
+	}
+	if !strings.HasPrefix(first, "-- base ") {
+		return logBase{}, nil
+	}
+	var b logBase
+	if _, err := fmt.Sscanf(first, baseHeaderFormat, &b.offset, &b.entries); err != nil {
+		return logBase{}, fmt.Errorf("bad header %q: %w", first, err)
+	}
+	b.size = int64(len(baseHeader(format, b)))
+	return b, nil
+}
+
+// baseHeader encodes the header recording b
+func baseHeader(format LogFormat, b logBase) []byte {
+	line := fmt.Sprintf(baseHeaderFormat, b.offset, b.entries)
+	if format == LogFormatBinary {
+		n := len(line)
+		return append([]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}, line...)
+	}
+	return []byte(line + "\n")
+}
+
+// UseMmap makes Replay map the log into memory instead of reading it through
+// a buffer. Entries are decoded one at a time straight from the mapping, so
+// replay allocates only the commands it applies, and the file's pages live in
+// the OS page cache rather than the heap. Where mmap is unavailable the file
+// is read whole instead.
+func (cl *CommitLog) UseMmap(on bool) {
+	cl.mmap = on
+}
+
+// KeepForBackups makes Truncate keep the entries after the last backup, so
+// that the next can be an incremental one; see WriteIncrementalBackup. The
+// offset the last backup ended at is kept in backup.offset next to the log.
+// Until the next backup, the log then grows as it would without snapshots.
+func (cl *CommitLog) KeepForBackups(on bool) {
+	cl.backups = on
+}
+
+// Dir returns the data directory the log is in
+func (cl *CommitLog) Dir() string {
+	return filepath.Dir(cl.path)
+}
+
+// backupOffsetPath is where a backup leaves the offset it ended at
+func (cl *CommitLog) backupOffsetPath() string {
+	return filepath.Join(cl.Dir(), "backup.offset")
+}
+
+// SetFlushPolicy replaces DefaultFlushPolicy; call it before Start. Zero
+// fields keep their defaults.
+func (cl *CommitLog) SetFlushPolicy(p FlushPolicy) {
+	if p.MaxBytes <= 0 {
+		p.MaxBytes = DefaultFlushPolicy.MaxBytes
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = DefaultFlushPolicy.MaxDelay
+	}
+	cl.policy = p
+}
+
+// Start begins the background writer goroutine
+func (cl *CommitLog) Start() {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.started {
+		return
+	}
+	cl.started = true
+	go cl.run()
+}
+
+// Stop flushes and closes the log
+func (cl *CommitLog) Stop() error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if !cl.started {
+		return nil
+	}
+	close(cl.closed)
+	// wait for run() to finish draining
+	<-cl.done
+	if err := cl.w.Flush(); err != nil {
+		return err
+	}
+	if err := cl.file.Sync(); err != nil {
+		return err
+	}
+	return cl.file.Close()
+}
+
+// run writes queued entries in batches and syncs them as the flush policy
+// says. Nothing wakes it while the log is idle.
+func (cl *CommitLog) run() {
+	deadline := time.NewTimer(time.Hour)
+	deadline.Stop()
+	var (
+		pending int // bytes written since the last sync
+		armed   bool
+		waiters []chan error
+	)
+	write := func(e logEntry) {
+		if e.line != "" { // else only waiting for a sync; see Truncate
+			cl.wmu.Lock()
+			pending += cl.writeEntry(e.line)
+			cl.wmu.Unlock()
+		}
+		if e.done != nil {
+			waiters = append(waiters, e.done)
+		}
+	}
+	flush := func() {
+		cl.wmu.Lock()
+		err := cl.w.Flush()
+		if err == nil {
+			err = cl.file.Sync()
+		}
+		cl.wmu.Unlock()
+		for _, w := range waiters {
+			w <- err
+		}
+		waiters, pending = waiters[:0], 0
+		if armed {
+			deadline.Stop()
+			armed = false
+		}
+	}
+
+	for {
+		select {
+		case <-cl.closed:
+			// Drain remaining queued entries before exiting
+			for {
+				select {
+				case e := <-cl.queue:
+					write(e)
+				default:
+					flush()
+					close(cl.done)
+					return
+				}
+			}
+		case e := <-cl.queue:
+			write(e)
+			// take whatever else is already queued into the same batch
+		batch:
+			for pending < cl.policy.MaxBytes {
+				select {
+				case e := <-cl.queue:
+					write(e)
+				default:
+					break batch
+				}
+			}
+			switch {
+			case pending >= cl.policy.MaxBytes || len(waiters) > 0:
+				flush()
+			case !armed:
+				deadline.Reset(cl.policy.MaxDelay)
+				armed = true
+			}
+		case <-deadline.C:
+			armed = false
+			flush()
+		}
+	}
+}
+
+// writeEntry encodes a single command according to the configured format and
+// returns the number of bytes it took
+func (cl *CommitLog) writeEntry(line string) int {
+	switch cl.format {
+	case LogFormatBinary:
+		// Binary encoding: 4-byte big-endian length, followed by bytes
+		b := []byte(line)
+		var hdr [4]byte
+		n := len(b)
+		hdr[0] = byte(n >> 24)
+		hdr[1] = byte(n >> 16)
+		hdr[2] = byte(n >> 8)
+		hdr[3] = byte(n)
+		_, _ = cl.w.Write(hdr[:])
+		_, _ = cl.w.Write(b)
+		return 4 + n
+	default:
+		// Text format: one command per line
+		_, _ = cl.w.WriteString(line)
+		if len(line) == 0 || line[len(line)-1] != '\n' {
+			_ = cl.w.WriteByte('\n')
+			return len(line) + 1
+		}
+		return len(line)
+	}
+}
+
+// Entries returns the number of entries in the log: those Truncate cut,
+// those Replay has read, and those appended since. A command with line breaks
+// is several entries in the text format, one per line, as Replay reads it
+// back.
+func (cl *CommitLog) Entries() int {
+	return int(cl.entries.Load())
+}
+
+// count adds the entries command makes to Entries
+func (cl *CommitLog) count(command string) {
+	if cl.format == LogFormatBinary {
+		cl.entries.Add(1)
+		return
+	}
+	for _, line := range strings.Split(command, "\n") {
+		if strings.TrimSpace(line) != "" {
+			cl.entries.Add(1)
+		}
+	}
+}
+
+// Append enqueues a command to be written. Ordering is preserved by the single writer.
+// Nothing is written if ctx is already done. Under a FlushPolicy with Sync set
+// it waits like AppendSync.
+func (cl *CommitLog) Append(ctx context.Context, command string) error {
+	if cl.policy.Sync {
+		return cl.AppendSync(ctx, command)
+	}
+	if command == "" {
+		return ErrEmptyCommand
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cl.count(command)
+	select {
+	case cl.queue <- logEntry{line: command}:
+		return nil
+	default:
+		// queue is full; do a synchronous write to avoid losing entries
+		cl.wmu.Lock()
+		defer cl.wmu.Unlock()
+		cl.writeEntry(command)
+		return cl.w.Flush()
+	}
+}
+
+// AppendSync appends a command and waits until it, and everything queued
+// before it, has been synced to disk. The log must have been started. The writer syncs as soon as it has
+// written the command rather than waiting for the flush policy. If ctx ends
+// first, AppendSync returns ctx.Err() and the command may still be written.
+func (cl *CommitLog) AppendSync(ctx context.Context, command string) error {
+	done, err := cl.enqueue(ctx, command)
+	if err != nil {
+		return err
+	}
+	return cl.await(ctx, done)
+}
+
+// Enqueue appends a command like Append, but returns before waiting for the
+// sync a FlushPolicy with Sync set makes Append wait for, with a function that
+// waits for it; without Sync, the function returns nil at once. A caller
+// that appends under a lock, to keep commands in the order they ran, waits
+// after releasing it, so that commands arriving together share one sync.
+func (cl *CommitLog) Enqueue(ctx context.Context, command string) (wait func() error, err error) {
+	if !cl.policy.Sync {
+		return func() error { return nil }, cl.Append(ctx, command)
+	}
+	done, err := cl.enqueue(ctx, command)
+	if err != nil {
+		return nil, err
+	}
+	return func() error { return cl.await(ctx, done) }, nil
+}
+
+// enqueue queues command for the writer to sync as soon as it is written,
+// returning the channel the outcome of the sync comes on
+func (cl *CommitLog) enqueue(ctx context.Context, command string) (chan error, error) {
+	if command == "" {
+		return nil, ErrEmptyCommand
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	done := make(chan error, 1)
+	select {
+	case cl.queue <- logEntry{line: command, done: done}:
+		cl.count(command)
+		return done, nil
+	case <-cl.closed:
+		return nil, ErrLogClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// await waits for the sync of an entry enqueue queued
+func (cl *CommitLog) await(ctx context.Context, done chan error) error {
+	select {
+	case err := <-done:
+		return err
+	case <-cl.done:
+		// the writer drained and synced the queue before exiting
+		select {
+		case err := <-done:
+			return err
+		default:
+			return ErrLogClosed
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Replay reads the log from the beginning and invokes apply for each line.
+// apply should execute the command without re-appending to the log.
+// Replay stops with ctx.Err() between entries once ctx is done.
+func (cl *CommitLog) Replay(ctx context.Context, apply func(line string) error) error {
+	apply = cl.counted(apply)
+	f, err := os.Open(cl.path)
+	if err != nil {
+		return fmt.Errorf("open for replay: %w", err)
+	}
+	defer f.Close()
+	if cl.mmap {
+		data, unmap, err := mapFile(f)
+		if err != nil {
+			return fmt.Errorf("map for replay: %w", err)
+		}
+		defer unmap()
+		return cl.replayMapped(ctx, data[min(cl.base.size, int64(len(data))):], apply)
+	}
+	if _, err := f.Seek(cl.base.size, io.SeekStart); err != nil {
+		return fmt.Errorf("open for replay: %w", err)
+	}
+	switch cl.format {
+	case LogFormatBinary:
+		r := bufio.NewReader(f)
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var hdr [4]byte
+			if _, err := io.ReadFull(r, hdr[:]); err != nil {
+				if err == io.EOF || err == io.ErrUnexpectedEOF {
+					return nil
+				}
+				return fmt.Errorf("replay read header: %w", err)
+			}
+			n := int(hdr[0])<<24 | int(hdr[1])<<16 | int(hdr[2])<<8 | int(hdr[3])
+			if n < 0 || n > 10<<20 { // 10MB guard
+				return fmt.Errorf("invalid record length: %d", n)
+			}
+			buf := make([]byte, n)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return fmt.Errorf("replay read body: %w", err)
+			}
+			line := strings.TrimSpace(string(buf))
+			if line == "" {
+				continue
+			}
+			if err := apply(line); err != nil {
+				return fmt.Errorf("replay apply failed: %w", err)
+			}
+		}
+	default:
+		s := bufio.NewScanner(f)
+		s.Buffer(make([]byte, 0, 64<<10), 10<<20) // allow reasonably long commands
+		for s.Scan() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			line := s.Text()
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			if err := apply(line); err != nil {
+				return fmt.Errorf("replay apply failed: %w", err)
+			}
+		}
+		return s.Err()
+	}
+}
+
+// counted returns apply counting each entry it is called with in Entries
+func (cl *CommitLog) counted(apply func(line string) error) func(line string) error {
+	return func(line string) error {
+		cl.entries.Add(1)
+		return apply(line)
+	}
+}
+
+// replayMapped is Replay over a mapped log. Each entry is copied out of data
+// before it is applied, so nothing apply keeps refers to the mapping.
+func (cl *CommitLog) replayMapped(ctx context.Context, data []byte, apply func(line string) error) error {
+	for len(data) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var entry []byte
+		switch cl.format {
+		case LogFormatBinary:
+			if len(data) < 4 {
+				return nil // torn header, as in Replay
+			}
+			n := int(data[0])<<24 | int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+			if n < 0 || n > 10<<20 { // 10MB guard
+				return fmt.Errorf("invalid record length: %d", n)
+			}
+			if len(data)-4 < n {
+				return fmt.Errorf("replay read body: %w", io.ErrUnexpectedEOF)
+			}
+			entry, data = data[4:4+n], data[4+n:]
+		default:
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				i = len(data) - 1
+			}
+			entry, data = data[:i+1], data[i+1:]
+		}
+		line := strings.TrimSpace(string(entry))
+		if line == "" {
+			continue
+		}
+		if err := apply(line); err != nil {
+			return fmt.Errorf("replay apply failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// ReadFrom reads the entries written since byte offset pos and calls apply
+// with each one and the offset just past it, which is where the next read
+// should resume. Entries still sitting in the write buffer, or cut short by a
+// crash, are not visible yet, and reading resumes after those Truncate cut.
+// ReadFrom returns the offset after the last entry it read.
+func (cl *CommitLog) ReadFrom(ctx context.Context, pos int64, apply func(entry string, next int64) error) (int64, error) {
+	cl.wmu.Lock()
+	base := cl.base
+	f, err := os.Open(cl.path)
+	cl.wmu.Unlock()
+	if err != nil {
+		return pos, fmt.Errorf("open for read: %w", err)
+	}
+	defer f.Close()
+	pos = max(pos, base.offset)
+	if _, err := f.Seek(pos-base.offset+base.size, io.SeekStart); err != nil {
+		return pos, err
+	}
+	r := bufio.NewReader(f)
+	for {
+		if err := ctx.Err(); err != nil {
+			return pos, err
+		}
+		var entry []byte
+		var n int64
+		switch cl.format {
+		case LogFormatBinary:
+			var hdr [4]byte
+			if _, err := io.ReadFull(r, hdr[:]); err != nil {
+				return pos, nil // no complete entry yet
+			}
+			size := int(hdr[0])<<24 | int(hdr[1])<<16 | int(hdr[2])<<8 | int(hdr[3])
+			if size > 10<<20 {
+				return pos, fmt.Errorf("invalid record length at offset %d: %d", pos, size)
+			}
+			entry = make([]byte, size)
+			if _, err := io.ReadFull(r, entry); err != nil {
+				return pos, nil
+			}
+			n = int64(4 + size)
+		default:
+			line, err := r.ReadBytes('\n')
+			if err != nil {
+				return pos, nil
+			}
+			entry = line
+			n = int64(len(line))
+		}
+		pos += n
+		line := strings.TrimSpace(string(entry))
+		if line == "" {
+			continue
+		}
+		if err := apply(line, pos); err != nil {
+			return pos - n, err
+		}
+	}
+}
+
+// Dropped returns the number of entries Truncate cut from the log
+func (cl *CommitLog) Dropped() int {
+	cl.wmu.Lock()
+	defer cl.wmu.Unlock()
+	return cl.base.entries
+}
+
+// errCut stops the scan for where Truncate cuts
+var errCut = errors.New("cut here")
+
+// Truncate cuts the first entries entries from the front of the log, once
+// something else, such as a data file snapshot, holds their changes, but
+// keeps those that end after byte offset keepFrom, and with KeepForBackups
+// those after the last backup. The log is rewritten, so appends wait
+// meanwhile; a crash leaves the old log or the new one.
+func (cl *CommitLog) Truncate(entries int, keepFrom int64) error {
+	if cl.backups {
+		pos, err := ReadOffset(cl.backupOffsetPath())
+		if err != nil {
+			return err
+		}
+		if pos > 0 {
+			keepFrom = min(keepFrom, pos)
+		}
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if err := cl.writeOut(); err != nil {
+		return err
+	}
+	cl.wmu.Lock()
+	base := cl.base
+	cl.wmu.Unlock()
+	cut := logBase{offset: base.offset, entries: base.entries}
+	_, err := cl.ReadFrom(context.Background(), base.offset, func(_ string, next int64) error {
+		if cut.entries >= entries || next > keepFrom {
+			return errCut
+		}
+		cut.offset, cut.entries = next, cut.entries+1
+		return nil
+	})
+	if err != nil && err != errCut {
+		return err
+	}
+	if cut.entries == base.entries {
+		return nil
+	}
+
+	cl.wmu.Lock()
+	defer cl.wmu.Unlock()
+	if err := cl.w.Flush(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(cl.path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("truncate commit log: %w", err)
+	}
+	hdr := baseHeader(cl.format, cut)
+	cut.size = int64(len(hdr))
+	_, err = f.Write(hdr)
+	if err == nil {
+		from := cut.offset - base.offset + base.size
+		_, err = io.Copy(f, io.NewSectionReader(cl.file, from, 1<<62))
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), cl.path)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("truncate commit log: %w", err)
+	}
+	cl.file.Close()
+	cl.file = f
+	cl.w.Reset(f)
+	cl.base = cut
+	return nil
+}
+
+// WriteTail writes the log to w as a backup taken at entry from holds it: a
+// header saying the first from entries were cut, then the entries after
+// them, as far as they are written once those queued so far are. It returns
+// the number of entries the copy holds, counting those cut, and the offset
+// it ends at. The entries after from must still be in the log, so Truncate
+// must not run meanwhile.
+func (cl *CommitLog) WriteTail(ctx context.Context, w io.Writer, from int) (int, int64, error) {
+	return cl.writeTail(ctx, w, from, true)
+}
+
+// writeTail is WriteTail, leaving out the header unless header is set
+func (cl *CommitLog) writeTail(ctx context.Context, w io.Writer, from int, header bool) (int, int64, error) {
+	cl.mu.Lock()
+	err := cl.writeOut()
+	cl.mu.Unlock()
+	if err != nil {
+		return 0, 0, err
+	}
+	cl.wmu.Lock()
+	base := cl.base
+	cl.wmu.Unlock()
+	if from < base.entries {
+		return 0, 0, fmt.Errorf("commit log entries up to %d were cut, so those after %d are gone", base.entries, from)
+	}
+	start, n := base.offset, base.entries
+	end, err := cl.ReadFrom(ctx, base.offset, func(_ string, next int64) error {
+		if n++; n <= from {
+			start = next
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if n < from {
+		return 0, 0, fmt.Errorf("commit log holds %d entries, not %d", n, from)
+	}
+	f, err := os.Open(cl.path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	if header {
+		if _, err := w.Write(baseHeader(cl.format, logBase{offset: start, entries: from})); err != nil {
+			return 0, 0, err
+		}
+	}
+	if _, err := io.Copy(w, io.NewSectionReader(f, start-base.offset+base.size, end-start)); err != nil {
+		return 0, 0, err
+	}
+	return n, end, nil
+}
+
+// writeOut waits until the entries queued so far are written; cl.mu must be
+// held
+func (cl *CommitLog) writeOut() error {
+	if !cl.started {
+		cl.wmu.Lock()
+		defer cl.wmu.Unlock()
+		return cl.w.Flush()
+	}
+	select {
+	case <-cl.closed:
+		return ErrLogClosed
+	default:
+	}
+	done := make(chan error, 1)
+	cl.queue <- logEntry{done: done}
+	return <-done
+}
+
+// ReadOffset reads a commit log offset kept in a file, or 0 if there is none
+func ReadOffset(path string) (int64, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	pos, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad offset in %s: %w", path, err)
+	}
+	return pos, nil
+}
+
+// WriteOffset replaces an offset file, so a crash leaves the old or the new
+// offset and never a torn one
+func WriteOffset(path string, pos int64) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(pos, 10)+"\n"), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
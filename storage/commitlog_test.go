@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// openLog opens the commit log in dir and starts it
+func openLog(t *testing.T, dir string, format LogFormat, policy FlushPolicy) *CommitLog {
+	t.Helper()
+	cl, err := OpenCommitLogWithFormat(dir, format)
+	if err != nil {
+		t.Fatalf("open %s log: %v", format, err)
+	}
+	cl.SetFlushPolicy(policy)
+	cl.Start()
+	return cl
+}
+
+// appendAll appends commands to cl
+func appendAll(t *testing.T, cl *CommitLog, commands ...string) {
+	t.Helper()
+	for _, c := range commands {
+		if err := cl.Append(context.Background(), c); err != nil {
+			t.Fatalf("append %q: %v", c, err)
+		}
+	}
+}
+
+// replay returns the entries Replay reads from cl
+func replay(t *testing.T, cl *CommitLog) []string {
+	t.Helper()
+	var lines []string
+	err := cl.Replay(context.Background(), func(line string) error {
+		lines = append(lines, line)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	return lines
+}
+
+// logSize returns the size of the commit log in dir
+func logSize(t *testing.T, dir string) int64 {
+	t.Helper()
+	info, err := os.Stat(filepath.Join(dir, "commit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestCommitLogReplay(t *testing.T) {
+	commands := []string{"CREATE NODE A (x: int);", "INSERT NODE A (x: 1);", "INSERT NODE A (x: 2);"}
+	tests := []struct {
+		name   string
+		format LogFormat
+		mmap   bool
+	}{
+		{name: "text", format: LogFormatText},
+		{name: "binary", format: LogFormatBinary},
+		{name: "text mapped", format: LogFormatText, mmap: true},
+		{name: "binary mapped", format: LogFormatBinary, mmap: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cl, err := OpenCommitLogWithFormat(dir, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cl.UseMmap(tt.mmap)
+			if lines := replay(t, cl); len(lines) != 0 { // maps an empty log
+				t.Errorf("replayed %q from an empty log", lines)
+			}
+			cl.Start()
+			appendAll(t, cl, commands...)
+			if err := cl.Stop(); err != nil {
+				t.Fatal(err)
+			}
+			if tt.format == LogFormatBinary {
+				// a header torn by a crash is ignored
+				f, err := os.OpenFile(filepath.Join(dir, "commit.log"), os.O_APPEND|os.O_WRONLY, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				f.Write([]byte{0, 0})
+				f.Close()
+			}
+
+			cl, err = OpenCommitLogWithFormat(dir, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cl.UseMmap(tt.mmap)
+			if lines := replay(t, cl); !slices.Equal(lines, commands) {
+				t.Errorf("replayed %q, want %q", lines, commands)
+			}
+			if n := cl.Entries(); n != len(commands) {
+				t.Errorf("%d entries after replay, want %d", n, len(commands))
+			}
+		})
+	}
+}
+
+func TestCommitLogFlushPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	// a sync append is on disk when it returns
+	dir := t.TempDir()
+	cl := openLog(t, dir, LogFormatBinary, FlushPolicy{Sync: true})
+	appendAll(t, cl, "CREATE NODE A (x: int);")
+	if logSize(t, dir) == 0 {
+		t.Error("sync append: log empty after Append")
+	}
+	wait, err := cl.Enqueue(ctx, "INSERT NODE A (x: 1);")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(); err != nil {
+		t.Fatal(err)
+	}
+	size := logSize(t, dir)
+	if err := cl.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if logSize(t, dir) != size {
+		t.Error("enqueue: the wait returned before the entry was synced")
+	}
+
+	// otherwise the write lands once the delay has passed, without a Stop
+	dir = t.TempDir()
+	cl = openLog(t, dir, LogFormatBinary, FlushPolicy{MaxDelay: 20 * time.Millisecond})
+	defer cl.Stop()
+	appendAll(t, cl, "CREATE NODE A (x: int);")
+	for start := time.Now(); logSize(t, dir) == 0; time.Sleep(5 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("log still empty after 5s")
+		}
+	}
+
+	// or once enough has been buffered, or the log is stopped
+	dir = t.TempDir()
+	lazy := openLog(t, dir, LogFormatText, FlushPolicy{MaxBytes: 1 << 20, MaxDelay: time.Hour})
+	appendAll(t, lazy, "CREATE NODE A (x: int);")
+	time.Sleep(20 * time.Millisecond)
+	if n := logSize(t, dir); n != 0 {
+		t.Errorf("lazy policy: %d bytes written before a sync was due", n)
+	}
+	if err := lazy.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if logSize(t, dir) == 0 {
+		t.Error("lazy policy: log empty after Stop")
+	}
+	if err := lazy.AppendSync(ctx, "INSERT NODE A (x: 1);"); err != ErrLogClosed {
+		t.Errorf("append to a stopped log: %v, want %v", err, ErrLogClosed)
+	}
+}
+
+func TestCommitLogTruncate(t *testing.T) {
+	ctx := context.Background()
+	commands := []string{"CREATE NODE A (x: int);", "INSERT NODE A (x: 1);", "INSERT NODE A (x: 2);", "INSERT NODE A (x: 3);", "INSERT NODE A (x: 4);"}
+	for _, format := range []LogFormat{LogFormatText, LogFormatBinary} {
+		t.Run(format.String(), func(t *testing.T) {
+			dir := t.TempDir()
+			cl := openLog(t, dir, format, FlushPolicy{Sync: true})
+			appendAll(t, cl, commands...)
+			var offsets []int64
+			if _, err := cl.ReadFrom(ctx, 0, func(_ string, next int64) error {
+				offsets = append(offsets, next)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if len(offsets) != len(commands) {
+				t.Fatalf("read %d entries, want %d", len(offsets), len(commands))
+			}
+
+			// the entries after keepFrom stay
+			if err := cl.Truncate(3, offsets[0]); err != nil {
+				t.Fatal(err)
+			}
+			if cl.Dropped() != 1 || cl.Entries() != len(commands) {
+				t.Errorf("dropped %d of %d entries, want 1 of %d", cl.Dropped(), cl.Entries(), len(commands))
+			}
+			if err := cl.Truncate(3, math.MaxInt64); err != nil {
+				t.Fatal(err)
+			}
+			if cl.Dropped() != 3 {
+				t.Errorf("dropped %d entries, want 3", cl.Dropped())
+			}
+			// offsets keep counting what was cut
+			var next []int64
+			if _, err := cl.ReadFrom(ctx, 0, func(_ string, n int64) error {
+				next = append(next, n)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(next, offsets[3:]) {
+				t.Errorf("offsets after a truncate are %v, want %v", next, offsets[3:])
+			}
+			appendAll(t, cl, "INSERT NODE A (x: 5);")
+			if err := cl.Stop(); err != nil {
+				t.Fatal(err)
+			}
+
+			cl, err := OpenCommitLogWithFormat(dir, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := append(slices.Clone(commands[3:]), "INSERT NODE A (x: 5);")
+			if lines := replay(t, cl); !slices.Equal(lines, want) {
+				t.Errorf("replayed %q, want %q", lines, want)
+			}
+			if cl.Dropped() != 3 || cl.Entries() != 6 {
+				t.Errorf("reopened with %d of %d entries dropped, want 3 of 6", cl.Dropped(), cl.Entries())
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package storage
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads f into memory where mmap is not available
+func mapFile(f *os.File) (data []byte, unmap func() error, err error) {
+	data, err = io.ReadAll(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
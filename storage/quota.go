@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"grapho/executor"
+	"grapho/parser"
+)
+
+/* ---------------------- Disk quota ---------------------- */
+
+// A quota bounds the size of a data directory. Once the files in it come
+// within a reserve of the limit, scripts that would grow the graph or the
+// catalog are refused with ErrQuotaExceeded before they run, so that the
+// commit log is never left short of the disk space a sync needs. Scripts that
+// only delete still run, as do queries, and the next snapshot wins their
+// space back. The directory is walked at most once an interval, when a
+// script is checked; in between, the bytes appended to the commit log are
+// added to the last measurement.
+
+// ErrQuotaExceeded is what scripts that would write fail with while the data
+// directory is at its quota
+var ErrQuotaExceeded = errors.New("data directory is at its size quota")
+
+// DefaultQuotaInterval is how stale a quota's measurement of the data
+// directory may get unless QuotaConfig says otherwise
+const DefaultQuotaInterval = 10 * time.Second
+
+// QuotaConfig configures a Quota
+type QuotaConfig struct {
+	MaxBytes int64         // most bytes the data directory may hold
+	Reserve  int64         // writes stop this far short of MaxBytes; default a twentieth of it
+	Interval time.Duration // most time between walks of the directory; default DefaultQuotaInterval
+}
+
+// QuotaStats reports how full the data directory is
+type QuotaStats struct {
+	Used     int64     `json:"used"`  // bytes, as of the last walk plus the log appended since
+	Limit    int64     `json:"limit"` // bytes past which writes are refused
+	MaxBytes int64     `json:"max_bytes"`
+	Refused  int       `json:"refused"`  // scripts refused
+	Measured time.Time `json:"measured"` // time of the last walk
+}
+
+// Quota tracks the size of a data directory against its limit. It is safe
+// for concurrent use.
+type Quota struct {
+	dir string
+	cfg QuotaConfig
+
+	mu    sync.Mutex
+	stats QuotaStats
+}
+
+// NewQuota returns a quota on dir, which it measures at once
+func NewQuota(dir string, cfg QuotaConfig) (*Quota, error) {
+	if cfg.MaxBytes <= 0 {
+		return nil, fmt.Errorf("quota must be positive, got %d bytes", cfg.MaxBytes)
+	}
+	if cfg.Reserve == 0 {
+		cfg.Reserve = cfg.MaxBytes / 20
+	}
+	if cfg.Reserve < 0 || cfg.Reserve >= cfg.MaxBytes {
+		return nil, fmt.Errorf("quota reserve must be between 0 and %d bytes, got %d", cfg.MaxBytes, cfg.Reserve)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultQuotaInterval
+	}
+	q := &Quota{dir: dir, cfg: cfg}
+	q.stats.MaxBytes, q.stats.Limit = cfg.MaxBytes, cfg.MaxBytes-cfg.Reserve
+	if err := q.measure(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Check returns ErrQuotaExceeded if the data directory is at its limit and
+// any of stmts would write more than deletions; see executor.OnlyDeletes
+func (q *Quota) Check(stmts []parser.Stmt) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if time.Since(q.stats.Measured) >= q.cfg.Interval {
+		if err := q.measure(); err != nil {
+			return fmt.Errorf("quota: %w", err)
+		}
+	}
+	if q.stats.Used < q.stats.Limit {
+		return nil
+	}
+	for _, st := range stmts {
+		if executor.Mutates(st) && !executor.OnlyDeletes(st) {
+			q.stats.Refused++
+			return fmt.Errorf("%w: %d of %d bytes used; only deletes run until space is freed", ErrQuotaExceeded, q.stats.Used, q.cfg.MaxBytes)
+		}
+	}
+	return nil
+}
+
+// Grew adds n bytes written to the commit log to the last measurement
+func (q *Quota) Grew(n int) {
+	q.mu.Lock()
+	q.stats.Used += int64(n)
+	q.mu.Unlock()
+}
+
+// Stats returns how full the data directory was when last checked
+func (q *Quota) Stats() QuotaStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.stats
+}
+
+// measure walks the data directory; q.mu must be held
+func (q *Quota) measure() error {
+	var used int64
+	err := filepath.WalkDir(q.dir, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // removed as it was walked, e.g. by a snapshot
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		used += info.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	q.stats.Used, q.stats.Measured = used, time.Now()
+	return nil
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"grapho/parser"
+)
+
+func TestNewQuota(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     QuotaConfig
+		limit   int64
+		wantErr bool
+	}{
+		{name: "default reserve", cfg: QuotaConfig{MaxBytes: 2000}, limit: 1900},
+		{name: "reserve", cfg: QuotaConfig{MaxBytes: 2000, Reserve: 500}, limit: 1500},
+		{name: "no limit", cfg: QuotaConfig{}, wantErr: true},
+		{name: "negative limit", cfg: QuotaConfig{MaxBytes: -1}, wantErr: true},
+		{name: "negative reserve", cfg: QuotaConfig{MaxBytes: 2000, Reserve: -1}, wantErr: true},
+		{name: "reserve past the limit", cfg: QuotaConfig{MaxBytes: 2000, Reserve: 2000}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := NewQuota(t.TempDir(), tt.cfg)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("NewQuota(%+v) accepted it", tt.cfg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewQuota(%+v): %v", tt.cfg, err)
+			}
+			if st := q.Stats(); st.Limit != tt.limit || st.MaxBytes != tt.cfg.MaxBytes || st.Used != 0 {
+				t.Errorf("stats %+v, want a limit of %d", st, tt.limit)
+			}
+		})
+	}
+}
+
+func TestQuota(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "sub", "data")
+	if err := os.MkdirAll(filepath.Dir(data), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(data, make([]byte, 900), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := NewQuota(dir, QuotaConfig{MaxBytes: 1000, Reserve: 50, Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := NewQuota(dir, QuotaConfig{MaxBytes: 1000, Reserve: 50, Interval: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := stale.Stats(); st.Used != 900 || st.Limit != 950 {
+		t.Errorf("measured %+v, want 900 of 950 bytes used", st)
+	}
+
+	check := func(q *Quota, script string, refused bool) {
+		t.Helper()
+		err := q.Check(parse(t, script))
+		if refused != errors.Is(err, ErrQuotaExceeded) || !refused && err != nil {
+			t.Errorf("%s: %v, refused %v", script, err, refused)
+		}
+	}
+	check(stale, "INSERT NODE A (x: 1);", false)
+
+	// appends count until the next walk
+	stale.Grew(60)
+	for _, tt := range []struct {
+		script  string
+		refused bool
+	}{
+		{script: "MATCH A;"},
+		{script: "SHOW STATS;"},
+		{script: "DELETE NODE A WHERE x: 1;"},
+		{script: "MATCH (a:A) DELETE a;"},
+		{script: "DROP NODE A;"},
+		{script: "INSERT NODE A (x: 1);", refused: true},
+		{script: "CREATE NODE B (x: int);", refused: true},
+		{script: "MATCH (a:A) SET a.x: 2;", refused: true},
+		{script: "DELETE NODE A WHERE x: 1; INSERT NODE A (x: 2);", refused: true},
+	} {
+		check(stale, tt.script, tt.refused)
+	}
+	if st := stale.Stats(); st.Used != 960 || st.Refused != 4 {
+		t.Errorf("stats %+v, want 960 bytes used and 4 scripts refused", st)
+	}
+
+	// the space freed shows at the next walk
+	fresh.Grew(60)
+	check(fresh, "INSERT NODE A (x: 1);", false) // walked again, without the 60
+	if err := os.WriteFile(data, make([]byte, 980), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	check(fresh, "INSERT NODE A (x: 1);", true)
+	check(stale, "INSERT NODE A (x: 1);", true)
+	if err := os.Remove(data); err != nil {
+		t.Fatal(err)
+	}
+	check(fresh, "INSERT NODE A (x: 1);", false)
+	check(stale, "INSERT NODE A (x: 1);", true)
+	if st := fresh.Stats(); st.Used != 0 {
+		t.Errorf("measured %d bytes after the file went", st.Used)
+	}
+}
+
+// parse parses script, failing the test on a parse error
+func parse(t *testing.T, script string) []parser.Stmt {
+	t.Helper()
+	stmts, errs := parser.NewParser(script).ParseScript()
+	if len(errs) > 0 {
+		t.Fatalf("%s: %v", script, errs)
+	}
+	return stmts
+}
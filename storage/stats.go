@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"grapho/executor"
+)
+
+// StatsFile is the file in a data directory statistics are kept in across
+// restarts
+const StatsFile = "stats.json"
+
+// LoadStats reads statistics saved by SaveStats, returning nil if there are
+// none
+func LoadStats(path string) (*executor.Statistics, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read statistics: %w", err)
+	}
+	var st executor.Statistics
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("read statistics %s: %w", path, err)
+	}
+	return &st, nil
+}
+
+// SaveStats replaces the statistics file, so a crash leaves the old or the new
+// statistics and never torn ones
+func SaveStats(path string, st *executor.Statistics) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
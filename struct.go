@@ -0,0 +1,312 @@
+package grapho
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"grapho/catalog"
+	"grapho/executor"
+	"grapho/parser"
+)
+
+// Struct fields map to node properties through the `grapho` tag:
+//
+//	type Person struct {
+//		ID    string `grapho:"_id"` // the node ID; filled by ScanStruct, and by InsertNode if it generates the key
+//		Name  string `grapho:"name"`
+//		Age   int    `grapho:"age"`
+//		Email *string // untagged: the lower-cased field name, "email"; nil means null
+//		Born  time.Time `grapho:"born"` // a date, time or datetime field
+//		Meta  map[string]any `grapho:"meta"` // a json field, or its text in a string
+//		Photo []byte `grapho:"photo"` // a blob field, or its base64 in a string
+//		Notes string `grapho:"-"` // never mapped
+//	}
+//
+// The mapping is checked against the catalog the first time a struct type is
+// used with a node type, and again whenever the schema changes.
+
+const idProperty = "_id"
+
+// structField maps one Go field to a property
+type structField struct {
+	index []int
+	name  string
+	base  catalog.BaseType // of the field, which spells a time.Time
+}
+
+type mappingKey struct {
+	typ      reflect.Type
+	nodeType string
+	version  uint64
+}
+
+var mappings sync.Map // mappingKey -> []structField
+
+// structMapping returns the checked property mapping of struct type t for nodeType
+func structMapping(cat *catalog.Catalog, t reflect.Type, nodeType string) ([]structField, error) {
+	key := mappingKey{typ: t, nodeType: nodeType, version: cat.Version}
+	if m, ok := mappings.Load(key); ok {
+		return m.([]structField), nil
+	}
+
+	nt, ok := cat.Nodes[nodeType]
+	if !ok {
+		return nil, fmt.Errorf("grapho: node type '%s' does not exist", nodeType)
+	}
+	var fields []structField
+	for _, f := range reflect.VisibleFields(t) {
+		var base catalog.BaseType
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		name := f.Tag.Get("grapho")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		if name == idProperty {
+			if f.Type.Kind() != reflect.String {
+				return nil, fmt.Errorf("grapho: %s.%s: %s must be a string", t, f.Name, idProperty)
+			}
+		} else {
+			spec, ok := nt.Fields[name]
+			if !ok {
+				return nil, fmt.Errorf("grapho: %s.%s: %s has no field '%s'", t, f.Name, nodeType, name)
+			}
+			if !compatible(f.Type, spec.Type) {
+				return nil, fmt.Errorf("grapho: %s.%s: %s cannot hold %s.%s", t, f.Name, f.Type, nodeType, name)
+			}
+			base = spec.Type.Base
+		}
+		fields = append(fields, structField{index: f.Index, name: name, base: base})
+	}
+	mappings.Store(key, fields)
+	return fields, nil
+}
+
+// compatible reports whether Go type t can hold values of the catalog type
+func compatible(t reflect.Type, spec catalog.TypeSpec) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Interface {
+		return true
+	}
+	if t == timeType {
+		return spec.Elem == nil && (spec.Base == catalog.BaseDate || spec.Base == catalog.BaseTime || spec.Base == catalog.BaseDateTime)
+	}
+	switch spec.Base {
+	case catalog.BaseInt:
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return true
+		}
+		return false
+	case catalog.BaseFloat:
+		return t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64
+	case catalog.BaseBool:
+		return t.Kind() == reflect.Bool
+	case catalog.BaseArray:
+		return false
+	case catalog.BaseJSON:
+		// a document decodes into maps, slices and structs, or is its text
+		switch t.Kind() {
+		case reflect.String, reflect.Map, reflect.Slice, reflect.Struct:
+			return true
+		}
+		return false
+	case catalog.BaseBlob:
+		// the bytes, or their base64
+		return t == bytesType || t.Kind() == reflect.String
+	default:
+		// strings, text, UUIDs and enums are stored as text, and times are
+		// written as it
+		return t.Kind() == reflect.String
+	}
+}
+
+// structPointer checks that v is a non-nil pointer to a struct
+func structPointer(v any) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("grapho: expected a non-nil pointer to a struct, got %T", v)
+	}
+	return rv.Elem(), nil
+}
+
+// ScanStruct copies the current row into the struct dst points to, using the
+// row's node type to check the mapping. Properties the row lacks are left alone.
+func (r *Rows) ScanStruct(dst any) error {
+	rv, err := structPointer(dst)
+	if err != nil {
+		return err
+	}
+	fields, err := structMapping(r.db.exec.Registry().Current(), rv.Type(), r.cur.Type)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		v, ok := r.cur.Properties[f.name]
+		if f.name == idProperty {
+			v, ok = r.cur.ID, true
+		}
+		if !ok {
+			continue
+		}
+		if err := setValue(rv.FieldByIndex(f.index), v); err != nil {
+			return fmt.Errorf("grapho: ScanStruct field %q: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// InsertNode inserts the struct src points to as a node of nodeType. Nil
+// pointer fields are inserted as null. A zero uuid primary key is left for
+// the database to generate, and then written back into src, as is the node
+// ID.
+func (db *DB) InsertNode(ctx context.Context, nodeType string, src any) error {
+	rv, err := structPointer(src)
+	if err != nil {
+		return err
+	}
+	cat := db.exec.Registry().Current()
+	fields, err := structMapping(cat, rv.Type(), nodeType)
+	if err != nil {
+		return err
+	}
+
+	var (
+		props     []parser.Property
+		keyFields []structField // to write a generated key into
+		generate  bool
+	)
+	for _, f := range fields {
+		v := rv.FieldByIndex(f.index)
+		if f.name == idProperty {
+			keyFields = append(keyFields, f)
+			continue
+		}
+		if f.name == cat.Nodes[nodeType].PK && f.base == catalog.BaseUUID && v.IsZero() {
+			keyFields = append(keyFields, f)
+			generate = true
+			continue
+		}
+		lit, err := literal(v, f.base)
+		if err != nil {
+			return fmt.Errorf("grapho: InsertNode field %q: %w", f.name, err)
+		}
+		props = append(props, parser.Prop(f.name, lit))
+	}
+	stmt := parser.InsertNode(nodeType, props...)
+	if !generate {
+		return db.execStmt(ctx, stmt)
+	}
+	text, err := parser.Format(stmt)
+	if err != nil {
+		return fmt.Errorf("grapho: %w", err)
+	}
+	ids := &insertedIDs{}
+	if err := db.run(ctx, text, ids); err != nil {
+		return err
+	}
+	if len(ids.ids) == 1 {
+		for _, f := range keyFields {
+			if err := setValue(rv.FieldByIndex(f.index), ids.ids[0]); err != nil {
+				return fmt.Errorf("grapho: InsertNode field %q: %w", f.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// insertedIDs is the Output that collects the IDs of what a statement
+// inserts
+type insertedIDs struct {
+	ids []string
+}
+
+func (o *insertedIDs) Message(format string, args ...any) {}
+
+func (o *insertedIDs) ResultSet() {}
+
+func (o *insertedIDs) Row(nodeType, id string, props map[string]interface{}) {}
+
+func (o *insertedIDs) Changed(c executor.Change, msg string) {
+	o.ids = append(o.ids, c.IDs...)
+}
+
+// execStmt formats a built statement and executes it
+func (db *DB) execStmt(ctx context.Context, stmt parser.Stmt) error {
+	text, err := parser.Format(stmt)
+	if err != nil {
+		return fmt.Errorf("grapho: %w", err)
+	}
+	return db.Exec(ctx, text)
+}
+
+// timeType is the Go type of date, time and datetime values
+var timeType = reflect.TypeFor[time.Time]()
+
+// bytesType is the Go type of blob values
+var bytesType = reflect.TypeFor[[]byte]()
+
+// literal converts a Go value to a statement literal; a time.Time is spelt
+// as a value of a field of type base, anything but a string in a json field
+// as JSON, and a []byte as a blob
+func literal(v reflect.Value, base catalog.BaseType) (*parser.Literal, error) {
+	if v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return parser.Null(), nil
+		}
+		v = v.Elem()
+	}
+	if base == catalog.BaseJSON && v.Kind() != reflect.String {
+		b, err := json.Marshal(v.Interface())
+		if err != nil {
+			return nil, err
+		}
+		return &parser.Literal{Kind: parser.LitJSON, Text: string(b)}, nil
+	}
+	if v.Type() == bytesType {
+		return &parser.Literal{Kind: parser.LitBlob, Text: base64.StdEncoding.EncodeToString(v.Bytes())}, nil
+	}
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		switch base {
+		case catalog.BaseDate:
+			return parser.Str(t.Format(time.DateOnly)), nil
+		case catalog.BaseTime:
+			return parser.Str(t.Format("15:04:05.999999999Z07:00")), nil
+		}
+		return parser.Str(t.Format(time.RFC3339Nano)), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return parser.Str(v.String()), nil
+	case reflect.Bool:
+		return parser.Bool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return parser.Int(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &parser.Literal{Kind: parser.LitNumber, Text: strconv.FormatUint(v.Uint(), 10)}, nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("%v cannot be written as a literal", f)
+		}
+		return parser.Float(f), nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", v.Type())
+	}
+}
@@ -0,0 +1,181 @@
+package grapho
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+type person struct {
+	ID    string  `grapho:"_id"`
+	Name  string  `grapho:"name"`
+	Age   int     `grapho:"age"`
+	Email *string // maps to "email"
+	Notes string  `grapho:"-"`
+}
+
+func TestInsertNodeAndScanStruct(t *testing.T) {
+	db, ctx := openPeople(t)
+	if err := db.Exec(ctx, "ALTER NODE Person ADD email: string;"); err != nil {
+		t.Fatalf("alter: %v", err)
+	}
+
+	email := "o'neil@example.com"
+	in := person{Name: "O'Neil", Age: 52, Email: &email, Notes: "ignored"}
+	if err := db.InsertNode(ctx, "Person", &in); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	rows, err := db.QueryRows(ctx, "MATCH Person WHERE name: 'O''Neil';")
+	if err != nil {
+		t.Fatalf("query rows: %v", err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		t.Fatalf("no row: %v", rows.Err())
+	}
+	var out person
+	if err := rows.ScanStruct(&out); err != nil {
+		t.Fatalf("scan struct: %v", err)
+	}
+	if out.ID == "" || out.Name != in.Name || out.Age != 52 || out.Email == nil || *out.Email != email || out.Notes != "" {
+		t.Fatalf("got %+v", out)
+	}
+}
+
+func TestStructMappingChecksSchema(t *testing.T) {
+	db, ctx := openPeople(t)
+
+	type wrongType struct {
+		Age bool `grapho:"age"`
+	}
+	if err := db.InsertNode(ctx, "Person", &wrongType{}); err == nil || !strings.Contains(err.Error(), "cannot hold") {
+		t.Fatalf("expected type mismatch, got %v", err)
+	}
+
+	type unknownField struct {
+		Shoe int
+	}
+	if err := db.InsertNode(ctx, "Person", &unknownField{}); err == nil || !strings.Contains(err.Error(), "no field 'shoe'") {
+		t.Fatalf("expected unknown field, got %v", err)
+	}
+
+	if err := db.InsertNode(ctx, "Person", person{}); err == nil {
+		t.Fatal("expected error for non-pointer")
+	}
+	if err := db.InsertNode(ctx, "Robot", &person{}); err == nil {
+		t.Fatal("expected error for unknown node type")
+	}
+}
+
+func TestStructTimes(t *testing.T) {
+	db, ctx := openPeople(t)
+	if err := db.Exec(ctx, "ALTER NODE Person ADD born: date; ALTER NODE Person ADD seen: datetime; ALTER NODE Person ADD wakes: time;"); err != nil {
+		t.Fatalf("alter: %v", err)
+	}
+	type timed struct {
+		Name  string     `grapho:"name"`
+		Born  time.Time  `grapho:"born"`
+		Seen  *time.Time `grapho:"seen"`
+		Wakes time.Time  `grapho:"wakes"`
+	}
+	seen := time.Date(2024, 5, 1, 9, 30, 15, 500, time.FixedZone("", 2*3600))
+	in := timed{Name: "Ann", Born: time.Date(1990, 2, 3, 23, 0, 0, 0, time.UTC), Seen: &seen, Wakes: time.Date(0, 1, 1, 6, 45, 0, 0, time.UTC)}
+	if err := db.InsertNode(ctx, "Person", &in); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	found, err := FindNodes[timed](ctx, db, "Person", "born", time.Date(1990, 2, 3, 0, 0, 0, 0, time.UTC))
+	if err != nil || len(found) != 1 {
+		t.Fatalf("find: %v, %v", found, err)
+	}
+	out := found[0]
+	if !out.Born.Equal(time.Date(1990, 2, 3, 0, 0, 0, 0, time.UTC)) || out.Seen == nil || !out.Seen.Equal(seen) || !out.Wakes.Equal(in.Wakes) {
+		t.Fatalf("got %+v", out)
+	}
+	type wrong struct {
+		Age time.Time `grapho:"age"`
+	}
+	if err := db.InsertNode(ctx, "Person", &wrong{}); err == nil || !strings.Contains(err.Error(), "cannot hold") {
+		t.Fatalf("expected type mismatch, got %v", err)
+	}
+}
+
+func TestInsertNodeGeneratesKey(t *testing.T) {
+	db, ctx := openPeople(t)
+	if err := db.Exec(ctx, "CREATE NODE Badge (code: uuid PRIMARY KEY, label: string);"); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	type badge struct {
+		ID    string `grapho:"_id"`
+		Code  string `grapho:"code"`
+		Label string `grapho:"label"`
+	}
+	b := badge{Label: "guest"}
+	if err := db.InsertNode(ctx, "Badge", &b); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if len(b.Code) != 36 || b.ID != b.Code {
+		t.Fatalf("got %+v", b)
+	}
+	found, err := FindNodes[badge](ctx, db, "Badge", "code", b.Code)
+	if err != nil || len(found) != 1 || found[0] != b {
+		t.Fatalf("find: %v, %v", found, err)
+	}
+}
+
+func TestStructJSON(t *testing.T) {
+	db, ctx := openPeople(t)
+	if err := db.Exec(ctx, "CREATE NODE Profile (name: string PRIMARY KEY, meta: json, raw: json);"); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	type address struct {
+		City string `json:"city"`
+	}
+	type profile struct {
+		Name string         `grapho:"name"`
+		Meta map[string]any `grapho:"meta"`
+		Raw  string         `grapho:"raw"`
+	}
+	in := profile{Name: "ann", Meta: map[string]any{"address": address{City: "Bern"}, "n": 2}, Raw: `[1, 2]`}
+	if err := db.InsertNode(ctx, "Profile", &in); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	found, err := FindNodes[profile](ctx, db, "Profile", "name", "ann")
+	if err != nil || len(found) != 1 {
+		t.Fatalf("find: %v, %v", found, err)
+	}
+	out := found[0]
+	if out.Meta["address"].(map[string]any)["city"] != "Bern" || out.Meta["n"] != 2.0 || out.Raw != "[1,2]" {
+		t.Fatalf("got %+v", out)
+	}
+	type wrong struct {
+		Meta int `grapho:"meta"`
+	}
+	if err := db.InsertNode(ctx, "Profile", &wrong{}); err == nil || !strings.Contains(err.Error(), "cannot hold") {
+		t.Fatalf("expected type mismatch, got %v", err)
+	}
+}
+
+func TestStructBlob(t *testing.T) {
+	db, ctx := openPeople(t)
+	if err := db.Exec(ctx, "CREATE NODE File (name: string PRIMARY KEY, data: blob, thumb: blob);"); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	type file struct {
+		Name  string `grapho:"name"`
+		Data  []byte `grapho:"data"`
+		Thumb string `grapho:"thumb"`
+	}
+	in := file{Name: "logo", Data: []byte{0x89, 'P', 'N', 'G'}, Thumb: "aGk"}
+	if err := db.InsertNode(ctx, "File", &in); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	found, err := FindNodes[file](ctx, db, "File", "name", "logo")
+	if err != nil || len(found) != 1 {
+		t.Fatalf("find: %v, %v", found, err)
+	}
+	if out := found[0]; !bytes.Equal(out.Data, in.Data) || out.Thumb != "aGk=" {
+		t.Fatalf("got %+v", out)
+	}
+}
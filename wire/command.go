@@ -0,0 +1,49 @@
+package wire
+
+import (
+	"errors"
+	"strings"
+)
+
+// FoldCommand turns a script into the single request line the server expects:
+// comments are removed and line breaks outside quotes become spaces. The server
+// runs a command as soon as a line ends with ';', so a multi-line script sent
+// verbatim would otherwise be answered in several pieces.
+func FoldCommand(script string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(script); i++ {
+		ch := script[i]
+		switch {
+		case ch == '\'' || ch == '`':
+			j := i + 1
+			for j < len(script) && script[j] != ch {
+				if script[j] == '\n' || script[j] == '\r' {
+					return "", errors.New("wire: line break inside quoted text cannot be sent")
+				}
+				j++
+			}
+			if j >= len(script) {
+				return "", errors.New("wire: unterminated quoted text")
+			}
+			b.WriteString(script[i : j+1])
+			i = j
+		case ch == '-' && i+1 < len(script) && script[i+1] == '-':
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			b.WriteByte(' ')
+		case ch == '/' && i+1 < len(script) && script[i+1] == '*':
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				return "", errors.New("wire: unterminated block comment")
+			}
+			i += end + 3
+			b.WriteByte(' ')
+		case ch == '\n' || ch == '\r' || ch == '\t':
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return strings.TrimSpace(b.String()), nil
+}
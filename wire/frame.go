@@ -0,0 +1,157 @@
+// Package wire defines the framed response protocol spoken between the server and
+// clients that opt into it. Requests stay plain text lines terminated by ';'.
+package wire
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// FrameType identifies the payload carried by a frame
+type FrameType byte
+
+const (
+	FrameMessage   FrameType = iota + 1 // informational text
+	FrameResultSet                      // a result set follows as Row frames
+	FrameRow                            // one result row
+	FrameDone                           // command completed successfully
+	FrameError                          // command failed
+)
+
+// SwitchCommand is the line a text-mode client sends to switch its connection to frames
+const SwitchCommand = `\protocol framed`
+
+// LanguageCommand, followed by a space and LanguageGrapho or LanguageCypher,
+// selects the query language of the following commands on a connection
+const LanguageCommand = `\language`
+
+// CursorCommand, followed by a space and a MATCH, opens a cursor over the
+// rows of the MATCH instead of sending them, closing any cursor the
+// connection already has. FetchCommand, followed by a space and a count,
+// sends up to that many of its next rows. CloseCommand discards the rest.
+const (
+	CursorCommand = `\cursor`
+	FetchCommand  = `\fetch`
+	CloseCommand  = `\close`
+)
+
+// Query languages a connection can select with LanguageCommand
+const (
+	LanguageGrapho = "grapho"
+	LanguageCypher = "cypher"
+)
+
+// maxFrameSize guards against corrupt length headers
+const maxFrameSize = 16 << 20
+
+func (t FrameType) String() string {
+	switch t {
+	case FrameMessage:
+		return "MESSAGE"
+	case FrameResultSet:
+		return "RESULTSET"
+	case FrameRow:
+		return "ROW"
+	case FrameDone:
+		return "DONE"
+	case FrameError:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("FrameType(%d)", byte(t))
+	}
+}
+
+// Frame is a single protocol unit: 1-byte type, 4-byte big-endian length, payload
+type Frame struct {
+	Type    FrameType
+	Payload []byte
+}
+
+// Message is the payload of FrameMessage. Affected is set on the message
+// that sums up a write statement.
+type Message struct {
+	Text     string    `json:"text"`
+	Affected *Affected `json:"affected,omitempty"`
+}
+
+// Affected is what one or more write statements changed
+type Affected struct {
+	NodesInserted int      `json:"nodes_inserted"`
+	NodesUpdated  int      `json:"nodes_updated"`
+	NodesDeleted  int      `json:"nodes_deleted"`
+	EdgesInserted int      `json:"edges_inserted"`
+	EdgesUpdated  int      `json:"edges_updated"`
+	EdgesDeleted  int      `json:"edges_deleted"`
+	IDs           []string `json:"ids,omitempty"` // of the nodes and edges inserted
+	UpdatedIDs    []string `json:"updated_ids,omitempty"`
+	DeletedIDs    []string `json:"deleted_ids,omitempty"`
+}
+
+// ResultSet is the payload of FrameResultSet
+type ResultSet struct{}
+
+// Row is the payload of FrameRow
+type Row struct {
+	Type       string         `json:"type"`
+	ID         string         `json:"id"`
+	Properties map[string]any `json:"properties"`
+}
+
+// Done is the payload of FrameDone. After CursorCommand and FetchCommand,
+// More is set while the cursor has rows left.
+type Done struct {
+	Statements int  `json:"statements"`
+	More       bool `json:"more,omitempty"`
+}
+
+// Error is the payload of FrameError. Statement is the 1-based index of the failing
+// statement, or 0 when the command could not be parsed.
+type Error struct {
+	Statement int      `json:"statement"`
+	Messages  []string `json:"messages"`
+}
+
+// WriteFrame encodes v as JSON and writes it as a frame of type t
+func WriteFrame(w io.Writer, t FrameType, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("wire: encode %v: %w", t, err)
+	}
+	n := len(payload)
+	hdr := [5]byte{byte(t), byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err = w.Write(payload)
+	return err
+}
+
+// ReadFrame reads the next frame from r
+func ReadFrame(r io.Reader) (Frame, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return Frame{}, err
+	}
+	n := int(hdr[1])<<24 | int(hdr[2])<<16 | int(hdr[3])<<8 | int(hdr[4])
+	if n > maxFrameSize {
+		return Frame{}, fmt.Errorf("wire: frame too large: %d bytes", n)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return Frame{}, fmt.Errorf("wire: read payload: %w", err)
+	}
+	return Frame{Type: FrameType(hdr[0]), Payload: payload}, nil
+}
+
+// Decode unmarshals the frame payload into v. Numbers decode as json.Number so
+// integer values survive the round trip.
+func (f Frame) Decode(v any) error {
+	dec := json.NewDecoder(bytes.NewReader(f.Payload))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("wire: decode %v: %w", f.Type, err)
+	}
+	return nil
+}
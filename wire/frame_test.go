@@ -0,0 +1,144 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	row := Row{Type: "Person", ID: "1", Properties: map[string]any{"name": "Ann", "age": 42}}
+	if err := WriteFrame(&buf, FrameRow, row); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := WriteFrame(&buf, FrameDone, Done{Statements: 1}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	f, err := ReadFrame(&buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if f.Type != FrameRow {
+		t.Fatalf("want ROW, got %v", f.Type)
+	}
+	var got Row
+	if err := f.Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Type != "Person" || got.ID != "1" || got.Properties["name"] != "Ann" {
+		t.Fatalf("bad row: %#v", got)
+	}
+	if got.Properties["age"] != json.Number("42") {
+		t.Fatalf("want json.Number 42, got %#v", got.Properties["age"])
+	}
+
+	f, err = ReadFrame(&buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var done Done
+	if f.Type != FrameDone || f.Decode(&done) != nil || done.Statements != 1 {
+		t.Fatalf("bad done frame: %v %#v", f.Type, done)
+	}
+
+	if _, err := ReadFrame(&buf); err != io.EOF {
+		t.Fatalf("want EOF, got %v", err)
+	}
+}
+
+func TestRowWriterMatchesWriteFrame(t *testing.T) {
+	rows := []Row{
+		{Type: "Person", ID: "1", Properties: map[string]any{"name": "Ann", "age": "42", "ok": true, "none": nil}},
+		{Type: "Odd \"type\"", ID: "2", Properties: map[string]any{"s": "a<b>&c\n\t\x01\\ \u2028 \xff é"}},
+		{Type: "Empty", ID: "3", Properties: map[string]any{}},
+		{Type: "Nil", ID: "4"},
+		{Type: "Other", ID: "5", Properties: map[string]any{"n": int64(-7), "list": []any{"x", 1.5}}},
+		{Type: "Text", ID: "6", Properties: map[string]any{"at": time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)}},
+	}
+	var want, got bytes.Buffer
+	rw := NewRowWriter(&got)
+	for _, row := range rows {
+		if err := WriteFrame(&want, FrameRow, row); err != nil {
+			t.Fatalf("WriteFrame: %v", err)
+		}
+		if err := rw.WriteRow(row.Type, row.ID, row.Properties); err != nil {
+			t.Fatalf("WriteRow: %v", err)
+		}
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Fatalf("got  %q\nwant %q", got.Bytes(), want.Bytes())
+	}
+
+	props := map[string]any{"name": "Ann", "email": "ann@example.org", "age": "42", "ok": true}
+	rw = NewRowWriter(io.Discard)
+	if n := testing.AllocsPerRun(100, func() { rw.WriteRow("Person", "1", props) }); n != 0 {
+		t.Errorf("WriteRow allocates %v times per row, want 0", n)
+	}
+}
+
+func TestReadFrameRejectsOversizedLength(t *testing.T) {
+	hdr := []byte{byte(FrameRow), 0x7f, 0xff, 0xff, 0xff}
+	if _, err := ReadFrame(bytes.NewReader(hdr)); err == nil {
+		t.Fatal("expected error for oversized frame")
+	}
+}
+
+func TestReadFrameTruncatedPayload(t *testing.T) {
+	var buf bytes.Buffer
+	_ = WriteFrame(&buf, FrameMessage, Message{Text: "hello"})
+	b := buf.Bytes()[:buf.Len()-2]
+	if _, err := ReadFrame(bytes.NewReader(b)); err == nil {
+		t.Fatal("expected error for truncated payload")
+	}
+}
+
+func TestFoldCommand(t *testing.T) {
+	got, err := FoldCommand("CREATE NODE A ( -- comment ; here\n  x: int /* block\n */\n);\nINSERT NODE A (x: 1, s: 'a -- b');")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "CREATE NODE A ( x: int ); INSERT NODE A (x: 1, s: 'a -- b');"
+	if strings.Contains(got, "\n") || strings.Join(strings.Fields(got), " ") != want {
+		t.Fatalf("got %q\nwant %q", got, want)
+	}
+	if _, err := FoldCommand("INSERT NODE A (s: 'line\nbreak');"); err == nil {
+		t.Fatal("expected error for line break in string")
+	}
+}
+
+func TestMessageAffected(t *testing.T) {
+	var buf bytes.Buffer
+	msgs := []Message{
+		{Text: "Inserted node Person 1", Affected: &Affected{NodesInserted: 1, IDs: []string{"1"}}},
+		{Text: "Created node type Person"},
+	}
+	for _, m := range msgs {
+		if err := WriteFrame(&buf, FrameMessage, m); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if !strings.Contains(buf.String(), `"affected":{"nodes_inserted":1,`) || strings.Count(buf.String(), "affected") != 1 {
+		t.Fatalf("unexpected payloads: %q", buf.String())
+	}
+	for _, want := range msgs {
+		f, err := ReadFrame(&buf)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		var got Message
+		if f.Type != FrameMessage || f.Decode(&got) != nil {
+			t.Fatalf("bad message frame: %v", f.Type)
+		}
+		if got.Text != want.Text || (got.Affected == nil) != (want.Affected == nil) {
+			t.Fatalf("got %#v, want %#v", got, want)
+		}
+		if a := got.Affected; a != nil && (a.NodesInserted != 1 || len(a.IDs) != 1 || a.IDs[0] != "1") {
+			t.Fatalf("bad affected: %#v", a)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package wire
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+)
+
+// RowWriter writes Row frames for a stream of result rows. It produces the
+// same bytes as WriteFrame(w, FrameRow, Row{...}) but builds each frame in a
+// buffer it reuses, copying stored strings straight into the payload instead
+// of going through encoding/json, so a warmed-up writer allocates nothing for
+// rows whose values are strings, booleans or null. Other values fall back to
+// json.Marshal.
+type RowWriter struct {
+	w    io.Writer
+	buf  []byte
+	keys []string
+}
+
+// NewRowWriter returns a RowWriter that writes to w
+func NewRowWriter(w io.Writer) *RowWriter {
+	return &RowWriter{w: w}
+}
+
+// WriteRow writes one Row frame. Properties are written in key order, as
+// encoding/json writes maps.
+func (rw *RowWriter) WriteRow(nodeType, id string, props map[string]any) error {
+	b := append(rw.buf[:0], byte(FrameRow), 0, 0, 0, 0)
+	b = append(b, `{"type":`...)
+	b = appendString(b, nodeType)
+	b = append(b, `,"id":`...)
+	b = appendString(b, id)
+	b = append(b, `,"properties":`...)
+	if props == nil {
+		b = append(b, "null"...)
+	} else {
+		rw.keys = rw.keys[:0]
+		for k := range props {
+			rw.keys = append(rw.keys, k)
+		}
+		slices.Sort(rw.keys)
+		b = append(b, '{')
+		for i, k := range rw.keys {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendString(b, k)
+			b = append(b, ':')
+			var err error
+			if b, err = appendValue(b, props[k]); err != nil {
+				rw.buf = b
+				return fmt.Errorf("wire: encode %v: %w", FrameRow, err)
+			}
+		}
+		b = append(b, '}')
+	}
+	b = append(b, '}')
+
+	n := len(b) - 5
+	b[1], b[2], b[3], b[4] = byte(n>>24), byte(n>>16), byte(n>>8), byte(n)
+	rw.buf = b
+	_, err := rw.w.Write(b)
+	return err
+}
+
+// appendValue appends v as JSON
+func appendValue(b []byte, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, "null"...), nil
+	case string:
+		return appendString(b, v), nil
+	case bool:
+		return strconv.AppendBool(b, v), nil
+	case int64:
+		return strconv.AppendInt(b, v, 10), nil
+	case int:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case encoding.TextMarshaler:
+		// such as a stored time
+		text, err := v.MarshalText()
+		if err != nil {
+			return b, err
+		}
+		return appendString(b, string(text)), nil
+	}
+	js, err := json.Marshal(v)
+	if err != nil {
+		return b, err
+	}
+	return append(b, js...), nil
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendString appends s as a JSON string, escaped exactly as encoding/json
+// escapes it
+func appendString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			case '\b':
+				b = append(b, '\\', 'b')
+			case '\f':
+				b = append(b, '\\', 'f')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		// U+2028 and U+2029 end lines in JavaScript
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hexDigits[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}